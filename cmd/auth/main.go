@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,13 +13,31 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	grpchealthsrv "google.golang.org/grpc/health"
+	grpchealth "google.golang.org/grpc/health/grpc_health_v1"
 
+	"github.com/linkeunid/hello-go/pkg/alerting"
+	"github.com/linkeunid/hello-go/pkg/autotls"
+	"github.com/linkeunid/hello-go/pkg/capture"
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/discovery"
+	"github.com/linkeunid/hello-go/pkg/handoff"
+	"github.com/linkeunid/hello-go/pkg/health"
 	"github.com/linkeunid/hello-go/pkg/logger"
+	"github.com/linkeunid/hello-go/pkg/metrics"
 	"github.com/linkeunid/hello-go/pkg/middleware"
+	"github.com/linkeunid/hello-go/pkg/startup"
+	"github.com/linkeunid/hello-go/pkg/svid"
 
 	// Update import path to use the generated code in api/gen/auth
 	authpb "github.com/linkeunid/hello-go/api/gen/auth"
+	cachepb "github.com/linkeunid/hello-go/api/gen/cache"
+	databasepb "github.com/linkeunid/hello-go/api/gen/database"
+	flightrecorderpb "github.com/linkeunid/hello-go/api/gen/flightrecorder"
+	jobspb "github.com/linkeunid/hello-go/api/gen/jobs"
+	operationspb "github.com/linkeunid/hello-go/api/gen/operations"
+	readonlypb "github.com/linkeunid/hello-go/api/gen/readonly"
+	statuspb "github.com/linkeunid/hello-go/api/gen/status"
 	"github.com/linkeunid/hello-go/internal/auth/server"
 )
 
@@ -40,28 +57,122 @@ func main() {
 	}
 	defer log.Sync()
 
+	// Alerts fire on repeated dependency failures, open circuits and invalid token spikes
+	alerting.Init(cfg, "auth", log.Named("alerting"))
+
 	log.Info("Starting auth service",
 		zap.Int("http_port", cfg.Auth.ServicePort),
 		zap.Int("grpc_port", cfg.Auth.GRPCPort))
 
-	// Initialize gRPC server
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Auth.GRPCPort))
+	// Listeners are inherited from the previous process during zero-downtime restarts
+	upgrader, err := handoff.NewUpgrader(cfg, "auth", log.Named("handoff"))
+	if err != nil {
+		log.Fatal("Failed to initialize restart handoff", zap.Error(err))
+	}
+
+	// Bind the listeners first, so port conflicts are reported before connecting to dependencies
+	lis, err := upgrader.Listen("grpc", config.ListenAddress(cfg.Auth.GRPCListen, cfg.Auth.GRPCPort))
+	if err != nil {
+		log.Fatal("Failed to listen", zap.Error(err))
+	}
+	httpLis, err := upgrader.Listen("http", config.ListenAddress(cfg.Auth.HTTPListen, cfg.Auth.ServicePort))
 	if err != nil {
 		log.Fatal("Failed to listen", zap.Error(err))
 	}
 
-	// Create gRPC server with logging interceptor
-	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(middleware.GrpcLoggingInterceptor(log)),
-	)
+	// With SPIFFE, callers are authenticated by their SPIFFE ID over mTLS
+	serverCreds, gatewayCreds := insecure.NewCredentials(), insecure.NewCredentials()
+	if cfg.SPIFFE.Enabled {
+		source, err := svid.NewSource(cfg, log.Named("spiffe"))
+		if err != nil {
+			log.Fatal("Failed to obtain SVID", zap.Error(err))
+		}
+		defer source.Close()
+
+		// The gateway connects to the gRPC server with the service's own SVID
+		serverCreds, err = source.ServerCredentials(cfg.SPIFFE.AllowedIDs)
+		if err == nil {
+			gatewayCreds, err = source.ClientCredentials(source.ID().String())
+		}
+		if err != nil {
+			log.Fatal("Failed to set up SPIFFE credentials", zap.Error(err))
+		}
+	}
 
 	// Initialize auth server with logger
 	authServer := server.NewAuthServer(cfg, log)
+
+	// Capture anonymized traffic for replays when CAPTURE_DIR is set
+	capturer, err := capture.NewRecorder(cfg, "auth", log.Named("capture"))
+	if err != nil {
+		log.Fatal("Failed to start traffic capture", zap.Error(err))
+	}
+	defer capturer.Close()
+
+	// Create gRPC server with tracing, region, baggage, SLO, panic recovery, tenant, logging, flight recorder, read-only, metering, capture, caller allowlist, scope and step-up interceptors
+	jwtValidator := middleware.NewJWTValidator(cfg, log)
+	jwtValidator.Keyfunc = authServer.Keys().Keyfunc
+	grpcServer := grpc.NewServer(
+		grpc.Creds(serverCreds),
+		grpc.ChainUnaryInterceptor(
+			middleware.TraceInterceptor(cfg, log.Named("trace")),
+			middleware.RegionInterceptor(cfg, log.Named("region")),
+			middleware.BaggageInterceptor(cfg, log.Named("baggage")),
+			middleware.SLOInterceptor(cfg, log.Named("slo")),
+			middleware.RecoveryInterceptor(jwtValidator, cfg, log.Named("recovery")),
+			middleware.TenantInterceptor(jwtValidator, cfg, log.Named("tenant")),
+			middleware.GrpcLoggingInterceptor(cfg, log),
+			middleware.FlightRecorderInterceptor(authServer.Recorder(), jwtValidator, cfg),
+			middleware.ReadOnlyInterceptor(authServer.ReadOnlyMode(), log.Named("read_only")),
+			middleware.MeteringInterceptor(authServer.Meter(), jwtValidator, cfg),
+			middleware.CaptureInterceptor(capturer),
+			middleware.CallerAllowlistInterceptor(cfg, authServer.SecurityEvents(), log.Named("callers")),
+			middleware.ScopeInterceptor(jwtValidator, server.MethodScopes, log.Named("scopes")),
+			middleware.StepUpInterceptor(jwtValidator, server.StepUpMethods, cfg.Auth.StepUpMaxAge, log.Named("step_up")),
+		),
+	)
 	authpb.RegisterAuthServiceServer(grpcServer, authServer)
+	operationspb.RegisterOperationsServiceServer(grpcServer, authServer.Operations())
+	jobspb.RegisterDeadLetterServiceServer(grpcServer, authServer.DeadLetters())
+	flightrecorderpb.RegisterFlightRecorderServiceServer(grpcServer, authServer.FlightRecorder())
+	cachepb.RegisterCacheServiceServer(grpcServer, authServer.Caches())
+	databasepb.RegisterDatabaseServiceServer(grpcServer, authServer.Database())
+	readonlypb.RegisterReadOnlyServiceServer(grpcServer, authServer.ReadOnly())
+
+	// Register status and standard gRPC health services
+	checker := health.NewChecker("auth", cfg, log, authServer.Checks()...)
+	statuspb.RegisterStatusServiceServer(grpcServer, checker)
+	grpchealth.RegisterHealthServer(grpcServer, grpchealthsrv.NewServer())
+
+	// Check dependencies and log the startup summary, strict mode refuses to start without them
+	if err := startup.Preflight(context.Background(), cfg, log, checker, startup.Summary{
+		Service: "auth",
+		Ports: map[string]int{
+			"http": handoff.Port(httpLis),
+			"grpc": handoff.Port(lis),
+		},
+		Features: map[string]bool{
+			"mock_services": os.Getenv("USE_MOCK_SERVICES") == "true",
+			"acme":          cfg.ACME.Enabled,
+			"spiffe":        cfg.SPIFFE.Enabled,
+			"siem":          cfg.SIEM.Sink != "none",
+			"metering":      cfg.Metering.Enabled,
+			"read_only":     cfg.ReadOnly.Enabled,
+		},
+		Settings: map[string]string{
+			"profile":           cfg.Profile,
+			"region":            cfg.Region,
+			"database_driver":   cfg.Database.Driver,
+			"registration_mode": cfg.Auth.RegistrationMode,
+			"jwt_expiration":    cfg.Auth.JWTExpiration.String(),
+		},
+	}); err != nil {
+		log.Fatal("Failed to start auth service", zap.Error(err))
+	}
 
 	// Start gRPC server in a goroutine
 	go func() {
-		log.Info("Starting gRPC server", zap.Int("port", cfg.Auth.GRPCPort))
+		log.Info("Starting gRPC server", zap.String("address", lis.Addr().String()))
 		if err := grpcServer.Serve(lis); err != nil {
 			log.Fatal("Failed to serve gRPC", zap.Error(err))
 		}
@@ -71,45 +182,222 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	mux := runtime.NewServeMux()
-	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	mux := runtime.NewServeMux(
+		// Keep the caller's trace ID, baggage and tenant
+		runtime.WithMetadata(middleware.TraceAnnotator),
+		runtime.WithMetadata(middleware.RegionAnnotator),
+		runtime.WithMetadata(middleware.BaggageAnnotator),
+		runtime.WithMetadata(middleware.TenantAnnotator),
+		// Let browsers and CDNs cache responses as configured per route
+		runtime.WithMiddlewares(middleware.CacheRouteMiddleware),
+		runtime.WithForwardResponseOption(middleware.CacheControlResponseOption(cfg)),
+		// Answer rate limited requests with 429 and X-RateLimit-* headers
+		runtime.WithOutgoingHeaderMatcher(middleware.RateLimitHeaderMatcher),
+		runtime.WithErrorHandler(middleware.RateLimitErrorHandler),
+	)
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(gatewayCreds),
+		middleware.GatewayCallerCredentials(),
+	}
 
 	if err := authpb.RegisterAuthServiceHandlerFromEndpoint(
 		ctx,
 		mux,
-		fmt.Sprintf("localhost:%d", cfg.Auth.GRPCPort),
+		handoff.DialTarget(lis),
 		opts,
 	); err != nil {
 		log.Fatal("Failed to register gateway", zap.Error(err))
 	}
 
+	if err := operationspb.RegisterOperationsServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register operations gateway", zap.Error(err))
+	}
+
+	if err := jobspb.RegisterDeadLetterServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register dead letter gateway", zap.Error(err))
+	}
+
+	if err := flightrecorderpb.RegisterFlightRecorderServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register flight recorder gateway", zap.Error(err))
+	}
+
+	if err := cachepb.RegisterCacheServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register cache gateway", zap.Error(err))
+	}
+
+	if err := databasepb.RegisterDatabaseServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register database gateway", zap.Error(err))
+	}
+
+	if err := readonlypb.RegisterReadOnlyServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register read-only gateway", zap.Error(err))
+	}
+
+	if err := statuspb.RegisterStatusServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register status gateway", zap.Error(err))
+	}
+
+	// Serve liveness and readiness probes and the token signing keys next to the gateway
+	httpMux := http.NewServeMux()
+	httpMux.Handle("/health", checker.LivenessHandler())
+	httpMux.Handle("/ready", checker.ReadinessHandler())
+	httpMux.Handle(server.DiscoveryPath, authServer.DiscoveryHandler())
+	httpMux.Handle(server.JWKSPath, authServer.Keys().Handler())
+	httpMux.Handle("/", mux)
+
 	// Add logging middleware
-	httpHandler := middleware.LoggingMiddleware(log)(mux)
+	httpHandler := middleware.LoggingMiddleware(log)(httpMux)
 
 	// Start HTTP server
 	httpServer := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Auth.ServicePort),
 		Handler: httpHandler,
 	}
 
+	// Serve HTTPS with certificates from an ACME CA when enabled
+	if cfg.ACME.Enabled {
+		certManager, err := autotls.NewManager(cfg, log.Named("acme"))
+		if err != nil {
+			log.Fatal("Failed to set up ACME certificates", zap.Error(err))
+		}
+		httpServer.TLSConfig = certManager.TLSConfig()
+		// Handshake errors, e.g. for unknown host names, go to the structured log
+		httpServer.ErrorLog = zap.NewStdLog(log.Named("tls"))
+
+		if cfg.ACME.HTTPChallengeAddress != "" {
+			challengeLis, err := upgrader.Listen("acme", cfg.ACME.HTTPChallengeAddress)
+			if err != nil {
+				log.Fatal("Failed to listen", zap.Error(err))
+			}
+			go func() {
+				if err := certManager.ServeChallenges(challengeLis); err != nil {
+					log.Error("Failed to serve ACME challenges", zap.Error(err))
+				}
+			}()
+		}
+	}
+
 	// Start HTTP server in a goroutine
 	go func() {
-		log.Info("Starting HTTP server", zap.Int("port", cfg.Auth.ServicePort))
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Info("Starting HTTP server",
+			zap.String("address", httpLis.Addr().String()),
+			zap.Bool("tls", httpServer.TLSConfig != nil))
+
+		var err error
+		if httpServer.TLSConfig != nil {
+			err = httpServer.ServeTLS(httpLis, "", "")
+		} else {
+			err = httpServer.Serve(httpLis)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatal("Failed to serve HTTP", zap.Error(err))
 		}
 	}()
 
-	// Wait for interrupt signal to gracefully shut down the servers
+	// Serve Prometheus metrics, e.g. the SLO counters, apart from the public gateway
+	if cfg.Auth.MetricsPort > 0 {
+		metricsLis, err := upgrader.Listen("metrics", config.ListenAddress("", cfg.Auth.MetricsPort))
+		if err != nil {
+			log.Fatal("Failed to listen", zap.Error(err))
+		}
+		go func() {
+			log.Info("Starting metrics server", zap.String("address", metricsLis.Addr().String()))
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("/metrics", metrics.Handler())
+			if err := http.Serve(metricsLis, metricsMux); err != nil {
+				log.Error("Failed to serve metrics", zap.Error(err))
+			}
+		}()
+	}
+
+	// Work on background jobs like sending emails until shutdown
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobsDone := make(chan struct{})
+	go func() {
+		authServer.RunJobs(jobsCtx)
+		close(jobsDone)
+	}()
+
+	// Let the previous process, if any, shut down now that this one is serving
+	if err := upgrader.Ready(); err != nil {
+		log.Error("Failed to complete restart handoff", zap.Error(err))
+	}
+
+	// Register the ports, e.g. the ones picked for port 0, with service discovery
+	registration, err := discovery.Register(context.Background(), cfg, "auth", lis, httpLis, log.Named("discovery"))
+	if err != nil {
+		log.Error("Failed to register with service discovery", zap.Error(err))
+	}
+
+	// Wait for interrupt signal to gracefully shut down the servers.
+	// SIGHUP first hands the listeners over to a new process.
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	s := <-quit
-	log.Info("Shutting down servers", zap.String("signal", s.String()))
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for s := range quit {
+		if s == syscall.SIGHUP {
+			if err := upgrader.Upgrade(); err != nil {
+				log.Error("Zero-downtime restart failed, still serving", zap.Error(err))
+				continue
+			}
+		}
+		log.Info("Shutting down servers", zap.String("signal", s.String()))
+		break
+	}
+
+	// Stop sending new clients to this instance
+	deregisterCtx, cancelDeregister := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := registration.Deregister(deregisterCtx); err != nil {
+		log.Error("Failed to deregister from service discovery", zap.Error(err))
+	}
+	cancelDeregister()
 
 	// Gracefully stop the gRPC server
 	grpcServer.GracefulStop()
 	log.Info("gRPC server stopped")
 
+	// Let running jobs finish
+	stopJobs()
+	<-jobsDone
+
+	// Flush the security events of the finished requests
+	if err := authServer.Close(); err != nil {
+		log.Error("Failed to flush security events", zap.Error(err))
+	}
+
 	// Gracefully shut down the HTTP server
 	ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/backup"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	"github.com/linkeunid/hello-go/pkg/logger"
+)
+
+func main() {
+	restore := flag.Bool("restore", false, "restore a backup instead of creating one")
+	file := flag.String("file", "", "archive path to write (backup) or read (restore)")
+	upload := flag.Bool("upload", false, "upload the archive to the configured object store")
+	s3Key := flag.String("s3-key", "", "restore from this object store key instead of a local file")
+	replace := flag.Bool("replace", false, "delete existing rows of the archived tables before restoring")
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	log, err := logger.NewLogger(cfg)
+	if err != nil {
+		fmt.Printf("Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	// Connect to database
+	db, err := database.Open(cfg, log.Named("backup"))
+	if err != nil {
+		log.Fatal("Failed to connect to database", zap.Error(err))
+	}
+
+	b := backup.NewBackup(db, cfg.Backup.Tables, log.Named("backup"))
+	ctx := context.Background()
+
+	if *restore {
+		runRestore(ctx, cfg, b, log, *file, *s3Key, *replace)
+		return
+	}
+
+	runBackup(ctx, cfg, b, log, *file, *upload)
+}
+
+// runBackup exports the tables, optionally encrypting and uploading the archive
+func runBackup(ctx context.Context, cfg *config.Config, b *backup.Backup, log *zap.Logger, file string, upload bool) {
+	log.Info("Starting backup", zap.Strings("tables", cfg.Backup.Tables))
+
+	var buf bytes.Buffer
+	if err := b.Export(ctx, &buf); err != nil {
+		log.Fatal("Failed to export tables", zap.Error(err))
+	}
+
+	data := buf.Bytes()
+	name := fmt.Sprintf("backup-%s.json.gz", time.Now().UTC().Format("20060102T150405Z"))
+
+	// Encrypt when a key is configured
+	if cfg.Backup.EncryptionKey != "" {
+		encrypted, err := backup.Encrypt(data, cfg.Backup.EncryptionKey.Reveal())
+		if err != nil {
+			log.Fatal("Failed to encrypt archive", zap.Error(err))
+		}
+		data = encrypted
+		name += ".enc"
+	}
+
+	if file == "" {
+		file = name
+	}
+
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		log.Fatal("Failed to write archive", zap.String("file", file), zap.Error(err))
+	}
+
+	log.Info("Backup written",
+		zap.String("file", file),
+		zap.Int("bytes", len(data)),
+		zap.Bool("encrypted", cfg.Backup.EncryptionKey != ""))
+
+	if !upload {
+		return
+	}
+
+	store, err := backup.NewS3Store(cfg.Backup.S3)
+	if err != nil {
+		log.Fatal("Failed to create object store", zap.Error(err))
+	}
+
+	key := filepath.Base(file)
+	if err := store.Put(ctx, key, data); err != nil {
+		log.Fatal("Failed to upload archive", zap.String("key", key), zap.Error(err))
+	}
+
+	log.Info("Backup uploaded",
+		zap.String("bucket", cfg.Backup.S3.Bucket),
+		zap.String("key", cfg.Backup.S3.Prefix+key))
+}
+
+// runRestore loads an archive from a file or the object store and restores it
+func runRestore(ctx context.Context, cfg *config.Config, b *backup.Backup, log *zap.Logger, file, s3Key string, replace bool) {
+	var data []byte
+	var err error
+
+	switch {
+	case s3Key != "":
+		store, err := backup.NewS3Store(cfg.Backup.S3)
+		if err != nil {
+			log.Fatal("Failed to create object store", zap.Error(err))
+		}
+		data, err = store.Get(ctx, s3Key)
+		if err != nil {
+			log.Fatal("Failed to download archive", zap.String("key", s3Key), zap.Error(err))
+		}
+	case file != "":
+		data, err = os.ReadFile(file)
+		if err != nil {
+			log.Fatal("Failed to read archive", zap.String("file", file), zap.Error(err))
+		}
+	default:
+		log.Fatal("Restore requires -file or -s3-key")
+	}
+
+	// Decrypt archives produced with an encryption key
+	if backup.IsEncrypted(data) {
+		if cfg.Backup.EncryptionKey == "" {
+			log.Fatal("Archive is encrypted but BACKUP_ENCRYPTION_KEY is not set")
+		}
+		data, err = backup.Decrypt(data, cfg.Backup.EncryptionKey.Reveal())
+		if err != nil {
+			log.Fatal("Failed to decrypt archive", zap.Error(err))
+		}
+	}
+
+	header, err := b.Restore(ctx, bytes.NewReader(data), replace)
+	if err != nil {
+		log.Fatal("Failed to restore backup", zap.Error(err))
+	}
+
+	log.Info("Backup restored",
+		zap.Time("created_at", header.CreatedAt),
+		zap.Strings("tables", header.Tables))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/linkeunid/hello-go/internal/bench"
+)
+
+// The benchmarks are `Benchmark*` functions next to the code they measure, run
+// with `go test -bench`. This compares two saved outputs of such runs.
+func main() {
+	threshold := flag.Float64("threshold", 0.1, "fail when a benchmark is slower than the baseline by more than this fraction")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-threshold 0.1] baseline.txt current.txt\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	baseline, err := bench.Load(flag.Arg(0))
+	if err != nil {
+		fmt.Printf("Failed to load baseline: %v\n", err)
+		os.Exit(1)
+	}
+	current, err := bench.Load(flag.Arg(1))
+	if err != nil {
+		fmt.Printf("Failed to load results: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !baseline.SameMachine(current) {
+		fmt.Printf("Warning: the reports were measured on different machines (%s/%s %s and %s/%s %s)\n",
+			baseline.GOOS, baseline.GOARCH, baseline.CPU, current.GOOS, current.GOARCH, current.CPU)
+	}
+
+	regressed := false
+	fmt.Printf("Compared to %s (threshold %+.0f%%)\n", flag.Arg(0), *threshold*100)
+	for _, change := range bench.Compare(baseline, current) {
+		verdict := "ok"
+		if change.Regressed(*threshold) {
+			verdict = "REGRESSION"
+			regressed = true
+		}
+		fmt.Printf("%-72s %14.0f -> %14.0f ns/op %+7.1f%%  %s\n",
+			change.Name, change.Baseline, change.Current, change.Delta*100, verdict)
+	}
+
+	if regressed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/cdc"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	"github.com/linkeunid/hello-go/pkg/events"
+	"github.com/linkeunid/hello-go/pkg/logger"
+)
+
+// watchedTables lists the tables whose changes are published
+var watchedTables = []cdc.Table{
+	{
+		Name:      "users",
+		Key:       "id",
+		Entity:    "user",
+		Sensitive: []string{"password"},
+	},
+}
+
+func main() {
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	log, err := logger.NewLogger(cfg)
+	if err != nil {
+		fmt.Printf("Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	// Connect to database
+	db, err := database.Open(cfg, log.Named("cdc"))
+	if err != nil {
+		log.Fatal("Failed to connect to database", zap.Error(err))
+	}
+
+	publisher, err := events.NewPublisher(cfg, db, log.Named("events"))
+	if err != nil {
+		log.Fatal("Failed to create event publisher", zap.Error(err))
+	}
+
+	// Stream the binlog, or fall back to diffing snapshots
+	var capture interface{ Start(ctx context.Context) }
+	if cfg.CDC.Mode == config.CDCBinlog {
+		capture, err = cdc.NewListener(cfg, db, publisher, watchedTables, log.Named("cdc"))
+	} else {
+		capture, err = cdc.NewWatcher(cfg, db, publisher, watchedTables, log.Named("cdc"))
+	}
+	if err != nil {
+		log.Fatal("Failed to create change data capture", zap.String("mode", cfg.CDC.Mode), zap.Error(err))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stop capturing on interrupt
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+		log.Info("Shutting down change data capture", zap.String("signal", s.String()))
+		cancel()
+	}()
+
+	capture.Start(ctx)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/linkeunid/hello-go/pkg/configcrypt"
+)
+
+func main() {
+	keygen := flag.Bool("keygen", false, "generate an age identity, like age-keygen")
+	encrypt := flag.String("encrypt", "", "encrypt the value read from stdin for this variable, e.g. DB_PASSWORD")
+	decrypt := flag.Bool("decrypt", false, "decrypt the ENC[...] value read from stdin")
+	recipient := flag.String("recipient", os.Getenv("CONFIG_RECIPIENT"), "comma separated age recipients to encrypt to, defaults to CONFIG_RECIPIENT")
+	kmsKey := flag.String("kms-key", os.Getenv("CONFIG_KMS_KEY_ID"), "encrypt with this AWS KMS key instead, defaults to CONFIG_KMS_KEY_ID")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	switch {
+	case *keygen:
+		identity, recipient, err := configcrypt.GenerateIdentity()
+		if err != nil {
+			fail(err)
+		}
+		fmt.Fprintf(os.Stderr, "Public key: %s\n", recipient)
+		fmt.Printf("# public key: %s\n%s\n", recipient, identity)
+
+	case *encrypt != "":
+		var encrypter configcrypt.Encrypter
+		var err error
+		if *kmsKey != "" && *recipient == "" {
+			encrypter, err = configcrypt.NewKMSCipher(ctx, *kmsKey)
+		} else {
+			encrypter, err = configcrypt.NewAgeEncrypter(*recipient)
+		}
+		if err != nil {
+			fail(err)
+		}
+
+		value, err := configcrypt.Encrypt(ctx, encrypter, readValue())
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("%s=%s\n", *encrypt, value)
+
+	case *decrypt:
+		value := readValue()
+
+		var decrypter configcrypt.Decrypter
+		var err error
+		if configcrypt.Scheme(value) == configcrypt.SchemeKMS {
+			decrypter, err = configcrypt.NewKMSCipher(ctx, *kmsKey)
+		} else {
+			var identity string
+			if identity, err = configcrypt.IdentityFromEnv(); err == nil {
+				decrypter, err = configcrypt.NewAgeDecrypter(identity)
+			}
+		}
+		if err != nil {
+			fail(err)
+		}
+
+		plaintext, err := configcrypt.Decrypt(ctx, value, decrypter)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Println(plaintext)
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// readValue reads a value from stdin, without the trailing newline
+func readValue() string {
+	data, err := io.ReadAll(bufio.NewReader(os.Stdin))
+	if err != nil {
+		fail(err)
+	}
+	return strings.TrimRight(string(data), "\r\n")
+}
+
+// fail prints an error and exits
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/debugtoken"
+)
+
+func main() {
+	ttl := flag.Duration("ttl", 15*time.Minute, "how long the token is valid, at most 24h")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Logging.DebugKey == "" {
+		fmt.Println("LOG_DEBUG_KEY is not set")
+		os.Exit(1)
+	}
+	if *ttl <= 0 || *ttl > debugtoken.MaxLifetime {
+		fmt.Printf("-ttl must be between 0 and %s\n", debugtoken.MaxLifetime)
+		os.Exit(1)
+	}
+
+	expires := time.Now().Add(*ttl)
+	fmt.Fprintf(os.Stderr, "Debug token valid until %s\n", expires.UTC().Format(time.RFC3339))
+	fmt.Println(debugtoken.Sign(cfg.Logging.DebugKey.Reveal(), expires))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	authpb "github.com/linkeunid/hello-go/api/gen/auth"
+	userpb "github.com/linkeunid/hello-go/api/gen/user"
+	userv2pb "github.com/linkeunid/hello-go/api/gen/userv2"
+	authserver "github.com/linkeunid/hello-go/internal/auth/server"
+	"github.com/linkeunid/hello-go/internal/fuzz"
+	userserver "github.com/linkeunid/hello-go/internal/user/server"
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+func main() {
+	iterations := flag.Int("iterations", 200, "calls per method")
+	seed := flag.Uint64("seed", uint64(time.Now().UnixNano()), "seed of the generated requests, to reproduce a run")
+	malformed := flag.Float64("malformed", 0.3, "probability of a field getting an edge case value")
+	mutated := flag.Float64("mutated", 0.1, "share of calls whose encoded request is corrupted")
+	methods := flag.String("methods", "", "only call methods containing one of these comma-separated strings")
+	timeout := flag.Duration("timeout", 5*time.Second, "timeout of each call, longer calls are reported as hanging")
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Requests are fired at the mock services, so nothing is written to a database
+	// and the user service validates tokens itself
+	os.Setenv("USE_MOCK_SERVICES", "true")
+	os.Setenv("BYPASS_AUTH", "false")
+	log := zap.NewNop()
+
+	authServer := authserver.NewAuthServer(cfg, log)
+	defer authServer.Close()
+	userServer := userserver.NewUserServer(cfg, log)
+	defer userServer.Close()
+
+	// Handler panics would crash the process, the recoverer reports them
+	recoverer := fuzz.NewRecoverer()
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(recoverer.Interceptor()))
+	authpb.RegisterAuthServiceServer(grpcServer, authServer)
+	userpb.RegisterUserServiceServer(grpcServer, userServer)
+	userv2pb.RegisterUserServiceServer(grpcServer, userServer.V2())
+
+	lis := bufconn.Listen(1 << 20)
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///fuzz",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("Failed to connect to the services: %v\n", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Calls are made anonymously or as one of the seeded mock users
+	credentials := fuzz.Credentials{}
+	for name, login := range map[string]*authpb.LoginRequest{
+		"admin": {Email: "admin@example.com", Password: "admin123"},
+		"user":  {Email: "user@example.com", Password: "password123"},
+	} {
+		res, err := authpb.NewAuthServiceClient(conn).Login(ctx, login)
+		if err != nil {
+			fmt.Printf("Failed to log in as %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		credentials[name] = res.Token
+	}
+
+	all, err := fuzz.Methods("auth.AuthService", "user.UserService", "user.v2.UserService")
+	if err != nil {
+		fmt.Printf("Failed to list methods: %v\n", err)
+		os.Exit(1)
+	}
+	selected := all
+	if *methods != "" {
+		selected = nil
+		for _, method := range all {
+			for _, filter := range strings.Split(*methods, ",") {
+				if strings.Contains(string(method.FullName()), strings.TrimSpace(filter)) {
+					selected = append(selected, method)
+					break
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Fuzzing %d methods with seed %d\n\n", len(selected), *seed)
+	report, err := fuzz.Run(ctx, conn, fuzz.NewGenerator(*seed, *malformed), selected, fuzz.Options{
+		Iterations:  *iterations,
+		Mutated:     *mutated,
+		Timeout:     *timeout,
+		Credentials: credentials,
+		Recoverer:   recoverer,
+	})
+	if err != nil {
+		fmt.Printf("Fuzzing failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	report.Print(os.Stdout)
+	if report.Failed() {
+		fmt.Printf("\n%d findings, rerun with -seed %d to reproduce\n", len(report.Findings), *seed)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/migrations"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	"github.com/linkeunid/hello-go/pkg/logger"
+	"github.com/linkeunid/hello-go/pkg/migrate"
+)
+
+func main() {
+	check := flag.Bool("check", false, "check the live schema against the models of this binary")
+	phase := flag.String("phase", "", "apply pending migrations of the given phase (expand or contract)")
+	flag.Parse()
+
+	if !*check && *phase == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	log, err := logger.NewLogger(cfg)
+	if err != nil {
+		fmt.Printf("Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	// Connect to database
+	db, err := database.Open(cfg, log.Named("migrate"))
+	if err != nil {
+		log.Fatal("Failed to connect to database", zap.Error(err))
+	}
+
+	if *phase != "" {
+		migrator := migrate.NewMigrator(db, log.Named("migrate"))
+		if err := migrator.Apply(context.Background(), migrations.Migrations, migrate.Phase(*phase)); err != nil {
+			log.Fatal("Failed to apply migrations", zap.String("phase", *phase), zap.Error(err))
+		}
+		log.Info("Migrations applied", zap.String("phase", *phase))
+	}
+
+	if *check {
+		report, err := migrate.CheckCompatibility(db, migrations.Models()...)
+		if err != nil {
+			log.Fatal("Failed to check schema compatibility", zap.Error(err))
+		}
+
+		indexReport, err := migrate.CheckIndexes(db, migrations.Indexes()...)
+		if err != nil {
+			log.Fatal("Failed to check indexes", zap.Error(err))
+		}
+		report.Issues = append(report.Issues, indexReport.Issues...)
+
+		for _, issue := range report.Issues {
+			fmt.Printf("%-7s %s.%s: %s\n", issue.Severity, issue.Table, issue.Column, issue.Message)
+		}
+
+		if !report.Compatible() {
+			fmt.Println("Schema is NOT compatible with this binary")
+			os.Exit(1)
+		}
+		fmt.Println("Schema is compatible with this binary")
+	}
+}
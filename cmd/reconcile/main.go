@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/internal/reconcile"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	"github.com/linkeunid/hello-go/pkg/logger"
+)
+
+func main() {
+	repair := flag.Bool("repair", false, "repair the issues from the source of truth")
+	source := flag.String("source", "", "store to repair from, auth or user (default RECONCILE_SOURCE_OF_TRUTH)")
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	switch *source {
+	case "":
+	case config.SourceOfTruthAuth, config.SourceOfTruthUser:
+		cfg.Reconcile.SourceOfTruth = *source
+	default:
+		fmt.Printf("Invalid source %q, expected auth or user\n", *source)
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	log, err := logger.NewLogger(cfg)
+	if err != nil {
+		fmt.Printf("Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	// Connect to both stores
+	authDB, err := openStore(cfg, cfg.Reconcile.AuthDatabase, log.Named("auth"))
+	if err != nil {
+		log.Fatal("Failed to connect to auth database", zap.Error(err))
+	}
+	userDB, err := openStore(cfg, cfg.Reconcile.UserDatabase, log.Named("user"))
+	if err != nil {
+		log.Fatal("Failed to connect to user database", zap.Error(err))
+	}
+
+	// Stop the check on interrupt
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	checker := reconcile.NewChecker(cfg, authDB, userDB, log.Named("reconcile"))
+	report, err := checker.Run(ctx, *repair)
+	if err != nil {
+		log.Fatal("Failed to check consistency", zap.Error(err))
+	}
+	printReport(report)
+
+	// Fail while issues remain, so scheduled runs can alert
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			os.Exit(1)
+		}
+	}
+}
+
+// openStore connects to one of the compared databases
+func openStore(cfg *config.Config, dbCfg config.DatabaseConfig, log *zap.Logger) (*gorm.DB, error) {
+	storeCfg := *cfg
+	storeCfg.Database = dbCfg
+	return database.Open(&storeCfg, log)
+}
+
+// printReport prints a human-readable summary of a consistency check
+func printReport(report *reconcile.Report) {
+	mode := "check"
+	if report.Repair {
+		mode = "repair"
+	}
+
+	fmt.Printf("Consistency report (%s from %s, %s)\n", mode, report.SourceOfTruth, report.Duration)
+	fmt.Printf("  auth users: %d, user users: %d, issues: %d\n", report.AuthUsers, report.UserUsers, len(report.Issues))
+	for _, issue := range report.Issues {
+		status := ""
+		switch {
+		case issue.Err != nil:
+			status = fmt.Sprintf(" (repair failed: %v)", issue.Err)
+		case issue.Repaired:
+			status = " (repaired)"
+		case issue.Kind == reconcile.IssueOrphan:
+			status = " (review manually)"
+		}
+
+		switch issue.Kind {
+		case reconcile.IssueDrift:
+			fmt.Printf("  %-8s %s %s: auth %q, user %q%s\n",
+				issue.Kind, issue.UserID, issue.Field, issue.AuthValue, issue.UserValue, status)
+		case reconcile.IssueMissing:
+			fmt.Printf("  %-8s %s not in the %s store%s\n", issue.Kind, issue.UserID, otherStore(report.SourceOfTruth), status)
+		default:
+			fmt.Printf("  %-8s %s not in the %s store%s\n", issue.Kind, issue.UserID, report.SourceOfTruth, status)
+		}
+	}
+}
+
+// otherStore returns the store that isn't the source of truth
+func otherStore(source string) string {
+	if source == config.SourceOfTruthAuth {
+		return config.SourceOfTruthUser
+	}
+	return config.SourceOfTruthAuth
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	// Link the services' messages, replays look them up by method name
+	_ "github.com/linkeunid/hello-go/api/gen/auth"
+	_ "github.com/linkeunid/hello-go/api/gen/cache"
+	_ "github.com/linkeunid/hello-go/api/gen/flightrecorder"
+	_ "github.com/linkeunid/hello-go/api/gen/jobs"
+	_ "github.com/linkeunid/hello-go/api/gen/operations"
+	_ "github.com/linkeunid/hello-go/api/gen/status"
+	_ "github.com/linkeunid/hello-go/api/gen/user"
+	"github.com/linkeunid/hello-go/internal/replay"
+	"github.com/linkeunid/hello-go/pkg/capture"
+)
+
+func main() {
+	target := flag.String("target", "localhost:9092", "gRPC address of the build to replay against")
+	token := flag.String("token", "", "bearer token sent with every call, captured tokens are redacted")
+	includeRedacted := flag.Bool("include-redacted", false, "also replay calls whose passwords or tokens were redacted")
+	rate := flag.Float64("rate", 0, "calls per second, 0 for as fast as possible")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each call")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] capture.jsonl...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var records []capture.Record
+	for _, path := range flag.Args() {
+		fileRecords, err := capture.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Failed to read capture: %v\n", err)
+			os.Exit(1)
+		}
+		records = append(records, fileRecords...)
+	}
+
+	conn, err := grpc.NewClient(*target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("Failed to connect to %s: %v\n", *target, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := replay.Replay(ctx, conn, records, replay.Options{
+		Token:           *token,
+		IncludeRedacted: *includeRedacted,
+		Rate:            *rate,
+		Timeout:         *timeout,
+	})
+	if err != nil {
+		fmt.Printf("Replay failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	report.Print(os.Stdout)
+	if report.Failed() {
+		fmt.Println("\nSome calls ended with another status code than captured")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/retention"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	"github.com/linkeunid/hello-go/pkg/jobs"
+	"github.com/linkeunid/hello-go/pkg/logger"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+func main() {
+	once := flag.Bool("once", false, "run the retention policies once and exit")
+	dryRun := flag.Bool("dry-run", false, "only report matching records, do not modify anything")
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	log, err := logger.NewLogger(cfg)
+	if err != nil {
+		fmt.Printf("Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	// Connect to database
+	db, err := database.Open(cfg, log.Named("retention"))
+	if err != nil {
+		log.Fatal("Failed to connect to database", zap.Error(err))
+	}
+
+	runner := retention.NewRunner(cfg, db, log.Named("retention"))
+	if *dryRun {
+		runner.SetDryRun(true)
+	}
+
+	// Run a single pass and print the report
+	if *once {
+		report := runner.RunOnce(context.Background())
+		printReport(report)
+		return
+	}
+
+	if !cfg.Retention.Enabled {
+		log.Warn("Retention is disabled, set RETENTION_ENABLED=true or use -once")
+		return
+	}
+
+	// Expose metrics while running periodically
+	if cfg.Retention.MetricsPort > 0 {
+		go func() {
+			log.Info("Starting metrics server", zap.Int("port", cfg.Retention.MetricsPort))
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Retention.MetricsPort), mux); err != nil {
+				log.Error("Failed to serve metrics", zap.Error(err))
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Policies run as jobs so failures are retried and several instances share the work
+	queue, err := jobs.NewQueue(cfg, db, log.Named("jobs"))
+	if err != nil {
+		log.Fatal("Failed to create job queue", zap.Error(err))
+	}
+	runner.Register(queue)
+
+	workersDone := make(chan struct{})
+	go func() {
+		queue.Run(ctx)
+		close(workersDone)
+	}()
+
+	// Stop the runner on interrupt
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+		log.Info("Shutting down retention runner", zap.String("signal", s.String()))
+		cancel()
+	}()
+
+	runner.Start(ctx, queue)
+
+	// Let running policies finish
+	<-workersDone
+	if err := queue.Close(); err != nil {
+		log.Error("Failed to close job queue", zap.Error(err))
+	}
+}
+
+// printReport prints a human-readable summary of a retention run
+func printReport(report *retention.Report) {
+	mode := "applied"
+	if report.DryRun {
+		mode = "dry run"
+	}
+
+	fmt.Printf("Retention report (%s, %s)\n", mode, report.Duration)
+	for _, result := range report.Results {
+		switch {
+		case result.Err != nil:
+			fmt.Printf("  %-32s %-10s error: %v\n", result.Policy, result.Action, result.Err)
+		case result.Skipped:
+			fmt.Printf("  %-32s %-10s skipped (no %s table)\n", result.Policy, result.Action, result.Table)
+		default:
+			fmt.Printf("  %-32s %-10s %d records older than %s\n",
+				result.Policy, result.Action, result.Affected, result.Cutoff.Format("2006-01-02"))
+		}
+	}
+}
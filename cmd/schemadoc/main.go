@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/linkeunid/hello-go/internal/migrations"
+	"github.com/linkeunid/hello-go/internal/schemadoc"
+)
+
+func main() {
+	out := flag.String("out", "docs/schema.md", "write the schema documentation to this file")
+	diagram := flag.String("diagram", "docs/schema.mmd", "write the Mermaid ER diagram to this file")
+	check := flag.Bool("check", false, "fail if the files are out of date with the models instead of writing them")
+	flag.Parse()
+
+	// Descriptions are read from the source, run from the module root
+	models := append(migrations.Models(), migrations.SharedModels()...)
+	schema, err := schemadoc.Describe(".", models...)
+	if err != nil {
+		fmt.Printf("Failed to describe schema: %v\n", err)
+		os.Exit(1)
+	}
+
+	files := map[string]string{
+		*out:     schema.Markdown(),
+		*diagram: schema.Mermaid(),
+	}
+
+	if *check {
+		stale := false
+		for path, content := range files {
+			current, err := os.ReadFile(path)
+			if err != nil || !bytes.Equal(current, []byte(content)) {
+				fmt.Printf("%s is out of date\n", path)
+				stale = true
+			}
+		}
+		if stale {
+			fmt.Println("Models changed, regenerate the schema docs with `make schema-docs`")
+			os.Exit(1)
+		}
+		fmt.Println("Schema docs are up to date")
+		return
+	}
+
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			fmt.Printf("Failed to create directory: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			fmt.Printf("Failed to write %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+
+	for _, conflict := range schema.Conflicts {
+		fmt.Printf("Conflict: %s\n", conflict)
+	}
+}
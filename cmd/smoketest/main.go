@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/linkeunid/hello-go/internal/smoketest"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+func main() {
+	authURL := flag.String("auth-url", "http://localhost:8081", "base URL of the auth service's HTTP gateway")
+	userURL := flag.String("user-url", "http://localhost:8082", "base URL of the user service's HTTP gateway")
+	adminToken := flag.String("admin-token", os.Getenv("SMOKETEST_ADMIN_TOKEN"), "admin token approving the temporary account if registrations need approval, defaults to SMOKETEST_ADMIN_TOKEN")
+	emailDomain := flag.String("email-domain", "example.com", "domain of the temporary account's email")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each request")
+	probe := flag.Bool("probe", false, "keep checking an existing account (login, get me, logout) every interval and expose metrics instead of running the scenario once")
+	interval := flag.Duration("interval", time.Minute, "time between probe runs")
+	metricsPort := flag.Int("metrics-port", 9100, "port exposing the probe metrics on /metrics")
+	probeEmail := flag.String("probe-email", os.Getenv("SMOKETEST_PROBE_EMAIL"), "email of the account the probe logs in with, defaults to SMOKETEST_PROBE_EMAIL")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := smoketest.Options{
+		AuthURL:     strings.TrimSuffix(*authURL, "/"),
+		UserURL:     strings.TrimSuffix(*userURL, "/"),
+		AdminToken:  *adminToken,
+		EmailDomain: *emailDomain,
+		Timeout:     *timeout,
+		Email:       *probeEmail,
+		// Passwords aren't flags, so they don't show up in process listings
+		Password: os.Getenv("SMOKETEST_PROBE_PASSWORD"),
+	}
+
+	if *probe {
+		if opts.Email == "" || opts.Password == "" {
+			fmt.Println("Probe mode needs an account, set -probe-email and SMOKETEST_PROBE_PASSWORD")
+			os.Exit(1)
+		}
+
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			if err := http.ListenAndServe(fmt.Sprintf(":%d", *metricsPort), mux); err != nil {
+				fmt.Printf("Failed to serve metrics: %v\n", err)
+				os.Exit(1)
+			}
+		}()
+
+		fmt.Printf("Probing %s and %s every %s as %s, metrics on :%d/metrics\n", opts.AuthURL, opts.UserURL, *interval, opts.Email, *metricsPort)
+		smoketest.Probe(ctx, opts, *interval, os.Stdout)
+		return
+	}
+
+	result := smoketest.Run(ctx, opts)
+	result.Print(os.Stdout)
+
+	if !result.Passed() {
+		fmt.Println("\nSmoke test failed")
+		os.Exit(1)
+	}
+	fmt.Println("\nSmoke test passed")
+}
@@ -3,24 +3,43 @@ package main
 import (
 	"context"
 	"fmt"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	// Embed the timezone database, the runtime image doesn't ship one
+	_ "time/tzdata"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	grpchealthsrv "google.golang.org/grpc/health"
+	grpchealth "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/encoding/protojson"
 
+	"github.com/linkeunid/hello-go/pkg/alerting"
+	"github.com/linkeunid/hello-go/pkg/autotls"
+	"github.com/linkeunid/hello-go/pkg/capture"
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/discovery"
+	"github.com/linkeunid/hello-go/pkg/handoff"
+	"github.com/linkeunid/hello-go/pkg/health"
 	"github.com/linkeunid/hello-go/pkg/logger"
+	"github.com/linkeunid/hello-go/pkg/metrics"
 	"github.com/linkeunid/hello-go/pkg/middleware"
+	"github.com/linkeunid/hello-go/pkg/startup"
+	"github.com/linkeunid/hello-go/pkg/svid"
 
 	// Update import path to use the generated code in api/gen/user
+	cachepb "github.com/linkeunid/hello-go/api/gen/cache"
+	databasepb "github.com/linkeunid/hello-go/api/gen/database"
+	flightrecorderpb "github.com/linkeunid/hello-go/api/gen/flightrecorder"
+	readonlypb "github.com/linkeunid/hello-go/api/gen/readonly"
+	statuspb "github.com/linkeunid/hello-go/api/gen/status"
 	userpb "github.com/linkeunid/hello-go/api/gen/user"
+	userv2pb "github.com/linkeunid/hello-go/api/gen/userv2"
 	"github.com/linkeunid/hello-go/internal/user/server"
 )
 
@@ -40,28 +59,123 @@ func main() {
 	}
 	defer log.Sync()
 
+	// Alerts fire on repeated dependency failures, open circuits and invalid token spikes
+	alerting.Init(cfg, "user", log.Named("alerting"))
+
 	log.Info("Starting user service",
 		zap.Int("http_port", cfg.User.ServicePort),
 		zap.Int("grpc_port", cfg.User.GRPCPort))
 
-	// Initialize gRPC server
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.User.GRPCPort))
+	// Listeners are inherited from the previous process during zero-downtime restarts
+	upgrader, err := handoff.NewUpgrader(cfg, "user", log.Named("handoff"))
+	if err != nil {
+		log.Fatal("Failed to initialize restart handoff", zap.Error(err))
+	}
+
+	// Bind the listeners first, so port conflicts are reported before connecting to dependencies
+	lis, err := upgrader.Listen("grpc", config.ListenAddress(cfg.User.GRPCListen, cfg.User.GRPCPort))
+	if err != nil {
+		log.Fatal("Failed to listen", zap.Error(err))
+	}
+	httpLis, err := upgrader.Listen("http", config.ListenAddress(cfg.User.HTTPListen, cfg.User.ServicePort))
 	if err != nil {
 		log.Fatal("Failed to listen", zap.Error(err))
 	}
 
-	// Create gRPC server with logging interceptor
-	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(middleware.GrpcLoggingInterceptor(log)),
-	)
+	// With SPIFFE, callers are authenticated by their SPIFFE ID over mTLS
+	serverCreds, gatewayCreds := insecure.NewCredentials(), insecure.NewCredentials()
+	if cfg.SPIFFE.Enabled {
+		source, err := svid.NewSource(cfg, log.Named("spiffe"))
+		if err != nil {
+			log.Fatal("Failed to obtain SVID", zap.Error(err))
+		}
+		defer source.Close()
+
+		// The gateway connects to the gRPC server with the service's own SVID
+		serverCreds, err = source.ServerCredentials(cfg.SPIFFE.AllowedIDs)
+		if err == nil {
+			gatewayCreds, err = source.ClientCredentials(source.ID().String())
+		}
+		if err != nil {
+			log.Fatal("Failed to set up SPIFFE credentials", zap.Error(err))
+		}
+	}
 
 	// Initialize user server with logger
 	userServer := server.NewUserServer(cfg, log)
+
+	// Capture anonymized traffic for replays when CAPTURE_DIR is set
+	capturer, err := capture.NewRecorder(cfg, "user", log.Named("capture"))
+	if err != nil {
+		log.Fatal("Failed to start traffic capture", zap.Error(err))
+	}
+	defer capturer.Close()
+
+	// Create gRPC server with tracing, region, baggage, SLO, panic recovery, tenant, logging, flight recorder, read-only, metering, capture, caller allowlist, scope and step-up interceptors
+	jwtValidator := middleware.NewJWTValidator(cfg, log)
+	grpcServer := grpc.NewServer(
+		grpc.Creds(serverCreds),
+		grpc.ChainUnaryInterceptor(
+			middleware.TraceInterceptor(cfg, log.Named("trace")),
+			middleware.RegionInterceptor(cfg, log.Named("region")),
+			middleware.BaggageInterceptor(cfg, log.Named("baggage")),
+			middleware.SLOInterceptor(cfg, log.Named("slo")),
+			middleware.RecoveryInterceptor(jwtValidator, cfg, log.Named("recovery")),
+			middleware.TenantInterceptor(jwtValidator, cfg, log.Named("tenant")),
+			middleware.GrpcLoggingInterceptor(cfg, log),
+			middleware.FlightRecorderInterceptor(userServer.Recorder(), jwtValidator, cfg),
+			middleware.ReadOnlyInterceptor(userServer.ReadOnlyMode(), log.Named("read_only")),
+			middleware.MeteringInterceptor(userServer.Meter(), jwtValidator, cfg),
+			middleware.CaptureInterceptor(capturer),
+			middleware.CallerAllowlistInterceptor(cfg, userServer.SecurityEvents(), log.Named("callers")),
+			middleware.ScopeInterceptor(jwtValidator, server.MethodScopes, log.Named("scopes")),
+			middleware.StepUpInterceptor(jwtValidator, server.StepUpMethods, cfg.Auth.StepUpMaxAge, log.Named("step_up")),
+		),
+	)
 	userpb.RegisterUserServiceServer(grpcServer, userServer)
+	userv2pb.RegisterUserServiceServer(grpcServer, userServer.V2())
+	flightrecorderpb.RegisterFlightRecorderServiceServer(grpcServer, userServer.FlightRecorder())
+	cachepb.RegisterCacheServiceServer(grpcServer, userServer.Caches())
+	databasepb.RegisterDatabaseServiceServer(grpcServer, userServer.Database())
+	readonlypb.RegisterReadOnlyServiceServer(grpcServer, userServer.ReadOnly())
+
+	// Register status and standard gRPC health services
+	checker := health.NewChecker("user", cfg, log, userServer.Checks()...)
+	statuspb.RegisterStatusServiceServer(grpcServer, checker)
+	grpchealth.RegisterHealthServer(grpcServer, grpchealthsrv.NewServer())
+
+	// Check dependencies and log the startup summary, strict mode refuses to start without them
+	if err := startup.Preflight(context.Background(), cfg, log, checker, startup.Summary{
+		Service: "user",
+		Ports: map[string]int{
+			"http": handoff.Port(httpLis),
+			"grpc": handoff.Port(lis),
+		},
+		Features: map[string]bool{
+			"mock_services": os.Getenv("USE_MOCK_SERVICES") == "true",
+			"acme":          cfg.ACME.Enabled,
+			"spiffe":        cfg.SPIFFE.Enabled,
+			"bypass_auth":   os.Getenv("BYPASS_AUTH") == "true",
+			"siem":          cfg.SIEM.Sink != "none",
+			"metering":      cfg.Metering.Enabled,
+			"read_only":     cfg.ReadOnly.Enabled,
+			"projection":    cfg.User.Projection,
+		},
+		Settings: map[string]string{
+			"profile":               cfg.Profile,
+			"region":                cfg.Region,
+			"database_driver":       cfg.Database.Driver,
+			"auth_client_pool_size": fmt.Sprint(cfg.Auth.ClientPoolSize),
+			"auth_target":           cfg.Auth.GRPCTarget(),
+			"username_hold_period":  cfg.User.UsernameHoldPeriod.String(),
+		},
+	}); err != nil {
+		log.Fatal("Failed to start user service", zap.Error(err))
+	}
 
 	// Start gRPC server in a goroutine
 	go func() {
-		log.Info("Starting gRPC server", zap.Int("port", cfg.User.GRPCPort))
+		log.Info("Starting gRPC server", zap.String("address", lis.Addr().String()))
 		if err := grpcServer.Serve(lis); err != nil {
 			log.Fatal("Failed to serve gRPC", zap.Error(err))
 		}
@@ -71,45 +185,228 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	mux := runtime.NewServeMux()
-	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	mux := runtime.NewServeMux(
+		// Render timestamps in the timezone requested via X-Timezone
+		runtime.WithMetadata(middleware.TimezoneAnnotator),
+		// Keep the caller's trace ID, baggage and tenant
+		runtime.WithMetadata(middleware.TraceAnnotator),
+		runtime.WithMetadata(middleware.RegionAnnotator),
+		runtime.WithMetadata(middleware.BaggageAnnotator),
+		runtime.WithMetadata(middleware.TenantAnnotator),
+		runtime.WithForwardResponseRewriter(middleware.TimezoneResponseRewriter),
+		// Let browsers and CDNs cache responses as configured per route
+		runtime.WithMiddlewares(middleware.CacheRouteMiddleware),
+		runtime.WithForwardResponseOption(middleware.CacheControlResponseOption(cfg)),
+		// Answer rate limited requests with 429 and X-RateLimit-* headers
+		runtime.WithOutgoingHeaderMatcher(middleware.RateLimitHeaderMatcher),
+		runtime.WithErrorHandler(middleware.RateLimitErrorHandler),
+		// Reject unknown and malformed query parameters instead of ignoring them
+		runtime.SetQueryParameterParser(middleware.StrictQueryParser{}),
+		// Omit empty fields so read masks shrink REST responses too
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.HTTPBodyMarshaler{
+			Marshaler: &runtime.JSONPb{
+				MarshalOptions: protojson.MarshalOptions{
+					EmitUnpopulated: false,
+				},
+				UnmarshalOptions: protojson.UnmarshalOptions{
+					DiscardUnknown: true,
+				},
+			},
+		}),
+	)
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(gatewayCreds),
+		middleware.GatewayCallerCredentials(),
+	}
 
 	if err := userpb.RegisterUserServiceHandlerFromEndpoint(
 		ctx,
 		mux,
-		fmt.Sprintf("localhost:%d", cfg.User.GRPCPort),
+		handoff.DialTarget(lis),
 		opts,
 	); err != nil {
 		log.Fatal("Failed to register gateway", zap.Error(err))
 	}
 
+	if err := userv2pb.RegisterUserServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register v2 gateway", zap.Error(err))
+	}
+
+	if err := flightrecorderpb.RegisterFlightRecorderServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register flight recorder gateway", zap.Error(err))
+	}
+
+	if err := cachepb.RegisterCacheServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register cache gateway", zap.Error(err))
+	}
+
+	if err := databasepb.RegisterDatabaseServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register database gateway", zap.Error(err))
+	}
+
+	if err := readonlypb.RegisterReadOnlyServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register read-only gateway", zap.Error(err))
+	}
+
+	if err := statuspb.RegisterStatusServiceHandlerFromEndpoint(
+		ctx,
+		mux,
+		handoff.DialTarget(lis),
+		opts,
+	); err != nil {
+		log.Fatal("Failed to register status gateway", zap.Error(err))
+	}
+
+	// Serve liveness and readiness probes next to the gateway
+	httpMux := http.NewServeMux()
+	httpMux.Handle("/health", checker.LivenessHandler())
+	httpMux.Handle("/ready", checker.ReadinessHandler())
+	// Accept JSON Patch and merge patch bodies on PATCH routes
+	httpMux.Handle("/", middleware.PatchHandler(mux))
+
 	// Add logging middleware
-	httpHandler := middleware.LoggingMiddleware(log)(mux)
+	httpHandler := middleware.LoggingMiddleware(log)(httpMux)
 
 	// Start HTTP server
 	httpServer := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.User.ServicePort),
 		Handler: httpHandler,
 	}
 
+	// Serve HTTPS with certificates from an ACME CA when enabled
+	if cfg.ACME.Enabled {
+		certManager, err := autotls.NewManager(cfg, log.Named("acme"))
+		if err != nil {
+			log.Fatal("Failed to set up ACME certificates", zap.Error(err))
+		}
+		httpServer.TLSConfig = certManager.TLSConfig()
+		// Handshake errors, e.g. for unknown host names, go to the structured log
+		httpServer.ErrorLog = zap.NewStdLog(log.Named("tls"))
+
+		if cfg.ACME.HTTPChallengeAddress != "" {
+			challengeLis, err := upgrader.Listen("acme", cfg.ACME.HTTPChallengeAddress)
+			if err != nil {
+				log.Fatal("Failed to listen", zap.Error(err))
+			}
+			go func() {
+				if err := certManager.ServeChallenges(challengeLis); err != nil {
+					log.Error("Failed to serve ACME challenges", zap.Error(err))
+				}
+			}()
+		}
+	}
+
 	// Start HTTP server in a goroutine
 	go func() {
-		log.Info("Starting HTTP server", zap.Int("port", cfg.User.ServicePort))
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Info("Starting HTTP server",
+			zap.String("address", httpLis.Addr().String()),
+			zap.Bool("tls", httpServer.TLSConfig != nil))
+
+		var err error
+		if httpServer.TLSConfig != nil {
+			err = httpServer.ServeTLS(httpLis, "", "")
+		} else {
+			err = httpServer.Serve(httpLis)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatal("Failed to serve HTTP", zap.Error(err))
 		}
 	}()
 
-	// Wait for interrupt signal to gracefully shut down the servers
+	// Serve Prometheus metrics, e.g. the SLO counters, apart from the public gateway
+	if cfg.User.MetricsPort > 0 {
+		metricsLis, err := upgrader.Listen("metrics", config.ListenAddress("", cfg.User.MetricsPort))
+		if err != nil {
+			log.Fatal("Failed to listen", zap.Error(err))
+		}
+		go func() {
+			log.Info("Starting metrics server", zap.String("address", metricsLis.Addr().String()))
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("/metrics", metrics.Handler())
+			if err := http.Serve(metricsLis, metricsMux); err != nil {
+				log.Error("Failed to serve metrics", zap.Error(err))
+			}
+		}()
+	}
+
+	// Keep the users table up to date with the auth service's events until shutdown
+	projectionCtx, stopProjection := context.WithCancel(context.Background())
+	projectionDone := make(chan struct{})
+	go func() {
+		userServer.RunProjection(projectionCtx)
+		close(projectionDone)
+	}()
+
+	// Let the previous process, if any, shut down now that this one is serving
+	if err := upgrader.Ready(); err != nil {
+		log.Error("Failed to complete restart handoff", zap.Error(err))
+	}
+
+	// Register the ports, e.g. the ones picked for port 0, with service discovery
+	registration, err := discovery.Register(context.Background(), cfg, "user", lis, httpLis, log.Named("discovery"))
+	if err != nil {
+		log.Error("Failed to register with service discovery", zap.Error(err))
+	}
+
+	// Wait for interrupt signal to gracefully shut down the servers.
+	// SIGHUP first hands the listeners over to a new process.
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	s := <-quit
-	log.Info("Shutting down servers", zap.String("signal", s.String()))
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for s := range quit {
+		if s == syscall.SIGHUP {
+			if err := upgrader.Upgrade(); err != nil {
+				log.Error("Zero-downtime restart failed, still serving", zap.Error(err))
+				continue
+			}
+		}
+		log.Info("Shutting down servers", zap.String("signal", s.String()))
+		break
+	}
+
+	// Stop sending new clients to this instance
+	deregisterCtx, cancelDeregister := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := registration.Deregister(deregisterCtx); err != nil {
+		log.Error("Failed to deregister from service discovery", zap.Error(err))
+	}
+	cancelDeregister()
 
 	// Gracefully stop the gRPC server
 	grpcServer.GracefulStop()
 	log.Info("gRPC server stopped")
 
+	// Finish the event being projected
+	stopProjection()
+	<-projectionDone
+
+	// Flush the security events of the finished requests
+	if err := userServer.Close(); err != nil {
+		log.Error("Failed to flush security events", zap.Error(err))
+	}
+
 	// Gracefully shut down the HTTP server
 	ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -0,0 +1,234 @@
+package anonymize
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/internal/retention"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/events"
+)
+
+// Target describes where a table references users
+type Target struct {
+	// Table is the database table name
+	Table string
+	// IDColumns hold a user ID
+	IDColumns []string
+	// EmailColumns hold an email address
+	EmailColumns []string
+	// TextColumns hold free-form payloads (e.g. JSON) that may mention the ID or email
+	TextColumns []string
+}
+
+// DefaultTargets are the tables that keep referencing users after they are deleted.
+// Tables and columns that don't exist are skipped.
+func DefaultTargets() []Target {
+	return []Target{
+		{
+			Table:        retention.TableAuditLogs,
+			IDColumns:    []string{"user_id", "actor_id"},
+			EmailColumns: []string{"email"},
+			TextColumns:  []string{"details"},
+		},
+		{
+			Table:        retention.TableLoginHistory,
+			IDColumns:    []string{"user_id"},
+			EmailColumns: []string{"email"},
+		},
+		{
+			Table:       events.Record{}.TableName(),
+			IDColumns:   []string{"subject"},
+			TextColumns: []string{"data"},
+		},
+	}
+}
+
+// TableReport is the outcome of anonymizing a single table
+type TableReport struct {
+	Table string
+	// Updated is the number of updated rows, summed over columns
+	Updated int64
+	// Remaining is the number of rows still referencing the user after the pass
+	Remaining int64
+	// Skipped is set when the table doesn't exist
+	Skipped bool
+}
+
+// Report summarizes the anonymization of a user
+type Report struct {
+	// Pseudonym replaced the user ID, it is safe to log
+	Pseudonym string
+	Tables    []TableReport
+}
+
+// Verified reports whether no table references the user anymore
+func (r *Report) Verified() bool {
+	for _, table := range r.Tables {
+		if table.Remaining > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Anonymizer replaces references to deleted users with stable pseudonyms.
+//
+// Pseudonyms are keyed hashes, so records of the same user can still be
+// correlated (e.g. for security investigations) without revealing who it was.
+type Anonymizer struct {
+	key     []byte
+	targets []Target
+	logger  *zap.Logger
+}
+
+// NewAnonymizer creates a new anonymizer for the default targets
+func NewAnonymizer(cfg *config.Config, logger *zap.Logger) *Anonymizer {
+	if cfg.Privacy.PseudonymKey == "" {
+		logger.Warn("PSEUDONYM_KEY is not set, pseudonyms are unkeyed hashes")
+	}
+
+	return &Anonymizer{
+		key:     []byte(cfg.Privacy.PseudonymKey.Reveal()),
+		targets: DefaultTargets(),
+		logger:  logger,
+	}
+}
+
+// Pseudonym returns the stable pseudonym of a user ID
+func (a *Anonymizer) Pseudonym(userID string) string {
+	return "anon-" + a.hash(userID)
+}
+
+// PseudonymEmail returns the stable pseudonym of an email address
+func (a *Anonymizer) PseudonymEmail(email string) string {
+	return "anon-" + a.hash(strings.ToLower(email)) + "@" + retention.AnonymizedEmailDomain
+}
+
+// hash returns a shortened keyed hash of a value
+func (a *Anonymizer) hash(value string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// Anonymize replaces the user's ID and email in every target table and verifies
+// that no reference is left. Run it in the transaction that deletes the user
+// so both are rolled back together.
+func (a *Anonymizer) Anonymize(ctx context.Context, tx *gorm.DB, userID, email string) (*Report, error) {
+	report := &Report{Pseudonym: a.Pseudonym(userID)}
+	pseudonymEmail := a.PseudonymEmail(email)
+
+	for _, target := range a.targets {
+		result, err := a.anonymizeTable(tx.WithContext(ctx), target, userID, email, report.Pseudonym, pseudonymEmail)
+		if err != nil {
+			return nil, fmt.Errorf("failed to anonymize %s: %w", target.Table, err)
+		}
+		report.Tables = append(report.Tables, result)
+	}
+
+	a.logger.Info("Anonymized user references",
+		zap.String("pseudonym", report.Pseudonym),
+		zap.Bool("verified", report.Verified()),
+		zap.Any("tables", report.Tables))
+
+	return report, nil
+}
+
+// anonymizeTable replaces the user's references in a single table and counts what is left
+func (a *Anonymizer) anonymizeTable(db *gorm.DB, target Target, userID, email, pseudonym, pseudonymEmail string) (TableReport, error) {
+	report := TableReport{Table: target.Table}
+
+	migrator := db.Migrator()
+	if !migrator.HasTable(target.Table) {
+		report.Skipped = true
+		return report, nil
+	}
+
+	// Only touch the columns this table actually has
+	present := func(columns []string) []string {
+		var result []string
+		for _, column := range columns {
+			if migrator.HasColumn(target.Table, column) {
+				result = append(result, column)
+			}
+		}
+		return result
+	}
+	idColumns := present(target.IDColumns)
+	emailColumns := present(target.EmailColumns)
+	textColumns := present(target.TextColumns)
+	if email == "" {
+		emailColumns = nil
+	}
+
+	replace := func(column, value, replacement string) error {
+		result := db.Table(target.Table).Where(fmt.Sprintf("%s = ?", column), value).
+			UpdateColumn(column, replacement)
+		report.Updated += result.RowsAffected
+		return result.Error
+	}
+
+	for _, column := range idColumns {
+		if err := replace(column, userID, pseudonym); err != nil {
+			return report, err
+		}
+	}
+	for _, column := range emailColumns {
+		if err := replace(column, email, pseudonymEmail); err != nil {
+			return report, err
+		}
+	}
+
+	// Replace mentions inside payloads, e.g. the email in a JSON event
+	for _, column := range textColumns {
+		expr := gorm.Expr(fmt.Sprintf("REPLACE(%s, ?, ?)", column), userID, pseudonym)
+		if email != "" {
+			expr = gorm.Expr(fmt.Sprintf("REPLACE(REPLACE(%s, ?, ?), ?, ?)", column), userID, pseudonym, email, pseudonymEmail)
+		}
+		query := db.Table(target.Table).Where(fmt.Sprintf("%s LIKE ?", column), "%"+userID+"%")
+		if email != "" {
+			query = query.Or(fmt.Sprintf("%s LIKE ?", column), "%"+email+"%")
+		}
+		result := query.UpdateColumn(column, expr)
+		if result.Error != nil {
+			return report, result.Error
+		}
+		report.Updated += result.RowsAffected
+	}
+
+	// Verify that nothing references the user anymore
+	var conditions []string
+	var args []interface{}
+	for _, column := range idColumns {
+		conditions = append(conditions, fmt.Sprintf("%s = ?", column))
+		args = append(args, userID)
+	}
+	for _, column := range emailColumns {
+		conditions = append(conditions, fmt.Sprintf("%s = ?", column))
+		args = append(args, email)
+	}
+	for _, column := range textColumns {
+		conditions = append(conditions, fmt.Sprintf("%s LIKE ?", column))
+		args = append(args, "%"+userID+"%")
+		if email != "" {
+			conditions = append(conditions, fmt.Sprintf("%s LIKE ?", column))
+			args = append(args, "%"+email+"%")
+		}
+	}
+	if len(conditions) > 0 {
+		if err := db.Table(target.Table).Where(strings.Join(conditions, " OR "), args...).
+			Count(&report.Remaining).Error; err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
@@ -4,22 +4,32 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"time"
+	"strings"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/credentials"
+	grpchealth "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 
 	// Update import path to use the generated code in api/gen/auth
 	"github.com/linkeunid/hello-go/api/gen/auth"
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	"github.com/linkeunid/hello-go/pkg/discovery"
 	"github.com/linkeunid/hello-go/pkg/middleware"
+	"github.com/linkeunid/hello-go/pkg/svid"
 )
 
 // AuthClient is a client for the auth service
 type AuthClient interface {
 	// ValidateToken validates a token and returns the user ID
 	ValidateToken(ctx context.Context, token string) (bool, string, error)
+	// CheckEmailAvailability reports whether no account has the email yet. The
+	// auth service rate limits it by clientIP, the address of the caller's client.
+	CheckEmailAvailability(ctx context.Context, email, clientIP string) (bool, error)
+	// Ping checks that the auth service is reachable and serving
+	Ping(ctx context.Context) error
 	// Close closes the gRPC connection
 	Close() error
 }
@@ -27,8 +37,8 @@ type AuthClient interface {
 // authClient implements the AuthClient interface
 type authClient struct {
 	cfg    *config.Config
-	client auth.AuthServiceClient
-	conn   *grpc.ClientConn
+	pool   *channelPool
+	svid   *svid.Source
 	logger *zap.Logger
 }
 
@@ -42,29 +52,79 @@ func NewAuthClient(cfg *config.Config, logger *zap.Logger) (AuthClient, error) {
 		return NewMockAuthClient(cfg, logger), nil
 	}
 
+	target := cfg.Auth.GRPCTarget()
 	logger.Debug("Creating auth client",
-		zap.Int("grpc_port", cfg.Auth.GRPCPort))
-
-	// Set up a connection to the gRPC server with logging interceptor
-	conn, err := grpc.Dial(
-		fmt.Sprintf("localhost:%d", cfg.Auth.GRPCPort),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithUnaryInterceptor(middleware.GrpcClientLoggingInterceptor(logger)),
-	)
+		zap.String("target", target),
+		zap.Bool("xds", isXDSTarget(target)),
+		zap.String("region", cfg.Region),
+		zap.Int("pool_size", cfg.Auth.ClientPoolSize))
+
+	// With SPIFFE, the auth service is authenticated by its SPIFFE ID over mTLS
+	var source *svid.Source
+	var creds credentials.TransportCredentials
+	var err error
+	if cfg.SPIFFE.Enabled {
+		source, err = svid.NewSource(cfg, logger.Named("spiffe"))
+		if err == nil {
+			creds, err = source.ClientCredentials(cfg.SPIFFE.AuthID)
+		}
+	} else {
+		creds, err = transportCredentials(cfg, target)
+	}
+	if err != nil {
+		if source != nil {
+			source.Close()
+		}
+		logger.Error("Failed to set up auth client credentials", zap.Error(err))
+		return nil, err
+	}
+
+	// Timeouts, retries and hedging come from the service config, unless the
+	// xDS control plane sets its own
+	serviceConfig, hedging, err := loadServiceConfig(cfg)
 	if err != nil {
+		if source != nil {
+			source.Close()
+		}
+		logger.Error("Failed to load auth client service config", zap.Error(err))
+		return nil, err
+	}
+
+	// Set up a pool of connections to the gRPC server with logging interceptor
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithChainUnaryInterceptor(
+			middleware.GrpcClientLoggingInterceptor(logger),
+			middleware.RegionClientInterceptor(),
+			middleware.BaggageClientInterceptor(),
+			middleware.TenantClientInterceptor(),
+			hedgingInterceptor(hedging),
+		),
+	}
+	// Resolve consul:///auth targets with the agent, preferring instances in the region
+	if strings.HasPrefix(target, discovery.Scheme+":") {
+		dialOpts = append(dialOpts, grpc.WithResolvers(discovery.NewResolverBuilder(cfg, logger.Named("resolver"))))
+	}
+	// Identify with an API key for auth services restricting internal RPCs
+	if cfg.Callers.ClientAPIKey != "" {
+		dialOpts = append(dialOpts, middleware.APIKeyCallerCredentials(cfg.Callers.ClientAPIKey.Reveal()))
+	}
+	pool, err := newChannelPool(target, cfg.Auth.ClientPoolSize, logger, dialOpts...)
+	if err != nil {
+		if source != nil {
+			source.Close()
+		}
 		logger.Error("Failed to connect to auth service", zap.Error(err))
 		return nil, fmt.Errorf("failed to connect to auth service: %w", err)
 	}
 
 	logger.Debug("Connection to auth service established")
 
-	// Create gRPC client
-	client := auth.NewAuthServiceClient(conn)
-
 	return &authClient{
 		cfg:    cfg,
-		client: client,
-		conn:   conn,
+		pool:   pool,
+		svid:   source,
 		logger: logger,
 	}, nil
 }
@@ -80,12 +140,8 @@ func (c *authClient) ValidateToken(ctx context.Context, token string) (bool, str
 	c.logger.Debug("Validating token",
 		zap.String("token_preview", tokenPreview))
 
-	// Set timeout
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
-	// Call gRPC method
-	res, err := c.client.ValidateToken(ctx, &auth.ValidateTokenRequest{
+	// Call gRPC method, the timeout is set by the service config
+	res, err := auth.NewAuthServiceClient(c.pool.Get()).ValidateToken(ctx, &auth.ValidateTokenRequest{
 		Token: token,
 	})
 	if err != nil {
@@ -95,13 +151,57 @@ func (c *authClient) ValidateToken(ctx context.Context, token string) (bool, str
 
 	c.logger.Debug("Token validation result",
 		zap.Bool("valid", res.Valid),
-		zap.String("user_id", res.UserId))
+		zap.String("user_id", res.UserId),
+		zap.String("tenant_id", res.TenantId))
+
+	// The auth service checks the tenant too, older versions didn't return it
+	if tenant, ok := database.TenantFromContext(ctx); ok && res.Valid && res.TenantId != "" && res.TenantId != tenant {
+		c.logger.Warn("Token of another tenant",
+			zap.String("tenant_id", res.TenantId),
+			zap.String("requested_tenant_id", tenant))
+		return false, "", nil
+	}
 
 	return res.Valid, res.UserId, nil
 }
 
-// Close closes the gRPC connection
+// CheckEmailAvailability asks the auth service whether an email can still be
+// registered. Errors are the auth service's status, e.g. ResourceExhausted.
+func (c *authClient) CheckEmailAvailability(ctx context.Context, email, clientIP string) (bool, error) {
+	// The auth service counts the call against the client's limit, not ours
+	if clientIP != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-forwarded-for", clientIP)
+	}
+
+	res, err := auth.NewAuthServiceClient(c.pool.Get()).CheckEmailAvailability(ctx, &auth.CheckEmailAvailabilityRequest{
+		Email: email,
+	})
+	if err != nil {
+		c.logger.Debug("Failed to check email availability", zap.Error(err))
+		return false, err
+	}
+	return res.Available, nil
+}
+
+// Ping checks that the auth service is reachable and serving
+func (c *authClient) Ping(ctx context.Context) error {
+	res, err := grpchealth.NewHealthClient(c.pool.Get()).Check(ctx, &grpchealth.HealthCheckRequest{})
+	if err != nil {
+		return fmt.Errorf("auth service unreachable, %d/%d channels healthy: %w",
+			c.pool.Healthy(), c.pool.Size(), err)
+	}
+	if res.Status != grpchealth.HealthCheckResponse_SERVING {
+		return fmt.Errorf("auth service is %s", res.Status)
+	}
+	return nil
+}
+
+// Close closes the gRPC connections
 func (c *authClient) Close() error {
-	c.logger.Debug("Closing auth client connection")
-	return c.conn.Close()
+	c.logger.Debug("Closing auth client connections")
+	err := c.pool.Close()
+	if c.svid != nil {
+		c.svid.Close()
+	}
+	return err
 }
@@ -3,26 +3,36 @@ package client
 import (
 	"context"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/jwe"
+	"github.com/linkeunid/hello-go/pkg/signing"
 )
 
 // MockAuthClient implements the AuthClient interface with mock data
 type mockAuthClient struct {
-	cfg    *config.Config
-	logger *zap.Logger
+	cfg *config.Config
+	// keyfunc verifies tokens with the published keys when JWKS_URL is set
+	keyfunc jwt.Keyfunc
+	logger  *zap.Logger
 }
 
 // NewMockAuthClient creates a new mock auth client
 func NewMockAuthClient(cfg *config.Config, logger *zap.Logger) AuthClient {
-	return &mockAuthClient{
+	c := &mockAuthClient{
 		cfg:    cfg,
 		logger: logger.Named("mock_auth_client"),
 	}
+	c.keyfunc = signing.SecretKeyfunc(cfg)
+	if cfg.Auth.JWKSURL != "" {
+		c.keyfunc = signing.NewRemoteKeySet(cfg.Auth.JWKSURL, cfg, c.logger.Named("jwks")).Keyfunc
+	}
+	return c
 }
 
 // ValidateToken validates a token and returns the user ID
@@ -47,10 +57,15 @@ func (c *mockAuthClient) ValidateToken(ctx context.Context, token string) (bool,
 		return false, "", nil
 	}
 
+	// Decrypt encrypted tokens
+	signed, err := jwe.Open(token, c.cfg.Auth.TokenEncryptionKey.Reveal())
+	if err != nil {
+		c.logger.Debug("Token decryption failed", zap.Error(err))
+		return false, "", nil
+	}
+
 	// Parse token
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		return []byte(c.cfg.Auth.JWTSecret), nil
-	})
+	parsedToken, err := jwt.Parse(signed, c.keyfunc)
 
 	if err != nil {
 		c.logger.Debug("Token validation failed", zap.Error(err))
@@ -91,6 +106,24 @@ func (c *mockAuthClient) ValidateToken(ctx context.Context, token string) (bool,
 	return true, userID, nil
 }
 
+// mockEmails are the emails of the mock auth service's users
+var mockEmails = map[string]bool{
+	"admin@example.com": true,
+	"user@example.com":  true,
+	"test@example.com":  true,
+}
+
+// CheckEmailAvailability reports whether the email isn't one of the mock users'
+func (c *mockAuthClient) CheckEmailAvailability(ctx context.Context, email, clientIP string) (bool, error) {
+	c.logger.Debug("Mock: Checking email availability", zap.String("email", email))
+	return !mockEmails[strings.ToLower(strings.TrimSpace(email))], nil
+}
+
+// Ping always succeeds, the mock client doesn't connect to the auth service
+func (c *mockAuthClient) Ping(ctx context.Context) error {
+	return nil
+}
+
 // Close closes the mock auth client
 func (c *mockAuthClient) Close() error {
 	c.logger.Debug("Closing mock auth client")
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// channelPool spreads calls over several connections to the auth service.
+//
+// A single HTTP/2 connection limits the number of concurrent streams, so
+// under high concurrency calls queue up behind each other. Each channel has
+// its own connection, picked round-robin while skipping unhealthy ones.
+type channelPool struct {
+	conns  []*grpc.ClientConn
+	next   atomic.Uint32
+	logger *zap.Logger
+}
+
+// newChannelPool dials size connections to target
+func newChannelPool(target string, size int, logger *zap.Logger, opts ...grpc.DialOption) (*channelPool, error) {
+	if size < 1 {
+		size = 1
+	}
+
+	pool := &channelPool{
+		conns:  make([]*grpc.ClientConn, 0, size),
+		logger: logger,
+	}
+
+	for i := 0; i < size; i++ {
+		conn, err := grpc.Dial(target, opts...)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+
+		// Connect eagerly so the first calls don't all wait on the same channel
+		conn.Connect()
+		pool.conns = append(pool.conns, conn)
+	}
+
+	return pool, nil
+}
+
+// healthy reports whether a channel can take calls right now
+func healthy(conn *grpc.ClientConn) bool {
+	switch conn.GetState() {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return false
+	default:
+		return true
+	}
+}
+
+// Get returns the next healthy channel.
+// When every channel is unhealthy the next one is returned anyway, so the
+// call fails with the actual connection error and triggers a reconnect.
+func (p *channelPool) Get() *grpc.ClientConn {
+	start := p.next.Add(1)
+	for i := 0; i < len(p.conns); i++ {
+		conn := p.conns[(int(start)+i)%len(p.conns)]
+		if healthy(conn) {
+			return conn
+		}
+	}
+
+	p.logger.Warn("No healthy auth service channel available",
+		zap.Int("pool_size", len(p.conns)))
+	return p.conns[int(start)%len(p.conns)]
+}
+
+// Healthy returns the number of healthy channels
+func (p *channelPool) Healthy() int {
+	count := 0
+	for _, conn := range p.conns {
+		if healthy(conn) {
+			count++
+		}
+	}
+	return count
+}
+
+// Size returns the number of channels
+func (p *channelPool) Size() int {
+	return len(p.conns)
+}
+
+// Close closes every channel
+func (p *channelPool) Close() error {
+	var errs []error
+	for _, conn := range p.conns {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
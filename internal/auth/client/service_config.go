@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// defaultServiceConfig sets the timeouts, retries and hedging of auth service calls
+//
+//go:embed service_config.json
+var defaultServiceConfig string
+
+// serviceConfig is the part of a gRPC service config the client applies itself
+type serviceConfig struct {
+	MethodConfig []struct {
+		Name []struct {
+			Service string `json:"service"`
+			Method  string `json:"method"`
+		} `json:"name"`
+		HedgingPolicy *hedgingPolicy `json:"hedgingPolicy"`
+	} `json:"methodConfig"`
+}
+
+// hedgingPolicy sends further attempts of a call that hasn't completed after
+// hedgingDelay, see https://github.com/grpc/proposal/blob/master/A6-client-retries.md
+type hedgingPolicy struct {
+	MaxAttempts         int          `json:"maxAttempts"`
+	HedgingDelay        string       `json:"hedgingDelay"`
+	NonFatalStatusCodes []codes.Code `json:"nonFatalStatusCodes"`
+
+	delay time.Duration
+}
+
+// loadServiceConfig returns the service config of the auth client, read from
+// AUTH_CLIENT_SERVICE_CONFIG if set, and the hedging policies it contains by full method name
+func loadServiceConfig(cfg *config.Config) (string, map[string]*hedgingPolicy, error) {
+	raw := defaultServiceConfig
+	if path := cfg.Auth.ClientServiceConfig; path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read auth client service config: %w", err)
+		}
+		raw = string(data)
+	}
+
+	var sc serviceConfig
+	if err := json.Unmarshal([]byte(raw), &sc); err != nil {
+		return "", nil, fmt.Errorf("invalid auth client service config: %w", err)
+	}
+
+	policies := make(map[string]*hedgingPolicy)
+	for _, mc := range sc.MethodConfig {
+		if mc.HedgingPolicy == nil {
+			continue
+		}
+
+		delay, err := time.ParseDuration(mc.HedgingPolicy.HedgingDelay)
+		if err != nil && mc.HedgingPolicy.HedgingDelay != "" {
+			return "", nil, fmt.Errorf("invalid hedgingDelay %q in auth client service config", mc.HedgingPolicy.HedgingDelay)
+		}
+		mc.HedgingPolicy.delay = delay
+
+		for _, name := range mc.Name {
+			policies["/"+name.Service+"/"+name.Method] = mc.HedgingPolicy
+		}
+	}
+
+	return raw, policies, nil
+}
+
+// hedgingInterceptor applies the hedgingPolicy of the service config, which
+// grpc-go doesn't implement itself. Until a call completes, another attempt is
+// sent every hedgingDelay, up to maxAttempts, or right away when an attempt
+// fails with a non-fatal code. The first successful response is used and the
+// other attempts are cancelled.
+func hedgingInterceptor(policies map[string]*hedgingPolicy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		// Method policies take precedence over service ones
+		policy, ok := policies[method]
+		if !ok {
+			policy, ok = policies[method[:strings.LastIndex(method, "/")+1]]
+		}
+		message, isProto := reply.(proto.Message)
+		if !ok || !isProto || policy.MaxAttempts < 2 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		return policy.invoke(ctx, method, req, message, cc, invoker, opts...)
+	}
+}
+
+// invoke runs the hedged attempts of a call
+func (p *hedgingPolicy) invoke(ctx context.Context, method string, req interface{}, reply proto.Message, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		reply proto.Message
+		err   error
+	}
+	results := make(chan result, p.MaxAttempts)
+
+	// Every attempt gets its own reply, they run concurrently
+	attempt := func() {
+		attemptReply := reply.ProtoReflect().New().Interface()
+		err := invoker(ctx, method, req, attemptReply, cc, opts...)
+		results <- result{reply: attemptReply, err: err}
+	}
+
+	go attempt()
+	started, pending := 1, 1
+
+	timer := time.NewTimer(p.delay)
+	defer timer.Stop()
+
+	var err error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if started < p.MaxAttempts {
+				go attempt()
+				started++
+				pending++
+				timer.Reset(p.delay)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				proto.Reset(reply)
+				proto.Merge(reply, res.reply)
+				return nil
+			}
+
+			err = res.err
+			if !p.nonFatal(status.Code(err)) {
+				return err
+			}
+			if started < p.MaxAttempts {
+				go attempt()
+				started++
+				pending++
+				timer.Reset(p.delay)
+			}
+		}
+	}
+
+	return err
+}
+
+// nonFatal reports whether an attempt failing with code lets the other attempts continue
+func (p *hedgingPolicy) nonFatal(code codes.Code) bool {
+	for _, nonFatal := range p.NonFatalStatusCodes {
+		if code == nonFatal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	xdscreds "google.golang.org/grpc/credentials/xds"
+
+	// Register the xds:/// resolver and balancers
+	_ "google.golang.org/grpc/xds"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// xdsScheme is the target scheme resolved through an xDS control plane
+const xdsScheme = "xds:"
+
+// ErrXDSBootstrapMissing is returned for xds targets without a bootstrap configuration
+var ErrXDSBootstrapMissing = errors.New("xds target requires GRPC_XDS_BOOTSTRAP or GRPC_XDS_BOOTSTRAP_CONFIG")
+
+// isXDSTarget reports whether target is resolved through xDS, e.g. "xds:///auth-service:9091"
+func isXDSTarget(target string) bool {
+	return strings.HasPrefix(target, xdsScheme)
+}
+
+// transportCredentials returns the credentials for dialing target.
+//
+// Plaintext is used by default: behind an Envoy sidecar the proxy handles mTLS.
+// For xds targets with MESH_XDS_CREDENTIALS, security is configured by the
+// control plane instead (proxyless mTLS), falling back to plaintext when it
+// doesn't configure any.
+func transportCredentials(cfg *config.Config, target string) (credentials.TransportCredentials, error) {
+	if !isXDSTarget(target) {
+		return insecure.NewCredentials(), nil
+	}
+
+	if os.Getenv("GRPC_XDS_BOOTSTRAP") == "" && os.Getenv("GRPC_XDS_BOOTSTRAP_CONFIG") == "" {
+		return nil, ErrXDSBootstrapMissing
+	}
+
+	if !cfg.Mesh.XDSCredentials {
+		return insecure.NewCredentials(), nil
+	}
+
+	creds, err := xdscreds.NewClientCredentials(xdscreds.ClientOptions{
+		FallbackCreds: insecure.NewCredentials(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create xds credentials: %w", err)
+	}
+	return creds, nil
+}
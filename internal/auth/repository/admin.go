@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+	"github.com/linkeunid/hello-go/pkg/events"
+)
+
+// UserFilter narrows the users listed for admins, empty fields match everything
+type UserFilter struct {
+	Status string
+	Role   string
+	// Query matches a substring of the email or name
+	Query string
+	// Tags match users having all of them, they must not repeat
+	Tags []string
+}
+
+// scopes returns the filter as query scopes
+func (f UserFilter) scopes() []database.Scope {
+	var scopes []database.Scope
+	if f.Status != "" {
+		scopes = append(scopes, database.Where("status = ?", f.Status))
+	}
+	if f.Role != "" {
+		scopes = append(scopes, database.Where("role = ?", f.Role))
+	}
+	if f.Query != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(f.Query) + "%"
+		scopes = append(scopes, database.Where("email LIKE ? OR name LIKE ?", pattern, pattern))
+	}
+	if len(f.Tags) > 0 {
+		scopes = append(scopes, taggedScope(f.Tags))
+	}
+	return scopes
+}
+
+// UserSessionStats summarizes the sessions of a user
+type UserSessionStats struct {
+	UserID         string
+	ActiveSessions int
+	LastLoginAt    *time.Time
+}
+
+// Session is a login session, i.e. a refresh token family
+type Session struct {
+	// ID is the family ID
+	ID              string
+	StartedAt       time.Time
+	LastRefreshedAt time.Time
+	ExpiresAt       time.Time
+	// Active is set while the session has a token that is neither revoked nor expired
+	Active bool
+}
+
+// countableColumns are the columns users can be counted by
+var countableColumns = map[string]bool{"status": true, "role": true}
+
+// ListUsers returns users matching the filter, newest first
+func (r *authRepository) ListUsers(ctx context.Context, filter UserFilter, page, pageSize int) ([]*User, int, error) {
+	r.logger.Debug("Listing users for admins",
+		zap.Any("filter", filter),
+		zap.Int("page", page),
+		zap.Int("page_size", pageSize))
+
+	scopes := append(filter.scopes(), database.OrderBy("created_at DESC"))
+	users, total, err := r.users.List(ctx, page, pageSize, scopes...)
+	if err != nil {
+		r.logger.Error("Database error while listing users", zap.Error(err))
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// CountUsersBy counts the users matching the filter by the values of a column, "status" or "role"
+func (r *authRepository) CountUsersBy(ctx context.Context, column string, filter UserFilter) (map[string]int, error) {
+	if !countableColumns[column] {
+		return nil, fmt.Errorf("users can't be counted by %s", column)
+	}
+
+	var rows []struct {
+		Value string
+		Count int
+	}
+	err := r.users.Query(ctx, filter.scopes()...).
+		Select(column + " AS value, COUNT(*) AS count").
+		Group(column).
+		Scan(&rows).Error
+	if err != nil {
+		r.logger.Error("Database error while counting users",
+			zap.String("column", column),
+			zap.Error(err))
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Value] = row.Count
+	}
+	return counts, nil
+}
+
+// GetSessionStats summarizes the sessions of the given users in one query.
+// Users without any sessions are missing from the result.
+func (r *authRepository) GetSessionStats(ctx context.Context, userIDs []string) (map[string]*UserSessionStats, error) {
+	stats := make(map[string]*UserSessionStats, len(userIDs))
+	if len(userIDs) == 0 {
+		return stats, nil
+	}
+
+	// The first token of a family is issued on login and its ID is the family ID
+	var rows []*UserSessionStats
+	err := r.refreshTokens.Query(ctx, database.Where("user_id IN ?", userIDs)).
+		Select("user_id, "+
+			"SUM(CASE WHEN revoked_at IS NULL AND expires_at > ? THEN 1 ELSE 0 END) AS active_sessions, "+
+			"MAX(CASE WHEN id = family_id THEN created_at END) AS last_login_at", time.Now()).
+		Group("user_id").
+		Scan(&rows).Error
+	if err != nil {
+		r.logger.Error("Database error while summarizing sessions", zap.Error(err))
+		return nil, err
+	}
+
+	for _, row := range rows {
+		stats[row.UserID] = row
+	}
+	return stats, nil
+}
+
+// ListSessions returns a user's most recent sessions, including ended ones, newest first
+func (r *authRepository) ListSessions(ctx context.Context, userID string, limit int) ([]*Session, error) {
+	var rows []struct {
+		FamilyID        string
+		StartedAt       time.Time
+		LastRefreshedAt time.Time
+		ExpiresAt       time.Time
+		Live            int
+	}
+	err := r.refreshTokens.Query(ctx, database.Where("user_id = ?", userID)).
+		Select("family_id, "+
+			"MIN(created_at) AS started_at, "+
+			"MAX(created_at) AS last_refreshed_at, "+
+			"MAX(expires_at) AS expires_at, "+
+			"SUM(CASE WHEN revoked_at IS NULL AND expires_at > ? THEN 1 ELSE 0 END) AS live", time.Now()).
+		Group("family_id").
+		Order("started_at DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	if err != nil {
+		r.logger.Error("Database error while listing sessions",
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	sessions := make([]*Session, len(rows))
+	for i, row := range rows {
+		sessions[i] = &Session{
+			ID:              row.FamilyID,
+			StartedAt:       row.StartedAt,
+			LastRefreshedAt: row.LastRefreshedAt,
+			ExpiresAt:       row.ExpiresAt,
+			Active:          row.Live > 0,
+		}
+	}
+	return sessions, nil
+}
+
+// ListUserEvents returns the most recent events about a user, newest first.
+// Events are only stored with the database events backend, otherwise there are none.
+func (r *authRepository) ListUserEvents(ctx context.Context, userID string, limit int) ([]*events.Record, error) {
+	if !r.db.Migrator().HasTable(&events.Record{}) {
+		return nil, nil
+	}
+
+	var records []*events.Record
+	err := r.db.WithContext(ctx).
+		Where("subject = ?", userID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&records).Error
+	if err != nil {
+		r.logger.Error("Database error while listing user events",
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// ListUserIDs returns the IDs of every user matching the filter, oldest first
+func (r *authRepository) ListUserIDs(ctx context.Context, filter UserFilter) ([]string, error) {
+	r.logger.Debug("Listing user IDs", zap.Any("filter", filter))
+
+	var ids []string
+	scopes := append(filter.scopes(), database.OrderBy("created_at ASC"))
+	if err := r.users.Query(ctx, scopes...).Pluck("id", &ids).Error; err != nil {
+		r.logger.Error("Database error while listing user IDs", zap.Error(err))
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// RequirePasswordReset makes a user reset their password before they can log in again
+func (r *authRepository) RequirePasswordReset(ctx context.Context, id string) error {
+	r.logger.Debug("Requiring password reset", zap.String("user_id", id))
+
+	err := r.users.Update(ctx, id,
+		map[string]interface{}{"password_reset_required": true, "updated_at": time.Now()})
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		r.logger.Error("Database error while requiring password reset",
+			zap.String("user_id", id),
+			zap.Error(err))
+	}
+
+	return err
+}
+
+// InvalidateSessions ends every session of a user in one transaction: access
+// tokens issued before at are rejected and the active refresh tokens are
+// revoked. It returns how many refresh tokens were revoked.
+func (r *authRepository) InvalidateSessions(ctx context.Context, userID string, at time.Time) (int64, error) {
+	r.logger.Debug("Invalidating sessions of user",
+		zap.String("user_id", userID),
+		zap.Time("valid_after", at))
+
+	var revoked int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := r.users.WithDB(tx).Update(ctx, userID, map[string]interface{}{
+			"tokens_valid_after": at,
+			"updated_at":         at,
+		})
+		if err != nil {
+			return err
+		}
+
+		result := r.refreshTokens.WithDB(tx).Query(ctx,
+			database.Where("user_id = ?", userID),
+			database.Where("revoked_at IS NULL")).
+			Update("revoked_at", at)
+		revoked = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			r.logger.Error("Database error while invalidating sessions of user",
+				zap.String("user_id", userID),
+				zap.Error(err))
+		}
+		return 0, err
+	}
+
+	return revoked, nil
+}
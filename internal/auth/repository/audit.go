@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrAuditLogNotFound is returned for unknown audit log entries
+var ErrAuditLogNotFound = errors.New("audit log entry not found")
+
+// Audit log actions
+const (
+	// AuditImpersonation is an admin obtaining a token for a user
+	AuditImpersonation = "impersonation"
+)
+
+// AuditLog records an admin's action on a user. Entries are purged after
+// RETENTION_AUDIT_LOG_DAYS and anonymized with their user.
+type AuditLog struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement"`
+	// ActorID is the admin who acted
+	ActorID string `gorm:"index;type:varchar(36)"`
+	// UserID is the user acted on
+	UserID string `gorm:"index;type:varchar(36)"`
+	// Email is the user's email at the time
+	Email  string `gorm:"type:varchar(255);default:''"`
+	Action string `gorm:"type:varchar(50)"`
+	// Details is a JSON object, e.g. the reason of an impersonation
+	Details   string    `gorm:"type:text"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// CreateAuditLog stores an audit log entry
+func (r *authRepository) CreateAuditLog(ctx context.Context, entry *AuditLog) error {
+	r.logger.Debug("Creating audit log entry",
+		zap.String("action", entry.Action),
+		zap.String("actor_id", entry.ActorID),
+		zap.String("user_id", entry.UserID))
+
+	if err := r.auditLogs.Create(ctx, entry); err != nil {
+		r.logger.Error("Database error while creating audit log entry",
+			zap.String("action", entry.Action),
+			zap.String("user_id", entry.UserID),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
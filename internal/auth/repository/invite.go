@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// Invite errors
+var (
+	ErrInviteNotFound = errors.New("invite not found")
+	// ErrInviteUnavailable is returned when an invite was accepted, e.g.
+	// concurrently, or expired before it could be accepted
+	ErrInviteUnavailable = errors.New("invite was already accepted or expired")
+)
+
+// Invite lets an email register while registration is invite-only. Only a
+// hash of the code is stored.
+type Invite struct {
+	ID string `gorm:"primaryKey;type:varchar(36)"`
+	// TenantID is the tenant the account is created in
+	TenantID string `gorm:"type:varchar(36);default:'default'"`
+	Email    string `gorm:"index;type:varchar(255)"`
+	// CodeHash is the SHA-256 of the code
+	CodeHash string `gorm:"uniqueIndex;type:varchar(64)"`
+	// InvitedBy is the admin who created the invite
+	InvitedBy string `gorm:"type:varchar(36)"`
+	// UserID is the account created by accepting the invite
+	UserID     string `gorm:"type:varchar(36);default:''"`
+	AcceptedAt *time.Time
+	ExpiresAt  time.Time `gorm:"index"`
+	CreatedAt  time.Time
+}
+
+// CreateInvite stores a new invite
+func (r *authRepository) CreateInvite(ctx context.Context, invite *Invite) error {
+	r.logger.Debug("Creating invite",
+		zap.String("invite_id", invite.ID),
+		zap.String("email", invite.Email),
+		zap.String("invited_by", invite.InvitedBy))
+
+	if err := r.invites.Create(ctx, invite); err != nil {
+		r.logger.Error("Database error while creating invite",
+			zap.String("email", invite.Email),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// GetInviteByHash gets an invite by the hash of its code
+func (r *authRepository) GetInviteByHash(ctx context.Context, hash string) (*Invite, error) {
+	invite, err := r.invites.First(ctx, database.Where("code_hash = ?", hash))
+	if err != nil && !errors.Is(err, ErrInviteNotFound) {
+		r.logger.Error("Database error while getting invite", zap.Error(err))
+	}
+
+	return invite, err
+}
+
+// AcceptInvite creates the active account of an invite's email and marks the
+// invite accepted in one transaction. ErrInviteUnavailable is returned if the
+// invite was accepted concurrently or expired in the meantime.
+func (r *authRepository) AcceptInvite(ctx context.Context, inviteID, email, password, name string) (string, error) {
+	r.logger.Debug("Accepting invite",
+		zap.String("invite_id", inviteID),
+		zap.String("email", email))
+
+	user, err := r.newUser(ctx, email, password, name, StatusActive)
+	if err != nil {
+		return "", err
+	}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The conditions let only one of two concurrent acceptances win, and
+		// only before the invite expires
+		now := time.Now()
+		err := r.invites.WithDB(tx).Update(ctx, inviteID,
+			map[string]interface{}{"accepted_at": now, "user_id": user.ID},
+			database.Where("accepted_at IS NULL"),
+			database.Where("expires_at > ?", now))
+		if errors.Is(err, ErrInviteNotFound) {
+			return ErrInviteUnavailable
+		}
+		if err != nil {
+			return err
+		}
+
+		return r.users.WithDB(tx).Create(ctx, user)
+	})
+	if err != nil {
+		if !errors.Is(err, ErrInviteUnavailable) {
+			r.logger.Error("Database error while accepting invite",
+				zap.String("invite_id", inviteID),
+				zap.String("email", email),
+				zap.Error(err))
+		}
+		return "", err
+	}
+
+	return user.ID, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// ErrLoginHistoryNotFound is returned for unknown login history entries
+var ErrLoginHistoryNotFound = errors.New("login history entry not found")
+
+// LoginHistory records a login attempt on a user's account, successful or
+// not, for the user to review. Entries are purged after
+// RETENTION_LOGIN_HISTORY_DAYS and anonymized with their user.
+type LoginHistory struct {
+	ID     uint64 `gorm:"primaryKey;autoIncrement"`
+	UserID string `gorm:"index:idx_login_histories_user_id_created_at,priority:1;type:varchar(36)"`
+	// Email is the email the attempt was made with
+	Email string `gorm:"type:varchar(255);default:''"`
+	// Method is how the user authenticated, e.g. password or webauthn
+	Method  string `gorm:"type:varchar(20)"`
+	Success bool
+	// Reason is why a failed attempt was rejected
+	Reason    string    `gorm:"type:varchar(255);default:''"`
+	IPAddress string    `gorm:"type:varchar(45);default:''"`
+	UserAgent string    `gorm:"type:varchar(255);default:''"`
+	CreatedAt time.Time `gorm:"index;index:idx_login_histories_user_id_created_at,priority:2"`
+}
+
+// CreateLoginHistory stores a login history entry
+func (r *authRepository) CreateLoginHistory(ctx context.Context, entry *LoginHistory) error {
+	r.logger.Debug("Creating login history entry",
+		zap.String("user_id", entry.UserID),
+		zap.Bool("success", entry.Success))
+
+	if err := r.loginHistory.Create(ctx, entry); err != nil {
+		r.logger.Error("Database error while creating login history entry",
+			zap.String("user_id", entry.UserID),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// ListLoginHistory returns a page of a user's login history, newest first
+func (r *authRepository) ListLoginHistory(ctx context.Context, userID string, page, pageSize int) ([]*LoginHistory, int, error) {
+	r.logger.Debug("Listing login history",
+		zap.String("user_id", userID),
+		zap.Int("page", page),
+		zap.Int("page_size", pageSize))
+
+	entries, total, err := r.loginHistory.List(ctx, page, pageSize,
+		database.Where("user_id = ?", userID),
+		database.OrderBy("created_at DESC, id DESC"))
+	if err != nil {
+		r.logger.Error("Database error while listing login history",
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// MFA errors
+var (
+	ErrTOTPCredentialNotFound = errors.New("TOTP credential not found")
+	// ErrTOTPCodeUsed is returned when a code's time step isn't newer than the last used one
+	ErrTOTPCodeUsed          = errors.New("TOTP code was already used")
+	ErrMFAChallengeNotFound  = errors.New("MFA challenge not found")
+	ErrMFAChallengeCompleted = errors.New("MFA challenge was already completed")
+	ErrMFAChallengeExhausted = errors.New("MFA challenge has no attempts left")
+)
+
+// TOTPCredential is a user's authenticator app. It's pending until the user
+// confirmed it with a code, only confirmed credentials are asked for at login.
+type TOTPCredential struct {
+	ID     string `gorm:"primaryKey;type:varchar(36)"`
+	UserID string `gorm:"uniqueIndex;type:varchar(36)"`
+	// Secret is the base32 TOTP secret shared with the app
+	Secret      string `gorm:"type:varchar(64)"`
+	ConfirmedAt *time.Time
+	// LastStep is the time step of the last accepted code, codes can't be used twice
+	LastStep  int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Confirmed reports whether the user confirmed the credential, enabling MFA
+func (c *TOTPCredential) Confirmed() bool {
+	return c.ConfirmedAt != nil
+}
+
+// MFAChallenge is the second step of a login to an account with MFA, started
+// once the password was checked. Only a hash of its token is stored.
+type MFAChallenge struct {
+	ID     string `gorm:"primaryKey;type:varchar(36)"`
+	UserID string `gorm:"index;type:varchar(36)"`
+	// TokenHash is the SHA-256 of the token
+	TokenHash string `gorm:"uniqueIndex;type:varchar(64)"`
+	// ClientType, Scope and ExpiresIn are the login's, applied to the issued tokens
+	ClientType string `gorm:"type:varchar(20);default:''"`
+	Scope      string `gorm:"type:varchar(255);default:''"`
+	ExpiresIn  int64
+	// Attempts counts the codes entered
+	Attempts    int
+	CompletedAt *time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+	CreatedAt   time.Time
+}
+
+// GetTOTPCredential gets a user's TOTP credential, pending or confirmed
+func (r *authRepository) GetTOTPCredential(ctx context.Context, userID string) (*TOTPCredential, error) {
+	credential, err := r.totpCredentials.First(ctx, database.Where("user_id = ?", userID))
+	if err != nil && !errors.Is(err, ErrTOTPCredentialNotFound) {
+		r.logger.Error("Database error while getting TOTP credential",
+			zap.String("user_id", userID),
+			zap.Error(err))
+	}
+
+	return credential, err
+}
+
+// SaveTOTPCredential creates or replaces a TOTP credential
+func (r *authRepository) SaveTOTPCredential(ctx context.Context, credential *TOTPCredential) error {
+	r.logger.Debug("Saving TOTP credential", zap.String("user_id", credential.UserID))
+
+	if err := r.totpCredentials.Save(ctx, credential); err != nil {
+		r.logger.Error("Database error while saving TOTP credential",
+			zap.String("user_id", credential.UserID),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code, confirming a pending
+// credential. ErrTOTPCodeUsed is returned if the step isn't newer than the
+// last one, e.g. for a code used concurrently.
+func (r *authRepository) UseTOTPStep(ctx context.Context, id string, step int64) error {
+	// The condition on last_step lets only one of two concurrent uses of a code win
+	result := r.totpCredentials.Query(ctx,
+		database.Where("id = ?", id),
+		database.Where("last_step < ?", step)).
+		Updates(map[string]interface{}{
+			"last_step":    step,
+			"confirmed_at": gorm.Expr("COALESCE(confirmed_at, ?)", time.Now()),
+			"updated_at":   time.Now(),
+		})
+	if result.Error != nil {
+		r.logger.Error("Database error while using TOTP code",
+			zap.String("credential_id", id),
+			zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTOTPCodeUsed
+	}
+
+	return nil
+}
+
+// CreateMFAChallenge stores a new MFA challenge
+func (r *authRepository) CreateMFAChallenge(ctx context.Context, challenge *MFAChallenge) error {
+	r.logger.Debug("Creating MFA challenge",
+		zap.String("challenge_id", challenge.ID),
+		zap.String("user_id", challenge.UserID))
+
+	if err := r.mfaChallenges.Create(ctx, challenge); err != nil {
+		r.logger.Error("Database error while creating MFA challenge",
+			zap.String("user_id", challenge.UserID),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// GetMFAChallengeByHash gets an MFA challenge by the hash of its token
+func (r *authRepository) GetMFAChallengeByHash(ctx context.Context, hash string) (*MFAChallenge, error) {
+	challenge, err := r.mfaChallenges.First(ctx, database.Where("token_hash = ?", hash))
+	if err != nil && !errors.Is(err, ErrMFAChallengeNotFound) {
+		r.logger.Error("Database error while getting MFA challenge", zap.Error(err))
+	}
+
+	return challenge, err
+}
+
+// AttemptMFAChallenge counts an attempt at a challenge before its code is
+// checked. ErrMFAChallengeExhausted is returned if the challenge already had
+// maxAttempts attempts or was completed.
+func (r *authRepository) AttemptMFAChallenge(ctx context.Context, id string, maxAttempts int) error {
+	// The condition on attempts stops concurrent guesses from exceeding the limit
+	err := r.mfaChallenges.Update(ctx, id,
+		map[string]interface{}{"attempts": gorm.Expr("attempts + 1")},
+		database.Where("attempts < ? AND completed_at IS NULL", maxAttempts))
+	if errors.Is(err, ErrMFAChallengeNotFound) {
+		return ErrMFAChallengeExhausted
+	}
+	if err != nil {
+		r.logger.Error("Database error while attempting MFA challenge",
+			zap.String("challenge_id", id),
+			zap.Error(err))
+	}
+
+	return err
+}
+
+// CompleteMFAChallenge marks a challenge as completed. ErrMFAChallengeCompleted
+// is returned if it was completed concurrently.
+func (r *authRepository) CompleteMFAChallenge(ctx context.Context, id string) error {
+	// The condition on completed_at lets only one of two concurrent logins win
+	err := r.mfaChallenges.Update(ctx, id,
+		map[string]interface{}{"completed_at": time.Now()},
+		database.Where("completed_at IS NULL"))
+	if errors.Is(err, ErrMFAChallengeNotFound) {
+		return ErrMFAChallengeCompleted
+	}
+	if err != nil {
+		r.logger.Error("Database error while completing MFA challenge",
+			zap.String("challenge_id", id),
+			zap.Error(err))
+	}
+
+	return err
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// ErrOrganizationOfOtherTenant is returned for syncs of another tenant's organization
+var ErrOrganizationOfOtherTenant = errors.New("organization belongs to another tenant")
+
+// Organization is a group of users whose members are managed by an external
+// system, e.g. HR. It's created by the first sync of its members.
+type Organization struct {
+	ID string `gorm:"primaryKey;type:varchar(36)"`
+	// TenantID is the tenant that created the organization, its members are users of the tenant
+	TenantID  string `gorm:"index;type:varchar(36);default:'default'"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// OrganizationMember is a user's membership in an organization
+type OrganizationMember struct {
+	OrganizationID string `gorm:"primaryKey;type:varchar(36)"`
+	UserID         string `gorm:"primaryKey;type:varchar(36);index"`
+	// Role is the member's role in the organization, e.g. member or admin
+	Role      string `gorm:"type:varchar(20)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// MembershipChange is a change to an organization's members. OldRole is empty
+// for added members, NewRole for removed ones.
+type MembershipChange struct {
+	UserID  string
+	Email   string
+	OldRole string
+	NewRole string
+}
+
+// GetUsersByEmails returns the users with the given emails, ignoring case
+func (r *authRepository) GetUsersByEmails(ctx context.Context, emails []string) ([]*User, error) {
+	var users []*User
+	if len(emails) == 0 {
+		return users, nil
+	}
+
+	lowered := make([]string, len(emails))
+	for i, email := range emails {
+		lowered[i] = strings.ToLower(email)
+	}
+	err := r.users.Query(ctx, database.Where("LOWER(email) IN ?", lowered)).
+		Select("id", "email").
+		Find(&users).Error
+	if err != nil {
+		r.logger.Error("Database error while getting users by email", zap.Error(err))
+		return nil, err
+	}
+	return users, nil
+}
+
+// SyncOrganizationMembers makes members, by user ID to role, the members of an
+// organization in one transaction and returns the changes, sorted by user ID.
+// The organization is created in the context's tenant if it doesn't exist.
+// With dryRun the changes are only computed.
+func (r *authRepository) SyncOrganizationMembers(ctx context.Context, organizationID string, members map[string]string, dryRun bool) ([]*MembershipChange, error) {
+	r.logger.Debug("Syncing organization members",
+		zap.String("organization_id", organizationID),
+		zap.Int("members", len(members)),
+		zap.Bool("dry_run", dryRun))
+
+	var changes []*MembershipChange
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the organization so concurrent syncs apply one after the other,
+		// including the first ones of an organization without members
+		tenant := database.TenantOrDefault(ctx)
+		var organization Organization
+		if !dryRun {
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&Organization{ID: organizationID, TenantID: tenant}).Error
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", organizationID).
+			Limit(1).
+			Find(&organization).Error
+		if err != nil {
+			return err
+		}
+		if organization.ID != "" && organization.TenantID != tenant {
+			return ErrOrganizationOfOtherTenant
+		}
+
+		var current []OrganizationMember
+		err = tx.Where("organization_id = ?", organizationID).Find(&current).Error
+		if err != nil {
+			return err
+		}
+
+		existing := make(map[string]string, len(current))
+		for _, member := range current {
+			existing[member.UserID] = member.Role
+			if _, ok := members[member.UserID]; !ok {
+				changes = append(changes, &MembershipChange{UserID: member.UserID, OldRole: member.Role})
+			}
+		}
+		for userID, role := range members {
+			if old, ok := existing[userID]; !ok || old != role {
+				changes = append(changes, &MembershipChange{UserID: userID, OldRole: old, NewRole: role})
+			}
+		}
+		sort.Slice(changes, func(i, j int) bool {
+			return changes[i].UserID < changes[j].UserID
+		})
+
+		if err := r.fillChangeEmails(ctx, tx, changes); err != nil {
+			return err
+		}
+		if dryRun || len(changes) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		var upserts []OrganizationMember
+		var removed []string
+		for _, change := range changes {
+			if change.NewRole == "" {
+				removed = append(removed, change.UserID)
+				continue
+			}
+			upserts = append(upserts, OrganizationMember{
+				OrganizationID: organizationID,
+				UserID:         change.UserID,
+				Role:           change.NewRole,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			})
+		}
+
+		if len(removed) > 0 {
+			err := tx.Where("organization_id = ? AND user_id IN ?", organizationID, removed).
+				Delete(&OrganizationMember{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(upserts) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "organization_id"}, {Name: "user_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+			}).Create(&upserts).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&Organization{}).Where("id = ?", organizationID).Update("updated_at", now).Error
+	})
+	if errors.Is(err, ErrOrganizationOfOtherTenant) {
+		return nil, err
+	}
+	if err != nil {
+		r.logger.Error("Database error while syncing organization members",
+			zap.String("organization_id", organizationID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// fillChangeEmails sets the emails of the changed members' users
+func (r *authRepository) fillChangeEmails(ctx context.Context, tx *gorm.DB, changes []*MembershipChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	userIDs := make([]string, len(changes))
+	for i, change := range changes {
+		userIDs[i] = change.UserID
+	}
+	var users []*User
+	err := r.users.WithDB(tx).Query(ctx, database.Where("id IN ?", userIDs)).
+		Select("id", "email").
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+
+	emails := make(map[string]string, len(users))
+	for _, user := range users {
+		emails[user.ID] = user.Email
+	}
+	for _, change := range changes {
+		change.Email = emails[change.UserID]
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// Password errors
+var (
+	ErrPasswordMismatch = errors.New("password does not match")
+	// ErrUnknownPasswordHash is returned for stored passwords of an unknown format
+	ErrUnknownPasswordHash = errors.New("unknown password hash format")
+)
+
+// Sizes of argon2id salts and keys in bytes
+const (
+	argon2SaltSize = 16
+	argon2KeySize  = 32
+)
+
+// passwordHasher hashes passwords with the algorithm of PASSWORD_HASH_ALGORITHM
+// and verifies the hashes of every algorithm
+type passwordHasher struct {
+	cfg config.PasswordHashingConfig
+}
+
+// hash hashes a password. Argon2id hashes are stored in the PHC string format,
+// e.g. "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>".
+func (h *passwordHasher) hash(password string) (string, error) {
+	if h.cfg.Algorithm != config.PasswordArgon2id {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		return string(hashed), err
+	}
+
+	salt := make([]byte, argon2SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, uint32(h.cfg.Argon2Iterations), uint32(h.cfg.Argon2Memory),
+		uint8(h.cfg.Argon2Parallelism), argon2KeySize)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		h.cfg.Argon2Memory, h.cfg.Argon2Iterations, h.cfg.Argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verify checks a password against its hash and reports whether the hash
+// should be replaced, as it wasn't made with the current algorithm and parameters
+func (h *passwordHasher) verify(hashed, password string) (bool, error) {
+	if strings.HasPrefix(hashed, "$argon2id$") {
+		return h.verifyArgon2id(hashed, password)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, ErrPasswordMismatch
+		}
+		return false, fmt.Errorf("%w: %v", ErrUnknownPasswordHash, err)
+	}
+	cost, err := bcrypt.Cost([]byte(hashed))
+	if err != nil {
+		return false, err
+	}
+	return h.cfg.Algorithm != config.PasswordBcrypt || cost != h.cfg.BcryptCost, nil
+}
+
+// verifyArgon2id checks a password against an argon2id hash
+func (h *passwordHasher) verifyArgon2id(hashed, password string) (bool, error) {
+	// "", "argon2id", version, parameters, salt, key
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 {
+		return false, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("%w: argon2 version %q", ErrUnknownPasswordHash, parts[2])
+	}
+	var memory, iterations uint32
+	var parallelism uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+		return false, fmt.Errorf("%w: argon2 parameters %q", ErrUnknownPasswordHash, parts[3])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("%w: argon2 salt", ErrUnknownPasswordHash)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, fmt.Errorf("%w: argon2 key", ErrUnknownPasswordHash)
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return false, ErrPasswordMismatch
+	}
+
+	outdated := h.cfg.Algorithm != config.PasswordArgon2id ||
+		memory != uint32(h.cfg.Argon2Memory) ||
+		iterations != uint32(h.cfg.Argon2Iterations) ||
+		parallelism != uint8(h.cfg.Argon2Parallelism)
+	return outdated, nil
+}
+
+// CheckPassword verifies a user's password and reports whether its hash should
+// be upgraded with RehashPassword. ErrPasswordMismatch is returned for wrong passwords.
+func (r *authRepository) CheckPassword(storedPassword, providedPassword string) (bool, error) {
+	return r.passwords.verify(storedPassword, providedPassword)
+}
+
+// RehashPassword replaces a user's verified password hash with one of the
+// current algorithm and parameters. The hash is kept if the password was
+// changed meanwhile.
+func (r *authRepository) RehashPassword(ctx context.Context, userID, storedPassword, password string) error {
+	hashedPassword, err := r.passwords.hash(password)
+	if err != nil {
+		r.logger.Error("Failed to hash password", zap.Error(err))
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// The condition on the stored hash lets a concurrent password change win
+	err = r.users.Update(ctx, userID,
+		map[string]interface{}{"password": hashedPassword, "updated_at": time.Now()},
+		database.Where("password = ?", storedPassword))
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		r.logger.Error("Database error while rehashing password",
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return err
+	}
+
+	r.logger.Debug("Password rehashed",
+		zap.String("user_id", userID),
+		zap.String("algorithm", r.passwords.cfg.Algorithm))
+	return nil
+}
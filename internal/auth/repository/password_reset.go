@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// Password reset token errors
+var (
+	ErrPasswordResetTokenNotFound = errors.New("password reset token not found")
+	// ErrPasswordResetTokenUsed is returned when a token was already used, e.g. concurrently
+	ErrPasswordResetTokenUsed = errors.New("password reset token was already used")
+)
+
+// PasswordResetToken lets a user set a new password without knowing the
+// current one. Only a hash of the token is stored.
+type PasswordResetToken struct {
+	ID     string `gorm:"primaryKey;type:varchar(36)"`
+	UserID string `gorm:"index;type:varchar(36)"`
+	// TokenHash is the SHA-256 of the token
+	TokenHash string `gorm:"uniqueIndex;type:varchar(64)"`
+	UsedAt    *time.Time
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// CreatePasswordResetToken stores a new password reset token
+func (r *authRepository) CreatePasswordResetToken(ctx context.Context, token *PasswordResetToken) error {
+	r.logger.Debug("Creating password reset token",
+		zap.String("token_id", token.ID),
+		zap.String("user_id", token.UserID))
+
+	if err := r.resetTokens.Create(ctx, token); err != nil {
+		r.logger.Error("Database error while creating password reset token",
+			zap.String("user_id", token.UserID),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// GetPasswordResetTokenByHash gets a password reset token by the hash of its value
+func (r *authRepository) GetPasswordResetTokenByHash(ctx context.Context, hash string) (*PasswordResetToken, error) {
+	token, err := r.resetTokens.First(ctx, database.Where("token_hash = ?", hash))
+	if err != nil && !errors.Is(err, ErrPasswordResetTokenNotFound) {
+		r.logger.Error("Database error while getting password reset token", zap.Error(err))
+	}
+
+	return token, err
+}
+
+// ResetPassword uses a reset token to set a user's password in one transaction.
+// The user's other unused reset tokens are used up as well, and a required
+// reset is cleared. ErrPasswordResetTokenUsed is returned if the token was used
+// concurrently.
+func (r *authRepository) ResetPassword(ctx context.Context, tokenID, userID, password string) error {
+	r.logger.Debug("Resetting password",
+		zap.String("token_id", tokenID),
+		zap.String("user_id", userID))
+
+	hashedPassword, err := r.passwords.hash(password)
+	if err != nil {
+		r.logger.Error("Failed to hash password", zap.Error(err))
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tokens := r.resetTokens.WithDB(tx)
+		now := time.Now()
+
+		// The condition on used_at lets only one of two concurrent resets win
+		err := tokens.Update(ctx, tokenID,
+			map[string]interface{}{"used_at": now},
+			database.Where("used_at IS NULL"))
+		if errors.Is(err, ErrPasswordResetTokenNotFound) {
+			return ErrPasswordResetTokenUsed
+		}
+		if err != nil {
+			return err
+		}
+
+		// Links from earlier requests stop working once the password was changed
+		err = tokens.Query(ctx,
+			database.Where("user_id = ?", userID),
+			database.Where("used_at IS NULL")).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		return r.users.WithDB(tx).Update(ctx, userID, map[string]interface{}{
+			"password":                string(hashedPassword),
+			"password_reset_required": false,
+			"updated_at":              now,
+		})
+	})
+	if err != nil && !errors.Is(err, ErrPasswordResetTokenUsed) && !errors.Is(err, ErrUserNotFound) {
+		r.logger.Error("Database error while resetting password",
+			zap.String("user_id", userID),
+			zap.Error(err))
+	}
+
+	return err
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// benchmarkBcryptCost matches the default PASSWORD_BCRYPT_COST
+const benchmarkBcryptCost = 14
+
+// bcryptHasher returns a hasher for bcrypt hashes at benchmarkBcryptCost
+func bcryptHasher() *passwordHasher {
+	return &passwordHasher{cfg: config.PasswordHashingConfig{
+		Algorithm:  config.PasswordBcrypt,
+		BcryptCost: benchmarkBcryptCost,
+	}}
+}
+
+// BenchmarkBcryptHash measures hashing a password, e.g. at registration
+func BenchmarkBcryptHash(b *testing.B) {
+	h := bcryptHasher()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := h.hash("password123"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkBcryptVerify measures verifying a password at login
+func BenchmarkBcryptVerify(b *testing.B) {
+	h := bcryptHasher()
+	hashed, err := h.hash("password123")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := h.verify(hashed, "password123"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkBcryptVerifyParallel measures verifying passwords from all CPUs at
+// once, to show how login throughput scales under concurrency
+func BenchmarkBcryptVerifyParallel(b *testing.B) {
+	h := bcryptHasher()
+	hashed, err := h.hash("password123")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := h.verify(hashed, "password123"); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
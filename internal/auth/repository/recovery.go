@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// Account recovery errors
+var (
+	// ErrBackupCodeNotFound is returned for a code the user doesn't have or already used
+	ErrBackupCodeNotFound         = errors.New("backup code not found")
+	ErrRecoveryEmailTokenNotFound = errors.New("recovery email token not found")
+	// ErrRecoveryEmailTokenUsed is returned when a token was already used, e.g. concurrently
+	ErrRecoveryEmailTokenUsed = errors.New("recovery email token was already used")
+)
+
+// BackupCode is a one-time code completing a login in place of the
+// authenticator app, e.g. when the phone is lost. Only a hash of it is stored.
+type BackupCode struct {
+	ID     string `gorm:"primaryKey;type:varchar(36)"`
+	UserID string `gorm:"index;type:varchar(36)"`
+	// CodeHash is the SHA-256 of the normalized code
+	CodeHash  string `gorm:"type:varchar(64)"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// RecoveryEmailToken verifies that a user can read the recovery email they
+// added, which is only set once it's verified. Only a hash of the token is stored.
+type RecoveryEmailToken struct {
+	ID     string `gorm:"primaryKey;type:varchar(36)"`
+	UserID string `gorm:"index;type:varchar(36)"`
+	// Email is the recovery email being verified
+	Email string `gorm:"type:varchar(100)"`
+	// TokenHash is the SHA-256 of the token
+	TokenHash string `gorm:"uniqueIndex;type:varchar(64)"`
+	UsedAt    *time.Time
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// ListUsersByAnyEmail returns the users whose email or recovery email is the
+// given one. Several users may share a recovery email, e.g. a family's.
+func (r *authRepository) ListUsersByAnyEmail(ctx context.Context, email string) ([]*User, error) {
+	var users []*User
+	err := r.users.Query(ctx,
+		database.Where("email = ? OR recovery_email = ?", email, email),
+		database.OrderBy("created_at ASC")).
+		Find(&users).Error
+	if err != nil {
+		r.logger.Error("Database error while listing users by email",
+			zap.String("email", email),
+			zap.Error(err))
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ReplaceBackupCodes replaces a user's backup codes in one transaction, so the
+// previous ones stop working when the new ones are stored
+func (r *authRepository) ReplaceBackupCodes(ctx context.Context, userID string, codes []*BackupCode) error {
+	r.logger.Debug("Replacing backup codes",
+		zap.String("user_id", userID),
+		zap.Int("count", len(codes)))
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		backupCodes := r.backupCodes.WithDB(tx)
+		if err := backupCodes.Query(ctx, database.Where("user_id = ?", userID)).Delete(&BackupCode{}).Error; err != nil {
+			return err
+		}
+		for _, code := range codes {
+			if err := backupCodes.Create(ctx, code); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		r.logger.Error("Database error while replacing backup codes",
+			zap.String("user_id", userID),
+			zap.Error(err))
+	}
+
+	return err
+}
+
+// UseBackupCode marks an unused backup code of a user as used.
+// ErrBackupCodeNotFound is returned if the user has no such unused code, e.g.
+// because it was used concurrently.
+func (r *authRepository) UseBackupCode(ctx context.Context, userID, hash string) error {
+	// The condition on used_at lets only one of two concurrent uses of a code win
+	result := r.backupCodes.Query(ctx,
+		database.Where("user_id = ?", userID),
+		database.Where("code_hash = ?", hash),
+		database.Where("used_at IS NULL")).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		r.logger.Error("Database error while using backup code",
+			zap.String("user_id", userID),
+			zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBackupCodeNotFound
+	}
+
+	return nil
+}
+
+// CreateRecoveryEmailToken stores a new recovery email token
+func (r *authRepository) CreateRecoveryEmailToken(ctx context.Context, token *RecoveryEmailToken) error {
+	r.logger.Debug("Creating recovery email token",
+		zap.String("token_id", token.ID),
+		zap.String("user_id", token.UserID))
+
+	if err := r.recoveryTokens.Create(ctx, token); err != nil {
+		r.logger.Error("Database error while creating recovery email token",
+			zap.String("user_id", token.UserID),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// GetRecoveryEmailTokenByHash gets a recovery email token by the hash of its value
+func (r *authRepository) GetRecoveryEmailTokenByHash(ctx context.Context, hash string) (*RecoveryEmailToken, error) {
+	token, err := r.recoveryTokens.First(ctx, database.Where("token_hash = ?", hash))
+	if err != nil && !errors.Is(err, ErrRecoveryEmailTokenNotFound) {
+		r.logger.Error("Database error while getting recovery email token", zap.Error(err))
+	}
+
+	return token, err
+}
+
+// VerifyRecoveryEmail uses a recovery email token to set the user's recovery
+// email in one transaction. The user's other unused tokens are used up as well.
+// ErrRecoveryEmailTokenUsed is returned if the token was used concurrently.
+func (r *authRepository) VerifyRecoveryEmail(ctx context.Context, token *RecoveryEmailToken) error {
+	r.logger.Debug("Verifying recovery email",
+		zap.String("token_id", token.ID),
+		zap.String("user_id", token.UserID))
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tokens := r.recoveryTokens.WithDB(tx)
+		now := time.Now()
+
+		// The condition on used_at lets only one of two concurrent verifications win
+		err := tokens.Update(ctx, token.ID,
+			map[string]interface{}{"used_at": now},
+			database.Where("used_at IS NULL"))
+		if errors.Is(err, ErrRecoveryEmailTokenNotFound) {
+			return ErrRecoveryEmailTokenUsed
+		}
+		if err != nil {
+			return err
+		}
+
+		// Links to addresses added before stop working once one was verified
+		err = tokens.Query(ctx,
+			database.Where("user_id = ?", token.UserID),
+			database.Where("used_at IS NULL")).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		return r.users.WithDB(tx).Update(ctx, token.UserID, map[string]interface{}{
+			"recovery_email": token.Email,
+			"updated_at":     now,
+		})
+	})
+	if err != nil && !errors.Is(err, ErrRecoveryEmailTokenUsed) && !errors.Is(err, ErrUserNotFound) {
+		r.logger.Error("Database error while verifying recovery email",
+			zap.String("user_id", token.UserID),
+			zap.Error(err))
+	}
+
+	return err
+}
+
+// RemoveRecoveryEmail removes a user's recovery email, pending verifications
+// stop working as well
+func (r *authRepository) RemoveRecoveryEmail(ctx context.Context, userID string) error {
+	r.logger.Debug("Removing recovery email", zap.String("user_id", userID))
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := r.recoveryTokens.WithDB(tx).Query(ctx,
+			database.Where("user_id = ?", userID),
+			database.Where("used_at IS NULL")).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		return r.users.WithDB(tx).Update(ctx, userID, map[string]interface{}{
+			"recovery_email": "",
+			"updated_at":     now,
+		})
+	})
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		r.logger.Error("Database error while removing recovery email",
+			zap.String("user_id", userID),
+			zap.Error(err))
+	}
+
+	return err
+}
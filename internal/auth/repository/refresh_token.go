@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// Refresh token errors
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	// ErrRefreshTokenRotated is returned when rotating a token that was already rotated or revoked
+	ErrRefreshTokenRotated = errors.New("refresh token was already rotated")
+)
+
+// RefreshToken is a single-use token for obtaining a new access token.
+//
+// Every refresh replaces the token with a new one of the same family, the
+// chain of tokens issued since a login. Only a hash of the token is stored.
+type RefreshToken struct {
+	ID       string `gorm:"primaryKey;type:varchar(36)"`
+	FamilyID string `gorm:"index;type:varchar(36)"`
+	UserID   string `gorm:"index;type:varchar(36)"`
+	// ClientType is the client type the family was started with, its access tokens get its lifetime
+	ClientType string `gorm:"type:varchar(20);default:''"`
+	// Scope is the space separated scopes the family's access tokens are
+	// restricted to, empty for unrestricted ones
+	Scope string `gorm:"type:varchar(255);default:''"`
+	// TokenHash is the SHA-256 of the token
+	TokenHash string `gorm:"uniqueIndex;type:varchar(64)"`
+	// ReplacedBy is the ID of the token this one was rotated to
+	ReplacedBy string `gorm:"type:varchar(36)"`
+	RevokedAt  *time.Time
+	// AuthenticatedAt is when the user logged in to start the family, unset for
+	// families started before it was recorded
+	AuthenticatedAt *time.Time
+	ExpiresAt       time.Time `gorm:"index"`
+	CreatedAt       time.Time
+}
+
+// Rotated reports whether the token was exchanged for a new one
+func (t *RefreshToken) Rotated() bool {
+	return t.ReplacedBy != ""
+}
+
+// CreateRefreshToken stores a new refresh token
+func (r *authRepository) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	r.logger.Debug("Creating refresh token",
+		zap.String("token_id", token.ID),
+		zap.String("family_id", token.FamilyID),
+		zap.String("user_id", token.UserID))
+
+	if err := r.refreshTokens.Create(ctx, token); err != nil {
+		r.logger.Error("Database error while creating refresh token",
+			zap.String("user_id", token.UserID),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// GetRefreshTokenByHash gets a refresh token by the hash of its value
+func (r *authRepository) GetRefreshTokenByHash(ctx context.Context, hash string) (*RefreshToken, error) {
+	token, err := r.refreshTokens.First(ctx, database.Where("token_hash = ?", hash))
+	if err != nil && !errors.Is(err, ErrRefreshTokenNotFound) {
+		r.logger.Error("Database error while getting refresh token", zap.Error(err))
+	}
+
+	return token, err
+}
+
+// RotateRefreshToken revokes a token in favor of its replacement in one transaction.
+// ErrRefreshTokenRotated is returned if the token was rotated or revoked concurrently.
+func (r *authRepository) RotateRefreshToken(ctx context.Context, id string, replacement *RefreshToken) error {
+	r.logger.Debug("Rotating refresh token",
+		zap.String("token_id", id),
+		zap.String("replacement_id", replacement.ID),
+		zap.String("family_id", replacement.FamilyID))
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tokens := r.refreshTokens.WithDB(tx)
+
+		// The condition on revoked_at lets only one of two concurrent refreshes win
+		err := tokens.Update(ctx, id,
+			map[string]interface{}{"revoked_at": time.Now(), "replaced_by": replacement.ID},
+			database.Where("revoked_at IS NULL"))
+		if errors.Is(err, ErrRefreshTokenNotFound) {
+			return ErrRefreshTokenRotated
+		}
+		if err != nil {
+			return err
+		}
+
+		return tokens.Create(ctx, replacement)
+	})
+	if err != nil && !errors.Is(err, ErrRefreshTokenRotated) {
+		r.logger.Error("Database error while rotating refresh token",
+			zap.String("token_id", id),
+			zap.Error(err))
+	}
+
+	return err
+}
+
+// RevokeRefreshTokenFamily revokes every active token of a family and returns how many were revoked
+func (r *authRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) (int64, error) {
+	r.logger.Debug("Revoking refresh token family", zap.String("family_id", familyID))
+
+	result := r.refreshTokens.Query(ctx,
+		database.Where("family_id = ?", familyID),
+		database.Where("revoked_at IS NULL")).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		r.logger.Error("Database error while revoking refresh token family",
+			zap.String("family_id", familyID),
+			zap.Error(result.Error))
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
@@ -8,22 +8,73 @@ import (
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	gormlogger "gorm.io/gorm/logger"
 
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	"github.com/linkeunid/hello-go/pkg/events"
+	"github.com/linkeunid/hello-go/pkg/migrate"
+)
+
+// Account statuses
+const (
+	StatusActive   = "active"
+	StatusPending  = "pending"
+	StatusRejected = "rejected"
+	// StatusSuspended blocks an active account until an admin lifts the suspension
+	StatusSuspended = "suspended"
+)
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Common errors
+var (
+	ErrUserNotFound           = errors.New("user not found")
+	ErrServiceAccountNotFound = errors.New("service account not found")
 )
 
 // User represents a user in the database
 type User struct {
-	ID        string `gorm:"primaryKey;type:varchar(36)"`
-	Email     string `gorm:"uniqueIndex;type:varchar(100)"`
-	Password  string `gorm:"type:varchar(255)"`
-	Name      string `gorm:"type:varchar(100)"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID string `gorm:"primaryKey;type:varchar(36)"`
+	// TenantID is the customer the user belongs to, emails are unique per tenant
+	TenantID string `gorm:"uniqueIndex:idx_users_email_tenant_id,priority:2;index;type:varchar(36);default:'default'"`
+	Email    string `gorm:"uniqueIndex:idx_users_email_tenant_id,priority:1;type:varchar(100)"`
+	Password string `gorm:"type:varchar(255)"`
+	Name     string `gorm:"type:varchar(100)"`
+	Role     string `gorm:"type:varchar(20);default:'user'"`
+	Status   string `gorm:"type:varchar(20);default:'active';index"`
+	// PasswordResetRequired blocks logins until the user sets a new password
+	PasswordResetRequired bool `gorm:"default:false"`
+	// Locale is the preferred language set with the user service, emails are sent in it
+	Locale string `gorm:"type:varchar(35);default:''"`
+	// RecoveryEmail is the verified secondary email that can receive password
+	// reset links, empty if the user has none
+	RecoveryEmail string `gorm:"type:varchar(100);default:'';index"`
+	// TokensValidAfter rejects the user's access tokens issued before it, set
+	// when all of the user's sessions are invalidated
+	TokensValidAfter *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// Models returns the database models managed by this repository
+func Models() []interface{} {
+	return []interface{}{&User{}, &ServiceAccount{}, &RefreshToken{}, &PasswordResetToken{}, &UserTag{}, &Segment{}, &TOTPCredential{}, &MFAChallenge{}, &Organization{}, &OrganizationMember{}, &WebAuthnCredential{}, &WebAuthnSession{}, &AuditLog{}, &Invite{}, &BackupCode{}, &RecoveryEmailToken{}, &LoginHistory{}}
+}
+
+// Indexes returns the indexes the repository's queries rely on, created by the migrations
+func Indexes() []migrate.AddIndex {
+	return []migrate.AddIndex{
+		{Table: "users", Name: "idx_users_email_tenant_id", Columns: []string{"email", "tenant_id"}, Unique: true},
+		{Table: "users", Name: "idx_users_tenant_id", Columns: []string{"tenant_id"}},
+		{Table: "users", Name: "idx_users_status", Columns: []string{"status"}},
+		{Table: "users", Name: "idx_users_created_at_id", Columns: []string{"created_at", "id"}},
+		{Table: "users", Name: "idx_users_recovery_email", Columns: []string{"recovery_email"}},
+	}
 }
 
 // AuthRepository defines the interface for auth repository operations
@@ -32,98 +83,221 @@ type AuthRepository interface {
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	// UserExists checks if a user exists by email
 	UserExists(ctx context.Context, email string) (bool, error)
-	// CreateUser creates a new user
-	CreateUser(ctx context.Context, email, password, name string) (string, error)
-	// CheckPassword verifies a user's password
-	CheckPassword(storedPassword, providedPassword string) error
+	// GetUserByID gets a user by ID
+	GetUserByID(ctx context.Context, id string) (*User, error)
+	// CreateUser creates a new user with the given account status
+	CreateUser(ctx context.Context, email, password, name, status string) (string, error)
+	// ListUsersByStatus returns users with the given account status, oldest first
+	ListUsersByStatus(ctx context.Context, status string, page, pageSize int) ([]*User, int, error)
+	// UpdateStatus changes a user's account status if it currently is the expected one
+	UpdateStatus(ctx context.Context, id, expected, status string) error
+	// CheckPassword verifies a user's password and reports whether its hash should be upgraded
+	CheckPassword(storedPassword, providedPassword string) (bool, error)
+	// RehashPassword replaces a user's verified password hash with one of the current algorithm
+	RehashPassword(ctx context.Context, userID, storedPassword, password string) error
+	// CreateServiceAccount stores a new service account
+	CreateServiceAccount(ctx context.Context, account *ServiceAccount) error
+	// GetServiceAccountByClientID gets a service account by its client ID
+	GetServiceAccountByClientID(ctx context.Context, clientID string) (*ServiceAccount, error)
+	// CreateRefreshToken stores a new refresh token
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	// GetRefreshTokenByHash gets a refresh token by the hash of its value
+	GetRefreshTokenByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	// RotateRefreshToken revokes a token in favor of its replacement
+	RotateRefreshToken(ctx context.Context, id string, replacement *RefreshToken) error
+	// RevokeRefreshTokenFamily revokes every active token of a family
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) (int64, error)
+	// CreatePasswordResetToken stores a new password reset token
+	CreatePasswordResetToken(ctx context.Context, token *PasswordResetToken) error
+	// GetPasswordResetTokenByHash gets a password reset token by the hash of its value
+	GetPasswordResetTokenByHash(ctx context.Context, hash string) (*PasswordResetToken, error)
+	// ResetPassword uses a reset token to set a user's password
+	ResetPassword(ctx context.Context, tokenID, userID, password string) error
+	// ListUsersByAnyEmail returns the users whose email or recovery email is the given one
+	ListUsersByAnyEmail(ctx context.Context, email string) ([]*User, error)
+	// ReplaceBackupCodes replaces a user's backup codes
+	ReplaceBackupCodes(ctx context.Context, userID string, codes []*BackupCode) error
+	// UseBackupCode marks an unused backup code of a user as used
+	UseBackupCode(ctx context.Context, userID, hash string) error
+	// CreateRecoveryEmailToken stores a new recovery email token
+	CreateRecoveryEmailToken(ctx context.Context, token *RecoveryEmailToken) error
+	// GetRecoveryEmailTokenByHash gets a recovery email token by the hash of its value
+	GetRecoveryEmailTokenByHash(ctx context.Context, hash string) (*RecoveryEmailToken, error)
+	// VerifyRecoveryEmail uses a recovery email token to set the user's recovery email
+	VerifyRecoveryEmail(ctx context.Context, token *RecoveryEmailToken) error
+	// RemoveRecoveryEmail removes a user's recovery email
+	RemoveRecoveryEmail(ctx context.Context, userID string) error
+	// CreateInvite stores a new invite
+	CreateInvite(ctx context.Context, invite *Invite) error
+	// GetInviteByHash gets an invite by the hash of its code
+	GetInviteByHash(ctx context.Context, hash string) (*Invite, error)
+	// AcceptInvite creates the active account of an invite's email and marks the invite accepted
+	AcceptInvite(ctx context.Context, inviteID, email, password, name string) (string, error)
+	// GetTOTPCredential gets a user's TOTP credential, pending or confirmed
+	GetTOTPCredential(ctx context.Context, userID string) (*TOTPCredential, error)
+	// SaveTOTPCredential creates or replaces a TOTP credential
+	SaveTOTPCredential(ctx context.Context, credential *TOTPCredential) error
+	// UseTOTPStep records the time step of an accepted code, confirming a pending credential
+	UseTOTPStep(ctx context.Context, id string, step int64) error
+	// CreateMFAChallenge stores a new MFA challenge
+	CreateMFAChallenge(ctx context.Context, challenge *MFAChallenge) error
+	// GetMFAChallengeByHash gets an MFA challenge by the hash of its token
+	GetMFAChallengeByHash(ctx context.Context, hash string) (*MFAChallenge, error)
+	// AttemptMFAChallenge counts an attempt at a challenge, up to maxAttempts
+	AttemptMFAChallenge(ctx context.Context, id string, maxAttempts int) error
+	// CompleteMFAChallenge marks a challenge as completed
+	CompleteMFAChallenge(ctx context.Context, id string) error
+	// ListWebAuthnCredentials returns a user's credentials, oldest first
+	ListWebAuthnCredentials(ctx context.Context, userID string) ([]*WebAuthnCredential, error)
+	// GetWebAuthnCredential gets a credential by its base64url encoded credential ID
+	GetWebAuthnCredential(ctx context.Context, credentialID string) (*WebAuthnCredential, error)
+	// CreateWebAuthnCredential stores a new credential
+	CreateWebAuthnCredential(ctx context.Context, credential *WebAuthnCredential) error
+	// UseWebAuthnCredential records a login with a credential and its new sign count
+	UseWebAuthnCredential(ctx context.Context, id string, previous, signCount uint32) error
+	// CreateWebAuthnSession stores a new WebAuthn session
+	CreateWebAuthnSession(ctx context.Context, session *WebAuthnSession) error
+	// GetWebAuthnSession gets a WebAuthn session by ID
+	GetWebAuthnSession(ctx context.Context, id string) (*WebAuthnSession, error)
+	// CompleteWebAuthnSession marks a session as completed
+	CompleteWebAuthnSession(ctx context.Context, id string) error
+	// CreateAuditLog stores an audit log entry
+	CreateAuditLog(ctx context.Context, entry *AuditLog) error
+	// CreateLoginHistory stores a login history entry
+	CreateLoginHistory(ctx context.Context, entry *LoginHistory) error
+	// ListLoginHistory returns a page of a user's login history, newest first
+	ListLoginHistory(ctx context.Context, userID string, page, pageSize int) ([]*LoginHistory, int, error)
+	// ListUsers returns users matching the filter, newest first
+	ListUsers(ctx context.Context, filter UserFilter, page, pageSize int) ([]*User, int, error)
+	// CountUsersBy counts the users matching the filter by the values of a column, "status" or "role"
+	CountUsersBy(ctx context.Context, column string, filter UserFilter) (map[string]int, error)
+	// GetSessionStats summarizes the sessions of the given users
+	GetSessionStats(ctx context.Context, userIDs []string) (map[string]*UserSessionStats, error)
+	// ListSessions returns a user's most recent sessions, including ended ones, newest first
+	ListSessions(ctx context.Context, userID string, limit int) ([]*Session, error)
+	// ListUserEvents returns the most recent events about a user, newest first
+	ListUserEvents(ctx context.Context, userID string, limit int) ([]*events.Record, error)
+	// ListUserIDs returns the IDs of every user matching the filter, oldest first
+	ListUserIDs(ctx context.Context, filter UserFilter) ([]string, error)
+	// RequirePasswordReset makes a user reset their password before they can log in again
+	RequirePasswordReset(ctx context.Context, id string) error
+	// InvalidateSessions rejects a user's access tokens issued before at and revokes their refresh tokens
+	InvalidateSessions(ctx context.Context, userID string, at time.Time) (int64, error)
+	// AddUserTags tags a user, tags the user already has are kept
+	AddUserTags(ctx context.Context, userID string, tags []string, createdBy string) error
+	// RemoveUserTag removes a tag from a user
+	RemoveUserTag(ctx context.Context, userID, tag string) error
+	// GetUserTags returns the sorted tags of the given users by user ID
+	GetUserTags(ctx context.Context, userIDs []string) (map[string][]string, error)
+	// GetUsersByEmails returns the users with the given emails, ignoring case
+	GetUsersByEmails(ctx context.Context, emails []string) ([]*User, error)
+	// SyncOrganizationMembers makes members, by user ID to role, the members of an organization
+	SyncOrganizationMembers(ctx context.Context, organizationID string, members map[string]string, dryRun bool) ([]*MembershipChange, error)
+	// CreateSegment stores a new segment
+	CreateSegment(ctx context.Context, segment *Segment) error
+	// GetSegment gets a segment by name
+	GetSegment(ctx context.Context, name string) (*Segment, error)
+	// ListSegments returns every segment by name
+	ListSegments(ctx context.Context) ([]*Segment, error)
+	// UpdateSegment replaces the filter and description of the segment with the same name
+	UpdateSegment(ctx context.Context, segment *Segment) error
+	// DeleteSegment deletes a segment by name
+	DeleteSegment(ctx context.Context, name string) error
+	// DB returns the database connection, e.g. for the event publisher
+	DB() *gorm.DB
+	// Ping checks the database connection
+	Ping(ctx context.Context) error
 }
 
 // authRepository implements the AuthRepository interface
 type authRepository struct {
-	db     *gorm.DB
-	logger *zap.Logger
+	db                  *gorm.DB
+	users               *database.Repository[User]
+	serviceAccounts     *database.Repository[ServiceAccount]
+	refreshTokens       *database.Repository[RefreshToken]
+	resetTokens         *database.Repository[PasswordResetToken]
+	segments            *database.Repository[Segment]
+	totpCredentials     *database.Repository[TOTPCredential]
+	mfaChallenges       *database.Repository[MFAChallenge]
+	webauthnCredentials *database.Repository[WebAuthnCredential]
+	webauthnSessions    *database.Repository[WebAuthnSession]
+	auditLogs           *database.Repository[AuditLog]
+	invites             *database.Repository[Invite]
+	backupCodes         *database.Repository[BackupCode]
+	recoveryTokens      *database.Repository[RecoveryEmailToken]
+	loginHistory        *database.Repository[LoginHistory]
+	passwords           *passwordHasher
+	logger              *zap.Logger
 }
 
 // NewAuthRepository creates a new auth repository
 func NewAuthRepository(cfg *config.Config, logger *zap.Logger) AuthRepository {
-	// Create custom GORM logger that uses zap
-	gormLogger := logger.Named("gorm")
-
-	zapAdapter := zapGormLogger{
-		Logger: gormLogger,
-		Config: gormlogger.Config{
-			SlowThreshold:             200 * time.Millisecond,
-			LogLevel:                  gormlogger.Info,
-			IgnoreRecordNotFoundError: false,
-			Colorful:                  false,
-		},
-	}
-
-	var db *gorm.DB
-	var err error
-
-	if cfg.Database.Driver == "mysql" {
-		// Connect to MySQL database
-		db, err = gorm.Open(mysql.Open(cfg.Database.GetDSN()), &gorm.Config{
-			Logger: zapAdapter,
-		})
-	} else {
-		logger.Fatal("Unsupported database driver", zap.String("driver", cfg.Database.Driver))
-	}
-
+	db, err := database.Open(cfg, logger)
 	if err != nil {
 		// Log and panic
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
 
 	// Migrate the schema
-	if err := db.AutoMigrate(&User{}); err != nil {
+	if err := db.AutoMigrate(Models()...); err != nil {
 		logger.Fatal("Failed to migrate database schema", zap.Error(err))
 	}
+	migrate.VerifyIndexes(db, logger, Indexes()...)
 
 	return &authRepository{
-		db:     db,
-		logger: logger,
+		db:                  db,
+		users:               database.NewRepository[User](db, ErrUserNotFound, database.WithTenantColumn("tenant_id")),
+		serviceAccounts:     database.NewRepository[ServiceAccount](db, ErrServiceAccountNotFound),
+		refreshTokens:       database.NewRepository[RefreshToken](db, ErrRefreshTokenNotFound),
+		resetTokens:         database.NewRepository[PasswordResetToken](db, ErrPasswordResetTokenNotFound),
+		segments:            database.NewRepository[Segment](db, ErrSegmentNotFound),
+		totpCredentials:     database.NewRepository[TOTPCredential](db, ErrTOTPCredentialNotFound),
+		mfaChallenges:       database.NewRepository[MFAChallenge](db, ErrMFAChallengeNotFound),
+		webauthnCredentials: database.NewRepository[WebAuthnCredential](db, ErrWebAuthnCredentialNotFound),
+		webauthnSessions:    database.NewRepository[WebAuthnSession](db, ErrWebAuthnSessionNotFound),
+		auditLogs:           database.NewRepository[AuditLog](db, ErrAuditLogNotFound),
+		invites:             database.NewRepository[Invite](db, ErrInviteNotFound),
+		backupCodes:         database.NewRepository[BackupCode](db, ErrBackupCodeNotFound),
+		recoveryTokens:      database.NewRepository[RecoveryEmailToken](db, ErrRecoveryEmailTokenNotFound),
+		loginHistory:        database.NewRepository[LoginHistory](db, ErrLoginHistoryNotFound),
+		passwords:           &passwordHasher{cfg: cfg.Auth.PasswordHashing},
+		logger:              logger,
 	}
 }
 
 // GetUserByEmail gets a user by email
 func (r *authRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
-	var user User
-
 	r.logger.Debug("Getting user by email", zap.String("email", email))
 
-	result := r.db.WithContext(ctx).Where("email = ?", email).First(&user)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+	user, err := r.users.First(ctx, database.Where("email = ?", email))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
 			r.logger.Debug("User not found", zap.String("email", email))
 		} else {
 			r.logger.Error("Database error while getting user",
 				zap.String("email", email),
-				zap.Error(result.Error))
+				zap.Error(err))
 		}
-		return nil, result.Error
+		return nil, err
 	}
 
 	r.logger.Debug("User found",
 		zap.String("email", email),
 		zap.String("user_id", user.ID))
 
-	return &user, nil
+	return user, nil
 }
 
 // UserExists checks if a user exists by email
 func (r *authRepository) UserExists(ctx context.Context, email string) (bool, error) {
-	var count int64
-
 	r.logger.Debug("Checking if user exists", zap.String("email", email))
 
-	result := r.db.WithContext(ctx).Model(&User{}).Where("email = ?", email).Count(&count)
-	if result.Error != nil {
+	count, err := r.users.Count(ctx, database.Where("email = ?", email))
+	if err != nil {
 		r.logger.Error("Database error while checking if user exists",
 			zap.String("email", email),
-			zap.Error(result.Error))
-		return false, result.Error
+			zap.Error(err))
+		return false, err
 	}
 
 	exists := count > 0
@@ -134,108 +308,123 @@ func (r *authRepository) UserExists(ctx context.Context, email string) (bool, er
 	return exists, nil
 }
 
-// CreateUser creates a new user
-func (r *authRepository) CreateUser(ctx context.Context, email, password, name string) (string, error) {
-	// Generate a new UUID for the user ID
-	userID := uuid.New().String()
-
-	r.logger.Debug("Creating new user",
-		zap.String("email", email),
-		zap.String("name", name),
-		zap.String("user_id", userID))
+// GetUserByID gets a user by ID
+func (r *authRepository) GetUserByID(ctx context.Context, id string) (*User, error) {
+	r.logger.Debug("Getting user by ID", zap.String("user_id", id))
 
-	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	user, err := r.users.Get(ctx, id)
 	if err != nil {
-		r.logger.Error("Failed to hash password", zap.Error(err))
-		return "", fmt.Errorf("failed to hash password: %w", err)
+		if errors.Is(err, ErrUserNotFound) {
+			r.logger.Debug("User not found", zap.String("user_id", id))
+			return nil, err
+		}
+		r.logger.Error("Database error while getting user",
+			zap.String("user_id", id),
+			zap.Error(err))
+		return nil, err
 	}
 
-	// Create user
-	user := User{
-		ID:        userID,
-		Email:     email,
-		Password:  string(hashedPassword),
-		Name:      name,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	return user, nil
+}
+
+// CreateUser creates a new user with the given account status
+func (r *authRepository) CreateUser(ctx context.Context, email, password, name, status string) (string, error) {
+	user, err := r.newUser(ctx, email, password, name, status)
+	if err != nil {
+		return "", err
 	}
 
+	r.logger.Debug("Creating new user",
+		zap.String("email", email),
+		zap.String("name", name),
+		zap.String("user_id", user.ID),
+		zap.String("status", status))
+
 	// Save to database
-	result := r.db.WithContext(ctx).Create(&user)
-	if result.Error != nil {
+	if err := r.users.Create(ctx, user); err != nil {
 		r.logger.Error("Database error while creating user",
 			zap.String("email", email),
-			zap.Error(result.Error))
-		return "", result.Error
+			zap.Error(err))
+		return "", err
 	}
 
 	r.logger.Debug("User created successfully",
 		zap.String("email", email),
-		zap.String("user_id", userID))
-
-	return userID, nil
-}
+		zap.String("user_id", user.ID))
 
-// CheckPassword verifies a user's password
-func (r *authRepository) CheckPassword(storedPassword, providedPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(providedPassword))
+	return user.ID, nil
 }
 
-// Custom GORM logger that uses Zap
-type zapGormLogger struct {
-	Logger *zap.Logger
-	gormlogger.Config
-}
+// newUser returns a new user of the context's tenant with a hashed password,
+// not yet stored
+func (r *authRepository) newUser(ctx context.Context, email, password, name, status string) (*User, error) {
+	hashedPassword, err := r.passwords.hash(password)
+	if err != nil {
+		r.logger.Error("Failed to hash password", zap.Error(err))
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
 
-// LogMode sets log mode
-func (l zapGormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
-	newLogger := l
-	newLogger.LogLevel = level
-	return newLogger
+	now := time.Now()
+	return &User{
+		ID:        uuid.New().String(),
+		TenantID:  database.TenantOrDefault(ctx),
+		Email:     email,
+		Password:  string(hashedPassword),
+		Name:      name,
+		Role:      RoleUser,
+		Status:    status,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
 }
 
-// Info logs info
-func (l zapGormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
-	if l.LogLevel >= gormlogger.Info {
-		l.Logger.Sugar().Infof(msg, data...)
+// ListUsersByStatus returns users with the given account status, oldest first
+func (r *authRepository) ListUsersByStatus(ctx context.Context, status string, page, pageSize int) ([]*User, int, error) {
+	r.logger.Debug("Listing users by status",
+		zap.String("status", status),
+		zap.Int("page", page),
+		zap.Int("page_size", pageSize))
+
+	// Oldest registrations are reviewed first
+	users, total, err := r.users.List(ctx, page, pageSize,
+		database.Where("status = ?", status),
+		database.OrderBy("created_at ASC"))
+	if err != nil {
+		r.logger.Error("Database error while listing users",
+			zap.String("status", status),
+			zap.Error(err))
+		return nil, 0, err
 	}
-}
 
-// Warn logs warning
-func (l zapGormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
-	if l.LogLevel >= gormlogger.Warn {
-		l.Logger.Sugar().Warnf(msg, data...)
-	}
+	return users, total, nil
 }
 
-// Error logs error
-func (l zapGormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
-	if l.LogLevel >= gormlogger.Error {
-		l.Logger.Sugar().Errorf(msg, data...)
+// UpdateStatus changes a user's account status if it currently is the expected one
+func (r *authRepository) UpdateStatus(ctx context.Context, id, expected, status string) error {
+	r.logger.Debug("Updating user status",
+		zap.String("user_id", id),
+		zap.String("expected", expected),
+		zap.String("status", status))
+
+	// The expected status in the condition keeps concurrent reviews from overriding each other
+	err := r.users.Update(ctx, id,
+		map[string]interface{}{"status": status, "updated_at": time.Now()},
+		database.Where("status = ?", expected))
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		r.logger.Error("Database error while updating user status",
+			zap.String("user_id", id),
+			zap.Error(err))
 	}
-}
 
-// Trace logs SQL trace
-func (l zapGormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
-	if l.LogLevel <= gormlogger.Silent {
-		return
-	}
+	return err
+}
 
-	elapsed := time.Since(begin)
-	sql, rows := fc()
-	fields := []zap.Field{
-		zap.String("sql", sql),
-		zap.Int64("rows", rows),
-		zap.Duration("elapsed", elapsed),
-	}
+// Ping checks the database connection
+func (r *authRepository) Ping(ctx context.Context) error {
+	return r.users.Ping(ctx)
+}
 
-	switch {
-	case err != nil && l.LogLevel >= gormlogger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
-		l.Logger.Error("SQL error", append(fields, zap.Error(err))...)
-	case elapsed > l.SlowThreshold && l.SlowThreshold != 0 && l.LogLevel >= gormlogger.Warn:
-		l.Logger.Warn("Slow SQL query", fields...)
-	case l.LogLevel >= gormlogger.Info:
-		l.Logger.Debug("SQL query", fields...)
-	}
+// DB returns the database connection
+func (r *authRepository) DB() *gorm.DB {
+	return r.db
 }
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// ServiceAccount is a non-human client that obtains tokens with the client credentials grant
+type ServiceAccount struct {
+	ID       string `gorm:"primaryKey;type:varchar(36)"`
+	Name     string `gorm:"type:varchar(100)"`
+	ClientID string `gorm:"uniqueIndex;type:varchar(64)"`
+	// SecretHash is the SHA-256 of the client secret, which has enough entropy not to need bcrypt
+	SecretHash string `gorm:"type:varchar(64)"`
+	// Scopes are the scopes the account may request, separated by spaces
+	Scopes    string `gorm:"type:varchar(1000)"`
+	Disabled  bool   `gorm:"default:false"`
+	CreatedBy string `gorm:"type:varchar(36)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ScopeList returns the scopes of the account
+func (a *ServiceAccount) ScopeList() []string {
+	return strings.Fields(a.Scopes)
+}
+
+// CreateServiceAccount stores a new service account
+func (r *authRepository) CreateServiceAccount(ctx context.Context, account *ServiceAccount) error {
+	r.logger.Debug("Creating service account",
+		zap.String("id", account.ID),
+		zap.String("name", account.Name),
+		zap.String("client_id", account.ClientID))
+
+	if err := r.serviceAccounts.Create(ctx, account); err != nil {
+		r.logger.Error("Database error while creating service account",
+			zap.String("client_id", account.ClientID),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// GetServiceAccountByClientID gets a service account by its client ID
+func (r *authRepository) GetServiceAccountByClientID(ctx context.Context, clientID string) (*ServiceAccount, error) {
+	r.logger.Debug("Getting service account", zap.String("client_id", clientID))
+
+	account, err := r.serviceAccounts.First(ctx, database.Where("client_id = ?", clientID))
+	if err != nil && !errors.Is(err, ErrServiceAccountNotFound) {
+		r.logger.Error("Database error while getting service account",
+			zap.String("client_id", clientID),
+			zap.Error(err))
+	}
+
+	return account, err
+}
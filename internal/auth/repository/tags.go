@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// Tag and segment errors
+var (
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrSegmentNotFound = errors.New("segment not found")
+)
+
+// UserTag is a tag an admin put on a user, e.g. to group users into cohorts
+type UserTag struct {
+	UserID    string `gorm:"primaryKey;type:varchar(36)"`
+	Tag       string `gorm:"primaryKey;type:varchar(50);index"`
+	CreatedBy string `gorm:"type:varchar(36)"`
+	CreatedAt time.Time
+}
+
+// Segment is a saved user filter
+type Segment struct {
+	ID          string `gorm:"primaryKey;type:varchar(36)"`
+	Name        string `gorm:"uniqueIndex;type:varchar(50)"`
+	Description string `gorm:"type:varchar(255)"`
+	Status      string `gorm:"type:varchar(20)"`
+	Role        string `gorm:"type:varchar(20)"`
+	Query       string `gorm:"type:varchar(100)"`
+	// Tags are separated by spaces
+	Tags      string `gorm:"type:varchar(1000)"`
+	CreatedBy string `gorm:"type:varchar(36)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TagList returns the tags of the segment
+func (s *Segment) TagList() []string {
+	return strings.Fields(s.Tags)
+}
+
+// Filter returns the users the segment selects
+func (s *Segment) Filter() UserFilter {
+	return UserFilter{Status: s.Status, Role: s.Role, Query: s.Query, Tags: s.TagList()}
+}
+
+// taggedScope matches users having every tag, tags must not repeat
+func taggedScope(tags []string) database.Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		tagged := db.Session(&gorm.Session{NewDB: true}).
+			Model(&UserTag{}).
+			Select("user_id").
+			Where("tag IN ?", tags).
+			Group("user_id").
+			Having("COUNT(*) = ?", len(tags))
+		return db.Where("id IN (?)", tagged)
+	}
+}
+
+// AddUserTags tags a user, tags the user already has are kept
+func (r *authRepository) AddUserTags(ctx context.Context, userID string, tags []string, createdBy string) error {
+	r.logger.Debug("Adding user tags",
+		zap.String("user_id", userID),
+		zap.Strings("tags", tags))
+
+	// Check if user exists
+	if _, err := r.users.Get(ctx, userID, "id"); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rows := make([]UserTag, len(tags))
+	for i, tag := range tags {
+		rows[i] = UserTag{UserID: userID, Tag: tag, CreatedBy: createdBy, CreatedAt: now}
+	}
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+	if err != nil {
+		r.logger.Error("Database error while adding user tags",
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// RemoveUserTag removes a tag from a user
+func (r *authRepository) RemoveUserTag(ctx context.Context, userID, tag string) error {
+	r.logger.Debug("Removing user tag",
+		zap.String("user_id", userID),
+		zap.String("tag", tag))
+
+	result := r.db.WithContext(ctx).Where("user_id = ? AND tag = ?", userID, tag).Delete(&UserTag{})
+	if result.Error != nil {
+		r.logger.Error("Database error while removing user tag",
+			zap.String("user_id", userID),
+			zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTagNotFound
+	}
+
+	return nil
+}
+
+// GetUserTags returns the sorted tags of the given users by user ID
+func (r *authRepository) GetUserTags(ctx context.Context, userIDs []string) (map[string][]string, error) {
+	tags := make(map[string][]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return tags, nil
+	}
+
+	var rows []UserTag
+	err := r.db.WithContext(ctx).
+		Where("user_id IN ?", userIDs).
+		Order("tag ASC").
+		Find(&rows).Error
+	if err != nil {
+		r.logger.Error("Database error while getting user tags", zap.Error(err))
+		return nil, err
+	}
+
+	for _, row := range rows {
+		tags[row.UserID] = append(tags[row.UserID], row.Tag)
+	}
+	return tags, nil
+}
+
+// CreateSegment stores a new segment
+func (r *authRepository) CreateSegment(ctx context.Context, segment *Segment) error {
+	r.logger.Debug("Creating segment", zap.String("name", segment.Name))
+
+	if err := r.segments.Create(ctx, segment); err != nil {
+		if !errors.Is(err, database.ErrDuplicate) {
+			r.logger.Error("Database error while creating segment",
+				zap.String("name", segment.Name),
+				zap.Error(err))
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetSegment gets a segment by name
+func (r *authRepository) GetSegment(ctx context.Context, name string) (*Segment, error) {
+	r.logger.Debug("Getting segment", zap.String("name", name))
+
+	segment, err := r.segments.First(ctx, database.Where("name = ?", name))
+	if err != nil && !errors.Is(err, ErrSegmentNotFound) {
+		r.logger.Error("Database error while getting segment",
+			zap.String("name", name),
+			zap.Error(err))
+	}
+
+	return segment, err
+}
+
+// ListSegments returns every segment by name
+func (r *authRepository) ListSegments(ctx context.Context) ([]*Segment, error) {
+	var segments []*Segment
+	if err := r.segments.Query(ctx, database.OrderBy("name ASC")).Find(&segments).Error; err != nil {
+		r.logger.Error("Database error while listing segments", zap.Error(err))
+		return nil, err
+	}
+	return segments, nil
+}
+
+// UpdateSegment replaces the filter and description of the segment with the same name
+func (r *authRepository) UpdateSegment(ctx context.Context, segment *Segment) error {
+	r.logger.Debug("Updating segment", zap.String("name", segment.Name))
+
+	existing, err := r.GetSegment(ctx, segment.Name)
+	if err != nil {
+		return err
+	}
+
+	err = r.segments.Update(ctx, existing.ID, map[string]interface{}{
+		"description": segment.Description,
+		"status":      segment.Status,
+		"role":        segment.Role,
+		"query":       segment.Query,
+		"tags":        segment.Tags,
+		"updated_at":  time.Now(),
+	})
+	if err != nil {
+		r.logger.Error("Database error while updating segment",
+			zap.String("name", segment.Name),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// DeleteSegment deletes a segment by name
+func (r *authRepository) DeleteSegment(ctx context.Context, name string) error {
+	r.logger.Debug("Deleting segment", zap.String("name", name))
+
+	segment, err := r.GetSegment(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if err := r.segments.Delete(ctx, segment.ID); err != nil {
+		r.logger.Error("Database error while deleting segment",
+			zap.String("name", name),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
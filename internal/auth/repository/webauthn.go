@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// WebAuthn errors
+var (
+	ErrWebAuthnCredentialNotFound = errors.New("WebAuthn credential not found")
+	// ErrWebAuthnSignCountUsed is returned when a credential's sign count changed
+	// since it was read, e.g. for an assertion used concurrently
+	ErrWebAuthnSignCountUsed    = errors.New("WebAuthn sign count was already used")
+	ErrWebAuthnSessionNotFound  = errors.New("WebAuthn session not found")
+	ErrWebAuthnSessionCompleted = errors.New("WebAuthn session was already completed")
+)
+
+// WebAuthn session kinds
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login"
+)
+
+// WebAuthnCredential is a passkey or security key a user registered to log in
+type WebAuthnCredential struct {
+	ID     string `gorm:"primaryKey;type:varchar(36)"`
+	UserID string `gorm:"index;type:varchar(36)"`
+	// CredentialID is the authenticator's ID of the credential, base64url encoded
+	CredentialID string `gorm:"uniqueIndex;type:varchar(255)"`
+	// PublicKey is the COSE_Key of the credential
+	PublicKey []byte `gorm:"type:blob"`
+	Algorithm int64
+	// SignCount is the authenticator's signature counter at the last login, 0 if it has none
+	SignCount uint32
+	// AAGUID identifies the authenticator model, hex encoded
+	AAGUID string `gorm:"type:varchar(32);default:''"`
+	// Transports are the comma-separated ways the browser can reach the authenticator, e.g. "internal,hybrid"
+	Transports string `gorm:"type:varchar(255);default:''"`
+	// Name is the user's label of the credential, e.g. "MacBook"
+	Name       string `gorm:"type:varchar(100);default:''"`
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// WebAuthnSession is a started registration or login ceremony, holding the
+// challenge the authenticator has to sign
+type WebAuthnSession struct {
+	ID string `gorm:"primaryKey;type:varchar(36)"`
+	// UserID is the user registering or logging in, empty for logins without a known email
+	UserID string `gorm:"index;type:varchar(36)"`
+	// Kind is WebAuthnRegistration or WebAuthnLogin
+	Kind        string `gorm:"type:varchar(20)"`
+	Challenge   string `gorm:"type:varchar(64)"`
+	CompletedAt *time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+	CreatedAt   time.Time
+}
+
+// ListWebAuthnCredentials returns a user's credentials, oldest first
+func (r *authRepository) ListWebAuthnCredentials(ctx context.Context, userID string) ([]*WebAuthnCredential, error) {
+	var credentials []*WebAuthnCredential
+	err := r.webauthnCredentials.Query(ctx,
+		database.Where("user_id = ?", userID),
+		database.OrderBy("created_at ASC")).
+		Find(&credentials).Error
+	if err != nil {
+		r.logger.Error("Database error while listing WebAuthn credentials",
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// GetWebAuthnCredential gets a credential by its base64url encoded credential ID
+func (r *authRepository) GetWebAuthnCredential(ctx context.Context, credentialID string) (*WebAuthnCredential, error) {
+	credential, err := r.webauthnCredentials.First(ctx, database.Where("credential_id = ?", credentialID))
+	if err != nil && !errors.Is(err, ErrWebAuthnCredentialNotFound) {
+		r.logger.Error("Database error while getting WebAuthn credential", zap.Error(err))
+	}
+
+	return credential, err
+}
+
+// CreateWebAuthnCredential stores a new credential. database.ErrDuplicate is
+// returned if the credential is already registered.
+func (r *authRepository) CreateWebAuthnCredential(ctx context.Context, credential *WebAuthnCredential) error {
+	r.logger.Debug("Creating WebAuthn credential",
+		zap.String("credential_id", credential.ID),
+		zap.String("user_id", credential.UserID))
+
+	err := r.webauthnCredentials.Create(ctx, credential)
+	if err != nil && !errors.Is(err, database.ErrDuplicate) {
+		r.logger.Error("Database error while creating WebAuthn credential",
+			zap.String("user_id", credential.UserID),
+			zap.Error(err))
+	}
+
+	return err
+}
+
+// UseWebAuthnCredential records a login with a credential and its new sign
+// count. ErrWebAuthnSignCountUsed is returned if the stored count changed
+// since it was read, e.g. for an assertion used concurrently.
+func (r *authRepository) UseWebAuthnCredential(ctx context.Context, id string, previous, signCount uint32) error {
+	now := time.Now()
+	// The condition on sign_count lets only one of two concurrent logins win
+	err := r.webauthnCredentials.Update(ctx, id,
+		map[string]interface{}{
+			"sign_count":   signCount,
+			"last_used_at": now,
+			"updated_at":   now,
+		},
+		database.Where("sign_count = ?", previous))
+	if errors.Is(err, ErrWebAuthnCredentialNotFound) {
+		return ErrWebAuthnSignCountUsed
+	}
+	if err != nil {
+		r.logger.Error("Database error while using WebAuthn credential",
+			zap.String("credential_id", id),
+			zap.Error(err))
+	}
+
+	return err
+}
+
+// CreateWebAuthnSession stores a new WebAuthn session
+func (r *authRepository) CreateWebAuthnSession(ctx context.Context, session *WebAuthnSession) error {
+	r.logger.Debug("Creating WebAuthn session",
+		zap.String("session_id", session.ID),
+		zap.String("kind", session.Kind))
+
+	if err := r.webauthnSessions.Create(ctx, session); err != nil {
+		r.logger.Error("Database error while creating WebAuthn session",
+			zap.String("user_id", session.UserID),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// GetWebAuthnSession gets a WebAuthn session by ID
+func (r *authRepository) GetWebAuthnSession(ctx context.Context, id string) (*WebAuthnSession, error) {
+	session, err := r.webauthnSessions.Get(ctx, id)
+	if err != nil && !errors.Is(err, ErrWebAuthnSessionNotFound) {
+		r.logger.Error("Database error while getting WebAuthn session",
+			zap.String("session_id", id),
+			zap.Error(err))
+	}
+
+	return session, err
+}
+
+// CompleteWebAuthnSession marks a session as completed, its challenge can't be
+// used again. ErrWebAuthnSessionCompleted is returned if it was completed concurrently.
+func (r *authRepository) CompleteWebAuthnSession(ctx context.Context, id string) error {
+	// The condition on completed_at lets only one of two concurrent ceremonies win
+	err := r.webauthnSessions.Update(ctx, id,
+		map[string]interface{}{"completed_at": time.Now()},
+		database.Where("completed_at IS NULL"))
+	if errors.Is(err, ErrWebAuthnSessionNotFound) {
+		return ErrWebAuthnSessionCompleted
+	}
+	if err != nil {
+		r.logger.Error("Database error while completing WebAuthn session",
+			zap.String("session_id", id),
+			zap.Error(err))
+	}
+
+	return err
+}
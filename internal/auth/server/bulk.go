@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/api/gen/auth"
+	operationspb "github.com/linkeunid/hello-go/api/gen/operations"
+	"github.com/linkeunid/hello-go/internal/auth/service"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/operations"
+	"github.com/linkeunid/hello-go/pkg/siem"
+)
+
+// BulkSuspendUsers suspends active accounts and ends their sessions, as a long-running operation
+func (s *AuthServer) BulkSuspendUsers(ctx context.Context, req *auth.BulkUsersRequest) (*operationspb.Operation, error) {
+	return s.startBulkOperation(ctx, service.BulkSuspend, req)
+}
+
+// BulkUnsuspendUsers reactivates suspended accounts, as a long-running operation
+func (s *AuthServer) BulkUnsuspendUsers(ctx context.Context, req *auth.BulkUsersRequest) (*operationspb.Operation, error) {
+	return s.startBulkOperation(ctx, service.BulkUnsuspend, req)
+}
+
+// BulkForcePasswordReset makes users reset their password before logging in again and ends their sessions, as a long-running operation
+func (s *AuthServer) BulkForcePasswordReset(ctx context.Context, req *auth.BulkUsersRequest) (*operationspb.Operation, error) {
+	return s.startBulkOperation(ctx, service.BulkForcePasswordReset, req)
+}
+
+// BulkRevokeSessions revokes every refresh token of the users, as a long-running operation
+func (s *AuthServer) BulkRevokeSessions(ctx context.Context, req *auth.BulkUsersRequest) (*operationspb.Operation, error) {
+	return s.startBulkOperation(ctx, service.BulkRevokeSessions, req)
+}
+
+// startBulkOperation starts a bulk operation for an admin
+func (s *AuthServer) startBulkOperation(ctx context.Context, action string, req *auth.BulkUsersRequest) (*operationspb.Operation, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	target := service.BulkTarget{
+		UserIDs: req.UserIds,
+		Filter: service.UserFilter{
+			Status:  req.Status,
+			Role:    req.Role,
+			Query:   req.Query,
+			Tags:    req.Tags,
+			Segment: req.Segment,
+		},
+	}
+	op, err := s.service.StartBulkOperation(ctx, action, target, adminID)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to start bulk operation", err, zap.String("action", action))
+		return nil, apperrors.MapToStatus(err, "failed to start bulk operation")
+	}
+
+	s.logger.Info("Bulk operation started",
+		zap.String("operation_id", op.ID),
+		zap.String("action", action),
+		zap.String("admin_id", adminID))
+	s.emitAdminAction(ctx, adminID, "bulk."+action, siem.Target{Type: "operation", ID: op.ID}, map[string]string{
+		"user_ids": strconv.Itoa(len(req.UserIds)),
+		"status":   req.Status,
+		"role":     req.Role,
+		"query":    req.Query,
+		"tags":     strings.Join(req.Tags, " "),
+		"segment":  req.Segment,
+	})
+
+	return operations.ToProto(op), nil
+}
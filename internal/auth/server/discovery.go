@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/pkg/middleware"
+)
+
+// Well-known paths served by the auth service's HTTP server
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+	JWKSPath      = "/.well-known/jwks.json"
+)
+
+// discoveryDocument is the OpenID Provider metadata of the auth service
+// (OpenID Connect Discovery 1.0 section 3). Only what the service supports is listed.
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// DiscoveryHandler serves the OIDC discovery document, pointing validators
+// to the JWKS the service's signing keys are published in
+func (s *AuthServer) DiscoveryHandler() http.Handler {
+	issuer := strings.TrimSuffix(s.cfg.Auth.Issuer, "/")
+	document := discoveryDocument{
+		Issuer:                            issuer,
+		JWKSURI:                           issuer + JWKSPath,
+		TokenEndpoint:                     issuer + "/api/v1/auth/token",
+		GrantTypesSupported:               []string{"client_credentials"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_post"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{s.keys.Algorithm()},
+		ScopesSupported:                   []string{middleware.ScopeUsersRead, middleware.ScopeUsersWrite, middleware.ScopeUsersAdmin},
+		ClaimsSupported:                   []string{"sub", "iss", "exp", "iat", "auth_time", "scope", "client_id"},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		if err := json.NewEncoder(w).Encode(document); err != nil {
+			s.logger.Error("Failed to write discovery document", zap.Error(err))
+		}
+	})
+}
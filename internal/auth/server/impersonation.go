@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/api/gen/auth"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/siem"
+)
+
+// impersonatorClaim is the claim of impersonation tokens naming the admin
+const impersonatorClaim = "impersonator"
+
+// Impersonate issues a short-lived access token for a user to an admin. The
+// token has no "auth_time", so it can't call methods that need a recent login,
+// and there is no refresh token: the admin impersonates again once it expired.
+func (s *AuthServer) Impersonate(ctx context.Context, req *auth.ImpersonateRequest) (*auth.ImpersonateResponse, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	impersonation, err := s.service.Impersonate(ctx, adminID, req.UserId, req.Reason)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to impersonate user", err,
+			zap.String("admin_id", adminID),
+			zap.String("user_id", req.UserId))
+		s.security.Emit(ctx, siem.Event{
+			Category: siem.CategoryIAM,
+			Action:   "impersonation",
+			Outcome:  siem.OutcomeFailure,
+			Severity: siem.SeverityMedium,
+			Reason:   siem.Reason(err),
+			Actor:    siem.Actor{Type: siem.ActorUser, ID: adminID},
+			Target:   &siem.Target{Type: "user", ID: req.UserId},
+		})
+		return nil, apperrors.MapToStatus(err, "failed to impersonate user")
+	}
+
+	token, err := s.signToken(ctx, jwt.MapClaims{
+		"sub":             impersonation.UserID,
+		impersonatorClaim: adminID,
+	}, impersonation.Lifetime)
+	if err != nil {
+		s.logger.Error("Failed to generate impersonation token",
+			zap.String("user_id", impersonation.UserID),
+			zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to generate token")
+	}
+
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategoryIAM,
+		Action:   "impersonation",
+		Outcome:  siem.OutcomeSuccess,
+		Severity: siem.SeverityHigh,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: adminID},
+		Target:   &siem.Target{Type: "user", ID: impersonation.UserID},
+		Details:  map[string]string{"reason": strings.TrimSpace(req.Reason), "expires_in": impersonation.Lifetime.String()},
+	})
+
+	return &auth.ImpersonateResponse{
+		Token:     token,
+		UserId:    impersonation.UserID,
+		ExpiresIn: int64(impersonation.Lifetime.Seconds()),
+	}, nil
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/api/gen/auth"
+	"github.com/linkeunid/hello-go/internal/auth/service"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/middleware"
+	"github.com/linkeunid/hello-go/pkg/siem"
+)
+
+// GetLoginHistory returns the caller's successful and failed logins, newest first
+func (s *AuthServer) GetLoginHistory(ctx context.Context, req *auth.GetLoginHistoryRequest) (*auth.GetLoginHistoryResponse, error) {
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	history, total, err := s.service.GetLoginHistory(ctx, userID, int(req.Page), int(req.PageSize))
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to get login history", err, zap.String("user_id", userID))
+		return nil, apperrors.MapToStatus(err, "failed to get login history")
+	}
+
+	attempts := make([]*auth.LoginAttempt, len(history))
+	for i, entry := range history {
+		attempts[i] = &auth.LoginAttempt{
+			Id:          entry.ID,
+			Method:      entry.Method,
+			Success:     entry.Success,
+			Reason:      entry.Reason,
+			IpAddress:   entry.IPAddress,
+			UserAgent:   entry.UserAgent,
+			AttemptedAt: formatTime(entry.CreatedAt),
+		}
+	}
+
+	return &auth.GetLoginHistoryResponse{
+		Attempts: attempts,
+		Total:    int32(total),
+	}, nil
+}
+
+// recordLogin adds a login attempt to the user's login history with the
+// client's address and user agent. err is why the attempt failed, nil if it
+// succeeded. Failures to record are logged, they don't fail the login.
+func (s *AuthServer) recordLogin(ctx context.Context, attempt service.LoginAttempt, err error) {
+	attempt.Success = err == nil
+	if err != nil {
+		attempt.Reason = siem.Reason(err)
+	}
+	// The address is the one rate limits count, which clients can't forge with X-Forwarded-For
+	attempt.IPAddress = middleware.ClientIP(ctx, s.loginLimits.trustedProxies)
+	attempt.UserAgent = siem.SourceFromContext(ctx).UserAgent
+
+	if err := s.service.RecordLogin(ctx, &attempt); err != nil {
+		s.logger.Warn("Failed to record login",
+			zap.String("user_id", attempt.UserID),
+			zap.String("method", attempt.Method),
+			zap.Error(err))
+	}
+}
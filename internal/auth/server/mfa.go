@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/api/gen/auth"
+	"github.com/linkeunid/hello-go/internal/auth/service"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/siem"
+)
+
+// VerifyMFA completes the login of an account with MFA with a code from the
+// authenticator app or a backup code and issues the tokens
+func (s *AuthServer) VerifyMFA(ctx context.Context, req *auth.VerifyMFARequest) (*auth.VerifyMFAResponse, error) {
+	if req.ChallengeToken == "" || req.Code == "" {
+		return nil, status.Error(codes.InvalidArgument, "challenge_token and code are required")
+	}
+
+	login, err := s.service.CompleteMFAChallenge(ctx, req.ChallengeToken, req.Code)
+	if err != nil {
+		apperrors.Log(s.logger, "MFA verification failed", err)
+		s.recordLogin(ctx, service.LoginAttempt{ChallengeToken: req.ChallengeToken, Method: service.MFAMethod(req.Code)}, err)
+		s.security.Emit(ctx, siem.Event{
+			Category: siem.CategoryAuthentication,
+			Action:   "mfa",
+			Outcome:  siem.OutcomeFailure,
+			Severity: siem.SeverityLow,
+			Reason:   siem.Reason(err),
+		})
+		return nil, apperrors.MapToStatus(err, "failed to verify code")
+	}
+
+	session, err := s.startSession(ctx, login.UserID, login.ClientType, login.Scope, login.ExpiresIn)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("User logged in successfully with MFA", zap.String("user_id", login.UserID))
+	s.recordLogin(ctx, service.LoginAttempt{UserID: login.UserID, Method: login.Method}, nil)
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategoryAuthentication,
+		Action:   "login",
+		Outcome:  siem.OutcomeSuccess,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: login.UserID},
+		Details:  map[string]string{"mfa": login.Method},
+	})
+	if login.Method == service.MFAMethodBackupCode {
+		// A lost authenticator app, or a leaked sheet of codes
+		s.security.Emit(ctx, siem.Event{
+			Category: siem.CategoryAuthentication,
+			Action:   "backup_code_used",
+			Outcome:  siem.OutcomeSuccess,
+			Severity: siem.SeverityMedium,
+			Actor:    siem.Actor{Type: siem.ActorUser, ID: login.UserID},
+		})
+	}
+
+	return &auth.VerifyMFAResponse{
+		Token:        session.token,
+		UserId:       login.UserID,
+		RefreshToken: session.refreshToken,
+		ExpiresIn:    int64(session.lifetime.Seconds()),
+	}, nil
+}
+
+// EnrollTOTP starts enrolling an authenticator app for the caller
+func (s *AuthServer) EnrollTOTP(ctx context.Context, req *auth.EnrollTOTPRequest) (*auth.EnrollTOTPResponse, error) {
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment, err := s.service.EnrollTOTP(ctx, userID)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to enroll TOTP", err, zap.String("user_id", userID))
+		return nil, apperrors.MapToStatus(err, "failed to enroll authenticator app")
+	}
+
+	return &auth.EnrollTOTPResponse{
+		Secret: enrollment.Secret,
+		Uri:    enrollment.URI,
+	}, nil
+}
+
+// ConfirmTOTP confirms the caller's pending authenticator app, enabling MFA,
+// and returns the caller's backup codes
+func (s *AuthServer) ConfirmTOTP(ctx context.Context, req *auth.ConfirmTOTPRequest) (*auth.ConfirmTOTPResponse, error) {
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Code == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	backupCodes, err := s.service.ConfirmTOTP(ctx, userID, req.Code)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to confirm TOTP", err, zap.String("user_id", userID))
+		return nil, apperrors.MapToStatus(err, "failed to confirm authenticator app")
+	}
+
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategoryIAM,
+		Action:   "mfa_enabled",
+		Outcome:  siem.OutcomeSuccess,
+		Severity: siem.SeverityLow,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: userID},
+		Details:  map[string]string{"method": "totp"},
+	})
+
+	return &auth.ConfirmTOTPResponse{BackupCodes: backupCodes}, nil
+}
+
+// RegenerateBackupCodes replaces the caller's backup codes
+func (s *AuthServer) RegenerateBackupCodes(ctx context.Context, req *auth.RegenerateBackupCodesRequest) (*auth.RegenerateBackupCodesResponse, error) {
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	backupCodes, err := s.service.RegenerateBackupCodes(ctx, userID)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to regenerate backup codes", err, zap.String("user_id", userID))
+		return nil, apperrors.MapToStatus(err, "failed to regenerate backup codes")
+	}
+
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategoryIAM,
+		Action:   "backup_codes_regenerated",
+		Outcome:  siem.OutcomeSuccess,
+		Severity: siem.SeverityLow,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: userID},
+	})
+
+	return &auth.RegenerateBackupCodesResponse{BackupCodes: backupCodes}, nil
+}
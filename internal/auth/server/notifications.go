@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/linkeunid/hello-go/api/gen/auth"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/mail"
+	"github.com/linkeunid/hello-go/pkg/notification"
+	"github.com/linkeunid/hello-go/pkg/siem"
+)
+
+// ListNotificationTemplates returns the email and webhook templates
+func (s *AuthServer) ListNotificationTemplates(ctx context.Context, req *auth.ListNotificationTemplatesRequest) (*auth.ListNotificationTemplatesResponse, error) {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	templates, err := s.service.Templates().List(ctx)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to list notification templates", err)
+		return nil, apperrors.MapToStatus(err, "failed to list notification templates")
+	}
+
+	protoTemplates := make([]*auth.NotificationTemplate, len(templates))
+	for i, template := range templates {
+		protoTemplates[i] = toProtoTemplate(template)
+	}
+
+	return &auth.ListNotificationTemplatesResponse{Templates: protoTemplates}, nil
+}
+
+// GetNotificationTemplate returns the current content of a template
+func (s *AuthServer) GetNotificationTemplate(ctx context.Context, req *auth.GetNotificationTemplateRequest) (*auth.NotificationTemplate, error) {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	template, err := s.service.Templates().Get(ctx, req.Name, req.Locale)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to get notification template", err, zap.String("name", req.Name), zap.String("locale", req.Locale))
+		return nil, apperrors.MapToStatus(err, "failed to get notification template")
+	}
+
+	return toProtoTemplate(template), nil
+}
+
+// UpdateNotificationTemplate changes a template, the content must render with the sample data
+func (s *AuthServer) UpdateNotificationTemplate(ctx context.Context, req *auth.UpdateNotificationTemplateRequest) (*auth.NotificationTemplate, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var sampleData string
+	if req.SampleData != nil {
+		encoded, err := protojson.Marshal(req.SampleData)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid sample data")
+		}
+		sampleData = string(encoded)
+	}
+
+	template, err := s.service.Templates().Update(ctx, req.Name, req.Locale, req.Subject, req.Body, sampleData, adminID)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to update notification template", err, zap.String("name", req.Name), zap.String("locale", req.Locale))
+		return nil, apperrors.MapToStatus(err, "failed to update notification template")
+	}
+
+	s.logger.Info("Notification template updated",
+		zap.String("name", req.Name),
+		zap.String("locale", template.Locale),
+		zap.String("admin_id", adminID))
+	s.emitAdminAction(ctx, adminID, "notification_template.update", siem.Target{Type: "notification_template", ID: req.Name},
+		map[string]string{"locale": template.Locale})
+
+	return toProtoTemplate(template), nil
+}
+
+// ResetNotificationTemplate restores the built-in content of a template
+func (s *AuthServer) ResetNotificationTemplate(ctx context.Context, req *auth.ResetNotificationTemplateRequest) (*auth.NotificationTemplate, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := s.service.Templates().Reset(ctx, req.Name, req.Locale)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to reset notification template", err, zap.String("name", req.Name), zap.String("locale", req.Locale))
+		return nil, apperrors.MapToStatus(err, "failed to reset notification template")
+	}
+
+	s.logger.Info("Notification template reset",
+		zap.String("name", req.Name),
+		zap.String("locale", req.Locale),
+		zap.String("admin_id", adminID))
+	s.emitAdminAction(ctx, adminID, "notification_template.reset", siem.Target{Type: "notification_template", ID: req.Name},
+		map[string]string{"locale": req.Locale})
+
+	return toProtoTemplate(template), nil
+}
+
+// PreviewNotificationTemplate renders a template, or unsaved changes to it, without sending anything
+func (s *AuthServer) PreviewNotificationTemplate(ctx context.Context, req *auth.PreviewNotificationTemplateRequest) (*auth.PreviewNotificationTemplateResponse, error) {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	var data map[string]interface{}
+	if req.Data != nil {
+		data = req.Data.AsMap()
+	}
+
+	draft := notification.Draft{Subject: req.Subject, Body: req.Body}
+	rendered, err := s.service.Templates().Preview(ctx, req.Name, req.Locale, draft, data)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to preview notification template", err, zap.String("name", req.Name), zap.String("locale", req.Locale))
+		return nil, apperrors.MapToStatus(err, "failed to preview notification template")
+	}
+
+	return &auth.PreviewNotificationTemplateResponse{
+		Subject: rendered.Subject,
+		Body:    rendered.Body,
+		Locale:  rendered.Locale,
+	}, nil
+}
+
+// AdminListEmails returns the recorded emails with their delivery status, newest first
+func (s *AuthServer) AdminListEmails(ctx context.Context, req *auth.AdminListEmailsRequest) (*auth.AdminListEmailsResponse, error) {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	filter := mail.MessageFilter{
+		UserID:    req.UserId,
+		Recipient: req.Recipient,
+		Status:    req.Status,
+	}
+	messages, total, err := s.service.Mail().Messages(ctx, filter, int(req.Page), int(req.PageSize))
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to list emails", err)
+		return nil, apperrors.MapToStatus(err, "failed to list emails")
+	}
+
+	protoMessages := make([]*auth.EmailMessage, len(messages))
+	for i, message := range messages {
+		protoMessages[i] = toProtoEmail(message)
+	}
+
+	return &auth.AdminListEmailsResponse{
+		Messages: protoMessages,
+		Total:    int32(total),
+	}, nil
+}
+
+// toProtoEmail converts a recorded email to its proto message
+func toProtoEmail(message *mail.Message) *auth.EmailMessage {
+	protoMessage := &auth.EmailMessage{
+		Id:        message.ID,
+		UserId:    message.UserID,
+		Recipient: message.Recipient,
+		Template:  message.Template,
+		Locale:    message.Locale,
+		Subject:   message.Subject,
+		Status:    message.Status,
+		Attempts:  int32(message.Attempts),
+		Error:     message.Error,
+		CreatedAt: formatTime(message.CreatedAt),
+	}
+	if message.SentAt != nil {
+		protoMessage.SentAt = formatTime(*message.SentAt)
+	}
+	return protoMessage
+}
+
+// toProtoTemplate converts a notification template to its proto message
+func toProtoTemplate(template *notification.Template) *auth.NotificationTemplate {
+	protoTemplate := &auth.NotificationTemplate{
+		Name:       template.Name,
+		Locale:     template.Locale,
+		Channel:    template.Channel,
+		Subject:    template.Subject,
+		Body:       template.Body,
+		Customized: template.Customized,
+		UpdatedBy:  template.UpdatedBy,
+	}
+	if template.SampleData != "" {
+		sampleData := &structpb.Struct{}
+		if err := protojson.Unmarshal([]byte(template.SampleData), sampleData); err == nil {
+			protoTemplate.SampleData = sampleData
+		}
+	}
+	if !template.UpdatedAt.IsZero() {
+		protoTemplate.UpdatedAt = formatTime(template.UpdatedAt)
+	}
+	return protoTemplate
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/api/gen/auth"
+	"github.com/linkeunid/hello-go/internal/auth/service"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/siem"
+)
+
+// SyncOrganizationMembers makes a list the members of an organization
+func (s *AuthServer) SyncOrganizationMembers(ctx context.Context, req *auth.SyncOrganizationMembersRequest) (*auth.SyncOrganizationMembersResponse, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]service.OrganizationMember, len(req.Members))
+	for i, member := range req.Members {
+		members[i] = service.OrganizationMember{Email: member.Email, Role: member.Role}
+	}
+
+	sync, err := s.service.SyncOrganizationMembers(ctx, req.OrganizationId, members, req.DryRun)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to sync organization members", err,
+			zap.String("organization_id", req.OrganizationId))
+		return nil, apperrors.MapToStatus(err, "failed to sync organization members")
+	}
+
+	if !req.DryRun {
+		s.emitAdminAction(ctx, adminID, "organization.sync_members", siem.Target{Type: "organization", ID: req.OrganizationId},
+			map[string]string{
+				"members":        strconv.Itoa(len(req.Members)),
+				"changes":        strconv.Itoa(len(sync.Changes)),
+				"unknown_emails": strconv.Itoa(len(sync.UnknownEmails)),
+			})
+	}
+
+	res := &auth.SyncOrganizationMembersResponse{
+		Changes:       make([]*auth.MembershipChange, len(sync.Changes)),
+		UnknownEmails: sync.UnknownEmails,
+	}
+	for i, change := range sync.Changes {
+		res.Changes[i] = &auth.MembershipChange{
+			UserId:  change.UserID,
+			Email:   change.Email,
+			Op:      change.Op,
+			OldRole: change.OldRole,
+			NewRole: change.NewRole,
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,14 @@
+package server
+
+import (
+	"github.com/linkeunid/hello-go/api/gen/auth"
+)
+
+// ReadOnlyMethods lists the methods served in read-only mode although they
+// take a request body, see readonly.Mode
+var ReadOnlyMethods = []string{
+	// Tokens of service accounts are issued without storing anything
+	auth.AuthService_Token_FullMethodName,
+	auth.AuthService_ValidateToken_FullMethodName,
+	auth.AuthService_PreviewNotificationTemplate_FullMethodName,
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/api/gen/auth"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/siem"
+)
+
+// SetRecoveryEmail emails a verification link to the caller's new recovery
+// email, or removes the recovery email if none is given
+func (s *AuthServer) SetRecoveryEmail(ctx context.Context, req *auth.SetRecoveryEmailRequest) (*auth.SetRecoveryEmailResponse, error) {
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.SetRecoveryEmail(ctx, userID, req.Email); err != nil {
+		apperrors.Log(s.logger, "Failed to set recovery email", err, zap.String("user_id", userID))
+		return nil, apperrors.MapToStatus(err, "failed to set recovery email")
+	}
+
+	if req.Email == "" {
+		s.security.Emit(ctx, siem.Event{
+			Category: siem.CategoryIAM,
+			Action:   "recovery_email_removed",
+			Outcome:  siem.OutcomeSuccess,
+			Severity: siem.SeverityLow,
+			Actor:    siem.Actor{Type: siem.ActorUser, ID: userID},
+		})
+	}
+
+	return &auth.SetRecoveryEmailResponse{}, nil
+}
+
+// VerifyRecoveryEmail sets the recovery email with the token of a verification email
+func (s *AuthServer) VerifyRecoveryEmail(ctx context.Context, req *auth.VerifyRecoveryEmailRequest) (*auth.VerifyRecoveryEmailResponse, error) {
+	if req.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	userID, err := s.service.VerifyRecoveryEmail(ctx, req.Token)
+	if err != nil {
+		apperrors.Log(s.logger, "Recovery email verification failed", err)
+		return nil, apperrors.MapToStatus(err, "failed to verify recovery email")
+	}
+
+	// Password resets can be sent to the address from now on
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategoryIAM,
+		Action:   "recovery_email_verified",
+		Outcome:  siem.OutcomeSuccess,
+		Severity: siem.SeverityMedium,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: userID},
+	})
+
+	return &auth.VerifyRecoveryEmailResponse{}, nil
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/api/gen/auth"
+	"github.com/linkeunid/hello-go/pkg/middleware"
+)
+
+// MethodScopes lists the scope each method requires from restricted tokens,
+// see middleware.ScopeInterceptor. Restricted tokens can log in and manage
+// their own session, account and admin methods need an unrestricted token.
+var MethodScopes = map[string]string{
+	auth.AuthService_Login_FullMethodName:                  "",
+	auth.AuthService_Refresh_FullMethodName:                "",
+	auth.AuthService_VerifyMFA_FullMethodName:              "",
+	auth.AuthService_BeginWebAuthnLogin_FullMethodName:     "",
+	auth.AuthService_FinishWebAuthnLogin_FullMethodName:    "",
+	auth.AuthService_Logout_FullMethodName:                 "",
+	auth.AuthService_RequestPasswordReset_FullMethodName:   "",
+	auth.AuthService_ConfirmPasswordReset_FullMethodName:   "",
+	auth.AuthService_VerifyRecoveryEmail_FullMethodName:    "",
+	auth.AuthService_Register_FullMethodName:               "",
+	auth.AuthService_CheckEmailAvailability_FullMethodName: "",
+	auth.AuthService_AcceptInvite_FullMethodName:           "",
+	auth.AuthService_Token_FullMethodName:                  "",
+	auth.AuthService_ValidateToken_FullMethodName:          "",
+}
+
+// loginScopes are the scopes a login may restrict its tokens to.
+// users.admin is left out, it's reserved for service accounts.
+var loginScopes = []string{middleware.ScopeUsersRead, middleware.ScopeUsersWrite}
+
+// normalizeLoginScope checks the space separated scopes requested at login
+// and returns their names without duplicates, empty for unrestricted tokens
+func normalizeLoginScope(scope string) (string, error) {
+	var scopes []string
+	seen := make(map[string]bool)
+	for _, requested := range middleware.CanonicalScopes(strings.Fields(scope)) {
+		if !isLoginScope(requested) {
+			return "", status.Errorf(codes.InvalidArgument, "scope must be a list of %s", strings.Join(loginScopes, ", "))
+		}
+		if !seen[requested] {
+			seen[requested] = true
+			scopes = append(scopes, requested)
+		}
+	}
+	return strings.Join(scopes, " "), nil
+}
+
+// isLoginScope reports whether scope is one of loginScopes
+func isLoginScope(scope string) bool {
+	for _, allowed := range loginScopes {
+		if scope == allowed {
+			return true
+		}
+	}
+	return false
+}
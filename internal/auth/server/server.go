@@ -2,26 +2,52 @@ package server
 
 import (
 	"context"
+	"errors"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	// Update import path to use the generated code in api/gen/auth
 	"github.com/linkeunid/hello-go/api/gen/auth"
 	"github.com/linkeunid/hello-go/internal/auth/service"
+	"github.com/linkeunid/hello-go/pkg/alerting"
+	"github.com/linkeunid/hello-go/pkg/cache"
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/flightrecorder"
+	"github.com/linkeunid/hello-go/pkg/health"
+	"github.com/linkeunid/hello-go/pkg/jobs"
+	"github.com/linkeunid/hello-go/pkg/jwe"
+	"github.com/linkeunid/hello-go/pkg/metering"
+	"github.com/linkeunid/hello-go/pkg/middleware"
+	"github.com/linkeunid/hello-go/pkg/operations"
+	"github.com/linkeunid/hello-go/pkg/readonly"
+	"github.com/linkeunid/hello-go/pkg/revocation"
+	"github.com/linkeunid/hello-go/pkg/siem"
+	"github.com/linkeunid/hello-go/pkg/signing"
 )
 
 // AuthServer implements the AuthService gRPC service
 type AuthServer struct {
 	auth.UnimplementedAuthServiceServer
-	cfg     *config.Config
-	service service.AuthService
-	logger  *zap.Logger
+	cfg          *config.Config
+	service      service.AuthService
+	jwtValidator *middleware.JWTValidator
+	keys         *signing.KeySet
+	security     siem.Emitter
+	recorder     *flightrecorder.Recorder
+	readOnly     *readonly.Mode
+	loginLimits  *loginLimits
+	logger       *zap.Logger
 }
 
 // NewAuthServer creates a new AuthServer instance
@@ -37,21 +63,161 @@ func NewAuthServer(cfg *config.Config, logger *zap.Logger) *AuthServer {
 		svc = service.NewAuthService(cfg, logger.Named("auth_service"))
 	}
 
+	security, err := siem.NewEmitter(cfg, "auth", logger.Named("siem"))
+	if err != nil {
+		logger.Fatal("Failed to create security event emitter", zap.Error(err))
+	}
+
+	keys, err := signing.NewKeySet(cfg, logger.Named("signing"))
+	if err != nil {
+		logger.Fatal("Failed to load token signing key", zap.Error(err))
+	}
+
+	jwtValidator := middleware.NewJWTValidator(cfg, logger)
+	jwtValidator.Keyfunc = keys.Keyfunc
+	jwtValidator.Revocations = svc.Revocations()
+	jwtValidator.ValidAfter = svc.TokensValidAfter
+
+	readOnly := readonly.NewMode(cfg, logger.Named("read_only"))
+	readOnly.Allow(ReadOnlyMethods...)
+
+	limits, err := newLoginLimits(cfg, useMock)
+	if err != nil {
+		logger.Fatal("Failed to create login rate limits", zap.Error(err))
+	}
+
 	return &AuthServer{
-		cfg:     cfg,
-		service: svc,
-		logger:  logger.Named("auth_server"),
+		cfg:          cfg,
+		service:      svc,
+		jwtValidator: jwtValidator,
+		keys:         keys,
+		security:     security,
+		recorder:     flightrecorder.NewRecorder(cfg, "auth"),
+		readOnly:     readOnly,
+		loginLimits:  limits,
+		logger:       logger.Named("auth_server"),
+	}
+}
+
+// Keys returns the keys the service signs tokens with
+func (s *AuthServer) Keys() *signing.KeySet {
+	return s.keys
+}
+
+// SecurityEvents returns the emitter for the service's security events
+func (s *AuthServer) SecurityEvents() siem.Emitter {
+	return s.security
+}
+
+// Operations returns the OperationsService for the service's long-running operations
+func (s *AuthServer) Operations() *operations.Server {
+	return operations.NewServer(s.service.Operations(), s.authorizeOperations, s.logger.Named("operations"))
+}
+
+// Recorder returns the flight recorder of the service's recent requests
+func (s *AuthServer) Recorder() *flightrecorder.Recorder {
+	return s.recorder
+}
+
+// FlightRecorder returns the FlightRecorderService for the service's recent requests, admins only
+func (s *AuthServer) FlightRecorder() *flightrecorder.Server {
+	return flightrecorder.NewServer(s.recorder, func(ctx context.Context) error {
+		_, err := s.requireAdmin(ctx)
+		return err
+	}, s.logger.Named("flight_recorder"))
+}
+
+// Caches returns the CacheService for the service's in-process caches, admins only
+func (s *AuthServer) Caches() *cache.Server {
+	return cache.NewServer("auth", func(ctx context.Context) error {
+		_, err := s.requireAdmin(ctx)
+		return err
+	}, s.logger.Named("cache"))
+}
+
+// Database returns the DatabaseService for the service's SQL log settings, admins only
+func (s *AuthServer) Database() *database.Server {
+	return database.NewServer(s.cfg, "auth", func(ctx context.Context) error {
+		_, err := s.requireAdmin(ctx)
+		return err
+	}, s.logger.Named("database"))
+}
+
+// ReadOnlyMode returns whether the service rejects mutations
+func (s *AuthServer) ReadOnlyMode() *readonly.Mode {
+	return s.readOnly
+}
+
+// ReadOnly returns the ReadOnlyService for the service's read-only mode, admins only
+func (s *AuthServer) ReadOnly() *readonly.Server {
+	return readonly.NewServer(s.readOnly, "auth", func(ctx context.Context) error {
+		_, err := s.requireAdmin(ctx)
+		return err
+	}, s.logger.Named("read_only"))
+}
+
+// Meter returns the service's usage meter
+func (s *AuthServer) Meter() *metering.Meter {
+	return s.service.Meter()
+}
+
+// DeadLetters returns the DeadLetterService for the service's job queue, admins only
+func (s *AuthServer) DeadLetters() *jobs.Server {
+	return jobs.NewServer(s.service.Jobs(), func(ctx context.Context) error {
+		_, err := s.requireAdmin(ctx)
+		return err
+	}, s.logger.Named("dead_letters"))
+}
+
+// RunJobs works on the service's background jobs, e.g. sending emails, until ctx is cancelled
+func (s *AuthServer) RunJobs(ctx context.Context) {
+	s.service.Jobs().Run(ctx)
+}
+
+// Close interrupts running operations, closes the job queue and flushes pending
+// usage and security events
+func (s *AuthServer) Close() error {
+	if err := s.service.Operations().Close(); err != nil {
+		s.logger.Error("Failed to close operations", zap.Error(err))
+	}
+	if err := s.service.Jobs().Close(); err != nil {
+		s.logger.Error("Failed to close job queue", zap.Error(err))
+	}
+	if err := s.service.Meter().Close(); err != nil {
+		s.logger.Error("Failed to flush usage", zap.Error(err))
+	}
+	return s.security.Close()
+}
+
+// Checks returns the dependency checks reported by the status service
+func (s *AuthServer) Checks() []health.Check {
+	return []health.Check{
+		{Name: "database", Critical: true, Probe: s.service.Ping},
 	}
 }
 
 // Login authenticates a user and returns a JWT token
 func (s *AuthServer) Login(ctx context.Context, req *auth.LoginRequest) (*auth.LoginResponse, error) {
+	if err := s.limitLogin(ctx, "login", req.Email); err != nil {
+		return nil, err
+	}
+
 	// Check email and password (simplified for example)
 	if req.Email == "" || req.Password == "" {
 		s.logger.Warn("Login attempt with missing credentials",
 			zap.String("email", req.Email))
 		return nil, status.Error(codes.InvalidArgument, "email and password are required")
 	}
+	if err := service.ValidateClientType(req.ClientType); err != nil {
+		return nil, apperrors.MapToStatus(err, "invalid client type")
+	}
+	if req.ExpiresIn < 0 {
+		return nil, status.Error(codes.InvalidArgument, "expires_in must not be negative")
+	}
+	scope, err := normalizeLoginScope(req.Scope)
+	if err != nil {
+		return nil, err
+	}
 
 	s.logger.Debug("Login attempt",
 		zap.String("email", req.Email))
@@ -59,68 +225,729 @@ func (s *AuthServer) Login(ctx context.Context, req *auth.LoginRequest) (*auth.L
 	// Authenticate user
 	userID, err := s.service.Authenticate(ctx, req.Email, req.Password)
 	if err != nil {
-		s.logger.Warn("Authentication failed",
-			zap.String("email", req.Email),
-			zap.Error(err))
-		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+		apperrors.Log(s.logger, "Authentication failed", err, zap.String("email", req.Email))
+		s.recordLogin(ctx, service.LoginAttempt{Email: req.Email, Method: service.LoginMethodPassword}, err)
+		s.security.Emit(ctx, siem.Event{
+			Category: siem.CategoryAuthentication,
+			Action:   "login",
+			Outcome:  siem.OutcomeFailure,
+			Severity: siem.SeverityLow,
+			Reason:   siem.Reason(err),
+			Actor:    siem.Actor{Type: siem.ActorUser, Name: req.Email},
+		})
+		return nil, apperrors.MapToStatus(err, "failed to authenticate")
 	}
 
-	// Generate JWT token
-	token, err := s.generateToken(userID)
+	// Accounts with MFA get their tokens once they entered a code with VerifyMFA
+	challengeToken, err := s.service.StartMFAChallenge(ctx, userID, req.ClientType, scope, time.Duration(req.ExpiresIn)*time.Second)
 	if err != nil {
-		s.logger.Error("Failed to generate token",
-			zap.String("user_id", userID),
-			zap.Error(err))
-		return nil, status.Error(codes.Internal, "failed to generate token")
+		apperrors.Log(s.logger, "Failed to start MFA challenge", err, zap.String("user_id", userID))
+		return nil, apperrors.MapToStatus(err, "failed to authenticate")
+	}
+	if challengeToken != "" {
+		s.logger.Debug("MFA required for login", zap.String("user_id", userID))
+		return &auth.LoginResponse{
+			MfaRequired:    true,
+			ChallengeToken: challengeToken,
+		}, nil
+	}
+
+	session, err := s.startSession(ctx, userID, req.ClientType, scope, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		return nil, err
 	}
 
 	s.logger.Info("User logged in successfully",
 		zap.String("user_id", userID),
 		zap.String("email", req.Email))
+	s.recordLogin(ctx, service.LoginAttempt{UserID: userID, Email: req.Email, Method: service.LoginMethodPassword}, nil)
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategoryAuthentication,
+		Action:   "login",
+		Outcome:  siem.OutcomeSuccess,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: userID, Name: req.Email},
+	})
 
 	return &auth.LoginResponse{
-		Token:  token,
-		UserId: userID,
+		Token:        session.token,
+		UserId:       userID,
+		RefreshToken: session.refreshToken,
+		ExpiresIn:    int64(session.lifetime.Seconds()),
 	}, nil
 }
 
+// session is the tokens issued for a login
+type session struct {
+	token        string
+	refreshToken string
+	lifetime     time.Duration
+}
+
+// startSession issues the access and refresh token of a user who just
+// authenticated, with the lifetime of the client type capped by requested.
+// The tokens are restricted to scope unless it's empty.
+func (s *AuthServer) startSession(ctx context.Context, userID, clientType, scope string, requested time.Duration) (*session, error) {
+	lifetime, err := s.service.TokenLifetime(ctx, userID, clientType, requested)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to determine token lifetime", err, zap.String("user_id", userID))
+		return nil, apperrors.MapToStatus(err, "failed to generate token")
+	}
+	token, err := s.generateToken(ctx, userID, time.Now(), scope, lifetime)
+	if err != nil {
+		s.logger.Error("Failed to generate token",
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to generate token")
+	}
+
+	refreshToken, err := s.service.IssueRefreshToken(ctx, userID, clientType, scope)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to issue refresh token", err, zap.String("user_id", userID))
+		return nil, apperrors.MapToStatus(err, "failed to issue refresh token")
+	}
+
+	return &session{token: token, refreshToken: refreshToken, lifetime: lifetime}, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and refresh token
+func (s *AuthServer) Refresh(ctx context.Context, req *auth.RefreshRequest) (*auth.RefreshResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, status.Error(codes.InvalidArgument, "refresh_token is required")
+	}
+	if req.ExpiresIn < 0 {
+		return nil, status.Error(codes.InvalidArgument, "expires_in must not be negative")
+	}
+
+	session, err := s.service.RefreshSession(ctx, req.RefreshToken)
+	if err != nil {
+		apperrors.Log(s.logger, "Refresh failed", err)
+
+		// A reused token means it was stolen or leaked
+		event := siem.Event{
+			Category: siem.CategorySession,
+			Action:   "refresh",
+			Outcome:  siem.OutcomeFailure,
+			Severity: siem.SeverityLow,
+			Reason:   siem.Reason(err),
+		}
+		if errors.Is(err, service.ErrRefreshTokenReused) {
+			event.Action = "refresh_token_reuse"
+			event.Severity = siem.SeverityHigh
+		}
+		s.security.Emit(ctx, event)
+		return nil, apperrors.MapToStatus(err, "failed to refresh session")
+	}
+
+	// Refreshed tokens get the lifetime of the client type the session started with
+	lifetime, err := s.service.TokenLifetime(ctx, session.UserID, session.ClientType, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to determine token lifetime", err, zap.String("user_id", session.UserID))
+		return nil, apperrors.MapToStatus(err, "failed to generate token")
+	}
+	// The token keeps the time and scope of the login, refreshing doesn't count as authenticating again
+	token, err := s.generateToken(ctx, session.UserID, session.AuthenticatedAt, session.Scope, lifetime)
+	if err != nil {
+		s.logger.Error("Failed to generate token",
+			zap.String("user_id", session.UserID),
+			zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to generate token")
+	}
+
+	s.logger.Debug("Session refreshed", zap.String("user_id", session.UserID))
+
+	return &auth.RefreshResponse{
+		Token:        token,
+		RefreshToken: session.RefreshToken,
+		UserId:       session.UserID,
+		ExpiresIn:    int64(lifetime.Seconds()),
+	}, nil
+}
+
+// Logout revokes the caller's access token until it expires and, if given, the
+// session of the refresh token, so neither can be used anymore
+func (s *AuthServer) Logout(ctx context.Context, req *auth.LogoutRequest) (*auth.LogoutResponse, error) {
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The refresh token is checked first, so a wrong one leaves the access token usable for a retry
+	if req.RefreshToken != "" {
+		if err := s.service.EndSession(ctx, userID, req.RefreshToken); err != nil {
+			apperrors.Log(s.logger, "Failed to end session", err)
+			return nil, apperrors.MapToStatus(err, "failed to end session")
+		}
+	}
+
+	if err := s.jwtValidator.Revoke(ctx, token); err != nil {
+		apperrors.Log(s.logger, "Failed to revoke token", err)
+		return nil, apperrors.MapToStatus(err, "failed to revoke token")
+	}
+
+	s.logger.Debug("User logged out", zap.String("user_id", userID))
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategorySession,
+		Action:   "logout",
+		Outcome:  siem.OutcomeSuccess,
+		Severity: siem.SeverityInfo,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: userID},
+	})
+
+	return &auth.LogoutResponse{}, nil
+}
+
+// InvalidateAllSessions ends every session of a user. Users can invalidate
+// their own sessions, admins those of any user.
+func (s *AuthServer) InvalidateAllSessions(ctx context.Context, req *auth.InvalidateAllSessionsRequest) (*auth.InvalidateAllSessionsResponse, error) {
+	callerID, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if req.UserId != callerID {
+		if _, err := s.requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	revoked, err := s.service.InvalidateAllSessions(ctx, req.UserId)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to invalidate sessions", err, zap.String("user_id", req.UserId))
+		return nil, apperrors.MapToStatus(err, "failed to invalidate sessions")
+	}
+
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategorySession,
+		Action:   "invalidate_all_sessions",
+		Outcome:  siem.OutcomeSuccess,
+		Severity: siem.SeverityMedium,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: callerID},
+		Target:   &siem.Target{Type: "user", ID: req.UserId},
+		Details:  map[string]string{"sessions_revoked": strconv.FormatInt(revoked, 10)},
+	})
+
+	return &auth.InvalidateAllSessionsResponse{SessionsRevoked: revoked}, nil
+}
+
+// RequestPasswordReset emails a password reset link to the user with the given
+// email. It answers the same for unknown emails.
+func (s *AuthServer) RequestPasswordReset(ctx context.Context, req *auth.RequestPasswordResetRequest) (*auth.RequestPasswordResetResponse, error) {
+	if req.Email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	if err := s.service.RequestPasswordReset(ctx, req.Email); err != nil {
+		apperrors.Log(s.logger, "Failed to request password reset", err)
+		return nil, apperrors.MapToStatus(err, "failed to request password reset")
+	}
+
+	return &auth.RequestPasswordResetResponse{}, nil
+}
+
+// ConfirmPasswordReset sets a new password with the token of a reset email
+func (s *AuthServer) ConfirmPasswordReset(ctx context.Context, req *auth.ConfirmPasswordResetRequest) (*auth.ConfirmPasswordResetResponse, error) {
+	if req.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	userID, err := s.service.ConfirmPasswordReset(ctx, req.Token, req.NewPassword)
+	if err != nil {
+		apperrors.Log(s.logger, "Password reset failed", err)
+		s.security.Emit(ctx, siem.Event{
+			Category: siem.CategoryIAM,
+			Action:   "password_reset",
+			Outcome:  siem.OutcomeFailure,
+			Severity: siem.SeverityLow,
+			Reason:   siem.Reason(err),
+		})
+		return nil, apperrors.MapToStatus(err, "failed to reset password")
+	}
+
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategoryIAM,
+		Action:   "password_reset",
+		Outcome:  siem.OutcomeSuccess,
+		Severity: siem.SeverityMedium,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: userID},
+	})
+
+	return &auth.ConfirmPasswordResetResponse{}, nil
+}
+
 // Register creates a new user account
 func (s *AuthServer) Register(ctx context.Context, req *auth.RegisterRequest) (*auth.RegisterResponse, error) {
-	// Validate request
-	if req.Email == "" || req.Password == "" || req.Name == "" {
-		s.logger.Warn("Registration attempt with missing fields",
-			zap.String("email", req.Email),
-			zap.String("name", req.Name))
-		return nil, status.Error(codes.InvalidArgument, "email, password, and name are required")
+	if err := s.limitLogin(ctx, "register", req.Email); err != nil {
+		return nil, err
 	}
 
+	// Fields are validated by the service, which reports every invalid one at once
 	s.logger.Debug("Registration attempt",
 		zap.String("email", req.Email),
 		zap.String("name", req.Name))
 
 	// Register user
-	userID, err := s.service.Register(ctx, req.Email, req.Password, req.Name)
+	registration, err := s.service.Register(ctx, req.Email, req.Password, req.Name)
 	if err != nil {
-		if err == service.ErrUserAlreadyExists {
-			s.logger.Warn("User already exists during registration",
-				zap.String("email", req.Email))
-			return nil, status.Error(codes.AlreadyExists, "user already exists")
-		}
-		s.logger.Error("Failed to register user",
-			zap.String("email", req.Email),
-			zap.Error(err))
-		return nil, status.Error(codes.Internal, "failed to register user")
+		apperrors.Log(s.logger, "Failed to register user", err, zap.String("email", req.Email))
+		s.security.Emit(ctx, siem.Event{
+			Category: siem.CategoryIAM,
+			Action:   "register",
+			Outcome:  siem.OutcomeFailure,
+			Reason:   siem.Reason(err),
+			Actor:    siem.Actor{Type: siem.ActorUser, Name: req.Email},
+		})
+		return nil, apperrors.MapToStatus(err, "failed to register user")
 	}
 
 	s.logger.Info("User registered successfully",
-		zap.String("user_id", userID),
-		zap.String("email", req.Email))
+		zap.String("user_id", registration.UserID),
+		zap.String("email", req.Email),
+		zap.String("status", registration.Status))
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategoryIAM,
+		Action:   "register",
+		Outcome:  siem.OutcomeSuccess,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: registration.UserID, Name: req.Email},
+		Details:  map[string]string{"status": registration.Status},
+	})
 
 	return &auth.RegisterResponse{
-		UserId: userID,
+		UserId: registration.UserID,
+		Status: registration.Status,
+	}, nil
+}
+
+// CheckEmailAvailability reports whether an email can still be registered. It
+// counts against the client IP's login limit, so it can't be used to probe
+// which emails have accounts faster than logging in could.
+func (s *AuthServer) CheckEmailAvailability(ctx context.Context, req *auth.CheckEmailAvailabilityRequest) (*auth.CheckEmailAvailabilityResponse, error) {
+	if err := s.limitLogin(ctx, "check_email", ""); err != nil {
+		return nil, err
+	}
+	s.logger.Debug("CheckEmailAvailability request")
+
+	available, err := s.service.CheckEmailAvailability(ctx, req.Email)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to check email availability", err)
+		return nil, apperrors.MapToStatus(err, "failed to check email availability")
+	}
+
+	return &auth.CheckEmailAvailabilityResponse{
+		Available: available,
+	}, nil
+}
+
+// ListPendingRegistrations returns the registrations waiting for admin approval
+func (s *AuthServer) ListPendingRegistrations(ctx context.Context, req *auth.ListPendingRegistrationsRequest) (*auth.ListPendingRegistrationsResponse, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("ListPendingRegistrations request",
+		zap.String("admin_id", adminID),
+		zap.Int32("page", req.Page),
+		zap.Int32("page_size", req.PageSize))
+
+	registrations, total, err := s.service.ListPendingRegistrations(ctx, int(req.Page), int(req.PageSize))
+	if err != nil {
+		s.logger.Error("Failed to list pending registrations", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list pending registrations")
+	}
+
+	// Convert to proto registrations
+	protoRegistrations := make([]*auth.Registration, len(registrations))
+	for i, registration := range registrations {
+		protoRegistrations[i] = &auth.Registration{
+			UserId:    registration.UserID,
+			Email:     registration.Email,
+			Name:      registration.Name,
+			CreatedAt: registration.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+		}
+	}
+
+	return &auth.ListPendingRegistrationsResponse{
+		Registrations: protoRegistrations,
+		Total:         int32(total),
+	}, nil
+}
+
+// ApproveRegistration activates a pending account
+func (s *AuthServer) ApproveRegistration(ctx context.Context, req *auth.ApproveRegistrationRequest) (*auth.ApproveRegistrationResponse, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.ApproveRegistration(ctx, req.UserId); err != nil {
+		apperrors.Log(s.logger, "Failed to approve registration", err, zap.String("user_id", req.UserId))
+		return nil, apperrors.MapToStatus(err, "failed to review registration")
+	}
+
+	s.logger.Info("Registration approved",
+		zap.String("user_id", req.UserId),
+		zap.String("admin_id", adminID))
+	s.emitAdminAction(ctx, adminID, "registration.approve", siem.Target{Type: "user", ID: req.UserId}, nil)
+
+	return &auth.ApproveRegistrationResponse{
+		Success: true,
+	}, nil
+}
+
+// RejectRegistration rejects a pending account
+func (s *AuthServer) RejectRegistration(ctx context.Context, req *auth.RejectRegistrationRequest) (*auth.RejectRegistrationResponse, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.RejectRegistration(ctx, req.UserId); err != nil {
+		apperrors.Log(s.logger, "Failed to reject registration", err, zap.String("user_id", req.UserId))
+		return nil, apperrors.MapToStatus(err, "failed to review registration")
+	}
+
+	s.logger.Info("Registration rejected",
+		zap.String("user_id", req.UserId),
+		zap.String("admin_id", adminID))
+	s.emitAdminAction(ctx, adminID, "registration.reject", siem.Target{Type: "user", ID: req.UserId}, nil)
+
+	return &auth.RejectRegistrationResponse{
+		Success: true,
 	}, nil
 }
 
+// AdminListUsers returns a page of users with their session stats and counts by status and role
+func (s *AuthServer) AdminListUsers(ctx context.Context, req *auth.AdminListUsersRequest) (*auth.AdminListUsersResponse, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("AdminListUsers request",
+		zap.String("admin_id", adminID),
+		zap.Int32("page", req.Page),
+		zap.Int32("page_size", req.PageSize),
+		zap.String("status", req.Status),
+		zap.String("role", req.Role),
+		zap.Strings("tags", req.Tags),
+		zap.String("segment", req.Segment))
+
+	filter := service.UserFilter{
+		Status:  req.Status,
+		Role:    req.Role,
+		Query:   req.Query,
+		Tags:    req.Tags,
+		Segment: req.Segment,
+	}
+	users, total, counts, err := s.service.ListUsersForAdmin(ctx, filter, int(req.Page), int(req.PageSize))
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to list users", err)
+		return nil, apperrors.MapToStatus(err, "failed to list users")
+	}
+
+	protoUsers := make([]*auth.AdminUser, len(users))
+	for i, user := range users {
+		protoUsers[i] = toProtoAdminUser(user)
+	}
+
+	return &auth.AdminListUsersResponse{
+		Users:        protoUsers,
+		Total:        int32(total),
+		StatusCounts: toProtoCounts(counts.ByStatus),
+		RoleCounts:   toProtoCounts(counts.ByRole),
+	}, nil
+}
+
+// AdminGetUser returns a user with their sessions, login history and recent activity
+func (s *AuthServer) AdminGetUser(ctx context.Context, req *auth.AdminGetUserRequest) (*auth.AdminGetUserResponse, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("AdminGetUser request",
+		zap.String("admin_id", adminID),
+		zap.String("user_id", req.UserId))
+
+	detail, err := s.service.GetUserForAdmin(ctx, req.UserId)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to get user", err, zap.String("user_id", req.UserId))
+		return nil, apperrors.MapToStatus(err, "failed to get user")
+	}
+
+	// Every session starts with a login, only active ones are listed as sessions
+	res := &auth.AdminGetUserResponse{
+		User:         toProtoAdminUser(detail.User),
+		Sessions:     []*auth.Session{},
+		LoginHistory: make([]*auth.Login, len(detail.Sessions)),
+		Activity:     make([]*auth.ActivityEntry, len(detail.Activity)),
+	}
+	for i, session := range detail.Sessions {
+		res.LoginHistory[i] = &auth.Login{
+			SessionId:  session.ID,
+			LoggedInAt: formatTime(session.StartedAt),
+			Active:     session.Active,
+		}
+		if session.Active {
+			res.Sessions = append(res.Sessions, &auth.Session{
+				Id:              session.ID,
+				StartedAt:       formatTime(session.StartedAt),
+				LastRefreshedAt: formatTime(session.LastRefreshedAt),
+				ExpiresAt:       formatTime(session.ExpiresAt),
+			})
+		}
+	}
+	for i, entry := range detail.Activity {
+		res.Activity[i] = &auth.ActivityEntry{
+			Id:         entry.ID,
+			Type:       entry.Type,
+			Source:     entry.Source,
+			OccurredAt: formatTime(entry.OccurredAt),
+			Data:       entry.Data,
+		}
+	}
+
+	return res, nil
+}
+
+// toProtoAdminUser converts an admin user to its proto message
+func toProtoAdminUser(user *service.AdminUser) *auth.AdminUser {
+	protoUser := &auth.AdminUser{
+		Id:             user.ID,
+		Email:          user.Email,
+		Name:           user.Name,
+		Role:           user.Role,
+		Status:         user.Status,
+		CreatedAt:      formatTime(user.CreatedAt),
+		UpdatedAt:      formatTime(user.UpdatedAt),
+		ActiveSessions: int32(user.ActiveSessions),
+		Tags:           user.Tags,
+	}
+	if user.LastLoginAt != nil {
+		protoUser.LastLoginAt = formatTime(*user.LastLoginAt)
+	}
+	return protoUser
+}
+
+// toProtoCounts converts counts to their proto map
+func toProtoCounts(counts map[string]int) map[string]int32 {
+	protoCounts := make(map[string]int32, len(counts))
+	for key, count := range counts {
+		protoCounts[key] = int32(count)
+	}
+	return protoCounts
+}
+
+// formatTime formats a timestamp for responses
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// Token issues an access token for the client_credentials grant
+func (s *AuthServer) Token(ctx context.Context, req *auth.TokenRequest) (*auth.TokenResponse, error) {
+	if req.GrantType != "client_credentials" {
+		s.logger.Warn("Token request with unsupported grant type",
+			zap.String("grant_type", req.GrantType))
+		return nil, status.Error(codes.InvalidArgument, "unsupported grant_type, only client_credentials is supported")
+	}
+	if req.ClientId == "" || req.ClientSecret == "" {
+		return nil, status.Error(codes.InvalidArgument, "client_id and client_secret are required")
+	}
+
+	s.logger.Debug("Token request",
+		zap.String("client_id", req.ClientId),
+		zap.String("scope", req.Scope))
+
+	account, err := s.service.AuthenticateClient(ctx, req.ClientId, req.ClientSecret, middleware.CanonicalScopes(strings.Fields(req.Scope)))
+	if err != nil {
+		apperrors.Log(s.logger, "Client authentication failed", err, zap.String("client_id", req.ClientId))
+		s.security.Emit(ctx, siem.Event{
+			Category: siem.CategoryAuthentication,
+			Action:   "client_credentials",
+			Outcome:  siem.OutcomeFailure,
+			Severity: siem.SeverityLow,
+			Reason:   siem.Reason(err),
+			Actor:    siem.Actor{Type: siem.ActorServiceAccount, Name: req.ClientId},
+			Details:  map[string]string{"scope": req.Scope},
+		})
+		return nil, apperrors.MapToStatus(err, "failed to authenticate client")
+	}
+
+	// Service account tokens carry the client and the granted scopes next to the
+	// subject. Each token request authenticates the client with its secret.
+	scope := strings.Join(account.Scopes, " ")
+	token, err := s.signToken(ctx, jwt.MapClaims{
+		"sub":       account.ID,
+		"client_id": account.ClientID,
+		"scope":     scope,
+		"auth_time": time.Now().Unix(),
+	}, s.cfg.Auth.ClientTokenExpiration)
+	if err != nil {
+		s.logger.Error("Failed to generate token",
+			zap.String("client_id", req.ClientId),
+			zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to generate token")
+	}
+
+	s.logger.Info("Issued client credentials token",
+		zap.String("client_id", account.ClientID),
+		zap.String("service_account_id", account.ID),
+		zap.String("scope", scope))
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategoryAuthentication,
+		Action:   "client_credentials",
+		Outcome:  siem.OutcomeSuccess,
+		Actor:    siem.Actor{Type: siem.ActorServiceAccount, ID: account.ID, Name: account.ClientID},
+		Details:  map[string]string{"scope": scope},
+	})
+
+	return &auth.TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.cfg.Auth.ClientTokenExpiration.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// CreateServiceAccount creates a service account, its client secret is only returned once
+func (s *AuthServer) CreateServiceAccount(ctx context.Context, req *auth.CreateServiceAccountRequest) (*auth.CreateServiceAccountResponse, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	account, secret, err := s.service.CreateServiceAccount(ctx, req.Name, middleware.CanonicalScopes(req.Scopes), adminID)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to create service account", err, zap.String("name", req.Name))
+		return nil, apperrors.MapToStatus(err, "failed to create service account")
+	}
+
+	s.logger.Info("Service account created",
+		zap.String("service_account_id", account.ID),
+		zap.String("client_id", account.ClientID),
+		zap.Strings("scopes", account.Scopes),
+		zap.String("admin_id", adminID))
+	s.emitAdminAction(ctx, adminID, "service_account.create",
+		siem.Target{Type: "service_account", ID: account.ID},
+		map[string]string{"client_id": account.ClientID, "scopes": strings.Join(account.Scopes, " ")})
+
+	return &auth.CreateServiceAccountResponse{
+		ServiceAccount: &auth.ServiceAccount{
+			Id:        account.ID,
+			Name:      account.Name,
+			ClientId:  account.ClientID,
+			Scopes:    account.Scopes,
+			CreatedAt: account.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+		},
+		ClientSecret: secret,
+	}, nil
+}
+
+// requireAdmin authenticates the request and checks that the caller is an admin
+func (s *AuthServer) requireAdmin(ctx context.Context) (string, error) {
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Check the role on every call so revoked admins lose access immediately
+	isAdmin, err := s.service.IsAdmin(ctx, userID)
+	if err != nil {
+		s.logger.Error("Failed to check admin role",
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return "", status.Error(codes.Internal, "failed to check permissions")
+	}
+	if !isAdmin {
+		s.logger.Warn("Permission denied: admin role required",
+			zap.String("user_id", userID))
+		method, _ := grpc.Method(ctx)
+		s.security.Emit(ctx, siem.Event{
+			Category: siem.CategoryAuthorization,
+			Action:   "admin_access",
+			Outcome:  siem.OutcomeFailure,
+			Severity: siem.SeverityMedium,
+			Reason:   "admin role required",
+			Actor:    siem.Actor{Type: siem.ActorUser, ID: userID},
+			Details:  map[string]string{"method": method},
+		})
+		return "", status.Error(codes.PermissionDenied, "admin role required")
+	}
+
+	return userID, nil
+}
+
+// authenticate validates the request's bearer token and returns the user ID
+func (s *AuthServer) authenticate(ctx context.Context) (string, error) {
+	token, err := s.bearerToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	valid, userID, _ := s.jwtValidator.ValidateToken(ctx, token)
+	if !valid {
+		s.logger.Warn("Invalid token")
+		return "", status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	return userID, nil
+}
+
+// bearerToken returns the request's bearer token
+func (s *AuthServer) bearerToken(ctx context.Context) (string, error) {
+	// Get authorization token from metadata
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		s.logger.Warn("Missing authorization token")
+		return "", status.Error(codes.Unauthenticated, "missing authorization token")
+	}
+
+	// Remove "Bearer " prefix
+	token := values[0]
+	if len(token) > 7 && token[:7] == "Bearer " {
+		token = token[7:]
+	}
+	return token, nil
+}
+
+// authorizeOperations lets every authenticated user access their own operations and admins all of them
+func (s *AuthServer) authorizeOperations(ctx context.Context) (string, bool, error) {
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	isAdmin, err := s.service.IsAdmin(ctx, userID)
+	if err != nil {
+		s.logger.Error("Failed to check admin role",
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return "", false, status.Error(codes.Internal, "failed to check permissions")
+	}
+
+	return userID, isAdmin, nil
+}
+
+// emitAdminAction records a successful change made by an admin
+func (s *AuthServer) emitAdminAction(ctx context.Context, adminID, action string, target siem.Target, details map[string]string) {
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategoryIAM,
+		Action:   action,
+		Outcome:  siem.OutcomeSuccess,
+		Severity: siem.SeverityMedium,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: adminID},
+		Target:   &target,
+		Details:  details,
+	})
+}
+
 // ValidateToken validates a JWT token
 func (s *AuthServer) ValidateToken(ctx context.Context, req *auth.ValidateTokenRequest) (*auth.ValidateTokenResponse, error) {
 	// Validate token
@@ -131,21 +958,25 @@ func (s *AuthServer) ValidateToken(ctx context.Context, req *auth.ValidateTokenR
 
 	s.logger.Debug("Token validation attempt")
 
+	// Decrypt encrypted tokens to the signed token they wrap
+	signed, err := jwe.Open(req.Token, s.cfg.Auth.TokenEncryptionKey.Reveal())
+	if err != nil {
+		s.logger.Debug("Token decryption failed", zap.Error(err))
+		alerting.Observe(config.AlertTokenValidationErrors, "")
+		return &auth.ValidateTokenResponse{
+			Valid:  false,
+			UserId: "",
+		}, nil
+	}
+
 	// Parse token
-	token, err := jwt.Parse(req.Token, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			s.logger.Warn("Token with invalid signing method",
-				zap.String("method", token.Method.Alg()))
-			return nil, status.Error(codes.Unauthenticated, "invalid token")
-		}
-		return []byte(s.cfg.Auth.JWTSecret), nil
-	})
+	token, err := jwt.Parse(signed, s.keys.Keyfunc)
 
 	// Check for parsing errors
 	if err != nil {
 		s.logger.Debug("Invalid token during validation",
 			zap.Error(err))
+		alerting.Observe(config.AlertTokenValidationErrors, "")
 		return &auth.ValidateTokenResponse{
 			Valid:  false,
 			UserId: "",
@@ -155,6 +986,7 @@ func (s *AuthServer) ValidateToken(ctx context.Context, req *auth.ValidateTokenR
 	// Check if token is valid
 	if !token.Valid {
 		s.logger.Debug("Token validation failed")
+		alerting.Observe(config.AlertTokenValidationErrors, "")
 		return &auth.ValidateTokenResponse{
 			Valid:  false,
 			UserId: "",
@@ -181,32 +1013,101 @@ func (s *AuthServer) ValidateToken(ctx context.Context, req *auth.ValidateTokenR
 		}, nil
 	}
 
+	// Tokens are only valid in their tenant, calls naming another one are refused
+	tenant, _ := claims[middleware.TenantClaim].(string)
+	if tenant == "" {
+		tenant = config.DefaultTenant
+	}
+	if callTenant, ok := database.TenantFromContext(ctx); ok && callTenant != tenant {
+		s.logger.Warn("Token validated for another tenant",
+			zap.String("user_id", userID),
+			zap.String("tenant_id", tenant),
+			zap.String("requested_tenant_id", callTenant))
+		return &auth.ValidateTokenResponse{
+			Valid:  false,
+			UserId: "",
+		}, nil
+	}
+
+	// Logged out tokens are rejected until they expire
+	revoked, err := s.service.Revocations().IsRevoked(ctx, revocation.TokenID(signed))
+	if err != nil {
+		s.logger.Error("Failed to check token revocation", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to validate token")
+	}
+	if revoked {
+		s.logger.Debug("Token was revoked", zap.String("user_id", userID))
+		return &auth.ValidateTokenResponse{
+			Valid:  false,
+			UserId: "",
+		}, nil
+	}
+
+	// Tokens issued before the user's sessions were invalidated are rejected
+	validAfter, err := s.service.TokensValidAfter(ctx, userID)
+	if err != nil {
+		s.logger.Error("Failed to check token cutoff", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to validate token")
+	}
+	if middleware.IssuedAt(claims).Before(validAfter) {
+		s.logger.Debug("Token was issued before the user's sessions were invalidated", zap.String("user_id", userID))
+		return &auth.ValidateTokenResponse{
+			Valid:  false,
+			UserId: "",
+		}, nil
+	}
+
+	impersonator, _ := claims[impersonatorClaim].(string)
 	s.logger.Debug("Token validated successfully",
-		zap.String("user_id", userID))
+		zap.String("user_id", userID),
+		zap.String("impersonator", impersonator))
 
 	return &auth.ValidateTokenResponse{
-		Valid:  true,
-		UserId: userID,
+		Valid:        true,
+		UserId:       userID,
+		Impersonator: impersonator,
+		TenantId:     tenant,
 	}, nil
 }
 
-// generateToken generates a JWT token for the given user ID
-func (s *AuthServer) generateToken(userID string) (string, error) {
-	// Create JWT claims
-	claims := jwt.MapClaims{
-		"sub": userID,
-		"exp": time.Now().Add(s.cfg.Auth.JWTExpiration).Unix(),
-		"iat": time.Now().Unix(),
+// generateToken generates a JWT token for the given user ID, valid for ttl.
+// authTime is when the user entered their credentials, it's left out if zero.
+// A non-empty scope restricts the token, see middleware.ScopeInterceptor.
+func (s *AuthServer) generateToken(ctx context.Context, userID string, authTime time.Time, scope string, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{"sub": userID}
+	if !authTime.IsZero() {
+		claims["auth_time"] = authTime.Unix()
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	return s.signToken(ctx, claims, ttl)
+}
+
+// signToken signs a JWT token with the given claims, valid for ttl. Tokens
+// issued in a tenant carry it, see middleware.TenantInterceptor.
+func (s *AuthServer) signToken(ctx context.Context, claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	if tenant, ok := database.TenantFromContext(ctx); ok {
+		claims[middleware.TenantClaim] = tenant
 	}
 
-	// Create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	now := time.Now()
+	claims["exp"] = now.Add(ttl).Unix()
+	// Milliseconds, so a token issued right after the user's sessions were
+	// invalidated isn't rejected with the ones before it
+	claims["iat"] = float64(now.UnixMilli()) / 1000
+	claims["iss"] = s.cfg.Auth.Issuer
 
 	// Sign token
-	tokenString, err := token.SignedString([]byte(s.cfg.Auth.JWTSecret))
+	tokenString, err := s.keys.Sign(claims)
 	if err != nil {
 		return "", err
 	}
 
+	// Encrypt the signed token so its claims can't be read in transit
+	if s.cfg.Auth.TokenEncryptionKey != "" {
+		return jwe.Encrypt(tokenString, s.cfg.Auth.TokenEncryptionKey.Reveal())
+	}
+
 	return tokenString, nil
 }
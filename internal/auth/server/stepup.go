@@ -0,0 +1,23 @@
+package server
+
+import (
+	"github.com/linkeunid/hello-go/api/gen/auth"
+	"github.com/linkeunid/hello-go/pkg/middleware"
+)
+
+// StepUpMethods lists the sensitive methods that need a recent login, see
+// middleware.StepUpInterceptor
+var StepUpMethods = map[string]middleware.StepUpRule{
+	// Service accounts get credentials of their own
+	auth.AuthService_CreateServiceAccount_FullMethodName: nil,
+	// A stolen session mustn't be able to lock the user out with its own authenticator app
+	auth.AuthService_EnrollTOTP_FullMethodName: nil,
+	// Nor log in with fresh backup codes
+	auth.AuthService_RegenerateBackupCodes_FullMethodName: nil,
+	// Nor take the account over with password resets sent to its own address
+	auth.AuthService_SetRecoveryEmail_FullMethodName: nil,
+	// Nor log in as the user with its own passkey
+	auth.AuthService_BeginWebAuthnRegistration_FullMethodName: nil,
+	// Acting as another user needs the admin to be at the keyboard
+	auth.AuthService_Impersonate_FullMethodName: nil,
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/api/gen/auth"
+	"github.com/linkeunid/hello-go/internal/auth/service"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/siem"
+)
+
+// AddUserTags tags a user, tags the user already has are kept
+func (s *AuthServer) AddUserTags(ctx context.Context, req *auth.AddUserTagsRequest) (*auth.AdminUser, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.service.AddUserTags(ctx, req.UserId, req.Tags, adminID)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to add user tags", err, zap.String("user_id", req.UserId))
+		return nil, apperrors.MapToStatus(err, "failed to add user tags")
+	}
+
+	s.emitAdminAction(ctx, adminID, "user.tag", siem.Target{Type: "user", ID: req.UserId},
+		map[string]string{"tags": strings.Join(req.Tags, " ")})
+
+	return toProtoAdminUser(user), nil
+}
+
+// RemoveUserTag removes a tag from a user
+func (s *AuthServer) RemoveUserTag(ctx context.Context, req *auth.RemoveUserTagRequest) (*auth.AdminUser, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.service.RemoveUserTag(ctx, req.UserId, req.Tag)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to remove user tag", err, zap.String("user_id", req.UserId))
+		return nil, apperrors.MapToStatus(err, "failed to remove user tag")
+	}
+
+	s.emitAdminAction(ctx, adminID, "user.untag", siem.Target{Type: "user", ID: req.UserId},
+		map[string]string{"tag": req.Tag})
+
+	return toProtoAdminUser(user), nil
+}
+
+// ListSegments returns the saved segments, by name
+func (s *AuthServer) ListSegments(ctx context.Context, req *auth.ListSegmentsRequest) (*auth.ListSegmentsResponse, error) {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	segments, err := s.service.ListSegments(ctx)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to list segments", err)
+		return nil, apperrors.MapToStatus(err, "failed to list segments")
+	}
+
+	res := &auth.ListSegmentsResponse{Segments: make([]*auth.Segment, len(segments))}
+	for i, segment := range segments {
+		res.Segments[i] = toProtoSegment(segment)
+	}
+	return res, nil
+}
+
+// CreateSegment saves a named user filter
+func (s *AuthServer) CreateSegment(ctx context.Context, req *auth.CreateSegmentRequest) (*auth.Segment, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	segment, err := s.service.CreateSegment(ctx, fromProtoSegment(req.Segment), adminID)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to create segment", err, zap.String("name", req.GetSegment().GetName()))
+		return nil, apperrors.MapToStatus(err, "failed to create segment")
+	}
+
+	s.emitAdminAction(ctx, adminID, "segment.create", siem.Target{Type: "segment", ID: segment.Name}, nil)
+
+	return toProtoSegment(segment), nil
+}
+
+// UpdateSegment replaces the filter and description of a segment
+func (s *AuthServer) UpdateSegment(ctx context.Context, req *auth.UpdateSegmentRequest) (*auth.Segment, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	segment, err := s.service.UpdateSegment(ctx, fromProtoSegment(req.Segment))
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to update segment", err, zap.String("name", req.GetSegment().GetName()))
+		return nil, apperrors.MapToStatus(err, "failed to update segment")
+	}
+
+	s.emitAdminAction(ctx, adminID, "segment.update", siem.Target{Type: "segment", ID: segment.Name}, nil)
+
+	return toProtoSegment(segment), nil
+}
+
+// DeleteSegment deletes a segment
+func (s *AuthServer) DeleteSegment(ctx context.Context, req *auth.DeleteSegmentRequest) (*auth.DeleteSegmentResponse, error) {
+	adminID, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.DeleteSegment(ctx, req.Name); err != nil {
+		apperrors.Log(s.logger, "Failed to delete segment", err, zap.String("name", req.Name))
+		return nil, apperrors.MapToStatus(err, "failed to delete segment")
+	}
+
+	s.emitAdminAction(ctx, adminID, "segment.delete", siem.Target{Type: "segment", ID: req.Name}, nil)
+
+	return &auth.DeleteSegmentResponse{Success: true}, nil
+}
+
+// fromProtoSegment converts a segment proto message, a missing one is an empty segment
+func fromProtoSegment(segment *auth.Segment) *service.Segment {
+	return &service.Segment{
+		Name:        segment.GetName(),
+		Description: segment.GetDescription(),
+		Filter: service.UserFilter{
+			Status: segment.GetStatus(),
+			Role:   segment.GetRole(),
+			Query:  segment.GetQuery(),
+			Tags:   segment.GetTags(),
+		},
+	}
+}
+
+// toProtoSegment converts a segment to its proto message
+func toProtoSegment(segment *service.Segment) *auth.Segment {
+	return &auth.Segment{
+		Name:        segment.Name,
+		Description: segment.Description,
+		Status:      segment.Filter.Status,
+		Role:        segment.Filter.Role,
+		Query:       segment.Filter.Query,
+		Tags:        segment.Filter.Tags,
+		CreatedBy:   segment.CreatedBy,
+		CreatedAt:   formatTime(segment.CreatedAt),
+		UpdatedAt:   formatTime(segment.UpdatedAt),
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/api/gen/auth"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/metering"
+)
+
+// Usage report limits
+const (
+	defaultUsagePeriod = 24 * time.Hour
+	defaultUsageLimit  = 100
+	maxUsageLimit      = 1000
+)
+
+// ReportUsage returns the API usage per principal and method recorded by the
+// services sharing the database, busiest first
+func (s *AuthServer) ReportUsage(ctx context.Context, req *auth.ReportUsageRequest) (*auth.ReportUsageResponse, error) {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	end := time.Now().UTC()
+	if req.EndTime != "" {
+		parsed, err := time.Parse(time.RFC3339, req.EndTime)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "end_time must be an RFC 3339 time")
+		}
+		end = parsed.UTC()
+	}
+	start := end.Add(-defaultUsagePeriod)
+	if req.StartTime != "" {
+		parsed, err := time.Parse(time.RFC3339, req.StartTime)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "start_time must be an RFC 3339 time")
+		}
+		start = parsed.UTC()
+	}
+	if !start.Before(end) {
+		return nil, status.Error(codes.InvalidArgument, "start_time must be before end_time")
+	}
+
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultUsageLimit
+	}
+	if limit > maxUsageLimit {
+		limit = maxUsageLimit
+	}
+
+	query := metering.Query{
+		Start:     start.Truncate(time.Hour),
+		End:       end,
+		Service:   req.Service,
+		Principal: req.Principal,
+		Method:    req.Method,
+		Limit:     limit,
+	}
+	usage, err := s.service.Meter().Report(ctx, query)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to report usage", err)
+		return nil, apperrors.MapToStatus(err, "failed to report usage")
+	}
+
+	res := &auth.ReportUsageResponse{
+		Rows:      make([]*auth.UsageRow, len(usage)),
+		StartTime: formatTime(query.Start),
+		EndTime:   formatTime(query.End),
+	}
+	for i, u := range usage {
+		row := &auth.UsageRow{
+			Service:          u.Service,
+			Principal:        u.Principal,
+			Method:           u.Method,
+			Calls:            u.Calls,
+			Errors:           u.Errors,
+			RequestBytes:     u.RequestBytes,
+			ResponseBytes:    u.ResponseBytes,
+			MaxLatencyMicros: u.MaxLatencyMicros,
+		}
+		if u.Calls > 0 {
+			row.AvgLatencyMicros = u.LatencyMicros / u.Calls
+		}
+		res.Rows[i] = row
+	}
+	return res, nil
+}
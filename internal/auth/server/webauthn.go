@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/api/gen/auth"
+	"github.com/linkeunid/hello-go/internal/auth/service"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/siem"
+	"github.com/linkeunid/hello-go/pkg/webauthn"
+)
+
+// BeginWebAuthnRegistration starts registering a passkey or security key for the caller
+func (s *AuthServer) BeginWebAuthnRegistration(ctx context.Context, req *auth.BeginWebAuthnRegistrationRequest) (*auth.BeginWebAuthnRegistrationResponse, error) {
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := s.service.BeginWebAuthnRegistration(ctx, userID)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to begin WebAuthn registration", err, zap.String("user_id", userID))
+		return nil, apperrors.MapToStatus(err, "failed to begin passkey registration")
+	}
+
+	return &auth.BeginWebAuthnRegistrationResponse{
+		SessionId:          options.SessionID,
+		Challenge:          options.Challenge,
+		RpId:               options.RPID,
+		RpName:             options.RPName,
+		UserHandle:         options.UserHandle,
+		UserName:           options.UserName,
+		UserDisplayName:    options.UserDisplayName,
+		Algorithms:         options.Algorithms,
+		ExcludeCredentials: webAuthnDescriptorsToProto(options.ExcludeCredentials),
+		Timeout:            options.Timeout.Milliseconds(),
+	}, nil
+}
+
+// FinishWebAuthnRegistration verifies the authenticator's response and stores the caller's credential
+func (s *AuthServer) FinishWebAuthnRegistration(ctx context.Context, req *auth.FinishWebAuthnRegistrationRequest) (*auth.FinishWebAuthnRegistrationResponse, error) {
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.SessionId == "" || req.ClientDataJson == "" || req.AttestationObject == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id, client_data_json and attestation_object are required")
+	}
+	clientData, err := webauthn.DecodeID(req.ClientDataJson)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "client_data_json must be base64url encoded")
+	}
+	attestation, err := webauthn.DecodeID(req.AttestationObject)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "attestation_object must be base64url encoded")
+	}
+
+	credential, err := s.service.FinishWebAuthnRegistration(ctx, userID, req.SessionId, &service.WebAuthnRegistration{
+		ClientDataJSON:    clientData,
+		AttestationObject: attestation,
+		Transports:        req.Transports,
+		Name:              req.Name,
+	})
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to finish WebAuthn registration", err, zap.String("user_id", userID))
+		return nil, apperrors.MapToStatus(err, "failed to register passkey")
+	}
+
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategoryIAM,
+		Action:   "mfa_enabled",
+		Outcome:  siem.OutcomeSuccess,
+		Severity: siem.SeverityLow,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: userID},
+		Details:  map[string]string{"method": "webauthn", "credential_id": credential.ID},
+	})
+
+	return &auth.FinishWebAuthnRegistrationResponse{
+		Id:           credential.ID,
+		CredentialId: credential.CredentialID,
+		Name:         credential.Name,
+		CreatedAt:    formatTime(credential.CreatedAt),
+	}, nil
+}
+
+// BeginWebAuthnLogin starts a login with a passkey or security key
+func (s *AuthServer) BeginWebAuthnLogin(ctx context.Context, req *auth.BeginWebAuthnLoginRequest) (*auth.BeginWebAuthnLoginResponse, error) {
+	if err := s.limitLogin(ctx, "login", req.Email); err != nil {
+		return nil, err
+	}
+
+	options, err := s.service.BeginWebAuthnLogin(ctx, req.Email)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to begin WebAuthn login", err)
+		return nil, apperrors.MapToStatus(err, "failed to begin passkey login")
+	}
+
+	return &auth.BeginWebAuthnLoginResponse{
+		SessionId:        options.SessionID,
+		Challenge:        options.Challenge,
+		RpId:             options.RPID,
+		AllowCredentials: webAuthnDescriptorsToProto(options.AllowCredentials),
+		Timeout:          options.Timeout.Milliseconds(),
+	}, nil
+}
+
+// FinishWebAuthnLogin verifies the authenticator's response and issues the
+// tokens. Authenticators that didn't verify the user, e.g. security keys
+// without a PIN, only replace the password: accounts with MFA get a challenge
+// as with Login.
+func (s *AuthServer) FinishWebAuthnLogin(ctx context.Context, req *auth.FinishWebAuthnLoginRequest) (*auth.LoginResponse, error) {
+	if req.SessionId == "" || req.CredentialId == "" || req.ClientDataJson == "" || req.AuthenticatorData == "" || req.Signature == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id, credential_id, client_data_json, authenticator_data and signature are required")
+	}
+	if err := service.ValidateClientType(req.ClientType); err != nil {
+		return nil, apperrors.MapToStatus(err, "invalid client type")
+	}
+	if req.ExpiresIn < 0 {
+		return nil, status.Error(codes.InvalidArgument, "expires_in must not be negative")
+	}
+	assertion, err := webAuthnAssertionFromProto(req)
+	if err != nil {
+		return nil, err
+	}
+
+	login, err := s.service.FinishWebAuthnLogin(ctx, req.SessionId, assertion)
+	if err != nil {
+		apperrors.Log(s.logger, "WebAuthn login failed", err)
+		s.security.Emit(ctx, siem.Event{
+			Category: siem.CategoryAuthentication,
+			Action:   "login",
+			Outcome:  siem.OutcomeFailure,
+			Severity: siem.SeverityLow,
+			Reason:   siem.Reason(err),
+			Details:  map[string]string{"method": "webauthn"},
+		})
+		return nil, apperrors.MapToStatus(err, "failed to authenticate")
+	}
+
+	expiresIn := time.Duration(req.ExpiresIn) * time.Second
+	if !login.UserVerified {
+		challengeToken, err := s.service.StartMFAChallenge(ctx, login.UserID, req.ClientType, "", expiresIn)
+		if err != nil {
+			apperrors.Log(s.logger, "Failed to start MFA challenge", err, zap.String("user_id", login.UserID))
+			return nil, apperrors.MapToStatus(err, "failed to authenticate")
+		}
+		if challengeToken != "" {
+			s.logger.Debug("MFA required for login", zap.String("user_id", login.UserID))
+			return &auth.LoginResponse{
+				MfaRequired:    true,
+				ChallengeToken: challengeToken,
+			}, nil
+		}
+	}
+
+	session, err := s.startSession(ctx, login.UserID, req.ClientType, "", expiresIn)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("User logged in successfully with WebAuthn", zap.String("user_id", login.UserID))
+	s.recordLogin(ctx, service.LoginAttempt{UserID: login.UserID, Method: service.LoginMethodWebAuthn}, nil)
+	s.security.Emit(ctx, siem.Event{
+		Category: siem.CategoryAuthentication,
+		Action:   "login",
+		Outcome:  siem.OutcomeSuccess,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: login.UserID},
+		Details:  map[string]string{"method": "webauthn"},
+	})
+
+	return &auth.LoginResponse{
+		Token:        session.token,
+		UserId:       login.UserID,
+		RefreshToken: session.refreshToken,
+		ExpiresIn:    int64(session.lifetime.Seconds()),
+	}, nil
+}
+
+// webAuthnAssertionFromProto decodes the base64url encoded fields of a login response
+func webAuthnAssertionFromProto(req *auth.FinishWebAuthnLoginRequest) (*service.WebAuthnAssertion, error) {
+	assertion := &service.WebAuthnAssertion{CredentialID: req.CredentialId}
+	fields := []struct {
+		name  string
+		value string
+		dst   *[]byte
+	}{
+		{"client_data_json", req.ClientDataJson, &assertion.ClientDataJSON},
+		{"authenticator_data", req.AuthenticatorData, &assertion.AuthenticatorData},
+		{"signature", req.Signature, &assertion.Signature},
+		{"user_handle", req.UserHandle, &assertion.UserHandle},
+	}
+	for _, field := range fields {
+		decoded, err := webauthn.DecodeID(field.value)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s must be base64url encoded", field.name)
+		}
+		*field.dst = decoded
+	}
+	return assertion, nil
+}
+
+// webAuthnDescriptorsToProto converts credential descriptors
+func webAuthnDescriptorsToProto(descriptors []service.WebAuthnDescriptor) []*auth.WebAuthnCredentialDescriptor {
+	result := make([]*auth.WebAuthnCredentialDescriptor, 0, len(descriptors))
+	for _, descriptor := range descriptors {
+		result = append(result, &auth.WebAuthnCredentialDescriptor{
+			Id:         descriptor.ID,
+			Transports: descriptor.Transports,
+		})
+	}
+	return result
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+const (
+	// adminSessionLimit is the number of recent sessions in a user's admin detail
+	adminSessionLimit = 20
+	// adminActivityLimit is the number of recent events in a user's admin detail
+	adminActivityLimit = 50
+)
+
+// UserFilter narrows the users listed for admins, empty fields match everything
+type UserFilter struct {
+	Status string
+	Role   string
+	// Query matches a substring of the email or name
+	Query string
+	// Tags match users having all of them
+	Tags []string
+	// Segment names a saved segment whose filter is combined with the other fields
+	Segment string
+}
+
+// AdminUser is a user as shown in the admin dashboard
+type AdminUser struct {
+	ID             string
+	Email          string
+	Name           string
+	Role           string
+	Status         string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	ActiveSessions int
+	LastLoginAt    *time.Time
+	// Tags are sorted
+	Tags []string
+}
+
+// UserCounts counts the users matching a filter by status and by role
+type UserCounts struct {
+	ByStatus map[string]int
+	ByRole   map[string]int
+}
+
+// Session is a login session of a user
+type Session struct {
+	ID              string
+	StartedAt       time.Time
+	LastRefreshedAt time.Time
+	ExpiresAt       time.Time
+	Active          bool
+}
+
+// ActivityEntry is an event about a user, e.g. a detected refresh token reuse
+type ActivityEntry struct {
+	ID         uint64
+	Type       string
+	Source     string
+	Data       string
+	OccurredAt time.Time
+}
+
+// AdminUserDetail combines everything the admin dashboard shows about a user
+type AdminUserDetail struct {
+	User *AdminUser
+	// Sessions are the most recent logins, newest first, including ended ones
+	Sessions []*Session
+	// Activity lists the most recent events about the user, newest first
+	Activity []*ActivityEntry
+}
+
+// ListUsersForAdmin returns a page of users matching the filter with their session
+// stats, the total number of matches and the matches counted by status and role
+func (s *authService) ListUsersForAdmin(ctx context.Context, filter UserFilter, page, pageSize int) ([]*AdminUser, int, *UserCounts, error) {
+	// Validate page and pageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	s.logger.Debug("Listing users for admins",
+		zap.Any("filter", filter),
+		zap.Int("page", page),
+		zap.Int("page_size", pageSize))
+
+	repoFilter, err := s.resolveFilter(ctx, filter)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	users, total, err := s.repo.ListUsers(ctx, repoFilter, page, pageSize)
+	if err != nil {
+		s.logger.Error("Error listing users", zap.Error(err))
+		return nil, 0, nil, err
+	}
+
+	// Load the session stats of the whole page at once
+	userIDs := make([]string, len(users))
+	for i, user := range users {
+		userIDs[i] = user.ID
+	}
+	stats, err := s.repo.GetSessionStats(ctx, userIDs)
+	if err != nil {
+		s.logger.Error("Error loading session stats", zap.Error(err))
+		return nil, 0, nil, err
+	}
+	tags, err := s.repo.GetUserTags(ctx, userIDs)
+	if err != nil {
+		s.logger.Error("Error loading user tags", zap.Error(err))
+		return nil, 0, nil, err
+	}
+
+	counts := &UserCounts{}
+	if counts.ByStatus, err = s.countUsersBy(ctx, "status", repoFilter); err != nil {
+		s.logger.Error("Error counting users by status", zap.Error(err))
+		return nil, 0, nil, err
+	}
+	if counts.ByRole, err = s.countUsersBy(ctx, "role", repoFilter); err != nil {
+		s.logger.Error("Error counting users by role", zap.Error(err))
+		return nil, 0, nil, err
+	}
+
+	result := make([]*AdminUser, len(users))
+	for i, user := range users {
+		result[i] = toAdminUser(user, stats[user.ID], tags[user.ID])
+	}
+
+	return result, total, counts, nil
+}
+
+// countUsersBy counts the users matching the filter by a column. Counts scan
+// every matching user, so they are cached briefly: paging through a list
+// counts once.
+func (s *authService) countUsersBy(ctx context.Context, column string, filter repository.UserFilter) (map[string]int, error) {
+	// Counts are per tenant, like the users they count
+	key := fmt.Sprintf("%s|%s|%q|%q|%q|%q", database.TenantOrDefault(ctx), column, filter.Status, filter.Role, filter.Query, filter.Tags)
+	if counts, ok := s.counts.Get(key); ok {
+		return counts, nil
+	}
+
+	counts, err := s.repo.CountUsersBy(ctx, column, filter)
+	if err != nil {
+		return nil, err
+	}
+	s.counts.Set(key, counts)
+	return counts, nil
+}
+
+// GetUserForAdmin returns a user with their recent sessions and activity
+func (s *authService) GetUserForAdmin(ctx context.Context, userID string) (*AdminUserDetail, error) {
+	s.logger.Debug("Getting user for admins", zap.String("user_id", userID))
+
+	user, err := s.getAdminUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.repo.ListSessions(ctx, userID, adminSessionLimit)
+	if err != nil {
+		s.logger.Error("Error listing sessions", zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	records, err := s.repo.ListUserEvents(ctx, userID, adminActivityLimit)
+	if err != nil {
+		s.logger.Error("Error listing user events", zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	detail := &AdminUserDetail{
+		User:     user,
+		Sessions: make([]*Session, len(sessions)),
+		Activity: make([]*ActivityEntry, len(records)),
+	}
+	for i, session := range sessions {
+		detail.Sessions[i] = (*Session)(session)
+	}
+	for i, record := range records {
+		detail.Activity[i] = &ActivityEntry{
+			ID:         record.ID,
+			Type:       record.Type,
+			Source:     record.Source,
+			Data:       record.Data,
+			OccurredAt: record.OccurredAt,
+		}
+	}
+
+	return detail, nil
+}
+
+// getAdminUser returns a user with their session stats and tags
+func (s *authService) getAdminUser(ctx context.Context, userID string) (*AdminUser, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		s.logger.Error("Error getting user", zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	stats, err := s.repo.GetSessionStats(ctx, []string{userID})
+	if err != nil {
+		s.logger.Error("Error loading session stats", zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	tags, err := s.repo.GetUserTags(ctx, []string{userID})
+	if err != nil {
+		s.logger.Error("Error loading user tags", zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	return toAdminUser(user, stats[userID], tags[userID]), nil
+}
+
+// toAdminUser maps a user with their session stats, if any, and tags to an admin user
+func toAdminUser(user *repository.User, stats *repository.UserSessionStats, tags []string) *AdminUser {
+	adminUser := &AdminUser{
+		ID:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Role:      user.Role,
+		Status:    user.Status,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Tags:      tags,
+	}
+	if stats != nil {
+		adminUser.ActiveSessions = stats.ActiveSessions
+		adminUser.LastLoginAt = stats.LastLoginAt
+	}
+	return adminUser
+}
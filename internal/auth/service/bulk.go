@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/operations"
+)
+
+// Bulk actions
+const (
+	// BulkSuspend suspends active accounts and ends their sessions
+	BulkSuspend = "suspend"
+	// BulkUnsuspend reactivates suspended accounts
+	BulkUnsuspend = "unsuspend"
+	// BulkForcePasswordReset blocks logins until the users reset their password and ends their sessions
+	BulkForcePasswordReset = "force_password_reset"
+	// BulkRevokeSessions revokes every refresh token of the users
+	BulkRevokeSessions = "revoke_sessions"
+)
+
+const (
+	// maxBulkUserIDs limits the users listed explicitly in one bulk operation
+	maxBulkUserIDs = 1000
+	// bulkProgressInterval is the number of users processed between progress updates
+	bulkProgressInterval = 50
+	// maxBulkErrors limits the failures recorded in a bulk operation, later ones are only counted
+	maxBulkErrors = 100
+)
+
+// Bulk operation errors, their messages are returned to clients
+var (
+	ErrUnknownBulkAction = apperrors.Invalid("unknown bulk action")
+	ErrEmptyBulkTarget   = apperrors.Invalid("user IDs or at least one filter are required")
+	ErrTooManyBulkUsers  = apperrors.Invalid("too many user IDs, at most 1000 per operation")
+)
+
+// Errors recorded for the users a bulk action failed for
+var (
+	errBulkNotActive    = apperrors.FailedPrecondition("user not found or not active")
+	errBulkNotSuspended = apperrors.FailedPrecondition("user not found or not suspended")
+	errBulkSelf         = apperrors.Invalid("admins can't apply this action to their own account")
+)
+
+// BulkTarget selects the users of a bulk operation, by ID or, without IDs, by filter
+type BulkTarget struct {
+	UserIDs []string
+	Filter  UserFilter
+}
+
+// BulkError is a user a bulk action failed for
+type BulkError struct {
+	UserID string `json:"user_id"`
+	Error  string `json:"error"`
+}
+
+// BulkProgress is the metadata and result of a bulk operation
+type BulkProgress struct {
+	Action string `json:"action"`
+	// Total is the number of targeted users, known once the filter is resolved
+	Total     int `json:"total"`
+	Processed int `json:"processed"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	// Errors lists the first failures, see Failed for their number
+	Errors []BulkError `json:"errors"`
+}
+
+// BulkOperationKind returns the operation kind of a bulk action
+func BulkOperationKind(action string) string {
+	return "auth.bulk." + action
+}
+
+// startBulkOperation validates a bulk action and starts an operation applying it
+// to the users returned by resolve
+func startBulkOperation(
+	ctx context.Context,
+	manager *operations.Manager,
+	action string,
+	target BulkTarget,
+	createdBy string,
+	resolve func(ctx context.Context) ([]string, error),
+	apply func(ctx context.Context, userID string) error,
+) (*operations.Operation, error) {
+	switch action {
+	case BulkSuspend, BulkUnsuspend, BulkForcePasswordReset, BulkRevokeSessions:
+	default:
+		return nil, ErrUnknownBulkAction
+	}
+	if len(target.UserIDs) > maxBulkUserIDs {
+		return nil, ErrTooManyBulkUsers
+	}
+	if len(target.UserIDs) == 0 && target.Filter.empty() {
+		return nil, ErrEmptyBulkTarget
+	}
+
+	initial := &BulkProgress{Action: action, Total: len(target.UserIDs), Errors: []BulkError{}}
+	return manager.Start(ctx, BulkOperationKind(action), createdBy, initial, func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+		userIDs := target.UserIDs
+		if len(userIDs) == 0 {
+			var err error
+			if userIDs, err = resolve(ctx); err != nil {
+				return nil, errors.New("failed to resolve the target users")
+			}
+		}
+
+		return runBulk(ctx, progress, action, userIDs, apply)
+	})
+}
+
+// runBulk applies an action to every user, reporting the progress every
+// bulkProgressInterval users, and stops early when the operation is cancelled
+func runBulk(
+	ctx context.Context,
+	progress *operations.Progress,
+	action string,
+	userIDs []string,
+	apply func(ctx context.Context, userID string) error,
+) (*BulkProgress, error) {
+	state := &BulkProgress{Action: action, Total: len(userIDs), Errors: []BulkError{}}
+	progress.Update(ctx, state)
+
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			progress.Update(ctx, state)
+			return nil, ctx.Err()
+		}
+
+		if err := apply(ctx, userID); err != nil {
+			state.Failed++
+			if len(state.Errors) < maxBulkErrors {
+				message := "internal error"
+				if apperrors.KindOf(err) != apperrors.KindInternal {
+					message = err.Error()
+				}
+				state.Errors = append(state.Errors, BulkError{UserID: userID, Error: message})
+			}
+		} else {
+			state.Succeeded++
+		}
+		state.Processed++
+
+		if state.Processed%bulkProgressInterval == 0 {
+			progress.Update(ctx, state)
+		}
+	}
+
+	progress.Update(ctx, state)
+	return state, nil
+}
+
+// StartBulkOperation applies a bulk action to the target users as a long-running operation
+func (s *authService) StartBulkOperation(ctx context.Context, action string, target BulkTarget, createdBy string) (*operations.Operation, error) {
+	s.logger.Debug("Starting bulk operation",
+		zap.String("action", action),
+		zap.Int("user_ids", len(target.UserIDs)),
+		zap.Any("filter", target.Filter),
+		zap.String("created_by", createdBy))
+
+	var filter repository.UserFilter
+	if len(target.UserIDs) == 0 {
+		var err error
+		if filter, err = s.resolveFilter(ctx, target.Filter); err != nil {
+			return nil, err
+		}
+	}
+	resolve := func(ctx context.Context) ([]string, error) {
+		return s.repo.ListUserIDs(ctx, filter)
+	}
+	apply := func(ctx context.Context, userID string) error {
+		return s.applyBulkAction(ctx, action, userID, createdBy)
+	}
+
+	op, err := startBulkOperation(ctx, s.operations, action, target, createdBy, resolve, apply)
+	if err != nil {
+		apperrors.Log(s.logger, "Error starting bulk operation", err, zap.String("action", action))
+		return nil, err
+	}
+
+	return op, nil
+}
+
+// applyBulkAction applies a bulk action to one user
+func (s *authService) applyBulkAction(ctx context.Context, action, userID, adminID string) error {
+	switch action {
+	case BulkSuspend:
+		if userID == adminID {
+			return errBulkSelf
+		}
+		err := s.repo.UpdateStatus(ctx, userID, repository.StatusActive, repository.StatusSuspended)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return errBulkNotActive
+		}
+		if err != nil {
+			return err
+		}
+	case BulkUnsuspend:
+		err := s.repo.UpdateStatus(ctx, userID, repository.StatusSuspended, repository.StatusActive)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return errBulkNotSuspended
+		}
+		return err
+	case BulkForcePasswordReset:
+		if userID == adminID {
+			return errBulkSelf
+		}
+		err := s.repo.RequirePasswordReset(ctx, userID)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+	case BulkRevokeSessions:
+		if _, err := s.repo.GetUserByID(ctx, userID); err != nil {
+			if errors.Is(err, repository.ErrUserNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+	}
+
+	// Every action but unsuspending ends the user's sessions
+	_, _, err := s.invalidateSessions(ctx, userID)
+	return err
+}
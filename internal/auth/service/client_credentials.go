@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// Client credentials errors, their messages are returned to clients
+var (
+	ErrInvalidClient         = apperrors.Unauthenticated("invalid client credentials")
+	ErrInvalidScope          = apperrors.Invalid("requested scope is not granted to the client")
+	ErrInvalidServiceAccount = apperrors.Invalid("a name and at least one valid scope are required")
+)
+
+// scopePattern matches scope names such as "users.read"
+var scopePattern = regexp.MustCompile(`^[a-z][a-z0-9_.:-]*$`)
+
+// ServiceAccount represents a non-human client of the API
+type ServiceAccount struct {
+	ID       string
+	Name     string
+	ClientID string
+	// Scopes are the scopes the account may request, or was granted when authenticating
+	Scopes    []string
+	CreatedAt time.Time
+}
+
+// CreateServiceAccount creates a service account and returns it with its client secret.
+// The secret is only stored hashed, so it can't be retrieved again.
+func (s *authService) CreateServiceAccount(ctx context.Context, name string, scopes []string, createdBy string) (*ServiceAccount, string, error) {
+	s.logger.Debug("Creating service account",
+		zap.String("name", name),
+		zap.Strings("scopes", scopes),
+		zap.String("created_by", createdBy))
+
+	scopes, err := normalizeScopes(name, scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	clientID, secret, err := newClientCredentials()
+	if err != nil {
+		s.logger.Error("Failed to generate client credentials", zap.Error(err))
+		return nil, "", err
+	}
+
+	account := &repository.ServiceAccount{
+		ID:         uuid.New().String(),
+		Name:       name,
+		ClientID:   clientID,
+		SecretHash: hashSecret(secret),
+		Scopes:     strings.Join(scopes, " "),
+		CreatedBy:  createdBy,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if err := s.repo.CreateServiceAccount(ctx, account); err != nil {
+		return nil, "", err
+	}
+
+	return &ServiceAccount{
+		ID:        account.ID,
+		Name:      account.Name,
+		ClientID:  account.ClientID,
+		Scopes:    scopes,
+		CreatedAt: account.CreatedAt,
+	}, secret, nil
+}
+
+// AuthenticateClient verifies a client's credentials and returns its service account
+// with the granted scopes: the requested ones, or all of its scopes if none were requested
+func (s *authService) AuthenticateClient(ctx context.Context, clientID, clientSecret string, scopes []string) (*ServiceAccount, error) {
+	s.logger.Debug("Authenticating client",
+		zap.String("client_id", clientID),
+		zap.Strings("scopes", scopes))
+
+	account, err := s.repo.GetServiceAccountByClientID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrServiceAccountNotFound) {
+			return nil, ErrInvalidClient
+		}
+		return nil, err
+	}
+
+	if account.Disabled || !secretMatches(account.SecretHash, clientSecret) {
+		return nil, ErrInvalidClient
+	}
+
+	granted, err := grantScopes(account.ScopeList(), scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceAccount{
+		ID:        account.ID,
+		Name:      account.Name,
+		ClientID:  account.ClientID,
+		Scopes:    granted,
+		CreatedAt: account.CreatedAt,
+	}, nil
+}
+
+// normalizeScopes validates the scopes of a new service account and removes duplicates
+func normalizeScopes(name string, scopes []string) ([]string, error) {
+	if strings.TrimSpace(name) == "" || len(scopes) == 0 {
+		return nil, ErrInvalidServiceAccount
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !scopePattern.MatchString(scope) {
+			return nil, ErrInvalidServiceAccount
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+
+	return result, nil
+}
+
+// grantScopes checks that every requested scope is allowed
+func grantScopes(allowed, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+
+	for _, scope := range requested {
+		found := false
+		for _, candidate := range allowed {
+			if candidate == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	return requested, nil
+}
+
+// newClientCredentials generates a client ID and a random client secret
+func newClientCredentials() (string, string, error) {
+	id := make([]byte, 12)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	return "svc_" + hex.EncodeToString(id), base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashSecret returns the hex encoded SHA-256 of a client secret
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// secretMatches compares a client secret to a stored hash in constant time
+func secretMatches(hash, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(hashSecret(secret))) == 1
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	eventspb "github.com/linkeunid/hello-go/api/gen/events"
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	"github.com/linkeunid/hello-go/pkg/database"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/mail"
+	"github.com/linkeunid/hello-go/pkg/notification"
+)
+
+// Invite errors
+var (
+	ErrInvalidInvite  = apperrors.Invalid("invalid or expired invite")
+	ErrInviteRequired = apperrors.PermissionDenied("registration requires an invite")
+)
+
+// Invite is an admin's invitation of an email to register
+type Invite struct {
+	ID    string
+	Email string
+	// Code accepts the invite, it's only known when the invite is created
+	Code      string
+	ExpiresAt time.Time
+}
+
+// CreateInvite invites an email to register and emails it the invite link.
+// Invites work in every registration mode, the account is active once
+// accepted, even when registrations need approval.
+func (s *authService) CreateInvite(ctx context.Context, adminID, email string) (*Invite, error) {
+	if err := validateInvite(email); err != nil {
+		return nil, err
+	}
+
+	exists, err := s.repo.UserExists(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrUserAlreadyExists
+	}
+
+	ttl := s.cfg.Auth.InviteExpiration
+	code, invite, err := newInvite(database.TenantOrDefault(ctx), adminID, email, ttl)
+	if err != nil {
+		s.logger.Error("Failed to generate invite code", zap.Error(err))
+		return nil, err
+	}
+	if err := s.repo.CreateInvite(ctx, invite); err != nil {
+		return nil, err
+	}
+
+	request, err := inviteEmailRequest(s.cfg.Auth.InviteURL, email, code, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.mail.Send(ctx, request); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Invite created",
+		zap.String("invite_id", invite.ID),
+		zap.String("admin_id", adminID),
+		zap.String("email", email))
+
+	return &Invite{ID: invite.ID, Email: email, Code: code, ExpiresAt: invite.ExpiresAt}, nil
+}
+
+// AcceptInvite creates the active account of an invited email with the
+// invite's code
+func (s *authService) AcceptInvite(ctx context.Context, code, password, name string) (*Registration, error) {
+	invite, err := s.repo.GetInviteByHash(ctx, hashSecret(code))
+	if err != nil {
+		if errors.Is(err, repository.ErrInviteNotFound) {
+			return nil, ErrInvalidInvite
+		}
+		return nil, err
+	}
+	if invite.AcceptedAt != nil || time.Now().After(invite.ExpiresAt) {
+		return nil, ErrInvalidInvite
+	}
+
+	// The account is created in the tenant of the admin who invited the email,
+	// whatever tenant the request names
+	ctx = database.WithTenant(ctx, invite.TenantID)
+
+	if err := validateRegistration(invite.Email, password, name); err != nil {
+		return nil, err
+	}
+
+	// The email may have registered another way since it was invited
+	exists, err := s.repo.UserExists(ctx, invite.Email)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrUserAlreadyExists
+	}
+
+	userID, err := s.repo.AcceptInvite(ctx, invite.ID, invite.Email, password, name)
+	if errors.Is(err, repository.ErrInviteUnavailable) {
+		return nil, ErrInvalidInvite
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("Invite accepted",
+		zap.String("invite_id", invite.ID),
+		zap.String("user_id", userID))
+
+	publishUserEvent(ctx, s.events, s.logger, EventUserRegistered, userID, &eventspb.UserRegistered{
+		UserId:   userID,
+		Email:    invite.Email,
+		Name:     name,
+		Role:     repository.RoleUser,
+		Status:   repository.StatusActive,
+		TenantId: database.TenantOrDefault(ctx),
+	})
+
+	return &Registration{
+		UserID:    userID,
+		Email:     invite.Email,
+		Name:      name,
+		Status:    repository.StatusActive,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// inviteEmailRequest returns the request of an invite email linking to
+// inviteURL with the code. The invitee's locale isn't known, so it's in the
+// default locale.
+func inviteEmailRequest(inviteURL, email, code string, ttl time.Duration) (mail.Request, error) {
+	link, err := url.Parse(inviteURL)
+	if err != nil {
+		return mail.Request{}, fmt.Errorf("invalid invite URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("code", code)
+	link.RawQuery = query.Encode()
+
+	return mail.Request{
+		To:       email,
+		Template: notification.EmailInvite,
+		Data: map[string]interface{}{
+			"invite_url": link.String(),
+			"expires_in": formatExpiry(ttl),
+		},
+	}, nil
+}
+
+// newInvite generates an invite code and its stored invite to a tenant
+func newInvite(tenant, adminID, email string, ttl time.Duration) (string, *repository.Invite, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	code := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	return code, &repository.Invite{
+		ID:        uuid.New().String(),
+		TenantID:  tenant,
+		Email:     email,
+		CodeHash:  hashSecret(code),
+		InvitedBy: adminID,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}, nil
+}
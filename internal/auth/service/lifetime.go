@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	"github.com/linkeunid/hello-go/pkg/config"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// ErrInvalidClientType is returned for client types other than web and mobile
+var ErrInvalidClientType = apperrors.Invalid("client_type must be web or mobile")
+
+// ValidateClientType checks the client type of a login, empty for unknown clients
+func ValidateClientType(clientType string) error {
+	switch clientType {
+	case "", config.ClientWeb, config.ClientMobile:
+		return nil
+	default:
+		return ErrInvalidClientType
+	}
+}
+
+// TokenLifetime returns the lifetime of an access token for a user of a client
+// type. A positive requested lifetime shortens it but can't extend it.
+func (s *authService) TokenLifetime(ctx context.Context, userID, clientType string, requested time.Duration) (time.Duration, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+
+	return tokenLifetime(&s.cfg.Auth, user.Role, clientType, requested), nil
+}
+
+// tokenLifetime applies the lifetime policies: the shortest lifetime of the
+// role and the client type, or JWTExpiration if neither has one, capped by a
+// positive requested lifetime
+func tokenLifetime(cfg *config.AuthConfig, role, clientType string, requested time.Duration) time.Duration {
+	lifetime := time.Duration(0)
+	for _, ttl := range []time.Duration{cfg.TokenExpirationByRole[role], cfg.TokenExpirationByClient[clientType]} {
+		if ttl > 0 && (lifetime == 0 || ttl < lifetime) {
+			lifetime = ttl
+		}
+	}
+	if lifetime == 0 {
+		lifetime = cfg.JWTExpiration
+	}
+
+	if requested > 0 && requested < lifetime {
+		return requested
+	}
+	return lifetime
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+)
+
+// Methods of first login steps, the MFAMethods complete the second one
+const (
+	LoginMethodPassword = "password"
+	LoginMethodWebAuthn = "webauthn"
+)
+
+// Column sizes of the login history, longer values are cut off
+const (
+	maxLoginReasonLength    = 255
+	maxLoginUserAgentLength = 255
+)
+
+// LoginAttempt is a login attempt to record in the login history. Its user is
+// UserID or, if that's unknown, the user of Email or ChallengeToken.
+type LoginAttempt struct {
+	UserID string
+	// Email is the email the attempt was made with, if any
+	Email string
+	// ChallengeToken is the MFA challenge the attempt entered a code for
+	ChallengeToken string
+	// Method is a LoginMethod or MFAMethod
+	Method  string
+	Success bool
+	// Reason is why a failed attempt was rejected
+	Reason    string
+	IPAddress string
+	UserAgent string
+}
+
+// LoginHistoryEntry is a recorded login attempt
+type LoginHistoryEntry struct {
+	ID        uint64
+	Method    string
+	Success   bool
+	Reason    string
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+}
+
+// RecordLogin adds a login attempt to its user's login history. Attempts on
+// unknown accounts aren't recorded, there is no user to show them to.
+func (s *authService) RecordLogin(ctx context.Context, attempt *LoginAttempt) error {
+	userID, err := s.loginAttemptUser(ctx, attempt)
+	if err != nil || userID == "" {
+		return err
+	}
+
+	return s.repo.CreateLoginHistory(ctx, &repository.LoginHistory{
+		UserID:    userID,
+		Email:     attempt.Email,
+		Method:    attempt.Method,
+		Success:   attempt.Success,
+		Reason:    truncate(attempt.Reason, maxLoginReasonLength),
+		IPAddress: attempt.IPAddress,
+		UserAgent: truncate(attempt.UserAgent, maxLoginUserAgentLength),
+		CreatedAt: time.Now(),
+	})
+}
+
+// loginAttemptUser returns the ID of the user a login attempt was made on,
+// empty if there's no such user
+func (s *authService) loginAttemptUser(ctx context.Context, attempt *LoginAttempt) (string, error) {
+	switch {
+	case attempt.UserID != "":
+		return attempt.UserID, nil
+	case attempt.ChallengeToken != "":
+		challenge, err := s.repo.GetMFAChallengeByHash(ctx, hashSecret(attempt.ChallengeToken))
+		if errors.Is(err, repository.ErrMFAChallengeNotFound) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return challenge.UserID, nil
+	case attempt.Email != "":
+		user, err := s.repo.GetUserByEmail(ctx, attempt.Email)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return user.ID, nil
+	default:
+		return "", nil
+	}
+}
+
+// GetLoginHistory returns a page of a user's login attempts, newest first
+func (s *authService) GetLoginHistory(ctx context.Context, userID string, page, pageSize int) ([]*LoginHistoryEntry, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	s.logger.Debug("Getting login history",
+		zap.String("user_id", userID),
+		zap.Int("page", page),
+		zap.Int("page_size", pageSize))
+
+	entries, total, err := s.repo.ListLoginHistory(ctx, userID, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	history := make([]*LoginHistoryEntry, len(entries))
+	for i, entry := range entries {
+		history[i] = toLoginHistoryEntry(entry)
+	}
+	return history, total, nil
+}
+
+// toLoginHistoryEntry converts a stored login history entry
+func toLoginHistoryEntry(entry *repository.LoginHistory) *LoginHistoryEntry {
+	return &LoginHistoryEntry{
+		ID:        entry.ID,
+		Method:    entry.Method,
+		Success:   entry.Success,
+		Reason:    entry.Reason,
+		IPAddress: entry.IPAddress,
+		UserAgent: entry.UserAgent,
+		CreatedAt: entry.CreatedAt,
+	}
+}
+
+// truncate cuts s off after at most n bytes, on a rune boundary. Invalid
+// UTF-8, e.g. from a forged header, is dropped, so strict databases accept it.
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
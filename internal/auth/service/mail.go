@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	"github.com/linkeunid/hello-go/pkg/mail"
+)
+
+// SendUserEmail sends an email to a user in their locale, falling back to the request's locales
+func (s *authService) SendUserEmail(ctx context.Context, userID, template string, data map[string]interface{}) (*mail.Message, error) {
+	s.logger.Debug("Sending email to user",
+		zap.String("user_id", userID),
+		zap.String("template", template))
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return s.mail.Send(ctx, userEmailRequest(ctx, userID, user.Email, user.Name, user.Locale, template, data))
+}
+
+// userEmailRequest builds the request for an email to a user. The user's
+// stored locale is preferred over the ones of the current request, and the
+// template data gets the user's name unless it is set.
+func userEmailRequest(ctx context.Context, userID, email, name, locale, template string, data map[string]interface{}) mail.Request {
+	templateData := map[string]interface{}{"name": name}
+	for key, value := range data {
+		templateData[key] = value
+	}
+
+	return mail.Request{
+		UserID:   userID,
+		To:       email,
+		Template: template,
+		Locales:  append([]string{locale}, mail.RequestLocales(ctx)...),
+		Data:     templateData,
+	}
+}
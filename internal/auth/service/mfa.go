@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	eventspb "github.com/linkeunid/hello-go/api/gen/events"
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/totp"
+)
+
+// MFA errors, their messages are returned to clients
+var (
+	ErrMFAAlreadyEnabled   = apperrors.AlreadyExists("MFA is already enabled")
+	ErrNoTOTPEnrollment    = apperrors.FailedPrecondition("no TOTP enrollment to confirm, enroll first")
+	ErrInvalidTOTPCode     = apperrors.Invalid("invalid TOTP code")
+	ErrInvalidMFAChallenge = apperrors.Unauthenticated("invalid or expired MFA challenge, log in again")
+)
+
+// maxMFAAttempts is the number of wrong codes after which a challenge stops working
+const maxMFAAttempts = 5
+
+// EventMFAEnabled is published when a user confirmed an authenticator app,
+// with an eventspb.MFAEnabled payload
+const EventMFAEnabled = "auth.mfa_enabled"
+
+// TOTPEnrollment is a pending authenticator app, to be confirmed with a code
+type TOTPEnrollment struct {
+	// Secret is the base32 secret to enter into the app
+	Secret string
+	// URI is the otpauth:// URI of the secret, shown as QR code
+	URI string
+}
+
+// Methods completing the second step of a login
+const (
+	MFAMethodTOTP       = "totp"
+	MFAMethodBackupCode = "backup_code"
+)
+
+// MFALogin is a login whose second step was completed
+type MFALogin struct {
+	UserID     string
+	ClientType string
+	// Scope is the scopes requested at login, empty for unrestricted tokens
+	Scope string
+	// ExpiresIn is the token lifetime requested at login, 0 for the default
+	ExpiresIn time.Duration
+	// Method is the MFAMethod the code was of
+	Method string
+}
+
+// EnrollTOTP starts enrolling an authenticator app for a user. A pending
+// enrollment is replaced, MFA is enabled once it's confirmed with ConfirmTOTP.
+func (s *authService) EnrollTOTP(ctx context.Context, userID string) (*TOTPEnrollment, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	credential, err := s.repo.GetTOTPCredential(ctx, userID)
+	switch {
+	case errors.Is(err, repository.ErrTOTPCredentialNotFound):
+		credential = &repository.TOTPCredential{ID: uuid.New().String(), UserID: userID, CreatedAt: time.Now()}
+	case err != nil:
+		return nil, err
+	case credential.Confirmed():
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		s.logger.Error("Failed to generate TOTP secret", zap.Error(err))
+		return nil, err
+	}
+	credential.Secret = secret
+	credential.UpdatedAt = time.Now()
+	if err := s.repo.SaveTOTPCredential(ctx, credential); err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("TOTP enrollment started", zap.String("user_id", userID))
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.cfg.Auth.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP confirms a pending authenticator app with a code from it,
+// enabling MFA for the user's logins. It returns the user's backup codes, for
+// logins without the app.
+func (s *authService) ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	credential, err := s.repo.GetTOTPCredential(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrTOTPCredentialNotFound) {
+			return nil, ErrNoTOTPEnrollment
+		}
+		return nil, err
+	}
+	if credential.Confirmed() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	if err := s.useTOTPCode(ctx, credential, code); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("MFA enabled", zap.String("user_id", userID))
+	publishUserEvent(ctx, s.events, s.logger, EventMFAEnabled, userID, &eventspb.MFAEnabled{
+		UserId: userID,
+		Method: MFAMethodTOTP,
+	})
+
+	// MFA stays enabled if this fails, the user can regenerate the codes
+	return s.issueBackupCodes(ctx, userID)
+}
+
+// StartMFAChallenge starts the second step of a login once the password was
+// checked and returns the challenge token to complete it with. It returns an
+// empty token if the user has no MFA enabled.
+func (s *authService) StartMFAChallenge(ctx context.Context, userID, clientType, scope string, expiresIn time.Duration) (string, error) {
+	credential, err := s.repo.GetTOTPCredential(ctx, userID)
+	if errors.Is(err, repository.ErrTOTPCredentialNotFound) || (err == nil && !credential.Confirmed()) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	value, challenge, err := newMFAChallenge(userID, clientType, scope, expiresIn, s.cfg.Auth.MFAChallengeExpiration)
+	if err != nil {
+		s.logger.Error("Failed to generate MFA challenge", zap.Error(err))
+		return "", err
+	}
+	if err := s.repo.CreateMFAChallenge(ctx, challenge); err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// CompleteMFAChallenge checks the code for a login's challenge, a code of the
+// authenticator app or a backup code. Each challenge can be completed once and
+// takes at most maxMFAAttempts codes.
+func (s *authService) CompleteMFAChallenge(ctx context.Context, challengeToken, code string) (*MFALogin, error) {
+	challenge, err := s.repo.GetMFAChallengeByHash(ctx, hashSecret(challengeToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrMFAChallengeNotFound) {
+			return nil, ErrInvalidMFAChallenge
+		}
+		return nil, err
+	}
+	if challenge.CompletedAt != nil || time.Now().After(challenge.ExpiresAt) {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	// The attempt is counted before the code is checked, so concurrent guesses can't exceed the limit
+	if err := s.repo.AttemptMFAChallenge(ctx, challenge.ID, maxMFAAttempts); err != nil {
+		if errors.Is(err, repository.ErrMFAChallengeExhausted) {
+			return nil, ErrInvalidMFAChallenge
+		}
+		return nil, err
+	}
+
+	credential, err := s.repo.GetTOTPCredential(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrTOTPCredentialNotFound) {
+			return nil, ErrInvalidMFAChallenge
+		}
+		return nil, err
+	}
+
+	method := MFAMethod(code)
+	if method == MFAMethodBackupCode {
+		err = s.useBackupCode(ctx, challenge.UserID, code)
+	} else {
+		err = s.useTOTPCode(ctx, credential, code)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CompleteMFAChallenge(ctx, challenge.ID); err != nil {
+		if errors.Is(err, repository.ErrMFAChallengeCompleted) {
+			return nil, ErrInvalidMFAChallenge
+		}
+		return nil, err
+	}
+
+	return &MFALogin{
+		UserID:     challenge.UserID,
+		ClientType: challenge.ClientType,
+		Scope:      challenge.Scope,
+		ExpiresIn:  time.Duration(challenge.ExpiresIn) * time.Second,
+		Method:     method,
+	}, nil
+}
+
+// MFAMethod returns the MFAMethod of a code entered at login
+func MFAMethod(code string) string {
+	if isBackupCode(code) {
+		return MFAMethodBackupCode
+	}
+	return MFAMethodTOTP
+}
+
+// useTOTPCode checks a code of a credential and records it, so it can't be used again
+func (s *authService) useTOTPCode(ctx context.Context, credential *repository.TOTPCredential, code string) error {
+	step, ok := totp.Validate(credential.Secret, code, time.Now())
+	if !ok || step <= credential.LastStep {
+		return ErrInvalidTOTPCode
+	}
+
+	err := s.repo.UseTOTPStep(ctx, credential.ID, step)
+	if errors.Is(err, repository.ErrTOTPCodeUsed) {
+		return ErrInvalidTOTPCode
+	}
+	return err
+}
+
+// newMFAChallenge generates a challenge token and its stored form
+func newMFAChallenge(userID, clientType, scope string, expiresIn, ttl time.Duration) (string, *repository.MFAChallenge, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	value := base64.RawURLEncoding.EncodeToString(raw)
+
+	return value, &repository.MFAChallenge{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		TokenHash:  hashSecret(value),
+		ClientType: clientType,
+		Scope:      scope,
+		ExpiresIn:  int64(expiresIn.Seconds()),
+		ExpiresAt:  time.Now().Add(ttl),
+		CreatedAt:  time.Now(),
+	}, nil
+}
@@ -2,21 +2,58 @@ package service
 
 import (
 	"context"
-	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	eventspb "github.com/linkeunid/hello-go/api/gen/events"
+	"github.com/linkeunid/hello-go/internal/auth/repository"
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/events"
+	"github.com/linkeunid/hello-go/pkg/jobs"
+	"github.com/linkeunid/hello-go/pkg/jwe"
+	"github.com/linkeunid/hello-go/pkg/mail"
+	"github.com/linkeunid/hello-go/pkg/metering"
+	"github.com/linkeunid/hello-go/pkg/notification"
+	"github.com/linkeunid/hello-go/pkg/operations"
+	"github.com/linkeunid/hello-go/pkg/revocation"
+	"github.com/linkeunid/hello-go/pkg/signing"
+	"github.com/linkeunid/hello-go/pkg/totp"
+	"github.com/linkeunid/hello-go/pkg/webauthn"
 )
 
 // MockAuthService implements the AuthService interface with mock data
 type mockAuthService struct {
-	cfg    *config.Config
-	logger *zap.Logger
-	users  map[string]*mockUser // email -> user
+	cfg                 *config.Config
+	logger              *zap.Logger
+	users               map[string]*mockUser                      // email -> user
+	serviceAccounts     map[string]*mockServiceAccount            // client ID -> account
+	refreshTokens       map[string]*repository.RefreshToken       // token hash -> token
+	resetTokens         map[string]*repository.PasswordResetToken // token hash -> token
+	invites             map[string]*repository.Invite             // code hash -> invite
+	segments            map[string]*Segment                       // name -> segment
+	organizations       map[string]map[string]string              // organization ID -> user ID -> role
+	totpCredentials     map[string]*repository.TOTPCredential     // user ID -> credential
+	mfaChallenges       map[string]*repository.MFAChallenge       // token hash -> challenge
+	webauthnCredentials map[string]*repository.WebAuthnCredential // credential ID -> credential
+	webauthnSessions    map[string]*repository.WebAuthnSession    // session ID -> session
+	backupCodes         map[string][]*repository.BackupCode       // user ID -> codes
+	recoveryTokens      map[string]*repository.RecoveryEmailToken // token hash -> token
+	auditLogs           []*repository.AuditLog
+	loginHistory        []*repository.LoginHistory
+	relyingParty        *webauthn.RelyingParty
+	operations          *operations.Manager
+	jobs                *jobs.Queue
+	meter               *metering.Meter
+	revoked             revocation.Store
+	templates           *notification.Templates
+	mail                *mail.Dispatcher
+	events              events.Publisher
 }
 
 // mockUser represents a mock user
@@ -25,7 +62,44 @@ type mockUser struct {
 	Email     string
 	Password  string
 	Name      string
+	Role      string
+	Status    string
 	CreatedAt time.Time
+	// PasswordResetRequired blocks logins until the password is reset
+	PasswordResetRequired bool
+	Locale                string
+	// RecoveryEmail is the verified recovery email, empty if none
+	RecoveryEmail string
+	// TokensValidAfter rejects access tokens issued before it
+	TokensValidAfter time.Time
+	// Tags are sorted
+	Tags []string
+}
+
+// matches reports whether the user matches an admin filter
+func (u *mockUser) matches(filter UserFilter) bool {
+	query := strings.ToLower(filter.Query)
+	return (filter.Status == "" || u.Status == filter.Status) &&
+		(filter.Role == "" || u.Role == filter.Role) &&
+		(query == "" || strings.Contains(strings.ToLower(u.Email), query) || strings.Contains(strings.ToLower(u.Name), query)) &&
+		u.hasTags(filter.Tags)
+}
+
+// hasTags reports whether the user has every tag
+func (u *mockUser) hasTags(tags []string) bool {
+	for _, tag := range tags {
+		i := sort.SearchStrings(u.Tags, tag)
+		if i == len(u.Tags) || u.Tags[i] != tag {
+			return false
+		}
+	}
+	return true
+}
+
+// mockServiceAccount represents a mock service account
+type mockServiceAccount struct {
+	ServiceAccount
+	Secret string
 }
 
 // NewMockAuthService creates a new mock auth service
@@ -37,6 +111,8 @@ func NewMockAuthService(cfg *config.Config, logger *zap.Logger) AuthService {
 			Email:     "admin@example.com",
 			Password:  "admin123", // In a real app, this would be hashed
 			Name:      "Admin User",
+			Role:      repository.RoleAdmin,
+			Status:    repository.StatusActive,
 			CreatedAt: time.Now().Add(-30 * 24 * time.Hour),
 		},
 		"user@example.com": {
@@ -44,6 +120,8 @@ func NewMockAuthService(cfg *config.Config, logger *zap.Logger) AuthService {
 			Email:     "user@example.com",
 			Password:  "password123", // In a real app, this would be hashed
 			Name:      "Regular User",
+			Role:      repository.RoleUser,
+			Status:    repository.StatusActive,
 			CreatedAt: time.Now().Add(-7 * 24 * time.Hour),
 		},
 		"test@example.com": {
@@ -51,14 +129,53 @@ func NewMockAuthService(cfg *config.Config, logger *zap.Logger) AuthService {
 			Email:     "test@example.com",
 			Password:  "test123", // In a real app, this would be hashed
 			Name:      "Test User",
+			Role:      repository.RoleUser,
+			Status:    repository.StatusActive,
 			CreatedAt: time.Now().Add(-1 * 24 * time.Hour),
 		},
 	}
 
+	// Create a mock service account for batch jobs
+	serviceAccounts := map[string]*mockServiceAccount{
+		"svc_batch": {
+			ServiceAccount: ServiceAccount{
+				ID:        "00000000-0000-0000-0000-000000000101",
+				Name:      "Batch Jobs",
+				ClientID:  "svc_batch",
+				Scopes:    []string{"users.read"},
+				CreatedAt: time.Now().Add(-30 * 24 * time.Hour),
+			},
+			Secret: "batch-secret", // In a real app, this would be hashed
+		},
+	}
+
+	queue := jobs.NewMemoryQueue(cfg, logger.Named("jobs"))
+	templates := notification.NewMemoryTemplates(logger.Named("templates"))
+
 	return &mockAuthService{
-		cfg:    cfg,
-		logger: logger,
-		users:  users,
+		cfg:                 cfg,
+		logger:              logger,
+		users:               users,
+		serviceAccounts:     serviceAccounts,
+		refreshTokens:       make(map[string]*repository.RefreshToken),
+		resetTokens:         make(map[string]*repository.PasswordResetToken),
+		invites:             make(map[string]*repository.Invite),
+		segments:            make(map[string]*Segment),
+		organizations:       make(map[string]map[string]string),
+		totpCredentials:     make(map[string]*repository.TOTPCredential),
+		mfaChallenges:       make(map[string]*repository.MFAChallenge),
+		webauthnCredentials: make(map[string]*repository.WebAuthnCredential),
+		webauthnSessions:    make(map[string]*repository.WebAuthnSession),
+		backupCodes:         make(map[string][]*repository.BackupCode),
+		recoveryTokens:      make(map[string]*repository.RecoveryEmailToken),
+		relyingParty:        webauthn.NewRelyingParty(cfg),
+		operations:          operations.NewMemoryManager(logger.Named("operations")),
+		jobs:                queue,
+		meter:               metering.NewMemoryMeter(cfg, "auth", logger.Named("metering")),
+		revoked:             revocation.NewMemoryStore(),
+		templates:           templates,
+		mail:                mail.NewMemoryDispatcher(cfg, templates, queue, logger.Named("mail")),
+		events:              events.NewLogPublisher(logger.Named("events")),
 	}
 }
 
@@ -77,50 +194,949 @@ func (s *mockAuthService) Authenticate(ctx context.Context, email, password stri
 		return "", ErrInvalidCredentials
 	}
 
+	// Only report the account status once the password is verified
+	switch user.Status {
+	case repository.StatusPending:
+		return "", ErrAccountPending
+	case repository.StatusRejected:
+		return "", ErrAccountRejected
+	case repository.StatusSuspended:
+		return "", ErrAccountSuspended
+	}
+	if user.PasswordResetRequired {
+		return "", ErrPasswordResetRequired
+	}
+
 	return user.ID, nil
 }
 
-// Register creates a new user
-func (s *mockAuthService) Register(ctx context.Context, email, password, name string) (string, error) {
+// Register creates a new user, pending approval if the registration mode requires it
+func (s *mockAuthService) Register(ctx context.Context, email, password, name string) (*Registration, error) {
 	s.logger.Debug("Mock: Registering new user", zap.String("email", email), zap.String("name", name))
 
-	// Validate email format
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
-	if !emailRegex.MatchString(email) {
-		return "", ErrInvalidCredentials
+	// Determine the initial account status
+	accountStatus := repository.StatusActive
+	switch s.cfg.Auth.RegistrationMode {
+	case config.RegistrationClosed:
+		return nil, ErrRegistrationClosed
+	case config.RegistrationInvite:
+		return nil, ErrInviteRequired
+	case config.RegistrationApproval:
+		accountStatus = repository.StatusPending
 	}
 
-	// Check if user already exists
-	if _, exists := s.users[email]; exists {
-		return "", ErrUserAlreadyExists
+	// Validate every field
+	if err := validateRegistration(email, password, name); err != nil {
+		return nil, err
 	}
 
-	// Check password strength (simple example)
-	if len(password) < 6 {
-		return "", ErrInvalidCredentials
+	// Check if user already exists
+	if _, exists := s.users[email]; exists {
+		return nil, ErrUserAlreadyExists
 	}
 
 	// Create user
 	userID := "mock-" + strings.ReplaceAll(email, "@", "-at-")
-	s.users[email] = &mockUser{
+	user := &mockUser{
 		ID:        userID,
 		Email:     email,
 		Password:  password, // In a real app, this would be hashed
 		Name:      name,
+		Role:      repository.RoleUser,
+		Status:    accountStatus,
 		CreatedAt: time.Now(),
 	}
+	s.users[email] = user
 
-	return userID, nil
+	publishUserEvent(ctx, s.events, s.logger, EventUserRegistered, user.ID, &eventspb.UserRegistered{
+		UserId: user.ID,
+		Email:  user.Email,
+		Name:   user.Name,
+		Role:   user.Role,
+		Status: user.Status,
+	})
+
+	return &Registration{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Status:    user.Status,
+		CreatedAt: user.CreatedAt,
+	}, nil
+}
+
+// CheckEmailAvailability reports whether no mock user has the email yet
+func (s *mockAuthService) CheckEmailAvailability(ctx context.Context, email string) (bool, error) {
+	s.logger.Debug("Mock: Checking email availability", zap.String("email", email))
+
+	if err := validateEmailCheck(email); err != nil {
+		return false, err
+	}
+
+	_, exists := s.users[email]
+	return !exists, nil
+}
+
+// CreateInvite invites an email to register and emails it the invite link
+func (s *mockAuthService) CreateInvite(ctx context.Context, adminID, email string) (*Invite, error) {
+	if err := validateInvite(email); err != nil {
+		return nil, err
+	}
+	if _, exists := s.users[email]; exists {
+		return nil, ErrUserAlreadyExists
+	}
+
+	ttl := s.cfg.Auth.InviteExpiration
+	code, invite, err := newInvite(config.DefaultTenant, adminID, email, ttl)
+	if err != nil {
+		return nil, err
+	}
+	s.invites[invite.CodeHash] = invite
+
+	request, err := inviteEmailRequest(s.cfg.Auth.InviteURL, email, code, ttl)
+	if err != nil {
+		return nil, err
+	}
+	// Emails aren't delivered by the mock, so the link is logged to try the flow
+	s.logger.Info("Mock: Invite link", zap.String("email", email), zap.Any("invite_url", request.Data["invite_url"]))
+	if _, err := s.mail.Send(ctx, request); err != nil {
+		return nil, err
+	}
+
+	return &Invite{ID: invite.ID, Email: email, Code: code, ExpiresAt: invite.ExpiresAt}, nil
+}
+
+// AcceptInvite creates the active account of an invited email with the invite's code
+func (s *mockAuthService) AcceptInvite(ctx context.Context, code, password, name string) (*Registration, error) {
+	invite, exists := s.invites[hashSecret(code)]
+	if !exists || invite.AcceptedAt != nil || time.Now().After(invite.ExpiresAt) {
+		return nil, ErrInvalidInvite
+	}
+	if err := validateRegistration(invite.Email, password, name); err != nil {
+		return nil, err
+	}
+	if _, exists := s.users[invite.Email]; exists {
+		return nil, ErrUserAlreadyExists
+	}
+
+	s.logger.Debug("Mock: Accepting invite", zap.String("invite_id", invite.ID), zap.String("email", invite.Email))
+
+	user := &mockUser{
+		ID:        "mock-" + strings.ReplaceAll(invite.Email, "@", "-at-"),
+		Email:     invite.Email,
+		Password:  password, // In a real app, this would be hashed
+		Name:      name,
+		Role:      repository.RoleUser,
+		Status:    repository.StatusActive,
+		CreatedAt: time.Now(),
+	}
+	s.users[user.Email] = user
+	now := time.Now()
+	invite.AcceptedAt = &now
+	invite.UserID = user.ID
+
+	publishUserEvent(ctx, s.events, s.logger, EventUserRegistered, user.ID, &eventspb.UserRegistered{
+		UserId: user.ID,
+		Email:  user.Email,
+		Name:   user.Name,
+		Role:   user.Role,
+		Status: user.Status,
+	})
+
+	return &Registration{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Status:    user.Status,
+		CreatedAt: user.CreatedAt,
+	}, nil
+}
+
+// ListPendingRegistrations returns the registrations waiting for approval
+func (s *mockAuthService) ListPendingRegistrations(ctx context.Context, page, pageSize int) ([]*Registration, int, error) {
+	s.logger.Debug("Mock: Listing pending registrations", zap.Int("page", page), zap.Int("page_size", pageSize))
+
+	// Validate page and pageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	// Collect pending users, oldest first
+	var pending []*Registration
+	for _, user := range s.users {
+		if user.Status != repository.StatusPending {
+			continue
+		}
+		pending = append(pending, &Registration{
+			UserID:    user.ID,
+			Email:     user.Email,
+			Name:      user.Name,
+			Status:    user.Status,
+			CreatedAt: user.CreatedAt,
+		})
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+
+	// Apply pagination
+	total := len(pending)
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []*Registration{}, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+
+	return pending[start:end], total, nil
+}
+
+// ApproveRegistration activates a pending account
+func (s *mockAuthService) ApproveRegistration(ctx context.Context, userID string) error {
+	return s.reviewRegistration(userID, repository.StatusActive)
+}
+
+// RejectRegistration rejects a pending account
+func (s *mockAuthService) RejectRegistration(ctx context.Context, userID string) error {
+	return s.reviewRegistration(userID, repository.StatusRejected)
+}
+
+// reviewRegistration moves a pending account to the given status
+func (s *mockAuthService) reviewRegistration(userID, accountStatus string) error {
+	s.logger.Debug("Mock: Reviewing registration", zap.String("user_id", userID), zap.String("status", accountStatus))
+
+	user := s.findByID(userID)
+	if user == nil || user.Status != repository.StatusPending {
+		return ErrNotPending
+	}
+
+	user.Status = accountStatus
+	return nil
+}
+
+// IsAdmin checks if a user has the admin role
+func (s *mockAuthService) IsAdmin(ctx context.Context, userID string) (bool, error) {
+	user := s.findByID(userID)
+	if user == nil {
+		return false, nil
+	}
+
+	return user.Role == repository.RoleAdmin && user.Status == repository.StatusActive, nil
+}
+
+// CreateServiceAccount creates a service account and returns it with its client secret
+func (s *mockAuthService) CreateServiceAccount(ctx context.Context, name string, scopes []string, createdBy string) (*ServiceAccount, string, error) {
+	s.logger.Debug("Mock: Creating service account", zap.String("name", name), zap.Strings("scopes", scopes))
+
+	scopes, err := normalizeScopes(name, scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	clientID, secret, err := newClientCredentials()
+	if err != nil {
+		return nil, "", err
+	}
+
+	account := &mockServiceAccount{
+		ServiceAccount: ServiceAccount{
+			ID:        "mock-" + clientID,
+			Name:      name,
+			ClientID:  clientID,
+			Scopes:    scopes,
+			CreatedAt: time.Now(),
+		},
+		Secret: secret,
+	}
+	s.serviceAccounts[clientID] = account
+
+	created := account.ServiceAccount
+	return &created, secret, nil
+}
+
+// AuthenticateClient verifies a client's credentials and returns its service account with the granted scopes
+func (s *mockAuthService) AuthenticateClient(ctx context.Context, clientID, clientSecret string, scopes []string) (*ServiceAccount, error) {
+	s.logger.Debug("Mock: Authenticating client", zap.String("client_id", clientID))
+
+	account, exists := s.serviceAccounts[clientID]
+	if !exists || account.Secret != clientSecret {
+		return nil, ErrInvalidClient
+	}
+
+	granted, err := grantScopes(account.Scopes, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticated := account.ServiceAccount
+	authenticated.Scopes = granted
+	return &authenticated, nil
+}
+
+// IssueRefreshToken starts a new refresh token family for a user of a client type
+func (s *mockAuthService) IssueRefreshToken(ctx context.Context, userID, clientType, scope string) (string, error) {
+	s.logger.Debug("Mock: Issuing refresh token",
+		zap.String("user_id", userID),
+		zap.String("client_type", clientType),
+		zap.String("scope", scope))
+
+	value, token, err := newRefreshToken(userID, "", clientType, s.cfg.Auth.RefreshTokenExpiration)
+	if err != nil {
+		return "", err
+	}
+	token.Scope = scope
+	s.refreshTokens[token.TokenHash] = token
+
+	return value, nil
+}
+
+// EndSession revokes the token family of a user's refresh token
+func (s *mockAuthService) EndSession(ctx context.Context, userID, refreshToken string) error {
+	token, exists := s.refreshTokens[hashSecret(refreshToken)]
+	if !exists || token.UserID != userID {
+		return ErrInvalidRefreshToken
+	}
+
+	s.logger.Debug("Mock: Ending session",
+		zap.String("user_id", userID),
+		zap.String("family_id", token.FamilyID))
+
+	now := time.Now()
+	for _, member := range s.refreshTokens {
+		if member.FamilyID == token.FamilyID && member.RevokedAt == nil {
+			member.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// RefreshSession exchanges a refresh token for a new one, revoking the family on reuse
+func (s *mockAuthService) RefreshSession(ctx context.Context, refreshToken string) (*RefreshedSession, error) {
+	token, exists := s.refreshTokens[hashSecret(refreshToken)]
+	if !exists {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	s.logger.Debug("Mock: Refreshing session",
+		zap.String("user_id", token.UserID),
+		zap.String("family_id", token.FamilyID))
+
+	if token.Rotated() {
+		// Revoke every token of the family
+		now := time.Now()
+		var revoked int64
+		for _, member := range s.refreshTokens {
+			if member.FamilyID == token.FamilyID && member.RevokedAt == nil {
+				member.RevokedAt = &now
+				revoked++
+			}
+		}
+
+		s.logger.Warn("Mock: Refresh token reuse detected, session revoked",
+			zap.String("user_id", token.UserID),
+			zap.String("family_id", token.FamilyID),
+			zap.Int64("revoked", revoked))
+
+		publishUserEvent(ctx, s.events, s.logger, EventRefreshTokenReused, token.UserID, &eventspb.RefreshTokenReused{
+			UserId:   token.UserID,
+			FamilyId: token.FamilyID,
+			TokenId:  token.ID,
+			Revoked:  revoked,
+		})
+		return nil, ErrRefreshTokenReused
+	}
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user := s.findByID(token.UserID)
+	if user == nil || user.Status != repository.StatusActive {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	value, replacement, err := newRefreshToken(token.UserID, token.FamilyID, token.ClientType, s.cfg.Auth.RefreshTokenExpiration)
+	if err != nil {
+		return nil, err
+	}
+	replacement.AuthenticatedAt = token.AuthenticatedAt
+	replacement.Scope = token.Scope
+
+	now := time.Now()
+	token.RevokedAt = &now
+	token.ReplacedBy = replacement.ID
+	s.refreshTokens[replacement.TokenHash] = replacement
+
+	return refreshedSession(token, value), nil
+}
+
+// RequestPasswordReset emails a reset link to the active users with the given
+// email or recovery email, unknown emails are ignored
+func (s *mockAuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	s.logger.Debug("Mock: Requesting password reset", zap.String("email", email))
+
+	for _, user := range s.users {
+		if (user.Email != email && user.RecoveryEmail != email) || user.Status != repository.StatusActive {
+			continue
+		}
+
+		value, token, err := newPasswordResetToken(user.ID, s.cfg.Auth.PasswordResetExpiration)
+		if err != nil {
+			return err
+		}
+		s.resetTokens[token.TokenHash] = token
+
+		data, err := passwordResetEmailData(s.cfg.Auth.PasswordResetURL, value, s.cfg.Auth.PasswordResetExpiration)
+		if err != nil {
+			return err
+		}
+		// Emails aren't delivered by the mock, so the link is logged to try the flow
+		s.logger.Info("Mock: Password reset link", zap.String("email", email), zap.Any("reset_url", data["reset_url"]))
+		if _, err := s.mail.Send(ctx, userEmailRequest(ctx, user.ID, email, user.Name, user.Locale, notification.EmailPasswordReset, data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfirmPasswordReset sets a new password with a reset token and ends the user's sessions
+func (s *mockAuthService) ConfirmPasswordReset(ctx context.Context, resetToken, newPassword string) (string, error) {
+	if err := validateNewPassword(newPassword); err != nil {
+		return "", err
+	}
+
+	token, exists := s.resetTokens[hashSecret(resetToken)]
+	if !exists || token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return "", ErrInvalidResetToken
+	}
+	user := s.findByID(token.UserID)
+	if user == nil {
+		return "", ErrInvalidResetToken
+	}
+
+	s.logger.Debug("Mock: Resetting password", zap.String("user_id", user.ID))
+
+	// Links from earlier requests stop working as well
+	now := time.Now()
+	for _, other := range s.resetTokens {
+		if other.UserID == user.ID && other.UsedAt == nil {
+			other.UsedAt = &now
+		}
+	}
+	user.Password = newPassword
+	user.PasswordResetRequired = false
+	_, revoked := s.invalidateSessions(user)
+
+	publishUserEvent(ctx, s.events, s.logger, EventPasswordReset, user.ID, &eventspb.PasswordReset{
+		UserId:          user.ID,
+		SessionsRevoked: revoked,
+	})
+	return user.ID, nil
+}
+
+// TokenLifetime returns the lifetime of an access token for a user of a client type
+func (s *mockAuthService) TokenLifetime(ctx context.Context, userID, clientType string, requested time.Duration) (time.Duration, error) {
+	user := s.findByID(userID)
+	if user == nil {
+		return 0, ErrUserNotFound
+	}
+	return tokenLifetime(&s.cfg.Auth, user.Role, clientType, requested), nil
+}
+
+// TokensValidAfter returns the time before which a user's access tokens are rejected
+func (s *mockAuthService) TokensValidAfter(ctx context.Context, userID string) (time.Time, error) {
+	user := s.findByID(userID)
+	if user == nil {
+		return time.Time{}, nil
+	}
+	return user.TokensValidAfter, nil
+}
+
+// InvalidateAllSessions ends every session of a user
+func (s *mockAuthService) InvalidateAllSessions(ctx context.Context, userID string) (int64, error) {
+	user := s.findByID(userID)
+	if user == nil {
+		return 0, ErrUserNotFound
+	}
+
+	s.logger.Debug("Mock: Invalidating sessions", zap.String("user_id", userID))
+
+	validAfter, revoked := s.invalidateSessions(user)
+	publishUserEvent(ctx, s.events, s.logger, EventSessionsInvalidated, userID, &eventspb.SessionsInvalidated{
+		UserId:          userID,
+		ValidAfter:      timestamppb.New(validAfter),
+		SessionsRevoked: revoked,
+	})
+	return revoked, nil
+}
+
+// Impersonate checks that an admin may act as a user and records it in the audit log
+func (s *mockAuthService) Impersonate(ctx context.Context, adminID, userID, reason string) (*Impersonation, error) {
+	user := s.findByID(userID)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	reason = strings.TrimSpace(reason)
+	if err := checkImpersonation(adminID, user.ID, user.Role, user.Status, reason); err != nil {
+		return nil, err
+	}
+
+	lifetime := s.cfg.Auth.ImpersonationExpiration
+	entry, err := impersonationAuditLog(adminID, user.ID, user.Email, reason, lifetime)
+	if err != nil {
+		return nil, err
+	}
+	entry.ID = uint64(len(s.auditLogs) + 1)
+	s.auditLogs = append(s.auditLogs, entry)
+
+	s.logger.Debug("Mock: Admin impersonating user",
+		zap.String("admin_id", adminID),
+		zap.String("user_id", user.ID),
+		zap.String("details", entry.Details))
+
+	return &Impersonation{UserID: user.ID, Email: user.Email, Lifetime: lifetime}, nil
+}
+
+// RecordLogin adds a login attempt to its user's login history
+func (s *mockAuthService) RecordLogin(ctx context.Context, attempt *LoginAttempt) error {
+	userID := attempt.UserID
+	if userID == "" && attempt.ChallengeToken != "" {
+		if challenge, exists := s.mfaChallenges[hashSecret(attempt.ChallengeToken)]; exists {
+			userID = challenge.UserID
+		}
+	}
+	if userID == "" && attempt.Email != "" {
+		if user, exists := s.users[attempt.Email]; exists {
+			userID = user.ID
+		}
+	}
+	if userID == "" {
+		return nil
+	}
+
+	s.logger.Debug("Mock: Recording login",
+		zap.String("user_id", userID),
+		zap.String("method", attempt.Method),
+		zap.Bool("success", attempt.Success))
+
+	s.loginHistory = append(s.loginHistory, &repository.LoginHistory{
+		ID:        uint64(len(s.loginHistory) + 1),
+		UserID:    userID,
+		Email:     attempt.Email,
+		Method:    attempt.Method,
+		Success:   attempt.Success,
+		Reason:    truncate(attempt.Reason, maxLoginReasonLength),
+		IPAddress: attempt.IPAddress,
+		UserAgent: truncate(attempt.UserAgent, maxLoginUserAgentLength),
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+// GetLoginHistory returns a page of a user's login attempts, newest first
+func (s *mockAuthService) GetLoginHistory(ctx context.Context, userID string, page, pageSize int) ([]*LoginHistoryEntry, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	// Entries are appended in order, so the newest are at the end
+	var history []*LoginHistoryEntry
+	for i := len(s.loginHistory) - 1; i >= 0; i-- {
+		if entry := s.loginHistory[i]; entry.UserID == userID {
+			history = append(history, toLoginHistoryEntry(entry))
+		}
+	}
+
+	total := len(history)
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []*LoginHistoryEntry{}, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+
+	return history[start:end], total, nil
+}
+
+// invalidateSessions rejects a user's access tokens issued until now and
+// revokes their refresh tokens
+func (s *mockAuthService) invalidateSessions(user *mockUser) (time.Time, int64) {
+	now := time.Now().Truncate(time.Millisecond)
+	user.TokensValidAfter = now
+
+	var revoked int64
+	for _, token := range s.refreshTokens {
+		if token.UserID == user.ID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			revoked++
+		}
+	}
+	return now, revoked
+}
+
+// EnrollTOTP starts enrolling an authenticator app, replacing a pending enrollment
+func (s *mockAuthService) EnrollTOTP(ctx context.Context, userID string) (*TOTPEnrollment, error) {
+	user := s.findByID(userID)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if credential, exists := s.totpCredentials[userID]; exists && credential.Confirmed() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	s.totpCredentials[userID] = &repository.TOTPCredential{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.cfg.Auth.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP confirms a pending authenticator app with a code from it and returns the backup codes
+func (s *mockAuthService) ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	credential, exists := s.totpCredentials[userID]
+	if !exists {
+		return nil, ErrNoTOTPEnrollment
+	}
+	if credential.Confirmed() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if !useMockTOTPCode(credential, code) {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	publishUserEvent(ctx, s.events, s.logger, EventMFAEnabled, userID, &eventspb.MFAEnabled{
+		UserId: userID,
+		Method: MFAMethodTOTP,
+	})
+
+	codes, stored, err := newBackupCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	s.backupCodes[userID] = stored
+	return codes, nil
+}
+
+// RegenerateBackupCodes replaces the backup codes of a user with MFA
+func (s *mockAuthService) RegenerateBackupCodes(ctx context.Context, userID string) ([]string, error) {
+	credential, exists := s.totpCredentials[userID]
+	if !exists || !credential.Confirmed() {
+		return nil, ErrMFANotEnabled
+	}
+
+	codes, stored, err := newBackupCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	s.backupCodes[userID] = stored
+	return codes, nil
+}
+
+// StartMFAChallenge returns a challenge token for users with MFA, an empty one for others
+func (s *mockAuthService) StartMFAChallenge(ctx context.Context, userID, clientType, scope string, expiresIn time.Duration) (string, error) {
+	credential, exists := s.totpCredentials[userID]
+	if !exists || !credential.Confirmed() {
+		return "", nil
+	}
+
+	value, challenge, err := newMFAChallenge(userID, clientType, scope, expiresIn, s.cfg.Auth.MFAChallengeExpiration)
+	if err != nil {
+		return "", err
+	}
+	s.mfaChallenges[challenge.TokenHash] = challenge
+
+	return value, nil
+}
+
+// CompleteMFAChallenge checks the code for a login's challenge
+func (s *mockAuthService) CompleteMFAChallenge(ctx context.Context, challengeToken, code string) (*MFALogin, error) {
+	challenge, exists := s.mfaChallenges[hashSecret(challengeToken)]
+	if !exists || challenge.CompletedAt != nil || challenge.Attempts >= maxMFAAttempts || time.Now().After(challenge.ExpiresAt) {
+		return nil, ErrInvalidMFAChallenge
+	}
+	challenge.Attempts++
+	credential, exists := s.totpCredentials[challenge.UserID]
+	if !exists {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	method := MFAMethodTOTP
+	var err error
+	if isBackupCode(code) {
+		method = MFAMethodBackupCode
+		if !s.useMockBackupCode(challenge.UserID, code) {
+			err = ErrInvalidBackupCode
+		}
+	} else if !useMockTOTPCode(credential, code) {
+		err = ErrInvalidTOTPCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	challenge.CompletedAt = &now
+	return &MFALogin{
+		UserID:     challenge.UserID,
+		ClientType: challenge.ClientType,
+		Scope:      challenge.Scope,
+		ExpiresIn:  time.Duration(challenge.ExpiresIn) * time.Second,
+		Method:     method,
+	}, nil
+}
+
+// useMockBackupCode uses up an unused backup code of a user
+func (s *mockAuthService) useMockBackupCode(userID, code string) bool {
+	hash := hashSecret(normalizeBackupCode(code))
+	for _, stored := range s.backupCodes[userID] {
+		if stored.CodeHash == hash && stored.UsedAt == nil {
+			now := time.Now()
+			stored.UsedAt = &now
+			return true
+		}
+	}
+	return false
+}
+
+// SetRecoveryEmail logs a verification link for a user's new recovery email, an empty email removes it
+func (s *mockAuthService) SetRecoveryEmail(ctx context.Context, userID, email string) error {
+	user := s.findByID(userID)
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	if email == "" {
+		// Pending verifications stop working as well
+		now := time.Now()
+		for _, token := range s.recoveryTokens {
+			if token.UserID == userID && token.UsedAt == nil {
+				token.UsedAt = &now
+			}
+		}
+		user.RecoveryEmail = ""
+		return nil
+	}
+	if err := validateRecoveryEmail(email, user.Email); err != nil {
+		return err
+	}
+
+	ttl := s.cfg.Auth.RecoveryEmailExpiration
+	value, token, err := newRecoveryEmailToken(userID, email, ttl)
+	if err != nil {
+		return err
+	}
+	s.recoveryTokens[token.TokenHash] = token
+
+	data, err := recoveryEmailData(s.cfg.Auth.RecoveryEmailURL, value, ttl)
+	if err != nil {
+		return err
+	}
+	// Emails aren't delivered by the mock, so the link is logged to try the flow
+	s.logger.Info("Mock: Recovery email verification link", zap.String("email", email), zap.Any("verification_url", data["verification_url"]))
+	_, err = s.mail.Send(ctx, userEmailRequest(ctx, user.ID, email, user.Name, user.Locale, notification.EmailRecoveryVerification, data))
+	return err
+}
+
+// VerifyRecoveryEmail sets the recovery email of a verification token
+func (s *mockAuthService) VerifyRecoveryEmail(ctx context.Context, verificationToken string) (string, error) {
+	token, exists := s.recoveryTokens[hashSecret(verificationToken)]
+	if !exists || token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return "", ErrInvalidRecoveryEmailToken
+	}
+	user := s.findByID(token.UserID)
+	if user == nil {
+		return "", ErrInvalidRecoveryEmailToken
+	}
+
+	// Links to addresses added before stop working as well
+	now := time.Now()
+	for _, other := range s.recoveryTokens {
+		if other.UserID == user.ID && other.UsedAt == nil {
+			other.UsedAt = &now
+		}
+	}
+	user.RecoveryEmail = token.Email
+	return user.ID, nil
+}
+
+// useMockTOTPCode checks a code of a credential and records it, confirming a pending credential
+func useMockTOTPCode(credential *repository.TOTPCredential, code string) bool {
+	step, ok := totp.Validate(credential.Secret, code, time.Now())
+	if !ok || step <= credential.LastStep {
+		return false
+	}
+
+	now := time.Now()
+	credential.LastStep = step
+	if credential.ConfirmedAt == nil {
+		credential.ConfirmedAt = &now
+	}
+	return true
+}
+
+// BeginWebAuthnRegistration starts registering a passkey or security key for a user
+func (s *mockAuthService) BeginWebAuthnRegistration(ctx context.Context, userID string) (*WebAuthnRegistrationOptions, error) {
+	user := s.findByID(userID)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	session, err := newWebAuthnSession(userID, repository.WebAuthnRegistration, s.cfg.WebAuthn.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	s.webauthnSessions[session.ID] = session
+
+	return newRegistrationOptions(s.relyingParty, session, user.ID, user.Email, user.Name, s.userWebAuthnCredentials(userID), s.cfg.WebAuthn.Timeout), nil
+}
+
+// FinishWebAuthnRegistration verifies the authenticator's response to a registration and stores the credential
+func (s *mockAuthService) FinishWebAuthnRegistration(ctx context.Context, userID, sessionID string, registration *WebAuthnRegistration) (*WebAuthnCredential, error) {
+	session, exists := s.webauthnSessions[sessionID]
+	if !exists || !openWebAuthnSession(session, repository.WebAuthnRegistration) || session.UserID != userID {
+		return nil, ErrInvalidWebAuthnSession
+	}
+
+	verified, err := s.relyingParty.VerifyRegistration(session.Challenge, registration.ClientDataJSON, registration.AttestationObject)
+	if err != nil {
+		s.logger.Debug("Mock: WebAuthn registration rejected", zap.Error(err))
+		return nil, ErrInvalidWebAuthnResponse
+	}
+
+	now := time.Now()
+	session.CompletedAt = &now
+	credential := newWebAuthnCredential(userID, verified, registration)
+	if _, exists := s.webauthnCredentials[credential.CredentialID]; exists {
+		return nil, ErrWebAuthnCredentialExists
+	}
+	s.webauthnCredentials[credential.CredentialID] = credential
+
+	return &WebAuthnCredential{
+		ID:           credential.ID,
+		CredentialID: credential.CredentialID,
+		Name:         credential.Name,
+		CreatedAt:    credential.CreatedAt,
+	}, nil
+}
+
+// BeginWebAuthnLogin starts a login with a passkey or security key, unknown emails get no credentials
+func (s *mockAuthService) BeginWebAuthnLogin(ctx context.Context, email string) (*WebAuthnLoginOptions, error) {
+	var userID string
+	if user, exists := s.users[email]; exists {
+		userID = user.ID
+	}
+
+	session, err := newWebAuthnSession(userID, repository.WebAuthnLogin, s.cfg.WebAuthn.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	s.webauthnSessions[session.ID] = session
+
+	var credentials []*repository.WebAuthnCredential
+	if userID != "" {
+		credentials = s.userWebAuthnCredentials(userID)
+	}
+	return newLoginOptions(s.relyingParty, session, credentials, s.cfg.WebAuthn.Timeout), nil
+}
+
+// FinishWebAuthnLogin verifies the authenticator's response to a login and returns the user it logs in
+func (s *mockAuthService) FinishWebAuthnLogin(ctx context.Context, sessionID string, assertion *WebAuthnAssertion) (*WebAuthnLogin, error) {
+	session, exists := s.webauthnSessions[sessionID]
+	if !exists || !openWebAuthnSession(session, repository.WebAuthnLogin) {
+		return nil, ErrInvalidWebAuthnSession
+	}
+	credential, exists := s.webauthnCredentials[assertion.CredentialID]
+	if !exists {
+		return nil, ErrInvalidWebAuthnLogin
+	}
+
+	verified, err := verifyWebAuthnAssertion(s.relyingParty, session, credential, assertion)
+	if err != nil {
+		logWebAuthnRejection(s.logger, credential, err)
+		return nil, ErrInvalidWebAuthnLogin
+	}
+
+	now := time.Now()
+	session.CompletedAt = &now
+	credential.SignCount = verified.SignCount
+	credential.LastUsedAt = &now
+
+	user := s.findByID(credential.UserID)
+	if user == nil {
+		return nil, ErrInvalidWebAuthnLogin
+	}
+	switch user.Status {
+	case repository.StatusPending:
+		return nil, ErrAccountPending
+	case repository.StatusRejected:
+		return nil, ErrAccountRejected
+	case repository.StatusSuspended:
+		return nil, ErrAccountSuspended
+	}
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	return &WebAuthnLogin{UserID: user.ID, UserVerified: verified.UserVerified}, nil
+}
+
+// userWebAuthnCredentials returns a user's credentials, oldest first
+func (s *mockAuthService) userWebAuthnCredentials(userID string) []*repository.WebAuthnCredential {
+	var credentials []*repository.WebAuthnCredential
+	for _, credential := range s.webauthnCredentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].CreatedAt.Before(credentials[j].CreatedAt)
+	})
+	return credentials
+}
+
+// findByID returns the mock user with the given ID
+func (s *mockAuthService) findByID(userID string) *mockUser {
+	for _, user := range s.users {
+		if user.ID == userID {
+			return user
+		}
+	}
+	return nil
 }
 
 // ValidateToken validates a token and returns the user ID
 func (s *mockAuthService) ValidateToken(ctx context.Context, tokenString string) (string, error) {
 	s.logger.Debug("Mock: Validating token")
 
+	// Decrypt encrypted tokens
+	tokenString, err := jwe.Open(tokenString, s.cfg.Auth.TokenEncryptionKey.Reveal())
+	if err != nil {
+		return "", ErrInvalidCredentials
+	}
+
 	// Parse token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.cfg.Auth.JWTSecret), nil
-	})
+	token, err := jwt.Parse(tokenString, signing.SecretKeyfunc(s.cfg))
 
 	if err != nil || !token.Valid {
 		return "", ErrInvalidCredentials
@@ -141,3 +1157,442 @@ func (s *mockAuthService) ValidateToken(ctx context.Context, tokenString string)
 	// For mock service, let's allow any token with a user ID
 	return userID, nil
 }
+
+// Ping always succeeds, mock data is kept in memory
+func (s *mockAuthService) Ping(ctx context.Context) error {
+	return nil
+}
+
+// ListUsersForAdmin returns a page of users matching the filter with their session stats and counts
+func (s *mockAuthService) ListUsersForAdmin(ctx context.Context, filter UserFilter, page, pageSize int) ([]*AdminUser, int, *UserCounts, error) {
+	s.logger.Debug("Mock: Listing users for admins",
+		zap.Any("filter", filter),
+		zap.Int("page", page),
+		zap.Int("page_size", pageSize))
+
+	// Validate page and pageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	filter, err := s.resolveFilter(filter)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	// Collect matching users, newest first
+	counts := &UserCounts{ByStatus: make(map[string]int), ByRole: make(map[string]int)}
+	var matches []*AdminUser
+	for _, user := range s.users {
+		if !user.matches(filter) {
+			continue
+		}
+		counts.ByStatus[user.Status]++
+		counts.ByRole[user.Role]++
+		matches = append(matches, s.adminUser(user))
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].CreatedAt.After(matches[j].CreatedAt)
+	})
+
+	// Apply pagination
+	total := len(matches)
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []*AdminUser{}, total, counts, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+
+	return matches[start:end], total, counts, nil
+}
+
+// GetUserForAdmin returns a user with their recent sessions, the mock has no activity
+func (s *mockAuthService) GetUserForAdmin(ctx context.Context, userID string) (*AdminUserDetail, error) {
+	s.logger.Debug("Mock: Getting user for admins", zap.String("user_id", userID))
+
+	user := s.findByID(userID)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	sessions := s.sessions(userID)
+	if len(sessions) > adminSessionLimit {
+		sessions = sessions[:adminSessionLimit]
+	}
+
+	return &AdminUserDetail{
+		User:     s.adminUser(user),
+		Sessions: sessions,
+		Activity: []*ActivityEntry{},
+	}, nil
+}
+
+// adminUser maps a mock user to an admin user with their session stats
+func (s *mockAuthService) adminUser(user *mockUser) *AdminUser {
+	adminUser := &AdminUser{
+		ID:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Role:      user.Role,
+		Status:    user.Status,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.CreatedAt,
+		Tags:      user.Tags,
+	}
+	for _, session := range s.sessions(user.ID) {
+		if session.Active {
+			adminUser.ActiveSessions++
+		}
+		if adminUser.LastLoginAt == nil || session.StartedAt.After(*adminUser.LastLoginAt) {
+			startedAt := session.StartedAt
+			adminUser.LastLoginAt = &startedAt
+		}
+	}
+	return adminUser
+}
+
+// sessions groups a user's refresh tokens into sessions, newest first
+func (s *mockAuthService) sessions(userID string) []*Session {
+	families := make(map[string]*Session)
+	for _, token := range s.refreshTokens {
+		if token.UserID != userID {
+			continue
+		}
+		session, exists := families[token.FamilyID]
+		if !exists {
+			session = &Session{ID: token.FamilyID, StartedAt: token.CreatedAt}
+			families[token.FamilyID] = session
+		}
+		if token.CreatedAt.Before(session.StartedAt) {
+			session.StartedAt = token.CreatedAt
+		}
+		if token.CreatedAt.After(session.LastRefreshedAt) {
+			session.LastRefreshedAt = token.CreatedAt
+		}
+		if token.ExpiresAt.After(session.ExpiresAt) {
+			session.ExpiresAt = token.ExpiresAt
+		}
+		if token.RevokedAt == nil && time.Now().Before(token.ExpiresAt) {
+			session.Active = true
+		}
+	}
+
+	sessions := make([]*Session, 0, len(families))
+	for _, session := range families {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.After(sessions[j].StartedAt)
+	})
+	return sessions
+}
+
+// StartBulkOperation applies a bulk action to the target users as a long-running operation
+func (s *mockAuthService) StartBulkOperation(ctx context.Context, action string, target BulkTarget, createdBy string) (*operations.Operation, error) {
+	s.logger.Debug("Mock: Starting bulk operation",
+		zap.String("action", action),
+		zap.Int("user_ids", len(target.UserIDs)),
+		zap.String("created_by", createdBy))
+
+	var filter UserFilter
+	if len(target.UserIDs) == 0 {
+		var err error
+		if filter, err = s.resolveFilter(target.Filter); err != nil {
+			return nil, err
+		}
+	}
+
+	// Resolve the filter, oldest users first
+	resolve := func(ctx context.Context) ([]string, error) {
+		var matches []*mockUser
+		for _, user := range s.users {
+			if user.matches(filter) {
+				matches = append(matches, user)
+			}
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			return matches[i].CreatedAt.Before(matches[j].CreatedAt)
+		})
+
+		userIDs := make([]string, len(matches))
+		for i, user := range matches {
+			userIDs[i] = user.ID
+		}
+		return userIDs, nil
+	}
+	apply := func(ctx context.Context, userID string) error {
+		return s.applyBulkAction(action, userID, createdBy)
+	}
+
+	return startBulkOperation(ctx, s.operations, action, target, createdBy, resolve, apply)
+}
+
+// applyBulkAction applies a bulk action to one mock user
+func (s *mockAuthService) applyBulkAction(action, userID, adminID string) error {
+	user := s.findByID(userID)
+	if (action == BulkSuspend || action == BulkForcePasswordReset) && userID == adminID {
+		return errBulkSelf
+	}
+
+	switch action {
+	case BulkSuspend:
+		if user == nil || user.Status != repository.StatusActive {
+			return errBulkNotActive
+		}
+		user.Status = repository.StatusSuspended
+	case BulkUnsuspend:
+		if user == nil || user.Status != repository.StatusSuspended {
+			return errBulkNotSuspended
+		}
+		user.Status = repository.StatusActive
+		return nil
+	case BulkForcePasswordReset:
+		if user == nil {
+			return ErrUserNotFound
+		}
+		user.PasswordResetRequired = true
+	case BulkRevokeSessions:
+		if user == nil {
+			return ErrUserNotFound
+		}
+	}
+
+	// Every action but unsuspending ends the user's sessions
+	s.invalidateSessions(user)
+	return nil
+}
+
+// Operations returns the manager of the service's long-running operations
+func (s *mockAuthService) Operations() *operations.Manager {
+	return s.operations
+}
+
+// Jobs returns the service's background job queue
+func (s *mockAuthService) Jobs() *jobs.Queue {
+	return s.jobs
+}
+
+// Meter returns the service's usage meter
+func (s *mockAuthService) Meter() *metering.Meter {
+	return s.meter
+}
+
+// Revocations returns the store of logged out tokens
+func (s *mockAuthService) Revocations() revocation.Store {
+	return s.revoked
+}
+
+// Templates returns the email and webhook templates
+func (s *mockAuthService) Templates() *notification.Templates {
+	return s.templates
+}
+
+// Mail returns the dispatcher of transactional emails
+func (s *mockAuthService) Mail() *mail.Dispatcher {
+	return s.mail
+}
+
+// SendUserEmail sends an email to a user in their locale
+func (s *mockAuthService) SendUserEmail(ctx context.Context, userID, template string, data map[string]interface{}) (*mail.Message, error) {
+	s.logger.Debug("Mock: Sending email to user",
+		zap.String("user_id", userID),
+		zap.String("template", template))
+
+	user := s.findByID(userID)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return s.mail.Send(ctx, userEmailRequest(ctx, userID, user.Email, user.Name, user.Locale, template, data))
+}
+
+// resolveFilter validates a filter and combines it with its segment, if any
+func (s *mockAuthService) resolveFilter(filter UserFilter) (UserFilter, error) {
+	tags, err := normalizeTags(filter.Tags)
+	if err != nil {
+		return UserFilter{}, err
+	}
+	filter.Tags = tags
+
+	if filter.Segment != "" {
+		segment, exists := s.segments[filter.Segment]
+		if !exists {
+			return UserFilter{}, ErrSegmentNotFound
+		}
+		filter = filter.merge(segment.Filter)
+	}
+	return filter, nil
+}
+
+// AddUserTags tags a user and returns the user with all their tags
+func (s *mockAuthService) AddUserTags(ctx context.Context, userID string, tags []string, createdBy string) (*AdminUser, error) {
+	s.logger.Debug("Mock: Adding user tags", zap.String("user_id", userID), zap.Strings("tags", tags))
+
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, ErrInvalidTag
+	}
+
+	user := s.findByID(userID)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	user.Tags, _ = normalizeTags(append(append([]string(nil), user.Tags...), tags...))
+
+	return s.adminUser(user), nil
+}
+
+// RemoveUserTag removes a tag from a user and returns the user with their remaining tags
+func (s *mockAuthService) RemoveUserTag(ctx context.Context, userID, tag string) (*AdminUser, error) {
+	s.logger.Debug("Mock: Removing user tag", zap.String("user_id", userID), zap.String("tag", tag))
+
+	user := s.findByID(userID)
+	tag = strings.ToLower(tag)
+	if user == nil || !user.hasTags([]string{tag}) {
+		return nil, ErrTagNotFound
+	}
+
+	remaining := make([]string, 0, len(user.Tags)-1)
+	for _, existing := range user.Tags {
+		if existing != tag {
+			remaining = append(remaining, existing)
+		}
+	}
+	user.Tags = remaining
+
+	return s.adminUser(user), nil
+}
+
+// SyncOrganizationMembers reconciles an organization's members with a desired list
+func (s *mockAuthService) SyncOrganizationMembers(ctx context.Context, organizationID string, members []OrganizationMember, dryRun bool) (*MembershipSync, error) {
+	s.logger.Debug("Mock: Syncing organization members",
+		zap.String("organization_id", organizationID),
+		zap.Int("members", len(members)),
+		zap.Bool("dry_run", dryRun))
+
+	members, err := normalizeMembers(organizationID, members)
+	if err != nil {
+		return nil, err
+	}
+
+	sync := &MembershipSync{}
+	desired := make(map[string]string, len(members))
+	emails := make(map[string]string, len(members))
+	for _, member := range members {
+		var found *mockUser
+		for _, user := range s.users {
+			if strings.EqualFold(user.Email, member.Email) {
+				found = user
+				break
+			}
+		}
+		if found == nil {
+			sync.UnknownEmails = append(sync.UnknownEmails, member.Email)
+			continue
+		}
+		desired[found.ID] = member.Role
+		emails[found.ID] = found.Email
+	}
+
+	current := s.organizations[organizationID]
+	for userID, role := range current {
+		if _, ok := desired[userID]; !ok {
+			email := ""
+			if user := s.findByID(userID); user != nil {
+				email = user.Email
+			}
+			sync.Changes = append(sync.Changes, &MembershipChange{UserID: userID, Email: email, Op: MembershipRemoved, OldRole: role})
+		}
+	}
+	for userID, role := range desired {
+		old, ok := current[userID]
+		switch {
+		case !ok:
+			sync.Changes = append(sync.Changes, &MembershipChange{UserID: userID, Email: emails[userID], Op: MembershipAdded, NewRole: role})
+		case old != role:
+			sync.Changes = append(sync.Changes, &MembershipChange{UserID: userID, Email: emails[userID], Op: MembershipRoleChanged, OldRole: old, NewRole: role})
+		}
+	}
+	sortMembershipChanges(sync.Changes)
+
+	if !dryRun {
+		s.organizations[organizationID] = desired
+		publishMembershipChanges(ctx, s.events, s.logger, organizationID, sync.Changes)
+	}
+	return sync, nil
+}
+
+// ListSegments returns every segment by name
+func (s *mockAuthService) ListSegments(ctx context.Context) ([]*Segment, error) {
+	segments := make([]*Segment, 0, len(s.segments))
+	for _, segment := range s.segments {
+		listed := *segment
+		segments = append(segments, &listed)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Name < segments[j].Name
+	})
+	return segments, nil
+}
+
+// CreateSegment saves a new segment
+func (s *mockAuthService) CreateSegment(ctx context.Context, segment *Segment, createdBy string) (*Segment, error) {
+	s.logger.Debug("Mock: Creating segment", zap.String("name", segment.Name))
+
+	segment, err := normalizeSegment(segment)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := s.segments[segment.Name]; exists {
+		return nil, ErrSegmentExists
+	}
+
+	segment.CreatedBy = createdBy
+	segment.CreatedAt = time.Now()
+	segment.UpdatedAt = segment.CreatedAt
+	s.segments[segment.Name] = segment
+
+	created := *segment
+	return &created, nil
+}
+
+// UpdateSegment replaces the description and filter of a segment
+func (s *mockAuthService) UpdateSegment(ctx context.Context, segment *Segment) (*Segment, error) {
+	s.logger.Debug("Mock: Updating segment", zap.String("name", segment.Name))
+
+	segment, err := normalizeSegment(segment)
+	if err != nil {
+		return nil, err
+	}
+	existing, exists := s.segments[segment.Name]
+	if !exists {
+		return nil, ErrSegmentNotFound
+	}
+
+	existing.Description = segment.Description
+	existing.Filter = segment.Filter
+	existing.UpdatedAt = time.Now()
+
+	updated := *existing
+	return &updated, nil
+}
+
+// DeleteSegment deletes a segment
+func (s *mockAuthService) DeleteSegment(ctx context.Context, name string) error {
+	s.logger.Debug("Mock: Deleting segment", zap.String("name", name))
+
+	if _, exists := s.segments[name]; !exists {
+		return ErrSegmentNotFound
+	}
+	delete(s.segments, name)
+	return nil
+}
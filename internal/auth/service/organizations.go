@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	eventspb "github.com/linkeunid/hello-go/api/gen/events"
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/events"
+)
+
+// Events published for every change of an organization's members, with an
+// eventspb.OrganizationMembershipChanged payload
+const (
+	EventOrganizationMemberAdded       = "auth.organization_member_added"
+	EventOrganizationMemberRemoved     = "auth.organization_member_removed"
+	EventOrganizationMemberRoleChanged = "auth.organization_member_role_changed"
+)
+
+// Roles of organization members, independent of the account role
+const (
+	OrganizationRoleMember = "member"
+	OrganizationRoleAdmin  = "admin"
+)
+
+// Operations of membership changes
+const (
+	MembershipAdded       = "added"
+	MembershipRemoved     = "removed"
+	MembershipRoleChanged = "role_changed"
+)
+
+// Membership sync limits
+const (
+	// maxOrganizationIDLength is the column size of organization IDs
+	maxOrganizationIDLength = 36
+	// maxOrganizationMembers bounds the members of a single sync
+	maxOrganizationMembers = 10000
+)
+
+// ErrOrganizationOfOtherTenant is returned for syncs of an organization another tenant created
+var ErrOrganizationOfOtherTenant = apperrors.PermissionDenied("organization belongs to another tenant")
+
+// OrganizationMember is a desired member of an organization, identified by the
+// email of their account in the organization's tenant
+type OrganizationMember struct {
+	Email string
+	// Role is an OrganizationRole, OrganizationRoleMember if empty
+	Role string
+}
+
+// MembershipChange is a change a membership sync made, or would make in a dry run
+type MembershipChange struct {
+	UserID string
+	Email  string
+	// Op is MembershipAdded, MembershipRemoved or MembershipRoleChanged
+	Op      string
+	OldRole string
+	NewRole string
+}
+
+// MembershipSync is the outcome of a membership sync
+type MembershipSync struct {
+	// Changes are sorted by user ID
+	Changes []*MembershipChange
+	// UnknownEmails have no account, they were left out and can be invited first
+	UnknownEmails []string
+}
+
+// SyncOrganizationMembers makes members the members of an organization in one
+// transaction: missing members are added, members not in the list removed and
+// changed roles updated, publishing an event for each change. With dryRun the
+// changes are only returned.
+func (s *authService) SyncOrganizationMembers(ctx context.Context, organizationID string, members []OrganizationMember, dryRun bool) (*MembershipSync, error) {
+	members, err := normalizeMembers(organizationID, members)
+	if err != nil {
+		return nil, err
+	}
+
+	emails := make([]string, len(members))
+	for i, member := range members {
+		emails[i] = member.Email
+	}
+	users, err := s.repo.GetUsersByEmails(ctx, emails)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := make(map[string]string, len(users))
+	for _, user := range users {
+		userIDs[strings.ToLower(user.Email)] = user.ID
+	}
+
+	sync := &MembershipSync{}
+	desired := make(map[string]string, len(members))
+	for _, member := range members {
+		userID, ok := userIDs[strings.ToLower(member.Email)]
+		if !ok {
+			sync.UnknownEmails = append(sync.UnknownEmails, member.Email)
+			continue
+		}
+		desired[userID] = member.Role
+	}
+
+	changes, err := s.repo.SyncOrganizationMembers(ctx, organizationID, desired, dryRun)
+	if errors.Is(err, repository.ErrOrganizationOfOtherTenant) {
+		return nil, ErrOrganizationOfOtherTenant
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		sync.Changes = append(sync.Changes, toMembershipChange(change))
+	}
+
+	s.logger.Info("Synced organization members",
+		zap.String("organization_id", organizationID),
+		zap.Int("members", len(desired)),
+		zap.Int("changes", len(sync.Changes)),
+		zap.Int("unknown_emails", len(sync.UnknownEmails)),
+		zap.Bool("dry_run", dryRun))
+
+	if !dryRun {
+		publishMembershipChanges(ctx, s.events, s.logger, organizationID, sync.Changes)
+	}
+	return sync, nil
+}
+
+// normalizeMembers checks an organization ID and its desired members, and
+// returns the members with trimmed emails and default roles
+func normalizeMembers(organizationID string, members []OrganizationMember) ([]OrganizationMember, error) {
+	var violations apperrors.Violations
+	switch {
+	case strings.TrimSpace(organizationID) == "":
+		violations.Add("organization_id", "is required")
+	case utf8.RuneCountInString(organizationID) > maxOrganizationIDLength:
+		violations.Add("organization_id", fmt.Sprintf("must be at most %d characters", maxOrganizationIDLength))
+	}
+	if len(members) > maxOrganizationMembers {
+		violations.Add("members", fmt.Sprintf("must have at most %d entries", maxOrganizationMembers))
+		return nil, violations.Err()
+	}
+
+	normalized := make([]OrganizationMember, len(members))
+	seen := make(map[string]bool, len(members))
+	for i, member := range members {
+		field := fmt.Sprintf("members[%d]", i)
+		member.Email = strings.TrimSpace(member.Email)
+		if member.Role == "" {
+			member.Role = OrganizationRoleMember
+		}
+
+		switch {
+		case member.Email == "":
+			violations.Add(field+".email", "is required")
+		case !validEmail(member.Email):
+			violations.Add(field+".email", "must be a valid email address")
+		}
+		key := strings.ToLower(member.Email)
+		if seen[key] {
+			violations.Add(field+".email", "is listed more than once")
+		}
+		seen[key] = true
+		if member.Role != OrganizationRoleMember && member.Role != OrganizationRoleAdmin {
+			violations.Add(field+".role", fmt.Sprintf("must be %s or %s", OrganizationRoleMember, OrganizationRoleAdmin))
+		}
+
+		normalized[i] = member
+	}
+	if err := violations.Err(); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// toMembershipChange converts a stored membership change
+func toMembershipChange(change *repository.MembershipChange) *MembershipChange {
+	converted := &MembershipChange{
+		UserID:  change.UserID,
+		Email:   change.Email,
+		OldRole: change.OldRole,
+		NewRole: change.NewRole,
+	}
+	switch {
+	case change.OldRole == "":
+		converted.Op = MembershipAdded
+	case change.NewRole == "":
+		converted.Op = MembershipRemoved
+	default:
+		converted.Op = MembershipRoleChanged
+	}
+	return converted
+}
+
+// publishMembershipChanges publishes an event for each change of an organization's members
+func publishMembershipChanges(ctx context.Context, publisher events.Publisher, logger *zap.Logger, organizationID string, changes []*MembershipChange) {
+	eventTypes := map[string]string{
+		MembershipAdded:       EventOrganizationMemberAdded,
+		MembershipRemoved:     EventOrganizationMemberRemoved,
+		MembershipRoleChanged: EventOrganizationMemberRoleChanged,
+	}
+	for _, change := range changes {
+		publishUserEvent(ctx, publisher, logger, eventTypes[change.Op], change.UserID, &eventspb.OrganizationMembershipChanged{
+			OrganizationId: organizationID,
+			UserId:         change.UserID,
+			Email:          change.Email,
+			OldRole:        change.OldRole,
+			NewRole:        change.NewRole,
+		})
+	}
+}
+
+// sortMembershipChanges sorts changes by user ID, like the repository returns them
+func sortMembershipChanges(changes []*MembershipChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].UserID < changes[j].UserID
+	})
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	eventspb "github.com/linkeunid/hello-go/api/gen/events"
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/notification"
+)
+
+// Password reset errors, their messages are returned to clients
+var (
+	ErrInvalidResetToken = apperrors.Invalid("invalid or expired password reset token")
+)
+
+// EventPasswordReset is published when a user set a new password with a reset token,
+// with an eventspb.PasswordReset payload
+const EventPasswordReset = "auth.password_reset"
+
+// RequestPasswordReset emails a reset link to the users with the given email
+// or verified recovery email, to that address, so users who lost access to
+// their primary inbox can reset their password too. Unknown emails and
+// accounts that can't log in get no email but the same answer, so the call
+// doesn't reveal which emails are registered.
+func (s *authService) RequestPasswordReset(ctx context.Context, email string) error {
+	s.logger.Debug("Requesting password reset", zap.String("email", email))
+
+	users, err := s.repo.ListUsersByAnyEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if user.Status != repository.StatusActive {
+			s.logger.Debug("Password reset requested for inactive account",
+				zap.String("user_id", user.ID),
+				zap.String("status", user.Status))
+			continue
+		}
+		if err := s.sendPasswordReset(ctx, user, email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendPasswordReset emails a new reset link of a user to the given address
+func (s *authService) sendPasswordReset(ctx context.Context, user *repository.User, email string) error {
+	value, token, err := newPasswordResetToken(user.ID, s.cfg.Auth.PasswordResetExpiration)
+	if err != nil {
+		s.logger.Error("Failed to generate password reset token", zap.Error(err))
+		return err
+	}
+	if err := s.repo.CreatePasswordResetToken(ctx, token); err != nil {
+		return err
+	}
+
+	data, err := passwordResetEmailData(s.cfg.Auth.PasswordResetURL, value, s.cfg.Auth.PasswordResetExpiration)
+	if err != nil {
+		return err
+	}
+	_, err = s.mail.Send(ctx, userEmailRequest(ctx, user.ID, email, user.Name, user.Locale, notification.EmailPasswordReset, data))
+	return err
+}
+
+// ConfirmPasswordReset sets a new password with a reset token and ends the
+// user's sessions. A required password reset is cleared.
+func (s *authService) ConfirmPasswordReset(ctx context.Context, resetToken, newPassword string) (string, error) {
+	if err := validateNewPassword(newPassword); err != nil {
+		return "", err
+	}
+
+	token, err := s.repo.GetPasswordResetTokenByHash(ctx, hashSecret(resetToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrPasswordResetTokenNotFound) {
+			return "", ErrInvalidResetToken
+		}
+		return "", err
+	}
+	if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return "", ErrInvalidResetToken
+	}
+
+	err = s.repo.ResetPassword(ctx, token.ID, token.UserID, newPassword)
+	if errors.Is(err, repository.ErrPasswordResetTokenUsed) || errors.Is(err, repository.ErrUserNotFound) {
+		return "", ErrInvalidResetToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Sessions started with the old password end, including their access tokens
+	_, revoked, err := s.invalidateSessions(ctx, token.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.Info("Password reset",
+		zap.String("user_id", token.UserID),
+		zap.Int64("sessions_revoked", revoked))
+	publishUserEvent(ctx, s.events, s.logger, EventPasswordReset, token.UserID, &eventspb.PasswordReset{
+		UserId:          token.UserID,
+		SessionsRevoked: revoked,
+	})
+	return token.UserID, nil
+}
+
+// passwordResetEmailData returns the template data of a password reset email
+// linking to resetURL with the token
+func passwordResetEmailData(resetURL, value string, ttl time.Duration) (map[string]interface{}, error) {
+	link, err := url.Parse(resetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password reset URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", value)
+	link.RawQuery = query.Encode()
+
+	return map[string]interface{}{
+		"reset_url":  link.String(),
+		"expires_in": formatExpiry(ttl),
+	}, nil
+}
+
+// newPasswordResetToken generates a reset token and its stored form
+func newPasswordResetToken(userID string, ttl time.Duration) (string, *repository.PasswordResetToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	value := base64.RawURLEncoding.EncodeToString(raw)
+
+	return value, &repository.PasswordResetToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		TokenHash: hashSecret(value),
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// formatExpiry describes a lifetime in emails, e.g. "1 hour" or "90 minutes"
+func formatExpiry(ttl time.Duration) string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+
+	switch {
+	case ttl >= 24*time.Hour && ttl%(24*time.Hour) == 0:
+		return plural(int64(ttl/(24*time.Hour)), "day")
+	case ttl >= time.Hour && ttl%time.Hour == 0:
+		return plural(int64(ttl/time.Hour), "hour")
+	case ttl >= time.Minute:
+		return plural(int64(ttl/time.Minute), "minute")
+	default:
+		return ttl.String()
+	}
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/notification"
+)
+
+// Account recovery errors, their messages are returned to clients
+var (
+	ErrMFANotEnabled             = apperrors.FailedPrecondition("MFA is not enabled, confirm an authenticator app first")
+	ErrInvalidBackupCode         = apperrors.Invalid("invalid or used backup code")
+	ErrInvalidRecoveryEmailToken = apperrors.Invalid("invalid or expired recovery email token")
+)
+
+// Backup codes are issued in sets of backupCodeCount, each backupCodeLength
+// characters of backupCodeAlphabet, which leaves out look-alikes like 0 and o
+const (
+	backupCodeCount    = 10
+	backupCodeLength   = 10
+	backupCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// issueBackupCodes replaces a user's backup codes with a new set and returns it
+func (s *authService) issueBackupCodes(ctx context.Context, userID string) ([]string, error) {
+	codes, stored, err := newBackupCodes(userID)
+	if err != nil {
+		s.logger.Error("Failed to generate backup codes", zap.Error(err))
+		return nil, err
+	}
+	if err := s.repo.ReplaceBackupCodes(ctx, userID, stored); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RegenerateBackupCodes replaces the backup codes of a user with MFA, e.g.
+// once most were used or the old ones were exposed
+func (s *authService) RegenerateBackupCodes(ctx context.Context, userID string) ([]string, error) {
+	credential, err := s.repo.GetTOTPCredential(ctx, userID)
+	if errors.Is(err, repository.ErrTOTPCredentialNotFound) || (err == nil && !credential.Confirmed()) {
+		return nil, ErrMFANotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := s.issueBackupCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Backup codes regenerated", zap.String("user_id", userID))
+	return codes, nil
+}
+
+// useBackupCode checks a backup code of a user and uses it up
+func (s *authService) useBackupCode(ctx context.Context, userID, code string) error {
+	err := s.repo.UseBackupCode(ctx, userID, hashSecret(normalizeBackupCode(code)))
+	if errors.Is(err, repository.ErrBackupCodeNotFound) {
+		return ErrInvalidBackupCode
+	}
+	if err == nil {
+		s.logger.Info("Backup code used", zap.String("user_id", userID))
+	}
+	return err
+}
+
+// SetRecoveryEmail emails a verification link to a recovery email for a
+// user, which replaces the current one once it's verified. An empty email
+// removes the recovery email.
+func (s *authService) SetRecoveryEmail(ctx context.Context, userID, email string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if email == "" {
+		if err := s.repo.RemoveRecoveryEmail(ctx, userID); err != nil {
+			if errors.Is(err, repository.ErrUserNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		s.logger.Info("Recovery email removed", zap.String("user_id", userID))
+		return nil
+	}
+	if err := validateRecoveryEmail(email, user.Email); err != nil {
+		return err
+	}
+
+	ttl := s.cfg.Auth.RecoveryEmailExpiration
+	value, token, err := newRecoveryEmailToken(userID, email, ttl)
+	if err != nil {
+		s.logger.Error("Failed to generate recovery email token", zap.Error(err))
+		return err
+	}
+	if err := s.repo.CreateRecoveryEmailToken(ctx, token); err != nil {
+		return err
+	}
+
+	data, err := recoveryEmailData(s.cfg.Auth.RecoveryEmailURL, value, ttl)
+	if err != nil {
+		return err
+	}
+	_, err = s.mail.Send(ctx, userEmailRequest(ctx, user.ID, email, user.Name, user.Locale, notification.EmailRecoveryVerification, data))
+	return err
+}
+
+// VerifyRecoveryEmail sets the recovery email of a verification link's token
+// and returns the user it belongs to
+func (s *authService) VerifyRecoveryEmail(ctx context.Context, verificationToken string) (string, error) {
+	token, err := s.repo.GetRecoveryEmailTokenByHash(ctx, hashSecret(verificationToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrRecoveryEmailTokenNotFound) {
+			return "", ErrInvalidRecoveryEmailToken
+		}
+		return "", err
+	}
+	if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return "", ErrInvalidRecoveryEmailToken
+	}
+
+	err = s.repo.VerifyRecoveryEmail(ctx, token)
+	if errors.Is(err, repository.ErrRecoveryEmailTokenUsed) || errors.Is(err, repository.ErrUserNotFound) {
+		return "", ErrInvalidRecoveryEmailToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.Info("Recovery email verified", zap.String("user_id", token.UserID))
+	return token.UserID, nil
+}
+
+// newBackupCodes generates a set of backup codes and their stored form.
+// Codes are shown as two groups of five characters, e.g. "k7m2p-xq9rt".
+func newBackupCodes(userID string) ([]string, []*repository.BackupCode, error) {
+	codes := make([]string, backupCodeCount)
+	stored := make([]*repository.BackupCode, backupCodeCount)
+	alphabetSize := big.NewInt(int64(len(backupCodeAlphabet)))
+	for i := range codes {
+		raw := make([]byte, backupCodeLength)
+		for j := range raw {
+			n, err := rand.Int(rand.Reader, alphabetSize)
+			if err != nil {
+				return nil, nil, err
+			}
+			raw[j] = backupCodeAlphabet[n.Int64()]
+		}
+		code := string(raw)
+
+		codes[i] = code[:backupCodeLength/2] + "-" + code[backupCodeLength/2:]
+		stored[i] = &repository.BackupCode{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			CodeHash:  hashSecret(code),
+			CreatedAt: time.Now(),
+		}
+	}
+	return codes, stored, nil
+}
+
+// normalizeBackupCode removes the separators and case users may type a backup code with
+func normalizeBackupCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// isBackupCode reports whether a code entered at login is a backup code
+// rather than one of the authenticator app, which are 6 digits
+func isBackupCode(code string) bool {
+	return len(normalizeBackupCode(code)) == backupCodeLength
+}
+
+// recoveryEmailData returns the template data of a recovery email
+// verification linking to verifyURL with the token
+func recoveryEmailData(verifyURL, value string, ttl time.Duration) (map[string]interface{}, error) {
+	link, err := url.Parse(verifyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recovery email URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", value)
+	link.RawQuery = query.Encode()
+
+	return map[string]interface{}{
+		"verification_url": link.String(),
+		"expires_in":       formatExpiry(ttl),
+	}, nil
+}
+
+// newRecoveryEmailToken generates a recovery email token and its stored form
+func newRecoveryEmailToken(userID, email string, ttl time.Duration) (string, *repository.RecoveryEmailToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	value := base64.RawURLEncoding.EncodeToString(raw)
+
+	return value, &repository.RecoveryEmailToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Email:     email,
+		TokenHash: hashSecret(value),
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}, nil
+}
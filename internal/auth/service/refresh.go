@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	eventspb "github.com/linkeunid/hello-go/api/gen/events"
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/events"
+)
+
+// Refresh token errors, their messages are returned to clients
+var (
+	ErrInvalidRefreshToken = apperrors.Unauthenticated("invalid refresh token")
+	ErrRefreshTokenReused  = apperrors.Unauthenticated("refresh token was already used, the session has been revoked")
+)
+
+// EventRefreshTokenReused is published when a rotated refresh token is presented again,
+// with an eventspb.RefreshTokenReused payload
+const EventRefreshTokenReused = "auth.refresh_token_reused"
+
+// RefreshedSession is a session continued with a new refresh token
+type RefreshedSession struct {
+	UserID string
+	// ClientType is the client type the session was started with
+	ClientType string
+	// Scope is the scopes the session's tokens are restricted to, empty for none
+	Scope string
+	// AuthenticatedAt is when the user logged in, zero if unknown
+	AuthenticatedAt time.Time
+	RefreshToken    string
+}
+
+// IssueRefreshToken starts a new token family for a user of a client type, e.g.
+// on login. scope restricts the family's access tokens, empty for none.
+func (s *authService) IssueRefreshToken(ctx context.Context, userID, clientType, scope string) (string, error) {
+	s.logger.Debug("Issuing refresh token",
+		zap.String("user_id", userID),
+		zap.String("client_type", clientType),
+		zap.String("scope", scope))
+
+	value, token, err := newRefreshToken(userID, "", clientType, s.cfg.Auth.RefreshTokenExpiration)
+	if err != nil {
+		s.logger.Error("Failed to generate refresh token", zap.Error(err))
+		return "", err
+	}
+	token.Scope = scope
+
+	if err := s.repo.CreateRefreshToken(ctx, token); err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// RefreshSession exchanges a refresh token for a new one and returns the session it continues.
+//
+// Each token can be used once. Presenting a token that was already rotated means
+// it was copied, by an attacker or from a client that lost the new one, so the
+// whole family is revoked and a security event is raised.
+func (s *authService) RefreshSession(ctx context.Context, refreshToken string) (*RefreshedSession, error) {
+	token, err := s.repo.GetRefreshTokenByHash(ctx, hashSecret(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	s.logger.Debug("Refreshing session",
+		zap.String("user_id", token.UserID),
+		zap.String("family_id", token.FamilyID))
+
+	if token.Rotated() {
+		return nil, s.handleReuse(ctx, token)
+	}
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Sessions end when the account is no longer active
+	user, err := s.repo.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if user.Status != repository.StatusActive {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	value, replacement, err := newRefreshToken(token.UserID, token.FamilyID, token.ClientType, s.cfg.Auth.RefreshTokenExpiration)
+	if err != nil {
+		s.logger.Error("Failed to generate refresh token", zap.Error(err))
+		return nil, err
+	}
+	replacement.AuthenticatedAt = token.AuthenticatedAt
+	replacement.Scope = token.Scope
+
+	if err := s.repo.RotateRefreshToken(ctx, token.ID, replacement); err != nil {
+		// Another request rotated the token first, which is a reuse as well
+		if errors.Is(err, repository.ErrRefreshTokenRotated) {
+			return nil, s.handleReuse(ctx, token)
+		}
+		return nil, err
+	}
+
+	return refreshedSession(token, value), nil
+}
+
+// EndSession revokes the token family of a user's refresh token, e.g. on logout.
+// Tokens of other users are rejected like unknown ones.
+func (s *authService) EndSession(ctx context.Context, userID, refreshToken string) error {
+	token, err := s.repo.GetRefreshTokenByHash(ctx, hashSecret(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+	if token.UserID != userID {
+		return ErrInvalidRefreshToken
+	}
+
+	revoked, err := s.repo.RevokeRefreshTokenFamily(ctx, token.FamilyID)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Debug("Session ended",
+		zap.String("user_id", userID),
+		zap.String("family_id", token.FamilyID),
+		zap.Int64("revoked", revoked))
+	return nil
+}
+
+// handleReuse revokes the family of a reused token and publishes a security event
+func (s *authService) handleReuse(ctx context.Context, token *repository.RefreshToken) error {
+	revoked, err := s.repo.RevokeRefreshTokenFamily(ctx, token.FamilyID)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Warn("Refresh token reuse detected, session revoked",
+		zap.String("user_id", token.UserID),
+		zap.String("family_id", token.FamilyID),
+		zap.String("token_id", token.ID),
+		zap.Int64("revoked", revoked))
+
+	publishUserEvent(ctx, s.events, s.logger, EventRefreshTokenReused, token.UserID, &eventspb.RefreshTokenReused{
+		UserId:   token.UserID,
+		FamilyId: token.FamilyID,
+		TokenId:  token.ID,
+		Revoked:  revoked,
+	})
+
+	return ErrRefreshTokenReused
+}
+
+// newRefreshToken generates a refresh token of the given family, or starts a new
+// family whose ID is the token's ID if familyID is empty, so logins can be told
+// apart from refreshes. It returns the token value for the client and the record to store.
+func newRefreshToken(userID, familyID, clientType string, ttl time.Duration) (string, *repository.RefreshToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	value := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	token := &repository.RefreshToken{
+		ID:         uuid.New().String(),
+		FamilyID:   familyID,
+		UserID:     userID,
+		ClientType: clientType,
+		TokenHash:  hashSecret(value),
+		ExpiresAt:  now.Add(ttl),
+		CreatedAt:  now,
+	}
+	// A new family starts with a login
+	if familyID == "" {
+		token.FamilyID = token.ID
+		token.AuthenticatedAt = &now
+	}
+
+	return value, token, nil
+}
+
+// refreshedSession returns the session continued by a rotated token with the value of its replacement
+func refreshedSession(token *repository.RefreshToken, value string) *RefreshedSession {
+	session := &RefreshedSession{
+		UserID:       token.UserID,
+		ClientType:   token.ClientType,
+		Scope:        token.Scope,
+		RefreshToken: value,
+	}
+	if token.AuthenticatedAt != nil {
+		session.AuthenticatedAt = *token.AuthenticatedAt
+	}
+	return session
+}
+
+// publishUserEvent publishes an event about a user. Failures are logged rather
+// than returned, the request itself was handled.
+func publishUserEvent(ctx context.Context, publisher events.Publisher, logger *zap.Logger, eventType, userID string, data proto.Message) {
+	event, err := events.NewMessage(eventType, "auth", userID, data)
+	if err == nil {
+		err = publisher.Publish(ctx, event)
+	}
+	if err != nil {
+		logger.Error("Failed to publish user event",
+			zap.String("type", eventType),
+			zap.String("user_id", userID),
+			zap.Error(err))
+	}
+}
@@ -3,43 +3,236 @@ package service
 import (
 	"context"
 	"errors"
+	"time"
 
 	"go.uber.org/zap"
 
+	eventspb "github.com/linkeunid/hello-go/api/gen/events"
 	"github.com/linkeunid/hello-go/internal/auth/repository"
+	"github.com/linkeunid/hello-go/pkg/cache"
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/events"
+	"github.com/linkeunid/hello-go/pkg/jobs"
+	"github.com/linkeunid/hello-go/pkg/mail"
+	"github.com/linkeunid/hello-go/pkg/metering"
+	"github.com/linkeunid/hello-go/pkg/notification"
+	"github.com/linkeunid/hello-go/pkg/operations"
+	"github.com/linkeunid/hello-go/pkg/revocation"
+	"github.com/linkeunid/hello-go/pkg/webauthn"
 )
 
-// Common errors
+// Common errors, their messages are returned to clients
 var (
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrUserAlreadyExists  = errors.New("user already exists")
-	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidCredentials    = apperrors.Unauthenticated("invalid credentials")
+	ErrUserAlreadyExists     = apperrors.AlreadyExists("user already exists")
+	ErrUserNotFound          = apperrors.NotFound("user not found")
+	ErrRegistrationClosed    = apperrors.PermissionDenied("registration is disabled")
+	ErrAccountPending        = apperrors.FailedPrecondition("account is pending admin approval")
+	ErrAccountRejected       = apperrors.PermissionDenied("account registration was rejected")
+	ErrNotPending            = apperrors.NotFound("no pending registration for user")
+	ErrAccountSuspended      = apperrors.PermissionDenied("account is suspended")
+	ErrPasswordResetRequired = apperrors.FailedPrecondition("password reset required")
 )
 
+// Registration represents a user account and its approval status
+type Registration struct {
+	UserID    string
+	Email     string
+	Name      string
+	Status    string
+	CreatedAt time.Time
+}
+
+// EventUserRegistered is published when a user signed up, including registrations
+// pending approval, with an eventspb.UserRegistered payload
+const EventUserRegistered = "auth.user_registered"
+
+// EventEmailChanged is published when a user's login email changed, with an
+// eventspb.EmailChanged payload. Emails are still changed with the user service,
+// the type is reserved for consumers to handle once they move here.
+const EventEmailChanged = "auth.email_changed"
+
 // AuthService defines the interface for auth service operations
 type AuthService interface {
 	// Authenticate authenticates a user with email and password
 	Authenticate(ctx context.Context, email, password string) (string, error)
-	// Register creates a new user
-	Register(ctx context.Context, email, password, name string) (string, error)
+	// Register creates a new user, pending approval if the registration mode requires it
+	Register(ctx context.Context, email, password, name string) (*Registration, error)
+	// CheckEmailAvailability reports whether no user has the email yet
+	CheckEmailAvailability(ctx context.Context, email string) (bool, error)
 	// ValidateToken validates a token and returns the user ID
 	ValidateToken(ctx context.Context, token string) (string, error)
+	// CreateInvite invites an email to register and emails it the invite link
+	CreateInvite(ctx context.Context, adminID, email string) (*Invite, error)
+	// AcceptInvite creates the active account of an invited email with the invite's code
+	AcceptInvite(ctx context.Context, code, password, name string) (*Registration, error)
+	// ListPendingRegistrations returns the registrations waiting for approval
+	ListPendingRegistrations(ctx context.Context, page, pageSize int) ([]*Registration, int, error)
+	// ApproveRegistration activates a pending account
+	ApproveRegistration(ctx context.Context, userID string) error
+	// RejectRegistration rejects a pending account
+	RejectRegistration(ctx context.Context, userID string) error
+	// ListUsersForAdmin returns a page of users matching the filter with their session stats and counts
+	ListUsersForAdmin(ctx context.Context, filter UserFilter, page, pageSize int) ([]*AdminUser, int, *UserCounts, error)
+	// GetUserForAdmin returns a user with their recent sessions and activity
+	GetUserForAdmin(ctx context.Context, userID string) (*AdminUserDetail, error)
+	// AddUserTags tags a user and returns the user with all their tags
+	AddUserTags(ctx context.Context, userID string, tags []string, createdBy string) (*AdminUser, error)
+	// RemoveUserTag removes a tag from a user and returns the user with their remaining tags
+	RemoveUserTag(ctx context.Context, userID, tag string) (*AdminUser, error)
+	// SyncOrganizationMembers reconciles an organization's members with a desired list
+	SyncOrganizationMembers(ctx context.Context, organizationID string, members []OrganizationMember, dryRun bool) (*MembershipSync, error)
+	// ListSegments returns every segment by name
+	ListSegments(ctx context.Context) ([]*Segment, error)
+	// CreateSegment saves a new segment
+	CreateSegment(ctx context.Context, segment *Segment, createdBy string) (*Segment, error)
+	// UpdateSegment replaces the description and filter of a segment
+	UpdateSegment(ctx context.Context, segment *Segment) (*Segment, error)
+	// DeleteSegment deletes a segment
+	DeleteSegment(ctx context.Context, name string) error
+	// StartBulkOperation applies a bulk action to the target users as a long-running operation
+	StartBulkOperation(ctx context.Context, action string, target BulkTarget, createdBy string) (*operations.Operation, error)
+	// Operations returns the manager of the service's long-running operations
+	Operations() *operations.Manager
+	// Jobs returns the service's background job queue
+	Jobs() *jobs.Queue
+	// Meter returns the service's usage meter
+	Meter() *metering.Meter
+	// Revocations returns the store of logged out tokens
+	Revocations() revocation.Store
+	// Templates returns the email and webhook templates
+	Templates() *notification.Templates
+	// Mail returns the dispatcher of transactional emails
+	Mail() *mail.Dispatcher
+	// SendUserEmail sends an email to a user in their locale, falling back to the request's locales
+	SendUserEmail(ctx context.Context, userID, template string, data map[string]interface{}) (*mail.Message, error)
+	// IsAdmin checks if a user has the admin role
+	IsAdmin(ctx context.Context, userID string) (bool, error)
+	// CreateServiceAccount creates a service account and returns it with its client secret
+	CreateServiceAccount(ctx context.Context, name string, scopes []string, createdBy string) (*ServiceAccount, string, error)
+	// IssueRefreshToken starts a new refresh token family for a user of a client
+	// type, whose access tokens are restricted to scope unless it's empty
+	IssueRefreshToken(ctx context.Context, userID, clientType, scope string) (string, error)
+	// RefreshSession exchanges a refresh token for a new one and returns the session it continues
+	RefreshSession(ctx context.Context, refreshToken string) (*RefreshedSession, error)
+	// TokenLifetime returns the lifetime of an access token for a user of a client type
+	TokenLifetime(ctx context.Context, userID, clientType string, requested time.Duration) (time.Duration, error)
+	// EndSession revokes the token family of a user's refresh token
+	EndSession(ctx context.Context, userID, refreshToken string) error
+	// EnrollTOTP starts enrolling an authenticator app for a user
+	EnrollTOTP(ctx context.Context, userID string) (*TOTPEnrollment, error)
+	// ConfirmTOTP confirms a pending authenticator app with a code, enabling MFA, and returns the user's backup codes
+	ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error)
+	// RegenerateBackupCodes replaces the backup codes of a user with MFA and returns the new ones
+	RegenerateBackupCodes(ctx context.Context, userID string) ([]string, error)
+	// StartMFAChallenge starts the second step of a login, it returns an empty token for users without MFA
+	StartMFAChallenge(ctx context.Context, userID, clientType, scope string, expiresIn time.Duration) (string, error)
+	// CompleteMFAChallenge checks the code for a login's challenge and returns the login
+	CompleteMFAChallenge(ctx context.Context, challengeToken, code string) (*MFALogin, error)
+	// BeginWebAuthnRegistration starts registering a passkey or security key for a user
+	BeginWebAuthnRegistration(ctx context.Context, userID string) (*WebAuthnRegistrationOptions, error)
+	// FinishWebAuthnRegistration verifies the authenticator's response to a registration and stores the credential
+	FinishWebAuthnRegistration(ctx context.Context, userID, sessionID string, registration *WebAuthnRegistration) (*WebAuthnCredential, error)
+	// BeginWebAuthnLogin starts a login with a passkey or security key, email may be empty
+	BeginWebAuthnLogin(ctx context.Context, email string) (*WebAuthnLoginOptions, error)
+	// FinishWebAuthnLogin verifies the authenticator's response to a login and returns the user it logs in
+	FinishWebAuthnLogin(ctx context.Context, sessionID string, assertion *WebAuthnAssertion) (*WebAuthnLogin, error)
+	// TokensValidAfter returns the time before which a user's access tokens are rejected, zero if none are
+	TokensValidAfter(ctx context.Context, userID string) (time.Time, error)
+	// InvalidateAllSessions ends every session of a user and returns how many refresh tokens were revoked
+	InvalidateAllSessions(ctx context.Context, userID string) (int64, error)
+	// Impersonate checks that an admin may act as a user and records it in the audit log
+	Impersonate(ctx context.Context, adminID, userID, reason string) (*Impersonation, error)
+	// RecordLogin adds a login attempt to its user's login history, attempts on unknown accounts are ignored
+	RecordLogin(ctx context.Context, attempt *LoginAttempt) error
+	// GetLoginHistory returns a page of a user's login attempts, newest first
+	GetLoginHistory(ctx context.Context, userID string, page, pageSize int) ([]*LoginHistoryEntry, int, error)
+	// RequestPasswordReset emails a password reset link to the users with the given email or recovery email, if any
+	RequestPasswordReset(ctx context.Context, email string) error
+	// ConfirmPasswordReset sets a new password with a reset token, ends the user's sessions and returns the user ID
+	ConfirmPasswordReset(ctx context.Context, resetToken, newPassword string) (string, error)
+	// SetRecoveryEmail emails a verification link to a user's new recovery email, an empty email removes it
+	SetRecoveryEmail(ctx context.Context, userID, email string) error
+	// VerifyRecoveryEmail sets the recovery email of a verification token and returns the user ID
+	VerifyRecoveryEmail(ctx context.Context, verificationToken string) (string, error)
+	// AuthenticateClient verifies a client's credentials and returns its service account with the granted scopes
+	AuthenticateClient(ctx context.Context, clientID, clientSecret string, scopes []string) (*ServiceAccount, error)
+	// Ping checks the service's storage
+	Ping(ctx context.Context) error
 }
 
 // authService implements the AuthService interface
 type authService struct {
-	cfg    *config.Config
-	repo   repository.AuthRepository
+	cfg        *config.Config
+	repo       repository.AuthRepository
+	events     events.Publisher
+	operations *operations.Manager
+	jobs       *jobs.Queue
+	meter      *metering.Meter
+	revoked    revocation.Store
+	templates  *notification.Templates
+	mail       *mail.Dispatcher
+	// relyingParty verifies passkey registrations and logins
+	relyingParty *webauthn.RelyingParty
+	// counts caches the user counts of admin lists by column and filter
+	counts *cache.Cache[string, map[string]int]
 	logger *zap.Logger
 }
 
 // NewAuthService creates a new auth service
 func NewAuthService(cfg *config.Config, logger *zap.Logger) AuthService {
+	repo := repository.NewAuthRepository(cfg, logger.Named("auth_repository"))
+
+	publisher, err := events.NewPublisher(cfg, repo.DB(), logger.Named("events"))
+	if err != nil {
+		logger.Fatal("Failed to create event publisher", zap.Error(err))
+	}
+
+	operationManager, err := operations.NewManager(repo.DB(), logger.Named("operations"))
+	if err != nil {
+		logger.Fatal("Failed to create operation manager", zap.Error(err))
+	}
+
+	queue, err := jobs.NewQueue(cfg, repo.DB(), logger.Named("jobs"))
+	if err != nil {
+		logger.Fatal("Failed to create job queue", zap.Error(err))
+	}
+
+	meter, err := metering.NewMeter(cfg, repo.DB(), "auth", logger.Named("metering"))
+	if err != nil {
+		logger.Fatal("Failed to create usage meter", zap.Error(err))
+	}
+
+	revoked, err := revocation.NewStore(cfg, repo.DB(), logger.Named("revocation"))
+	if err != nil {
+		logger.Fatal("Failed to create token revocation store", zap.Error(err))
+	}
+
+	templates, err := notification.NewTemplates(repo.DB(), logger.Named("templates"))
+	if err != nil {
+		logger.Fatal("Failed to create notification templates", zap.Error(err))
+	}
+
+	dispatcher, err := mail.NewDispatcher(cfg, repo.DB(), templates, queue, logger.Named("mail"))
+	if err != nil {
+		logger.Fatal("Failed to create mail dispatcher", zap.Error(err))
+	}
+
 	return &authService{
-		cfg:    cfg,
-		repo:   repository.NewAuthRepository(cfg, logger.Named("auth_repository")),
-		logger: logger,
+		cfg:          cfg,
+		repo:         repo,
+		events:       publisher,
+		operations:   operationManager,
+		jobs:         queue,
+		meter:        meter,
+		revoked:      revoked,
+		templates:    templates,
+		mail:         dispatcher,
+		relyingParty: webauthn.NewRelyingParty(cfg),
+		counts:       cache.New[string, map[string]int]("counts", cfg.LocalCache.Counts),
+		logger:       logger,
 	}
 }
 
@@ -57,13 +250,36 @@ func (s *authService) Authenticate(ctx context.Context, email, password string)
 	}
 
 	// Verify password
-	if err := s.repo.CheckPassword(user.Password, password); err != nil {
+	rehash, err := s.repo.CheckPassword(user.Password, password)
+	if err != nil {
 		s.logger.Debug("Password verification failed",
 			zap.String("email", email),
 			zap.Error(err))
 		return "", ErrInvalidCredentials
 	}
 
+	// Upgrade hashes of an older algorithm or parameters while the password is at hand
+	if rehash {
+		if err := s.repo.RehashPassword(ctx, user.ID, user.Password, password); err != nil {
+			s.logger.Warn("Failed to rehash password",
+				zap.String("user_id", user.ID),
+				zap.Error(err))
+		}
+	}
+
+	// Only report the account status once the password is verified
+	switch user.Status {
+	case repository.StatusPending:
+		return "", ErrAccountPending
+	case repository.StatusRejected:
+		return "", ErrAccountRejected
+	case repository.StatusSuspended:
+		return "", ErrAccountSuspended
+	}
+	if user.PasswordResetRequired {
+		return "", ErrPasswordResetRequired
+	}
+
 	s.logger.Debug("User authenticated successfully",
 		zap.String("email", email),
 		zap.String("user_id", user.ID))
@@ -71,41 +287,164 @@ func (s *authService) Authenticate(ctx context.Context, email, password string)
 	return user.ID, nil
 }
 
-// Register creates a new user
-func (s *authService) Register(ctx context.Context, email, password, name string) (string, error) {
+// Register creates a new user, pending approval if the registration mode requires it
+func (s *authService) Register(ctx context.Context, email, password, name string) (*Registration, error) {
 	s.logger.Debug("Registering new user",
 		zap.String("email", email),
 		zap.String("name", name))
 
+	// Determine the initial account status
+	accountStatus := repository.StatusActive
+	switch s.cfg.Auth.RegistrationMode {
+	case config.RegistrationClosed:
+		return nil, ErrRegistrationClosed
+	case config.RegistrationInvite:
+		return nil, ErrInviteRequired
+	case config.RegistrationApproval:
+		accountStatus = repository.StatusPending
+	}
+
+	// Validate every field before touching the database
+	if err := validateRegistration(email, password, name); err != nil {
+		return nil, err
+	}
+
 	// Check if user already exists
 	exists, err := s.repo.UserExists(ctx, email)
 	if err != nil {
 		s.logger.Error("Error checking if user exists",
 			zap.String("email", email),
 			zap.Error(err))
-		return "", err
+		return nil, err
 	}
 
 	if exists {
 		s.logger.Debug("User already exists during registration",
 			zap.String("email", email))
-		return "", ErrUserAlreadyExists
+		return nil, ErrUserAlreadyExists
 	}
 
 	// Create user (password hashing is handled in the repository)
-	userID, err := s.repo.CreateUser(ctx, email, password, name)
+	userID, err := s.repo.CreateUser(ctx, email, password, name, accountStatus)
 	if err != nil {
 		s.logger.Error("Error creating user",
 			zap.String("email", email),
 			zap.Error(err))
-		return "", err
+		return nil, err
 	}
 
 	s.logger.Debug("User registered successfully",
 		zap.String("email", email),
-		zap.String("user_id", userID))
+		zap.String("user_id", userID),
+		zap.String("status", accountStatus))
+
+	publishUserEvent(ctx, s.events, s.logger, EventUserRegistered, userID, &eventspb.UserRegistered{
+		UserId:   userID,
+		Email:    email,
+		Name:     name,
+		Role:     repository.RoleUser,
+		Status:   accountStatus,
+		TenantId: database.TenantOrDefault(ctx),
+	})
+
+	return &Registration{
+		UserID:    userID,
+		Email:     email,
+		Name:      name,
+		Status:    accountStatus,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// CheckEmailAvailability reports whether no user of the tenant has the email yet
+func (s *authService) CheckEmailAvailability(ctx context.Context, email string) (bool, error) {
+	if err := validateEmailCheck(email); err != nil {
+		return false, err
+	}
+
+	exists, err := s.repo.UserExists(ctx, email)
+	if err != nil {
+		s.logger.Error("Error checking email availability", zap.Error(err))
+		return false, err
+	}
+	return !exists, nil
+}
+
+// ListPendingRegistrations returns the registrations waiting for approval
+func (s *authService) ListPendingRegistrations(ctx context.Context, page, pageSize int) ([]*Registration, int, error) {
+	// Validate page and pageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	s.logger.Debug("Listing pending registrations",
+		zap.Int("page", page),
+		zap.Int("page_size", pageSize))
+
+	users, total, err := s.repo.ListUsersByStatus(ctx, repository.StatusPending, page, pageSize)
+	if err != nil {
+		s.logger.Error("Error listing pending registrations", zap.Error(err))
+		return nil, 0, err
+	}
+
+	// Map to service layer registrations
+	result := make([]*Registration, len(users))
+	for i, user := range users {
+		result[i] = &Registration{
+			UserID:    user.ID,
+			Email:     user.Email,
+			Name:      user.Name,
+			Status:    user.Status,
+			CreatedAt: user.CreatedAt,
+		}
+	}
+
+	return result, total, nil
+}
+
+// ApproveRegistration activates a pending account
+func (s *authService) ApproveRegistration(ctx context.Context, userID string) error {
+	return s.reviewRegistration(ctx, userID, repository.StatusActive)
+}
+
+// RejectRegistration rejects a pending account
+func (s *authService) RejectRegistration(ctx context.Context, userID string) error {
+	return s.reviewRegistration(ctx, userID, repository.StatusRejected)
+}
+
+// reviewRegistration moves a pending account to the given status
+func (s *authService) reviewRegistration(ctx context.Context, userID, accountStatus string) error {
+	s.logger.Debug("Reviewing registration",
+		zap.String("user_id", userID),
+		zap.String("status", accountStatus))
+
+	if err := s.repo.UpdateStatus(ctx, userID, repository.StatusPending, accountStatus); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrNotPending
+		}
+		s.logger.Error("Error updating registration status",
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return err
+	}
 
-	return userID, nil
+	return nil
+}
+
+// IsAdmin checks if a user has the admin role
+func (s *authService) IsAdmin(ctx context.Context, userID string) (bool, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return user.Role == repository.RoleAdmin && user.Status == repository.StatusActive, nil
 }
 
 // ValidateToken validates a token and returns the user ID
@@ -113,3 +452,38 @@ func (s *authService) ValidateToken(ctx context.Context, token string) (string,
 	// This is handled in the server layer already, but we could add more logic here
 	return "", nil
 }
+
+// Operations returns the manager of the service's long-running operations
+func (s *authService) Operations() *operations.Manager {
+	return s.operations
+}
+
+// Jobs returns the service's background job queue
+func (s *authService) Jobs() *jobs.Queue {
+	return s.jobs
+}
+
+// Meter returns the service's usage meter
+func (s *authService) Meter() *metering.Meter {
+	return s.meter
+}
+
+// Revocations returns the store of logged out tokens
+func (s *authService) Revocations() revocation.Store {
+	return s.revoked
+}
+
+// Templates returns the email and webhook templates
+func (s *authService) Templates() *notification.Templates {
+	return s.templates
+}
+
+// Mail returns the dispatcher of transactional emails
+func (s *authService) Mail() *mail.Dispatcher {
+	return s.mail
+}
+
+// Ping checks the service's storage
+func (s *authService) Ping(ctx context.Context) error {
+	return s.repo.Ping(ctx)
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	eventspb "github.com/linkeunid/hello-go/api/gen/events"
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	"github.com/linkeunid/hello-go/pkg/revocation"
+)
+
+// EventSessionsInvalidated is published when all of a user's sessions were ended at once,
+// with an eventspb.SessionsInvalidated payload
+const EventSessionsInvalidated = "auth.sessions_invalidated"
+
+// TokensValidAfter returns the time before which a user's access tokens are
+// rejected, zero if none are. Service accounts and unknown users have none.
+func (s *authService) TokensValidAfter(ctx context.Context, userID string) (time.Time, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+
+	if user.TokensValidAfter == nil {
+		return time.Time{}, nil
+	}
+	return *user.TokensValidAfter, nil
+}
+
+// InvalidateAllSessions ends every session of a user: access tokens issued
+// until now are rejected and refresh tokens are revoked. The user has to log
+// in again on every device.
+func (s *authService) InvalidateAllSessions(ctx context.Context, userID string) (int64, error) {
+	validAfter, revoked, err := s.invalidateSessions(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+
+	s.logger.Info("Invalidated sessions",
+		zap.String("user_id", userID),
+		zap.Int64("sessions_revoked", revoked))
+	publishUserEvent(ctx, s.events, s.logger, EventSessionsInvalidated, userID, &eventspb.SessionsInvalidated{
+		UserId:          userID,
+		ValidAfter:      timestamppb.New(validAfter),
+		SessionsRevoked: revoked,
+	})
+	return revoked, nil
+}
+
+// invalidateSessions rejects a user's access tokens issued until now and
+// revokes their refresh tokens. It returns the cutoff and how many refresh
+// tokens were revoked.
+func (s *authService) invalidateSessions(ctx context.Context, userID string) (time.Time, int64, error) {
+	// Tokens carry their issue time in milliseconds, the cutoff is stored the same way
+	now := time.Now().Truncate(time.Millisecond)
+	revoked, err := s.repo.InvalidateSessions(ctx, userID, now)
+	if err != nil {
+		return now, revoked, err
+	}
+
+	// Services caching token validations stop trusting the user's cached
+	// tokens for as long as they cache them
+	if ttl := s.cfg.LocalCache.Tokens.TTL; ttl > 0 {
+		if err := s.revoked.Revoke(ctx, revocation.SessionsID(userID), now.Add(ttl)); err != nil {
+			return now, revoked, fmt.Errorf("failed to mark the ended sessions: %w", err)
+		}
+	}
+	return now, revoked, nil
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	"github.com/linkeunid/hello-go/pkg/database"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// Tag and segment errors, their messages are returned to clients
+var (
+	ErrInvalidTag      = apperrors.Invalid("tags must be 1 to 50 lowercase letters, digits, '-' or '_'")
+	ErrTagNotFound     = apperrors.NotFound("user doesn't have the tag")
+	ErrInvalidSegment  = apperrors.Invalid("a segment needs a valid name, a description of at most 255 characters and at least one filter")
+	ErrSegmentNotFound = apperrors.NotFound("segment not found")
+	ErrSegmentExists   = apperrors.AlreadyExists("segment already exists")
+)
+
+// tagPattern matches tag and segment names such as "beta-testers"
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// Segment is a saved user filter, usable wherever admins filter users
+type Segment struct {
+	Name        string
+	Description string
+	// Filter selects the users of the segment, segments can't refer to other segments
+	Filter    UserFilter
+	CreatedBy string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// empty reports whether the filter matches every user
+func (f UserFilter) empty() bool {
+	return f.Status == "" && f.Role == "" && f.Query == "" && len(f.Tags) == 0 && f.Segment == ""
+}
+
+// merge combines the filter with the filter of its segment. The filter's own
+// status, role and query take precedence, the tags of both are required.
+func (f UserFilter) merge(segment UserFilter) UserFilter {
+	if f.Status == "" {
+		f.Status = segment.Status
+	}
+	if f.Role == "" {
+		f.Role = segment.Role
+	}
+	if f.Query == "" {
+		f.Query = segment.Query
+	}
+	f.Tags, _ = normalizeTags(append(append([]string(nil), segment.Tags...), f.Tags...))
+	f.Segment = ""
+	return f
+}
+
+// normalizeTags lowercases, deduplicates and sorts tags
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return nil, ErrInvalidTag
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// normalizeSegment validates a segment and normalizes its tags
+func normalizeSegment(segment *Segment) (*Segment, error) {
+	normalized := *segment
+	normalized.Filter.Segment = ""
+	if !tagPattern.MatchString(normalized.Name) || len(normalized.Description) > 255 ||
+		len(normalized.Filter.Query) > 100 || normalized.Filter.empty() {
+		return nil, ErrInvalidSegment
+	}
+
+	tags, err := normalizeTags(normalized.Filter.Tags)
+	if err != nil {
+		return nil, err
+	}
+	normalized.Filter.Tags = tags
+	return &normalized, nil
+}
+
+// resolveFilter validates a filter and combines it with its segment, if any
+func (s *authService) resolveFilter(ctx context.Context, filter UserFilter) (repository.UserFilter, error) {
+	tags, err := normalizeTags(filter.Tags)
+	if err != nil {
+		return repository.UserFilter{}, err
+	}
+	filter.Tags = tags
+
+	if filter.Segment != "" {
+		segment, err := s.repo.GetSegment(ctx, filter.Segment)
+		if err != nil {
+			if errors.Is(err, repository.ErrSegmentNotFound) {
+				return repository.UserFilter{}, ErrSegmentNotFound
+			}
+			return repository.UserFilter{}, err
+		}
+		filter = filter.merge(toSegment(segment).Filter)
+	}
+
+	return repository.UserFilter{
+		Status: filter.Status,
+		Role:   filter.Role,
+		Query:  filter.Query,
+		Tags:   filter.Tags,
+	}, nil
+}
+
+// AddUserTags tags a user and returns the user with all their tags
+func (s *authService) AddUserTags(ctx context.Context, userID string, tags []string, createdBy string) (*AdminUser, error) {
+	s.logger.Debug("Adding user tags",
+		zap.String("user_id", userID),
+		zap.Strings("tags", tags),
+		zap.String("created_by", createdBy))
+
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, ErrInvalidTag
+	}
+
+	if err := s.repo.AddUserTags(ctx, userID, tags, createdBy); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		s.logger.Error("Error adding user tags", zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	return s.getAdminUser(ctx, userID)
+}
+
+// RemoveUserTag removes a tag from a user and returns the user with their remaining tags
+func (s *authService) RemoveUserTag(ctx context.Context, userID, tag string) (*AdminUser, error) {
+	s.logger.Debug("Removing user tag",
+		zap.String("user_id", userID),
+		zap.String("tag", tag))
+
+	if err := s.repo.RemoveUserTag(ctx, userID, strings.ToLower(tag)); err != nil {
+		if errors.Is(err, repository.ErrTagNotFound) {
+			return nil, ErrTagNotFound
+		}
+		s.logger.Error("Error removing user tag", zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	return s.getAdminUser(ctx, userID)
+}
+
+// ListSegments returns every segment by name
+func (s *authService) ListSegments(ctx context.Context) ([]*Segment, error) {
+	s.logger.Debug("Listing segments")
+
+	segments, err := s.repo.ListSegments(ctx)
+	if err != nil {
+		s.logger.Error("Error listing segments", zap.Error(err))
+		return nil, err
+	}
+
+	result := make([]*Segment, len(segments))
+	for i, segment := range segments {
+		result[i] = toSegment(segment)
+	}
+	return result, nil
+}
+
+// CreateSegment saves a new segment
+func (s *authService) CreateSegment(ctx context.Context, segment *Segment, createdBy string) (*Segment, error) {
+	s.logger.Debug("Creating segment",
+		zap.String("name", segment.Name),
+		zap.String("created_by", createdBy))
+
+	segment, err := normalizeSegment(segment)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	record := fromSegment(segment)
+	record.ID = uuid.New().String()
+	record.CreatedBy = createdBy
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	if err := s.repo.CreateSegment(ctx, record); err != nil {
+		if errors.Is(err, database.ErrDuplicate) {
+			return nil, ErrSegmentExists
+		}
+		s.logger.Error("Error creating segment", zap.String("name", segment.Name), zap.Error(err))
+		return nil, err
+	}
+
+	return toSegment(record), nil
+}
+
+// UpdateSegment replaces the description and filter of a segment
+func (s *authService) UpdateSegment(ctx context.Context, segment *Segment) (*Segment, error) {
+	s.logger.Debug("Updating segment", zap.String("name", segment.Name))
+
+	segment, err := normalizeSegment(segment)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateSegment(ctx, fromSegment(segment)); err != nil {
+		if errors.Is(err, repository.ErrSegmentNotFound) {
+			return nil, ErrSegmentNotFound
+		}
+		s.logger.Error("Error updating segment", zap.String("name", segment.Name), zap.Error(err))
+		return nil, err
+	}
+
+	updated, err := s.repo.GetSegment(ctx, segment.Name)
+	if err != nil {
+		s.logger.Error("Error getting segment", zap.String("name", segment.Name), zap.Error(err))
+		return nil, err
+	}
+	return toSegment(updated), nil
+}
+
+// DeleteSegment deletes a segment, the users it selected are unaffected
+func (s *authService) DeleteSegment(ctx context.Context, name string) error {
+	s.logger.Debug("Deleting segment", zap.String("name", name))
+
+	if err := s.repo.DeleteSegment(ctx, name); err != nil {
+		if errors.Is(err, repository.ErrSegmentNotFound) {
+			return ErrSegmentNotFound
+		}
+		s.logger.Error("Error deleting segment", zap.String("name", name), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// toSegment maps a stored segment to a segment
+func toSegment(segment *repository.Segment) *Segment {
+	filter := segment.Filter()
+	return &Segment{
+		Name:        segment.Name,
+		Description: segment.Description,
+		Filter: UserFilter{
+			Status: filter.Status,
+			Role:   filter.Role,
+			Query:  filter.Query,
+			Tags:   filter.Tags,
+		},
+		CreatedBy: segment.CreatedBy,
+		CreatedAt: segment.CreatedAt,
+		UpdatedAt: segment.UpdatedAt,
+	}
+}
+
+// fromSegment maps a segment to a stored segment without ID and timestamps
+func fromSegment(segment *Segment) *repository.Segment {
+	return &repository.Segment{
+		Name:        segment.Name,
+		Description: segment.Description,
+		Status:      segment.Filter.Status,
+		Role:        segment.Filter.Role,
+		Query:       segment.Filter.Query,
+		Tags:        strings.Join(segment.Filter.Tags, " "),
+	}
+}
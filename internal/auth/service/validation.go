@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// Registration field limits
+const (
+	// minPasswordLength is the minimum number of characters of a password
+	minPasswordLength = 8
+	// maxPasswordBytes is the bcrypt input limit, longer passwords are rejected rather than truncated
+	maxPasswordBytes = 72
+	// maxEmailLength and maxNameLength are the column sizes of the users table
+	maxEmailLength = 100
+	maxNameLength  = 100
+)
+
+// validateRegistration checks every field of a registration and reports all invalid ones together
+func validateRegistration(email, password, name string) error {
+	var violations apperrors.Violations
+
+	checkEmail(&violations, "email", email)
+	checkPassword(&violations, "password", password)
+
+	switch {
+	case strings.TrimSpace(name) == "":
+		violations.Add("name", "is required")
+	case utf8.RuneCountInString(name) > maxNameLength:
+		violations.Add("name", fmt.Sprintf("must be at most %d characters", maxNameLength))
+	}
+
+	return violations.Err()
+}
+
+// validateNewPassword checks a password set on a reset
+func validateNewPassword(password string) error {
+	var violations apperrors.Violations
+	checkPassword(&violations, "new_password", password)
+	return violations.Err()
+}
+
+// validateInvite checks the email of an invite
+func validateInvite(email string) error {
+	var violations apperrors.Violations
+	checkEmail(&violations, "email", email)
+	return violations.Err()
+}
+
+// validateRecoveryEmail checks a recovery email, which must differ from the account's email
+func validateRecoveryEmail(email, accountEmail string) error {
+	var violations apperrors.Violations
+	if strings.EqualFold(email, accountEmail) {
+		violations.Add("email", "must differ from the account's email")
+	} else {
+		checkEmail(&violations, "email", email)
+	}
+	return violations.Err()
+}
+
+// validateEmailCheck checks the email of an availability check
+func validateEmailCheck(email string) error {
+	var violations apperrors.Violations
+	checkEmail(&violations, "email", email)
+	return violations.Err()
+}
+
+// checkEmail adds the violation of an email field, if any
+func checkEmail(violations *apperrors.Violations, field, email string) {
+	switch {
+	case strings.TrimSpace(email) == "":
+		violations.Add(field, "is required")
+	case !validEmail(email):
+		violations.Add(field, "must be a valid email address")
+	case len(email) > maxEmailLength:
+		violations.Add(field, fmt.Sprintf("must be at most %d characters", maxEmailLength))
+	}
+}
+
+// checkPassword adds the violation of a password field, if any
+func checkPassword(violations *apperrors.Violations, field, password string) {
+	switch {
+	case password == "":
+		violations.Add(field, "is required")
+	case utf8.RuneCountInString(password) < minPasswordLength:
+		violations.Add(field, fmt.Sprintf("must be at least %d characters", minPasswordLength))
+	case len(password) > maxPasswordBytes:
+		violations.Add(field, fmt.Sprintf("must be at most %d bytes", maxPasswordBytes))
+	}
+}
+
+// validEmail reports whether email is a bare address with a dotted domain, not "Name <address>"
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && strings.Contains(email[strings.LastIndex(email, "@"):], ".")
+}
@@ -0,0 +1,393 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/auth/repository"
+	"github.com/linkeunid/hello-go/pkg/database"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/webauthn"
+)
+
+// WebAuthn errors, their messages are returned to clients
+var (
+	ErrInvalidWebAuthnSession   = apperrors.Unauthenticated("invalid or expired WebAuthn session, start again")
+	ErrInvalidWebAuthnResponse  = apperrors.Invalid("invalid WebAuthn response")
+	ErrInvalidWebAuthnLogin     = apperrors.Unauthenticated("invalid passkey")
+	ErrWebAuthnCredentialExists = apperrors.AlreadyExists("passkey is already registered")
+)
+
+// maxWebAuthnCredentialName is the length of the longest credential name
+const maxWebAuthnCredentialName = 100
+
+// WebAuthnDescriptor identifies a credential to the browser
+type WebAuthnDescriptor struct {
+	// ID is the base64url encoded credential ID
+	ID         string
+	Transports []string
+}
+
+// WebAuthnRegistrationOptions are the options of navigator.credentials.create()
+// for registering a credential
+type WebAuthnRegistrationOptions struct {
+	// SessionID identifies the ceremony when finishing it
+	SessionID string
+	// Challenge is base64url encoded, as the user handle
+	Challenge       string
+	RPID            string
+	RPName          string
+	UserHandle      string
+	UserName        string
+	UserDisplayName string
+	// Algorithms are the COSE algorithms accepted, in order of preference
+	Algorithms []int64
+	// ExcludeCredentials are the user's credentials, an authenticator can't register twice
+	ExcludeCredentials []WebAuthnDescriptor
+	Timeout            time.Duration
+}
+
+// WebAuthnLoginOptions are the options of navigator.credentials.get() for logging in
+type WebAuthnLoginOptions struct {
+	SessionID string
+	Challenge string
+	RPID      string
+	// AllowCredentials are the credentials of the user logging in, empty to let
+	// the authenticator offer its discoverable credentials
+	AllowCredentials []WebAuthnDescriptor
+	Timeout          time.Duration
+}
+
+// WebAuthnRegistration is the response of navigator.credentials.create()
+type WebAuthnRegistration struct {
+	ClientDataJSON    []byte
+	AttestationObject []byte
+	Transports        []string
+	// Name is the user's label of the credential, e.g. "MacBook"
+	Name string
+}
+
+// WebAuthnAssertion is the response of navigator.credentials.get()
+type WebAuthnAssertion struct {
+	// CredentialID is base64url encoded
+	CredentialID      string
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	// UserHandle is set by discoverable credentials
+	UserHandle []byte
+}
+
+// WebAuthnCredential is a registered passkey or security key
+type WebAuthnCredential struct {
+	ID           string
+	CredentialID string
+	Name         string
+	CreatedAt    time.Time
+}
+
+// WebAuthnLogin is a login with a passkey or security key
+type WebAuthnLogin struct {
+	UserID string
+	// UserVerified reports whether the authenticator verified the user, making
+	// the login multi-factor
+	UserVerified bool
+}
+
+// BeginWebAuthnRegistration starts registering a passkey or security key for a user
+func (s *authService) BeginWebAuthnRegistration(ctx context.Context, userID string) (*WebAuthnRegistrationOptions, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	credentials, err := s.repo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := newWebAuthnSession(userID, repository.WebAuthnRegistration, s.cfg.WebAuthn.Timeout)
+	if err != nil {
+		s.logger.Error("Failed to generate WebAuthn challenge", zap.Error(err))
+		return nil, err
+	}
+	if err := s.repo.CreateWebAuthnSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return newRegistrationOptions(s.relyingParty, session, user.ID, user.Email, user.Name, credentials, s.cfg.WebAuthn.Timeout), nil
+}
+
+// FinishWebAuthnRegistration verifies the authenticator's response to a
+// registration started by the user and stores the credential
+func (s *authService) FinishWebAuthnRegistration(ctx context.Context, userID, sessionID string, registration *WebAuthnRegistration) (*WebAuthnCredential, error) {
+	session, err := s.getWebAuthnSession(ctx, sessionID, repository.WebAuthnRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, ErrInvalidWebAuthnSession
+	}
+
+	verified, err := s.relyingParty.VerifyRegistration(session.Challenge, registration.ClientDataJSON, registration.AttestationObject)
+	if err != nil {
+		s.logger.Debug("WebAuthn registration rejected", zap.String("user_id", userID), zap.Error(err))
+		return nil, ErrInvalidWebAuthnResponse
+	}
+
+	if err := s.completeWebAuthnSession(ctx, session.ID); err != nil {
+		return nil, err
+	}
+
+	credential := newWebAuthnCredential(userID, verified, registration)
+	if err := s.repo.CreateWebAuthnCredential(ctx, credential); err != nil {
+		if errors.Is(err, database.ErrDuplicate) {
+			return nil, ErrWebAuthnCredentialExists
+		}
+		return nil, err
+	}
+
+	s.logger.Info("WebAuthn credential registered",
+		zap.String("user_id", userID),
+		zap.String("credential_id", credential.ID))
+	return &WebAuthnCredential{
+		ID:           credential.ID,
+		CredentialID: credential.CredentialID,
+		Name:         credential.Name,
+		CreatedAt:    credential.CreatedAt,
+	}, nil
+}
+
+// BeginWebAuthnLogin starts a login with a passkey or security key. Without
+// an email the authenticator offers its discoverable credentials. Unknown
+// emails get the options of a user without credentials, so they can't be told
+// apart from known ones.
+func (s *authService) BeginWebAuthnLogin(ctx context.Context, email string) (*WebAuthnLoginOptions, error) {
+	var userID string
+	var credentials []*repository.WebAuthnCredential
+	if email != "" {
+		user, err := s.repo.GetUserByEmail(ctx, email)
+		switch {
+		case errors.Is(err, repository.ErrUserNotFound):
+		case err != nil:
+			return nil, err
+		default:
+			userID = user.ID
+			if credentials, err = s.repo.ListWebAuthnCredentials(ctx, userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	session, err := newWebAuthnSession(userID, repository.WebAuthnLogin, s.cfg.WebAuthn.Timeout)
+	if err != nil {
+		s.logger.Error("Failed to generate WebAuthn challenge", zap.Error(err))
+		return nil, err
+	}
+	if err := s.repo.CreateWebAuthnSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return newLoginOptions(s.relyingParty, session, credentials, s.cfg.WebAuthn.Timeout), nil
+}
+
+// FinishWebAuthnLogin verifies the authenticator's response to a login and
+// returns the user it logs in. Each session can be completed once.
+func (s *authService) FinishWebAuthnLogin(ctx context.Context, sessionID string, assertion *WebAuthnAssertion) (*WebAuthnLogin, error) {
+	session, err := s.getWebAuthnSession(ctx, sessionID, repository.WebAuthnLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.repo.GetWebAuthnCredential(ctx, assertion.CredentialID)
+	if err != nil {
+		if errors.Is(err, repository.ErrWebAuthnCredentialNotFound) {
+			return nil, ErrInvalidWebAuthnLogin
+		}
+		return nil, err
+	}
+
+	verified, err := verifyWebAuthnAssertion(s.relyingParty, session, credential, assertion)
+	if err != nil {
+		logWebAuthnRejection(s.logger, credential, err)
+		return nil, ErrInvalidWebAuthnLogin
+	}
+
+	if err := s.completeWebAuthnSession(ctx, session.ID); err != nil {
+		return nil, err
+	}
+	err = s.repo.UseWebAuthnCredential(ctx, credential.ID, credential.SignCount, verified.SignCount)
+	if err != nil {
+		if errors.Is(err, repository.ErrWebAuthnSignCountUsed) {
+			return nil, ErrInvalidWebAuthnLogin
+		}
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, credential.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrInvalidWebAuthnLogin
+		}
+		return nil, err
+	}
+	switch user.Status {
+	case repository.StatusPending:
+		return nil, ErrAccountPending
+	case repository.StatusRejected:
+		return nil, ErrAccountRejected
+	case repository.StatusSuspended:
+		return nil, ErrAccountSuspended
+	}
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	return &WebAuthnLogin{UserID: user.ID, UserVerified: verified.UserVerified}, nil
+}
+
+// getWebAuthnSession gets an open session of a ceremony
+func (s *authService) getWebAuthnSession(ctx context.Context, id, kind string) (*repository.WebAuthnSession, error) {
+	session, err := s.repo.GetWebAuthnSession(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrWebAuthnSessionNotFound) {
+			return nil, ErrInvalidWebAuthnSession
+		}
+		return nil, err
+	}
+	if !openWebAuthnSession(session, kind) {
+		return nil, ErrInvalidWebAuthnSession
+	}
+	return session, nil
+}
+
+// completeWebAuthnSession completes a session, so its challenge can't be used again
+func (s *authService) completeWebAuthnSession(ctx context.Context, id string) error {
+	err := s.repo.CompleteWebAuthnSession(ctx, id)
+	if errors.Is(err, repository.ErrWebAuthnSessionCompleted) {
+		return ErrInvalidWebAuthnSession
+	}
+	return err
+}
+
+// newWebAuthnSession generates the session of a ceremony with a new challenge
+func newWebAuthnSession(userID, kind string, ttl time.Duration) (*repository.WebAuthnSession, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	return &repository.WebAuthnSession{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Kind:      kind,
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// openWebAuthnSession reports whether a session of the kind can still be completed
+func openWebAuthnSession(session *repository.WebAuthnSession, kind string) bool {
+	return session.Kind == kind && session.CompletedAt == nil && time.Now().Before(session.ExpiresAt)
+}
+
+// newRegistrationOptions returns the options of a registration session
+func newRegistrationOptions(rp *webauthn.RelyingParty, session *repository.WebAuthnSession, userID, email, name string, credentials []*repository.WebAuthnCredential, timeout time.Duration) *WebAuthnRegistrationOptions {
+	return &WebAuthnRegistrationOptions{
+		SessionID:          session.ID,
+		Challenge:          session.Challenge,
+		RPID:               rp.ID,
+		RPName:             rp.Name,
+		UserHandle:         webauthn.EncodeID([]byte(userID)),
+		UserName:           email,
+		UserDisplayName:    name,
+		Algorithms:         webauthn.Algorithms,
+		ExcludeCredentials: webAuthnDescriptors(credentials),
+		Timeout:            timeout,
+	}
+}
+
+// newLoginOptions returns the options of a login session
+func newLoginOptions(rp *webauthn.RelyingParty, session *repository.WebAuthnSession, credentials []*repository.WebAuthnCredential, timeout time.Duration) *WebAuthnLoginOptions {
+	return &WebAuthnLoginOptions{
+		SessionID:        session.ID,
+		Challenge:        session.Challenge,
+		RPID:             rp.ID,
+		AllowCredentials: webAuthnDescriptors(credentials),
+		Timeout:          timeout,
+	}
+}
+
+// webAuthnDescriptors returns the descriptors of credentials
+func webAuthnDescriptors(credentials []*repository.WebAuthnCredential) []WebAuthnDescriptor {
+	descriptors := make([]WebAuthnDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptor := WebAuthnDescriptor{ID: credential.CredentialID}
+		if credential.Transports != "" {
+			descriptor.Transports = strings.Split(credential.Transports, ",")
+		}
+		descriptors = append(descriptors, descriptor)
+	}
+	return descriptors
+}
+
+// newWebAuthnCredential returns the stored form of a verified credential
+func newWebAuthnCredential(userID string, verified *webauthn.Credential, registration *WebAuthnRegistration) *repository.WebAuthnCredential {
+	name := strings.TrimSpace(registration.Name)
+	if len(name) > maxWebAuthnCredentialName {
+		name = name[:maxWebAuthnCredentialName]
+	}
+
+	return &repository.WebAuthnCredential{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		CredentialID: webauthn.EncodeID(verified.ID),
+		PublicKey:    verified.PublicKey,
+		Algorithm:    verified.Algorithm,
+		SignCount:    verified.SignCount,
+		AAGUID:       hex.EncodeToString(verified.AAGUID),
+		Transports:   strings.Join(registration.Transports, ","),
+		Name:         name,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+}
+
+// verifyWebAuthnAssertion verifies an assertion of a credential for a login
+// session. A session started with an email only accepts the user's credentials.
+func verifyWebAuthnAssertion(rp *webauthn.RelyingParty, session *repository.WebAuthnSession, credential *repository.WebAuthnCredential, assertion *WebAuthnAssertion) (*webauthn.Assertion, error) {
+	if session.UserID != "" && session.UserID != credential.UserID {
+		return nil, errors.New("credential of another user than the session's")
+	}
+	if len(assertion.UserHandle) > 0 && string(assertion.UserHandle) != credential.UserID {
+		return nil, errors.New("user handle doesn't match the credential's user")
+	}
+
+	return rp.VerifyAssertion(session.Challenge, credential.PublicKey, credential.SignCount,
+		assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature)
+}
+
+// logWebAuthnRejection logs why an assertion was rejected, a regressed sign
+// count hints at a cloned authenticator
+func logWebAuthnRejection(logger *zap.Logger, credential *repository.WebAuthnCredential, err error) {
+	fields := []zap.Field{
+		zap.String("user_id", credential.UserID),
+		zap.String("credential_id", credential.ID),
+		zap.Error(err),
+	}
+	if errors.Is(err, webauthn.ErrSignCountRegressed) {
+		logger.Warn("WebAuthn sign count regressed, the authenticator may be cloned", fields...)
+		return
+	}
+	logger.Debug("WebAuthn login rejected", fields...)
+}
@@ -0,0 +1,278 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// FormatVersion is the version of the archive format written by Export
+const FormatVersion = 1
+
+// restoreBatchSize is the number of rows inserted per statement during restore
+const restoreBatchSize = 500
+
+// Common errors
+var (
+	ErrInvalidArchive     = errors.New("invalid backup archive")
+	ErrUnsupportedVersion = errors.New("unsupported backup archive version")
+)
+
+// Header is the first record of a backup archive
+type Header struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Driver    string    `json:"driver"`
+	Tables    []string  `json:"tables"`
+}
+
+// record is a single row of a backup archive
+type record struct {
+	Table string                 `json:"table"`
+	Row   map[string]interface{} `json:"row"`
+}
+
+// Backup exports and restores database tables as logical archives.
+// An archive is a gzip-compressed stream of JSON lines: a Header
+// followed by one record per row.
+type Backup struct {
+	db     *gorm.DB
+	tables []string
+	logger *zap.Logger
+}
+
+// NewBackup creates a new backup for the given tables
+func NewBackup(db *gorm.DB, tables []string, logger *zap.Logger) *Backup {
+	return &Backup{
+		db:     db,
+		tables: tables,
+		logger: logger,
+	}
+}
+
+// Export writes a consistent snapshot of all tables to w
+func (b *Backup) Export(ctx context.Context, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+
+	header := Header{
+		Version:   FormatVersion,
+		CreatedAt: time.Now().UTC(),
+		Driver:    b.db.Dialector.Name(),
+		Tables:    b.tables,
+	}
+	if err := enc.Encode(header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	// A read-only repeatable-read transaction gives every table the same snapshot
+	opts := &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	err := b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, table := range b.tables {
+			count, err := b.exportTable(tx, table, enc)
+			if err != nil {
+				return fmt.Errorf("failed to export table %s: %w", table, err)
+			}
+			b.logger.Info("Table exported",
+				zap.String("table", table),
+				zap.Int("rows", count))
+		}
+		return nil
+	}, opts)
+	if err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// exportTable streams every row of a table to the encoder
+func (b *Backup) exportTable(tx *gorm.DB, table string, enc *json.Encoder) (int, error) {
+	rows, err := tx.Table(table).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		row := make(map[string]interface{})
+		if err := tx.ScanRows(rows, &row); err != nil {
+			return count, err
+		}
+		if err := enc.Encode(record{Table: table, Row: row}); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, rows.Err()
+}
+
+// Restore reads an archive from r and inserts its rows.
+// When replace is true, the existing rows of each archived table are deleted first.
+// The restore runs in a single transaction, so a failure leaves the database unchanged.
+func (b *Backup) Restore(ctx context.Context, r io.Reader, replace bool) (*Header, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(gz))
+	dec.UseNumber()
+
+	var header Header
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if header.Version != FormatVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header.Version)
+	}
+
+	b.logger.Info("Restoring backup",
+		zap.Time("created_at", header.CreatedAt),
+		zap.Strings("tables", header.Tables),
+		zap.Bool("replace", replace))
+
+	err = b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Column types are needed to turn JSON values back into database values
+		columnTypes := make(map[string]map[string]string)
+		for _, table := range header.Tables {
+			types, err := tableColumnTypes(tx, table)
+			if err != nil {
+				return err
+			}
+			columnTypes[table] = types
+
+			if replace {
+				if err := tx.Exec(fmt.Sprintf("DELETE FROM %s", table)).Error; err != nil {
+					return fmt.Errorf("failed to clear table %s: %w", table, err)
+				}
+			}
+		}
+
+		batches := make(map[string][]map[string]interface{})
+		counts := make(map[string]int)
+		flush := func(table string) error {
+			if len(batches[table]) == 0 {
+				return nil
+			}
+			if err := tx.Table(table).Create(batches[table]).Error; err != nil {
+				return fmt.Errorf("failed to restore table %s: %w", table, err)
+			}
+			counts[table] += len(batches[table])
+			batches[table] = nil
+			return nil
+		}
+
+		for {
+			var rec record
+			if err := dec.Decode(&rec); err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+			}
+
+			types, ok := columnTypes[rec.Table]
+			if !ok {
+				return fmt.Errorf("%w: row for unlisted table %s", ErrInvalidArchive, rec.Table)
+			}
+
+			row, err := decodeRow(rec.Row, types)
+			if err != nil {
+				return fmt.Errorf("failed to decode row for table %s: %w", rec.Table, err)
+			}
+
+			batches[rec.Table] = append(batches[rec.Table], row)
+			if len(batches[rec.Table]) >= restoreBatchSize {
+				if err := flush(rec.Table); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, table := range header.Tables {
+			if err := flush(table); err != nil {
+				return err
+			}
+			b.logger.Info("Table restored",
+				zap.String("table", table),
+				zap.Int("rows", counts[table]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &header, nil
+}
+
+// tableColumnTypes returns the upper-cased database type of every column
+func tableColumnTypes(tx *gorm.DB, table string) (map[string]string, error) {
+	columns, err := tx.Migrator().ColumnTypes(table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of table %s: %w", table, err)
+	}
+
+	types := make(map[string]string, len(columns))
+	for _, column := range columns {
+		types[column.Name()] = strings.ToUpper(column.DatabaseTypeName())
+	}
+	return types, nil
+}
+
+// decodeRow converts JSON-decoded values back to values the driver accepts
+func decodeRow(row map[string]interface{}, types map[string]string) (map[string]interface{}, error) {
+	decoded := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		dbType, ok := types[column]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %s", column)
+		}
+
+		switch v := value.(type) {
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				decoded[column] = i
+			} else if f, err := v.Float64(); err == nil {
+				decoded[column] = f
+			} else {
+				return nil, fmt.Errorf("invalid number in column %s: %w", column, err)
+			}
+		case string:
+			switch {
+			case strings.Contains(dbType, "DATE") || strings.Contains(dbType, "TIME"):
+				t, err := time.Parse(time.RFC3339Nano, v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid time in column %s: %w", column, err)
+				}
+				decoded[column] = t
+			case strings.Contains(dbType, "BLOB") || strings.Contains(dbType, "BINARY"):
+				// []byte values are encoded as base64 by encoding/json
+				b, err := base64.StdEncoding.DecodeString(v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid binary data in column %s: %w", column, err)
+				}
+				decoded[column] = b
+			default:
+				decoded[column] = v
+			}
+		default:
+			decoded[column] = v
+		}
+	}
+	return decoded, nil
+}
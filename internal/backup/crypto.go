@@ -0,0 +1,79 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// encryptedMagic prefixes encrypted archives so they can be detected on restore
+var encryptedMagic = []byte("HGBAK1")
+
+// ErrDecryptionFailed is returned when an archive cannot be decrypted with the given key
+var ErrDecryptionFailed = errors.New("failed to decrypt backup archive")
+
+// deriveKey turns the configured passphrase into an AES-256 key
+func deriveKey(passphrase string) []byte {
+	key := sha256.Sum256([]byte(passphrase))
+	return key[:]
+}
+
+// Encrypt seals an archive with AES-256-GCM
+func Encrypt(data []byte, passphrase string) ([]byte, error) {
+	block, err := aes.NewCipher(deriveKey(passphrase))
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append([]byte{}, encryptedMagic...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, encryptedMagic), nil
+}
+
+// Decrypt opens an archive sealed by Encrypt
+func Decrypt(data []byte, passphrase string) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, ErrDecryptionFailed
+	}
+
+	block, err := aes.NewCipher(deriveKey(passphrase))
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	data = data[len(encryptedMagic):]
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrDecryptionFailed
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, encryptedMagic)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted reports whether the archive was produced by Encrypt
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
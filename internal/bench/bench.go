@@ -0,0 +1,162 @@
+package bench
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Result is the outcome of a benchmark, averaged over its runs with -count
+type Result struct {
+	// Name is the benchmark's package and name, e.g. "pkg/middleware.BenchmarkValidateToken-8"
+	Name        string
+	Runs        int
+	NsPerOp     float64
+	BytesPerOp  float64
+	AllocsPerOp float64
+}
+
+// Report is the output of `go test -bench` along with the environment it was
+// measured in. Results are only comparable between reports from the same machine.
+type Report struct {
+	GOOS    string
+	GOARCH  string
+	CPU     string
+	Results []Result
+}
+
+// Load reads a report saved from `go test -bench` output
+func Load(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	report, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid report %s: %w", path, err)
+	}
+	return report, nil
+}
+
+// Parse reads `go test -bench` output. Lines other than the environment and
+// benchmark results, e.g. PASS or log output, are skipped.
+func Parse(r io.Reader) (*Report, error) {
+	report := &Report{}
+	index := make(map[string]int)
+	pkg := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if key, value, ok := strings.Cut(line, ": "); ok {
+			switch key {
+			case "goos":
+				report.GOOS = value
+			case "goarch":
+				report.GOARCH = value
+			case "cpu":
+				report.CPU = value
+			case "pkg":
+				pkg = value
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		// Name, iterations, then value and unit pairs
+		res := Result{Name: fields[0], Runs: 1}
+		if pkg != "" {
+			res.Name = pkg + "." + fields[0]
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("benchmark %s: %w", fields[0], err)
+			}
+			switch fields[i+1] {
+			case "ns/op":
+				res.NsPerOp = value
+			case "B/op":
+				res.BytesPerOp = value
+			case "allocs/op":
+				res.AllocsPerOp = value
+			}
+		}
+
+		// Runs of the same benchmark, e.g. with -count, are averaged
+		if i, ok := index[res.Name]; ok {
+			prev := &report.Results[i]
+			n := float64(prev.Runs)
+			prev.NsPerOp = (prev.NsPerOp*n + res.NsPerOp) / (n + 1)
+			prev.BytesPerOp = (prev.BytesPerOp*n + res.BytesPerOp) / (n + 1)
+			prev.AllocsPerOp = (prev.AllocsPerOp*n + res.AllocsPerOp) / (n + 1)
+			prev.Runs++
+			continue
+		}
+		index[res.Name] = len(report.Results)
+		report.Results = append(report.Results, res)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(report.Results) == 0 {
+		return nil, fmt.Errorf("no benchmark results")
+	}
+	return report, nil
+}
+
+// SameMachine reports whether two reports were measured on the same platform and CPU
+func (r *Report) SameMachine(other *Report) bool {
+	return r.GOOS == other.GOOS && r.GOARCH == other.GOARCH && r.CPU == other.CPU
+}
+
+// Change compares a benchmark between two reports
+type Change struct {
+	Name     string
+	Baseline float64
+	Current  float64
+	// Delta is the relative change of ns/op, positive means slower
+	Delta float64
+}
+
+// Regressed reports whether the benchmark got slower by more than threshold (e.g. 0.1 for 10%)
+func (c Change) Regressed(threshold float64) bool {
+	return c.Delta > threshold
+}
+
+// Compare returns the changes of every benchmark present in both reports
+func Compare(baseline, current *Report) []Change {
+	previous := make(map[string]Result, len(baseline.Results))
+	for _, res := range baseline.Results {
+		previous[res.Name] = res
+	}
+
+	var changes []Change
+	for _, res := range current.Results {
+		old, ok := previous[res.Name]
+		if !ok || old.NsPerOp == 0 {
+			continue
+		}
+		changes = append(changes, Change{
+			Name:     res.Name,
+			Baseline: old.NsPerOp,
+			Current:  res.NsPerOp,
+			Delta:    (res.NsPerOp - old.NsPerOp) / old.NsPerOp,
+		})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
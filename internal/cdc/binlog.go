@@ -0,0 +1,472 @@
+package cdc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	eventspb "github.com/linkeunid/hello-go/api/gen/events"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/events"
+)
+
+// positionName is the cdc_positions row the binlog listener stores its position in
+const positionName = "binlog"
+
+const (
+	// heartbeatPeriod is how often an idle server sends a heartbeat, a stream
+	// silent for twice as long is considered broken
+	heartbeatPeriod = 30 * time.Second
+	// reconnectDelay is how long the listener waits before reconnecting after an error
+	reconnectDelay = 5 * time.Second
+	// positionInterval is how often the position is stored while only
+	// unwatched tables change, bounding how much a restart reads again
+	positionInterval = time.Minute
+)
+
+// Position is how far the binlog listener has published the binary log
+type Position struct {
+	Name      string `gorm:"primaryKey;type:varchar(64)"`
+	File      string `gorm:"type:varchar(255)"`
+	Pos       uint32
+	UpdatedAt time.Time
+}
+
+// TableName overrides the table name used by Position
+func (Position) TableName() string {
+	return "cdc_positions"
+}
+
+// Listener captures row changes by streaming MySQL's binary log as a replica
+// does, publishing the same events as the Watcher as each transaction commits.
+// It needs binlog_format=ROW and binlog_row_image=FULL, and a database user
+// with the REPLICATION SLAVE and REPLICATION CLIENT privileges.
+//
+// The position after the last published transaction is stored in
+// cdc_positions and a restart resumes from it; the first start begins at the
+// server's current position, like the Watcher's baseline. Delivery is
+// at-least-once: events are published before the position is stored.
+type Listener struct {
+	cfg       *config.Config
+	db        *gorm.DB
+	publisher events.Publisher
+	tables    map[string]Table
+	// columns are the column names of the watched tables in ordinal order,
+	// the binlog only has their positions
+	columns  map[string][]string
+	location *time.Location
+	logger   *zap.Logger
+}
+
+// NewListener creates a new binlog change data capture listener
+func NewListener(cfg *config.Config, db *gorm.DB, publisher events.Publisher, tables []Table, logger *zap.Logger) (*Listener, error) {
+	if err := db.AutoMigrate(&Position{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate position table: %w", err)
+	}
+
+	location, err := paramsLocation(cfg.Database.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	watched := make(map[string]Table, len(tables))
+	for _, table := range tables {
+		watched[table.Name] = table
+	}
+
+	return &Listener{
+		cfg:       cfg,
+		db:        db,
+		publisher: publisher,
+		tables:    watched,
+		columns:   make(map[string][]string),
+		location:  location,
+		logger:    logger,
+	}, nil
+}
+
+// paramsLocation returns the time zone DATETIME values are read in, the loc of
+// DB_PARAMS like the SQL driver
+func paramsLocation(params string) (*time.Location, error) {
+	values, err := url.ParseQuery(params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DB_PARAMS: %w", err)
+	}
+	name := values.Get("loc")
+	if name == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DB_PARAMS loc %q: %w", name, err)
+	}
+	return location, nil
+}
+
+// Start streams the binary log until the context is cancelled, reconnecting after errors
+func (l *Listener) Start(ctx context.Context) {
+	l.logger.Info("Starting change data capture from the binary log",
+		zap.Int("server_id", l.cfg.CDC.ServerID),
+		zap.Int("tables", len(l.tables)))
+
+	for {
+		err := l.stream(ctx)
+		if ctx.Err() != nil {
+			l.logger.Info("Change data capture stopped")
+			return
+		}
+		l.logger.Error("Change data capture failed, reconnecting",
+			zap.Duration("delay", reconnectDelay),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			l.logger.Info("Change data capture stopped")
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// stream reads the binary log from the stored position until an error
+func (l *Listener) stream(ctx context.Context) error {
+	checksum, err := l.checkServer(ctx)
+	if err != nil {
+		return err
+	}
+	position, err := l.position(ctx)
+	if err != nil {
+		return err
+	}
+
+	conn, err := dialMySQL(ctx, &l.cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect for the binary log: %w", err)
+	}
+	defer conn.Close()
+	// Closing the connection unblocks a pending read
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := conn.exec("SET @master_binlog_checksum = @@global.binlog_checksum"); err != nil {
+		return err
+	}
+	if err := conn.exec(fmt.Sprintf("SET @master_heartbeat_period = %d", heartbeatPeriod.Nanoseconds())); err != nil {
+		return err
+	}
+	if err := conn.dumpBinlog(uint32(l.cfg.CDC.ServerID), position); err != nil {
+		return err
+	}
+	l.logger.Info("Streaming the binary log",
+		zap.String("file", position.File),
+		zap.Uint32("position", position.Pos))
+
+	parser := newBinlogParser(checksum, l.location)
+	var pending []events.Event
+	stored := time.Now()
+	for {
+		conn.setReadDeadline(time.Now().Add(2 * heartbeatPeriod))
+		data, err := conn.readEvent()
+		if err != nil {
+			return fmt.Errorf("failed to read the binary log: %w", err)
+		}
+		header, body, err := parser.header(data)
+		if err != nil {
+			return fmt.Errorf("failed to read binlog event: %w", err)
+		}
+		// Heartbeats and the format description resent on connect don't advance the position
+		if header.LogPos > 0 && header.Type != heartbeatEvent && header.Type != formatDescriptionEvent {
+			position.Pos = header.LogPos
+		}
+
+		commit := false
+		switch header.Type {
+		case rotateEvent:
+			position.File, position.Pos, err = parser.rotate(body)
+		case formatDescriptionEvent:
+			err = parser.formatDescription(body)
+		case tableMapEvent:
+			err = parser.tableMap(body)
+		case writeRowsEventV1, writeRowsEventV2, updateRowsEventV1, updateRowsEventV2, deleteRowsEventV1, deleteRowsEventV2:
+			var rows *rowsEvent
+			rows, err = parser.rows(header.Type, body)
+			if err == nil {
+				var changes []events.Event
+				changes, err = l.changes(ctx, rows)
+				pending = append(pending, changes...)
+			}
+		case xidEvent:
+			commit = true
+		case queryEvent:
+			var query string
+			query, err = parser.query(body)
+			switch statement := strings.ToUpper(strings.TrimSpace(query)); {
+			case statement == "COMMIT":
+				// Transactions of non-transactional tables end with a COMMIT query
+				commit = true
+			case statement != "BEGIN":
+				// A schema change may reorder columns, they're looked up again when needed
+				l.columns = make(map[string][]string)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode binlog event %d: %w", header.Type, err)
+		}
+
+		if !commit {
+			continue
+		}
+		if len(pending) == 0 && time.Since(stored) < positionInterval {
+			continue
+		}
+		if err := l.commit(ctx, pending, position); err != nil {
+			return err
+		}
+		pending = nil
+		stored = time.Now()
+	}
+}
+
+// checkServer verifies the server logs full row images and returns whether
+// binlog events carry checksums
+func (l *Listener) checkServer(ctx context.Context) (bool, error) {
+	var settings struct {
+		LogBin   bool
+		Format   string
+		RowImage string
+		Checksum string
+	}
+	err := l.db.WithContext(ctx).Raw("SELECT @@global.log_bin AS log_bin, @@global.binlog_format AS format, " +
+		"@@global.binlog_row_image AS row_image, @@global.binlog_checksum AS checksum").Scan(&settings).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to read binlog settings: %w", err)
+	}
+
+	switch {
+	case !settings.LogBin:
+		return false, errors.New("binary logging is disabled, enable log_bin or use CDC_MODE=snapshot")
+	case !strings.EqualFold(settings.Format, "ROW"):
+		return false, fmt.Errorf("binlog_format is %s, the binlog listener needs ROW", settings.Format)
+	case !strings.EqualFold(settings.RowImage, "FULL"):
+		return false, fmt.Errorf("binlog_row_image is %s, the binlog listener needs FULL", settings.RowImage)
+	}
+	return strings.EqualFold(settings.Checksum, "CRC32"), nil
+}
+
+// position returns the stored position, or stores and returns the server's
+// current position on the first start
+func (l *Listener) position(ctx context.Context) (Position, error) {
+	var position Position
+	err := l.db.WithContext(ctx).Where("name = ?", positionName).First(&position).Error
+	if err == nil {
+		return position, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Position{}, fmt.Errorf("failed to load binlog position: %w", err)
+	}
+
+	// MySQL 8.4 renamed SHOW MASTER STATUS
+	file, pos, err := l.serverPosition(ctx, "SHOW BINARY LOG STATUS")
+	if err != nil {
+		file, pos, err = l.serverPosition(ctx, "SHOW MASTER STATUS")
+	}
+	if err != nil {
+		return Position{}, fmt.Errorf("failed to read the server's binlog position: %w", err)
+	}
+
+	position = Position{Name: positionName, File: file, Pos: pos, UpdatedAt: time.Now()}
+	if err := l.db.WithContext(ctx).Create(&position).Error; err != nil {
+		return Position{}, fmt.Errorf("failed to store binlog position: %w", err)
+	}
+	l.logger.Info("Recorded change data capture baseline",
+		zap.String("file", file),
+		zap.Uint32("position", pos))
+	return position, nil
+}
+
+// serverPosition reads the file and position columns of a binlog status statement
+func (l *Listener) serverPosition(ctx context.Context, statement string) (string, uint32, error) {
+	rows, err := l.db.WithContext(ctx).Raw(statement).Rows()
+	if err != nil {
+		return "", 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", 0, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", 0, err
+		}
+		return "", 0, errors.New("binary logging is disabled")
+	}
+
+	values := make([]sql.RawBytes, len(columns))
+	targets := make([]interface{}, len(columns))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	if err := rows.Scan(targets...); err != nil {
+		return "", 0, err
+	}
+
+	var file string
+	var pos uint32
+	for i, column := range columns {
+		switch column {
+		case "File":
+			file = string(values[i])
+		case "Position":
+			if _, err := fmt.Sscan(string(values[i]), &pos); err != nil {
+				return "", 0, fmt.Errorf("invalid binlog position %q", values[i])
+			}
+		}
+	}
+	if file == "" {
+		return "", 0, errors.New("binary logging is disabled")
+	}
+	return file, pos, nil
+}
+
+// changes converts a rows event of a watched table into row change events
+func (l *Listener) changes(ctx context.Context, rows *rowsEvent) ([]events.Event, error) {
+	table, ok := l.tables[rows.Table.Table]
+	if !ok || rows.Table.Schema != l.cfg.Database.DBName {
+		return nil, nil
+	}
+
+	columns, err := l.tableColumns(ctx, table.Name, len(rows.Table.Types))
+	if err != nil {
+		return nil, err
+	}
+	if columns == nil {
+		// The table changed since the event was logged, its columns can't be named
+		l.logger.Error("Skipped binlog rows of a table whose columns changed since",
+			zap.String("table", table.Name),
+			zap.Int("rows", len(rows.Rows)))
+		return nil, nil
+	}
+	named := func(values []interface{}) map[string]interface{} {
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		return row
+	}
+
+	var changes []events.Event
+	add := func(op string, row map[string]interface{}, changed []string) error {
+		key := fmt.Sprint(row[table.Key])
+		change := &eventspb.RowChange{
+			Table:   table.Name,
+			Key:     key,
+			Op:      op,
+			Changed: changed,
+		}
+		// Deletions carry only the key, like the Watcher's
+		if op != "deleted" {
+			public, err := publicRow(row, table.Sensitive)
+			if err != nil {
+				return err
+			}
+			change.Row = public
+		}
+
+		event, err := events.NewMessage(table.Entity+"."+op, Source, key, change)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, event)
+		return nil
+	}
+
+	switch rows.Type {
+	case writeRowsEventV1, writeRowsEventV2:
+		for _, values := range rows.Rows {
+			if err := add("created", named(values), nil); err != nil {
+				return nil, err
+			}
+		}
+	case deleteRowsEventV1, deleteRowsEventV2:
+		for _, values := range rows.Rows {
+			if err := add("deleted", named(values), nil); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		for i := 0; i+1 < len(rows.Rows); i += 2 {
+			before, after := named(rows.Rows[i]), named(rows.Rows[i+1])
+			changed := changedValues(before, after)
+			if len(changed) == 0 {
+				continue
+			}
+			if err := add("updated", after, changed); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return changes, nil
+}
+
+// tableColumns returns the column names of a table, or nil if it no longer
+// has the number of columns the binlog event was logged with
+func (l *Listener) tableColumns(ctx context.Context, table string, count int) ([]string, error) {
+	if columns, ok := l.columns[table]; ok && len(columns) == count {
+		return columns, nil
+	}
+
+	var columns []string
+	err := l.db.WithContext(ctx).
+		Raw("SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION",
+			l.cfg.Database.DBName, table).
+		Scan(&columns).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load columns of %s: %w", table, err)
+	}
+	l.columns[table] = columns
+
+	if len(columns) != count {
+		return nil, nil
+	}
+	return columns, nil
+}
+
+// commit publishes the changes of the transactions read so far, then stores
+// the position after them
+func (l *Listener) commit(ctx context.Context, changes []events.Event, position Position) error {
+	if len(changes) > 0 {
+		if err := l.publisher.Publish(ctx, changes...); err != nil {
+			return fmt.Errorf("failed to publish changes: %w", err)
+		}
+		l.logger.Info("Captured changes", zap.Int("changes", len(changes)))
+	}
+
+	position.Name = positionName
+	position.UpdatedAt = time.Now()
+	if err := l.db.WithContext(ctx).Save(&position).Error; err != nil {
+		return fmt.Errorf("failed to store binlog position: %w", err)
+	}
+	return nil
+}
+
+// changedValues returns the columns whose values differ between two row images
+func changedValues(before, after map[string]interface{}) []string {
+	var changed []string
+	for column, value := range after {
+		if fmt.Sprint(before[column]) != fmt.Sprint(value) {
+			changed = append(changed, column)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
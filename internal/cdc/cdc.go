@@ -0,0 +1,424 @@
+package cdc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gorm.io/gorm"
+
+	eventspb "github.com/linkeunid/hello-go/api/gen/events"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/events"
+)
+
+// Source is the event source used for captured changes
+const Source = "cdc"
+
+// baselineKey marks that the initial snapshot of a table was recorded
+const baselineKey = ""
+
+// Table describes a watched table
+type Table struct {
+	// Name is the database table name
+	Name string
+	// Key is the primary key column
+	Key string
+	// Entity prefixes the emitted event types, e.g. "user" -> "user.updated"
+	Entity string
+	// Sensitive columns are tracked for changes but never included in payloads
+	Sensitive []string
+}
+
+// Snapshot is the last captured state of a row
+type Snapshot struct {
+	Table     string `gorm:"primaryKey;column:table_name;type:varchar(64)"`
+	RowKey    string `gorm:"primaryKey;type:varchar(100)"`
+	Hash      string `gorm:"type:char(64)"`
+	Data      string `gorm:"type:text"`
+	UpdatedAt time.Time
+}
+
+// TableName overrides the table name used by Snapshot
+func (Snapshot) TableName() string {
+	return "cdc_snapshots"
+}
+
+// Watcher captures row changes by diffing tables against stored snapshots.
+// It's a fallback for databases without a log-based change stream: every poll
+// reads each watched table in full, the snapshots keep a copy of its rows, and
+// successive changes to a row between two polls are captured as one.
+//
+// Unlike application hooks, this sees every change regardless of how it was
+// made (seed scripts, admin SQL, other services), including changes that
+// don't touch updated_at. Delivery is at-least-once: events are published
+// before the snapshot is updated.
+type Watcher struct {
+	db        *gorm.DB
+	publisher events.Publisher
+	tables    []Table
+	interval  time.Duration
+	batchSize int
+	logger    *zap.Logger
+}
+
+// NewWatcher creates a new change data capture watcher
+func NewWatcher(cfg *config.Config, db *gorm.DB, publisher events.Publisher, tables []Table, logger *zap.Logger) (*Watcher, error) {
+	if err := db.AutoMigrate(&Snapshot{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate snapshot table: %w", err)
+	}
+
+	return &Watcher{
+		db:        db,
+		publisher: publisher,
+		tables:    tables,
+		interval:  cfg.CDC.Interval,
+		batchSize: cfg.CDC.BatchSize,
+		logger:    logger,
+	}, nil
+}
+
+// Start polls the tables until the context is cancelled
+func (w *Watcher) Start(ctx context.Context) {
+	w.logger.Info("Starting change data capture",
+		zap.Duration("interval", w.interval),
+		zap.Int("tables", len(w.tables)))
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, table := range w.tables {
+			if err := w.Poll(ctx, table); err != nil {
+				w.logger.Error("Change data capture failed",
+					zap.String("table", table.Name),
+					zap.Error(err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Change data capture stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll captures the changes of a single table since the last poll. The table
+// is walked in batches of CDC_BATCH_SIZE rows, loading only the snapshots of
+// each batch, and every batch's changes are published before its snapshots
+// are stored.
+func (w *Watcher) Poll(ctx context.Context, table Table) error {
+	// The first poll only records a baseline, otherwise every existing row would be "created"
+	var markers int64
+	err := w.db.WithContext(ctx).Model(&Snapshot{}).
+		Where("table_name = ? AND row_key = ?", table.Name, baselineKey).
+		Count(&markers).Error
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot: %w", err)
+	}
+	baseline := markers == 0
+
+	rows, changed := 0, 0
+	err = w.scan(ctx, table, func(batch []map[string]interface{}) error {
+		keys := make([]string, len(batch))
+		for i, row := range batch {
+			keys[i] = fmt.Sprint(row[table.Key])
+		}
+		previous, err := w.snapshots(ctx, table, keys)
+		if err != nil {
+			return err
+		}
+
+		var changes []events.Event
+		var upserts []Snapshot
+		for i, row := range batch {
+			key := keys[i]
+			data, hash, err := encodeRow(row, table.Sensitive)
+			if err != nil {
+				return err
+			}
+
+			old, existed := previous[key]
+			if existed && old.Hash == hash {
+				continue
+			}
+
+			upserts = append(upserts, Snapshot{
+				Table:     table.Name,
+				RowKey:    key,
+				Hash:      hash,
+				Data:      data,
+				UpdatedAt: time.Now(),
+			})
+
+			if baseline {
+				continue
+			}
+
+			public, err := publicRow(row, table.Sensitive)
+			if err != nil {
+				return err
+			}
+			change := &eventspb.RowChange{
+				Table: table.Name,
+				Key:   key,
+				Row:   public,
+			}
+			if existed {
+				change.Op = "updated"
+				change.Changed = changedColumns(old.Data, data)
+			} else {
+				change.Op = "created"
+			}
+
+			event, err := events.NewMessage(table.Entity+"."+change.Op, Source, key, change)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, event)
+		}
+
+		rows += len(batch)
+		changed += len(changes)
+		return w.commit(ctx, table, changes, upserts, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	if baseline {
+		// Recorded last, so an interrupted baseline is completed by the next poll
+		marker := Snapshot{Table: table.Name, RowKey: baselineKey, UpdatedAt: time.Now()}
+		if err := w.db.WithContext(ctx).Save(&marker).Error; err != nil {
+			return fmt.Errorf("failed to store snapshot: %w", err)
+		}
+		w.logger.Info("Recorded change data capture baseline",
+			zap.String("table", table.Name),
+			zap.Int("rows", rows))
+		return nil
+	}
+
+	deleted, err := w.captureDeletes(ctx, table)
+	if err != nil {
+		return err
+	}
+	changed += deleted
+
+	if changed > 0 {
+		w.logger.Info("Captured changes",
+			zap.String("table", table.Name),
+			zap.Int("changes", changed))
+	}
+
+	return nil
+}
+
+// captureDeletes publishes a deletion for every snapshot whose row is gone,
+// checking the snapshots in batches, and returns how many there were
+func (w *Watcher) captureDeletes(ctx context.Context, table Table) (int, error) {
+	count := 0
+	lastKey := baselineKey
+	for {
+		var keys []string
+		err := w.db.WithContext(ctx).Model(&Snapshot{}).
+			Where("table_name = ? AND row_key > ?", table.Name, lastKey).
+			Order("row_key").Limit(w.batchSize).
+			Pluck("row_key", &keys).Error
+		if err != nil {
+			return count, fmt.Errorf("failed to load snapshot: %w", err)
+		}
+		if len(keys) == 0 {
+			return count, nil
+		}
+		lastKey = keys[len(keys)-1]
+
+		var existing []string
+		err = w.db.WithContext(ctx).Table(table.Name).
+			Where(fmt.Sprintf("%s IN ?", table.Key), keys).
+			Pluck(table.Key, &existing).Error
+		if err != nil {
+			return count, fmt.Errorf("failed to scan table: %w", err)
+		}
+		found := make(map[string]bool, len(existing))
+		for _, key := range existing {
+			found[key] = true
+		}
+
+		var changes []events.Event
+		var deleted []string
+		for _, key := range keys {
+			if found[key] {
+				continue
+			}
+			deleted = append(deleted, key)
+
+			event, err := events.NewMessage(table.Entity+".deleted", Source, key, &eventspb.RowChange{
+				Table: table.Name,
+				Key:   key,
+				Op:    "deleted",
+			})
+			if err != nil {
+				return count, err
+			}
+			changes = append(changes, event)
+		}
+
+		if err := w.commit(ctx, table, changes, nil, deleted); err != nil {
+			return count, err
+		}
+		count += len(deleted)
+
+		if len(keys) < w.batchSize {
+			return count, nil
+		}
+	}
+}
+
+// snapshots returns the stored snapshots of the rows with the given keys
+func (w *Watcher) snapshots(ctx context.Context, table Table, keys []string) (map[string]Snapshot, error) {
+	var stored []Snapshot
+	err := w.db.WithContext(ctx).
+		Where("table_name = ? AND row_key IN ?", table.Name, keys).
+		Find(&stored).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+
+	snapshots := make(map[string]Snapshot, len(stored))
+	for _, snapshot := range stored {
+		snapshots[snapshot.RowKey] = snapshot
+	}
+	return snapshots, nil
+}
+
+// commit publishes the changes of a batch, then stores its snapshots
+func (w *Watcher) commit(ctx context.Context, table Table, changes []events.Event, upserts []Snapshot, deleted []string) error {
+	if len(changes) > 0 {
+		if err := w.publisher.Publish(ctx, changes...); err != nil {
+			return fmt.Errorf("failed to publish changes: %w", err)
+		}
+	}
+
+	err := w.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(upserts) > 0 {
+			if err := tx.Save(&upserts).Error; err != nil {
+				return err
+			}
+		}
+		if len(deleted) > 0 {
+			if err := tx.Where("table_name = ? AND row_key IN ?", table.Name, deleted).Delete(&Snapshot{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store snapshot: %w", err)
+	}
+	return nil
+}
+
+// scan iterates over all rows of a table in primary key order, in batches
+func (w *Watcher) scan(ctx context.Context, table Table, fn func(batch []map[string]interface{}) error) error {
+	var lastKey interface{}
+	for {
+		var rows []map[string]interface{}
+		query := w.db.WithContext(ctx).Table(table.Name).Order(table.Key).Limit(w.batchSize)
+		if lastKey != nil {
+			query = query.Where(fmt.Sprintf("%s > ?", table.Key), lastKey)
+		}
+		if err := query.Find(&rows).Error; err != nil {
+			return fmt.Errorf("failed to scan table: %w", err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		if err := fn(rows); err != nil {
+			return err
+		}
+		lastKey = rows[len(rows)-1][table.Key]
+
+		if len(rows) < w.batchSize {
+			return nil
+		}
+	}
+}
+
+// encodeRow returns the stored representation of a row and its hash.
+// Sensitive values are replaced by their own hash so changes are still detected.
+func encodeRow(row map[string]interface{}, sensitive []string) (string, string, error) {
+	stored := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		stored[column] = value
+	}
+	for _, column := range sensitive {
+		if value, ok := stored[column]; ok {
+			sum := sha256.Sum256([]byte(fmt.Sprint(value)))
+			stored[column] = hex.EncodeToString(sum[:])
+		}
+	}
+
+	// encoding/json sorts map keys, so equal rows encode identically
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode row: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return string(data), hex.EncodeToString(sum[:]), nil
+}
+
+// publicRow returns the row without its sensitive columns
+func publicRow(row map[string]interface{}, sensitive []string) (*structpb.Struct, error) {
+	public := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		public[column] = value
+	}
+	for _, column := range sensitive {
+		delete(public, column)
+	}
+
+	// Values are converted through JSON, structpb doesn't take times or byte slices
+	data, err := json.Marshal(public)
+	if err != nil {
+		return nil, err
+	}
+	converted := &structpb.Struct{}
+	if err := protojson.Unmarshal(data, converted); err != nil {
+		return nil, err
+	}
+	return converted, nil
+}
+
+// changedColumns returns the columns whose values differ between two stored rows
+func changedColumns(oldData, newData string) []string {
+	var oldRow, newRow map[string]interface{}
+	if json.Unmarshal([]byte(oldData), &oldRow) != nil || json.Unmarshal([]byte(newData), &newRow) != nil {
+		return nil
+	}
+
+	var changed []string
+	for column, value := range newRow {
+		if fmt.Sprint(oldRow[column]) != fmt.Sprint(value) {
+			changed = append(changed, column)
+		}
+	}
+	for column := range oldRow {
+		if _, ok := newRow[column]; !ok {
+			changed = append(changed, column)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed
+}
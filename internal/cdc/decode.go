@@ -0,0 +1,628 @@
+package cdc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Binlog event types, see the MySQL source's binlog_event.h
+const (
+	queryEvent             = 2
+	rotateEvent            = 4
+	formatDescriptionEvent = 15
+	xidEvent               = 16
+	tableMapEvent          = 19
+	writeRowsEventV1       = 23
+	updateRowsEventV1      = 24
+	deleteRowsEventV1      = 25
+	heartbeatEvent         = 27
+	writeRowsEventV2       = 30
+	updateRowsEventV2      = 31
+	deleteRowsEventV2      = 32
+)
+
+// Column types of table map events
+const (
+	typeDecimal    = 0
+	typeTiny       = 1
+	typeShort      = 2
+	typeLong       = 3
+	typeFloat      = 4
+	typeDouble     = 5
+	typeNull       = 6
+	typeTimestamp  = 7
+	typeLongLong   = 8
+	typeInt24      = 9
+	typeDate       = 10
+	typeTime       = 11
+	typeDatetime   = 12
+	typeYear       = 13
+	typeVarchar    = 15
+	typeBit        = 16
+	typeTimestamp2 = 17
+	typeDatetime2  = 18
+	typeTime2      = 19
+	typeJSON       = 245
+	typeNewDecimal = 246
+	typeEnum       = 247
+	typeSet        = 248
+	typeBlob       = 252
+	typeVarString  = 253
+	typeString     = 254
+	typeGeometry   = 255
+)
+
+// eventHeaderSize is the length of the common header of binlog events
+const eventHeaderSize = 19
+
+// eventHeader is the common header of binlog events
+type eventHeader struct {
+	Type byte
+	// LogPos is the position of the next event, 0 for artificial events
+	LogPos uint32
+}
+
+// tableMap describes the columns of the rows events that follow it
+type tableMap struct {
+	Schema   string
+	Table    string
+	Types    []byte
+	Metadata []uint16
+}
+
+// rowsEvent holds the row images of a rows event; updates have a before and
+// an after image per row, the others one image per row
+type rowsEvent struct {
+	Type  byte
+	Table *tableMap
+	Rows  [][]interface{}
+}
+
+// binlogParser decodes binlog events, keeping the state earlier events set up
+type binlogParser struct {
+	// checksum is whether events end with a CRC32
+	checksum bool
+	// tableIDSize is the length of table IDs, 6 bytes since MySQL 5.1
+	tableIDSize int
+	tables      map[uint64]*tableMap
+	location    *time.Location
+}
+
+func newBinlogParser(checksum bool, location *time.Location) *binlogParser {
+	return &binlogParser{
+		checksum:    checksum,
+		tableIDSize: 6,
+		tables:      make(map[uint64]*tableMap),
+		location:    location,
+	}
+}
+
+// header splits an event into its header and body, without the checksum
+func (p *binlogParser) header(event []byte) (eventHeader, []byte, error) {
+	if len(event) < eventHeaderSize {
+		return eventHeader{}, nil, errShortPacket
+	}
+	header := eventHeader{
+		Type:   event[4],
+		LogPos: binary.LittleEndian.Uint32(event[13:17]),
+	}
+	body := event[eventHeaderSize:]
+
+	// The format description carries its own checksum algorithm, its body is kept whole
+	if p.checksum && header.Type != formatDescriptionEvent {
+		if len(body) < 4 {
+			return eventHeader{}, nil, errShortPacket
+		}
+		body = body[:len(body)-4]
+	}
+	return header, body, nil
+}
+
+// formatDescription reads the checksum algorithm and the table ID size
+func (p *binlogParser) formatDescription(body []byte) error {
+	// Binlog version, server version, creation time, header length, then one
+	// post-header length per event type, the checksum algorithm and a checksum
+	const fixed = 2 + 50 + 4 + 1
+	if len(body) < fixed+5 {
+		return errShortPacket
+	}
+	p.checksum = body[len(body)-5] == 1
+
+	postHeaders := body[fixed : len(body)-5]
+	if len(postHeaders) >= tableMapEvent && postHeaders[tableMapEvent-1] == 6 {
+		p.tableIDSize = 4
+	} else {
+		p.tableIDSize = 6
+	}
+	return nil
+}
+
+// rotate returns the binlog file and position a rotate event points to
+func (p *binlogParser) rotate(body []byte) (string, uint32, error) {
+	d := &decoder{data: body}
+	pos := d.uint64()
+	file := string(d.rest())
+	if d.err != nil {
+		return "", 0, d.err
+	}
+	return file, uint32(pos), nil
+}
+
+// query returns the statement of a query event
+func (p *binlogParser) query(body []byte) (string, error) {
+	d := &decoder{data: body}
+	d.skip(4 + 4) // thread id, execution time
+	schemaLength := int(d.uint8())
+	d.skip(2) // error code
+	statusLength := int(d.uint16())
+	d.skip(statusLength + schemaLength + 1)
+	query := string(d.rest())
+	if d.err != nil {
+		return "", d.err
+	}
+	return query, nil
+}
+
+// tableMap records the table and column types of the rows events that follow
+func (p *binlogParser) tableMap(body []byte) error {
+	d := &decoder{data: body}
+	id := d.uint(p.tableIDSize)
+	d.skip(2) // flags
+	schema := string(d.bytes(int(d.uint8())))
+	d.skip(1)
+	table := string(d.bytes(int(d.uint8())))
+	d.skip(1)
+	types := append([]byte(nil), d.bytes(int(d.lenenc()))...)
+	meta := &decoder{data: d.bytes(int(d.lenenc()))}
+	if d.err != nil {
+		return d.err
+	}
+
+	metadata := make([]uint16, len(types))
+	for i, columnType := range types {
+		metadata[i] = columnMeta(meta, columnType)
+	}
+	if meta.err != nil {
+		return meta.err
+	}
+
+	p.tables[id] = &tableMap{Schema: schema, Table: table, Types: types, Metadata: metadata}
+	return nil
+}
+
+// columnMeta reads the metadata of a column type
+func columnMeta(d *decoder, columnType byte) uint16 {
+	switch columnType {
+	case typeFloat, typeDouble, typeBlob, typeGeometry, typeJSON,
+		typeTimestamp2, typeDatetime2, typeTime2:
+		return uint16(d.uint8())
+	case typeVarchar, typeVarString, typeBit:
+		return d.uint16()
+	case typeNewDecimal, typeString, typeEnum, typeSet:
+		// Precision and scale, or the real type and length, most significant first
+		b := d.bytes(2)
+		if b == nil {
+			return 0
+		}
+		return uint16(b[0])<<8 | uint16(b[1])
+	default:
+		return 0
+	}
+}
+
+// rows decodes the row images of a rows event. Rows of tables without a
+// preceding table map, which can't happen in a well-formed binlog, are an error.
+func (p *binlogParser) rows(eventType byte, body []byte) (*rowsEvent, error) {
+	d := &decoder{data: body}
+	id := d.uint(p.tableIDSize)
+	d.skip(2) // flags
+	switch eventType {
+	case writeRowsEventV2, updateRowsEventV2, deleteRowsEventV2:
+		extra := int(d.uint16())
+		d.skip(extra - 2)
+	}
+	count := int(d.lenenc())
+	present := d.bytes((count + 7) / 8)
+	presentAfter := present
+	update := eventType == updateRowsEventV1 || eventType == updateRowsEventV2
+	if update {
+		presentAfter = d.bytes((count + 7) / 8)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	table, ok := p.tables[id]
+	if !ok {
+		return nil, fmt.Errorf("rows event for unknown table id %d", id)
+	}
+	if count != len(table.Types) {
+		return nil, fmt.Errorf("rows event of %s.%s has %d columns, its table map %d", table.Schema, table.Table, count, len(table.Types))
+	}
+
+	event := &rowsEvent{Type: eventType, Table: table}
+	for d.remaining() > 0 {
+		row, err := p.row(d, table, present)
+		if err != nil {
+			return nil, err
+		}
+		event.Rows = append(event.Rows, row)
+
+		if update {
+			row, err := p.row(d, table, presentAfter)
+			if err != nil {
+				return nil, err
+			}
+			event.Rows = append(event.Rows, row)
+		}
+	}
+	return event, nil
+}
+
+// row decodes one row image, columns missing from the image are nil
+func (p *binlogParser) row(d *decoder, table *tableMap, present []byte) ([]interface{}, error) {
+	included := 0
+	for i := range table.Types {
+		if bit(present, i) {
+			included++
+		}
+	}
+	nulls := d.bytes((included + 7) / 8)
+
+	row := make([]interface{}, len(table.Types))
+	n := 0
+	for i, columnType := range table.Types {
+		if !bit(present, i) {
+			continue
+		}
+		null := bit(nulls, n)
+		n++
+		if null {
+			continue
+		}
+
+		value, err := p.value(d, columnType, table.Metadata[i])
+		if err != nil {
+			return nil, fmt.Errorf("column %d of %s.%s: %w", i+1, table.Schema, table.Table, err)
+		}
+		row[i] = value
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return row, nil
+}
+
+// value decodes a column value. Integers decode as signed, the binlog doesn't
+// record signedness; JSON and spatial values decode as nil.
+func (p *binlogParser) value(d *decoder, columnType byte, meta uint16) (interface{}, error) {
+	// Short CHAR columns and ENUM and SET columns are logged as strings with their real type in the metadata
+	if columnType == typeString && meta >= 256 {
+		realType := byte(meta >> 8)
+		length := int(meta & 0xff)
+		if realType&0x30 != 0x30 {
+			// Lengths over 255 borrow two bits of the type
+			length |= int((realType&0x30)^0x30) << 4
+			realType |= 0x30
+		}
+		switch realType {
+		case typeEnum, typeSet:
+			columnType = realType
+			meta = uint16(length)
+		default:
+			meta = uint16(length)
+		}
+	}
+
+	switch columnType {
+	case typeTiny:
+		return int64(int8(d.uint8())), d.err
+	case typeShort:
+		return int64(int16(d.uint16())), d.err
+	case typeInt24:
+		v := d.uint(3)
+		if v&0x800000 != 0 {
+			v |= 0xffffffffff000000
+		}
+		return int64(v), d.err
+	case typeLong:
+		return int64(int32(d.uint32())), d.err
+	case typeLongLong:
+		return int64(d.uint64()), d.err
+	case typeFloat:
+		return float64(math.Float32frombits(d.uint32())), d.err
+	case typeDouble:
+		return math.Float64frombits(d.uint64()), d.err
+	case typeYear:
+		year := d.uint8()
+		if year == 0 {
+			return int64(0), d.err
+		}
+		return int64(year) + 1900, d.err
+	case typeNewDecimal:
+		return decodeDecimal(d, int(meta>>8), int(meta&0xff)), d.err
+	case typeDate:
+		v := d.uint(3)
+		if v == 0 {
+			return nil, d.err
+		}
+		return time.Date(int(v>>9), time.Month(v>>5&15), int(v&31), 0, 0, 0, 0, p.location), d.err
+	case typeTimestamp:
+		return time.Unix(int64(d.uint32()), 0).In(p.location), d.err
+	case typeTimestamp2:
+		seconds := int64(d.bigEndian(4))
+		micros := fraction(d, int(meta))
+		return time.Unix(seconds, micros*1000).In(p.location), d.err
+	case typeDatetime:
+		v := d.uint64()
+		if v == 0 {
+			return nil, d.err
+		}
+		date, clock := int(v/1000000), int(v%1000000)
+		return time.Date(date/10000, time.Month(date/100%100), date%100,
+			clock/10000, clock/100%100, clock%100, 0, p.location), d.err
+	case typeDatetime2:
+		return p.datetime2(d, int(meta)), d.err
+	case typeTime:
+		v := int64(d.uint(3))
+		if v&0x800000 != 0 {
+			v -= 1 << 24
+		}
+		sign := ""
+		if v < 0 {
+			sign, v = "-", -v
+		}
+		return fmt.Sprintf("%s%02d:%02d:%02d", sign, v/10000, v/100%100, v%100), d.err
+	case typeTime2:
+		return time2(d, int(meta)), d.err
+	case typeVarchar, typeVarString, typeString:
+		var length int
+		if meta < 256 {
+			length = int(d.uint8())
+		} else {
+			length = int(d.uint16())
+		}
+		return string(d.bytes(length)), d.err
+	case typeEnum, typeSet:
+		// The index of the value, or a bitmask of the members
+		return int64(d.uint(int(meta & 0xff))), d.err
+	case typeBit:
+		bits := int(meta>>8)*8 + int(meta&0xff)
+		return int64(d.bigEndian((bits + 7) / 8)), d.err
+	case typeBlob:
+		return string(d.bytes(int(d.uint(int(meta))))), d.err
+	case typeJSON, typeGeometry:
+		d.skip(int(d.uint(int(meta))))
+		return nil, d.err
+	case typeNull:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported column type %d", columnType)
+	}
+}
+
+// datetime2 decodes a DATETIME with fractional seconds, zero dates as nil
+func (p *binlogParser) datetime2(d *decoder, fsp int) interface{} {
+	packed := int64(d.bigEndian(5)) - 0x8000000000
+	micros := fraction(d, fsp)
+	if packed == 0 {
+		return nil
+	}
+
+	ymd, hms := packed>>17, packed%(1<<17)
+	ym := ymd >> 5
+	return time.Date(int(ym/13), time.Month(ym%13), int(ymd%(1<<5)),
+		int(hms>>12), int(hms>>6%(1<<6)), int(hms%(1<<6)), int(micros*1000), p.location)
+}
+
+// time2 decodes a TIME with fractional seconds as "hh:mm:ss[.ffffff]"
+func time2(d *decoder, fsp int) string {
+	var packed int64
+	switch fsp {
+	case 1, 2:
+		packed = int64(d.bigEndian(3)) - 0x800000
+		frac := int64(d.uint8())
+		if packed < 0 && frac != 0 {
+			packed++
+			frac -= 0x100
+		}
+		packed = packed<<24 + frac*10000
+	case 3, 4:
+		packed = int64(d.bigEndian(3)) - 0x800000
+		frac := int64(d.bigEndian(2))
+		if packed < 0 && frac != 0 {
+			packed++
+			frac -= 0x10000
+		}
+		packed = packed<<24 + frac*100
+	case 5, 6:
+		packed = int64(d.bigEndian(6)) - 0x800000000000
+	default:
+		packed = (int64(d.bigEndian(3)) - 0x800000) << 24
+	}
+
+	sign := ""
+	if packed < 0 {
+		sign, packed = "-", -packed
+	}
+	hms, micros := packed>>24, packed%(1<<24)
+	value := fmt.Sprintf("%s%02d:%02d:%02d", sign, hms>>12%(1<<10), hms>>6%(1<<6), hms%(1<<6))
+	if micros != 0 {
+		value += fmt.Sprintf(".%06d", micros)
+	}
+	return value
+}
+
+// fraction reads the fractional seconds of a temporal value as microseconds
+func fraction(d *decoder, fsp int) int64 {
+	switch fsp {
+	case 1, 2:
+		return int64(d.bigEndian(1)) * 10000
+	case 3, 4:
+		return int64(d.bigEndian(2)) * 100
+	case 5, 6:
+		return int64(d.bigEndian(3))
+	default:
+		return 0
+	}
+}
+
+// decimalBytes is the length of a group of 0 to 9 decimal digits
+var decimalBytes = [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// decodeDecimal decodes a DECIMAL as a string, e.g. "-12.50". Digits are
+// stored in groups of nine per four bytes, the sign in the first bit.
+func decodeDecimal(d *decoder, precision, scale int) string {
+	integral := precision - scale
+	fullIntegral, partialIntegral := integral/9, integral%9
+	fullFractional, partialFractional := scale/9, scale%9
+	size := fullIntegral*4 + decimalBytes[partialIntegral] + fullFractional*4 + decimalBytes[partialFractional]
+
+	raw := d.bytes(size)
+	if raw == nil || size == 0 {
+		return "0"
+	}
+	data := append([]byte(nil), raw...)
+	negative := data[0]&0x80 == 0
+	data[0] ^= 0x80
+	if negative {
+		for i := range data {
+			data[i] ^= 0xff
+		}
+	}
+	digits := &decoder{data: data}
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	started := false
+	if partialIntegral > 0 {
+		if v := digits.bigEndian(decimalBytes[partialIntegral]); v != 0 {
+			b.WriteString(strconv.FormatUint(v, 10))
+			started = true
+		}
+	}
+	for i := 0; i < fullIntegral; i++ {
+		v := digits.bigEndian(4)
+		switch {
+		case started:
+			fmt.Fprintf(&b, "%09d", v)
+		case v != 0:
+			b.WriteString(strconv.FormatUint(v, 10))
+			started = true
+		}
+	}
+	if !started {
+		b.WriteByte('0')
+	}
+
+	if scale > 0 {
+		b.WriteByte('.')
+		for i := 0; i < fullFractional; i++ {
+			fmt.Fprintf(&b, "%09d", digits.bigEndian(4))
+		}
+		if partialFractional > 0 {
+			fmt.Fprintf(&b, "%0*d", partialFractional, digits.bigEndian(decimalBytes[partialFractional]))
+		}
+	}
+	return b.String()
+}
+
+// bit reports whether bit i of a bitmap is set
+func bit(bitmap []byte, i int) bool {
+	return i/8 < len(bitmap) && bitmap[i/8]&(1<<(i%8)) != 0
+}
+
+// decoder reads little-endian protocol values, recording the first error
+// instead of panicking on short input
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.pos+n > len(d.data) {
+		d.err = errShortPacket
+		return nil
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) skip(n int) {
+	d.bytes(n)
+}
+
+func (d *decoder) remaining() int {
+	if d.err != nil {
+		return 0
+	}
+	return len(d.data) - d.pos
+}
+
+func (d *decoder) rest() []byte {
+	return d.bytes(d.remaining())
+}
+
+// uint reads an n byte little-endian integer
+func (d *decoder) uint(n int) uint64 {
+	var v uint64
+	for i, b := range d.bytes(n) {
+		v |= uint64(b) << (8 * i)
+	}
+	return v
+}
+
+// bigEndian reads an n byte big-endian integer
+func (d *decoder) bigEndian(n int) uint64 {
+	var v uint64
+	for _, b := range d.bytes(n) {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func (d *decoder) uint8() uint8   { return uint8(d.uint(1)) }
+func (d *decoder) uint16() uint16 { return uint16(d.uint(2)) }
+func (d *decoder) uint32() uint32 { return uint32(d.uint(4)) }
+func (d *decoder) uint64() uint64 { return d.uint(8) }
+
+// lenenc reads a length-encoded integer
+func (d *decoder) lenenc() uint64 {
+	switch first := d.uint8(); first {
+	case 0xfc:
+		return d.uint(2)
+	case 0xfd:
+		return d.uint(3)
+	case 0xfe:
+		return d.uint(8)
+	default:
+		return uint64(first)
+	}
+}
+
+// nullString reads a NUL terminated string
+func (d *decoder) nullString() string {
+	if d.err != nil {
+		return ""
+	}
+	for i := d.pos; i < len(d.data); i++ {
+		if d.data[i] == 0 {
+			s := string(d.data[d.pos:i])
+			d.pos = i + 1
+			return s
+		}
+	}
+	d.err = errShortPacket
+	return ""
+}
@@ -0,0 +1,66 @@
+package cdc
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeDecimal(t *testing.T) {
+	tests := []struct {
+		data             string
+		precision, scale int
+		want             string
+	}{
+		{"810dfb38d204d2", 14, 4, "1234567890.1234"},
+		{"7ef204c72dfb2d", 14, 4, "-1234567890.1234"},
+		{"800000", 5, 2, "0.00"},
+	}
+
+	for _, tt := range tests {
+		data, _ := hex.DecodeString(tt.data)
+		d := &decoder{data: data}
+		if got := decodeDecimal(d, tt.precision, tt.scale); got != tt.want || d.err != nil {
+			t.Errorf("decodeDecimal(%s) = %q, %v, want %q", tt.data, got, d.err, tt.want)
+		}
+	}
+}
+
+func TestDecodeDatetime2(t *testing.T) {
+	data, _ := hex.DecodeString("998714a28a")
+	p := newBinlogParser(false, time.UTC)
+
+	got, err := p.value(&decoder{data: data}, typeDatetime2, 0)
+	want := time.Date(2010, 10, 10, 10, 10, 10, 0, time.UTC)
+	if err != nil || got != want {
+		t.Errorf("value() = %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestDecodeRows(t *testing.T) {
+	p := newBinlogParser(false, time.UTC)
+
+	// app.users (BIGINT, VARCHAR(100), DATETIME(3), DECIMAL(14,4))
+	tableMap, _ := hex.DecodeString("010000000000" + "0000" + "03617070" + "00" + "057573657273" + "00" +
+		"04" + "080f12f6" + "05" + "6400" + "03" + "0e04" + "00")
+	if err := p.tableMap(tableMap); err != nil {
+		t.Fatalf("tableMap() error = %v", err)
+	}
+
+	// One row with the DATETIME null
+	rows, _ := hex.DecodeString("010000000000" + "0000" + "0200" + "04" + "0f" +
+		"04" + "2a00000000000000" + "05616c696365" + "810dfb38d204d2")
+	event, err := p.rows(writeRowsEventV2, rows)
+	if err != nil {
+		t.Fatalf("rows() error = %v", err)
+	}
+
+	if event.Table.Schema != "app" || event.Table.Table != "users" {
+		t.Errorf("table = %s.%s, want app.users", event.Table.Schema, event.Table.Table)
+	}
+	want := [][]interface{}{{int64(42), "alice", nil, "1234567890.1234"}}
+	if !reflect.DeepEqual(event.Rows, want) {
+		t.Errorf("rows = %v, want %v", event.Rows, want)
+	}
+}
@@ -0,0 +1,394 @@
+package cdc
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// Capability flags sent by the replication client
+const (
+	clientLongPassword     = 0x00000001
+	clientLongFlag         = 0x00000004
+	clientProtocol41       = 0x00000200
+	clientTransactions     = 0x00002000
+	clientSecureConnection = 0x00008000
+	clientPluginAuth       = 0x00080000
+)
+
+// Commands of the client/server protocol
+const (
+	comQuery      = 0x03
+	comBinlogDump = 0x12
+)
+
+// Packet headers
+const (
+	packetOK  = 0x00
+	packetEOF = 0xfe
+	packetErr = 0xff
+)
+
+// maxPacketSize is the largest payload of a single packet, longer payloads are split
+const maxPacketSize = 1<<24 - 1
+
+// utf8mb4GeneralCI is the connection collation
+const utf8mb4GeneralCI = 45
+
+// handshakeTimeout bounds connecting and authenticating
+const handshakeTimeout = 10 * time.Second
+
+var errShortPacket = errors.New("malformed packet")
+
+// mysqlConn speaks just enough of the MySQL client/server protocol to
+// authenticate and stream the binary log, which database/sql doesn't expose
+type mysqlConn struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	sequence byte
+}
+
+// dialMySQL connects and authenticates to the database server
+func dialMySQL(ctx context.Context, cfg *config.DatabaseConfig) (*mysqlConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &mysqlConn{conn: conn, reader: bufio.NewReaderSize(conn, 64<<10)}
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := c.handshake(cfg.User, cfg.Password.Reveal()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// Close closes the connection
+func (c *mysqlConn) Close() error {
+	return c.conn.Close()
+}
+
+// setReadDeadline bounds the next reads
+func (c *mysqlConn) setReadDeadline(deadline time.Time) error {
+	return c.conn.SetReadDeadline(deadline)
+}
+
+// handshake answers the server's greeting and completes authentication
+func (c *mysqlConn) handshake(user, password string) error {
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if packet[0] == packetErr {
+		return packetError(packet)
+	}
+	if packet[0] != 10 {
+		return fmt.Errorf("unsupported protocol version %d", packet[0])
+	}
+
+	d := &decoder{data: packet[1:]}
+	d.nullString() // server version
+	d.skip(4)      // connection id
+	scramble := append([]byte(nil), d.bytes(8)...)
+	d.skip(1)
+	capabilities := uint32(d.uint16())
+	plugin := "mysql_native_password"
+	if d.remaining() > 0 {
+		d.skip(3) // character set and status
+		capabilities |= uint32(d.uint16()) << 16
+		dataLength := int(d.uint8())
+		d.skip(10)
+		if capabilities&clientSecureConnection != 0 {
+			// The rest of the scramble, NUL terminated
+			part := d.bytes(max(13, dataLength-8))
+			if len(part) > 0 {
+				scramble = append(scramble, part[:len(part)-1]...)
+			}
+		}
+		if capabilities&clientPluginAuth != 0 {
+			plugin = d.nullString()
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("failed to read handshake: %w", d.err)
+	}
+	if capabilities&clientProtocol41 == 0 {
+		return errors.New("server doesn't support protocol 4.1")
+	}
+
+	auth, err := scramblePassword(plugin, password, scramble)
+	if err != nil {
+		return err
+	}
+
+	response := binary.LittleEndian.AppendUint32(nil, clientLongPassword|clientLongFlag|clientProtocol41|
+		clientTransactions|clientSecureConnection|clientPluginAuth)
+	response = binary.LittleEndian.AppendUint32(response, maxPacketSize)
+	response = append(response, utf8mb4GeneralCI)
+	response = append(response, make([]byte, 23)...)
+	response = append(append(response, user...), 0)
+	response = append(append(response, byte(len(auth))), auth...)
+	response = append(append(response, plugin...), 0)
+	if err := c.writePacket(response); err != nil {
+		return err
+	}
+
+	return c.authResult(plugin, password, scramble)
+}
+
+// authResult reads the server's answers until authentication succeeds or fails,
+// following auth switches and caching_sha2_password's full authentication
+func (c *mysqlConn) authResult(plugin, password string, scramble []byte) error {
+	for {
+		packet, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+
+		switch packet[0] {
+		case packetOK:
+			return nil
+		case packetErr:
+			return packetError(packet)
+		case packetEOF:
+			// Auth switch request
+			d := &decoder{data: packet[1:]}
+			plugin = d.nullString()
+			scramble = d.rest()
+			if n := len(scramble); n > 0 && scramble[n-1] == 0 {
+				scramble = scramble[:n-1]
+			}
+			auth, err := scramblePassword(plugin, password, scramble)
+			if err != nil {
+				return err
+			}
+			if err := c.writePacket(auth); err != nil {
+				return err
+			}
+		case 0x01:
+			if plugin != "caching_sha2_password" || len(packet) < 2 {
+				return errors.New("unexpected authentication data")
+			}
+			switch packet[1] {
+			case 3:
+				// Fast authentication succeeded, an OK packet follows
+			case 4:
+				// Full authentication, the password is sent encrypted with the server's public key
+				if err := c.writePacket([]byte{2}); err != nil {
+					return err
+				}
+				key, err := c.readPacket()
+				if err != nil {
+					return err
+				}
+				if key[0] != 0x01 {
+					return errors.New("server didn't send its public key")
+				}
+				encrypted, err := encryptPassword(password, scramble, key[1:])
+				if err != nil {
+					return err
+				}
+				if err := c.writePacket(encrypted); err != nil {
+					return err
+				}
+			default:
+				return errors.New("unexpected authentication data")
+			}
+		default:
+			return fmt.Errorf("unexpected packet 0x%02x during authentication", packet[0])
+		}
+	}
+}
+
+// exec runs a statement without a result set, e.g. SET
+func (c *mysqlConn) exec(query string) error {
+	if err := c.writeCommand(comQuery, []byte(query)); err != nil {
+		return err
+	}
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	switch packet[0] {
+	case packetOK:
+		return nil
+	case packetErr:
+		return packetError(packet)
+	default:
+		return fmt.Errorf("unexpected result set for %q", query)
+	}
+}
+
+// dumpBinlog asks the server to stream the binary log from a position
+func (c *mysqlConn) dumpBinlog(serverID uint32, position Position) error {
+	data := binary.LittleEndian.AppendUint32(nil, position.Pos)
+	data = binary.LittleEndian.AppendUint16(data, 0) // block waiting for new events
+	data = binary.LittleEndian.AppendUint32(data, serverID)
+	data = append(data, position.File...)
+	return c.writeCommand(comBinlogDump, data)
+}
+
+// readEvent returns the next event of a binlog dump
+func (c *mysqlConn) readEvent() ([]byte, error) {
+	packet, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	switch packet[0] {
+	case packetOK:
+		return packet[1:], nil
+	case packetErr:
+		return nil, packetError(packet)
+	case packetEOF:
+		return nil, io.EOF
+	default:
+		return nil, fmt.Errorf("unexpected packet 0x%02x in binlog stream", packet[0])
+	}
+}
+
+// writeCommand starts a new command
+func (c *mysqlConn) writeCommand(command byte, data []byte) error {
+	c.sequence = 0
+	return c.writePacket(append([]byte{command}, data...))
+}
+
+// readPacket reads a payload, joining the packets it was split into
+func (c *mysqlConn) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+			return nil, err
+		}
+		length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+		c.sequence = header[3] + 1
+
+		start := len(payload)
+		payload = append(payload, make([]byte, length)...)
+		if _, err := io.ReadFull(c.reader, payload[start:]); err != nil {
+			return nil, err
+		}
+		if length < maxPacketSize {
+			if len(payload) == 0 {
+				return nil, errShortPacket
+			}
+			return payload, nil
+		}
+	}
+}
+
+// writePacket writes a payload, splitting it into packets of maxPacketSize
+func (c *mysqlConn) writePacket(payload []byte) error {
+	for {
+		n := min(len(payload), maxPacketSize)
+		packet := make([]byte, 4+n)
+		packet[0], packet[1], packet[2], packet[3] = byte(n), byte(n>>8), byte(n>>16), c.sequence
+		copy(packet[4:], payload[:n])
+		c.sequence++
+
+		if _, err := c.conn.Write(packet); err != nil {
+			return err
+		}
+		payload = payload[n:]
+		// A payload of exactly maxPacketSize is terminated by an empty packet
+		if n < maxPacketSize {
+			return nil
+		}
+	}
+}
+
+// packetError converts an ERR packet
+func packetError(packet []byte) error {
+	d := &decoder{data: packet[1:]}
+	code := d.uint16()
+	message := d.rest()
+	if len(message) >= 6 && message[0] == '#' {
+		message = message[6:] // SQL state
+	}
+	if d.err != nil {
+		return fmt.Errorf("malformed error packet: %w", d.err)
+	}
+	return fmt.Errorf("mysql error %d: %s", code, message)
+}
+
+// scramblePassword answers the server's challenge for an authentication plugin
+func scramblePassword(plugin, password string, scramble []byte) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	if len(scramble) < 20 {
+		return nil, errors.New("malformed authentication challenge")
+	}
+
+	switch plugin {
+	case "mysql_native_password":
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		stage1 := sha1.Sum([]byte(password))
+		stage2 := sha1.Sum(stage1[:])
+		h := sha1.New()
+		h.Write(scramble[:20])
+		h.Write(stage2[:])
+		out := h.Sum(nil)
+		for i := range out {
+			out[i] ^= stage1[i]
+		}
+		return out, nil
+	case "caching_sha2_password":
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		stage1 := sha256.Sum256([]byte(password))
+		stage2 := sha256.Sum256(stage1[:])
+		h := sha256.New()
+		h.Write(stage2[:])
+		h.Write(scramble[:20])
+		out := h.Sum(nil)
+		for i := range out {
+			out[i] ^= stage1[i]
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported authentication plugin %q", plugin)
+	}
+}
+
+// encryptPassword encrypts the password for caching_sha2_password's full
+// authentication over an unencrypted connection
+func encryptPassword(password string, scramble, pemKey []byte) ([]byte, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("malformed server public key")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("malformed server public key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("server public key isn't an RSA key")
+	}
+	if len(scramble) == 0 {
+		return nil, errors.New("malformed authentication challenge")
+	}
+
+	plain := append([]byte(password), 0)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, key, plain, nil)
+}
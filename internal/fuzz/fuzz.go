@@ -0,0 +1,336 @@
+package fuzz
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// ExpectedCodes are the status codes handlers may answer any input with.
+// Internal and Unknown mean an error wasn't mapped or a handler panicked,
+// DeadlineExceeded that it hung.
+var ExpectedCodes = map[codes.Code]bool{
+	codes.OK:                 true,
+	codes.InvalidArgument:    true,
+	codes.NotFound:           true,
+	codes.AlreadyExists:      true,
+	codes.PermissionDenied:   true,
+	codes.Unauthenticated:    true,
+	codes.FailedPrecondition: true,
+	codes.OutOfRange:         true,
+	codes.ResourceExhausted:  true,
+	codes.Aborted:            true,
+	codes.Unimplemented:      true,
+}
+
+// undecodable is the start of the message gRPC answers requests it can't decode with
+const undecodable = "grpc: error unmarshalling request"
+
+// Credentials are the tokens calls are made with, each call picks one of them
+// or none at random, so handlers see anonymous, regular and admin callers
+type Credentials map[string]string
+
+// Options control a fuzzing run
+type Options struct {
+	// Iterations is the number of calls per method
+	Iterations int
+	// Mutated is the share of calls whose encoded request is corrupted
+	Mutated float64
+	// Timeout bounds each call
+	Timeout time.Duration
+	// Credentials are the tokens calls are made with by caller name
+	Credentials Credentials
+	// Recoverer is the recoverer the services are served behind
+	Recoverer *Recoverer
+}
+
+// Finding is a call that panicked or ended with an unexpected status code
+type Finding struct {
+	Method string
+	Code   codes.Code
+	// Message is the status message, or the panic for panics
+	Message string
+	// Caller is the name of the credentials the call was made with
+	Caller string
+	// Input is the request as protojson, or hex for corrupted requests
+	Input string
+	// Stack is the stack of a panic
+	Stack string
+	// Count is the number of calls with the same outcome
+	Count int
+}
+
+// Panicked reports whether the finding is a panic
+func (f *Finding) Panicked() bool {
+	return f.Stack != ""
+}
+
+// MethodReport summarizes the calls of a method
+type MethodReport struct {
+	Method string
+	Calls  int
+	Codes  map[codes.Code]int
+}
+
+// Report is the outcome of a fuzzing run
+type Report struct {
+	Methods  []*MethodReport
+	Findings []*Finding
+}
+
+// Failed reports whether any call panicked or ended with an unexpected code
+func (r *Report) Failed() bool {
+	return len(r.Findings) > 0
+}
+
+// Print writes the calls per method and the findings
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "%-55s %6s  %s\n", "method", "calls", "codes")
+	for _, m := range r.Methods {
+		names := make([]string, 0, len(m.Codes))
+		for code, count := range m.Codes {
+			names = append(names, fmt.Sprintf("%s=%d", code, count))
+		}
+		sort.Strings(names)
+		fmt.Fprintf(w, "%-55s %6d  %s\n", m.Method, m.Calls, strings.Join(names, " "))
+	}
+
+	for _, finding := range r.Findings {
+		kind := "unexpected " + finding.Code.String()
+		if finding.Panicked() {
+			kind = "panic"
+		}
+		fmt.Fprintf(w, "\n%s in %s (%d calls)\n", kind, finding.Method, finding.Count)
+		fmt.Fprintf(w, "  message: %s\n", finding.Message)
+		fmt.Fprintf(w, "  caller:  %s\n", finding.Caller)
+		fmt.Fprintf(w, "  input:   %s\n", truncate(finding.Input, 2000))
+		if finding.Panicked() {
+			fmt.Fprintf(w, "  stack:\n%s\n", finding.Stack)
+		}
+	}
+}
+
+// Recoverer turns handler panics into Internal errors and keeps their stacks,
+// so a run can report them instead of the process crashing
+type Recoverer struct {
+	mu     sync.Mutex
+	panics map[string]string
+}
+
+// NewRecoverer creates a recoverer
+func NewRecoverer() *Recoverer {
+	return &Recoverer{panics: make(map[string]string)}
+}
+
+// recoveredKey is the metadata key the recoverer matches panics to calls with
+const recoveredKey = "x-fuzz-call"
+
+// Interceptor recovers panics of unary handlers
+func (r *Recoverer) Interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				var call string
+				if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(recoveredKey)) > 0 {
+					call = md.Get(recoveredKey)[0]
+				}
+				r.mu.Lock()
+				r.panics[call] = fmt.Sprintf("%v\n%s", recovered, debug.Stack())
+				r.mu.Unlock()
+				err = status.Errorf(codes.Internal, "panic: %v", recovered)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// take returns and forgets the panic of a call
+func (r *Recoverer) take(call string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stack, ok := r.panics[call]
+	delete(r.panics, call)
+	return stack, ok
+}
+
+// Methods returns the unary methods of services, e.g. "auth.AuthService".
+// The services' generated packages must be linked into the binary.
+func Methods(services ...string) ([]protoreflect.MethodDescriptor, error) {
+	var methods []protoreflect.MethodDescriptor
+	for _, name := range services {
+		desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			return nil, fmt.Errorf("unknown service %s: %w", name, err)
+		}
+		service, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s isn't a service", name)
+		}
+		for i := 0; i < service.Methods().Len(); i++ {
+			method := service.Methods().Get(i)
+			if !method.IsStreamingClient() && !method.IsStreamingServer() {
+				methods = append(methods, method)
+			}
+		}
+	}
+	return methods, nil
+}
+
+// Run calls each method with generated requests over conn. Calls whose
+// handler panicked, which must be served behind the Recoverer, or that ended
+// with a code outside ExpectedCodes are reported as findings, once per method,
+// code and message.
+func Run(ctx context.Context, conn grpc.ClientConnInterface, gen *Generator, methods []protoreflect.MethodDescriptor, opts Options) (*Report, error) {
+	callers := []string{"anonymous"}
+	for name := range opts.Credentials {
+		callers = append(callers, name)
+	}
+	sort.Strings(callers[1:])
+
+	report := &Report{}
+	findings := make(map[string]*Finding)
+	calls := 0
+
+	for _, method := range methods {
+		fullName := fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name())
+		reqType, err := protoregistry.GlobalTypes.FindMessageByName(method.Input().FullName())
+		if err != nil {
+			return nil, err
+		}
+		respType, err := protoregistry.GlobalTypes.FindMessageByName(method.Output().FullName())
+		if err != nil {
+			return nil, err
+		}
+
+		methodReport := &MethodReport{Method: fullName, Codes: make(map[codes.Code]int)}
+		report.Methods = append(report.Methods, methodReport)
+
+		for i := 0; i < opts.Iterations; i++ {
+			calls++
+			call := fmt.Sprint(calls)
+			caller := callers[gen.rand.IntN(len(callers))]
+
+			callCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+			callCtx = metadata.AppendToOutgoingContext(callCtx, recoveredKey, call)
+			if token := opts.Credentials[caller]; token != "" {
+				callCtx = metadata.AppendToOutgoingContext(callCtx, "authorization", "Bearer "+token)
+			}
+
+			req := reqType.New().Interface()
+			gen.Fill(req)
+
+			var input string
+			mutated := gen.rand.Float64() < opts.Mutated
+			if mutated {
+				data, marshalErr := proto.Marshal(req)
+				if marshalErr != nil {
+					cancel()
+					return nil, marshalErr
+				}
+				data = gen.Mutate(data)
+				input = hex.EncodeToString(data)
+				var resp []byte
+				err = conn.Invoke(callCtx, fullName, data, &resp, grpc.ForceCodec(rawCodec{}))
+			} else {
+				input = marshalInput(req)
+				err = conn.Invoke(callCtx, fullName, req, respType.New().Interface())
+			}
+			cancel()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			methodReport.Calls++
+			code := status.Code(err)
+			methodReport.Codes[code]++
+
+			stack, panicked := opts.Recoverer.take(call)
+			if !panicked && ExpectedCodes[code] {
+				continue
+			}
+			// Corrupted requests the server can't decode are rejected as expected
+			if !panicked && mutated && code == codes.Internal && strings.HasPrefix(status.Convert(err).Message(), undecodable) {
+				continue
+			}
+
+			message := status.Convert(err).Message()
+			key := fullName + "\x00" + code.String() + "\x00" + message
+			if finding, ok := findings[key]; ok {
+				finding.Count++
+				continue
+			}
+			finding := &Finding{
+				Method:  fullName,
+				Code:    code,
+				Message: message,
+				Caller:  caller,
+				Input:   input,
+				Stack:   stack,
+				Count:   1,
+			}
+			findings[key] = finding
+			report.Findings = append(report.Findings, finding)
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].Panicked() && !report.Findings[j].Panicked()
+	})
+	return report, nil
+}
+
+// marshalInput returns a request as protojson for the report
+func marshalInput(req proto.Message) string {
+	data, err := protojson.Marshal(req)
+	if err != nil {
+		return fmt.Sprintf("%v", req)
+	}
+	return string(data)
+}
+
+// truncate shortens long inputs in the report
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return fmt.Sprintf("%s... (%d bytes)", s[:n], len(s))
+}
+
+// rawCodec sends already encoded requests, so corrupted ones reach the server
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	data, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("raw codec can't encode %T", v)
+	}
+	return data, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	out, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("raw codec can't decode into %T", v)
+	}
+	*out = append((*out)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
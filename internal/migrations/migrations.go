@@ -0,0 +1,118 @@
+package migrations
+
+import (
+	authrepo "github.com/linkeunid/hello-go/internal/auth/repository"
+	"github.com/linkeunid/hello-go/internal/cdc"
+	userrepo "github.com/linkeunid/hello-go/internal/user/repository"
+	"github.com/linkeunid/hello-go/pkg/autotls"
+	"github.com/linkeunid/hello-go/pkg/events"
+	"github.com/linkeunid/hello-go/pkg/jobs"
+	"github.com/linkeunid/hello-go/pkg/mail"
+	"github.com/linkeunid/hello-go/pkg/metering"
+	"github.com/linkeunid/hello-go/pkg/migrate"
+	"github.com/linkeunid/hello-go/pkg/notification"
+	"github.com/linkeunid/hello-go/pkg/operations"
+	"github.com/linkeunid/hello-go/pkg/revocation"
+)
+
+// Migrations lists the schema migrations in the order they are applied.
+//
+// Every change is split into an expand migration, applied before the new
+// binary is rolled out, and a contract migration, applied once the old
+// binary has been retired. For example, adding a required column:
+//
+//	{ID: "0001_add_users_locale", Phase: migrate.PhaseExpand, Steps: []migrate.Step{
+//		migrate.AddColumn{Table: "users", Column: "locale", Type: "varchar(16)"},
+//		migrate.Backfill{Table: "users", Column: "locale", Value: "'en'"},
+//	}},
+//	{ID: "0002_require_users_locale", Phase: migrate.PhaseContract, Steps: []migrate.Step{
+//		migrate.SetNotNull{Table: "users", Column: "locale", Type: "varchar(16)"},
+//	}},
+var Migrations = []migrate.Migration{
+	{ID: "0001_add_users_presence", Phase: migrate.PhaseExpand, Steps: []migrate.Step{
+		migrate.AddColumn{Table: "users", Column: "last_seen_at", Type: "datetime(3)"},
+		migrate.AddColumn{Table: "users", Column: "presence_visibility", Type: "varchar(10)", Default: "''"},
+	}},
+	{ID: "0002_add_users_custom_fields", Phase: migrate.PhaseExpand, Steps: []migrate.Step{
+		migrate.AddColumn{Table: "users", Column: "custom_fields", Type: "json"},
+	}},
+	{ID: "0003_add_refresh_tokens_client_type", Phase: migrate.PhaseExpand, Steps: []migrate.Step{
+		migrate.AddColumn{Table: "refresh_tokens", Column: "client_type", Type: "varchar(20)", Default: "''"},
+	}},
+	{ID: "0004_add_users_tokens_valid_after", Phase: migrate.PhaseExpand, Steps: []migrate.Step{
+		migrate.AddColumn{Table: "users", Column: "tokens_valid_after", Type: "datetime(3)"},
+	}},
+	{ID: "0005_add_refresh_tokens_authenticated_at", Phase: migrate.PhaseExpand, Steps: []migrate.Step{
+		migrate.AddColumn{Table: "refresh_tokens", Column: "authenticated_at", Type: "datetime(3)"},
+	}},
+	{ID: "0006_add_events_data_schema", Phase: migrate.PhaseExpand, Steps: []migrate.Step{
+		migrate.AddColumn{Table: "events", Column: "data_schema", Type: "varchar(100)", Default: "''"},
+	}},
+	{ID: "0007_add_users_listing_indexes", Phase: migrate.PhaseExpand, Steps: []migrate.Step{
+		migrate.AddIndex{Table: "users", Name: "idx_users_status", Columns: []string{"status"}},
+		migrate.AddIndex{Table: "users", Name: "idx_users_created_at_id", Columns: []string{"created_at", "id"}},
+	}},
+	{ID: "0008_add_users_email_index", Phase: migrate.PhaseContract, Steps: []migrate.Step{
+		migrate.AddIndex{Table: "users", Name: "idx_users_email", Columns: []string{"email"}, Unique: true},
+	}},
+	{ID: "0009_add_tenant_id", Phase: migrate.PhaseExpand, Steps: []migrate.Step{
+		migrate.AddColumn{Table: "users", Column: "tenant_id", Type: "varchar(36)", Default: "'default'"},
+		migrate.AddIndex{Table: "users", Name: "idx_users_tenant_id", Columns: []string{"tenant_id"}},
+		migrate.AddColumn{Table: "invites", Column: "tenant_id", Type: "varchar(36)", Default: "'default'"},
+		migrate.AddColumn{Table: "organizations", Column: "tenant_id", Type: "varchar(36)", Default: "'default'"},
+		migrate.AddIndex{Table: "organizations", Name: "idx_organizations_tenant_id", Columns: []string{"tenant_id"}},
+	}},
+	// Emails are unique per tenant, the same email can sign up with several tenants
+	{ID: "0010_scope_users_email_to_tenant", Phase: migrate.PhaseContract, Steps: []migrate.Step{
+		migrate.AddIndex{Table: "users", Name: "idx_users_email_tenant_id", Columns: []string{"email", "tenant_id"}, Unique: true},
+		migrate.DropIndex{Table: "users", Name: "idx_users_email"},
+	}},
+	{ID: "0011_add_users_recovery_email", Phase: migrate.PhaseExpand, Steps: []migrate.Step{
+		migrate.AddColumn{Table: "users", Column: "recovery_email", Type: "varchar(100)", Default: "''"},
+		migrate.AddIndex{Table: "users", Name: "idx_users_recovery_email", Columns: []string{"recovery_email"}},
+	}},
+	{ID: "0012_add_session_scope", Phase: migrate.PhaseExpand, Steps: []migrate.Step{
+		migrate.AddColumn{Table: "refresh_tokens", Column: "scope", Type: "varchar(255)", Default: "''"},
+		migrate.AddColumn{Table: "mfa_challenges", Column: "scope", Type: "varchar(255)", Default: "''"},
+	}},
+}
+
+// Models returns every database model the services in this binary expect
+func Models() []interface{} {
+	var models []interface{}
+	models = append(models, authrepo.Models()...)
+	models = append(models, userrepo.Models()...)
+	return models
+}
+
+// Indexes returns every index the services in this binary expect
+func Indexes() []migrate.AddIndex {
+	var indexes []migrate.AddIndex
+	seen := make(map[string]bool)
+	for _, index := range append(authrepo.Indexes(), userrepo.Indexes()...) {
+		if key := index.Table + "." + index.Name; !seen[key] {
+			seen[key] = true
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+// SharedModels returns the models of tables owned by shared packages, which
+// create their tables themselves when they start
+func SharedModels() []interface{} {
+	return []interface{}{
+		&migrate.SchemaMigration{},
+		&events.Record{},
+		&events.Offset{},
+		&cdc.Snapshot{},
+		&cdc.Position{},
+		&operations.Operation{},
+		&jobs.Record{},
+		&notification.Template{},
+		&mail.Message{},
+		&autotls.Certificate{},
+		&metering.Record{},
+		&revocation.Record{},
+	}
+}
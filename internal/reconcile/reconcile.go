@@ -0,0 +1,318 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	authrepo "github.com/linkeunid/hello-go/internal/auth/repository"
+	userrepo "github.com/linkeunid/hello-go/internal/user/repository"
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// Issue kinds
+const (
+	// IssueMissing is a user in the source of truth that the other store lacks
+	IssueMissing = "missing"
+	// IssueOrphan is a user in the other store that the source of truth lacks
+	IssueOrphan = "orphan"
+	// IssueDrift is a user whose field differs between the stores
+	IssueDrift = "drift"
+)
+
+// comparedFields are the columns both stores keep and must agree on
+var comparedFields = []string{"tenant_id", "email", "name", "role", "locale"}
+
+// Issue is an inconsistency between the auth and user stores
+type Issue struct {
+	Kind   string
+	UserID string
+	// Field, AuthValue and UserValue describe a drift
+	Field     string
+	AuthValue string
+	UserValue string
+	// Repaired is set when the issue was fixed, Err when fixing it failed
+	Repaired bool
+	Err      error
+}
+
+// Report is the result of a check
+type Report struct {
+	SourceOfTruth string
+	Repair        bool
+	AuthUsers     int
+	UserUsers     int
+	Issues        []Issue
+	Duration      time.Duration
+}
+
+// Consistent reports whether no issue was found
+func (r *Report) Consistent() bool {
+	return len(r.Issues) == 0
+}
+
+// user is the part of a user row both stores keep
+type user struct {
+	ID        string
+	TenantID  string
+	Email     string
+	Password  string
+	Name      string
+	Role      string
+	Locale    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// field returns the value of a compared field
+func (u *user) field(name string) string {
+	switch name {
+	case "tenant_id":
+		return u.TenantID
+	case "email":
+		return u.Email
+	case "name":
+		return u.Name
+	case "role":
+		return u.Role
+	case "locale":
+		return u.Locale
+	default:
+		return ""
+	}
+}
+
+// Checker compares the users of the auth and user stores.
+//
+// When the services use separate databases, each keeps its own users table and
+// a failed write to one of them leaves the stores apart. The checker walks both
+// tables in ID order and reports users missing from either store and fields
+// that differ. With repair, the store that isn't the source of truth is updated
+// to match it: missing users are copied and drifted fields overwritten. Orphans
+// are only reported, deleting them would bypass the account deletion flow.
+type Checker struct {
+	cfg    config.ReconcileConfig
+	authDB *gorm.DB
+	userDB *gorm.DB
+	logger *zap.Logger
+}
+
+// NewChecker creates a checker for the auth and user databases
+func NewChecker(cfg *config.Config, authDB, userDB *gorm.DB, logger *zap.Logger) *Checker {
+	return &Checker{
+		cfg:    cfg.Reconcile,
+		authDB: authDB,
+		userDB: userDB,
+		logger: logger,
+	}
+}
+
+// Run compares the stores, repairing the issues if repair is set
+func (c *Checker) Run(ctx context.Context, repair bool) (*Report, error) {
+	start := time.Now()
+	report := &Report{SourceOfTruth: c.cfg.SourceOfTruth, Repair: repair}
+
+	c.logger.Info("Checking consistency of auth and user stores",
+		zap.String("source_of_truth", c.cfg.SourceOfTruth),
+		zap.Bool("repair", repair))
+
+	authUsers := newCursor(c.authDB.Model(&authrepo.User{}), c.cfg.BatchSize)
+	userUsers := newCursor(c.userDB.Model(&userrepo.User{}), c.cfg.BatchSize)
+
+	// Merge both tables, they are read in the same ID order
+	for {
+		authUser, err := authUsers.peek(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read auth users: %w", err)
+		}
+		userUser, err := userUsers.peek(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read user service users: %w", err)
+		}
+
+		switch {
+		case authUser == nil && userUser == nil:
+			report.Duration = time.Since(start)
+			c.logger.Info("Consistency check finished",
+				zap.Int("auth_users", report.AuthUsers),
+				zap.Int("user_users", report.UserUsers),
+				zap.Int("issues", len(report.Issues)),
+				zap.Duration("duration", report.Duration))
+			return report, nil
+		case userUser == nil || (authUser != nil && authUser.ID < userUser.ID):
+			report.AuthUsers++
+			authUsers.next()
+			report.Issues = append(report.Issues, c.onlyIn(ctx, config.SourceOfTruthAuth, authUser, repair))
+		case authUser == nil || userUser.ID < authUser.ID:
+			report.UserUsers++
+			userUsers.next()
+			report.Issues = append(report.Issues, c.onlyIn(ctx, config.SourceOfTruthUser, userUser, repair))
+		default:
+			report.AuthUsers++
+			report.UserUsers++
+			authUsers.next()
+			userUsers.next()
+			report.Issues = append(report.Issues, c.compare(ctx, authUser, userUser, repair)...)
+		}
+	}
+}
+
+// onlyIn handles a user found in a single store
+func (c *Checker) onlyIn(ctx context.Context, store string, u *user, repair bool) Issue {
+	if store != c.cfg.SourceOfTruth {
+		c.logger.Warn("User is missing from the source of truth",
+			zap.String("user_id", u.ID),
+			zap.String("store", store))
+		return Issue{Kind: IssueOrphan, UserID: u.ID}
+	}
+
+	issue := Issue{Kind: IssueMissing, UserID: u.ID}
+	c.logger.Warn("User is missing from a store",
+		zap.String("user_id", u.ID),
+		zap.String("found_in", store))
+	if !repair {
+		return issue
+	}
+
+	// Copy the user to the other store
+	if store == config.SourceOfTruthAuth {
+		issue.Err = c.userDB.WithContext(ctx).Create(&userrepo.User{
+			ID:        u.ID,
+			TenantID:  u.TenantID,
+			Email:     u.Email,
+			Password:  u.Password,
+			Name:      u.Name,
+			Role:      u.Role,
+			Locale:    u.Locale,
+			CreatedAt: u.CreatedAt,
+			UpdatedAt: u.UpdatedAt,
+		}).Error
+	} else {
+		issue.Err = c.authDB.WithContext(ctx).Create(&authrepo.User{
+			ID:        u.ID,
+			TenantID:  u.TenantID,
+			Email:     u.Email,
+			Password:  u.Password,
+			Name:      u.Name,
+			Role:      u.Role,
+			Locale:    u.Locale,
+			CreatedAt: u.CreatedAt,
+			UpdatedAt: u.UpdatedAt,
+		}).Error
+	}
+	c.recordRepair(&issue)
+	return issue
+}
+
+// compare reports the fields that differ between the two rows of a user
+func (c *Checker) compare(ctx context.Context, authUser, userUser *user, repair bool) []Issue {
+	var issues []Issue
+	updates := make(map[string]interface{})
+	for _, field := range comparedFields {
+		authValue, userValue := authUser.field(field), userUser.field(field)
+		if authValue == userValue {
+			continue
+		}
+
+		c.logger.Warn("User field differs between stores",
+			zap.String("user_id", authUser.ID),
+			zap.String("field", field))
+		issues = append(issues, Issue{
+			Kind:      IssueDrift,
+			UserID:    authUser.ID,
+			Field:     field,
+			AuthValue: authValue,
+			UserValue: userValue,
+		})
+
+		if c.cfg.SourceOfTruth == config.SourceOfTruthAuth {
+			updates[field] = authValue
+		} else {
+			updates[field] = userValue
+		}
+	}
+
+	if !repair || len(updates) == 0 {
+		return issues
+	}
+
+	// Overwrite the drifted fields in the other store
+	target := c.userDB.Model(&userrepo.User{})
+	if c.cfg.SourceOfTruth == config.SourceOfTruthUser {
+		target = c.authDB.Model(&authrepo.User{})
+	}
+	err := target.WithContext(ctx).Where("id = ?", authUser.ID).Updates(updates).Error
+	for i := range issues {
+		issues[i].Err = err
+		c.recordRepair(&issues[i])
+	}
+	return issues
+}
+
+// recordRepair marks an issue repaired unless fixing it failed
+func (c *Checker) recordRepair(issue *Issue) {
+	if issue.Err != nil {
+		c.logger.Error("Failed to repair inconsistency",
+			zap.String("user_id", issue.UserID),
+			zap.String("kind", issue.Kind),
+			zap.Error(issue.Err))
+		return
+	}
+	issue.Repaired = true
+}
+
+// cursor reads the users of a table in ID order, a batch at a time
+type cursor struct {
+	query     *gorm.DB
+	batchSize int
+	batch     []user
+	pos       int
+	lastID    string
+	done      bool
+}
+
+// newCursor creates a cursor over the users of a query
+func newCursor(query *gorm.DB, batchSize int) *cursor {
+	if batchSize < 1 {
+		batchSize = 500
+	}
+	return &cursor{query: query, batchSize: batchSize}
+}
+
+// peek returns the current user without advancing, nil once all users were read
+func (c *cursor) peek(ctx context.Context) (*user, error) {
+	if c.pos < len(c.batch) {
+		return &c.batch[c.pos], nil
+	}
+	if c.done {
+		return nil, nil
+	}
+
+	c.batch = c.batch[:0]
+	c.pos = 0
+	err := c.query.Session(&gorm.Session{}).WithContext(ctx).
+		Select("id", "tenant_id", "email", "password", "name", "role", "locale", "created_at", "updated_at").
+		Where("id > ?", c.lastID).
+		Order("id").
+		Limit(c.batchSize).
+		Find(&c.batch).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(c.batch) < c.batchSize {
+		c.done = true
+	}
+	if len(c.batch) == 0 {
+		return nil, nil
+	}
+	c.lastID = c.batch[len(c.batch)-1].ID
+	return &c.batch[0], nil
+}
+
+// next advances to the following user
+func (c *cursor) next() {
+	c.pos++
+}
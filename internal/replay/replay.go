@@ -0,0 +1,235 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/linkeunid/hello-go/pkg/capture"
+)
+
+// Options control a replay
+type Options struct {
+	// Token is sent as bearer token with every call, captured tokens are redacted
+	Token string
+	// IncludeRedacted replays calls whose secrets were redacted, which usually fail
+	IncludeRedacted bool
+	// Rate limits the calls per second, 0 replays as fast as possible
+	Rate float64
+	// Timeout bounds each call
+	Timeout time.Duration
+}
+
+// MethodReport summarizes the replayed calls of a method
+type MethodReport struct {
+	Method string
+	Calls  int
+	// Skipped calls weren't replayed, e.g. because their secrets were redacted
+	Skipped int
+	// CodeMismatches are calls that ended with another status code than captured
+	CodeMismatches int
+	// ShapeMismatches are successful calls whose response has other top-level
+	// fields than captured, which can also come from different data
+	ShapeMismatches int
+	CapturedLatency time.Duration
+	Latency         time.Duration
+	// Examples describe a few mismatches
+	Examples []string
+}
+
+// maxExamples is the number of mismatches described per method
+const maxExamples = 3
+
+// Report is the outcome of a replay
+type Report struct {
+	Methods []*MethodReport
+}
+
+// Failed reports whether any call ended with another status code than captured
+func (r *Report) Failed() bool {
+	for _, method := range r.Methods {
+		if method.CodeMismatches > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the report as a table
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "%-55s %6s %7s %6s %6s %12s %12s\n", "method", "calls", "skipped", "codes", "shapes", "captured", "replayed")
+	for _, m := range r.Methods {
+		fmt.Fprintf(w, "%-55s %6d %7d %6d %6d %12s %12s\n", m.Method, m.Calls, m.Skipped, m.CodeMismatches, m.ShapeMismatches,
+			m.CapturedLatency.Round(time.Microsecond), m.Latency.Round(time.Microsecond))
+		for _, example := range m.Examples {
+			fmt.Fprintf(w, "    %s\n", example)
+		}
+	}
+}
+
+// Replay sends the captured calls over conn in order and compares the status
+// codes and response shapes with the captured ones. Latencies are averages.
+func Replay(ctx context.Context, conn grpc.ClientConnInterface, records []capture.Record, opts Options) (*Report, error) {
+	methods := make(map[string]*MethodReport)
+	var interval time.Duration
+	if opts.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.Rate)
+	}
+
+	for i, record := range records {
+		report, ok := methods[record.Method]
+		if !ok {
+			report = &MethodReport{Method: record.Method}
+			methods[record.Method] = report
+		}
+		if record.Redacted && !opts.IncludeRedacted {
+			report.Skipped++
+			continue
+		}
+
+		req, resp, err := newMessages(record.Method)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i+1, err)
+		}
+		if err := protojson.Unmarshal(record.Request, req); err != nil {
+			return nil, fmt.Errorf("record %d: invalid request of %s: %w", i+1, record.Method, err)
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		if opts.Token != "" {
+			callCtx = metadata.AppendToOutgoingContext(callCtx, "authorization", "Bearer "+opts.Token)
+		}
+		start := time.Now()
+		err = conn.Invoke(callCtx, record.Method, req, resp)
+		latency := time.Since(start)
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		report.Calls++
+		report.CapturedLatency += time.Duration(record.LatencyMicros) * time.Microsecond
+		report.Latency += latency
+
+		if code := status.Code(err).String(); code != record.Code {
+			report.CodeMismatches++
+			report.example(fmt.Sprintf("record %d: %s instead of %s: %s", i+1, code, record.Code, status.Convert(err).Message()))
+		} else if err == nil && len(record.Response) > 0 {
+			if diff := shapeDiff(record.Response, resp); diff != "" {
+				report.ShapeMismatches++
+				report.example(fmt.Sprintf("record %d: %s", i+1, diff))
+			}
+		}
+
+		if interval > 0 {
+			time.Sleep(interval - latency)
+		}
+	}
+
+	result := &Report{}
+	for _, report := range methods {
+		if report.Calls > 0 {
+			report.CapturedLatency /= time.Duration(report.Calls)
+			report.Latency /= time.Duration(report.Calls)
+		}
+		result.Methods = append(result.Methods, report)
+	}
+	sort.Slice(result.Methods, func(i, j int) bool {
+		return result.Methods[i].Method < result.Methods[j].Method
+	})
+	return result, nil
+}
+
+// example records the description of a mismatch
+func (m *MethodReport) example(description string) {
+	if len(m.Examples) < maxExamples {
+		m.Examples = append(m.Examples, description)
+	}
+}
+
+// newMessages returns empty request and response messages of a full method
+// name, e.g. "/user.UserService/GetUser". The service's generated package must
+// be linked into the binary.
+func newMessages(method string) (proto.Message, proto.Message, error) {
+	service, name, ok := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid method %q", method)
+	}
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown service of %s: %w", method, err)
+	}
+	serviceDesc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s isn't a service", service)
+	}
+	methodDesc := serviceDesc.Methods().ByName(protoreflect.Name(name))
+	if methodDesc == nil {
+		return nil, nil, fmt.Errorf("unknown method %s", method)
+	}
+
+	reqType, err := protoregistry.GlobalTypes.FindMessageByName(methodDesc.Input().FullName())
+	if err != nil {
+		return nil, nil, err
+	}
+	respType, err := protoregistry.GlobalTypes.FindMessageByName(methodDesc.Output().FullName())
+	if err != nil {
+		return nil, nil, err
+	}
+	return reqType.New().Interface(), respType.New().Interface(), nil
+}
+
+// shapeDiff describes the top-level fields of the captured response missing
+// from the replayed one and the other way around, or returns an empty string
+func shapeDiff(captured json.RawMessage, resp proto.Message) string {
+	replayed, err := protojson.Marshal(resp)
+	if err != nil {
+		return fmt.Sprintf("response can't be encoded: %v", err)
+	}
+
+	var before, after map[string]json.RawMessage
+	if err := json.Unmarshal(captured, &before); err != nil {
+		return fmt.Sprintf("captured response isn't an object: %v", err)
+	}
+	if err := json.Unmarshal(replayed, &after); err != nil {
+		return fmt.Sprintf("replayed response isn't an object: %v", err)
+	}
+
+	var missing, added []string
+	for field := range before {
+		if _, ok := after[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			added = append(added, field)
+		}
+	}
+	if len(missing) == 0 && len(added) == 0 {
+		return ""
+	}
+
+	sort.Strings(missing)
+	sort.Strings(added)
+	var parts []string
+	if len(missing) > 0 {
+		parts = append(parts, "missing "+strings.Join(missing, ", "))
+	}
+	if len(added) > 0 {
+		parts = append(parts, "new "+strings.Join(added, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
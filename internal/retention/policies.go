@@ -0,0 +1,86 @@
+package retention
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// Tables covered by the default policies
+const (
+	TableLoginHistory        = "login_histories"
+	TableAuditLogs           = "audit_logs"
+	TableUsers               = "users"
+	TableRevokedTokens       = "revoked_tokens"
+	TablePasswordResetTokens = "password_reset_tokens"
+	TableRefreshTokens       = "refresh_tokens"
+	TableMFAChallenges       = "mfa_challenges"
+	TableInvites             = "invites"
+)
+
+// AnonymizedEmailDomain marks emails replaced by anonymization
+const AnonymizedEmailDomain = "anonymized.invalid"
+
+const day = 24 * time.Hour
+
+// DefaultPolicies builds the retention policies from the config.
+// A non-positive retention period disables the corresponding policy.
+func DefaultPolicies(cfg *config.RetentionConfig) []Policy {
+	var policies []Policy
+
+	if cfg.LoginHistoryDays > 0 {
+		policies = append(policies, Policy{
+			Name:   "login_history",
+			Table:  TableLoginHistory,
+			Column: "created_at",
+			MaxAge: time.Duration(cfg.LoginHistoryDays) * day,
+			Action: ActionPurge,
+		})
+	}
+
+	if cfg.AuditLogDays > 0 {
+		policies = append(policies, Policy{
+			Name:   "audit_logs",
+			Table:  TableAuditLogs,
+			Column: "created_at",
+			MaxAge: time.Duration(cfg.AuditLogDays) * day,
+			Action: ActionPurge,
+		})
+	}
+
+	if cfg.DeletedUserDays > 0 {
+		// Soft-deleted users keep their row for referential integrity,
+		// but lose everything that identifies the person
+		policies = append(policies, Policy{
+			Name:   "deleted_users",
+			Table:  TableUsers,
+			Column: "deleted_at",
+			MaxAge: time.Duration(cfg.DeletedUserDays) * day,
+			Action: ActionAnonymize,
+			Updates: map[string]interface{}{
+				"email":    gorm.Expr("CONCAT('deleted-', id, '@" + AnonymizedEmailDomain + "')"),
+				"name":     "Deleted User",
+				"password": "",
+				// Release the handle, the unique index allows multiple NULLs
+				"username": nil,
+			},
+			Where: "email NOT LIKE '%@" + AnonymizedEmailDomain + "'",
+		})
+	}
+
+	if cfg.ExpiredTokenDays > 0 {
+		for _, table := range []string{TableRevokedTokens, TablePasswordResetTokens, TableRefreshTokens, TableMFAChallenges, TableInvites} {
+			policies = append(policies, Policy{
+				Name:   "expired_" + table,
+				Table:  table,
+				Column: "expires_at",
+				MaxAge: time.Duration(cfg.ExpiredTokenDays) * day,
+				Action: ActionPurge,
+			})
+		}
+	}
+
+	return policies
+}
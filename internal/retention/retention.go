@@ -0,0 +1,279 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/jobs"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+// Action is what a policy does with stale records
+type Action string
+
+const (
+	// ActionPurge deletes stale records
+	ActionPurge Action = "purge"
+	// ActionAnonymize overwrites identifying columns of stale records
+	ActionAnonymize Action = "anonymize"
+)
+
+// Policy describes how stale records in a single table are handled
+type Policy struct {
+	// Name identifies the policy in reports and metrics
+	Name string
+	// Table is the database table the policy applies to
+	Table string
+	// Column is the timestamp column compared against the cutoff
+	Column string
+	// MaxAge is how long records are kept before the policy applies
+	MaxAge time.Duration
+	// Action is the action applied to stale records
+	Action Action
+	// Updates are the column replacements used by ActionAnonymize
+	Updates map[string]interface{}
+	// Where is an optional extra condition, e.g. to skip already anonymized rows
+	Where string
+}
+
+// Result is the outcome of applying a single policy
+type Result struct {
+	Policy   string
+	Table    string
+	Action   Action
+	Cutoff   time.Time
+	Affected int64
+	Skipped  bool
+	Err      error
+}
+
+// Report summarizes a retention run
+type Report struct {
+	DryRun    bool
+	StartedAt time.Time
+	Duration  time.Duration
+	Results   []Result
+}
+
+var (
+	affectedRecords = metrics.NewCounterVec("retention_affected_records_total",
+		"Number of records purged or anonymized by the retention job", "policy", "action")
+	matchedRecords = metrics.NewGaugeVec("retention_matched_records",
+		"Number of records matched by each policy during the last run", "policy", "action")
+	policyErrors = metrics.NewCounterVec("retention_errors_total",
+		"Number of failed retention policy executions", "policy")
+	lastRun = metrics.NewGaugeVec("retention_last_run_timestamp_seconds",
+		"Unix time of the last completed retention run", "dry_run")
+)
+
+// Runner applies retention policies to the database
+type Runner struct {
+	db       *gorm.DB
+	policies []Policy
+	interval time.Duration
+	dryRun   bool
+	logger   *zap.Logger
+}
+
+// NewRunner creates a new retention runner with the policies from the config
+func NewRunner(cfg *config.Config, db *gorm.DB, logger *zap.Logger) *Runner {
+	return &Runner{
+		db:       db,
+		policies: DefaultPolicies(&cfg.Retention),
+		interval: cfg.Retention.Interval,
+		dryRun:   cfg.Retention.DryRun,
+		logger:   logger,
+	}
+}
+
+// SetDryRun overrides the configured dry-run setting
+func (r *Runner) SetDryRun(dryRun bool) {
+	r.dryRun = dryRun
+}
+
+// PolicyJobType is the job type applying a single retention policy
+const PolicyJobType = "retention.policy"
+
+// policyJob is the payload of a retention policy job
+type policyJob struct {
+	Policy string `json:"policy"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// Register registers the retention policy job handler on the queue.
+// Failed policies are retried by the queue with backoff.
+func (r *Runner) Register(queue *jobs.Queue) {
+	queue.Register(PolicyJobType, func(ctx context.Context, job *jobs.Job) error {
+		var payload policyJob
+		if err := job.Decode(&payload); err != nil {
+			return jobs.Permanent(fmt.Errorf("invalid retention job payload: %w", err))
+		}
+
+		policy, ok := r.policy(payload.Policy)
+		if !ok {
+			return jobs.Permanent(fmt.Errorf("unknown retention policy: %s", payload.Policy))
+		}
+
+		result := r.apply(ctx, policy, time.Now(), payload.DryRun)
+		r.record(policy, result, payload.DryRun)
+		return result.Err
+	}, jobs.WithConcurrency(1))
+}
+
+// Start enqueues a job for every policy periodically until the context is
+// cancelled. A policy whose previous job is still pending is not enqueued again.
+func (r *Runner) Start(ctx context.Context, queue *jobs.Queue) {
+	r.logger.Info("Starting retention runner",
+		zap.Duration("interval", r.interval),
+		zap.Bool("dry_run", r.dryRun),
+		zap.Int("policies", len(r.policies)))
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, policy := range r.policies {
+			payload := policyJob{Policy: policy.Name, DryRun: r.dryRun}
+			_, err := queue.Enqueue(ctx, PolicyJobType, payload, jobs.Unique(PolicyJobType+":"+policy.Name))
+			switch {
+			case errors.Is(err, jobs.ErrDuplicate):
+				r.logger.Debug("Retention policy job still pending", zap.String("policy", policy.Name))
+			case err != nil && ctx.Err() == nil:
+				r.logger.Error("Failed to enqueue retention policy job",
+					zap.String("policy", policy.Name),
+					zap.Error(err))
+			}
+		}
+		lastRun.Set(float64(time.Now().Unix()), fmt.Sprintf("%t", r.dryRun))
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Retention runner stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// policy returns the policy with the given name
+func (r *Runner) policy(name string) (Policy, bool) {
+	for _, policy := range r.policies {
+		if policy.Name == name {
+			return policy, true
+		}
+	}
+	return Policy{}, false
+}
+
+// RunOnce applies every policy once and returns a report
+func (r *Runner) RunOnce(ctx context.Context) *Report {
+	report := &Report{
+		DryRun:    r.dryRun,
+		StartedAt: time.Now(),
+	}
+
+	for _, policy := range r.policies {
+		result := r.apply(ctx, policy, report.StartedAt, r.dryRun)
+		report.Results = append(report.Results, result)
+		r.record(policy, result, r.dryRun)
+	}
+
+	report.Duration = time.Since(report.StartedAt)
+	lastRun.Set(float64(time.Now().Unix()), fmt.Sprintf("%t", r.dryRun))
+
+	r.logger.Info("Retention run completed",
+		zap.Bool("dry_run", r.dryRun),
+		zap.Duration("duration", report.Duration))
+
+	return report
+}
+
+// record logs the result of a policy and counts failures
+func (r *Runner) record(policy Policy, result Result, dryRun bool) {
+	if result.Err != nil {
+		policyErrors.Inc(policy.Name)
+		r.logger.Error("Retention policy failed",
+			zap.String("policy", policy.Name),
+			zap.String("table", policy.Table),
+			zap.Error(result.Err))
+		return
+	}
+
+	if result.Skipped {
+		r.logger.Debug("Retention policy skipped, table not present",
+			zap.String("policy", policy.Name),
+			zap.String("table", policy.Table))
+		return
+	}
+
+	r.logger.Info("Retention policy applied",
+		zap.String("policy", policy.Name),
+		zap.String("table", policy.Table),
+		zap.String("action", string(policy.Action)),
+		zap.Time("cutoff", result.Cutoff),
+		zap.Int64("affected", result.Affected),
+		zap.Bool("dry_run", dryRun))
+}
+
+// apply applies a single policy, only counting matches in dry-run mode
+func (r *Runner) apply(ctx context.Context, policy Policy, now time.Time, dryRun bool) Result {
+	result := Result{
+		Policy: policy.Name,
+		Table:  policy.Table,
+		Action: policy.Action,
+		Cutoff: now.Add(-policy.MaxAge),
+	}
+
+	// Tables are created by the features that own them, so a missing
+	// table or column just means that feature is not deployed yet
+	migrator := r.db.Migrator()
+	if !migrator.HasTable(policy.Table) || !migrator.HasColumn(policy.Table, policy.Column) {
+		result.Skipped = true
+		return result
+	}
+
+	condition := fmt.Sprintf("%s < ?", policy.Column)
+	if policy.Where != "" {
+		condition = fmt.Sprintf("%s AND (%s)", condition, policy.Where)
+	}
+	query := r.db.WithContext(ctx).Table(policy.Table).Where(condition, result.Cutoff)
+
+	if dryRun {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			result.Err = err
+			return result
+		}
+		result.Affected = count
+		matchedRecords.Set(float64(count), policy.Name, string(policy.Action))
+		return result
+	}
+
+	var tx *gorm.DB
+	switch policy.Action {
+	case ActionPurge:
+		tx = r.db.WithContext(ctx).
+			Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", policy.Table, condition), result.Cutoff)
+	case ActionAnonymize:
+		tx = query.UpdateColumns(policy.Updates)
+	default:
+		result.Err = fmt.Errorf("unknown retention action: %s", policy.Action)
+		return result
+	}
+
+	if tx.Error != nil {
+		result.Err = tx.Error
+		return result
+	}
+
+	result.Affected = tx.RowsAffected
+	matchedRecords.Set(float64(tx.RowsAffected), policy.Name, string(policy.Action))
+	affectedRecords.Add(float64(tx.RowsAffected), policy.Name, string(policy.Action))
+	return result
+}
@@ -0,0 +1,109 @@
+package schemadoc
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// commentReader reads the doc comments of model fields from the module's source
+type commentReader struct {
+	root   string
+	module string
+	// packages caches the struct field comments by package path, type and field
+	packages map[string]map[string]map[string]string
+}
+
+// newCommentReader creates a reader for the module at root
+func newCommentReader(root string) *commentReader {
+	r := &commentReader{
+		root:     root,
+		packages: make(map[string]map[string]map[string]string),
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "go.mod")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if module, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+				r.module = strings.Trim(strings.TrimSpace(module), `"`)
+				break
+			}
+		}
+	}
+	return r
+}
+
+// modelName returns the name of a model type relative to the module, e.g. "internal/auth/repository.User"
+func (r *commentReader) modelName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if r.module != "" {
+		pkg = strings.TrimPrefix(strings.TrimPrefix(pkg, r.module), "/")
+	}
+	return pkg + "." + t.Name()
+}
+
+// fields returns the doc comments of the fields of a model type by field name
+func (r *commentReader) fields(t reflect.Type) map[string]string {
+	pkg := t.PkgPath()
+	if r.module == "" || !strings.HasPrefix(pkg, r.module) {
+		return nil
+	}
+
+	types, ok := r.packages[pkg]
+	if !ok {
+		types = parseFieldComments(filepath.Join(r.root, strings.TrimPrefix(pkg, r.module)))
+		r.packages[pkg] = types
+	}
+	return types[t.Name()]
+}
+
+// parseFieldComments collects the field doc comments of the structs declared in a package directory
+func parseFieldComments(dir string) map[string]map[string]string {
+	types := make(map[string]map[string]string)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return types
+	}
+
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			continue
+		}
+
+		ast.Inspect(file, func(node ast.Node) bool {
+			spec, ok := node.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			structType, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				return false
+			}
+
+			fields := make(map[string]string)
+			for _, field := range structType.Fields.List {
+				doc := field.Doc.Text()
+				if doc == "" {
+					doc = field.Comment.Text()
+				}
+				for _, ident := range field.Names {
+					fields[ident.Name] = strings.Join(strings.Fields(doc), " ")
+				}
+			}
+			types[spec.Name.Name] = fields
+			return false
+		})
+	}
+
+	return types
+}
@@ -0,0 +1,148 @@
+package schemadoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mermaid renders the schema as a Mermaid entity relationship diagram
+func (s *Schema) Mermaid() string {
+	var sb strings.Builder
+	sb.WriteString("erDiagram\n")
+
+	for _, table := range s.Tables {
+		fmt.Fprintf(&sb, "    %s {\n", table.Name)
+		for _, column := range table.Columns {
+			fmt.Fprintf(&sb, "        %s %s", mermaidType(column.Type), column.Name)
+			var keys []string
+			if column.PrimaryKey {
+				keys = append(keys, "PK")
+			}
+			if s.references(table.Name, column.Name) {
+				keys = append(keys, "FK")
+			}
+			if table.uniqueColumn(column.Name) {
+				keys = append(keys, "UK")
+			}
+			if len(keys) > 0 {
+				sb.WriteString(" " + strings.Join(keys, ", "))
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("    }\n")
+	}
+
+	for _, ref := range s.References {
+		cardinality := "}o--||"
+		if ref.Optional {
+			cardinality = "}o--o|"
+		}
+		fmt.Fprintf(&sb, "    %s %s %s : %s\n", ref.Table, cardinality, ref.RefTable, ref.Column)
+	}
+
+	return sb.String()
+}
+
+// Markdown renders the schema documentation with the diagram embedded
+func (s *Schema) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("# Database Schema\n\n")
+	sb.WriteString("<!-- Generated by cmd/schemadoc from the GORM models, don't edit. Run `make schema-docs` after changing a model. -->\n\n")
+	sb.WriteString("References are inferred from column names, the database has no foreign keys.\n\n")
+	sb.WriteString("```mermaid\n")
+	sb.WriteString(s.Mermaid())
+	sb.WriteString("```\n")
+
+	if len(s.Conflicts) > 0 {
+		sb.WriteString("\n## Conflicts\n\n")
+		sb.WriteString("Models sharing a table define these columns differently:\n\n")
+		for _, conflict := range s.Conflicts {
+			fmt.Fprintf(&sb, "- %s\n", conflict)
+		}
+	}
+
+	for _, table := range s.Tables {
+		fmt.Fprintf(&sb, "\n## %s\n\n", table.Name)
+		models := make([]string, len(table.Models))
+		for i, model := range table.Models {
+			models[i] = "`" + model + "`"
+		}
+		fmt.Fprintf(&sb, "Models: %s\n\n", strings.Join(models, ", "))
+
+		sb.WriteString("| Column | Type | Null | Default | Description |\n")
+		sb.WriteString("|---|---|---|---|---|\n")
+		for _, column := range table.Columns {
+			name := "`" + column.Name + "`"
+			if column.PrimaryKey {
+				name += " (PK)"
+			}
+			if ref, ok := s.reference(table.Name, column.Name); ok {
+				name += fmt.Sprintf(" → `%s`", ref.RefTable)
+			}
+			null := "yes"
+			if column.NotNull {
+				null = "no"
+			}
+			fmt.Fprintf(&sb, "| %s | `%s` | %s | %s | %s |\n",
+				name, column.Type, null, markdownCode(column.Default), markdownCell(column.Description))
+		}
+
+		if len(table.Indexes) > 0 {
+			sb.WriteString("\n| Index | Columns | Unique |\n")
+			sb.WriteString("|---|---|---|\n")
+			for _, index := range table.Indexes {
+				unique := "no"
+				if index.Unique {
+					unique = "yes"
+				}
+				fmt.Fprintf(&sb, "| `%s` | %s | %s |\n", index.Name, strings.Join(index.Columns, ", "), unique)
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// reference returns the reference of a column, if it has one
+func (s *Schema) reference(table, column string) (Reference, bool) {
+	for _, ref := range s.References {
+		if ref.Table == table && ref.Column == column {
+			return ref, true
+		}
+	}
+	return Reference{}, false
+}
+
+// references reports whether a column references another table
+func (s *Schema) references(table, column string) bool {
+	_, ok := s.reference(table, column)
+	return ok
+}
+
+// uniqueColumn reports whether a column has a unique index of its own
+func (t *Table) uniqueColumn(name string) bool {
+	for _, index := range t.Indexes {
+		if index.Unique && len(index.Columns) == 1 && index.Columns[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mermaidType makes a column type a valid Mermaid attribute type
+func mermaidType(columnType string) string {
+	return strings.NewReplacer(" ", "_", ",", "_").Replace(columnType)
+}
+
+// markdownCode formats a value as inline code, empty values stay empty
+func markdownCode(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "`" + value + "`"
+}
+
+// markdownCell escapes a value for a table cell
+func markdownCell(value string) string {
+	return strings.ReplaceAll(value, "|", "\\|")
+}
@@ -0,0 +1,203 @@
+package schemadoc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm/schema"
+)
+
+// Schema describes the tables of a set of models
+type Schema struct {
+	Tables     []*Table
+	References []Reference
+	// Conflicts lists columns that models sharing a table define differently
+	Conflicts []string
+}
+
+// Table describes a database table
+type Table struct {
+	Name string
+	// Models are the Go types mapped to the table, e.g. "internal/auth/repository.User"
+	Models  []string
+	Columns []*Column
+	Indexes []Index
+}
+
+// Column describes a column of a table
+type Column struct {
+	Name       string
+	Type       string
+	PrimaryKey bool
+	NotNull    bool
+	Default    string
+	// Description is the doc comment of the model field
+	Description string
+}
+
+// Index describes an index of a table
+type Index struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// Reference is a column pointing at the primary key of another table. Models
+// don't declare foreign keys, references are inferred from columns named after
+// a table, e.g. user_id referencing users.
+type Reference struct {
+	Table    string
+	Column   string
+	RefTable string
+	// Optional references may be empty
+	Optional bool
+}
+
+// Describe parses the models into a schema. Models mapped to the same table,
+// e.g. the auth and user views of users, are merged. Descriptions are read
+// from the models' source code in sourceRoot, the module root; they are left
+// empty if it isn't found.
+func Describe(sourceRoot string, models ...interface{}) (*Schema, error) {
+	namer := schema.NamingStrategy{}
+	cache := &sync.Map{}
+	comments := newCommentReader(sourceRoot)
+
+	s := &Schema{}
+	tables := make(map[string]*Table)
+	for _, model := range models {
+		parsed, err := schema.Parse(model, cache, namer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+
+		table, ok := tables[parsed.Table]
+		if !ok {
+			table = &Table{Name: parsed.Table}
+			tables[parsed.Table] = table
+			s.Tables = append(s.Tables, table)
+		}
+		modelType := reflect.Indirect(reflect.ValueOf(model)).Type()
+		table.Models = append(table.Models, comments.modelName(modelType))
+		descriptions := comments.fields(modelType)
+
+		for _, field := range parsed.Fields {
+			if field.DBName == "" {
+				continue
+			}
+
+			column := &Column{
+				Name:        field.DBName,
+				Type:        columnType(field),
+				PrimaryKey:  field.PrimaryKey,
+				NotNull:     field.NotNull || field.PrimaryKey,
+				Default:     field.DefaultValue,
+				Description: descriptions[field.Name],
+			}
+
+			existing := table.column(column.Name)
+			if existing == nil {
+				table.Columns = append(table.Columns, column)
+				continue
+			}
+			if existing.Type != column.Type || existing.NotNull != column.NotNull {
+				s.Conflicts = append(s.Conflicts, fmt.Sprintf("%s.%s is %s in %s but %s in %s",
+					table.Name, column.Name, existing.describeType(), table.Models[0],
+					column.describeType(), comments.modelName(modelType)))
+			}
+			if existing.Description == "" {
+				existing.Description = column.Description
+			}
+		}
+
+		for _, index := range parsed.ParseIndexes() {
+			if table.hasIndex(index.Name) {
+				continue
+			}
+			var columns []string
+			for _, option := range index.Fields {
+				columns = append(columns, option.DBName)
+			}
+			table.Indexes = append(table.Indexes, Index{
+				Name:    index.Name,
+				Columns: columns,
+				Unique:  index.Class == "UNIQUE",
+			})
+		}
+	}
+
+	sort.Slice(s.Tables, func(i, j int) bool { return s.Tables[i].Name < s.Tables[j].Name })
+	for _, table := range s.Tables {
+		sort.Slice(table.Indexes, func(i, j int) bool { return table.Indexes[i].Name < table.Indexes[j].Name })
+	}
+
+	// Infer references from columns named after a table
+	for _, table := range s.Tables {
+		for _, column := range table.Columns {
+			prefix, ok := strings.CutSuffix(column.Name, "_id")
+			if !ok || column.PrimaryKey {
+				continue
+			}
+			refTable := namer.TableName(prefix)
+			if _, exists := tables[refTable]; !exists {
+				continue
+			}
+			s.References = append(s.References, Reference{
+				Table:    table.Name,
+				Column:   column.Name,
+				RefTable: refTable,
+				Optional: !column.NotNull,
+			})
+		}
+	}
+
+	return s, nil
+}
+
+// column returns the column with the given name, if the table has it
+func (t *Table) column(name string) *Column {
+	for _, column := range t.Columns {
+		if column.Name == name {
+			return column
+		}
+	}
+	return nil
+}
+
+// hasIndex reports whether the table has an index with the given name
+func (t *Table) hasIndex(name string) bool {
+	for _, index := range t.Indexes {
+		if index.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// describeType returns the type with its nullability, for conflicts
+func (c *Column) describeType() string {
+	if c.NotNull {
+		return c.Type + " NOT NULL"
+	}
+	return c.Type
+}
+
+// columnType returns the SQL type of a field, or its GORM data type with the size
+// if the model leaves the type to the database driver
+func columnType(field *schema.Field) string {
+	switch field.DataType {
+	case schema.Int, schema.Uint, schema.Float:
+		return fmt.Sprintf("%s%d", field.DataType, field.Size)
+	case schema.String, schema.Bytes:
+		if field.Size > 0 {
+			return fmt.Sprintf("%s(%d)", field.DataType, field.Size)
+		}
+		return string(field.DataType)
+	case "":
+		return "unknown"
+	default:
+		return string(field.DataType)
+	}
+}
@@ -0,0 +1,42 @@
+package schemadoc_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linkeunid/hello-go/internal/migrations"
+	"github.com/linkeunid/hello-go/internal/schemadoc"
+)
+
+// moduleRoot is the module root relative to this package
+const moduleRoot = "../.."
+
+// TestDocsUpToDate fails when the models changed without regenerating the
+// schema docs with `make schema-docs`
+func TestDocsUpToDate(t *testing.T) {
+	models := append(migrations.Models(), migrations.SharedModels()...)
+	schema, err := schemadoc.Describe(moduleRoot, models...)
+	if err != nil {
+		t.Fatalf("Describe: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "docs/schema.md", want: schema.Markdown()},
+		{path: "docs/schema.mmd", want: schema.Mermaid()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := os.ReadFile(filepath.Join(moduleRoot, tt.path))
+			if err != nil {
+				t.Fatalf("read %s: %v", tt.path, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("%s is out of date with the models, regenerate it with `make schema-docs`", tt.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package smoketest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+var (
+	probeRuns = metrics.NewCounterVec("smoketest_probe_runs_total",
+		"Number of probe runs by result", "result")
+	probeStepFailures = metrics.NewCounterVec("smoketest_probe_step_failures_total",
+		"Number of failed probe steps", "step")
+	probeStepDuration = metrics.NewGaugeVec("smoketest_probe_step_duration_seconds",
+		"Duration of each probe step during the last run that reached it", "step")
+	probeDuration = metrics.NewGaugeVec("smoketest_probe_duration_seconds",
+		"Duration of the last probe run")
+	probeDurationTotal = metrics.NewCounterVec("smoketest_probe_duration_seconds_total",
+		"Total duration of probe runs, divided by smoketest_probe_runs_total for the average latency")
+	probeUp = metrics.NewGaugeVec("smoketest_probe_up",
+		"Whether the last probe run passed")
+	probeLastSuccess = metrics.NewGaugeVec("smoketest_probe_last_success_timestamp_seconds",
+		"Unix time of the last passed probe run")
+)
+
+// Check logs in with the existing account of opts, reads it and logs out
+// again. It is light enough to run against production every few minutes and,
+// unlike Run, doesn't create accounts.
+func Check(ctx context.Context, opts Options) *Result {
+	s := &scenario{
+		opts:     opts,
+		client:   &http.Client{Timeout: opts.Timeout},
+		email:    opts.Email,
+		password: opts.Password,
+		started:  time.Now(),
+	}
+
+	result := &Result{Email: s.email}
+	result.Steps = s.runAll(ctx, []scenarioStep{
+		{"login", s.login},
+		{"get me", s.getMe},
+		{"logout", s.logout},
+	})
+	return result
+}
+
+// Probe runs Check every interval until ctx is done, recording the outcomes
+// as metrics, and writes a line per run to w. Failed runs are written in full.
+func Probe(ctx context.Context, opts Options, interval time.Duration, w io.Writer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		result := Check(ctx, opts)
+		if ctx.Err() != nil {
+			return
+		}
+		record(result, time.Since(start))
+
+		if result.Passed() {
+			fmt.Fprintf(w, "%s PASS %s\n", start.UTC().Format(time.RFC3339), time.Since(start).Round(time.Millisecond))
+		} else {
+			fmt.Fprintf(w, "%s FAIL\n", start.UTC().Format(time.RFC3339))
+			result.Print(w)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// record updates the probe metrics with the outcome of a run
+func record(result *Result, duration time.Duration) {
+	for _, step := range result.Steps {
+		if step.Skipped {
+			continue
+		}
+		probeStepDuration.Set(step.Duration.Seconds(), step.Name)
+		if step.Err != nil {
+			probeStepFailures.Inc(step.Name)
+		}
+	}
+	probeDuration.Set(duration.Seconds())
+	probeDurationTotal.Add(duration.Seconds())
+
+	if !result.Passed() {
+		probeRuns.Inc("failed")
+		probeUp.Set(0)
+		return
+	}
+	probeRuns.Inc("passed")
+	probeUp.Set(1)
+	probeLastSuccess.Set(float64(time.Now().Unix()))
+}
+
+// logout ends the session and checks the token is rejected afterwards
+func (s *scenario) logout(ctx context.Context) error {
+	err := s.call(ctx, http.MethodPost, s.opts.AuthURL+"/api/v1/auth/logout", s.token, map[string]string{
+		"refresh_token": s.refreshToken,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		Valid bool `json:"valid"`
+	}
+	if err := s.call(ctx, http.MethodPost, s.opts.AuthURL+"/api/v1/auth/validate", "", map[string]string{
+		"token": s.token,
+	}, &res); err != nil {
+		return fmt.Errorf("validate after logout: %w", err)
+	}
+	if res.Valid {
+		return fmt.Errorf("token is still valid after logout")
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+package smoketest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Options configure a smoke test run
+type Options struct {
+	// AuthURL and UserURL are the base URLs of the services' HTTP gateways
+	AuthURL string
+	UserURL string
+	// AdminToken approves the temporary account when registrations need approval
+	AdminToken string
+	// EmailDomain is the domain of the temporary account's email
+	EmailDomain string
+	// Email and Password are of the existing account Check logs in with
+	Email    string
+	Password string
+	// Timeout bounds each request
+	Timeout time.Duration
+}
+
+// Step is the outcome of a step of the scenario
+type Step struct {
+	Name     string
+	Err      error
+	Skipped  bool
+	Duration time.Duration
+}
+
+// Result is the outcome of a run
+type Result struct {
+	Email string
+	// Temporary is set for accounts created by the run
+	Temporary bool
+	Steps     []Step
+}
+
+// Passed reports whether every step passed
+func (r *Result) Passed() bool {
+	for _, step := range r.Steps {
+		if step.Err != nil || step.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+// Print writes a line per step
+func (r *Result) Print(w io.Writer) {
+	if r.Temporary {
+		fmt.Fprintf(w, "Temporary account %s\n\n", r.Email)
+	} else {
+		fmt.Fprintf(w, "Account %s\n\n", r.Email)
+	}
+	for _, step := range r.Steps {
+		switch {
+		case step.Skipped:
+			fmt.Fprintf(w, "SKIP  %-10s\n", step.Name)
+		case step.Err != nil:
+			fmt.Fprintf(w, "FAIL  %-10s %8s  %v\n", step.Name, step.Duration.Round(time.Millisecond), step.Err)
+		default:
+			fmt.Fprintf(w, "PASS  %-10s %8s\n", step.Name, step.Duration.Round(time.Millisecond))
+		}
+	}
+}
+
+// scenario is the state shared by the steps of a run
+type scenario struct {
+	opts   Options
+	client *http.Client
+
+	email        string
+	password     string
+	name         string
+	userID       string
+	token        string
+	refreshToken string
+	started      time.Time
+}
+
+// scenarioStep is a named step of a scenario
+type scenarioStep struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Run registers a temporary account, logs in, reads, updates and lists it and
+// deletes it again. Steps after a failed one are skipped, but the account is
+// deleted whenever it was created.
+func Run(ctx context.Context, opts Options) *Result {
+	suffix := randomHex(6)
+	s := &scenario{
+		opts:     opts,
+		client:   &http.Client{Timeout: opts.Timeout},
+		email:    fmt.Sprintf("smoketest+%s@%s", suffix, opts.EmailDomain),
+		password: randomHex(16),
+		name:     "Smoke Test " + suffix,
+		started:  time.Now(),
+	}
+
+	result := &Result{Email: s.email, Temporary: true}
+	result.Steps = s.runAll(ctx, []scenarioStep{
+		{"register", s.register},
+		{"login", s.login},
+		{"get me", s.getMe},
+		{"update", s.update},
+		{"list", s.list},
+	})
+
+	// The account is cleaned up even when an earlier step failed
+	if s.userID == "" {
+		result.Steps = append(result.Steps, Step{Name: "delete", Skipped: true})
+	} else {
+		result.Steps = append(result.Steps, s.run(ctx, "delete", s.delete))
+	}
+	return result
+}
+
+// runAll runs steps in order, skipping those after a failed one
+func (s *scenario) runAll(ctx context.Context, steps []scenarioStep) []Step {
+	var results []Step
+	failed := false
+	for _, step := range steps {
+		if failed {
+			results = append(results, Step{Name: step.name, Skipped: true})
+			continue
+		}
+		results = append(results, s.run(ctx, step.name, step.fn))
+		failed = results[len(results)-1].Err != nil
+	}
+	return results
+}
+
+// run times a step
+func (s *scenario) run(ctx context.Context, name string, fn func(ctx context.Context) error) Step {
+	start := time.Now()
+	err := fn(ctx)
+	return Step{Name: name, Err: err, Duration: time.Since(start)}
+}
+
+func (s *scenario) register(ctx context.Context) error {
+	var res struct {
+		UserID string `json:"userId"`
+		Status string `json:"status"`
+	}
+	err := s.call(ctx, http.MethodPost, s.opts.AuthURL+"/api/v1/auth/register", "", map[string]string{
+		"email":    s.email,
+		"password": s.password,
+		"name":     s.name,
+	}, &res)
+	if err != nil {
+		return err
+	}
+	if res.UserID == "" {
+		return fmt.Errorf("no user ID in response")
+	}
+	s.userID = res.UserID
+
+	if res.Status != "pending" {
+		return nil
+	}
+	if s.opts.AdminToken == "" {
+		return fmt.Errorf("registration needs approval, pass an admin token to approve it")
+	}
+	return s.call(ctx, http.MethodPost, s.opts.AuthURL+"/api/v1/auth/registrations/"+s.userID+"/approve",
+		s.opts.AdminToken, map[string]string{}, nil)
+}
+
+func (s *scenario) login(ctx context.Context) error {
+	var res struct {
+		Token        string `json:"token"`
+		UserID       string `json:"userId"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	err := s.call(ctx, http.MethodPost, s.opts.AuthURL+"/api/v1/auth/login", "", map[string]string{
+		"email":    s.email,
+		"password": s.password,
+	}, &res)
+	if err != nil {
+		return err
+	}
+	if res.Token == "" {
+		return fmt.Errorf("no token in response")
+	}
+	// Existing accounts have no known user ID before the login
+	if s.userID == "" {
+		s.userID = res.UserID
+	} else if res.UserID != s.userID {
+		return fmt.Errorf("logged in as %q instead of the registered %q", res.UserID, s.userID)
+	}
+	s.token = res.Token
+	s.refreshToken = res.RefreshToken
+	return nil
+}
+
+// user is the part of a user the steps check
+type user struct {
+	Profile struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"profile"`
+	Account struct {
+		Email string `json:"email"`
+	} `json:"account"`
+}
+
+func (s *scenario) getMe(ctx context.Context) error {
+	var res struct {
+		User user `json:"user"`
+	}
+	if err := s.call(ctx, http.MethodGet, s.opts.UserURL+"/api/v1/users/"+s.userID, s.token, nil, &res); err != nil {
+		return err
+	}
+	if s.name != "" && res.User.Profile.Name != s.name {
+		return fmt.Errorf("name is %q instead of %q", res.User.Profile.Name, s.name)
+	}
+	if !strings.EqualFold(res.User.Account.Email, s.email) {
+		return fmt.Errorf("email is %q instead of %q", res.User.Account.Email, s.email)
+	}
+	return nil
+}
+
+func (s *scenario) update(ctx context.Context) error {
+	s.name += " Updated"
+	var res struct {
+		User             user   `json:"user"`
+		ConsistencyToken string `json:"consistencyToken"`
+	}
+	err := s.call(ctx, http.MethodPatch, s.opts.UserURL+"/api/v1/users/"+s.userID, s.token, map[string]string{
+		"name":       s.name,
+		"updateMask": "name",
+	}, &res)
+	if err != nil {
+		return err
+	}
+
+	// Read it back from the primary, replicas may lag behind
+	var read struct {
+		User user `json:"user"`
+	}
+	query := url.Values{"consistency_token": {res.ConsistencyToken}}
+	if err := s.call(ctx, http.MethodGet, s.opts.UserURL+"/api/v1/users/"+s.userID+"?"+query.Encode(), s.token, nil, &read); err != nil {
+		return fmt.Errorf("read back: %w", err)
+	}
+	if read.User.Profile.Name != s.name {
+		return fmt.Errorf("name is %q after the update instead of %q", read.User.Profile.Name, s.name)
+	}
+	return nil
+}
+
+func (s *scenario) list(ctx context.Context) error {
+	// Users created since shortly before the run, allowing for clock skew
+	query := url.Values{
+		"page_size":     {"100"},
+		"created_after": {s.started.Add(-5 * time.Minute).UTC().Format(time.RFC3339)},
+	}
+	var res struct {
+		Users []user `json:"users"`
+	}
+	if err := s.call(ctx, http.MethodGet, s.opts.UserURL+"/api/v1/users?"+query.Encode(), s.token, nil, &res); err != nil {
+		return err
+	}
+	for _, u := range res.Users {
+		if u.Profile.ID == s.userID {
+			return nil
+		}
+	}
+	return fmt.Errorf("temporary account isn't among the %d recently created users", len(res.Users))
+}
+
+func (s *scenario) delete(ctx context.Context) error {
+	// Without a session, e.g. when the login failed, the admin deletes the account
+	token := s.token
+	if token == "" {
+		token = s.opts.AdminToken
+	}
+	if token == "" {
+		return fmt.Errorf("can't delete %s without a session or admin token", s.userID)
+	}
+	if err := s.call(ctx, http.MethodDelete, s.opts.UserURL+"/api/v1/users/"+s.userID, token, nil, nil); err != nil {
+		return err
+	}
+
+	// The account must be gone
+	err := s.call(ctx, http.MethodGet, s.opts.UserURL+"/api/v1/users/"+s.userID, token, nil, nil)
+	if err == nil {
+		return fmt.Errorf("user still exists after deletion")
+	}
+	if statusErr, ok := err.(*statusError); !ok || (statusErr.code != http.StatusNotFound && statusErr.code != http.StatusUnauthorized) {
+		return fmt.Errorf("read after deletion: %w", err)
+	}
+	return nil
+}
+
+// statusError is a response with an error status
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("HTTP %d", e.code)
+	}
+	return fmt.Sprintf("HTTP %d: %s", e.code, e.message)
+}
+
+// call sends a JSON request and decodes the JSON response into out
+func (s *scenario) call(ctx context.Context, method, target, token string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var status struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &status)
+		return &statusError{code: resp.StatusCode, message: status.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,105 @@
+package projector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	eventspb "github.com/linkeunid/hello-go/api/gen/events"
+	authservice "github.com/linkeunid/hello-go/internal/auth/service"
+	"github.com/linkeunid/hello-go/internal/user/service"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	"github.com/linkeunid/hello-go/pkg/events"
+)
+
+// ConsumerName is the name the projector's offset is stored under in event_offsets
+const ConsumerName = "user.projector"
+
+// Projector keeps the user service's users up to date with the auth service's
+// events, so the services can keep their users in separate databases.
+//
+// Events are delivered at least once and projected idempotently: changes older
+// than the stored user are skipped.
+type Projector struct {
+	service    service.UserService
+	subscriber *events.Subscriber
+	logger     *zap.Logger
+}
+
+// NewProjector creates a projector reading the events table of USER_EVENTS_DB_*
+func NewProjector(cfg *config.Config, svc service.UserService, logger *zap.Logger) (*Projector, error) {
+	eventsCfg := *cfg
+	eventsCfg.Database = cfg.User.EventsDatabase
+	db, err := database.Open(&eventsCfg, logger.Named("database"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to events database: %w", err)
+	}
+
+	p := &Projector{
+		service: svc,
+		logger:  logger,
+	}
+
+	consumer := events.NewConsumer(logger)
+	consumer.Use(events.Logging(logger), events.Recover())
+	events.Handle(consumer, authservice.EventUserRegistered, p.userRegistered)
+	events.Handle(consumer, authservice.EventEmailChanged, p.emailChanged)
+
+	if p.subscriber, err = events.NewSubscriber(cfg, db, ConsumerName, consumer, logger); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Start projects events until the context is cancelled
+func (p *Projector) Start(ctx context.Context) {
+	p.subscriber.Start(ctx)
+}
+
+// userRegistered creates the user of a registration
+func (p *Projector) userRegistered(ctx context.Context, event events.Event, payload *eventspb.UserRegistered) error {
+	tenant := tenantOf(payload.TenantId)
+	return p.result(payload.UserId, p.service.ProjectRegistration(database.WithTenant(ctx, tenant), &service.User{
+		ID:        payload.UserId,
+		TenantID:  tenant,
+		Email:     payload.Email,
+		Name:      payload.Name,
+		Role:      payload.Role,
+		CreatedAt: event.OccurredAt,
+	}, event.OccurredAt))
+}
+
+// emailChanged sets the new email of a user
+func (p *Projector) emailChanged(ctx context.Context, event events.Event, payload *eventspb.EmailChanged) error {
+	ctx = database.WithTenant(ctx, tenantOf(payload.TenantId))
+	return p.result(payload.UserId, p.service.ProjectEmailChange(ctx, payload.UserId, payload.NewEmail, event.OccurredAt))
+}
+
+// tenantOf returns the tenant of an event's user, events published before
+// tenancy have none and are in the default tenant
+func tenantOf(tenant string) string {
+	if tenant == "" {
+		return config.DefaultTenant
+	}
+	return tenant
+}
+
+// result decides what a failed projection means for the event. Users deleted
+// from the user store stay deleted, and emails taken by another user won't
+// free up by retrying, the reconciler reports them.
+func (p *Projector) result(userID string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, service.ErrUserNotFound):
+		p.logger.Debug("Skipping event of unknown user", zap.String("user_id", userID))
+		return nil
+	case errors.Is(err, service.ErrEmailTaken):
+		return events.Permanent(err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// UpdateCustomFields sets the given custom fields of a user, nil values remove fields.
+// The user is locked while the fields are merged so concurrent updates of other fields are kept.
+func (r *userRepository) UpdateCustomFields(ctx context.Context, id string, changes map[string]interface{}) (*User, error) {
+	r.logger.Debug("Updating custom fields", zap.String("user_id", id))
+
+	var user *User
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		users := r.users.WithDB(tx.Clauses(clause.Locking{Strength: "UPDATE"}))
+
+		var err error
+		if user, err = users.Get(ctx, id); err != nil {
+			return err
+		}
+
+		fields := database.JSONMap{}
+		for name, value := range user.CustomFields {
+			fields[name] = value
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(fields, name)
+			} else {
+				fields[name] = value
+			}
+		}
+
+		user.CustomFields = fields
+		user.UpdatedAt = time.Now()
+		return r.users.WithDB(tx).Update(ctx, id, map[string]interface{}{
+			"custom_fields": user.CustomFields,
+			"updated_at":    user.UpdatedAt,
+		})
+	})
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			r.logger.Error("Database error while updating custom fields",
+				zap.String("user_id", id),
+				zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+	"github.com/linkeunid/hello-go/pkg/listfilter"
+)
+
+// User orders, see UserFilter.OrderBy
+const (
+	OrderCreatedAtDesc = "created_at_desc"
+	OrderCreatedAtAsc  = "created_at_asc"
+	OrderNameAsc       = "name_asc"
+	OrderNameDesc      = "name_desc"
+)
+
+// userOrders are the ORDER BY clauses of the user orders
+var userOrders = map[string]string{
+	OrderCreatedAtDesc: "created_at DESC",
+	OrderCreatedAtAsc:  "created_at ASC",
+	OrderNameAsc:       "name ASC",
+	OrderNameDesc:      "name DESC",
+}
+
+// UserFilterFields are the fields of user filter expressions, see UserFilter.Expression
+var UserFilterFields = listfilter.Schema{
+	"name":       {Column: "name", Type: listfilter.String},
+	"username":   {Column: "username", Type: listfilter.String},
+	"email":      {Column: "email", Type: listfilter.String},
+	"status":     {Column: "status", Type: listfilter.String, Values: []string{"active", "pending", "suspended", "rejected"}},
+	"created_at": {Column: "created_at", Type: listfilter.Timestamp},
+	"updated_at": {Column: "updated_at", Type: listfilter.Timestamp},
+}
+
+// UserFilter narrows the listed users, empty fields match everything
+type UserFilter struct {
+	// CustomFields match users whose custom field of the key has the value as text,
+	// see database.JSONText
+	CustomFields map[string]string
+	// CreatedAfter matches users created after the time
+	CreatedAfter time.Time
+	// Status matches the account status, the column is managed by the auth service
+	Status string
+	// Tags match users having all of them, they must not repeat. Tags are
+	// managed by the auth service in the user_tags table.
+	Tags []string
+	// Expression matches users by UserFilterFields, see listfilter.Parse
+	Expression listfilter.Expr
+	// OrderBy is one of the Order constants, newest first if empty
+	OrderBy string
+}
+
+// scopes returns the filter as query scopes, it fails if the database can't query JSON
+func (f UserFilter) scopes(db *gorm.DB) ([]database.Scope, error) {
+	names := make([]string, 0, len(f.CustomFields))
+	for name := range f.CustomFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	scopes := make([]database.Scope, 0, len(names)+5)
+	for _, name := range names {
+		expr, args, err := database.JSONText(db, "custom_fields", name)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, database.Where(expr+" = ?", append(args, f.CustomFields[name])...))
+	}
+	if !f.CreatedAfter.IsZero() {
+		scopes = append(scopes, database.Where("created_at > ?", f.CreatedAfter))
+	}
+	if f.Status != "" {
+		scopes = append(scopes, database.Where("status = ?", f.Status))
+	}
+	if len(f.Tags) > 0 {
+		scopes = append(scopes, database.Where(
+			"id IN (SELECT user_id FROM user_tags WHERE tag IN ? GROUP BY user_id HAVING COUNT(*) = ?)",
+			f.Tags, len(f.Tags)))
+	}
+	if f.Expression != nil {
+		scopes = append(scopes, listfilter.Scope(f.Expression))
+	}
+
+	order, ok := userOrders[f.OrderBy]
+	if !ok {
+		order = userOrders[OrderCreatedAtDesc]
+	}
+	scopes = append(scopes, database.OrderBy(order))
+	return scopes, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Projected writes copy changes made by the auth service. They're idempotent:
+// a change is skipped when the user was updated at or after it happened, so
+// redelivered and out of order events can't undo newer changes.
+
+// ProjectUser creates the user or, if it exists, sets its email, name and role.
+// It reports whether the user was written.
+func (r *userRepository) ProjectUser(ctx context.Context, user *User, at time.Time) (bool, error) {
+	return r.project(ctx, user.ID, at, user, map[string]interface{}{
+		"email": user.Email,
+		"name":  user.Name,
+		"role":  user.Role,
+	})
+}
+
+// ProjectEmail sets the email of an existing user and reports whether it was written
+func (r *userRepository) ProjectEmail(ctx context.Context, id, email string, at time.Time) (bool, error) {
+	return r.project(ctx, id, at, nil, map[string]interface{}{"email": email})
+}
+
+// project applies a change made at the given time to a user, creating the
+// user if it doesn't exist and create is set
+func (r *userRepository) project(ctx context.Context, id string, at time.Time, create *User, updates map[string]interface{}) (bool, error) {
+	written := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		users := r.users.WithDB(tx)
+
+		existing, err := users.Get(ctx, id, "id", "updated_at")
+		if errors.Is(err, ErrUserNotFound) && create != nil {
+			created := *create
+			created.UpdatedAt = at
+			written = true
+			return users.Create(ctx, &created)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !existing.UpdatedAt.Before(at) {
+			return nil
+		}
+		updates["updated_at"] = at
+		written = true
+		return users.Update(ctx, id, updates)
+	})
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			r.logger.Error("Database error while projecting user",
+				zap.String("user_id", id),
+				zap.Error(err))
+		}
+		return false, err
+	}
+
+	r.logger.Debug("User projected",
+		zap.String("user_id", id),
+		zap.Time("at", at),
+		zap.Bool("written", written))
+
+	return written, nil
+}
@@ -7,112 +7,171 @@ import (
 	"time"
 
 	"go.uber.org/zap"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	gormlogger "gorm.io/gorm/logger"
 
+	"github.com/linkeunid/hello-go/internal/anonymize"
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	"github.com/linkeunid/hello-go/pkg/migrate"
 )
 
 // Common errors
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound            = errors.New("user not found")
+	ErrUsernameTaken           = errors.New("username is taken")
+	ErrUsernameHeld            = errors.New("username was recently released by another user")
+	ErrAnonymizationIncomplete = errors.New("user references remain after anonymization")
 )
 
 // User represents a user in the database
 type User struct {
-	ID        string `gorm:"primaryKey;type:varchar(36)"`
-	Email     string `gorm:"uniqueIndex;type:varchar(100)"`
-	Password  string `gorm:"type:varchar(255)"`
-	Name      string `gorm:"type:varchar(100)"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID string `gorm:"primaryKey;type:varchar(36)"`
+	// TenantID is the customer the user belongs to, emails are unique per tenant
+	TenantID string  `gorm:"uniqueIndex:idx_users_email_tenant_id,priority:2;index;type:varchar(36);default:'default'"`
+	Email    string  `gorm:"uniqueIndex:idx_users_email_tenant_id,priority:1;type:varchar(100)"`
+	Password string  `gorm:"type:varchar(255)"`
+	Name     string  `gorm:"type:varchar(100)"`
+	Username *string `gorm:"uniqueIndex;type:varchar(30)"`
+	// Role is managed by the auth service
+	Role     string `gorm:"type:varchar(20);default:'user'"`
+	Locale   string `gorm:"type:varchar(35);default:''"`
+	Timezone string `gorm:"type:varchar(64);default:''"`
+	// LastSeenAt is when the user last made a request, written at most every PRESENCE_UPDATE_INTERVAL
+	LastSeenAt *time.Time
+	// PresenceVisibility is who sees whether the user is online, empty for PRESENCE_DEFAULT_VISIBILITY
+	PresenceVisibility string `gorm:"type:varchar(10);default:''"`
+	// CustomFields holds the values of the USER_CUSTOM_FIELDS by name
+	CustomFields database.JSONMap
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// GetUsername returns the username, or an empty string if the user has none
+func (u *User) GetUsername() string {
+	if u.Username == nil {
+		return ""
+	}
+	return *u.Username
+}
+
+// UsernameHistory records a username released by a user
+type UsernameHistory struct {
+	ID         uint64    `gorm:"primaryKey;autoIncrement"`
+	UserID     string    `gorm:"index;type:varchar(36)"`
+	Username   string    `gorm:"index;type:varchar(30)"`
+	ReleasedAt time.Time `gorm:"index"`
+}
+
+// Models returns the database models managed by this repository
+func Models() []interface{} {
+	return []interface{}{&User{}, &UsernameHistory{}}
+}
+
+// Indexes returns the indexes the repository's queries rely on, created by the migrations
+func Indexes() []migrate.AddIndex {
+	return []migrate.AddIndex{
+		{Table: "users", Name: "idx_users_email_tenant_id", Columns: []string{"email", "tenant_id"}, Unique: true},
+		{Table: "users", Name: "idx_users_tenant_id", Columns: []string{"tenant_id"}},
+		{Table: "users", Name: "idx_users_created_at_id", Columns: []string{"created_at", "id"}},
+	}
 }
 
 // UserRepository defines the interface for user repository operations
 type UserRepository interface {
-	// GetUserByID gets a user by ID
-	GetUserByID(ctx context.Context, id string) (*User, error)
+	// GetUserByID gets a user by ID, loading only the given columns if any
+	GetUserByID(ctx context.Context, id string, columns ...string) (*User, error)
 	// UpdateUser updates a user's information
 	UpdateUser(ctx context.Context, id, name, email string) (*User, error)
+	// UpdatePreferences updates a user's locale and timezone
+	UpdatePreferences(ctx context.Context, id, locale, timezone string) (*User, error)
+	// TouchLastSeen records that the user made a request at the given time
+	TouchLastSeen(ctx context.Context, id string, at time.Time) error
+	// UpdatePresenceVisibility sets who sees whether the user is online
+	UpdatePresenceVisibility(ctx context.Context, id, visibility string) (*User, error)
+	// UpdateCustomFields sets the given custom fields of a user, nil values remove fields
+	UpdateCustomFields(ctx context.Context, id string, changes map[string]interface{}) (*User, error)
+	// EmailTaken checks if a user other than excludeID has the email
+	EmailTaken(ctx context.Context, email, excludeID string) (bool, error)
+	// CountUsers counts the users created at or after since, every user for a zero time
+	CountUsers(ctx context.Context, since time.Time) (int, error)
+	// GetUserByUsername gets a user by username
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	// UpdateUsername changes a user's username, refusing usernames released by others after heldSince
+	UpdateUsername(ctx context.Context, id, username string, heldSince time.Time) (*User, error)
 	// DeleteUser deletes a user by ID
 	DeleteUser(ctx context.Context, id string) error
-	// ListUsers returns a list of users
-	ListUsers(ctx context.Context, page, pageSize int) ([]*User, int, error)
+	// ListUsers returns a list of users matching the filter, loading only the given columns if any
+	ListUsers(ctx context.Context, filter UserFilter, page, pageSize int, columns ...string) ([]*User, int, error)
+	// ProjectUser creates or updates a user registered with the auth service, unless it changed since at
+	ProjectUser(ctx context.Context, user *User, at time.Time) (bool, error)
+	// ProjectEmail sets the email the auth service changed at the given time, unless the user changed since
+	ProjectEmail(ctx context.Context, id, email string, at time.Time) (bool, error)
+	// DB returns the database connection, e.g. for the usage meter
+	DB() *gorm.DB
+	// Ping checks the database connection
+	Ping(ctx context.Context) error
 }
 
 // userRepository implements the UserRepository interface
 type userRepository struct {
-	db     *gorm.DB
-	logger *zap.Logger
+	db         *gorm.DB
+	users      *database.Repository[User]
+	anonymizer *anonymize.Anonymizer
+	logger     *zap.Logger
 }
 
 // NewUserRepository creates a new user repository
 func NewUserRepository(cfg *config.Config, logger *zap.Logger) UserRepository {
-	// Create custom GORM logger that uses zap
-	gormLogger := logger.Named("gorm")
-
-	zapAdapter := zapGormLogger{
-		Logger: gormLogger,
-		Config: gormlogger.Config{
-			SlowThreshold:             200 * time.Millisecond,
-			LogLevel:                  gormlogger.Info,
-			IgnoreRecordNotFoundError: false,
-			Colorful:                  false,
-		},
-	}
-
-	var db *gorm.DB
-	var err error
-
-	if cfg.Database.Driver == "mysql" {
-		// Connect to MySQL database
-		db, err = gorm.Open(mysql.Open(cfg.Database.GetDSN()), &gorm.Config{
-			Logger: zapAdapter,
-		})
-	} else {
-		logger.Fatal("Unsupported database driver", zap.String("driver", cfg.Database.Driver))
-	}
-
+	db, err := database.Open(cfg, logger)
 	if err != nil {
 		// Log and panic
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
 
 	// Migrate the schema
-	if err := db.AutoMigrate(&User{}); err != nil {
+	if err := db.AutoMigrate(Models()...); err != nil {
 		logger.Fatal("Failed to migrate database schema", zap.Error(err))
 	}
+	migrate.VerifyIndexes(db, logger, Indexes()...)
+
+	// Spread reads over the replicas, if any
+	if len(cfg.User.ReadReplicas) > 0 {
+		if err := database.UseReadReplicas(db, cfg.Database, cfg.User.ReadReplicas); err != nil {
+			logger.Fatal("Failed to configure read replicas", zap.Error(err))
+		}
+	}
 
 	return &userRepository{
-		db:     db,
-		logger: logger,
+		db:         db,
+		users:      database.NewRepository[User](db, ErrUserNotFound, database.WithTenantColumn("tenant_id")),
+		anonymizer: anonymize.NewAnonymizer(cfg, logger.Named("anonymizer")),
+		logger:     logger,
 	}
 }
 
-// GetUserByID gets a user by ID
-func (r *userRepository) GetUserByID(ctx context.Context, id string) (*User, error) {
-	var user User
-
-	r.logger.Debug("Getting user by ID", zap.String("user_id", id))
+// GetUserByID gets a user by ID, loading only the given columns if any
+func (r *userRepository) GetUserByID(ctx context.Context, id string, columns ...string) (*User, error) {
+	r.logger.Debug("Getting user by ID",
+		zap.String("user_id", id),
+		zap.Strings("columns", columns))
 
-	result := r.db.WithContext(ctx).Where("id = ?", id).First(&user)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+	user, err := r.users.Get(ctx, id, columns...)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
 			r.logger.Debug("User not found", zap.String("user_id", id))
-			return nil, ErrUserNotFound
+			return nil, err
 		}
 		r.logger.Error("Database error while getting user",
 			zap.String("user_id", id),
-			zap.Error(result.Error))
-		return nil, result.Error
+			zap.Error(err))
+		return nil, err
 	}
 
 	r.logger.Debug("User found",
 		zap.String("user_id", id),
 		zap.String("email", user.Email))
 
-	return &user, nil
+	return user, nil
 }
 
 // UpdateUser updates a user's information
@@ -122,8 +181,8 @@ func (r *userRepository) UpdateUser(ctx context.Context, id, name, email string)
 		zap.String("name", name),
 		zap.String("email", email))
 
-	// Get user
-	user, err := r.GetUserByID(ctx, id)
+	// Get user from the primary, saving a stale replica row would undo recent writes
+	user, err := r.GetUserByID(database.WithPrimary(ctx), id)
 	if err != nil {
 		return nil, err
 	}
@@ -134,12 +193,11 @@ func (r *userRepository) UpdateUser(ctx context.Context, id, name, email string)
 	user.UpdatedAt = time.Now()
 
 	// Save to database
-	result := r.db.WithContext(ctx).Save(user)
-	if result.Error != nil {
+	if err := r.users.Save(ctx, user); err != nil {
 		r.logger.Error("Database error while updating user",
 			zap.String("user_id", id),
-			zap.Error(result.Error))
-		return nil, result.Error
+			zap.Error(err))
+		return nil, err
 	}
 
 	r.logger.Debug("User updated successfully",
@@ -149,124 +207,278 @@ func (r *userRepository) UpdateUser(ctx context.Context, id, name, email string)
 	return user, nil
 }
 
-// DeleteUser deletes a user by ID
-func (r *userRepository) DeleteUser(ctx context.Context, id string) error {
-	r.logger.Debug("Deleting user", zap.String("user_id", id))
+// UpdatePreferences updates a user's locale and timezone
+func (r *userRepository) UpdatePreferences(ctx context.Context, id, locale, timezone string) (*User, error) {
+	r.logger.Debug("Updating user preferences",
+		zap.String("user_id", id),
+		zap.String("locale", locale),
+		zap.String("timezone", timezone))
 
-	// Check if user exists
-	if _, err := r.GetUserByID(ctx, id); err != nil {
-		return err
+	// Get user from the primary, saving a stale replica row would undo recent writes
+	user, err := r.GetUserByID(database.WithPrimary(ctx), id)
+	if err != nil {
+		return nil, err
 	}
 
-	result := r.db.WithContext(ctx).Delete(&User{}, "id = ?", id)
-	if result.Error != nil {
-		r.logger.Error("Database error while deleting user",
+	// Update fields
+	user.Locale = locale
+	user.Timezone = timezone
+	user.UpdatedAt = time.Now()
+
+	// Save to database
+	if err := r.users.Save(ctx, user); err != nil {
+		r.logger.Error("Database error while updating user preferences",
 			zap.String("user_id", id),
-			zap.Error(result.Error))
-		return result.Error
+			zap.Error(err))
+		return nil, err
 	}
 
-	if result.RowsAffected == 0 {
-		r.logger.Warn("No rows affected when deleting user",
-			zap.String("user_id", id))
-		return fmt.Errorf("no rows affected: %w", ErrUserNotFound)
-	}
+	r.logger.Debug("User preferences updated successfully", zap.String("user_id", id))
 
-	r.logger.Debug("User deleted successfully", zap.String("user_id", id))
+	return user, nil
+}
+
+// TouchLastSeen records that the user made a request at the given time.
+// It doesn't change updated_at, which tracks changes to the user's data.
+func (r *userRepository) TouchLastSeen(ctx context.Context, id string, at time.Time) error {
+	err := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).UpdateColumn("last_seen_at", at).Error
+	if err != nil {
+		r.logger.Error("Database error while updating last seen time",
+			zap.String("user_id", id),
+			zap.Error(err))
+		return err
+	}
 	return nil
 }
 
-// ListUsers returns a list of users
-func (r *userRepository) ListUsers(ctx context.Context, page, pageSize int) ([]*User, int, error) {
-	var users []*User
-	var total int64
+// UpdatePresenceVisibility sets who sees whether the user is online
+func (r *userRepository) UpdatePresenceVisibility(ctx context.Context, id, visibility string) (*User, error) {
+	r.logger.Debug("Updating presence visibility",
+		zap.String("user_id", id),
+		zap.String("visibility", visibility))
 
-	r.logger.Debug("Listing users",
-		zap.Int("page", page),
-		zap.Int("page_size", pageSize))
+	if err := r.users.Update(ctx, id, map[string]interface{}{"presence_visibility": visibility}); err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			r.logger.Error("Database error while updating presence visibility",
+				zap.String("user_id", id),
+				zap.Error(err))
+		}
+		return nil, err
+	}
 
-	// Calculate offset
-	offset := (page - 1) * pageSize
+	return r.GetUserByID(database.WithPrimary(ctx), id)
+}
 
-	// Get total count
-	result := r.db.WithContext(ctx).Model(&User{}).Count(&total)
-	if result.Error != nil {
-		r.logger.Error("Database error counting users", zap.Error(result.Error))
-		return nil, 0, result.Error
-	}
+// EmailTaken checks if a user other than excludeID has the email.
+// Emails are compared case-insensitively by the column's collation.
+func (r *userRepository) EmailTaken(ctx context.Context, email, excludeID string) (bool, error) {
+	r.logger.Debug("Checking if email is taken",
+		zap.String("email", email),
+		zap.String("exclude_id", excludeID))
 
-	// Get users
-	result = r.db.WithContext(ctx).
-		Order("created_at DESC").
-		Offset(offset).
-		Limit(pageSize).
-		Find(&users)
-	if result.Error != nil {
-		r.logger.Error("Database error listing users", zap.Error(result.Error))
-		return nil, 0, result.Error
+	// Check the primary, a replica may not have seen a recent change yet
+	count, err := r.users.Count(database.WithPrimary(ctx), database.Where("email = ? AND id <> ?", email, excludeID))
+	if err != nil {
+		r.logger.Error("Database error while checking email",
+			zap.String("email", email),
+			zap.Error(err))
+		return false, err
 	}
 
-	r.logger.Debug("Listed users successfully",
-		zap.Int("count", len(users)),
-		zap.Int64("total", total))
-
-	return users, int(total), nil
+	return count > 0, nil
 }
 
-// Custom GORM logger that uses Zap
-type zapGormLogger struct {
-	Logger *zap.Logger
-	gormlogger.Config
-}
+// CountUsers counts the users created at or after since, every user for a zero time
+func (r *userRepository) CountUsers(ctx context.Context, since time.Time) (int, error) {
+	r.logger.Debug("Counting users", zap.Time("since", since))
 
-// LogMode sets log mode
-func (l zapGormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
-	newLogger := l
-	newLogger.LogLevel = level
-	return newLogger
+	count, err := r.users.Count(ctx, database.Where("created_at >= ?", since))
+	if err != nil {
+		r.logger.Error("Database error while counting users", zap.Error(err))
+		return 0, err
+	}
+
+	return int(count), nil
 }
 
-// Info logs info
-func (l zapGormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
-	if l.LogLevel >= gormlogger.Info {
-		l.Logger.Sugar().Infof(msg, data...)
+// GetUserByUsername gets a user by username
+func (r *userRepository) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	r.logger.Debug("Getting user by username", zap.String("username", username))
+
+	user, err := r.users.First(ctx, database.Where("username = ?", username))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			r.logger.Debug("User not found", zap.String("username", username))
+			return nil, err
+		}
+		r.logger.Error("Database error while getting user",
+			zap.String("username", username),
+			zap.Error(err))
+		return nil, err
 	}
+
+	return user, nil
 }
 
-// Warn logs warning
-func (l zapGormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
-	if l.LogLevel >= gormlogger.Warn {
-		l.Logger.Sugar().Warnf(msg, data...)
+// UpdateUsername changes a user's username, refusing usernames released by others after heldSince
+func (r *userRepository) UpdateUsername(ctx context.Context, id, username string, heldSince time.Time) (*User, error) {
+	r.logger.Debug("Updating username",
+		zap.String("user_id", id),
+		zap.String("username", username))
+
+	var user *User
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		users := r.users.WithDB(tx)
+
+		// Get user
+		var err error
+		if user, err = users.Get(ctx, id); err != nil {
+			return err
+		}
+
+		previous := user.Username
+		if previous != nil && *previous == username {
+			return nil
+		}
+
+		// Check that no other user has the username
+		count, err := users.Count(ctx, database.Where("username = ? AND id <> ?", username, id))
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrUsernameTaken
+		}
+
+		// Recently released usernames stay reserved for their previous owner
+		if err := tx.Model(&UsernameHistory{}).
+			Where("username = ? AND user_id <> ? AND released_at > ?", username, id, heldSince).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrUsernameHeld
+		}
+
+		// Update username
+		user.Username = &username
+		user.UpdatedAt = time.Now()
+		if err := users.Save(ctx, user); err != nil {
+			if errors.Is(err, database.ErrDuplicate) {
+				return ErrUsernameTaken
+			}
+			return err
+		}
+
+		// Record the released username
+		if previous != nil {
+			history := UsernameHistory{
+				UserID:     id,
+				Username:   *previous,
+				ReleasedAt: time.Now(),
+			}
+			if err := tx.Create(&history).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) && !errors.Is(err, ErrUsernameTaken) && !errors.Is(err, ErrUsernameHeld) {
+			r.logger.Error("Database error while updating username",
+				zap.String("user_id", id),
+				zap.Error(err))
+		}
+		return nil, err
 	}
+
+	r.logger.Debug("Username updated successfully",
+		zap.String("user_id", id),
+		zap.String("username", username))
+
+	return user, nil
 }
 
-// Error logs error
-func (l zapGormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
-	if l.LogLevel >= gormlogger.Error {
-		l.Logger.Sugar().Errorf(msg, data...)
+// DeleteUser deletes a user by ID.
+// References to the user in audit data are replaced with pseudonyms in the same
+// transaction, which is rolled back if any reference is left.
+func (r *userRepository) DeleteUser(ctx context.Context, id string) error {
+	r.logger.Debug("Deleting user", zap.String("user_id", id))
+
+	// Check if user exists, the email is needed for anonymization
+	user, err := r.GetUserByID(database.WithPrimary(ctx), id)
+	if err != nil {
+		return err
 	}
-}
 
-// Trace logs SQL trace
-func (l zapGormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
-	if l.LogLevel <= gormlogger.Silent {
-		return
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := r.users.WithDB(tx).Delete(ctx, id); err != nil {
+			if errors.Is(err, ErrUserNotFound) {
+				r.logger.Warn("No rows affected when deleting user",
+					zap.String("user_id", id))
+				return fmt.Errorf("no rows affected: %w", err)
+			}
+			return err
+		}
+
+		// Anonymize audit data and verify nothing is left
+		report, err := r.anonymizer.Anonymize(ctx, tx, id, user.Email)
+		if err != nil {
+			return err
+		}
+		if !report.Verified() {
+			return ErrAnonymizationIncomplete
+		}
+
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			r.logger.Error("Database error while deleting user",
+				zap.String("user_id", id),
+				zap.Error(err))
+		}
+		return err
 	}
 
-	elapsed := time.Since(begin)
-	sql, rows := fc()
-	fields := []zap.Field{
-		zap.String("sql", sql),
-		zap.Int64("rows", rows),
-		zap.Duration("elapsed", elapsed),
+	r.logger.Debug("User deleted successfully", zap.String("user_id", id))
+	return nil
+}
+
+// ListUsers returns a list of users matching the filter, loading only the given columns if any
+func (r *userRepository) ListUsers(ctx context.Context, filter UserFilter, page, pageSize int, columns ...string) ([]*User, int, error) {
+	r.logger.Debug("Listing users",
+		zap.Any("filter", filter),
+		zap.Int("page", page),
+		zap.Int("page_size", pageSize),
+		zap.Strings("columns", columns))
+
+	scopes, err := filter.scopes(r.db)
+	if err != nil {
+		return nil, 0, err
 	}
+	scopes = append(scopes, database.Columns(columns...))
 
-	switch {
-	case err != nil && l.LogLevel >= gormlogger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
-		l.Logger.Error("SQL error", append(fields, zap.Error(err))...)
-	case elapsed > l.SlowThreshold && l.SlowThreshold != 0 && l.LogLevel >= gormlogger.Warn:
-		l.Logger.Warn("Slow SQL query", fields...)
-	case l.LogLevel >= gormlogger.Info:
-		l.Logger.Debug("SQL query", fields...)
+	users, total, err := r.users.List(ctx, page, pageSize, scopes...)
+	if err != nil {
+		r.logger.Error("Database error listing users", zap.Error(err))
+		return nil, 0, err
 	}
+
+	r.logger.Debug("Listed users successfully",
+		zap.Int("count", len(users)),
+		zap.Int("total", total))
+
+	return users, total, nil
+}
+
+// Ping checks the database connection
+func (r *userRepository) Ping(ctx context.Context) error {
+	return r.users.Ping(ctx)
+}
+
+// DB returns the database connection
+func (r *userRepository) DB() *gorm.DB {
+	return r.db
 }
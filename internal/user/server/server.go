@@ -2,9 +2,15 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -12,9 +18,22 @@ import (
 	// Update import path to use the generated code in api/gen/user
 	"github.com/linkeunid/hello-go/api/gen/user"
 	"github.com/linkeunid/hello-go/internal/auth/client"
+	"github.com/linkeunid/hello-go/internal/user/projector"
 	"github.com/linkeunid/hello-go/internal/user/service"
+	"github.com/linkeunid/hello-go/pkg/cache"
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/fieldmask"
+	"github.com/linkeunid/hello-go/pkg/flightrecorder"
+	"github.com/linkeunid/hello-go/pkg/health"
+	"github.com/linkeunid/hello-go/pkg/listfilter"
+	"github.com/linkeunid/hello-go/pkg/metering"
 	"github.com/linkeunid/hello-go/pkg/middleware"
+	"github.com/linkeunid/hello-go/pkg/presence"
+	"github.com/linkeunid/hello-go/pkg/readonly"
+	"github.com/linkeunid/hello-go/pkg/revocation"
+	"github.com/linkeunid/hello-go/pkg/siem"
 )
 
 // UserServer implements the UserService gRPC service
@@ -24,8 +43,16 @@ type UserServer struct {
 	service      service.UserService
 	authClient   client.AuthClient
 	jwtValidator *middleware.JWTValidator
-	logger       *zap.Logger
-	useMockMode  bool
+	security     siem.Emitter
+	presence     presence.Throttle
+	recorder     *flightrecorder.Recorder
+	readOnly     *readonly.Mode
+	// projector is nil unless USER_PROJECTION_ENABLED is set
+	projector *projector.Projector
+	// tokens caches validated tokens by token hash
+	tokens      *cache.Cache[string, cachedToken]
+	logger      *zap.Logger
+	useMockMode bool
 }
 
 // NewUserServer creates a new UserServer instance
@@ -55,17 +82,119 @@ func NewUserServer(cfg *config.Config, logger *zap.Logger) *UserServer {
 	} else {
 		svc = service.NewUserService(cfg, logger.Named("user_service"))
 	}
+	jwtValidator.Revocations = svc.Revocations()
+
+	security, err := siem.NewEmitter(cfg, "user", logger.Named("siem"))
+	if err != nil {
+		logger.Fatal("Failed to create security event emitter", zap.Error(err))
+	}
+
+	// Track presence, in memory for mock services
+	var tracker presence.Throttle
+	if cfg.Presence.Enabled {
+		if useMock {
+			tracker = presence.NewMemoryThrottle(cfg)
+		} else if tracker, err = presence.NewThrottle(cfg); err != nil {
+			logger.Fatal("Failed to create presence throttle", zap.Error(err))
+		}
+	}
+
+	// Project the auth service's events into the users table, they're only stored with a database
+	var userProjector *projector.Projector
+	if cfg.User.Projection {
+		if useMock {
+			logger.Warn("User projection is disabled with mock services")
+		} else if userProjector, err = projector.NewProjector(cfg, svc, logger.Named("projector")); err != nil {
+			logger.Fatal("Failed to create user projector", zap.Error(err))
+		}
+	}
 
 	return &UserServer{
 		cfg:          cfg,
 		service:      svc,
 		authClient:   authClient,
 		jwtValidator: jwtValidator,
+		security:     security,
+		presence:     tracker,
+		recorder:     flightrecorder.NewRecorder(cfg, "user"),
+		readOnly:     readonly.NewMode(cfg, logger.Named("read_only")),
+		projector:    userProjector,
+		tokens:       cache.New[string, cachedToken]("tokens", cfg.LocalCache.Tokens),
 		logger:       logger.Named("user_server"),
 		useMockMode:  useMock,
 	}
 }
 
+// SecurityEvents returns the emitter for the service's security events
+func (s *UserServer) SecurityEvents() siem.Emitter {
+	return s.security
+}
+
+// Recorder returns the flight recorder of the service's recent requests
+func (s *UserServer) Recorder() *flightrecorder.Recorder {
+	return s.recorder
+}
+
+// FlightRecorder returns the FlightRecorderService for the service's recent requests, admins only
+func (s *UserServer) FlightRecorder() *flightrecorder.Server {
+	return flightrecorder.NewServer(s.recorder, s.requireAdmin, s.logger.Named("flight_recorder"))
+}
+
+// Caches returns the CacheService for the service's in-process caches, admins only
+func (s *UserServer) Caches() *cache.Server {
+	return cache.NewServer("user", s.requireAdmin, s.logger.Named("cache"))
+}
+
+// Database returns the DatabaseService for the service's SQL log settings, admins only
+func (s *UserServer) Database() *database.Server {
+	return database.NewServer(s.cfg, "user", s.requireAdmin, s.logger.Named("database"))
+}
+
+// ReadOnlyMode returns whether the service rejects mutations
+func (s *UserServer) ReadOnlyMode() *readonly.Mode {
+	return s.readOnly
+}
+
+// ReadOnly returns the ReadOnlyService for the service's read-only mode, admins only
+func (s *UserServer) ReadOnly() *readonly.Server {
+	return readonly.NewServer(s.readOnly, "user", s.requireAdmin, s.logger.Named("read_only"))
+}
+
+// Meter returns the service's usage meter
+func (s *UserServer) Meter() *metering.Meter {
+	return s.service.Meter()
+}
+
+// RunProjection projects the auth service's events into the users table until
+// ctx is cancelled, if enabled
+func (s *UserServer) RunProjection(ctx context.Context) {
+	if s.projector != nil {
+		s.projector.Start(ctx)
+	}
+}
+
+// Close flushes pending usage and security events
+func (s *UserServer) Close() error {
+	if err := s.service.Meter().Close(); err != nil {
+		s.logger.Error("Failed to flush usage", zap.Error(err))
+	}
+	return s.security.Close()
+}
+
+// Checks returns the dependency checks reported by the status service
+func (s *UserServer) Checks() []health.Check {
+	checks := []health.Check{
+		{Name: "database", Critical: true, Probe: s.service.Ping},
+	}
+
+	// Tokens are validated locally when auth is bypassed, so the auth service isn't needed
+	if s.authClient != nil {
+		checks = append(checks, health.Check{Name: "auth_service", Critical: true, Probe: s.authClient.Ping})
+	}
+
+	return checks
+}
+
 // GetUser returns a user by ID
 func (s *UserServer) GetUser(ctx context.Context, req *user.GetUserRequest) (*user.GetUserResponse, error) {
 	// Authenticate request - can be bypassed in mock mode
@@ -76,34 +205,37 @@ func (s *UserServer) GetUser(ctx context.Context, req *user.GetUserRequest) (*us
 
 	s.logger.Debug("GetUser request",
 		zap.String("requested_user_id", req.Id),
-		zap.String("requester_user_id", userID))
+		zap.String("requester_user_id", userID),
+		zap.Strings("read_mask", req.ReadMask.GetPaths()))
 
-	// Get user
-	userData, err := s.service.GetUser(ctx, req.Id)
+	// Validate read mask
+	if !fieldmask.Validate(req.ReadMask, &user.User{}) {
+		return nil, status.Error(codes.InvalidArgument, "invalid read_mask")
+	}
+
+	// Read a recent update from the primary
+	ctx, err = service.ReadAfterWrite(ctx, req.Id, req.ConsistencyToken, s.cfg.User.ConsistencyWindow)
 	if err != nil {
-		if err == service.ErrUserNotFound {
-			s.logger.Warn("User not found",
-				zap.String("user_id", req.Id))
-			return nil, status.Error(codes.NotFound, "user not found")
-		}
-		s.logger.Error("Failed to get user",
-			zap.String("user_id", req.Id),
-			zap.Error(err))
-		return nil, status.Error(codes.Internal, "failed to get user")
+		return nil, apperrors.MapToStatus(err, "failed to get user")
+	}
+
+	// Get user, loading only the columns the read mask needs
+	userData, err := s.service.GetUser(ctx, req.Id, readMaskColumns(req.ReadMask, maskColumns)...)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to get user", err, zap.String("user_id", req.Id))
+		return nil, apperrors.MapToStatus(err, "failed to get user")
 	}
 
 	s.logger.Info("User retrieved successfully",
 		zap.String("user_id", req.Id))
 
-	// Return response
+	// Return response, private data only for the owner and admins
+	viewer := s.resolveViewer(ctx, userID)
+	protoUser := toProtoUser(userData, viewer)
+	fieldmask.Prune(protoUser, req.ReadMask)
+
 	return &user.GetUserResponse{
-		User: &user.User{
-			Id:        userData.ID,
-			Email:     userData.Email,
-			Name:      userData.Name,
-			CreatedAt: userData.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			UpdatedAt: userData.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-		},
+		User: protoUser,
 	}, nil
 }
 
@@ -119,42 +251,281 @@ func (s *UserServer) UpdateUser(ctx context.Context, req *user.UpdateUserRequest
 		zap.String("user_id", req.Id),
 		zap.String("requester_user_id", userID),
 		zap.String("new_name", req.Name),
-		zap.String("new_email", req.Email))
+		zap.String("new_email", req.Email),
+		zap.Strings("update_mask", req.UpdateMask.GetPaths()))
 
 	// Only allow users to update their own information
-	if userID != req.Id && userID != "mock-bypass" {
+	if !canModify(ctx, userID, req.Id) {
 		s.logger.Warn("Permission denied: user attempting to update another user",
 			zap.String("requester_id", userID),
 			zap.String("target_id", req.Id))
+		s.emitUserChange(ctx, userID, req.Id, "user.update", "cannot update other users")
 		return nil, status.Error(codes.PermissionDenied, "cannot update other users")
 	}
 
+	// Keep the current values of the fields outside the update mask
+	name, email, err := s.maskedUpdate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
 	// Update user
-	userData, err := s.service.UpdateUser(ctx, req.Id, req.Name, req.Email)
+	userData, err := s.service.UpdateUser(ctx, req.Id, name, email)
 	if err != nil {
-		if err == service.ErrUserNotFound {
-			s.logger.Warn("User not found during update",
-				zap.String("user_id", req.Id))
-			return nil, status.Error(codes.NotFound, "user not found")
-		}
-		s.logger.Error("Failed to update user",
-			zap.String("user_id", req.Id),
-			zap.Error(err))
-		return nil, status.Error(codes.Internal, "failed to update user")
+		apperrors.Log(s.logger, "Failed to update user", err, zap.String("user_id", req.Id))
+		return nil, apperrors.MapToStatus(err, "failed to update user")
 	}
 
 	s.logger.Info("User updated successfully",
 		zap.String("user_id", req.Id))
+	s.emitUserChange(ctx, userID, req.Id, "user.update", "")
 
-	// Return response
+	// Return response, private data only for the owner and admins
+	viewer := s.resolveViewer(ctx, userID)
 	return &user.UpdateUserResponse{
-		User: &user.User{
-			Id:        userData.ID,
-			Email:     userData.Email,
-			Name:      userData.Name,
-			CreatedAt: userData.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			UpdatedAt: userData.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-		},
+		User:             toProtoUser(userData, viewer),
+		ConsistencyToken: service.NewConsistencyToken(userData),
+	}, nil
+}
+
+// maskedUpdate returns the name and email to write for an update. Fields
+// outside the update mask keep their current values, read from the primary.
+func (s *UserServer) maskedUpdate(ctx context.Context, req *user.UpdateUserRequest) (string, string, error) {
+	paths := req.UpdateMask.GetPaths()
+	if len(paths) == 0 {
+		return req.Name, req.Email, nil
+	}
+
+	var updateName, updateEmail bool
+	for _, path := range paths {
+		switch path {
+		case "name":
+			updateName = true
+		case "email":
+			updateEmail = true
+		default:
+			return "", "", status.Errorf(codes.InvalidArgument, "invalid update_mask path %q, expected name or email", path)
+		}
+	}
+	if updateName && updateEmail {
+		return req.Name, req.Email, nil
+	}
+
+	current, err := s.service.GetUser(database.WithPrimary(ctx), req.Id, "name", "email")
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to get user", err, zap.String("user_id", req.Id))
+		return "", "", apperrors.MapToStatus(err, "failed to update user")
+	}
+
+	name, email := current.Name, current.Email
+	if updateName {
+		name = req.Name
+	}
+	if updateEmail {
+		email = req.Email
+	}
+	return name, email, nil
+}
+
+// UpdatePreferences updates a user's locale and timezone
+func (s *UserServer) UpdatePreferences(ctx context.Context, req *user.UpdatePreferencesRequest) (*user.UpdatePreferencesResponse, error) {
+	// Authenticate request - can be bypassed in mock mode
+	userID, err := s.authenticateOrBypass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("UpdatePreferences request",
+		zap.String("user_id", req.Id),
+		zap.String("requester_user_id", userID),
+		zap.String("locale", req.Locale),
+		zap.String("timezone", req.Timezone))
+
+	// Only allow users to update their own preferences
+	if !canModify(ctx, userID, req.Id) {
+		s.logger.Warn("Permission denied: user attempting to update another user's preferences",
+			zap.String("requester_id", userID),
+			zap.String("target_id", req.Id))
+		return nil, status.Error(codes.PermissionDenied, "cannot update other users")
+	}
+
+	// Update preferences
+	userData, err := s.service.UpdatePreferences(ctx, req.Id, req.Locale, req.Timezone)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to update user preferences", err, zap.String("user_id", req.Id))
+		return nil, apperrors.MapToStatus(err, "failed to update user preferences")
+	}
+
+	s.logger.Info("User preferences updated successfully",
+		zap.String("user_id", req.Id))
+
+	// Return response, private data only for the owner and admins
+	viewer := s.resolveViewer(ctx, userID)
+	return &user.UpdatePreferencesResponse{
+		User: toProtoUser(userData, viewer),
+	}, nil
+}
+
+// UpdatePresenceVisibility sets who sees whether a user is online
+func (s *UserServer) UpdatePresenceVisibility(ctx context.Context, req *user.UpdatePresenceVisibilityRequest) (*user.UpdatePresenceVisibilityResponse, error) {
+	// Authenticate request - can be bypassed in mock mode
+	userID, err := s.authenticateOrBypass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("UpdatePresenceVisibility request",
+		zap.String("user_id", req.Id),
+		zap.String("requester_user_id", userID),
+		zap.String("visibility", req.Visibility))
+
+	// Only allow users to update their own visibility
+	if !canModify(ctx, userID, req.Id) {
+		s.logger.Warn("Permission denied: user attempting to update another user's presence visibility",
+			zap.String("requester_id", userID),
+			zap.String("target_id", req.Id))
+		return nil, status.Error(codes.PermissionDenied, "cannot update other users")
+	}
+
+	// Update visibility
+	userData, err := s.service.UpdatePresenceVisibility(ctx, req.Id, req.Visibility)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to update presence visibility", err, zap.String("user_id", req.Id))
+		return nil, apperrors.MapToStatus(err, "failed to update presence visibility")
+	}
+
+	s.logger.Info("Presence visibility updated successfully",
+		zap.String("user_id", req.Id))
+
+	// Return response, private data only for the owner and admins
+	viewer := s.resolveViewer(ctx, userID)
+	return &user.UpdatePresenceVisibilityResponse{
+		User: toProtoUser(userData, viewer),
+	}, nil
+}
+
+// UpdateCustomFields sets a user's custom fields, only admins may change them
+func (s *UserServer) UpdateCustomFields(ctx context.Context, req *user.UpdateCustomFieldsRequest) (*user.UpdateCustomFieldsResponse, error) {
+	// Authenticate request - can be bypassed in mock mode
+	userID, err := s.authenticateOrBypass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("UpdateCustomFields request",
+		zap.String("user_id", req.Id),
+		zap.String("requester_user_id", userID))
+
+	// Custom fields are managed by admins
+	viewer := s.resolveViewer(ctx, userID)
+	if !viewer.admin {
+		s.logger.Warn("Permission denied: non-admin attempting to update custom fields",
+			zap.String("requester_id", userID),
+			zap.String("target_id", req.Id))
+		return nil, status.Error(codes.PermissionDenied, "only admins can update custom fields")
+	}
+
+	// Update custom fields
+	userData, err := s.service.UpdateCustomFields(ctx, req.Id, req.CustomFields.AsMap())
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to update custom fields", err, zap.String("user_id", req.Id))
+		return nil, apperrors.MapToStatus(err, "failed to update custom fields")
+	}
+
+	s.logger.Info("Custom fields updated successfully",
+		zap.String("user_id", req.Id))
+
+	return &user.UpdateCustomFieldsResponse{
+		User: toProtoUser(userData, viewer),
+	}, nil
+}
+
+// ListCustomFields returns the custom fields defined for this deployment
+func (s *UserServer) ListCustomFields(ctx context.Context, req *user.ListCustomFieldsRequest) (*user.ListCustomFieldsResponse, error) {
+	// Authenticate request - can be bypassed in mock mode
+	if _, err := s.authenticateOrBypass(ctx); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(s.cfg.User.CustomFields))
+	for name := range s.cfg.User.CustomFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := &user.ListCustomFieldsResponse{CustomFields: make([]*user.CustomField, len(names))}
+	for i, name := range names {
+		res.CustomFields[i] = &user.CustomField{Name: name, Type: s.cfg.User.CustomFields[name]}
+	}
+	return res, nil
+}
+
+// GetUserByUsername returns a user by username
+func (s *UserServer) GetUserByUsername(ctx context.Context, req *user.GetUserByUsernameRequest) (*user.GetUserByUsernameResponse, error) {
+	// Authenticate request - can be bypassed in mock mode
+	userID, err := s.authenticateOrBypass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("GetUserByUsername request",
+		zap.String("username", req.Username),
+		zap.String("requester_user_id", userID))
+
+	// Get user
+	userData, err := s.service.GetUserByUsername(ctx, req.Username)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to get user by username", err, zap.String("username", req.Username))
+		return nil, apperrors.MapToStatus(err, "failed to get user")
+	}
+
+	s.logger.Info("User retrieved successfully",
+		zap.String("user_id", userData.ID),
+		zap.String("username", req.Username))
+
+	// Return response, private data only for the owner and admins
+	viewer := s.resolveViewer(ctx, userID)
+	return &user.GetUserByUsernameResponse{
+		User: toProtoUser(userData, viewer),
+	}, nil
+}
+
+// UpdateUsername changes a user's username
+func (s *UserServer) UpdateUsername(ctx context.Context, req *user.UpdateUsernameRequest) (*user.UpdateUsernameResponse, error) {
+	// Authenticate request - can be bypassed in mock mode
+	userID, err := s.authenticateOrBypass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("UpdateUsername request",
+		zap.String("user_id", req.Id),
+		zap.String("requester_user_id", userID),
+		zap.String("username", req.Username))
+
+	// Only allow users to change their own username
+	if !canModify(ctx, userID, req.Id) {
+		s.logger.Warn("Permission denied: user attempting to change another user's username",
+			zap.String("requester_id", userID),
+			zap.String("target_id", req.Id))
+		return nil, status.Error(codes.PermissionDenied, "cannot update other users")
+	}
+
+	// Update username
+	userData, err := s.service.UpdateUsername(ctx, req.Id, req.Username)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to update username", err, zap.String("user_id", req.Id))
+		return nil, apperrors.MapToStatus(err, "failed to update username")
+	}
+
+	s.logger.Info("Username updated successfully",
+		zap.String("user_id", req.Id),
+		zap.String("username", userData.Username))
+
+	// Return response, private data only for the owner and admins
+	viewer := s.resolveViewer(ctx, userID)
+	return &user.UpdateUsernameResponse{
+		User: toProtoUser(userData, viewer),
 	}, nil
 }
 
@@ -171,29 +542,24 @@ func (s *UserServer) DeleteUser(ctx context.Context, req *user.DeleteUserRequest
 		zap.String("requester_user_id", userID))
 
 	// Only allow users to delete their own account
-	if userID != req.Id && userID != "mock-bypass" {
+	if !canModify(ctx, userID, req.Id) {
 		s.logger.Warn("Permission denied: user attempting to delete another user",
 			zap.String("requester_id", userID),
 			zap.String("target_id", req.Id))
+		s.emitUserChange(ctx, userID, req.Id, "user.delete", "cannot delete other users")
 		return nil, status.Error(codes.PermissionDenied, "cannot delete other users")
 	}
 
 	// Delete user
 	err = s.service.DeleteUser(ctx, req.Id)
 	if err != nil {
-		if err == service.ErrUserNotFound {
-			s.logger.Warn("User not found during deletion",
-				zap.String("user_id", req.Id))
-			return nil, status.Error(codes.NotFound, "user not found")
-		}
-		s.logger.Error("Failed to delete user",
-			zap.String("user_id", req.Id),
-			zap.Error(err))
-		return nil, status.Error(codes.Internal, "failed to delete user")
+		apperrors.Log(s.logger, "Failed to delete user", err, zap.String("user_id", req.Id))
+		return nil, apperrors.MapToStatus(err, "failed to delete user")
 	}
 
 	s.logger.Info("User deleted successfully",
 		zap.String("user_id", req.Id))
+	s.emitUserChange(ctx, userID, req.Id, "user.delete", "")
 
 	// Return response
 	return &user.DeleteUserResponse{
@@ -212,27 +578,49 @@ func (s *UserServer) ListUsers(ctx context.Context, req *user.ListUsersRequest)
 	s.logger.Debug("ListUsers request",
 		zap.String("requester_user_id", userID),
 		zap.Int32("page", req.Page),
-		zap.Int32("page_size", req.PageSize))
+		zap.Int32("page_size", req.PageSize),
+		zap.Strings("read_mask", req.ReadMask.GetPaths()),
+		zap.Strings("custom_fields", req.CustomFields),
+		zap.Time("created_after", req.CreatedAfter.AsTime()),
+		zap.String("status", req.Status.String()),
+		zap.Strings("tags", req.Tags),
+		zap.String("filter", req.Filter),
+		zap.String("order_by", req.OrderBy.String()))
+
+	// Validate read mask
+	if !fieldmask.Validate(req.ReadMask, &user.User{}) {
+		return nil, status.Error(codes.InvalidArgument, "invalid read_mask")
+	}
 
-	// List users
-	users, total, err := s.service.ListUsers(ctx, int(req.Page), int(req.PageSize))
+	// Custom fields, statuses and tags are private, filtering by them would reveal them
+	viewer := s.resolveViewer(ctx, userID)
+	filter, err := parseUserFilter(req)
 	if err != nil {
-		s.logger.Error("Failed to list users", zap.Error(err))
-		return nil, status.Error(codes.Internal, "failed to list users")
-	}
-
-	// Convert to proto users
-	protoUsers := make([]*user.User, len(users))
-	for i, userData := range users {
-		protoUsers[i] = &user.User{
-			Id:        userData.ID,
-			Email:     userData.Email,
-			Name:      userData.Name,
-			CreatedAt: userData.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			UpdatedAt: userData.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		return nil, err
+	}
+	if len(filter.CustomFields) > 0 && !viewer.admin {
+		return nil, status.Error(codes.PermissionDenied, "only admins can filter by custom fields")
+	}
+	if (filter.Status != "" || len(filter.Tags) > 0) && !viewer.admin {
+		return nil, status.Error(codes.PermissionDenied, "only admins can filter by status or tags")
+	}
+	for _, field := range listfilter.Fields(filter.Expression) {
+		if !publicFilterFields[field] && !viewer.admin {
+			return nil, status.Errorf(codes.PermissionDenied, "only admins can filter by %s", field)
 		}
 	}
 
+	// List users, loading only the columns the read mask needs
+	users, total, err := s.service.ListUsers(ctx, filter, int(req.Page), int(req.PageSize), readMaskColumns(req.ReadMask, maskColumns)...)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to list users", err)
+		return nil, apperrors.MapToStatus(err, "failed to list users")
+	}
+
+	// Convert to proto users, private data only for the owner and admins
+	protoUsers := toProtoUsers(users, viewer)
+	fieldmask.PruneAll(protoUsers, req.ReadMask)
+
 	s.logger.Info("Users listed successfully",
 		zap.Int("count", len(users)),
 		zap.Int("total", total))
@@ -244,6 +632,114 @@ func (s *UserServer) ListUsers(ctx context.Context, req *user.ListUsersRequest)
 	}, nil
 }
 
+// userStatuses maps the user statuses of requests to account statuses
+var userStatuses = map[user.UserStatus]string{
+	user.UserStatus_USER_STATUS_ACTIVE:    "active",
+	user.UserStatus_USER_STATUS_PENDING:   "pending",
+	user.UserStatus_USER_STATUS_SUSPENDED: "suspended",
+	user.UserStatus_USER_STATUS_REJECTED:  "rejected",
+}
+
+// userOrders maps the user orders of requests to service orders
+var userOrders = map[user.UserOrder]string{
+	user.UserOrder_USER_ORDER_CREATED_AT_DESC: service.OrderCreatedAtDesc,
+	user.UserOrder_USER_ORDER_CREATED_AT_ASC:  service.OrderCreatedAtAsc,
+	user.UserOrder_USER_ORDER_NAME_ASC:        service.OrderNameAsc,
+	user.UserOrder_USER_ORDER_NAME_DESC:       service.OrderNameDesc,
+}
+
+// publicFilterFields are the filter expression fields of the public profile,
+// any caller may filter by them
+var publicFilterFields = map[string]bool{"name": true, "username": true, "created_at": true}
+
+// parseUserFilter parses the filters of a request, e.g. "name:value" custom field filters.
+// Unknown enum numbers, which gRPC clients can send, are rejected.
+func parseUserFilter(req *user.ListUsersRequest) (service.UserFilter, error) {
+	filter := service.UserFilter{
+		CustomFields: make(map[string]string, len(req.CustomFields)),
+		Tags:         req.Tags,
+	}
+	for _, pair := range req.CustomFields {
+		name, value, ok := strings.Cut(pair, ":")
+		if !ok || name == "" {
+			return service.UserFilter{}, status.Errorf(codes.InvalidArgument, "invalid custom_fields filter %q, expected name:value", pair)
+		}
+		filter.CustomFields[name] = value
+	}
+
+	if req.CreatedAfter != nil {
+		if err := req.CreatedAfter.CheckValid(); err != nil {
+			return service.UserFilter{}, status.Error(codes.InvalidArgument, "invalid created_after")
+		}
+		filter.CreatedAfter = req.CreatedAfter.AsTime()
+	}
+
+	if req.Status != user.UserStatus_USER_STATUS_UNSPECIFIED {
+		var ok bool
+		if filter.Status, ok = userStatuses[req.Status]; !ok {
+			return service.UserFilter{}, status.Errorf(codes.InvalidArgument, "invalid status %d", req.Status)
+		}
+	}
+
+	expression, err := listfilter.Parse(req.Filter, service.UserFilterFields)
+	if err != nil {
+		return service.UserFilter{}, apperrors.MapToStatus(err, "invalid filter")
+	}
+	filter.Expression = expression
+
+	if req.OrderBy != user.UserOrder_USER_ORDER_UNSPECIFIED {
+		var ok bool
+		if filter.OrderBy, ok = userOrders[req.OrderBy]; !ok {
+			return service.UserFilter{}, status.Errorf(codes.InvalidArgument, "invalid order_by %d", req.OrderBy)
+		}
+	}
+
+	return filter, nil
+}
+
+// CheckEmailAvailability reports whether an email address can still be used.
+// It doesn't require authentication so signup forms can call it. The auth
+// service, which owns the accounts, answers it and rate limits it by the
+// client's IP like logins.
+func (s *UserServer) CheckEmailAvailability(ctx context.Context, req *user.CheckEmailAvailabilityRequest) (*user.CheckEmailAvailabilityResponse, error) {
+	s.logger.Debug("CheckEmailAvailability request")
+
+	if s.authClient == nil {
+		return nil, status.Error(codes.Unavailable, "email availability requires the auth service")
+	}
+	clientIP := middleware.ClientIP(ctx, s.cfg.LoginRateLimit.TrustedProxies)
+	available, err := s.authClient.CheckEmailAvailability(ctx, req.Email, clientIP)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		s.logger.Error("Failed to check email availability", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to check email availability")
+	}
+
+	return &user.CheckEmailAvailabilityResponse{
+		Available: available,
+	}, nil
+}
+
+// GetPublicStats returns rounded, noisy usage statistics. It doesn't require
+// authentication so marketing pages can call it.
+func (s *UserServer) GetPublicStats(ctx context.Context, req *user.GetPublicStatsRequest) (*user.GetPublicStatsResponse, error) {
+	s.logger.Debug("GetPublicStats request")
+
+	stats, err := s.service.GetPublicStats(ctx)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to get public stats", err)
+		return nil, apperrors.MapToStatus(err, "failed to get public stats")
+	}
+
+	return &user.GetPublicStatsResponse{
+		TotalUsers:    int64(stats.TotalUsers),
+		WeeklySignups: int64(stats.WeeklySignups),
+		ComputedAt:    stats.ComputedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}, nil
+}
+
 // authenticateOrBypass authenticates the request and returns the user ID
 // If USE_MOCK_SERVICES is true and BYPASS_AUTH is true, it will bypass authentication
 func (s *UserServer) authenticateOrBypass(ctx context.Context) (string, error) {
@@ -253,7 +749,58 @@ func (s *UserServer) authenticateOrBypass(ctx context.Context) (string, error) {
 		return "mock-bypass", nil
 	}
 
-	return s.authenticate(ctx)
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	s.resolveUserTimezone(ctx, userID)
+	s.recordPresence(ctx, userID)
+
+	return userID, nil
+}
+
+// recordPresence updates the caller's last seen time, at most once per
+// PRESENCE_UPDATE_INTERVAL. Failures don't fail the request.
+func (s *UserServer) recordPresence(ctx context.Context, userID string) {
+	if s.presence == nil || s.readOnly.Enabled() {
+		return
+	}
+
+	allowed, err := s.presence.Allow(ctx, userID)
+	if err != nil {
+		s.logger.Debug("Failed to check presence throttle",
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return
+	}
+	if !allowed {
+		return
+	}
+
+	if err := s.service.TouchLastSeen(ctx, userID); err != nil {
+		s.logger.Debug("Failed to update last seen time",
+			zap.String("user_id", userID),
+			zap.Error(err))
+	}
+}
+
+// resolveUserTimezone sends the caller's stored timezone to the gateway
+// when a REST client asked for timestamps in "their" timezone
+func (s *UserServer) resolveUserTimezone(ctx context.Context, userID string) {
+	if middleware.RequestedTimezone(ctx) != middleware.TimezoneUser {
+		return
+	}
+
+	caller, err := s.service.GetUser(ctx, userID)
+	if err != nil || caller.Timezone == "" {
+		// Without a stored preference timestamps stay in UTC
+		return
+	}
+
+	if err := grpc.SetHeader(ctx, metadata.Pairs(middleware.TimezoneMetadataKey, caller.Timezone)); err != nil {
+		s.logger.Debug("Failed to set timezone header", zap.Error(err))
+	}
 }
 
 // authenticate authenticates the request and returns the user ID
@@ -284,7 +831,20 @@ func (s *UserServer) authenticate(ctx context.Context) (string, error) {
 	var err error
 
 	if s.authClient != nil {
+		// Tokens validated recently by the auth service are trusted without asking
+		// again, in the tenant they were validated in
+		sum := sha256.Sum256([]byte(database.TenantOrDefault(ctx) + " " + token))
+		key := hex.EncodeToString(sum[:])
+		if cached, ok := s.tokens.Get(key); ok {
+			if s.stillValid(ctx, cached) {
+				return cached.userID, nil
+			}
+			s.tokens.Delete(key)
+		}
 		valid, userID, err = s.authClient.ValidateToken(ctx, token)
+		if err == nil && valid {
+			s.cacheToken(key, token, userID)
+		}
 	} else {
 		// Use local JWT validator when auth client is not available
 		valid, userID, err = s.jwtValidator.ValidateToken(ctx, token)
@@ -302,3 +862,41 @@ func (s *UserServer) authenticate(ctx context.Context) (string, error) {
 
 	return userID, nil
 }
+
+// cachedToken is a token the auth service validated
+type cachedToken struct {
+	userID string
+	// tokenID identifies the token in the revocation store
+	tokenID string
+}
+
+// cacheToken caches a token the auth service validated until it expires, at
+// most for the cache's TTL. Tokens that can't be checked locally aren't cached.
+func (s *UserServer) cacheToken(key, token, userID string) {
+	tokenID, expiresAt, ok := s.jwtValidator.TokenExpiry(token)
+	if !ok {
+		return
+	}
+	s.tokens.SetWithTTL(key, cachedToken{userID: userID, tokenID: tokenID}, time.Until(expiresAt))
+}
+
+// stillValid reports whether a cached token wasn't revoked since it was
+// validated, nor its user's sessions ended. Errors of the revocation store
+// count as revoked, so the auth service is asked instead.
+func (s *UserServer) stillValid(ctx context.Context, cached cachedToken) bool {
+	store := s.jwtValidator.Revocations
+	if store == nil {
+		return false
+	}
+	for _, id := range []string{cached.tokenID, revocation.SessionsID(cached.userID)} {
+		revoked, err := store.IsRevoked(ctx, id)
+		if err != nil {
+			s.logger.Debug("Failed to check revocation of cached token", zap.Error(err))
+			return false
+		}
+		if revoked {
+			return false
+		}
+	}
+	return true
+}
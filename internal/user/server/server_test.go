@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/linkeunid/hello-go/api/gen/user"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/revocation"
+)
+
+// cfg is loaded once, before benchmarks print their results
+var cfg *config.Config
+
+func TestMain(m *testing.M) {
+	var err error
+	if cfg, err = config.LoadConfig(); err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// newBenchmarkServer creates a server backed by the in-memory mock services,
+// so no database is needed. Logging is disabled, it would dominate the numbers.
+func newBenchmarkServer(b *testing.B, bypassAuth bool) *UserServer {
+	b.Setenv("USE_MOCK_SERVICES", "true")
+	if bypassAuth {
+		b.Setenv("BYPASS_AUTH", "true")
+	} else {
+		b.Setenv("BYPASS_AUTH", "false")
+	}
+	return NewUserServer(cfg, zap.NewNop())
+}
+
+// BenchmarkGetUser measures an authenticated GetUser with the caller's token
+// in the token cache, including the role lookup and response mapping
+func BenchmarkGetUser(b *testing.B) {
+	srv := newBenchmarkServer(b, false)
+	userID := "00000000-0000-0000-0000-000000000002"
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": userID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(cfg.Auth.JWTSecret.Reveal()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	req := &user.GetUserRequest{Id: userID}
+
+	// The first call validates the token with the auth service and caches it
+	if _, err := srv.GetUser(ctx, req); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := srv.GetUser(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCachedTokenRevocation(t *testing.T) {
+	t.Setenv("USE_MOCK_SERVICES", "true")
+	t.Setenv("BYPASS_AUTH", "false")
+	srv := NewUserServer(cfg, zap.NewNop())
+	userID := "00000000-0000-0000-0000-000000000002"
+	ctx := context.Background()
+
+	for _, revoke := range []string{"token", "sessions"} {
+		t.Run(revoke, func(t *testing.T) {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"sub": userID,
+				"jti": revoke,
+				"exp": time.Now().Add(time.Hour).Unix(),
+			}).SignedString([]byte(cfg.Auth.JWTSecret.Reveal()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv.cacheToken(revoke, token, userID)
+			cached, ok := srv.tokens.Get(revoke)
+			if !ok {
+				t.Fatal("token wasn't cached")
+			}
+			if !srv.stillValid(ctx, cached) {
+				t.Fatal("cached token is invalid before being revoked")
+			}
+
+			id := cached.tokenID
+			if revoke == "sessions" {
+				id = revocation.SessionsID(userID)
+			}
+			if err := srv.jwtValidator.Revocations.Revoke(ctx, id, time.Now().Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if srv.stillValid(ctx, cached) {
+				t.Error("cached token is still valid after being revoked")
+			}
+		})
+	}
+}
+
+func TestCachedTokenExpired(t *testing.T) {
+	t.Setenv("USE_MOCK_SERVICES", "true")
+	t.Setenv("BYPASS_AUTH", "false")
+	srv := NewUserServer(cfg, zap.NewNop())
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "00000000-0000-0000-0000-000000000002",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	}).SignedString([]byte(cfg.Auth.JWTSecret.Reveal()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.cacheToken("expired", token, "00000000-0000-0000-0000-000000000002")
+	if _, ok := srv.tokens.Get("expired"); ok {
+		t.Error("expired token was cached")
+	}
+}
+
+// BenchmarkListUsers measures walking every page of ListUsers
+func BenchmarkListUsers(b *testing.B) {
+	srv := newBenchmarkServer(b, true)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for page := int32(1); ; page++ {
+			res, err := srv.ListUsers(ctx, &user.ListUsersRequest{Page: page, PageSize: 5})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if page*5 >= res.Total {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"github.com/linkeunid/hello-go/api/gen/user"
+	"github.com/linkeunid/hello-go/api/gen/userv2"
+	"github.com/linkeunid/hello-go/pkg/middleware"
+)
+
+// StepUpMethods lists the sensitive methods that need a recent login, see
+// middleware.StepUpInterceptor
+var StepUpMethods = map[string]middleware.StepUpRule{
+	user.UserService_DeleteUser_FullMethodName:   nil,
+	user.UserService_UpdateUser_FullMethodName:   changesEmail,
+	userv2.UserService_DeleteUser_FullMethodName: nil,
+	userv2.UserService_UpdateUser_FullMethodName: changesEmailV2,
+}
+
+// changesEmail reports whether an update may change the email, which updates
+// without a mask do as well
+func changesEmail(req interface{}) bool {
+	update, ok := req.(*user.UpdateUserRequest)
+	if !ok {
+		return false
+	}
+
+	paths := update.UpdateMask.GetPaths()
+	if len(paths) == 0 {
+		return true
+	}
+	for _, path := range paths {
+		if path == "email" {
+			return true
+		}
+	}
+	return false
+}
+
+// changesEmailV2 reports whether a v2 update may change the email, which
+// updates without a mask do if they set it
+func changesEmailV2(req interface{}) bool {
+	update, ok := req.(*userv2.UpdateUserRequest)
+	if !ok {
+		return false
+	}
+
+	paths := update.UpdateMask.GetPaths()
+	if len(paths) == 0 {
+		return update.User.GetEmail() != ""
+	}
+	for _, path := range paths {
+		if path == "email" || path == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,419 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/linkeunid/hello-go/api/gen/userv2"
+	"github.com/linkeunid/hello-go/internal/user/service"
+	"github.com/linkeunid/hello-go/pkg/database"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/fieldmask"
+	"github.com/linkeunid/hello-go/pkg/listfilter"
+)
+
+// userCollection is the collection of user resource names, "users/{user}"
+const userCollection = "users/"
+
+// maxPageSizeV2 is the largest page of ListUsers, larger page sizes are coerced to it
+const maxPageSizeV2 = 100
+
+// UserServerV2 implements the v2 UserService, the resource-oriented API
+// following the AIPs. It shares the v1 server's service, authentication and
+// security events, so both versions behave the same for the same user.
+type UserServerV2 struct {
+	userv2.UnimplementedUserServiceServer
+	s *UserServer
+}
+
+// V2 returns the v2 UserService of the server
+func (s *UserServer) V2() *UserServerV2 {
+	return &UserServerV2{s: s}
+}
+
+// userFilterFieldsV2 are the fields of v2 filter expressions, named like the fields of User
+var userFilterFieldsV2 = listfilter.Schema{
+	"display_name": {Column: "name", Type: listfilter.String},
+	"username":     {Column: "username", Type: listfilter.String},
+	"email":        {Column: "email", Type: listfilter.String},
+	"create_time":  {Column: "created_at", Type: listfilter.Timestamp},
+	"update_time":  {Column: "updated_at", Type: listfilter.Timestamp},
+}
+
+// publicFilterFieldsV2 are the v2 filter fields any caller may filter by
+var publicFilterFieldsV2 = map[string]bool{"display_name": true, "username": true, "create_time": true}
+
+// userOrdersV2 maps the order_by values of ListUsers to service orders
+var userOrdersV2 = map[string]string{
+	"create_time":       service.OrderCreatedAtAsc,
+	"create_time desc":  service.OrderCreatedAtDesc,
+	"display_name":      service.OrderNameAsc,
+	"display_name desc": service.OrderNameDesc,
+}
+
+// maskColumnsV2 maps read mask paths of the v2 User to the database columns they need
+var maskColumnsV2 = map[string][]string{
+	"name":         {},
+	"display_name": {"name"},
+	"username":     {"username"},
+	"email":        {"email"},
+	"locale":       {"locale"},
+	"time_zone":    {"timezone"},
+	"create_time":  {"created_at"},
+	"update_time":  {"updated_at"},
+	"etag":         {"updated_at"},
+}
+
+// outputOnlyPathsV2 are the User fields clients can't set. Update masks may
+// include them, e.g. when a client sends back the whole user, they're ignored.
+var outputOnlyPathsV2 = map[string]bool{"name": true, "username": true, "create_time": true, "update_time": true, "etag": true}
+
+// GetUser returns a user by resource name
+func (v *UserServerV2) GetUser(ctx context.Context, req *userv2.GetUserRequest) (*userv2.User, error) {
+	s := v.s
+	userID, err := s.authenticateOrBypass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := parseUserName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !fieldmask.Validate(req.ReadMask, &userv2.User{}) {
+		return nil, status.Error(codes.InvalidArgument, "invalid read_mask")
+	}
+
+	userData, err := s.service.GetUser(ctx, id, readMaskColumns(req.ReadMask, maskColumnsV2)...)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to get user", err, zap.String("user_id", id))
+		return nil, apperrors.MapToStatus(err, "failed to get user")
+	}
+
+	protoUser := toProtoUserV2(userData, s.resolveViewer(ctx, userID))
+	fieldmask.Prune(protoUser, req.ReadMask)
+	return protoUser, nil
+}
+
+// ListUsers returns a page of users
+func (v *UserServerV2) ListUsers(ctx context.Context, req *userv2.ListUsersRequest) (*userv2.ListUsersResponse, error) {
+	s := v.s
+	userID, err := s.authenticateOrBypass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("ListUsers v2 request",
+		zap.String("requester_user_id", userID),
+		zap.Int32("page_size", req.PageSize),
+		zap.String("filter", req.Filter),
+		zap.String("order_by", req.OrderBy))
+
+	if !fieldmask.Validate(req.ReadMask, &userv2.User{}) {
+		return nil, status.Error(codes.InvalidArgument, "invalid read_mask")
+	}
+	if req.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+	pageSize := int(req.PageSize)
+	if pageSize == 0 {
+		pageSize = 10
+	}
+	if pageSize > maxPageSizeV2 {
+		pageSize = maxPageSizeV2
+	}
+
+	// Page tokens are only valid for the query they were issued for
+	query := pageQuery(req, pageSize)
+	page := 1
+	if req.PageToken != "" {
+		if page, err = decodePageToken(req.PageToken, query); err != nil {
+			return nil, err
+		}
+	}
+
+	viewer := s.resolveViewer(ctx, userID)
+	filter, err := parseUserFilterV2(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range listfilter.Fields(filter.Expression) {
+		if !publicFilterFieldsV2[field] && !viewer.admin {
+			return nil, status.Errorf(codes.PermissionDenied, "only admins can filter by %s", field)
+		}
+	}
+
+	users, total, err := s.service.ListUsers(ctx, filter, page, pageSize, readMaskColumns(req.ReadMask, maskColumnsV2)...)
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to list users", err)
+		return nil, apperrors.MapToStatus(err, "failed to list users")
+	}
+
+	res := &userv2.ListUsersResponse{
+		Users:     make([]*userv2.User, len(users)),
+		TotalSize: int32(total),
+	}
+	for i, userData := range users {
+		res.Users[i] = toProtoUserV2(userData, viewer)
+		fieldmask.Prune(res.Users[i], req.ReadMask)
+	}
+	if page*pageSize < total {
+		res.NextPageToken = encodePageToken(page+1, query)
+	}
+	return res, nil
+}
+
+// UpdateUser updates the fields of the update mask of a user
+func (v *UserServerV2) UpdateUser(ctx context.Context, req *userv2.UpdateUserRequest) (*userv2.User, error) {
+	s := v.s
+	userID, err := s.authenticateOrBypass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.User == nil {
+		return nil, status.Error(codes.InvalidArgument, "user is required")
+	}
+	id, err := parseUserName(req.User.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("UpdateUser v2 request",
+		zap.String("user_id", id),
+		zap.String("requester_user_id", userID),
+		zap.Strings("update_mask", req.UpdateMask.GetPaths()))
+
+	if !canModify(ctx, userID, id) {
+		s.logger.Warn("Permission denied: user attempting to update another user",
+			zap.String("requester_id", userID),
+			zap.String("target_id", id))
+		s.emitUserChange(ctx, userID, id, "user.update", "cannot update other users")
+		return nil, status.Error(codes.PermissionDenied, "cannot update other users")
+	}
+
+	paths, err := updatePathsV2(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fields outside the mask keep their current values, read from the primary
+	// like the etag they're checked against
+	userData, err := s.service.GetUser(database.WithPrimary(ctx), id)
+	if err == nil {
+		err = service.CheckETag(userData, req.User.Etag)
+	}
+	if err != nil {
+		apperrors.Log(s.logger, "Failed to update user", err, zap.String("user_id", id))
+		return nil, apperrors.MapToStatus(err, "failed to update user")
+	}
+
+	if paths["display_name"] || paths["email"] {
+		name, email := userData.Name, userData.Email
+		if paths["display_name"] {
+			name = req.User.DisplayName
+		}
+		if paths["email"] {
+			email = req.User.Email
+		}
+		if userData, err = s.service.UpdateUser(ctx, id, name, email); err != nil {
+			apperrors.Log(s.logger, "Failed to update user", err, zap.String("user_id", id))
+			return nil, apperrors.MapToStatus(err, "failed to update user")
+		}
+	}
+	if paths["locale"] || paths["time_zone"] {
+		locale, timezone := userData.Locale, userData.Timezone
+		if paths["locale"] {
+			locale = req.User.Locale
+		}
+		if paths["time_zone"] {
+			timezone = req.User.TimeZone
+		}
+		if userData, err = s.service.UpdatePreferences(ctx, id, locale, timezone); err != nil {
+			apperrors.Log(s.logger, "Failed to update user preferences", err, zap.String("user_id", id))
+			return nil, apperrors.MapToStatus(err, "failed to update user")
+		}
+	}
+
+	s.logger.Info("User updated successfully", zap.String("user_id", id))
+	s.emitUserChange(ctx, userID, id, "user.update", "")
+
+	return toProtoUserV2(userData, s.resolveViewer(ctx, userID)), nil
+}
+
+// DeleteUser deletes a user, only if it's unchanged when an etag is given
+func (v *UserServerV2) DeleteUser(ctx context.Context, req *userv2.DeleteUserRequest) (*emptypb.Empty, error) {
+	s := v.s
+	userID, err := s.authenticateOrBypass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := parseUserName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("DeleteUser v2 request",
+		zap.String("user_id", id),
+		zap.String("requester_user_id", userID))
+
+	if !canModify(ctx, userID, id) {
+		s.logger.Warn("Permission denied: user attempting to delete another user",
+			zap.String("requester_id", userID),
+			zap.String("target_id", id))
+		s.emitUserChange(ctx, userID, id, "user.delete", "cannot delete other users")
+		return nil, status.Error(codes.PermissionDenied, "cannot delete other users")
+	}
+
+	if req.Etag != "" {
+		current, err := s.service.GetUser(database.WithPrimary(ctx), id, "updated_at")
+		if err == nil {
+			err = service.CheckETag(current, req.Etag)
+		}
+		if err != nil {
+			apperrors.Log(s.logger, "Failed to delete user", err, zap.String("user_id", id))
+			return nil, apperrors.MapToStatus(err, "failed to delete user")
+		}
+	}
+
+	if err := s.service.DeleteUser(ctx, id); err != nil {
+		apperrors.Log(s.logger, "Failed to delete user", err, zap.String("user_id", id))
+		return nil, apperrors.MapToStatus(err, "failed to delete user")
+	}
+
+	s.logger.Info("User deleted successfully", zap.String("user_id", id))
+	s.emitUserChange(ctx, userID, id, "user.delete", "")
+
+	return &emptypb.Empty{}, nil
+}
+
+// parseUserName returns the ID of a user resource name, "users/{user}"
+func parseUserName(name string) (string, error) {
+	id, ok := strings.CutPrefix(name, userCollection)
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", status.Errorf(codes.InvalidArgument, "invalid name %q, expected users/{user}", name)
+	}
+	return id, nil
+}
+
+// toProtoUserV2 converts a service user to the v2 API. Like toProtoUser,
+// private fields are only set if the viewer may see them.
+func toProtoUserV2(userData *service.User, v viewer) *userv2.User {
+	protoUser := &userv2.User{
+		Name:        userCollection + userData.ID,
+		DisplayName: userData.Name,
+		Username:    userData.Username,
+		CreateTime:  timestamppb.New(userData.CreatedAt),
+	}
+
+	if v.canSeePrivate(userData.ID) {
+		protoUser.Email = userData.Email
+		protoUser.Locale = userData.Locale
+		protoUser.TimeZone = userData.Timezone
+		protoUser.UpdateTime = timestamppb.New(userData.UpdatedAt)
+		protoUser.Etag = service.ETag(userData)
+	}
+
+	return protoUser
+}
+
+// updatePathsV2 returns the fields an update writes. An empty mask writes the
+// fields set in the request's user, "*" writes every field (AIP-134).
+func updatePathsV2(req *userv2.UpdateUserRequest) (map[string]bool, error) {
+	paths := make(map[string]bool)
+
+	mask := req.UpdateMask.GetPaths()
+	if len(mask) == 0 {
+		paths["display_name"] = req.User.DisplayName != ""
+		paths["email"] = req.User.Email != ""
+		paths["locale"] = req.User.Locale != ""
+		paths["time_zone"] = req.User.TimeZone != ""
+		return paths, nil
+	}
+
+	for _, path := range mask {
+		switch {
+		case path == "*":
+			for _, field := range []string{"display_name", "email", "locale", "time_zone"} {
+				paths[field] = true
+			}
+		case path == "display_name" || path == "email" || path == "locale" || path == "time_zone":
+			paths[path] = true
+		case outputOnlyPathsV2[path]:
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "invalid update_mask path %q", path)
+		}
+	}
+	return paths, nil
+}
+
+// parseUserFilterV2 parses the filter and order of a v2 list request
+func parseUserFilterV2(req *userv2.ListUsersRequest) (service.UserFilter, error) {
+	var filter service.UserFilter
+
+	expression, err := listfilter.Parse(req.Filter, userFilterFieldsV2)
+	if err != nil {
+		return service.UserFilter{}, apperrors.MapToStatus(err, "invalid filter")
+	}
+	filter.Expression = expression
+
+	if orderBy := strings.Join(strings.Fields(req.OrderBy), " "); orderBy != "" {
+		var ok bool
+		if filter.OrderBy, ok = userOrdersV2[orderBy]; !ok {
+			return service.UserFilter{}, status.Errorf(codes.InvalidArgument,
+				"invalid order_by %q, expected create_time or display_name, optionally followed by desc", req.OrderBy)
+		}
+	}
+
+	return filter, nil
+}
+
+// pageToken is the decoded next_page_token of ListUsers
+type pageToken struct {
+	// Page is the number of the next page, starting at 1
+	Page int `json:"p"`
+	// Query is the hash of the request parameters the token was issued for
+	Query string `json:"q"`
+}
+
+// pageQuery returns the hash of the parameters that select a list request's users
+func pageQuery(req *userv2.ListUsersRequest, pageSize int) string {
+	params := []string{req.Filter, req.OrderBy, strings.Join(req.ReadMask.GetPaths(), ","), strconv.Itoa(pageSize)}
+	sum := sha256.Sum256([]byte(strings.Join(params, "\x00")))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// encodePageToken returns the page token of a page of a query. Tokens are
+// opaque to clients, they aren't secret.
+func encodePageToken(page int, query string) string {
+	// Marshaling a struct of an int and a string can't fail
+	data, _ := json.Marshal(pageToken{Page: page, Query: query})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodePageToken returns the page of a page token issued for the query
+func decodePageToken(token, query string) (int, error) {
+	var decoded pageToken
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(data, &decoded)
+	}
+	if err != nil || decoded.Page < 2 {
+		return 0, status.Error(codes.InvalidArgument, "invalid page_token")
+	}
+	if decoded.Query != query {
+		return 0, status.Error(codes.InvalidArgument, "page_token doesn't match the request, other parameters must not change between pages")
+	}
+	return decoded.Page, nil
+}
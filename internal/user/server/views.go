@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/linkeunid/hello-go/api/gen/user"
+	"github.com/linkeunid/hello-go/internal/user/service"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/middleware"
+	"github.com/linkeunid/hello-go/pkg/presence"
+	"github.com/linkeunid/hello-go/pkg/siem"
+)
+
+// viewer is the authenticated caller a user is rendered for
+type viewer struct {
+	id    string
+	admin bool
+	// presence is the presence configuration, users are only shown online if enabled
+	presence config.PresenceConfig
+}
+
+// canSeePrivate reports whether the viewer may see a user's private account data
+func (v viewer) canSeePrivate(ownerID string) bool {
+	return v.admin || v.id == ownerID
+}
+
+// canSeePresence reports whether the viewer may see whether a user is online
+func (v viewer) canSeePresence(userData *service.User) bool {
+	if !v.presence.Enabled {
+		return false
+	}
+	visibility := userData.PresenceVisibility
+	if visibility == "" {
+		visibility = v.presence.DefaultVisibility
+	}
+	return visibility == config.PresenceEveryone || v.canSeePrivate(userData.ID)
+}
+
+// resolveViewer looks up the caller's role. Lookup failures fall back to
+// the caller only seeing their own private data.
+func (s *UserServer) resolveViewer(ctx context.Context, userID string) viewer {
+	v := s.resolveRole(ctx, userID)
+	v.presence = s.cfg.Presence
+	return v
+}
+
+// requireAdmin authenticates the request and checks that the caller is an admin
+func (s *UserServer) requireAdmin(ctx context.Context) error {
+	userID, err := s.authenticateOrBypass(ctx)
+	if err != nil {
+		return err
+	}
+	if !s.resolveRole(ctx, userID).admin {
+		s.logger.Warn("Permission denied: admin role required", zap.String("user_id", userID))
+		method, _ := grpc.Method(ctx)
+		s.security.Emit(ctx, siem.Event{
+			Category: siem.CategoryAuthorization,
+			Action:   "admin_access",
+			Outcome:  siem.OutcomeFailure,
+			Severity: siem.SeverityMedium,
+			Reason:   "admin role required",
+			Actor:    siem.Actor{Type: siem.ActorUser, ID: userID},
+			Details:  map[string]string{"method": method},
+		})
+		return status.Error(codes.PermissionDenied, "admin role required")
+	}
+	return nil
+}
+
+// resolveRole returns the viewer with the caller's role
+func (s *UserServer) resolveRole(ctx context.Context, userID string) viewer {
+	// Bypassed authentication has no real caller, treat it as an admin for development
+	if userID == "mock-bypass" {
+		return viewer{id: userID, admin: true}
+	}
+
+	// Scoped tokens only see private data with the users.admin scope. Service accounts
+	// aren't users, so their role can't be looked up.
+	if scopes, restricted := middleware.ScopesFromContext(ctx); restricted {
+		if !middleware.GrantsScope(scopes, middleware.ScopeUsersAdmin) {
+			return viewer{id: userID}
+		}
+		return viewer{id: userID, admin: true}
+	}
+
+	// The role is looked up on every call, like the auth service's admin check,
+	// so a demoted admin stops seeing private data right away
+	caller, err := s.service.GetUser(ctx, userID)
+	if err != nil {
+		s.logger.Debug("Failed to look up caller role",
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return viewer{id: userID}
+	}
+
+	return viewer{id: userID, admin: caller.Role == service.RoleAdmin}
+}
+
+// toProtoUser converts a service user to its API representation.
+// Private account data is only included if the viewer may see it.
+func toProtoUser(userData *service.User, v viewer) *user.User {
+	protoUser := &user.User{Profile: &user.PublicProfile{}}
+	fillProfile(protoUser.Profile, userData, v)
+
+	if v.canSeePrivate(userData.ID) {
+		protoUser.Account = &user.PrivateAccount{}
+		fillAccount(protoUser.Account, userData)
+	}
+
+	return protoUser
+}
+
+// toProtoUsers converts a page of service users to their API representation.
+//
+// The messages of the page are allocated in a few contiguous batches instead of
+// three allocations per user, which dominated the allocations of ListUsers.
+func toProtoUsers(users []*service.User, v viewer) []*user.User {
+	protoUsers := make([]*user.User, len(users))
+	messages := make([]user.User, len(users))
+	profiles := make([]user.PublicProfile, len(users))
+
+	// Only allocate account messages for the users the viewer may see
+	private := 0
+	for _, userData := range users {
+		if v.canSeePrivate(userData.ID) {
+			private++
+		}
+	}
+	accounts := make([]user.PrivateAccount, private)
+
+	for i, userData := range users {
+		protoUser := &messages[i]
+		protoUser.Profile = &profiles[i]
+		fillProfile(protoUser.Profile, userData, v)
+
+		if v.canSeePrivate(userData.ID) {
+			protoUser.Account = &accounts[0]
+			accounts = accounts[1:]
+			fillAccount(protoUser.Account, userData)
+		}
+
+		protoUsers[i] = protoUser
+	}
+
+	return protoUsers
+}
+
+// fillProfile copies the public fields of a user. Together with fillAccount
+// this is the only place that maps service users to the API.
+func fillProfile(profile *user.PublicProfile, userData *service.User, v viewer) {
+	profile.Id = userData.ID
+	profile.Name = userData.Name
+	profile.Username = userData.Username
+	profile.CreatedAt = userData.CreatedAt.UTC().Format("2006-01-02T15:04:05Z")
+
+	if v.canSeePresence(userData) {
+		profile.Presence = presence.Status(userData.LastSeenAt, v.presence.OnlineWindow)
+		if !userData.LastSeenAt.IsZero() {
+			profile.LastSeenAt = userData.LastSeenAt.UTC().Format("2006-01-02T15:04:05Z")
+		}
+	}
+}
+
+// fillAccount copies the private fields of a user
+func fillAccount(account *user.PrivateAccount, userData *service.User) {
+	account.Email = userData.Email
+	account.Locale = userData.Locale
+	account.Timezone = userData.Timezone
+	account.UpdatedAt = userData.UpdatedAt.UTC().Format("2006-01-02T15:04:05Z")
+	account.PresenceVisibility = userData.PresenceVisibility
+	if len(userData.CustomFields) > 0 {
+		// Values are decoded from JSON, so they always convert
+		account.CustomFields, _ = structpb.NewStruct(userData.CustomFields)
+	}
+}
+
+// maskColumns maps read mask paths of User to the database columns they need
+var maskColumns = map[string][]string{
+	"profile":                     {"name", "username", "created_at", "last_seen_at", "presence_visibility"},
+	"profile.id":                  {},
+	"profile.name":                {"name"},
+	"profile.username":            {"username"},
+	"profile.created_at":          {"created_at"},
+	"profile.presence":            {"last_seen_at", "presence_visibility"},
+	"profile.last_seen_at":        {"last_seen_at", "presence_visibility"},
+	"account":                     {"email", "locale", "timezone", "updated_at", "presence_visibility", "custom_fields"},
+	"account.email":               {"email"},
+	"account.locale":              {"locale"},
+	"account.timezone":            {"timezone"},
+	"account.updated_at":          {"updated_at"},
+	"account.presence_visibility": {"presence_visibility"},
+	"account.custom_fields":       {"custom_fields"},
+}
+
+// readMaskColumns returns the columns to load for a read mask, with
+// pathColumns mapping its paths to columns. An empty mask loads every column.
+func readMaskColumns(mask *fieldmaskpb.FieldMask, pathColumns map[string][]string) []string {
+	var columns []string
+	seen := make(map[string]bool)
+	for _, path := range mask.GetPaths() {
+		for _, column := range pathColumns[path] {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+
+	// Only the primary key was requested, which is always loaded
+	if len(mask.GetPaths()) > 0 && len(columns) == 0 {
+		columns = append(columns, "id")
+	}
+
+	return columns
+}
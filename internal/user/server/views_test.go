@@ -0,0 +1,154 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/linkeunid/hello-go/api/gen/user"
+	"github.com/linkeunid/hello-go/internal/user/service"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/presence"
+)
+
+func TestToProtoUser(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	seen := time.Now().Add(-time.Minute).Truncate(time.Second)
+	presenceCfg := config.PresenceConfig{
+		Enabled:           true,
+		OnlineWindow:      5 * time.Minute,
+		DefaultVisibility: config.PresenceEveryone,
+	}
+
+	full := &service.User{
+		ID:                 "user-1",
+		TenantID:           "acme",
+		Email:              "jdoe@example.com",
+		Name:               "Jane Doe",
+		Username:           "jdoe",
+		Role:               "user",
+		Locale:             "de-DE",
+		Timezone:           "Europe/Berlin",
+		LastSeenAt:         seen,
+		PresenceVisibility: config.PresenceEveryone,
+		CustomFields:       map[string]interface{}{"team": "core"},
+		CreatedAt:          created,
+		UpdatedAt:          created.Add(time.Hour),
+	}
+	minimal := &service.User{
+		ID:        "user-2",
+		Email:     "new@example.com",
+		Name:      "New User",
+		CreatedAt: created,
+		UpdatedAt: created,
+	}
+	hidden := &service.User{
+		ID:                 "user-3",
+		Email:              "hidden@example.com",
+		LastSeenAt:         seen,
+		PresenceVisibility: config.PresenceNobody,
+		CreatedAt:          created,
+		UpdatedAt:          created,
+	}
+
+	customFields, err := structpb.NewStruct(map[string]interface{}{"team": "core"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fullProfile := &user.PublicProfile{
+		Id:         "user-1",
+		Name:       "Jane Doe",
+		Username:   "jdoe",
+		CreatedAt:  "2024-01-02T03:04:05Z",
+		Presence:   presence.StatusOnline,
+		LastSeenAt: seen.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	fullAccount := &user.PrivateAccount{
+		Email:              "jdoe@example.com",
+		Locale:             "de-DE",
+		Timezone:           "Europe/Berlin",
+		UpdatedAt:          "2024-01-02T04:04:05Z",
+		PresenceVisibility: config.PresenceEveryone,
+		CustomFields:       customFields,
+	}
+
+	tests := []struct {
+		name   string
+		user   *service.User
+		viewer viewer
+		want   *user.User
+	}{
+		{
+			name:   "owner sees every field",
+			user:   full,
+			viewer: viewer{id: "user-1", presence: presenceCfg},
+			want:   &user.User{Profile: fullProfile, Account: fullAccount},
+		},
+		{
+			name:   "admin sees every field",
+			user:   full,
+			viewer: viewer{id: "admin-1", admin: true, presence: presenceCfg},
+			want:   &user.User{Profile: fullProfile, Account: fullAccount},
+		},
+		{
+			name:   "others only see the profile",
+			user:   full,
+			viewer: viewer{id: "user-2", presence: presenceCfg},
+			want:   &user.User{Profile: fullProfile},
+		},
+		{
+			name:   "presence disabled",
+			user:   full,
+			viewer: viewer{id: "user-2"},
+			want: &user.User{Profile: &user.PublicProfile{
+				Id:        "user-1",
+				Name:      "Jane Doe",
+				Username:  "jdoe",
+				CreatedAt: "2024-01-02T03:04:05Z",
+			}},
+		},
+		{
+			name:   "presence hidden by the user",
+			user:   hidden,
+			viewer: viewer{id: "user-1", presence: presenceCfg},
+			want: &user.User{Profile: &user.PublicProfile{
+				Id:        "user-3",
+				CreatedAt: "2024-01-02T03:04:05Z",
+			}},
+		},
+		{
+			name:   "optional fields unset",
+			user:   minimal,
+			viewer: viewer{id: "user-2", presence: presenceCfg},
+			want: &user.User{
+				Profile: &user.PublicProfile{
+					Id:        "user-2",
+					Name:      "New User",
+					CreatedAt: "2024-01-02T03:04:05Z",
+					Presence:  presence.StatusOffline,
+				},
+				Account: &user.PrivateAccount{
+					Email:     "new@example.com",
+					UpdatedAt: "2024-01-02T03:04:05Z",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toProtoUser(tt.user, tt.viewer); !proto.Equal(got, tt.want) {
+				t.Errorf("toProtoUser() = %v, want %v", got, tt.want)
+			}
+
+			page := toProtoUsers([]*service.User{tt.user, tt.user}, tt.viewer)
+			for i, got := range page {
+				if !proto.Equal(got, tt.want) {
+					t.Errorf("toProtoUsers()[%d] = %v, want %v", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
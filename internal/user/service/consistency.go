@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// ErrInvalidConsistencyToken is returned for consistency tokens that weren't issued by UpdateUser
+var ErrInvalidConsistencyToken = apperrors.Invalid("invalid consistency token")
+
+// NewConsistencyToken returns the token of a write to a user. It records the
+// user and the time of the write; it isn't secret, a forged token only moves
+// reads to the primary.
+func NewConsistencyToken(user *User) string {
+	raw := user.ID + ":" + strconv.FormatInt(user.UpdatedAt.UnixMilli(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ReadAfterWrite returns a context reading the user with the given ID from the
+// primary database if the token is for that user and younger than window, the
+// longest a read replica may lag behind. Other tokens leave ctx unchanged.
+func ReadAfterWrite(ctx context.Context, id, token string, window time.Duration) (context.Context, error) {
+	if token == "" {
+		return ctx, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidConsistencyToken
+	}
+	userID, written, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidConsistencyToken
+	}
+	millis, err := strconv.ParseInt(written, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidConsistencyToken
+	}
+
+	// Replicas have caught up with older writes
+	if userID != id || time.Since(time.UnixMilli(millis)) > window {
+		return ctx, nil
+	}
+	return database.WithPrimary(ctx), nil
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"github.com/linkeunid/hello-go/internal/user/repository"
+)
+
+// Conversions between repository and service users live here so that adding a
+// field is a change to this file only. Conversions to the API live in the server's views.
+
+// fromRepository converts a repository user to a service user
+func fromRepository(user *repository.User) *User {
+	converted := &User{}
+	fillFromRepository(converted, user)
+	return converted
+}
+
+// fromRepositoryList converts a page of repository users, backed by a single allocation
+func fromRepositoryList(users []*repository.User) []*User {
+	result := make([]*User, len(users))
+	converted := make([]User, len(users))
+	for i, user := range users {
+		fillFromRepository(&converted[i], user)
+		result[i] = &converted[i]
+	}
+	return result
+}
+
+// fillFromRepository copies every field of a repository user
+func fillFromRepository(dst *User, user *repository.User) {
+	*dst = User{
+		ID:                 user.ID,
+		TenantID:           user.TenantID,
+		Email:              user.Email,
+		Name:               user.Name,
+		Locale:             user.Locale,
+		Timezone:           user.Timezone,
+		Username:           user.GetUsername(),
+		Role:               user.Role,
+		PresenceVisibility: user.PresenceVisibility,
+		CustomFields:       user.CustomFields,
+		CreatedAt:          user.CreatedAt,
+		UpdatedAt:          user.UpdatedAt,
+	}
+	if user.LastSeenAt != nil {
+		dst.LastSeenAt = *user.LastSeenAt
+	}
+}
+
+// clone returns a copy of the user, so callers can't modify stored users
+func (u *User) clone() *User {
+	copied := *u
+	if u.CustomFields != nil {
+		copied.CustomFields = make(map[string]interface{}, len(u.CustomFields))
+		for name, value := range u.CustomFields {
+			copied.CustomFields[name] = value
+		}
+	}
+	return &copied
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/linkeunid/hello-go/internal/user/repository"
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// notConverted lists the repository fields deliberately left out of service users
+var notConverted = map[string]bool{
+	"Password": true,
+}
+
+func TestFromRepository(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	updated := created.Add(time.Hour)
+	seen := created.Add(2 * time.Hour)
+	username := "jdoe"
+
+	tests := []struct {
+		name string
+		user *repository.User
+		want *User
+	}{
+		{
+			name: "every field",
+			user: &repository.User{
+				ID:                 "user-1",
+				TenantID:           "acme",
+				Email:              "jdoe@example.com",
+				Password:           "hash",
+				Name:               "Jane Doe",
+				Username:           &username,
+				Role:               RoleAdmin,
+				Locale:             "de-DE",
+				Timezone:           "Europe/Berlin",
+				LastSeenAt:         &seen,
+				PresenceVisibility: "nobody",
+				CustomFields:       database.JSONMap{"team": "core", "seats": float64(3)},
+				CreatedAt:          created,
+				UpdatedAt:          updated,
+			},
+			want: &User{
+				ID:                 "user-1",
+				TenantID:           "acme",
+				Email:              "jdoe@example.com",
+				Name:               "Jane Doe",
+				Username:           "jdoe",
+				Role:               RoleAdmin,
+				Locale:             "de-DE",
+				Timezone:           "Europe/Berlin",
+				LastSeenAt:         seen,
+				PresenceVisibility: "nobody",
+				CustomFields:       map[string]interface{}{"team": "core", "seats": float64(3)},
+				CreatedAt:          created,
+				UpdatedAt:          updated,
+			},
+		},
+		{
+			name: "optional fields unset",
+			user: &repository.User{
+				ID:        "user-2",
+				TenantID:  "default",
+				Email:     "new@example.com",
+				Name:      "New User",
+				Role:      "user",
+				CreatedAt: created,
+				UpdatedAt: created,
+			},
+			want: &User{
+				ID:        "user-2",
+				TenantID:  "default",
+				Email:     "new@example.com",
+				Name:      "New User",
+				Role:      "user",
+				CreatedAt: created,
+				UpdatedAt: created,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fromRepository(tt.user); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fromRepository() = %+v, want %+v", got, tt.want)
+			}
+
+			list := fromRepositoryList([]*repository.User{tt.user, tt.user})
+			for i, got := range list {
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("fromRepositoryList()[%d] = %+v, want %+v", i, got, tt.want)
+				}
+			}
+			if list[0] == list[1] {
+				t.Error("fromRepositoryList() returned the same user twice")
+			}
+		})
+	}
+}
+
+// TestFromRepositoryCoversEveryField fails when a field is added to the
+// repository user without converting it
+func TestFromRepositoryCoversEveryField(t *testing.T) {
+	var user repository.User
+	fillNonZero(t, reflect.ValueOf(&user).Elem())
+
+	converted := reflect.ValueOf(fromRepository(&user)).Elem()
+	fields := reflect.TypeOf(user)
+	for i := 0; i < fields.NumField(); i++ {
+		name := fields.Field(i).Name
+		if notConverted[name] {
+			continue
+		}
+		field := converted.FieldByName(name)
+		if !field.IsValid() {
+			t.Errorf("service.User has no field %s", name)
+			continue
+		}
+		if field.IsZero() {
+			t.Errorf("fromRepository() doesn't convert %s", name)
+		}
+	}
+}
+
+// fillNonZero sets every field of a struct to a non-zero value
+func fillNonZero(t *testing.T, v reflect.Value) {
+	t.Helper()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case field.Type() == reflect.TypeOf(time.Time{}):
+			field.Set(reflect.ValueOf(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+		case field.Type() == reflect.TypeOf(&time.Time{}):
+			seen := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+			field.Set(reflect.ValueOf(&seen))
+		case field.Kind() == reflect.String:
+			field.SetString("value")
+		case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.String:
+			value := "value"
+			field.Set(reflect.ValueOf(&value))
+		case field.Kind() == reflect.Map:
+			field.Set(reflect.MakeMap(field.Type()))
+			field.SetMapIndex(reflect.ValueOf("key"), reflect.ValueOf("value"))
+		default:
+			t.Fatalf("fillNonZero: unsupported field %s of type %s", v.Type().Field(i).Name, field.Type())
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	user := &User{ID: "user-1", Name: "Jane Doe", CustomFields: map[string]interface{}{"team": "core"}}
+
+	copied := user.clone()
+	if !reflect.DeepEqual(copied, user) {
+		t.Fatalf("clone() = %+v, want %+v", copied, user)
+	}
+
+	copied.Name = "Changed"
+	copied.CustomFields["team"] = "changed"
+	if user.Name != "Jane Doe" || user.CustomFields["team"] != "core" {
+		t.Errorf("modifying the clone changed the original: %+v", user)
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// ErrCustomFieldFilterUnsupported is returned for custom field filters on databases without JSON queries
+var ErrCustomFieldFilterUnsupported = apperrors.FailedPrecondition("custom field filters are not supported by the database")
+
+// maxCustomFieldLength limits the length of string custom fields, in characters
+const maxCustomFieldLength = 255
+
+// customFieldDate is the layout of date custom fields
+const customFieldDate = "2006-01-02"
+
+// normalizeCustomFields validates custom field changes against their types, nil
+// values remove a field. Removing fields that are no longer defined is allowed.
+func normalizeCustomFields(types map[string]string, changes map[string]interface{}) (map[string]interface{}, error) {
+	normalized := make(map[string]interface{}, len(changes))
+	for name, value := range changes {
+		fieldType, defined := types[name]
+		if value == nil {
+			normalized[name] = nil
+			continue
+		}
+		if !defined {
+			return nil, apperrors.Invalid(fmt.Sprintf("unknown custom field %q", name))
+		}
+
+		valid := false
+		switch fieldType {
+		case config.CustomFieldString:
+			text, ok := value.(string)
+			valid = ok && utf8.RuneCountInString(text) <= maxCustomFieldLength
+		case config.CustomFieldNumber:
+			number, ok := value.(float64)
+			valid = ok && !math.IsInf(number, 0) && !math.IsNaN(number)
+		case config.CustomFieldBool:
+			_, valid = value.(bool)
+		case config.CustomFieldDate:
+			text, ok := value.(string)
+			if ok {
+				_, err := time.Parse(customFieldDate, text)
+				valid = err == nil
+			}
+		}
+		if !valid {
+			return nil, apperrors.Invalid(fmt.Sprintf("invalid value of custom field %q, expected a %s", name, fieldType))
+		}
+		normalized[name] = value
+	}
+	return normalized, nil
+}
+
+// customFieldText returns the text of a custom field value as the database
+// writes it: strings as is, numbers and booleans as in JSON
+func customFieldText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,19 @@
+package service
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// normalizeEmail validates an email address and returns it without surrounding whitespace
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+
+	// Only accept bare addresses, not "Name <address>"
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "", ErrInvalidEmail
+	}
+
+	return email, nil
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// ErrETagMismatch is returned for writes with the etag of an older version of the user
+var ErrETagMismatch = apperrors.Aborted("etag mismatch, the user changed since it was read")
+
+// ETag returns the etag of a user's current state. Every write changes the
+// user's update time, so the etag changes with it. Times are truncated to
+// milliseconds like the database stores them, so a user has the same etag
+// whether it was just written or read back.
+func ETag(user *User) string {
+	sum := sha256.Sum256([]byte(user.ID + ":" + strconv.FormatInt(user.UpdatedAt.UnixMilli(), 10)))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// CheckETag returns ErrETagMismatch if etag is set and isn't the user's current etag
+func CheckETag(user *User, etag string) error {
+	if etag != "" && etag != ETag(user) {
+		return ErrETagMismatch
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linkeunid/hello-go/internal/user/repository"
+	"github.com/linkeunid/hello-go/pkg/config"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/listfilter"
+)
+
+// User orders of UserFilter.OrderBy
+const (
+	OrderCreatedAtDesc = repository.OrderCreatedAtDesc
+	OrderCreatedAtAsc  = repository.OrderCreatedAtAsc
+	OrderNameAsc       = repository.OrderNameAsc
+	OrderNameDesc      = repository.OrderNameDesc
+)
+
+// UserFilterFields are the fields of UserFilter.Expression
+var UserFilterFields = repository.UserFilterFields
+
+// userStatuses are the account statuses set by the auth service
+var userStatuses = map[string]bool{"active": true, "pending": true, "suspended": true, "rejected": true}
+
+// tagPattern matches the tags the auth service allows
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// UserFilter narrows the listed users, empty fields match everything
+type UserFilter struct {
+	// CustomFields match users whose custom field of the key has the value, e.g. "department" -> "sales"
+	CustomFields map[string]string
+	// CreatedAfter matches users created after the time
+	CreatedAfter time.Time
+	// Status matches the account status, e.g. "suspended"
+	Status string
+	// Tags match users having all of them
+	Tags []string
+	// Expression matches users by UserFilterFields, parsed with listfilter.Parse
+	Expression listfilter.Expr
+	// OrderBy is one of the Order constants, newest first if empty
+	OrderBy string
+}
+
+// normalizeFilter validates a filter and converts its custom field values to the text of stored values
+func normalizeFilter(types map[string]string, filter UserFilter) (repository.UserFilter, error) {
+	normalized := repository.UserFilter{
+		CustomFields: make(map[string]string, len(filter.CustomFields)),
+		CreatedAfter: filter.CreatedAfter,
+		Status:       filter.Status,
+		Expression:   filter.Expression,
+		OrderBy:      filter.OrderBy,
+	}
+
+	for name, text := range filter.CustomFields {
+		fieldType, defined := types[name]
+		if !defined {
+			return repository.UserFilter{}, apperrors.Invalid(fmt.Sprintf("unknown custom field %q", name))
+		}
+
+		var value interface{} = text
+		var err error
+		switch fieldType {
+		case config.CustomFieldNumber:
+			value, err = strconv.ParseFloat(text, 64)
+		case config.CustomFieldBool:
+			value, err = strconv.ParseBool(text)
+		case config.CustomFieldDate:
+			_, err = time.Parse(customFieldDate, text)
+		}
+		if err != nil {
+			return repository.UserFilter{}, apperrors.Invalid(fmt.Sprintf("invalid filter of custom field %q, expected a %s", name, fieldType))
+		}
+		normalized.CustomFields[name] = customFieldText(value)
+	}
+
+	if filter.Status != "" && !userStatuses[filter.Status] {
+		return repository.UserFilter{}, apperrors.Invalid(fmt.Sprintf("invalid status %q", filter.Status))
+	}
+
+	switch filter.OrderBy {
+	case "", OrderCreatedAtDesc, OrderCreatedAtAsc, OrderNameAsc, OrderNameDesc:
+	default:
+		return repository.UserFilter{}, apperrors.Invalid(fmt.Sprintf("invalid order %q", filter.OrderBy))
+	}
+
+	// Tags are deduplicated since every one of them has to match
+	seen := make(map[string]bool, len(filter.Tags))
+	for _, tag := range filter.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return repository.UserFilter{}, apperrors.Invalid(fmt.Sprintf("invalid tag %q", tag))
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized.Tags = append(normalized.Tags, tag)
+		}
+	}
+	sort.Strings(normalized.Tags)
+
+	return normalized, nil
+}
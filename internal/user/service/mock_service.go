@@ -2,18 +2,33 @@ package service
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/listfilter"
+	"github.com/linkeunid/hello-go/pkg/metering"
+	"github.com/linkeunid/hello-go/pkg/revocation"
 )
 
 // MockUserService implements the UserService interface with mock data
 type mockUserService struct {
-	cfg    *config.Config
-	logger *zap.Logger
-	users  map[string]*User // id -> user
+	cfg       *config.Config
+	logger    *zap.Logger
+	users     map[string]*User          // id -> user
+	usernames map[string]releasedHandle // released username -> previous owner
+	meter     *metering.Meter
+	revoked   revocation.Store
+	stats     *publicStats
+}
+
+// releasedHandle records who released a username and when
+type releasedHandle struct {
+	userID     string
+	releasedAt time.Time
 }
 
 // NewMockUserService creates a new mock user service
@@ -23,6 +38,8 @@ func NewMockUserService(cfg *config.Config, logger *zap.Logger) UserService {
 		"00000000-0000-0000-0000-000000000001": {
 			ID:        "00000000-0000-0000-0000-000000000001",
 			Email:     "admin@example.com",
+			Username:  "admin_user",
+			Role:      RoleAdmin,
 			Name:      "Admin User",
 			CreatedAt: time.Now().Add(-30 * 24 * time.Hour),
 			UpdatedAt: time.Now().Add(-2 * 24 * time.Hour),
@@ -30,6 +47,7 @@ func NewMockUserService(cfg *config.Config, logger *zap.Logger) UserService {
 		"00000000-0000-0000-0000-000000000002": {
 			ID:        "00000000-0000-0000-0000-000000000002",
 			Email:     "user@example.com",
+			Username:  "regular_user",
 			Name:      "Regular User",
 			CreatedAt: time.Now().Add(-7 * 24 * time.Hour),
 			UpdatedAt: time.Now().Add(-1 * 24 * time.Hour),
@@ -37,6 +55,7 @@ func NewMockUserService(cfg *config.Config, logger *zap.Logger) UserService {
 		"00000000-0000-0000-0000-000000000003": {
 			ID:        "00000000-0000-0000-0000-000000000003",
 			Email:     "test@example.com",
+			Username:  "test_user",
 			Name:      "Test User",
 			CreatedAt: time.Now().Add(-1 * 24 * time.Hour),
 			UpdatedAt: time.Now(),
@@ -59,14 +78,18 @@ func NewMockUserService(cfg *config.Config, logger *zap.Logger) UserService {
 	}
 
 	return &mockUserService{
-		cfg:    cfg,
-		logger: logger,
-		users:  mockUsers,
+		cfg:       cfg,
+		logger:    logger,
+		users:     mockUsers,
+		usernames: make(map[string]releasedHandle),
+		meter:     metering.NewMemoryMeter(cfg, "user", logger.Named("metering")),
+		revoked:   revocation.NewMemoryStore(),
+		stats:     &publicStats{cfg: cfg.PublicStats},
 	}
 }
 
-// GetUser gets a user by ID
-func (s *mockUserService) GetUser(ctx context.Context, id string) (*User, error) {
+// GetUser gets a user by ID, mock users always have every column loaded
+func (s *mockUserService) GetUser(ctx context.Context, id string, columns ...string) (*User, error) {
 	s.logger.Debug("Mock: Getting user by ID", zap.String("user_id", id))
 
 	user, exists := s.users[id]
@@ -75,13 +98,7 @@ func (s *mockUserService) GetUser(ctx context.Context, id string) (*User, error)
 	}
 
 	// Return a copy to prevent modification of internal state
-	return &User{
-		ID:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-	}, nil
+	return user.clone(), nil
 }
 
 // UpdateUser updates a user's information
@@ -96,11 +113,15 @@ func (s *mockUserService) UpdateUser(ctx context.Context, id, name, email string
 		return nil, ErrUserNotFound
 	}
 
+	// Validate email
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if email is already taken by another user
-	for _, u := range s.users {
-		if u.Email == email && u.ID != id {
-			return nil, ErrUserAlreadyExists
-		}
+	if s.emailTaken(email, id) {
+		return nil, ErrEmailTaken
 	}
 
 	// Update user
@@ -109,13 +130,225 @@ func (s *mockUserService) UpdateUser(ctx context.Context, id, name, email string
 	user.UpdatedAt = time.Now()
 
 	// Return a copy to prevent modification of internal state
-	return &User{
-		ID:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-	}, nil
+	return user.clone(), nil
+}
+
+// GetPublicStats returns the usage statistics of the mock users
+func (s *mockUserService) GetPublicStats(ctx context.Context) (*PublicStats, error) {
+	s.logger.Debug("Mock: Getting public stats")
+
+	return s.stats.get(ctx, func(ctx context.Context, since time.Time) (int, error) {
+		count := 0
+		for _, u := range s.users {
+			if !u.CreatedAt.Before(since) {
+				count++
+			}
+		}
+		return count, nil
+	})
+}
+
+// emailTaken checks if a mock user other than excludeID has the email,
+// case-insensitively like the database collation
+func (s *mockUserService) emailTaken(email, excludeID string) bool {
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, email) && u.ID != excludeID {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdatePreferences updates a user's locale and timezone
+func (s *mockUserService) UpdatePreferences(ctx context.Context, id, locale, timezone string) (*User, error) {
+	s.logger.Debug("Mock: Updating user preferences",
+		zap.String("user_id", id),
+		zap.String("locale", locale),
+		zap.String("timezone", timezone))
+
+	user, exists := s.users[id]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Validate and normalize preferences
+	locale, timezone, err := normalizePreferences(locale, timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update user
+	user.Locale = locale
+	user.Timezone = timezone
+	user.UpdatedAt = time.Now()
+
+	// Return a copy to prevent modification of internal state
+	return user.clone(), nil
+}
+
+// TouchLastSeen records that the user made a request now
+func (s *mockUserService) TouchLastSeen(ctx context.Context, id string) error {
+	s.logger.Debug("Mock: Updating last seen time", zap.String("user_id", id))
+
+	user, exists := s.users[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	user.LastSeenAt = time.Now()
+	return nil
+}
+
+// UpdatePresenceVisibility sets who sees whether the user is online
+func (s *mockUserService) UpdatePresenceVisibility(ctx context.Context, id, visibility string) (*User, error) {
+	s.logger.Debug("Mock: Updating presence visibility",
+		zap.String("user_id", id),
+		zap.String("visibility", visibility))
+
+	user, exists := s.users[id]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Validate visibility
+	if !validPresenceVisibility(visibility) {
+		return nil, ErrInvalidPresence
+	}
+
+	// Update user
+	user.PresenceVisibility = visibility
+	user.UpdatedAt = time.Now()
+
+	// Return a copy to prevent modification of internal state
+	return user.clone(), nil
+}
+
+// UpdateCustomFields sets the given custom fields of a user, nil values remove fields
+func (s *mockUserService) UpdateCustomFields(ctx context.Context, id string, changes map[string]interface{}) (*User, error) {
+	s.logger.Debug("Mock: Updating custom fields", zap.String("user_id", id))
+
+	user, exists := s.users[id]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Validate values against the field types
+	changes, err := normalizeCustomFields(s.cfg.User.CustomFields, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update user
+	fields := make(map[string]interface{}, len(user.CustomFields)+len(changes))
+	for name, value := range user.CustomFields {
+		fields[name] = value
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(fields, name)
+		} else {
+			fields[name] = value
+		}
+	}
+	user.CustomFields = fields
+	user.UpdatedAt = time.Now()
+
+	// Return a copy to prevent modification of internal state
+	return user.clone(), nil
+}
+
+// hasCustomFields reports whether the user's custom fields have the given texts, see customFieldText
+func (u *User) hasCustomFields(texts map[string]string) bool {
+	for name, text := range texts {
+		value, ok := u.CustomFields[name]
+		if !ok || customFieldText(value) != text {
+			return false
+		}
+	}
+	return true
+}
+
+// filterValue returns the value of a column of UserFilterFields, mock users are active
+func (u *User) filterValue(column string) interface{} {
+	switch column {
+	case "name":
+		return u.Name
+	case "username":
+		// Users without a username have NULL in the database
+		if u.Username == "" {
+			return nil
+		}
+		return u.Username
+	case "email":
+		return u.Email
+	case "status":
+		return "active"
+	case "created_at":
+		return u.CreatedAt
+	case "updated_at":
+		return u.UpdatedAt
+	default:
+		return nil
+	}
+}
+
+// GetUserByUsername gets a user by username
+func (s *mockUserService) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	s.logger.Debug("Mock: Getting user by username", zap.String("username", username))
+
+	username = strings.ToLower(strings.TrimSpace(username))
+	for _, user := range s.users {
+		if user.Username != "" && user.Username == username {
+			// Return a copy to prevent modification of internal state
+			return user.clone(), nil
+		}
+	}
+
+	return nil, ErrUserNotFound
+}
+
+// UpdateUsername changes a user's username
+func (s *mockUserService) UpdateUsername(ctx context.Context, id, username string) (*User, error) {
+	s.logger.Debug("Mock: Updating username",
+		zap.String("user_id", id),
+		zap.String("username", username))
+
+	user, exists := s.users[id]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Validate and normalize username
+	username, err := normalizeUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Username != username {
+		// Check if username is already taken by another user
+		for _, u := range s.users {
+			if u.Username == username && u.ID != id {
+				return nil, ErrUsernameTaken
+			}
+		}
+
+		// Recently released usernames stay reserved for their previous owner
+		if released, ok := s.usernames[username]; ok && released.userID != id &&
+			time.Since(released.releasedAt) < s.cfg.User.UsernameHoldPeriod {
+			return nil, ErrUsernameHeld
+		}
+
+		// Record the released username
+		if user.Username != "" {
+			s.usernames[user.Username] = releasedHandle{userID: id, releasedAt: time.Now()}
+		}
+
+		user.Username = username
+		user.UpdatedAt = time.Now()
+	}
+
+	// Return a copy to prevent modification of internal state
+	return user.clone(), nil
 }
 
 // DeleteUser deletes a user by ID
@@ -130,12 +363,62 @@ func (s *mockUserService) DeleteUser(ctx context.Context, id string) error {
 	return nil
 }
 
-// ListUsers returns a list of users
-func (s *mockUserService) ListUsers(ctx context.Context, page, pageSize int) ([]*User, int, error) {
+// ProjectRegistration creates or updates a mock user registered with the auth service
+func (s *mockUserService) ProjectRegistration(ctx context.Context, user *User, at time.Time) error {
+	s.logger.Debug("Mock: Projecting registration", zap.String("user_id", user.ID))
+
+	if s.emailTaken(user.Email, user.ID) {
+		return ErrEmailTaken
+	}
+
+	existing, exists := s.users[user.ID]
+	if !exists {
+		created := user.clone()
+		created.UpdatedAt = at
+		s.users[user.ID] = created
+		return nil
+	}
+	if existing.UpdatedAt.Before(at) {
+		existing.Email = user.Email
+		existing.Name = user.Name
+		existing.Role = user.Role
+		existing.UpdatedAt = at
+	}
+	return nil
+}
+
+// ProjectEmailChange sets the email a mock user changed with the auth service
+func (s *mockUserService) ProjectEmailChange(ctx context.Context, id, email string, at time.Time) error {
+	s.logger.Debug("Mock: Projecting email change", zap.String("user_id", id))
+
+	user, exists := s.users[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+	if s.emailTaken(email, id) {
+		return ErrEmailTaken
+	}
+
+	if user.UpdatedAt.Before(at) {
+		user.Email = email
+		user.UpdatedAt = at
+	}
+	return nil
+}
+
+// ListUsers returns a list of users matching the filter, mock users always have every column loaded
+func (s *mockUserService) ListUsers(ctx context.Context, filter UserFilter, page, pageSize int, columns ...string) ([]*User, int, error) {
 	s.logger.Debug("Mock: Listing users",
+		zap.Any("filter", filter),
 		zap.Int("page", page),
 		zap.Int("page_size", pageSize))
 
+	// Validate filter
+	repoFilter, err := normalizeFilter(s.cfg.User.CustomFields, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	// Validate page and pageSize
 	if page < 1 {
 		page = 1
@@ -144,21 +427,31 @@ func (s *mockUserService) ListUsers(ctx context.Context, page, pageSize int) ([]
 		pageSize = 10
 	}
 
-	// Convert map to slice
-	var allUsers []*User
+	// Convert map to slice, keeping the matching users. Mock users are active and have no tags.
+	allUsers := make([]*User, 0, len(s.users))
 	for _, user := range s.users {
-		// Create a copy to prevent modification of internal state
-		allUsers = append(allUsers, &User{
-			ID:        user.ID,
-			Email:     user.Email,
-			Name:      user.Name,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
-		})
+		if !user.hasCustomFields(repoFilter.CustomFields) || !user.CreatedAt.After(repoFilter.CreatedAfter) ||
+			(repoFilter.Status != "" && repoFilter.Status != "active") || len(repoFilter.Tags) > 0 ||
+			!listfilter.Match(repoFilter.Expression, user.filterValue) {
+			continue
+		}
+		allUsers = append(allUsers, user)
 	}
 
-	// Sort by creation date (newest first) - simplified for mock
-	// In a real implementation, you'd use sort.Slice
+	// Sort in the requested order, newest first by default
+	sort.Slice(allUsers, func(i, j int) bool {
+		a, b := allUsers[i], allUsers[j]
+		switch repoFilter.OrderBy {
+		case OrderCreatedAtAsc:
+			return a.CreatedAt.Before(b.CreatedAt)
+		case OrderNameAsc:
+			return a.Name < b.Name
+		case OrderNameDesc:
+			return a.Name > b.Name
+		default:
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+	})
 
 	// Calculate total
 	total := len(allUsers)
@@ -173,8 +466,27 @@ func (s *mockUserService) ListUsers(ctx context.Context, page, pageSize int) ([]
 		end = total
 	}
 
-	return allUsers[start:end], total, nil
+	// Copy only the page to prevent modification of internal state
+	result := make([]*User, end-start)
+	for i, user := range allUsers[start:end] {
+		result[i] = user.clone()
+	}
+
+	return result, total, nil
+}
+
+// Meter returns the service's usage meter
+func (s *mockUserService) Meter() *metering.Meter {
+	return s.meter
 }
 
-// Add error for email already taken
-var ErrUserAlreadyExists = ErrUserNotFound
+// Revocations returns a store local to this process, tokens logged out with
+// the mock auth service aren't seen here
+func (s *mockUserService) Revocations() revocation.Store {
+	return s.revoked
+}
+
+// Ping always succeeds, mock data is kept in memory
+func (s *mockUserService) Ping(ctx context.Context) error {
+	return nil
+}
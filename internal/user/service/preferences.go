@@ -0,0 +1,36 @@
+package service
+
+import (
+	"time"
+
+	"golang.org/x/text/language"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// normalizePreferences validates a locale and timezone and returns their canonical forms.
+// Empty values are allowed and clear the preference.
+func normalizePreferences(locale, timezone string) (string, string, error) {
+	if locale != "" {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return "", "", ErrInvalidLocale
+		}
+		locale = tag.String()
+	}
+
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil || loc.String() == "Local" {
+			return "", "", ErrInvalidTimezone
+		}
+		timezone = loc.String()
+	}
+
+	return locale, timezone, nil
+}
+
+// validPresenceVisibility reports whether users may choose the presence visibility
+func validPresenceVisibility(visibility string) bool {
+	return visibility == config.PresenceEveryone || visibility == config.PresenceNobody
+}
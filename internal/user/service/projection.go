@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/internal/user/repository"
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// ProjectRegistration creates or updates a user registered with the auth service
+// at the given time. Changes older than the stored user are skipped, so the
+// same registration can be projected again.
+func (s *userService) ProjectRegistration(ctx context.Context, user *User, at time.Time) error {
+	s.logger.Debug("Projecting registration",
+		zap.String("user_id", user.ID),
+		zap.Time("at", at))
+
+	if err := s.checkProjectedEmail(ctx, user.ID, user.Email); err != nil {
+		return err
+	}
+
+	written, err := s.repo.ProjectUser(ctx, &repository.User{
+		ID:        user.ID,
+		TenantID:  user.TenantID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+	}, at)
+	if err != nil {
+		if errors.Is(err, database.ErrDuplicate) {
+			return ErrEmailTaken
+		}
+		return err
+	}
+
+	s.logger.Debug("Registration projected",
+		zap.String("user_id", user.ID),
+		zap.Bool("written", written))
+	return nil
+}
+
+// ProjectEmailChange sets the email a user changed with the auth service at the
+// given time, unless the user changed since
+func (s *userService) ProjectEmailChange(ctx context.Context, id, email string, at time.Time) error {
+	s.logger.Debug("Projecting email change",
+		zap.String("user_id", id),
+		zap.Time("at", at))
+
+	if err := s.checkProjectedEmail(ctx, id, email); err != nil {
+		return err
+	}
+
+	written, err := s.repo.ProjectEmail(ctx, id, email, at)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrUserNotFound):
+			return ErrUserNotFound
+		case errors.Is(err, database.ErrDuplicate):
+			return ErrEmailTaken
+		}
+		return err
+	}
+
+	s.logger.Debug("Email change projected",
+		zap.String("user_id", id),
+		zap.Bool("written", written))
+	return nil
+}
+
+// checkProjectedEmail checks that no other user has an email the auth service assigned
+func (s *userService) checkProjectedEmail(ctx context.Context, id, email string) error {
+	taken, err := s.repo.EmailTaken(ctx, email, id)
+	if err != nil {
+		return err
+	}
+	if taken {
+		s.logger.Warn("Projected email belongs to another user", zap.String("user_id", id))
+		return ErrEmailTaken
+	}
+	return nil
+}
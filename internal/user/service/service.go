@@ -3,62 +3,134 @@ package service
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/linkeunid/hello-go/internal/user/repository"
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/metering"
+	"github.com/linkeunid/hello-go/pkg/revocation"
 )
 
-// Common errors
+// Common errors, their messages are returned to clients
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound     = apperrors.NotFound("user not found")
+	ErrEmailTaken       = apperrors.AlreadyExists("email is already taken")
+	ErrInvalidEmail     = apperrors.Invalid("invalid email address")
+	ErrInvalidLocale    = apperrors.Invalid("invalid locale, expected a BCP 47 language tag")
+	ErrInvalidTimezone  = apperrors.Invalid("invalid timezone, expected an IANA time zone name")
+	ErrInvalidUsername  = apperrors.Invalid("invalid username, use 3-30 lowercase letters, digits and underscores, starting with a letter")
+	ErrReservedUsername = apperrors.Invalid("username is reserved")
+	ErrUsernameTaken    = apperrors.AlreadyExists("username is taken")
+	ErrUsernameHeld     = apperrors.FailedPrecondition("username was recently released and is not available yet")
+	ErrInvalidPresence  = apperrors.Invalid("invalid presence visibility, expected everyone or nobody")
 )
 
+// RoleAdmin is the role of users that can see every user's private data
+const RoleAdmin = "admin"
+
 // User represents a user in the service layer
 type User struct {
-	ID        string
-	Email     string
-	Name      string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID string
+	// TenantID is the customer the user belongs to
+	TenantID string
+	Email    string
+	Name     string
+	Username string
+	Role     string
+	Locale   string
+	Timezone string
+	// LastSeenAt is zero if the user was never seen
+	LastSeenAt time.Time
+	// PresenceVisibility is empty for the configured default
+	PresenceVisibility string
+	// CustomFields are the values of the USER_CUSTOM_FIELDS by name
+	CustomFields map[string]interface{}
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
 }
 
 // UserService defines the interface for user service operations
 type UserService interface {
-	// GetUser gets a user by ID
-	GetUser(ctx context.Context, id string) (*User, error)
+	// GetUser gets a user by ID, loading only the given columns if any
+	GetUser(ctx context.Context, id string, columns ...string) (*User, error)
 	// UpdateUser updates a user's information
 	UpdateUser(ctx context.Context, id, name, email string) (*User, error)
+	// GetPublicStats returns the usage statistics safe to publish
+	GetPublicStats(ctx context.Context) (*PublicStats, error)
+	// UpdatePreferences updates a user's locale and timezone
+	UpdatePreferences(ctx context.Context, id, locale, timezone string) (*User, error)
+	// TouchLastSeen records that the user made a request now
+	TouchLastSeen(ctx context.Context, id string) error
+	// UpdatePresenceVisibility sets who sees whether the user is online
+	UpdatePresenceVisibility(ctx context.Context, id, visibility string) (*User, error)
+	// UpdateCustomFields sets the given custom fields of a user, nil values remove fields
+	UpdateCustomFields(ctx context.Context, id string, changes map[string]interface{}) (*User, error)
+	// GetUserByUsername gets a user by username
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	// UpdateUsername changes a user's username
+	UpdateUsername(ctx context.Context, id, username string) (*User, error)
 	// DeleteUser deletes a user by ID
 	DeleteUser(ctx context.Context, id string) error
-	// ListUsers returns a list of users
-	ListUsers(ctx context.Context, page, pageSize int) ([]*User, int, error)
+	// ListUsers returns a list of users matching the filter, loading only the given columns if any
+	ListUsers(ctx context.Context, filter UserFilter, page, pageSize int, columns ...string) ([]*User, int, error)
+	// ProjectRegistration creates or updates a user registered with the auth service at the given time
+	ProjectRegistration(ctx context.Context, user *User, at time.Time) error
+	// ProjectEmailChange sets the email a user changed with the auth service at the given time
+	ProjectEmailChange(ctx context.Context, id, email string, at time.Time) error
+	// Meter returns the service's usage meter
+	Meter() *metering.Meter
+	// Revocations returns the store of tokens logged out with the auth service
+	Revocations() revocation.Store
+	// Ping checks the service's storage
+	Ping(ctx context.Context) error
 }
 
 // userService implements the UserService interface
 type userService struct {
-	cfg    *config.Config
-	repo   repository.UserRepository
-	logger *zap.Logger
+	cfg     *config.Config
+	repo    repository.UserRepository
+	meter   *metering.Meter
+	revoked revocation.Store
+	stats   *publicStats
+	logger  *zap.Logger
 }
 
 // NewUserService creates a new user service
 func NewUserService(cfg *config.Config, logger *zap.Logger) UserService {
+	repo := repository.NewUserRepository(cfg, logger.Named("user_repository"))
+
+	meter, err := metering.NewMeter(cfg, repo.DB(), "user", logger.Named("metering"))
+	if err != nil {
+		logger.Fatal("Failed to create usage meter", zap.Error(err))
+	}
+
+	// Shared with the auth service, which revokes tokens on logout
+	revoked, err := revocation.NewStore(cfg, repo.DB(), logger.Named("revocation"))
+	if err != nil {
+		logger.Fatal("Failed to create token revocation store", zap.Error(err))
+	}
+
 	return &userService{
-		cfg:    cfg,
-		repo:   repository.NewUserRepository(cfg, logger.Named("user_repository")),
-		logger: logger,
+		cfg:     cfg,
+		repo:    repo,
+		meter:   meter,
+		revoked: revoked,
+		stats:   &publicStats{cfg: cfg.PublicStats},
+		logger:  logger,
 	}
 }
 
-// GetUser gets a user by ID
-func (s *userService) GetUser(ctx context.Context, id string) (*User, error) {
+// GetUser gets a user by ID, loading only the given columns if any
+func (s *userService) GetUser(ctx context.Context, id string, columns ...string) (*User, error) {
 	s.logger.Debug("Getting user by ID", zap.String("user_id", id))
 
 	// Get user
-	user, err := s.repo.GetUserByID(ctx, id)
+	user, err := s.repo.GetUserByID(ctx, id, columns...)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
 			s.logger.Debug("User not found", zap.String("user_id", id))
@@ -73,13 +145,7 @@ func (s *userService) GetUser(ctx context.Context, id string) (*User, error) {
 	s.logger.Debug("User found", zap.String("user_id", id))
 
 	// Map to service layer user
-	return &User{
-		ID:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-	}, nil
+	return fromRepository(user), nil
 }
 
 // UpdateUser updates a user's information
@@ -89,6 +155,26 @@ func (s *userService) UpdateUser(ctx context.Context, id, name, email string) (*
 		zap.String("name", name),
 		zap.String("email", email))
 
+	// Validate email
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check that no other user has the email. The unique index still catches
+	// concurrent updates, which are reported the same way below.
+	taken, err := s.repo.EmailTaken(ctx, email, id)
+	if err != nil {
+		s.logger.Error("Error checking email",
+			zap.String("user_id", id),
+			zap.Error(err))
+		return nil, err
+	}
+	if taken {
+		s.logger.Debug("Email already taken during update", zap.String("user_id", id))
+		return nil, ErrEmailTaken
+	}
+
 	// Update user
 	user, err := s.repo.UpdateUser(ctx, id, name, email)
 	if err != nil {
@@ -96,6 +182,10 @@ func (s *userService) UpdateUser(ctx context.Context, id, name, email string) (*
 			s.logger.Debug("User not found during update", zap.String("user_id", id))
 			return nil, ErrUserNotFound
 		}
+		if errors.Is(err, database.ErrDuplicate) {
+			s.logger.Debug("Email already taken during update", zap.String("user_id", id))
+			return nil, ErrEmailTaken
+		}
 		s.logger.Error("Error updating user",
 			zap.String("user_id", id),
 			zap.Error(err))
@@ -105,13 +195,188 @@ func (s *userService) UpdateUser(ctx context.Context, id, name, email string) (*
 	s.logger.Debug("User updated successfully", zap.String("user_id", id))
 
 	// Map to service layer user
-	return &User{
-		ID:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-	}, nil
+	return fromRepository(user), nil
+}
+
+// GetPublicStats returns the usage statistics safe to publish
+func (s *userService) GetPublicStats(ctx context.Context) (*PublicStats, error) {
+	// Stats are served to every tenant, so they count the users of all of them
+	ctx = database.WithTenant(ctx, "")
+	stats, err := s.stats.get(ctx, s.repo.CountUsers)
+	if err != nil && !errors.Is(err, ErrPublicStatsDisabled) {
+		s.logger.Error("Error computing public stats", zap.Error(err))
+	}
+	return stats, err
+}
+
+// UpdatePreferences updates a user's locale and timezone
+func (s *userService) UpdatePreferences(ctx context.Context, id, locale, timezone string) (*User, error) {
+	s.logger.Debug("Updating user preferences",
+		zap.String("user_id", id),
+		zap.String("locale", locale),
+		zap.String("timezone", timezone))
+
+	// Validate and normalize preferences
+	locale, timezone, err := normalizePreferences(locale, timezone)
+	if err != nil {
+		s.logger.Debug("Invalid user preferences",
+			zap.String("user_id", id),
+			zap.Error(err))
+		return nil, err
+	}
+
+	// Update preferences
+	user, err := s.repo.UpdatePreferences(ctx, id, locale, timezone)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			s.logger.Debug("User not found during preferences update", zap.String("user_id", id))
+			return nil, ErrUserNotFound
+		}
+		s.logger.Error("Error updating user preferences",
+			zap.String("user_id", id),
+			zap.Error(err))
+		return nil, err
+	}
+
+	s.logger.Debug("User preferences updated successfully", zap.String("user_id", id))
+
+	// Map to service layer user
+	return fromRepository(user), nil
+}
+
+// TouchLastSeen records that the user made a request now
+func (s *userService) TouchLastSeen(ctx context.Context, id string) error {
+	s.logger.Debug("Updating last seen time", zap.String("user_id", id))
+
+	return s.repo.TouchLastSeen(ctx, id, time.Now())
+}
+
+// UpdatePresenceVisibility sets who sees whether the user is online
+func (s *userService) UpdatePresenceVisibility(ctx context.Context, id, visibility string) (*User, error) {
+	s.logger.Debug("Updating presence visibility",
+		zap.String("user_id", id),
+		zap.String("visibility", visibility))
+
+	// Validate visibility
+	if !validPresenceVisibility(visibility) {
+		return nil, ErrInvalidPresence
+	}
+
+	// Update visibility
+	user, err := s.repo.UpdatePresenceVisibility(ctx, id, visibility)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			s.logger.Debug("User not found during presence visibility update", zap.String("user_id", id))
+			return nil, ErrUserNotFound
+		}
+		s.logger.Error("Error updating presence visibility",
+			zap.String("user_id", id),
+			zap.Error(err))
+		return nil, err
+	}
+
+	s.logger.Debug("Presence visibility updated successfully", zap.String("user_id", id))
+
+	// Map to service layer user
+	return fromRepository(user), nil
+}
+
+// UpdateCustomFields sets the given custom fields of a user, nil values remove fields
+func (s *userService) UpdateCustomFields(ctx context.Context, id string, changes map[string]interface{}) (*User, error) {
+	s.logger.Debug("Updating custom fields", zap.String("user_id", id))
+
+	// Validate values against the field types
+	changes, err := normalizeCustomFields(s.cfg.User.CustomFields, changes)
+	if err != nil {
+		s.logger.Debug("Invalid custom fields",
+			zap.String("user_id", id),
+			zap.Error(err))
+		return nil, err
+	}
+
+	// Update custom fields
+	user, err := s.repo.UpdateCustomFields(ctx, id, changes)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			s.logger.Debug("User not found during custom fields update", zap.String("user_id", id))
+			return nil, ErrUserNotFound
+		}
+		s.logger.Error("Error updating custom fields",
+			zap.String("user_id", id),
+			zap.Error(err))
+		return nil, err
+	}
+
+	s.logger.Debug("Custom fields updated successfully", zap.String("user_id", id))
+
+	// Map to service layer user
+	return fromRepository(user), nil
+}
+
+// GetUserByUsername gets a user by username
+func (s *userService) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	s.logger.Debug("Getting user by username", zap.String("username", username))
+
+	// Usernames are stored lowercase
+	username = strings.ToLower(strings.TrimSpace(username))
+
+	// Get user
+	user, err := s.repo.GetUserByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			s.logger.Debug("User not found", zap.String("username", username))
+			return nil, ErrUserNotFound
+		}
+		s.logger.Error("Error getting user by username",
+			zap.String("username", username),
+			zap.Error(err))
+		return nil, err
+	}
+
+	// Map to service layer user
+	return fromRepository(user), nil
+}
+
+// UpdateUsername changes a user's username
+func (s *userService) UpdateUsername(ctx context.Context, id, username string) (*User, error) {
+	s.logger.Debug("Updating username",
+		zap.String("user_id", id),
+		zap.String("username", username))
+
+	// Validate and normalize username
+	username, err := normalizeUsername(username)
+	if err != nil {
+		s.logger.Debug("Invalid username",
+			zap.String("user_id", id),
+			zap.Error(err))
+		return nil, err
+	}
+
+	// Update username
+	heldSince := time.Now().Add(-s.cfg.User.UsernameHoldPeriod)
+	user, err := s.repo.UpdateUsername(ctx, id, username, heldSince)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrUserNotFound):
+			s.logger.Debug("User not found during username update", zap.String("user_id", id))
+			return nil, ErrUserNotFound
+		case errors.Is(err, repository.ErrUsernameTaken):
+			return nil, ErrUsernameTaken
+		case errors.Is(err, repository.ErrUsernameHeld):
+			return nil, ErrUsernameHeld
+		}
+		s.logger.Error("Error updating username",
+			zap.String("user_id", id),
+			zap.Error(err))
+		return nil, err
+	}
+
+	s.logger.Debug("Username updated successfully",
+		zap.String("user_id", id),
+		zap.String("username", username))
+
+	// Map to service layer user
+	return fromRepository(user), nil
 }
 
 // DeleteUser deletes a user by ID
@@ -134,8 +399,8 @@ func (s *userService) DeleteUser(ctx context.Context, id string) error {
 	return nil
 }
 
-// ListUsers returns a list of users
-func (s *userService) ListUsers(ctx context.Context, page, pageSize int) ([]*User, int, error) {
+// ListUsers returns a list of users matching the filter, loading only the given columns if any
+func (s *userService) ListUsers(ctx context.Context, filter UserFilter, page, pageSize int, columns ...string) ([]*User, int, error) {
 	// Validate page and pageSize
 	if page < 1 {
 		page = 1
@@ -147,27 +412,28 @@ func (s *userService) ListUsers(ctx context.Context, page, pageSize int) ([]*Use
 	}
 
 	s.logger.Debug("Listing users",
+		zap.Any("filter", filter),
 		zap.Int("page", page),
 		zap.Int("page_size", pageSize))
 
+	// Validate filter
+	repoFilter, err := normalizeFilter(s.cfg.User.CustomFields, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	// Get users
-	users, total, err := s.repo.ListUsers(ctx, page, pageSize)
+	users, total, err := s.repo.ListUsers(ctx, repoFilter, page, pageSize, columns...)
 	if err != nil {
+		if errors.Is(err, database.ErrJSONUnsupported) {
+			return nil, 0, ErrCustomFieldFilterUnsupported
+		}
 		s.logger.Error("Error listing users", zap.Error(err))
 		return nil, 0, err
 	}
 
 	// Map to service layer users
-	result := make([]*User, len(users))
-	for i, user := range users {
-		result[i] = &User{
-			ID:        user.ID,
-			Email:     user.Email,
-			Name:      user.Name,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
-		}
-	}
+	result := fromRepositoryList(users)
 
 	s.logger.Debug("Listed users successfully",
 		zap.Int("count", len(result)),
@@ -175,3 +441,18 @@ func (s *userService) ListUsers(ctx context.Context, page, pageSize int) ([]*Use
 
 	return result, total, nil
 }
+
+// Meter returns the service's usage meter
+func (s *userService) Meter() *metering.Meter {
+	return s.meter
+}
+
+// Revocations returns the store of tokens logged out with the auth service
+func (s *userService) Revocations() revocation.Store {
+	return s.revoked
+}
+
+// Ping checks the service's storage
+func (s *userService) Ping(ctx context.Context) error {
+	return s.repo.Ping(ctx)
+}
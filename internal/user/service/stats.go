@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// ErrPublicStatsDisabled is returned for public stats unless PUBLIC_STATS_ENABLED is set
+var ErrPublicStatsDisabled = apperrors.NotFound("public stats are disabled")
+
+// signupWindow is the period of PublicStats.WeeklySignups
+const signupWindow = 7 * 24 * time.Hour
+
+// PublicStats are usage statistics safe to publish, e.g. on marketing pages.
+// Counts have Laplace noise added and are rounded, so they don't reveal exact
+// counts or whether a given user signed up.
+type PublicStats struct {
+	TotalUsers int
+	// WeeklySignups counts the users created in the last 7 days
+	WeeklySignups int
+	ComputedAt    time.Time
+}
+
+// countFunc counts the users created at or after since, every user for a zero time
+type countFunc func(ctx context.Context, since time.Time) (int, error)
+
+// publicStats serves the same public stats until they expire, after the TTL
+// plus a random jitter. New noise on every request would let callers average
+// it away, so it's only drawn when the stats are computed again.
+type publicStats struct {
+	cfg config.PublicStatsConfig
+
+	mu      sync.Mutex
+	stats   *PublicStats
+	expires time.Time
+}
+
+// get returns the current stats, computing them with count if they expired.
+// Concurrent callers wait for one computation.
+func (p *publicStats) get(ctx context.Context, count countFunc) (*PublicStats, error) {
+	if !p.cfg.Enabled {
+		return nil, ErrPublicStatsDisabled
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.stats != nil && now.Before(p.expires) {
+		return p.stats, nil
+	}
+
+	total, err := count(ctx, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	weekly, err := count(ctx, now.Add(-signupWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	// A user changes both counts by at most 1, each gets half the budget
+	scale := 2 / p.cfg.Epsilon
+	p.stats = &PublicStats{
+		TotalUsers:    roundTo(float64(total)+laplace(scale), p.cfg.UsersRounding),
+		WeeklySignups: roundTo(float64(weekly)+laplace(scale), p.cfg.SignupsRounding),
+		ComputedAt:    now,
+	}
+	p.expires = now.Add(p.cfg.TTL)
+	if p.cfg.Jitter > 0 {
+		p.expires = p.expires.Add(rand.N(p.cfg.Jitter))
+	}
+	return p.stats, nil
+}
+
+// laplace draws from the Laplace distribution centered on 0 with the given
+// scale, the difference of two exponential draws
+func laplace(scale float64) float64 {
+	return scale * (rand.ExpFloat64() - rand.ExpFloat64())
+}
+
+// roundTo rounds a count to the nearest multiple, negative counts to 0
+func roundTo(count float64, multiple int) int {
+	rounded := int(math.Round(count/float64(multiple))) * multiple
+	return max(rounded, 0)
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+)
+
+// usernamePattern allows 3-30 lowercase letters, digits and underscores, starting with a letter
+var usernamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{2,29}$`)
+
+// reservedUsernames can't be claimed because they collide with routes or impersonate staff
+var reservedUsernames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"api":           true,
+	"auth":          true,
+	"help":          true,
+	"login":         true,
+	"logout":        true,
+	"me":            true,
+	"moderator":     true,
+	"null":          true,
+	"register":      true,
+	"root":          true,
+	"security":      true,
+	"settings":      true,
+	"staff":         true,
+	"status":        true,
+	"support":       true,
+	"system":        true,
+	"undefined":     true,
+	"users":         true,
+}
+
+// normalizeUsername validates a username and returns its canonical lowercase form
+func normalizeUsername(username string) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+
+	if !usernamePattern.MatchString(username) || strings.Contains(username, "__") {
+		return "", ErrInvalidUsername
+	}
+
+	if reservedUsernames[username] {
+		return "", ErrReservedUsername
+	}
+
+	return username, nil
+}
@@ -0,0 +1,348 @@
+// Package alerting fires webhooks and PagerDuty events when critical
+// conditions occur too often. Components call Observe for every occurrence of
+// a condition, e.g. a failed database check, and Resolve once it's over. An
+// alert fires when a condition occurs ALERT_THRESHOLDS times within
+// ALERT_WINDOW. Alerting is disabled until Init is called with a target, the
+// functions do nothing until then.
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+var (
+	alerts = metrics.NewCounterVec("alerts_total",
+		"Alerts fired and resolved, by condition and status", "condition", "status")
+	deliveries = metrics.NewCounterVec("alert_deliveries_total",
+		"Alert deliveries by target and outcome", "target", "outcome")
+)
+
+// queueSize is the number of alerts waiting for delivery, alerts raised while
+// it's full are dropped
+const queueSize = 100
+
+// Alert statuses
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// condition describes the alert of a condition
+type condition struct {
+	// summary describes the alert, %s is replaced with the key
+	summary string
+	// severity is a PagerDuty severity: critical, error, warning or info
+	severity string
+	// autoResolve resolves the alert after a window below the threshold,
+	// the alerts of other conditions last until Resolve
+	autoResolve bool
+}
+
+// conditions are the known conditions by name
+var conditions = map[string]condition{
+	config.AlertDependencyFailures:    {summary: "Critical dependency %s is failing its checks", severity: "critical"},
+	config.AlertCircuitOpen:           {summary: "Circuit of HTTP client %s is open, its calls fail fast", severity: "error"},
+	config.AlertTokenValidationErrors: {summary: "Spike of requests with invalid tokens", severity: "warning", autoResolve: true},
+}
+
+// Alert is sent to ALERT_WEBHOOK_URL when it fires and when it resolves
+type Alert struct {
+	Status    string `json:"status"`
+	Condition string `json:"condition"`
+	// Key tells apart alerts of a condition, e.g. the dependency
+	Key         string `json:"key,omitempty"`
+	Summary     string `json:"summary"`
+	Severity    string `json:"severity"`
+	Service     string `json:"service"`
+	Environment string `json:"environment"`
+	Region      string `json:"region,omitempty"`
+	// Source is the instance raising the alert, its hostname
+	Source string `json:"source"`
+	// Count is the number of occurrences in the window that fired the alert
+	Count      int        `json:"count"`
+	Threshold  int        `json:"threshold"`
+	Window     string     `json:"window"`
+	StartedAt  time.Time  `json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// dedupKey identifies the alert across its firing and resolution
+func (a *Alert) dedupKey() string {
+	return strings.Join([]string{a.Service, a.Region, a.Source, a.Condition, a.Key}, "/")
+}
+
+// alerter counts the occurrences of conditions and delivers alerts from a goroutine
+type alerter struct {
+	cfg    *config.AlertingConfig
+	base   Alert
+	client *http.Client
+	logger *zap.Logger
+	queue  chan Alert
+
+	mu     sync.Mutex
+	states map[stateKey]*state
+}
+
+// stateKey identifies the occurrences of a condition for a key
+type stateKey struct {
+	condition string
+	key       string
+}
+
+// state counts the occurrences in the current window
+type state struct {
+	count int
+	// firing is the alert while it fires
+	firing *Alert
+}
+
+// current is the alerter started by Init
+var current atomic.Pointer[alerter]
+
+// Init starts alerting for the service, e.g. "auth". It's disabled without
+// ALERT_WEBHOOK_URL and ALERT_PAGERDUTY_ROUTING_KEY.
+func Init(cfg *config.Config, service string, logger *zap.Logger) {
+	if cfg.Alerting.WebhookURL == "" && cfg.Alerting.PagerDutyRoutingKey == "" {
+		current.Store(nil)
+		return
+	}
+
+	source, _ := os.Hostname()
+	a := &alerter{
+		cfg: &cfg.Alerting,
+		base: Alert{
+			Service:     service,
+			Environment: cfg.Environment,
+			Region:      cfg.Region,
+			Source:      source,
+			Window:      cfg.Alerting.Window.String(),
+		},
+		client: &http.Client{Timeout: cfg.Alerting.Timeout},
+		logger: logger,
+		queue:  make(chan Alert, queueSize),
+		states: make(map[stateKey]*state),
+	}
+	go a.run()
+	go a.rollWindows()
+	current.Store(a)
+
+	enabled := make([]string, 0, len(conditions))
+	for name := range conditions {
+		if cfg.Alerting.Thresholds[name] > 0 {
+			enabled = append(enabled, fmt.Sprintf("%s:%d", name, cfg.Alerting.Thresholds[name]))
+		}
+	}
+	sort.Strings(enabled)
+	logger.Info("Alerting enabled",
+		zap.Bool("webhook", cfg.Alerting.WebhookURL != ""),
+		zap.Bool("pagerduty", cfg.Alerting.PagerDutyRoutingKey != ""),
+		zap.Strings("thresholds", enabled),
+		zap.Duration("window", cfg.Alerting.Window))
+}
+
+// Observe counts an occurrence of a condition for a key, e.g. the name of the
+// failing dependency, firing its alert at the threshold
+func Observe(name, key string) {
+	a := current.Load()
+	if a == nil {
+		return
+	}
+	threshold := a.cfg.Thresholds[name]
+	if threshold <= 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	k := stateKey{condition: name, key: key}
+	st := a.states[k]
+	if st == nil {
+		st = &state{}
+		a.states[k] = st
+	}
+	st.count++
+	if st.firing != nil || st.count < threshold {
+		return
+	}
+
+	alert := a.base
+	alert.Status = StatusFiring
+	alert.Condition = name
+	alert.Key = key
+	alert.Summary = conditions[name].summary
+	if strings.Contains(alert.Summary, "%s") {
+		alert.Summary = fmt.Sprintf(alert.Summary, key)
+	}
+	alert.Severity = conditions[name].severity
+	alert.Count = st.count
+	alert.Threshold = threshold
+	alert.StartedAt = time.Now()
+	st.firing = &alert
+	a.deliver(alert)
+}
+
+// Resolve ends the alert of a condition for a key, if it fires, e.g. once the
+// dependency passes its check again
+func Resolve(name, key string) {
+	a := current.Load()
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	k := stateKey{condition: name, key: key}
+	if st := a.states[k]; st != nil {
+		a.resolve(st)
+		delete(a.states, k)
+	}
+}
+
+// resolve delivers the resolution of a firing alert, the lock must be held
+func (a *alerter) resolve(st *state) {
+	if st.firing == nil {
+		return
+	}
+
+	alert := *st.firing
+	now := time.Now()
+	alert.Status = StatusResolved
+	alert.ResolvedAt = &now
+	st.firing = nil
+	a.deliver(alert)
+}
+
+// deliver queues an alert without blocking, the lock must be held
+func (a *alerter) deliver(alert Alert) {
+	alerts.Inc(alert.Condition, alert.Status)
+	select {
+	case a.queue <- alert:
+	default:
+		deliveries.Inc("queue", "dropped")
+		a.logger.Error("Alert queue full, dropping alert",
+			zap.String("condition", alert.Condition),
+			zap.String("status", alert.Status))
+	}
+}
+
+// rollWindows starts a new window every ALERT_WINDOW, resolving the alerts of
+// spikes that ended
+func (a *alerter) rollWindows() {
+	ticker := time.NewTicker(a.cfg.Window)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		a.mu.Lock()
+		for k, st := range a.states {
+			if st.firing != nil && conditions[k.condition].autoResolve && st.count < a.cfg.Thresholds[k.condition] {
+				a.resolve(st)
+			}
+			st.count = 0
+			if st.firing == nil {
+				delete(a.states, k)
+			}
+		}
+		a.mu.Unlock()
+	}
+}
+
+// run delivers the queued alerts to every target
+func (a *alerter) run() {
+	for alert := range a.queue {
+		a.logger.Warn("Alert "+alert.Status,
+			zap.String("condition", alert.Condition),
+			zap.String("key", alert.Key),
+			zap.String("summary", alert.Summary),
+			zap.Int("count", alert.Count))
+
+		if a.cfg.WebhookURL != "" {
+			a.send("webhook", a.cfg.WebhookURL, alert)
+		}
+		if a.cfg.PagerDutyRoutingKey != "" {
+			a.send("pagerduty", a.cfg.PagerDutyURL, pagerDutyEvent(a.cfg.PagerDutyRoutingKey.Reveal(), &alert))
+		}
+	}
+}
+
+// pagerDutyEvent returns the Events API v2 event of an alert
+func pagerDutyEvent(routingKey string, alert *Alert) map[string]interface{} {
+	event := map[string]interface{}{
+		"routing_key":  routingKey,
+		"event_action": "trigger",
+		"dedup_key":    alert.dedupKey(),
+	}
+	if alert.Status == StatusResolved {
+		event["event_action"] = "resolve"
+		return event
+	}
+
+	event["payload"] = map[string]interface{}{
+		"summary":   fmt.Sprintf("[%s] %s: %s", alert.Environment, alert.Service, alert.Summary),
+		"source":    alert.Source,
+		"severity":  alert.Severity,
+		"timestamp": alert.StartedAt.UTC().Format(time.RFC3339),
+		"component": alert.Service,
+		"group":     alert.Region,
+		"class":     alert.Condition,
+		"custom_details": map[string]interface{}{
+			"key":       alert.Key,
+			"count":     alert.Count,
+			"threshold": alert.Threshold,
+			"window":    alert.Window,
+		},
+	}
+	return event
+}
+
+// send posts a JSON body to a target
+func (a *alerter) send(target, url string, body interface{}) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		deliveries.Inc(target, "failed")
+		a.logger.Error("Failed to encode alert", zap.String("target", target), zap.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(encoded))
+	if err != nil {
+		deliveries.Inc(target, "failed")
+		a.logger.Error("Failed to deliver alert", zap.String("target", target), zap.Error(err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			err = fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(message))
+		}
+	}
+	if err != nil {
+		deliveries.Inc(target, "failed")
+		a.logger.Error("Failed to deliver alert", zap.String("target", target), zap.Error(err))
+		return
+	}
+	deliveries.Inc(target, "success")
+}
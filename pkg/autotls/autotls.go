@@ -0,0 +1,94 @@
+package autotls
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// ErrNoDomains is returned when ACME is enabled without any domains to request certificates for
+var ErrNoDomains = errors.New("ACME_DOMAINS is required when ACME is enabled")
+
+// Manager obtains and renews certificates for the HTTPS gateway from an ACME CA
+// such as Let's Encrypt.
+//
+// Certificates are requested on the first TLS handshake for a configured domain
+// and renewed before they expire. The CA validates domain ownership with the
+// TLS-ALPN-01 challenge on the gateway itself, or with HTTP-01 when the challenge
+// listener is served (see ServeChallenges).
+type Manager struct {
+	manager *autocert.Manager
+	logger  *zap.Logger
+}
+
+// NewManager creates a certificate manager for the configured domains and cache
+func NewManager(cfg *config.Config, logger *zap.Logger) (*Manager, error) {
+	if len(cfg.ACME.Domains) == 0 {
+		return nil, ErrNoDomains
+	}
+
+	cache, err := newCache(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Using ACME certificates",
+		zap.Strings("domains", cfg.ACME.Domains),
+		zap.String("directory", cfg.ACME.DirectoryURL),
+		zap.String("cache", cfg.ACME.Cache))
+
+	return &Manager{
+		manager: &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.ACME.Domains...),
+			Email:      cfg.ACME.Email,
+			Cache:      cache,
+			Client:     &acme.Client{DirectoryURL: cfg.ACME.DirectoryURL},
+		},
+		logger: logger,
+	}, nil
+}
+
+// newCache creates the configured certificate cache
+func newCache(cfg *config.Config, logger *zap.Logger) (autocert.Cache, error) {
+	switch cfg.ACME.Cache {
+	case "dir", "":
+		return autocert.DirCache(cfg.ACME.CacheDir), nil
+	case "database":
+		// Replicas share certificates through the database instead of each requesting their own
+		db, err := database.Open(cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		return newDBCache(db)
+	default:
+		return nil, fmt.Errorf("unsupported ACME cache: %s", cfg.ACME.Cache)
+	}
+}
+
+// TLSConfig returns the TLS configuration for the HTTPS server, answering
+// TLS-ALPN-01 challenges and serving the managed certificates
+func (m *Manager) TLSConfig() *tls.Config {
+	return m.manager.TLSConfig()
+}
+
+// ServeChallenges answers HTTP-01 challenges on the listener and redirects any
+// other request to HTTPS. It blocks until the listener is closed.
+func (m *Manager) ServeChallenges(listener net.Listener) error {
+	m.logger.Info("Serving ACME HTTP-01 challenges", zap.String("address", listener.Addr().String()))
+
+	server := &http.Server{Handler: m.manager.HTTPHandler(nil)}
+	if err := server.Serve(listener); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
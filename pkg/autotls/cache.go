@@ -0,0 +1,62 @@
+package autotls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Certificate is a cached ACME certificate, account key or certificate key
+type Certificate struct {
+	Key       string `gorm:"primaryKey;type:varchar(255)"`
+	Data      []byte `gorm:"type:blob"`
+	UpdatedAt time.Time
+}
+
+// TableName overrides the table name used by Certificate
+func (Certificate) TableName() string {
+	return "acme_certificates"
+}
+
+// dbCache stores certificates in the database so replicas share them
+type dbCache struct {
+	db *gorm.DB
+}
+
+// newDBCache creates a cache backed by the acme_certificates table
+func newDBCache(db *gorm.DB) (autocert.Cache, error) {
+	if err := db.AutoMigrate(&Certificate{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate acme_certificates table: %w", err)
+	}
+	return &dbCache{db: db}, nil
+}
+
+// Get returns the cached data, or autocert.ErrCacheMiss
+func (c *dbCache) Get(ctx context.Context, key string) ([]byte, error) {
+	var certificate Certificate
+	err := c.db.WithContext(ctx).Where("`key` = ?", key).First(&certificate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, autocert.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	return certificate.Data, nil
+}
+
+// Put stores data under the key, replacing existing data
+func (c *dbCache) Put(ctx context.Context, key string, data []byte) error {
+	return c.db.WithContext(ctx).Clauses(clause.OnConflict{
+		UpdateAll: true,
+	}).Create(&Certificate{Key: key, Data: data}).Error
+}
+
+// Delete removes the data stored under the key
+func (c *dbCache) Delete(ctx context.Context, key string) error {
+	return c.db.WithContext(ctx).Where("`key` = ?", key).Delete(&Certificate{}).Error
+}
@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+// ErrCacheNotFound is returned for flushes of caches that aren't registered
+var ErrCacheNotFound = apperrors.NotFound("cache not found")
+
+// Cache metrics, labelled by cache name
+var (
+	hits = metrics.NewCounterVec("cache_hits_total",
+		"Lookups of in-process caches that found a fresh entry", "cache")
+	misses = metrics.NewCounterVec("cache_misses_total",
+		"Lookups of in-process caches that found no fresh entry", "cache")
+	evictions = metrics.NewCounterVec("cache_evictions_total",
+		"Entries removed from in-process caches by reason: size, expired or flush", "cache", "reason")
+	entries = metrics.NewGaugeVec("cache_entries",
+		"Entries held by in-process caches", "cache")
+)
+
+// Stats describes a cache and its usage since the process started
+type Stats struct {
+	Name       string
+	Entries    int
+	MaxEntries int
+	TTL        time.Duration
+	Hits       int64
+	Misses     int64
+	Evictions  int64
+}
+
+// entry is a cached value and its expiry
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// Cache is an in-process LRU cache holding at most a number of entries, each
+// for at most a TTL. The least recently used entry is evicted when the cache is
+// full, expired entries are removed when they are looked up or evicted. A cache
+// with no entries allowed is disabled: lookups miss without being counted and
+// values aren't stored.
+//
+// Caches are registered by name, so their stats are reported and they can be
+// flushed through the CacheService, see Server.
+type Cache[K comparable, V any] struct {
+	name       string
+	maxEntries int
+	ttl        time.Duration
+
+	mu        sync.Mutex
+	items     map[K]*list.Element
+	order     *list.List // most recently used first
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+// New creates and registers a cache with the given limits. It replaces a cache
+// registered with the same name.
+func New[K comparable, V any](name string, limits config.CacheLimits) *Cache[K, V] {
+	c := &Cache[K, V]{
+		name:       name,
+		maxEntries: limits.Size,
+		ttl:        limits.TTL,
+		items:      make(map[K]*list.Element),
+		order:      list.New(),
+	}
+	if c.enabled() {
+		register(c)
+	}
+	return c
+}
+
+// enabled reports whether the cache stores values
+func (c *Cache[K, V]) enabled() bool {
+	return c.maxEntries > 0 && c.ttl > 0
+}
+
+// Name returns the name of the cache
+func (c *Cache[K, V]) Name() string {
+	return c.name
+}
+
+// Get returns the value of a key if it's cached and hasn't expired
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	var zero V
+	if !c.enabled() {
+		return zero, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if ok && time.Now().After(element.Value.(*entry[K, V]).expires) {
+		c.remove(element, "expired")
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		misses.Inc(c.name)
+		return zero, false
+	}
+
+	c.hits++
+	hits.Inc(c.name)
+	c.order.MoveToFront(element)
+	return element.Value.(*entry[K, V]).value, true
+}
+
+// Set caches the value of a key for the cache's TTL, evicting the least
+// recently used entry if the cache is full
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL caches the value of a key for ttl, at most the cache's TTL, e.g.
+// until the value expires. Values with a ttl of 0 or less aren't stored.
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	if !c.enabled() || ttl <= 0 {
+		return
+	}
+	if ttl > c.ttl {
+		ttl = c.ttl
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(ttl)
+	if element, ok := c.items[key]; ok {
+		cached := element.Value.(*entry[K, V])
+		cached.value = value
+		cached.expires = expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	for c.order.Len() >= c.maxEntries {
+		c.remove(c.order.Back(), "size")
+	}
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+	entries.Set(float64(c.order.Len()), c.name)
+}
+
+// Delete removes the value of a key, e.g. after it changed
+func (c *Cache[K, V]) Delete(key K) {
+	if !c.enabled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.order.Remove(element)
+		delete(c.items, key)
+		entries.Set(float64(c.order.Len()), c.name)
+	}
+}
+
+// Flush removes every entry and returns how many there were
+func (c *Cache[K, V]) Flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := c.order.Len()
+	c.items = make(map[K]*list.Element)
+	c.order.Init()
+	c.evictions += int64(count)
+	evictions.Add(float64(count), c.name, "flush")
+	entries.Set(0, c.name)
+	return count
+}
+
+// Stats returns the cache's size, limits and usage
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Name:       c.name,
+		Entries:    c.order.Len(),
+		MaxEntries: c.maxEntries,
+		TTL:        c.ttl,
+		Hits:       c.hits,
+		Misses:     c.misses,
+		Evictions:  c.evictions,
+	}
+}
+
+// remove evicts an entry for the reason, the caller holds the lock
+func (c *Cache[K, V]) remove(element *list.Element, reason string) {
+	c.order.Remove(element)
+	delete(c.items, element.Value.(*entry[K, V]).key)
+	c.evictions++
+	evictions.Inc(c.name, reason)
+	entries.Set(float64(c.order.Len()), c.name)
+}
+
+// registered is a cache of any type in the registry
+type registered interface {
+	Name() string
+	Flush() int
+	Stats() Stats
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]registered)
+)
+
+// register adds a cache to the registry
+func register(c registered) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[c.Name()] = c
+}
+
+// List returns the stats of the registered caches by name
+func List() []Stats {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	stats := make([]Stats, 0, len(registry))
+	for _, c := range registry {
+		stats = append(stats, c.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// Flush removes every entry of a registered cache and returns how many there were
+func Flush(name string) (int, error) {
+	registryMu.Lock()
+	c, ok := registry[name]
+	registryMu.Unlock()
+
+	if !ok {
+		return 0, ErrCacheNotFound
+	}
+	return c.Flush(), nil
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	cachepb "github.com/linkeunid/hello-go/api/gen/cache"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// Authorizer checks that the caller may inspect and flush caches, typically an admin
+type Authorizer func(ctx context.Context) error
+
+// Server implements the CacheService gRPC service on the registered caches
+type Server struct {
+	cachepb.UnimplementedCacheServiceServer
+	service   string
+	authorize Authorizer
+	logger    *zap.Logger
+}
+
+// NewServer creates a CacheService for the registered caches of a service
+func NewServer(service string, authorize Authorizer, logger *zap.Logger) *Server {
+	return &Server{
+		service:   service,
+		authorize: authorize,
+		logger:    logger,
+	}
+}
+
+// ListCaches returns the registered caches and their usage
+func (s *Server) ListCaches(ctx context.Context, req *cachepb.ListCachesRequest) (*cachepb.ListCachesResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	stats := List()
+	caches := make([]*cachepb.CacheStats, len(stats))
+	for i, cache := range stats {
+		caches[i] = &cachepb.CacheStats{
+			Name:       cache.Name,
+			Entries:    int32(cache.Entries),
+			MaxEntries: int32(cache.MaxEntries),
+			Ttl:        cache.TTL.String(),
+			Hits:       cache.Hits,
+			Misses:     cache.Misses,
+			Evictions:  cache.Evictions,
+		}
+	}
+
+	return &cachepb.ListCachesResponse{
+		Service: s.service,
+		Caches:  caches,
+	}, nil
+}
+
+// FlushCache removes every entry of a registered cache
+func (s *Server) FlushCache(ctx context.Context, req *cachepb.FlushCacheRequest) (*cachepb.FlushCacheResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	flushed, err := Flush(req.Name)
+	if err != nil {
+		return nil, apperrors.MapToStatus(err, "failed to flush cache")
+	}
+	s.logger.Info("Cache flushed", zap.String("cache", req.Name), zap.Int("entries", flushed))
+
+	return &cachepb.FlushCacheResponse{Flushed: int32(flushed)}, nil
+}
@@ -0,0 +1,125 @@
+package capture
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/linkeunid/hello-go/pkg/logger"
+)
+
+// anonymizedEmailDomain is the domain of pseudonymized email addresses
+const anonymizedEmailDomain = "anonymized.invalid"
+
+// secretFields are the names of string fields holding secrets, they are replaced with logger.Redacted
+var secretFields = map[protoreflect.Name]bool{
+	"password":      true,
+	"new_password":  true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"client_secret": true,
+	// TOTP secrets, also part of their otpauth:// URI, codes and the login challenge
+	"secret":          true,
+	"uri":             true,
+	"code":            true,
+	"challenge_token": true,
+}
+
+// personalFields are the names of string fields holding personal data, they are
+// replaced with pseudonyms. Email addresses keep the form of an address.
+var personalFields = map[protoreflect.Name]bool{
+	"email":     true,
+	"recipient": true,
+	"name":      true,
+	"username":  true,
+	"query":     true,
+}
+
+// anonymizer removes secrets and personal data from messages. Pseudonyms are
+// keyed hashes, so the same email is captured as the same pseudonym and calls
+// of a user can still be replayed in sequence.
+type anonymizer struct {
+	key []byte
+}
+
+func newAnonymizer(key string) *anonymizer {
+	return &anonymizer{key: []byte(key)}
+}
+
+// message returns an anonymized copy of msg and whether secrets were removed
+func (a *anonymizer) message(msg proto.Message) (proto.Message, bool) {
+	clone := proto.Clone(msg)
+	redacted := a.walk(clone.ProtoReflect())
+	return clone, redacted
+}
+
+// walk anonymizes the fields of a message in place
+func (a *anonymizer) walk(m protoreflect.Message) bool {
+	redacted := false
+	m.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		switch {
+		case field.IsMap():
+			if field.MapValue().Message() != nil {
+				value.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					redacted = a.walk(v.Message()) || redacted
+					return true
+				})
+			}
+		case field.Message() != nil:
+			if field.IsList() {
+				list := value.List()
+				for i := 0; i < list.Len(); i++ {
+					redacted = a.walk(list.Get(i).Message()) || redacted
+				}
+			} else {
+				redacted = a.walk(value.Message()) || redacted
+			}
+		case field.Kind() == protoreflect.StringKind:
+			if secretFields[field.Name()] {
+				redacted = true
+			}
+			if field.IsList() {
+				list := value.List()
+				for i := 0; i < list.Len(); i++ {
+					list.Set(i, protoreflect.ValueOfString(a.value(field.Name(), list.Get(i).String())))
+				}
+			} else {
+				m.Set(field, protoreflect.ValueOfString(a.value(field.Name(), value.String())))
+			}
+		case field.Kind() == protoreflect.BytesKind:
+			// Bytes can't be inspected for secrets, so they are dropped
+			m.Clear(field)
+			redacted = true
+		}
+		return true
+	})
+	return redacted
+}
+
+// value returns the anonymized value of a string field
+func (a *anonymizer) value(name protoreflect.Name, value string) string {
+	switch {
+	case value == "":
+		return value
+	case secretFields[name]:
+		return logger.Redacted
+	case personalFields[name] && strings.Contains(value, "@"):
+		return "anon-" + a.hash(strings.ToLower(value)) + "@" + anonymizedEmailDomain
+	case personalFields[name]:
+		return "anon-" + a.hash(value)
+	default:
+		return value
+	}
+}
+
+// hash returns a shortened keyed hash of a value
+func (a *anonymizer) hash(value string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
@@ -0,0 +1,217 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/logger"
+)
+
+// Record is a captured call, one JSON line of a capture file
+type Record struct {
+	Time    time.Time `json:"time"`
+	Service string    `json:"service"`
+	// Method is the full gRPC method name
+	Method string `json:"method"`
+	// Request and Response are the anonymized messages in protojson, the response
+	// is empty for failed calls
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response,omitempty"`
+	// Code is the gRPC status code, e.g. "OK" or "NotFound"
+	Code          string `json:"code"`
+	LatencyMicros int64  `json:"latency_micros"`
+	// Redacted is set when secrets such as passwords were removed from the
+	// request, so replaying it can't give the same result
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// Recorder writes anonymized calls to a capture file in CAPTURE_DIR, named
+// after the service, start time and process. A nil recorder captures nothing.
+type Recorder struct {
+	service    string
+	ratio      float64
+	methods    map[string]bool
+	maxRecords int
+	anonymizer *anonymizer
+	path       string
+	logger     *zap.Logger
+
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	records int
+}
+
+// NewRecorder creates a recorder for a service, or returns nil when capturing is disabled
+func NewRecorder(cfg *config.Config, service string, logger *zap.Logger) (*Recorder, error) {
+	if cfg.Capture.Dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(cfg.Capture.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s-%d.jsonl", service, time.Now().UTC().Format("20060102T150405Z"), os.Getpid())
+	path := filepath.Join(cfg.Capture.Dir, name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture file: %w", err)
+	}
+
+	var methods map[string]bool
+	if len(cfg.Capture.Methods) > 0 {
+		methods = make(map[string]bool, len(cfg.Capture.Methods))
+		for _, method := range cfg.Capture.Methods {
+			methods[method] = true
+		}
+	}
+
+	if cfg.Privacy.PseudonymKey == "" {
+		logger.Warn("PSEUDONYM_KEY is not set, captured pseudonyms are unkeyed hashes")
+	}
+	logger.Info("Capturing gRPC traffic",
+		zap.String("file", path),
+		zap.Float64("sample_ratio", cfg.Capture.SampleRatio),
+		zap.Strings("methods", cfg.Capture.Methods))
+
+	return &Recorder{
+		service:    service,
+		ratio:      cfg.Capture.SampleRatio,
+		methods:    methods,
+		maxRecords: cfg.Capture.MaxRecords,
+		anonymizer: newAnonymizer(cfg.Privacy.PseudonymKey.Reveal()),
+		path:       path,
+		logger:     logger,
+		file:       file,
+		writer:     bufio.NewWriter(file),
+	}, nil
+}
+
+// Sampled reports whether a call of the method should be captured
+func (r *Recorder) Sampled(method string) bool {
+	if r == nil {
+		return false
+	}
+	if r.methods != nil && !r.methods[method] {
+		return false
+	}
+	return r.ratio >= 1 || rand.Float64() < r.ratio
+}
+
+// Capture anonymizes and writes a call. Calls whose messages aren't protos are skipped.
+func (r *Recorder) Capture(method string, req, resp interface{}, err error, latency time.Duration) {
+	if r == nil {
+		return
+	}
+	reqMsg, ok := req.(proto.Message)
+	if !ok {
+		return
+	}
+
+	record := Record{
+		Time:          time.Now().UTC(),
+		Service:       r.service,
+		Method:        method,
+		Code:          status.Code(err).String(),
+		LatencyMicros: latency.Microseconds(),
+	}
+
+	var marshalErr error
+	anonymized, redacted := r.anonymizer.message(reqMsg)
+	record.Redacted = redacted
+	record.Request, marshalErr = protojson.Marshal(anonymized)
+	if respMsg, ok := resp.(proto.Message); ok && err == nil && marshalErr == nil {
+		anonymized, _ = r.anonymizer.message(respMsg)
+		record.Response, marshalErr = protojson.Marshal(anonymized)
+	}
+	if marshalErr != nil {
+		r.logger.Error("Failed to encode captured call", zap.String("method", method), zap.Error(marshalErr))
+		return
+	}
+
+	line, marshalErr := json.Marshal(record)
+	if marshalErr != nil {
+		r.logger.Error("Failed to encode captured call", zap.String("method", method), zap.Error(marshalErr))
+		return
+	}
+	// Secrets that aren't in known fields, e.g. tokens in free text, are masked as in logs
+	line = []byte(logger.Scrub(string(line)))
+	if !json.Valid(line) {
+		r.logger.Error("Captured call isn't valid JSON once scrubbed", zap.String("method", method))
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.writer == nil || r.records >= r.maxRecords {
+		return
+	}
+	if _, writeErr := r.writer.Write(append(line, '\n')); writeErr != nil {
+		r.logger.Error("Failed to write captured call", zap.Error(writeErr))
+		return
+	}
+	r.records++
+	if r.records == r.maxRecords {
+		r.logger.Warn("Capture file is full, no more calls are captured",
+			zap.String("file", r.path),
+			zap.Int("records", r.records))
+	}
+}
+
+// Close flushes and closes the capture file
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.writer == nil {
+		return nil
+	}
+	err := r.writer.Flush()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.writer = nil
+	r.logger.Info("Captured gRPC traffic", zap.String("file", r.path), zap.Int("records", r.records))
+	return err
+}
+
+// ReadFile reads the records of a capture file
+func ReadFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	decoder := json.NewDecoder(file)
+	for {
+		var record Record
+		if err := decoder.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, fmt.Errorf("invalid capture record %d in %s: %w", len(records)+1, path, err)
+		}
+		records = append(records, record)
+	}
+}
@@ -2,40 +2,210 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 	"time"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Environment      string
+	Environment string
+	// Profile is the deployment profile whose defaults were applied, see Profile
+	Profile string
+	// Region is the region the instance runs in, e.g. "eu-west-1", empty for single-region deployments
+	Region           string
 	Auth             AuthConfig
 	User             UserConfig
 	Database         DatabaseConfig
 	Logging          LoggingConfig
+	Tracing          TracingConfig
 	ServiceDiscovery ServiceDiscoveryConfig
+	Retention        RetentionConfig
+	Backup           BackupConfig
+	Events           EventsConfig
+	CDC              CDCConfig
+	Status           StatusConfig
+	Privacy          PrivacyConfig
+	Startup          StartupConfig
+	Restart          RestartConfig
+	AddressReport    AddressReportConfig
+	Mesh             MeshConfig
+	SIEM             SIEMConfig
+	ACME             ACMEConfig
+	SPIFFE           SPIFFEConfig
+	Callers          CallersConfig
+	Redis            RedisConfig
+	Jobs             JobsConfig
+	Mail             MailConfig
+	Cache            CacheConfig
+	HTTPClient       HTTPClientConfig
+	Reconcile        ReconcileConfig
+	Presence         PresenceConfig
+	PublicStats      PublicStatsConfig
+	Tenancy          TenancyConfig
+	Metering         MeteringConfig
+	FlightRecorder   FlightRecorderConfig
+	LocalCache       LocalCacheConfig
+	Capture          CaptureConfig
+	ReadOnly         ReadOnlyConfig
+	LoginRateLimit   LoginRateLimitConfig
+	WebAuthn         WebAuthnConfig
+	Sentry           SentryConfig
+	Alerting         AlertingConfig
+	SLO              SLOConfig
 }
 
 // AuthConfig holds configuration specific to the Auth service
 type AuthConfig struct {
-	ServicePort   int
-	GRPCPort      int
-	JWTSecret     string
-	JWTExpiration time.Duration
+	ServicePort int
+	GRPCPort    int
+	JWTSecret   Secret
+	// PreviousJWTSecret is the HS256 secret being rotated out, tokens signed with it are still accepted
+	PreviousJWTSecret Secret
+	JWTExpiration     time.Duration
+	// SigningAlgorithm signs tokens: HS256 with JWTSecret, or RS256 or ES256
+	// with SigningKeyFile, whose public key is published as JWKS
+	SigningAlgorithm string
+	// SigningKeyFile is the PEM private key of RS256 and ES256, generated on
+	// start when unset, which needs JWKSURL so other services can validate tokens
+	SigningKeyFile string
+	// PreviousSigningKeyFile is the PEM private key being rotated out. It's
+	// published as JWKS with the current one and only verifies tokens.
+	PreviousSigningKeyFile string
+	// Issuer is the "iss" claim of issued tokens and the issuer in the OIDC discovery document
+	Issuer string
+	// JWKSURL makes services validate tokens with the keys published there
+	// instead of JWTSecret, e.g. "http://auth:8081/.well-known/jwks.json"
+	JWKSURL string
+	// RefreshTokenExpiration is the lifetime of a refresh token, each refresh issues a new one
+	RefreshTokenExpiration time.Duration
+	// ClientTokenExpiration is the lifetime of tokens issued to service accounts
+	ClientTokenExpiration time.Duration
+	// TokenExpirationByRole and TokenExpirationByClient set the lifetime of user
+	// tokens by the user's role, e.g. "admin", and the client type the user
+	// logged in with, ClientWeb or ClientMobile. The shortest applicable lifetime
+	// wins, JWTExpiration applies when none does.
+	TokenExpirationByRole   map[string]time.Duration
+	TokenExpirationByClient map[string]time.Duration
+	// TokenEncryptionKey encrypts issued tokens (JWE) when set, so their claims can't be read
+	TokenEncryptionKey Secret
+	// RegistrationMode is one of RegistrationOpen, RegistrationApproval, RegistrationInvite or RegistrationClosed
+	RegistrationMode string
+	// InviteExpiration is the lifetime of invite codes
+	InviteExpiration time.Duration
+	// InviteURL is the page invite emails link to, the code is appended as "code" query parameter
+	InviteURL string
+	// ClientPoolSize is the number of connections clients open to the auth service
+	ClientPoolSize int
+	// ClientServiceConfig is a gRPC service config file replacing the client's default timeouts and retries
+	ClientServiceConfig string
+	// GRPCListen and HTTPListen override the listen addresses, see ListenAddress
+	GRPCListen string
+	HTTPListen string
+	// MetricsPort serves Prometheus metrics on /metrics, 0 disables it
+	MetricsPort int
+	// GRPCAddress is the gRPC target clients dial, e.g. "unix:/run/hello/auth.sock"
+	GRPCAddress string
+	// RevocationBackend stores logged out tokens until they expire: database (revoked_tokens table) or redis
+	RevocationBackend string
+	// PasswordResetExpiration is the lifetime of password reset tokens
+	PasswordResetExpiration time.Duration
+	// PasswordResetURL is the page reset emails link to, the token is appended as "token" query parameter
+	PasswordResetURL string
+	// RecoveryEmailExpiration is the lifetime of the links verifying recovery emails
+	RecoveryEmailExpiration time.Duration
+	// RecoveryEmailURL is the page recovery email verifications link to, the token is appended as "token" query parameter
+	RecoveryEmailURL string
+	// StepUpMaxAge is how long after entering their credentials users may call
+	// sensitive methods, like deleting their account, 0 to not require it
+	StepUpMaxAge time.Duration
+	// MFAIssuer names the service in authenticator apps
+	MFAIssuer string
+	// MFAChallengeExpiration is how long users have to enter their code after the password at login
+	MFAChallengeExpiration time.Duration
+	// ImpersonationExpiration is the lifetime of the tokens admins obtain for other users
+	ImpersonationExpiration time.Duration
+	// PasswordHashing hashes user passwords
+	PasswordHashing PasswordHashingConfig
+}
+
+// PasswordHashingConfig holds how user passwords are hashed
+type PasswordHashingConfig struct {
+	// Algorithm hashes new passwords, PasswordBcrypt or PasswordArgon2id.
+	// Passwords hashed with another algorithm or parameters are rehashed when
+	// their user logs in.
+	Algorithm  string
+	BcryptCost int
+	// Argon2Memory is the memory argon2id uses in KiB, Argon2Iterations its
+	// passes over it and Argon2Parallelism its threads
+	Argon2Memory      int
+	Argon2Iterations  int
+	Argon2Parallelism int
 }
 
+// Password hashing algorithms
+const (
+	PasswordBcrypt   = "bcrypt"
+	PasswordArgon2id = "argon2id"
+)
+
+// Client types of user tokens, service accounts get ClientTokenExpiration
+const (
+	ClientWeb    = "web"
+	ClientMobile = "mobile"
+)
+
+// Registration modes
+const (
+	// RegistrationOpen lets anyone register and log in immediately
+	RegistrationOpen = "open"
+	// RegistrationApproval creates pending accounts that an admin has to approve
+	RegistrationApproval = "approval"
+	// RegistrationInvite lets only invited emails register, by accepting their invite
+	RegistrationInvite = "invite"
+	// RegistrationClosed disables self-registration
+	RegistrationClosed = "closed"
+)
+
 // UserConfig holds configuration specific to the User service
 type UserConfig struct {
 	ServicePort int
 	GRPCPort    int
+	// UsernameHoldPeriod is how long a released username stays reserved for its previous owner
+	UsernameHoldPeriod time.Duration
+	// GRPCListen and HTTPListen override the listen addresses, see ListenAddress
+	GRPCListen string
+	HTTPListen string
+	// MetricsPort serves Prometheus metrics on /metrics, 0 disables it
+	MetricsPort int
+	// ReadReplicas are host:port addresses of read replicas of DB_*, reads go to the primary if empty
+	ReadReplicas []string
+	// ConsistencyWindow is how long a consistency token routes reads to the primary, at least the replication lag
+	ConsistencyWindow time.Duration
+	// CustomFields are the types of the deployment's custom user fields by name, e.g. "department" -> "string"
+	CustomFields map[string]string
+	// Projection keeps the users table up to date with the auth service's events
+	Projection bool
+	// EventsDatabase is the database with the auth service's events table, defaults to DB_*
+	EventsDatabase DatabaseConfig
 }
 
+// Custom user field types
+const (
+	CustomFieldString = "string"
+	CustomFieldNumber = "number"
+	CustomFieldBool   = "bool"
+	// CustomFieldDate values are "YYYY-MM-DD" strings
+	CustomFieldDate = "date"
+)
+
 // DatabaseConfig holds configuration for the database connection
 type DatabaseConfig struct {
 	Driver   string
 	Host     string
 	Port     int
 	User     string
-	Password string
+	Password Secret
 	DBName   string
 	Params   string
 }
@@ -43,11 +213,550 @@ type DatabaseConfig struct {
 // LoggingConfig holds configuration for logging
 type LoggingConfig struct {
 	Level string
+	// Levels overrides Level for named loggers and their children, e.g. "gorm": "warn"
+	Levels map[string]string
+	// ScrubSecrets masks JWTs, bearer tokens, DSN passwords and API keys in log entries
+	ScrubSecrets bool
+	// Payloads selects the requests whose payloads are logged, see the LogPayloads constants
+	Payloads string
+	// DebugKey verifies the X-Debug-Token headers that enable payload logging for a request
+	DebugKey Secret
+	// Sampling limits the entries logged per second with the same level and
+	// message, SamplingByLevel overrides it for levels, e.g. "debug"
+	Sampling        LogSampling
+	SamplingByLevel map[string]LogSampling
+	// MaxPerSecond caps the entries written per second over every logger, 0 disables the cap
+	MaxPerSecond int
+	// SQLLevel is the GORM log level: silent, error, warn or info. It can be changed at runtime.
+	SQLLevel string
+	// SQLSlowThreshold is the duration above which queries are logged as slow, 0 disables
+	// slow query logs. It can be changed at runtime.
+	SQLSlowThreshold time.Duration
+	// SQLExplainRatio is the fraction of slow queries whose plan is logged with them,
+	// 0 disables EXPLAINs. It can be changed at runtime.
+	SQLExplainRatio float64
+}
+
+// LogSampling logs the first Initial entries with the same level and message
+// every second, then every Thereafter-th. An Initial of 0 disables sampling, a
+// Thereafter of 0 drops every entry after the first ones.
+type LogSampling struct {
+	Initial    int
+	Thereafter int
+}
+
+// Requests whose payloads are logged
+const (
+	// LogPayloadsAll logs the payloads of every request at debug level
+	LogPayloadsAll = "all"
+	// LogPayloadsSampled logs the payloads of sampled traces and of requests with a
+	// valid X-Debug-Token, whatever the log level
+	LogPayloadsSampled = "sampled"
+	// LogPayloadsNone never logs payloads
+	LogPayloadsNone = "none"
+)
+
+// TracingConfig holds configuration for W3C trace context handling and the
+// export of telemetry
+type TracingConfig struct {
+	// SampleRatio is the fraction of traces started by the services that are sampled,
+	// traces continued from a caller keep the caller's decision
+	SampleRatio float64
+	// BaggageKeys are the W3C baggage entries kept from callers, logged with
+	// every request and forwarded to downstream calls, e.g. "tenant"
+	BaggageKeys []string
+	// LogExport ships log entries to Loki or an OTLP collector besides standard output
+	LogExport LogExportConfig
+}
+
+// LogExportConfig holds configuration for shipping logs without a node-level agent
+type LogExportConfig struct {
+	// Exporter is one of the LogExporter constants
+	Exporter string
+	// Endpoint is the push URL, e.g. "http://loki:3100/loki/api/v1/push" or
+	// "http://otel-collector:4318/v1/logs"
+	Endpoint string
+	// Headers are sent with every push, e.g. Authorization or Loki's X-Scope-OrgID
+	Headers map[string]Secret
+	// Labels are added to every entry, as Loki stream labels or OTLP resource attributes
+	Labels map[string]string
+	// BatchSize is the maximum number of entries per push
+	BatchSize int
+	// FlushInterval is how long entries wait for a batch to fill up
+	FlushInterval time.Duration
+	// QueueSize is the number of entries buffered while pushes are slow or
+	// failing, entries logged while it's full are dropped
+	QueueSize int
+	// Timeout bounds each push, and flushing the queue on shutdown
+	Timeout time.Duration
 }
 
+// Log exporters
+const (
+	LogExporterNone = "none"
+	// LogExporterLoki pushes to Loki's /loki/api/v1/push
+	LogExporterLoki = "loki"
+	// LogExporterOTLP pushes to an OTLP/HTTP logs endpoint, with JSON encoding
+	LogExporterOTLP = "otlp"
+)
+
 // ServiceDiscoveryConfig holds configuration for service discovery
 type ServiceDiscoveryConfig struct {
+	// Backend is DiscoveryConsul or DiscoveryDNS
+	Backend string
+	// URL is the address of the Consul agent, e.g. "localhost:8500"
 	URL string
+	// Register registers the services' listeners with the Consul agent while they run
+	Register bool
+	// AdvertiseHost is the host registered for the services, the host name if empty
+	AdvertiseHost string
+}
+
+// Service discovery backends
+const (
+	// DiscoveryConsul finds services through the Consul agent at URL
+	DiscoveryConsul = "consul"
+	// DiscoveryDNS finds services by their DNS names, e.g. Kubernetes services
+	DiscoveryDNS = "dns"
+)
+
+// RetentionConfig holds configuration for the data retention job
+type RetentionConfig struct {
+	Enabled          bool
+	Interval         time.Duration
+	DryRun           bool
+	MetricsPort      int
+	LoginHistoryDays int
+	AuditLogDays     int
+	DeletedUserDays  int
+	ExpiredTokenDays int
+}
+
+// BackupConfig holds configuration for database backups
+type BackupConfig struct {
+	Tables        []string
+	EncryptionKey Secret
+	S3            S3Config
+}
+
+// S3Config holds configuration for an S3-compatible object store
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey Secret
+}
+
+// EventsConfig holds configuration for the event bus
+type EventsConfig struct {
+	Backend string
+	// PollInterval is how often subscribers check the events table for new events
+	PollInterval time.Duration
+	// BatchSize is the number of events a subscriber reads at a time
+	BatchSize int
+}
+
+// CDCConfig holds configuration for change data capture
+type CDCConfig struct {
+	// Mode is CDCBinlog or CDCSnapshot
+	Mode string
+	// ServerID identifies the binlog listener to MySQL, unique among its replicas
+	ServerID int
+	// Interval is how often the snapshot fallback reads the tables in full
+	Interval time.Duration
+	// BatchSize is how many rows and snapshots the snapshot fallback reads at a time
+	BatchSize int
+}
+
+// Change data capture modes
+const (
+	// CDCBinlog streams MySQL's row-based binary log as a replica
+	CDCBinlog = "binlog"
+	// CDCSnapshot diffs the watched tables against snapshots, the fallback
+	// for databases without a binlog
+	CDCSnapshot = "snapshot"
+)
+
+// StatusConfig holds configuration for dependency health checks
+type StatusConfig struct {
+	CheckTimeout    time.Duration
+	DegradedLatency time.Duration
+}
+
+// StartupConfig holds configuration for the startup preflight
+type StartupConfig struct {
+	// Strict refuses to start while a critical dependency is unavailable
+	Strict bool
+	// PreflightTimeout is how long to wait for critical dependencies
+	PreflightTimeout time.Duration
+}
+
+// MeshConfig holds configuration for running in a service mesh
+type MeshConfig struct {
+	// XDSCredentials lets the xDS control plane configure mTLS for xds:/// targets
+	XDSCredentials bool
+}
+
+// SIEMConfig holds configuration for the security event stream
+type SIEMConfig struct {
+	// Sink is where security events are written: none, file, syslog or kafka
+	Sink string
+	// File is the path events are appended to with the file sink
+	File string
+	// SyslogNetwork and SyslogAddress locate the syslog daemon, the local one if empty
+	SyslogNetwork string
+	SyslogAddress string
+	// KafkaBrokers and KafkaTopic configure the kafka sink
+	KafkaBrokers []string
+	KafkaTopic   string
+}
+
+// ACMEConfig holds configuration for automatic HTTPS certificates from an ACME CA
+type ACMEConfig struct {
+	// Enabled serves the gateways over HTTPS with certificates from the CA
+	Enabled bool
+	// Domains are the host names certificates may be requested for
+	Domains []string
+	// Email is the contact address for the CA account, e.g. for expiry notices
+	Email string
+	// DirectoryURL is the CA's directory, Let's Encrypt production by default
+	DirectoryURL string
+	// Cache is where certificates are stored: dir or database
+	Cache    string
+	CacheDir string
+	// HTTPChallengeAddress serves HTTP-01 challenges, e.g. ":80"; empty uses TLS-ALPN-01 only
+	HTTPChallengeAddress string
+}
+
+// SPIFFEConfig holds configuration for service-to-service mTLS with SPIFFE identities
+type SPIFFEConfig struct {
+	// Enabled secures the gRPC servers and the auth client with SVIDs from the Workload API
+	Enabled bool
+	// EndpointSocket is the Workload API address, e.g. "unix:///run/spire/agent.sock"
+	EndpointSocket string
+	// AuthID is the SPIFFE ID the auth service must present to the auth client
+	AuthID string
+	// AllowedIDs are the SPIFFE IDs allowed to call this service's gRPC server
+	AllowedIDs []string
+}
+
+// CallersConfig holds configuration for restricting internal RPCs to known callers
+type CallersConfig struct {
+	// Allowlist maps full method names, or prefixes ending in "*", to the caller identities allowed to call them
+	Allowlist map[string][]string
+	// APIKeys maps caller names to the API keys they identify with
+	APIKeys map[string]Secret
+	// ClientAPIKey is the API key this service identifies with when calling other services
+	ClientAPIKey Secret
+}
+
+// MailConfig holds configuration for sending emails
+type MailConfig struct {
+	// Driver sends the emails: smtp, or log to only log them
+	Driver       string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword Secret
+	// From is the sender address of every email
+	From string
+	// DefaultLocale is used when neither the recipient nor the request has a translated template
+	DefaultLocale string
+}
+
+// CacheConfig holds the Cache-Control policies of REST responses
+type CacheConfig struct {
+	// Policies maps routes, e.g. "GET /api/v1/users/{id}", to the Cache-Control header of their responses
+	Policies map[string]string
+	// DefaultPolicy is the Cache-Control header of routes without a policy, none if empty
+	DefaultPolicy string
+}
+
+// HTTPClientConfig holds the defaults of clients calling external HTTP services
+type HTTPClientConfig struct {
+	// Timeout bounds every attempt of a request
+	Timeout time.Duration
+	// MaxAttempts is how often idempotent requests are tried on network errors and 429, 502, 503 and 504
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry, it doubles with every attempt
+	RetryBackoff time.Duration
+	// MaxBackoff caps the delay between retries
+	MaxBackoff time.Duration
+	// BreakerThreshold is the number of consecutive failures that opens a client's circuit, 0 disables it
+	BreakerThreshold int
+	// BreakerCooldown is how long an open circuit rejects requests before trying again
+	BreakerCooldown time.Duration
+}
+
+// ReconcileConfig holds configuration for the consistency check of the auth and user stores
+type ReconcileConfig struct {
+	// AuthDatabase and UserDatabase are the databases of the services, both default to DB_*
+	AuthDatabase DatabaseConfig
+	UserDatabase DatabaseConfig
+	// SourceOfTruth is the store repairs copy from: auth or user
+	SourceOfTruth string
+	// BatchSize is the number of users read from each store at a time
+	BatchSize int
+}
+
+// Reconcile sources of truth
+const (
+	SourceOfTruthAuth = "auth"
+	SourceOfTruthUser = "user"
+)
+
+// PresenceConfig holds configuration for showing whether users are online
+type PresenceConfig struct {
+	Enabled bool
+	// OnlineWindow is how long after their last request a user counts as online
+	OnlineWindow time.Duration
+	// UpdateInterval is the least time between two writes of a user's last seen time
+	UpdateInterval time.Duration
+	// DefaultVisibility applies to users without a visibility of their own: everyone or nobody
+	DefaultVisibility string
+}
+
+// PublicStatsConfig holds configuration for the unauthenticated usage statistics
+// of marketing pages
+type PublicStatsConfig struct {
+	Enabled bool
+	// TTL is how long stats are served before they're computed again, plus up
+	// to Jitter so instances don't refresh together
+	TTL    time.Duration
+	Jitter time.Duration
+	// Epsilon is the differential privacy budget of every computation, lower
+	// values add more noise to the counts
+	Epsilon float64
+	// UsersRounding and SignupsRounding are the multiples the noisy counts are
+	// rounded to
+	UsersRounding   int
+	SignupsRounding int
+}
+
+// Presence visibilities, the user themselves and admins always see their presence
+const (
+	PresenceEveryone = "everyone"
+	PresenceNobody   = "nobody"
+)
+
+// MeteringConfig holds configuration for API usage metering
+type MeteringConfig struct {
+	Enabled bool
+	// FlushInterval is how often usage aggregated in memory is written to the usage_records table
+	FlushInterval time.Duration
+	// ExportURL receives every flushed batch of usage as a JSON POST when set
+	ExportURL string
+}
+
+// FlightRecorderConfig holds configuration for the buffer of recent requests
+type FlightRecorderConfig struct {
+	// Size is the number of recent requests kept per service, 0 disables the recorder
+	Size int
+}
+
+// CaptureConfig holds configuration for capturing gRPC traffic for replays
+type CaptureConfig struct {
+	// Dir receives a file of anonymized calls per process, capturing is disabled if empty
+	Dir string
+	// SampleRatio is the fraction of calls captured
+	SampleRatio float64
+	// Methods limits capturing to these full method names, all methods if empty
+	Methods []string
+	// MaxRecords stops capturing after this many calls per process
+	MaxRecords int
+}
+
+// TenancyConfig holds configuration for hosting several customers, i.e.
+// tenants, on one deployment
+type TenancyConfig struct {
+	// Enabled scopes users to the tenant of the request, see TenantHeader in
+	// pkg/middleware. Without it every user is in DefaultTenant.
+	Enabled bool
+}
+
+// DefaultTenant is the tenant of users created without one, e.g. before
+// tenancy was enabled, and of requests that don't name a tenant
+const DefaultTenant = "default"
+
+// ReadOnlyConfig holds configuration for serving reads only, e.g. against a DR replica
+type ReadOnlyConfig struct {
+	// Enabled rejects mutations at startup, admins can change it at runtime
+	Enabled bool
+	// Reason is shown to admins checking the mode, e.g. "failover drill"
+	Reason string
+}
+
+// LoginRateLimitConfig holds the limits of Login and Register calls, which
+// slow down password guessing and mass registrations
+type LoginRateLimitConfig struct {
+	// PerIP and PerEmail are the calls allowed per Window by client IP and by
+	// email, 0 disables a limit
+	PerIP    int
+	PerEmail int
+	Window   time.Duration
+	// Backend counts calls: memory, per instance, or redis, shared by every instance
+	Backend string
+	// TrustedProxies is the number of proxies in front of the gateway appending
+	// to X-Forwarded-For, the client IP is the address they received the call from
+	TrustedProxies int
+}
+
+// WebAuthnConfig holds the relying party of passkeys and security keys
+type WebAuthnConfig struct {
+	// RPID is the domain credentials are scoped to, e.g. "example.com", it must
+	// be the domain of the origins or a parent of it
+	RPID string
+	// RPName is the name authenticators show when registering
+	RPName string
+	// Origins are the origins of the pages allowed to register and log in, e.g. "https://app.example.com"
+	Origins []string
+	// Timeout is how long users have to complete a ceremony
+	Timeout time.Duration
+}
+
+// SentryConfig holds configuration for reporting crashes to Sentry or a
+// compatible service, e.g. GlitchTip
+type SentryConfig struct {
+	// DSN is the project's client key URL, e.g. "https://<key>@o1.ingest.sentry.io/<project>",
+	// reporting is disabled without it
+	DSN Secret
+	// Environment tags events, e.g. "production"
+	Environment string
+	// Release tags events, the build version by default
+	Release string
+	// SampleRate is the fraction of recovered panics and fatal log entries reported
+	SampleRate float64
+	// ErrorSampleRate is the fraction of error log entries reported
+	ErrorSampleRate float64
+	// Timeout bounds each report, and flushing pending reports before exiting
+	Timeout time.Duration
+}
+
+// AlertingConfig holds configuration for alerts on critical conditions
+type AlertingConfig struct {
+	// WebhookURL receives a JSON object when an alert fires or resolves
+	WebhookURL string
+	// PagerDutyRoutingKey is the integration key of a PagerDuty Events API v2 service
+	PagerDutyRoutingKey Secret
+	// PagerDutyURL is the Events API v2 endpoint
+	PagerDutyURL string
+	// Thresholds are the number of occurrences of each condition within Window
+	// that fire its alert, by condition name, 0 disables a condition. The
+	// defaults depend on the environment.
+	Thresholds map[string]int
+	// Window is the period occurrences are counted in
+	Window time.Duration
+	// Timeout bounds each delivery
+	Timeout time.Duration
+}
+
+// Alert conditions
+const (
+	// AlertDependencyFailures counts failed checks of critical dependencies, e.g. the database
+	AlertDependencyFailures = "dependency_failures"
+	// AlertCircuitOpen counts circuits of outbound HTTP clients opening
+	AlertCircuitOpen = "circuit_open"
+	// AlertTokenValidationErrors counts requests with invalid tokens
+	AlertTokenValidationErrors = "token_validation_errors"
+)
+
+// SLOConfig holds the service level objectives measured for dashboards and burn-rate alerts
+type SLOConfig struct {
+	Objectives []SLObjective
+}
+
+// SLObjective is the share of requests to some methods that must be good,
+// i.e. succeed or fast enough depending on the SLI
+type SLObjective struct {
+	// Name identifies the objective in the metrics, e.g. "login-latency"
+	Name string
+	// Methods are full gRPC method names, "/pkg.Service/*" for every method of
+	// a service or "*" for every method but the gRPC health and reflection ones
+	Methods []string
+	// SLI is SLIAvailability or SLILatency
+	SLI string
+	// Target is the share of good requests, e.g. 0.999
+	Target float64
+	// Threshold is the duration requests must complete within to be good, for SLILatency
+	Threshold time.Duration
+}
+
+// Service level indicators
+const (
+	// SLIAvailability counts requests not failing with a server error as good
+	SLIAvailability = "availability"
+	// SLILatency counts requests completing within the objective's threshold as good
+	SLILatency = "latency"
+)
+
+// LocalCacheConfig holds the limits of the services' in-process caches
+type LocalCacheConfig struct {
+	// Tokens caches the user service's token validations by token hash, until
+	// the token expires. The auth service marks ended sessions for the TTL.
+	Tokens CacheLimits
+	// Counts caches the auth service's user counts by status and role in admin lists
+	Counts CacheLimits
+}
+
+// CacheLimits bounds an in-process cache, a Size or TTL of 0 disables it
+type CacheLimits struct {
+	// Size is the maximum number of entries, the least recently used one is evicted
+	Size int
+	// TTL is how long an entry is kept
+	TTL time.Duration
+}
+
+// RedisConfig holds the connection settings of the Redis server
+type RedisConfig struct {
+	// Address is the host:port of the server
+	Address  string
+	Password Secret
+	DB       int
+}
+
+// JobsConfig holds configuration for the background job queue
+type JobsConfig struct {
+	// Backend stores the queue: database (jobs table) or redis
+	Backend string
+	// Concurrency maps job types to the number of workers processing them
+	Concurrency map[string]int
+	// DefaultConcurrency is the number of workers of job types missing from Concurrency
+	DefaultConcurrency int
+	// MaxAttempts is how often a job is tried before it is dead-lettered
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry, it doubles with every attempt
+	RetryBackoff time.Duration
+	// MaxBackoff caps the delay between retries
+	MaxBackoff time.Duration
+	// PollInterval is how often idle workers check for due jobs
+	PollInterval time.Duration
+	// Lease is how long a worker may run a job before it is handed to another worker
+	Lease time.Duration
+}
+
+// RestartConfig holds configuration for zero-downtime restarts
+type RestartConfig struct {
+	// ReusePort sets SO_REUSEPORT on listeners so several processes can share a port
+	ReusePort bool
+	// UpgradeTimeout is how long a new process may take to become ready on SIGHUP
+	UpgradeTimeout time.Duration
+}
+
+// AddressReportConfig holds where the services report the addresses they listen
+// on, e.g. for tests starting them with port 0
+type AddressReportConfig struct {
+	// File is written with the addresses as JSON once the service is serving
+	File string
+	// Stdout prints the addresses as a JSON line to standard output
+	Stdout bool
+}
+
+// PrivacyConfig holds configuration for anonymizing deleted users
+type PrivacyConfig struct {
+	// PseudonymKey keys the hashes that replace user IDs and emails
+	PseudonymKey Secret
 }
 
 // GetDSN returns the database connection string
@@ -55,16 +764,77 @@ func (c *DatabaseConfig) GetDSN() string {
 	if c.Driver == "mysql" {
 		// MySQL DSN format: username:password@tcp(host:port)/dbname?params
 		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?%s",
-			c.User, c.Password, c.Host, c.Port, c.DBName, c.Params)
+			c.User, c.Password.Reveal(), c.Host, c.Port, c.DBName, c.Params)
 	} else if c.Driver == "postgres" {
 		// PostgreSQL DSN format
 		return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-			c.Host, c.Port, c.User, c.Password, c.DBName)
+			c.Host, c.Port, c.User, c.Password.Reveal(), c.DBName)
 	}
 
 	// Default to MySQL format
 	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?%s",
-		c.User, c.Password, c.Host, c.Port, c.DBName, c.Params)
+		c.User, c.Password.Reveal(), c.Host, c.Port, c.DBName, c.Params)
+}
+
+// ListenAddress returns where a server listens: listen if set, otherwise the TCP port.
+// Besides host:port, listen can be "unix:/path/to.sock" or "systemd:<name>" for a
+// socket passed by systemd socket activation, named by FileDescriptorName.
+func ListenAddress(listen string, port int) string {
+	if listen != "" {
+		return listen
+	}
+	return fmt.Sprintf(":%d", port)
+}
+
+// Listener is a TCP port configured for a service, see Listeners
+type Listener struct {
+	// Service is the name of the service, e.g. "auth"
+	Service string
+	// Name is the name of the listener, e.g. "grpc"
+	Name string
+	// Setting is the env var configuring the port
+	Setting string
+	Port    int
+}
+
+// Listeners returns the TCP ports configured for every service, including those
+// of other services than the running one, so port conflicts can be explained.
+// Unix sockets, systemd sockets and port 0 aren't included.
+func (c *Config) Listeners() []Listener {
+	var listeners []Listener
+	add := func(service, name, listenSetting, listen, portSetting string, port int) {
+		setting := portSetting
+		if listen != "" {
+			_, value, err := net.SplitHostPort(listen)
+			if err != nil {
+				return
+			}
+			if port, err = strconv.Atoi(value); err != nil {
+				return
+			}
+			setting = listenSetting
+		}
+		if port != 0 {
+			listeners = append(listeners, Listener{Service: service, Name: name, Setting: setting, Port: port})
+		}
+	}
+
+	add("auth", "grpc", "AUTH_SERVICE_GRPC_LISTEN", c.Auth.GRPCListen, "AUTH_SERVICE_GRPC_PORT", c.Auth.GRPCPort)
+	add("auth", "http", "AUTH_SERVICE_HTTP_LISTEN", c.Auth.HTTPListen, "AUTH_SERVICE_PORT", c.Auth.ServicePort)
+	add("user", "grpc", "USER_SERVICE_GRPC_LISTEN", c.User.GRPCListen, "USER_SERVICE_GRPC_PORT", c.User.GRPCPort)
+	add("user", "http", "USER_SERVICE_HTTP_LISTEN", c.User.HTTPListen, "USER_SERVICE_PORT", c.User.ServicePort)
+	add("auth", "metrics", "", "", "AUTH_SERVICE_METRICS_PORT", c.Auth.MetricsPort)
+	add("user", "metrics", "", "", "USER_SERVICE_METRICS_PORT", c.User.MetricsPort)
+	add("retention", "metrics", "", "", "RETENTION_METRICS_PORT", c.Retention.MetricsPort)
+	return listeners
+}
+
+// GRPCTarget returns the address clients dial to reach the auth service
+func (c *AuthConfig) GRPCTarget() string {
+	if c.GRPCAddress != "" {
+		return c.GRPCAddress
+	}
+	return fmt.Sprintf("localhost:%d", c.GRPCPort)
 }
 
 // IsDevelopment returns true if the environment is development
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/linkeunid/hello-go/pkg/configcrypt"
+)
+
+// decryptTimeout bounds decrypting the environment, KMS values are decrypted remotely
+const decryptTimeout = 30 * time.Second
+
+// decryptEnv replaces the encrypted values of the environment, e.g. set in the
+// .env file as ENC[age,...] or ENC[kms,...], with their plaintext. age values
+// are decrypted with the identity in CONFIG_IDENTITY or the file at
+// CONFIG_IDENTITY_FILE, which is removed from the environment afterwards. KMS
+// values are decrypted with the AWS credentials of the environment.
+func decryptEnv() error {
+	var names []string
+	schemes := make(map[string][]string)
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if configcrypt.IsEncrypted(value) {
+			names = append(names, name)
+			scheme := configcrypt.Scheme(value)
+			schemes[scheme] = append(schemes[scheme], name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	ctx, cancel := context.WithTimeout(context.Background(), decryptTimeout)
+	defer cancel()
+
+	// Only the keys of the schemes in use are needed
+	var decrypters []configcrypt.Decrypter
+	if vars := schemes[configcrypt.SchemeAge]; len(vars) > 0 {
+		identity, err := configcrypt.IdentityFromEnv()
+		if err != nil {
+			sort.Strings(vars)
+			return fmt.Errorf("%w: %s", err, strings.Join(vars, ", "))
+		}
+		os.Unsetenv("CONFIG_IDENTITY")
+		d, err := configcrypt.NewAgeDecrypter(identity)
+		if err != nil {
+			return err
+		}
+		decrypters = append(decrypters, d)
+	}
+	if len(schemes[configcrypt.SchemeKMS]) > 0 {
+		d, err := configcrypt.NewKMSCipher(ctx, os.Getenv("CONFIG_KMS_KEY_ID"))
+		if err != nil {
+			return err
+		}
+		decrypters = append(decrypters, d)
+	}
+
+	for _, name := range names {
+		plaintext, err := configcrypt.Decrypt(ctx, os.Getenv(name), decrypters...)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", name, err)
+		}
+		os.Setenv(name, plaintext)
+	}
+	return nil
+}
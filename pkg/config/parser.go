@@ -2,13 +2,31 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// customFieldName matches the names of custom user fields, e.g. "hired_on"
+var customFieldName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// regionPattern matches region names, e.g. "eu-west-1"
+var regionPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// sloNamePattern matches the names of service level objectives, e.g. "login-latency"
+var sloNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+
+// tenantPattern matches tenant IDs, e.g. "acme" or a UUID
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,35}$`)
+
+// baggageKeyPattern matches the baggage keys kept from callers, e.g. "client_app"
+var baggageKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,62}$`)
+
 // LoadConfig loads configuration from .env file and environment variables
 func LoadConfig() (*Config, error) {
 	// Load .env file if it exists
@@ -17,6 +35,11 @@ func LoadConfig() (*Config, error) {
 		fmt.Printf("Warning: .env file not found: %v\n", err)
 	}
 
+	// Decrypt the secrets kept encrypted in the .env file or the environment
+	if err := decryptEnv(); err != nil {
+		return nil, err
+	}
+
 	// Get environment
 	environment := getEnv("ENVIRONMENT", "development")
 
@@ -33,43 +56,611 @@ func LoadConfig() (*Config, error) {
 		logLevel = getEnv("LOG_LEVEL", "info")
 	}
 
+	// Profiles replace the local defaults, e.g. of service addresses
+	profile := Profile()
+	if _, ok := profileDefaults[profile]; !ok {
+		return nil, fmt.Errorf("invalid PROFILE %q, expected one of %s", profile, strings.Join(Profiles(), ", "))
+	}
+
 	config := &Config{
 		Environment: environment,
+		Profile:     profile,
+		Region:      getEnv("REGION", ""),
 		Auth: AuthConfig{
-			ServicePort:   getEnvAsInt("AUTH_SERVICE_PORT", 8081),
-			GRPCPort:      getEnvAsInt("AUTH_SERVICE_GRPC_PORT", 9091),
-			JWTSecret:     getEnv("JWT_SECRET", "default-secret-key"),
-			JWTExpiration: getEnvAsDuration("JWT_EXPIRATION", 24*time.Hour),
+			ServicePort:             getEnvAsInt("AUTH_SERVICE_PORT", 8081),
+			GRPCPort:                getEnvAsInt("AUTH_SERVICE_GRPC_PORT", 9091),
+			JWTSecret:               getEnvAsSecret("JWT_SECRET", "default-secret-key"),
+			PreviousJWTSecret:       getEnvAsSecret("JWT_PREVIOUS_SECRET", ""),
+			JWTExpiration:           getEnvAsDuration("JWT_EXPIRATION", 24*time.Hour),
+			SigningAlgorithm:        getEnv("JWT_SIGNING_ALGORITHM", "HS256"),
+			SigningKeyFile:          getEnv("JWT_SIGNING_KEY_FILE", ""),
+			PreviousSigningKeyFile:  getEnv("JWT_PREVIOUS_SIGNING_KEY_FILE", ""),
+			Issuer:                  getEnv("JWT_ISSUER", "http://localhost:8081"),
+			JWKSURL:                 getEnv("JWKS_URL", ""),
+			RefreshTokenExpiration:  getEnvAsDuration("REFRESH_TOKEN_EXPIRATION", 30*24*time.Hour),
+			ClientTokenExpiration:   getEnvAsDuration("CLIENT_TOKEN_EXPIRATION", time.Hour),
+			TokenExpirationByRole:   getEnvAsDurationMap("JWT_EXPIRATION_BY_ROLE"),
+			TokenExpirationByClient: getEnvAsDurationMap("JWT_EXPIRATION_BY_CLIENT"),
+			TokenEncryptionKey:      getEnvAsSecret("JWT_ENCRYPTION_KEY", ""),
+			RegistrationMode:        getEnv("AUTH_REGISTRATION_MODE", RegistrationOpen),
+			InviteExpiration:        getEnvAsDuration("INVITE_EXPIRATION", 7*24*time.Hour),
+			InviteURL:               getEnv("INVITE_URL", "http://localhost:3000/accept-invite"),
+			ClientPoolSize:          getEnvAsInt("AUTH_CLIENT_POOL_SIZE", 4),
+			ClientServiceConfig:     getEnv("AUTH_CLIENT_SERVICE_CONFIG", ""),
+			GRPCListen:              getEnv("AUTH_SERVICE_GRPC_LISTEN", ""),
+			HTTPListen:              getEnv("AUTH_SERVICE_HTTP_LISTEN", ""),
+			MetricsPort:             getEnvAsInt("AUTH_SERVICE_METRICS_PORT", 0),
+			GRPCAddress:             getEnv("AUTH_SERVICE_GRPC_ADDRESS", ""),
+			RevocationBackend:       getEnv("TOKEN_REVOCATION_BACKEND", "database"),
+			PasswordResetExpiration: getEnvAsDuration("PASSWORD_RESET_TOKEN_EXPIRATION", time.Hour),
+			PasswordResetURL:        getEnv("PASSWORD_RESET_URL", "http://localhost:3000/reset-password"),
+			RecoveryEmailExpiration: getEnvAsDuration("RECOVERY_EMAIL_TOKEN_EXPIRATION", 24*time.Hour),
+			RecoveryEmailURL:        getEnv("RECOVERY_EMAIL_URL", "http://localhost:3000/verify-recovery-email"),
+			StepUpMaxAge:            getEnvAsDuration("STEP_UP_MAX_AGE", 5*time.Minute),
+			MFAIssuer:               getEnv("MFA_ISSUER", "hello-go"),
+			MFAChallengeExpiration:  getEnvAsDuration("MFA_CHALLENGE_EXPIRATION", 5*time.Minute),
+			ImpersonationExpiration: getEnvAsDuration("IMPERSONATION_TOKEN_EXPIRATION", 15*time.Minute),
+			PasswordHashing: PasswordHashingConfig{
+				Algorithm:         getEnv("PASSWORD_HASH_ALGORITHM", PasswordBcrypt),
+				BcryptCost:        getEnvAsInt("PASSWORD_BCRYPT_COST", 14),
+				Argon2Memory:      getEnvAsInt("PASSWORD_ARGON2_MEMORY", 64*1024),
+				Argon2Iterations:  getEnvAsInt("PASSWORD_ARGON2_ITERATIONS", 3),
+				Argon2Parallelism: getEnvAsInt("PASSWORD_ARGON2_PARALLELISM", 4),
+			},
 		},
 		User: UserConfig{
-			ServicePort: getEnvAsInt("USER_SERVICE_PORT", 8082),
-			GRPCPort:    getEnvAsInt("USER_SERVICE_GRPC_PORT", 9092),
+			ServicePort:        getEnvAsInt("USER_SERVICE_PORT", 8082),
+			GRPCPort:           getEnvAsInt("USER_SERVICE_GRPC_PORT", 9092),
+			UsernameHoldPeriod: getEnvAsDuration("USERNAME_HOLD_PERIOD", 30*24*time.Hour),
+			GRPCListen:         getEnv("USER_SERVICE_GRPC_LISTEN", ""),
+			HTTPListen:         getEnv("USER_SERVICE_HTTP_LISTEN", ""),
+			MetricsPort:        getEnvAsInt("USER_SERVICE_METRICS_PORT", 0),
+			ReadReplicas:       getEnvAsSlice("USER_DB_READ_REPLICAS", nil),
+			ConsistencyWindow:  getEnvAsDuration("USER_CONSISTENCY_WINDOW", 30*time.Second),
+			CustomFields:       getEnvAsMap("USER_CUSTOM_FIELDS"),
+			Projection:         getEnvAsBool("USER_PROJECTION_ENABLED", false),
 		},
 		Database: DatabaseConfig{
 			Driver:   getEnv("DB_DRIVER", "mysql"),
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     getEnvAsInt("DB_PORT", 3306),
 			User:     getEnv("DB_USER", "root"),
-			Password: getEnv("DB_PASSWORD", "rootpassword"),
+			Password: getEnvAsSecret("DB_PASSWORD", "rootpassword"),
 			DBName:   getEnv("DB_NAME", "microservices"),
 			Params:   getEnv("DB_PARAMS", "charset=utf8mb4&parseTime=True&loc=Local"),
 		},
 		Logging: LoggingConfig{
-			Level: logLevel,
+			Level:  logLevel,
+			Levels: getEnvAsMap("LOG_LEVELS"),
+			Sampling: LogSampling{
+				Initial:    getEnvAsInt("LOG_SAMPLING_INITIAL", 100),
+				Thereafter: getEnvAsInt("LOG_SAMPLING_THEREAFTER", 100),
+			},
+			MaxPerSecond:     getEnvAsInt("LOG_MAX_PER_SECOND", 2000),
+			ScrubSecrets:     getEnvAsBool("LOG_SCRUB_SECRETS", true),
+			Payloads:         getEnv("LOG_PAYLOADS", LogPayloadsAll),
+			DebugKey:         getEnvAsSecret("LOG_DEBUG_KEY", ""),
+			SQLLevel:         getEnv("LOG_SQL_LEVEL", "info"),
+			SQLSlowThreshold: getEnvAsDuration("LOG_SQL_SLOW_THRESHOLD", 200*time.Millisecond),
+			SQLExplainRatio:  getEnvAsFloat("LOG_SQL_EXPLAIN_RATIO", 0),
+		},
+		Tracing: TracingConfig{
+			SampleRatio: getEnvAsFloat("TRACE_SAMPLE_RATIO", 1),
+			BaggageKeys: getEnvAsSlice("TRACE_BAGGAGE_KEYS", []string{"tenant", "client_app", "experiments"}),
+			LogExport: LogExportConfig{
+				Exporter:      getEnv("LOG_EXPORTER", LogExporterNone),
+				Endpoint:      getEnv("LOG_EXPORT_ENDPOINT", ""),
+				Headers:       getEnvAsSecretMap("LOG_EXPORT_HEADERS"),
+				Labels:        getEnvAsMap("LOG_EXPORT_LABELS"),
+				BatchSize:     getEnvAsInt("LOG_EXPORT_BATCH_SIZE", 1000),
+				FlushInterval: getEnvAsDuration("LOG_EXPORT_FLUSH_INTERVAL", time.Second),
+				QueueSize:     getEnvAsInt("LOG_EXPORT_QUEUE_SIZE", 10000),
+				Timeout:       getEnvAsDuration("LOG_EXPORT_TIMEOUT", 10*time.Second),
+			},
 		},
 		ServiceDiscovery: ServiceDiscoveryConfig{
-			URL: getEnv("SERVICE_DISCOVERY_URL", "localhost:8500"),
+			Backend:       getEnv("SERVICE_DISCOVERY_BACKEND", DiscoveryConsul),
+			URL:           getEnv("SERVICE_DISCOVERY_URL", "localhost:8500"),
+			Register:      getEnvAsBool("SERVICE_DISCOVERY_REGISTER", false),
+			AdvertiseHost: getEnv("SERVICE_DISCOVERY_ADVERTISE_HOST", ""),
+		},
+		Retention: RetentionConfig{
+			Enabled:          getEnvAsBool("RETENTION_ENABLED", false),
+			Interval:         getEnvAsDuration("RETENTION_INTERVAL", 24*time.Hour),
+			DryRun:           getEnvAsBool("RETENTION_DRY_RUN", false),
+			MetricsPort:      getEnvAsInt("RETENTION_METRICS_PORT", 0),
+			LoginHistoryDays: getEnvAsInt("RETENTION_LOGIN_HISTORY_DAYS", 90),
+			AuditLogDays:     getEnvAsInt("RETENTION_AUDIT_LOG_DAYS", 365),
+			DeletedUserDays:  getEnvAsInt("RETENTION_DELETED_USER_DAYS", 30),
+			ExpiredTokenDays: getEnvAsInt("RETENTION_EXPIRED_TOKEN_DAYS", 7),
+		},
+		Backup: BackupConfig{
+			Tables:        getEnvAsSlice("BACKUP_TABLES", []string{"users"}),
+			EncryptionKey: getEnvAsSecret("BACKUP_ENCRYPTION_KEY", ""),
+			S3: S3Config{
+				Endpoint:  getEnv("BACKUP_S3_ENDPOINT", ""),
+				Region:    getEnv("BACKUP_S3_REGION", "us-east-1"),
+				Bucket:    getEnv("BACKUP_S3_BUCKET", ""),
+				Prefix:    getEnv("BACKUP_S3_PREFIX", "backups/"),
+				AccessKey: getEnv("BACKUP_S3_ACCESS_KEY", ""),
+				SecretKey: getEnvAsSecret("BACKUP_S3_SECRET_KEY", ""),
+			},
+		},
+		Events: EventsConfig{
+			Backend:      getEnv("EVENTS_BACKEND", "log"),
+			PollInterval: getEnvAsDuration("EVENTS_POLL_INTERVAL", time.Second),
+			BatchSize:    getEnvAsInt("EVENTS_BATCH_SIZE", 100),
+		},
+		CDC: CDCConfig{
+			Mode:      getEnv("CDC_MODE", ""),
+			ServerID:  getEnvAsInt("CDC_SERVER_ID", 1001),
+			Interval:  getEnvAsDuration("CDC_INTERVAL", 30*time.Second),
+			BatchSize: getEnvAsInt("CDC_BATCH_SIZE", 500),
+		},
+		Status: StatusConfig{
+			CheckTimeout:    getEnvAsDuration("STATUS_CHECK_TIMEOUT", 2*time.Second),
+			DegradedLatency: getEnvAsDuration("STATUS_DEGRADED_LATENCY", 500*time.Millisecond),
+		},
+		Startup: StartupConfig{
+			Strict:           getEnvAsBool("STRICT_STARTUP", false),
+			PreflightTimeout: getEnvAsDuration("STARTUP_PREFLIGHT_TIMEOUT", 10*time.Second),
+		},
+		Restart: RestartConfig{
+			ReusePort:      getEnvAsBool("RESTART_REUSE_PORT", false),
+			UpgradeTimeout: getEnvAsDuration("RESTART_UPGRADE_TIMEOUT", 30*time.Second),
+		},
+		AddressReport: AddressReportConfig{
+			File:   getEnv("ADDRESS_REPORT_FILE", ""),
+			Stdout: getEnvAsBool("ADDRESS_REPORT_STDOUT", false),
+		},
+		Mesh: MeshConfig{
+			XDSCredentials: getEnvAsBool("MESH_XDS_CREDENTIALS", false),
+		},
+		SIEM: SIEMConfig{
+			Sink:          getEnv("SIEM_SINK", "none"),
+			File:          getEnv("SIEM_FILE", "security-events.log"),
+			SyslogNetwork: getEnv("SIEM_SYSLOG_NETWORK", ""),
+			SyslogAddress: getEnv("SIEM_SYSLOG_ADDRESS", ""),
+			KafkaBrokers:  getEnvAsSlice("SIEM_KAFKA_BROKERS", nil),
+			KafkaTopic:    getEnv("SIEM_KAFKA_TOPIC", "security-events"),
+		},
+		ACME: ACMEConfig{
+			Enabled:              getEnvAsBool("ACME_ENABLED", false),
+			Domains:              getEnvAsSlice("ACME_DOMAINS", nil),
+			Email:                getEnv("ACME_EMAIL", ""),
+			DirectoryURL:         getEnv("ACME_DIRECTORY_URL", "https://acme-v02.api.letsencrypt.org/directory"),
+			Cache:                getEnv("ACME_CACHE", "dir"),
+			CacheDir:             getEnv("ACME_CACHE_DIR", "certs"),
+			HTTPChallengeAddress: getEnv("ACME_HTTP_CHALLENGE_ADDRESS", ""),
+		},
+		SPIFFE: SPIFFEConfig{
+			Enabled:        getEnvAsBool("SPIFFE_ENABLED", false),
+			EndpointSocket: getEnv("SPIFFE_ENDPOINT_SOCKET", ""),
+			AuthID:         getEnv("SPIFFE_AUTH_ID", ""),
+			AllowedIDs:     getEnvAsSlice("SPIFFE_ALLOWED_IDS", nil),
+		},
+		Callers: CallersConfig{
+			Allowlist:    getEnvAsAllowlist("CALLER_ALLOWLIST"),
+			APIKeys:      getEnvAsSecretMap("CALLER_API_KEYS"),
+			ClientAPIKey: getEnvAsSecret("CALLER_CLIENT_API_KEY", ""),
+		},
+		Mail: MailConfig{
+			Driver:        getEnv("MAIL_DRIVER", "log"),
+			SMTPHost:      getEnv("MAIL_SMTP_HOST", "localhost"),
+			SMTPPort:      getEnvAsInt("MAIL_SMTP_PORT", 587),
+			SMTPUsername:  getEnv("MAIL_SMTP_USERNAME", ""),
+			SMTPPassword:  getEnvAsSecret("MAIL_SMTP_PASSWORD", ""),
+			From:          getEnv("MAIL_FROM", "no-reply@example.com"),
+			DefaultLocale: getEnv("MAIL_DEFAULT_LOCALE", "en"),
+		},
+		Cache: CacheConfig{
+			Policies:      getEnvAsPolicies("CACHE_CONTROL_POLICIES"),
+			DefaultPolicy: getEnv("CACHE_CONTROL_DEFAULT", ""),
+		},
+		HTTPClient: HTTPClientConfig{
+			Timeout:          getEnvAsDuration("HTTP_CLIENT_TIMEOUT", 10*time.Second),
+			MaxAttempts:      getEnvAsInt("HTTP_CLIENT_MAX_ATTEMPTS", 3),
+			RetryBackoff:     getEnvAsDuration("HTTP_CLIENT_RETRY_BACKOFF", 200*time.Millisecond),
+			MaxBackoff:       getEnvAsDuration("HTTP_CLIENT_MAX_BACKOFF", 5*time.Second),
+			BreakerThreshold: getEnvAsInt("HTTP_CLIENT_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:  getEnvAsDuration("HTTP_CLIENT_BREAKER_COOLDOWN", 30*time.Second),
+		},
+		Presence: PresenceConfig{
+			Enabled:           getEnvAsBool("PRESENCE_ENABLED", false),
+			OnlineWindow:      getEnvAsDuration("PRESENCE_ONLINE_WINDOW", 5*time.Minute),
+			UpdateInterval:    getEnvAsDuration("PRESENCE_UPDATE_INTERVAL", time.Minute),
+			DefaultVisibility: getEnv("PRESENCE_DEFAULT_VISIBILITY", PresenceEveryone),
+		},
+		Tenancy: TenancyConfig{
+			Enabled: getEnvAsBool("TENANCY_ENABLED", false),
+		},
+		PublicStats: PublicStatsConfig{
+			Enabled:         getEnvAsBool("PUBLIC_STATS_ENABLED", false),
+			TTL:             getEnvAsDuration("PUBLIC_STATS_TTL", time.Hour),
+			Jitter:          getEnvAsDuration("PUBLIC_STATS_JITTER", 10*time.Minute),
+			Epsilon:         getEnvAsFloat("PUBLIC_STATS_EPSILON", 1),
+			UsersRounding:   getEnvAsInt("PUBLIC_STATS_USERS_ROUNDING", 100),
+			SignupsRounding: getEnvAsInt("PUBLIC_STATS_SIGNUPS_ROUNDING", 10),
+		},
+		Metering: MeteringConfig{
+			Enabled:       getEnvAsBool("METERING_ENABLED", false),
+			FlushInterval: getEnvAsDuration("METERING_FLUSH_INTERVAL", time.Minute),
+			ExportURL:     getEnv("METERING_EXPORT_URL", ""),
+		},
+		FlightRecorder: FlightRecorderConfig{
+			Size: getEnvAsInt("FLIGHT_RECORDER_SIZE", 1000),
+		},
+		Capture: CaptureConfig{
+			Dir:         getEnv("CAPTURE_DIR", ""),
+			SampleRatio: getEnvAsFloat("CAPTURE_SAMPLE_RATIO", 1),
+			Methods:     getEnvAsSlice("CAPTURE_METHODS", nil),
+			MaxRecords:  getEnvAsInt("CAPTURE_MAX_RECORDS", 100000),
+		},
+		ReadOnly: ReadOnlyConfig{
+			Enabled: getEnvAsBool("READ_ONLY_MODE", false),
+			Reason:  getEnv("READ_ONLY_REASON", ""),
+		},
+		LoginRateLimit: LoginRateLimitConfig{
+			PerIP:          getEnvAsInt("LOGIN_RATE_LIMIT_PER_IP", 20),
+			PerEmail:       getEnvAsInt("LOGIN_RATE_LIMIT_PER_EMAIL", 5),
+			Window:         getEnvAsDuration("LOGIN_RATE_LIMIT_WINDOW", time.Minute),
+			Backend:        getEnv("LOGIN_RATE_LIMIT_BACKEND", "memory"),
+			TrustedProxies: getEnvAsInt("LOGIN_RATE_LIMIT_TRUSTED_PROXIES", 0),
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:    getEnv("WEBAUTHN_RP_ID", "localhost"),
+			RPName:  getEnv("WEBAUTHN_RP_NAME", "hello-go"),
+			Origins: getEnvAsSlice("WEBAUTHN_ORIGINS", []string{"http://localhost:8081"}),
+			Timeout: getEnvAsDuration("WEBAUTHN_TIMEOUT", 5*time.Minute),
+		},
+		Alerting: AlertingConfig{
+			WebhookURL:          getEnv("ALERT_WEBHOOK_URL", ""),
+			PagerDutyRoutingKey: getEnvAsSecret("ALERT_PAGERDUTY_ROUTING_KEY", ""),
+			PagerDutyURL:        getEnv("ALERT_PAGERDUTY_URL", "https://events.pagerduty.com/v2/enqueue"),
+			Thresholds:          alertThresholds(environment),
+			Window:              getEnvAsDuration("ALERT_WINDOW", time.Minute),
+			Timeout:             getEnvAsDuration("ALERT_TIMEOUT", 10*time.Second),
+		},
+		Sentry: SentryConfig{
+			DSN:             getEnvAsSecret("SENTRY_DSN", ""),
+			Environment:     getEnv("SENTRY_ENVIRONMENT", ""),
+			Release:         getEnv("SENTRY_RELEASE", ""),
+			SampleRate:      getEnvAsFloat("SENTRY_SAMPLE_RATE", 1),
+			ErrorSampleRate: getEnvAsFloat("SENTRY_ERROR_SAMPLE_RATE", 0),
+			Timeout:         getEnvAsDuration("SENTRY_TIMEOUT", 5*time.Second),
+		},
+		LocalCache: LocalCacheConfig{
+			Tokens: CacheLimits{
+				Size: getEnvAsInt("LOCAL_CACHE_TOKENS_SIZE", 10000),
+				TTL:  getEnvAsDuration("LOCAL_CACHE_TOKENS_TTL", 30*time.Second),
+			},
+			Counts: CacheLimits{
+				Size: getEnvAsInt("LOCAL_CACHE_COUNTS_SIZE", 1000),
+				TTL:  getEnvAsDuration("LOCAL_CACHE_COUNTS_TTL", 10*time.Second),
+			},
+		},
+		Reconcile: ReconcileConfig{
+			SourceOfTruth: getEnv("RECONCILE_SOURCE_OF_TRUTH", SourceOfTruthAuth),
+			BatchSize:     getEnvAsInt("RECONCILE_BATCH_SIZE", 500),
+		},
+		Redis: RedisConfig{
+			Address:  getEnv("REDIS_ADDRESS", "localhost:6379"),
+			Password: getEnvAsSecret("REDIS_PASSWORD", ""),
+			DB:       getEnvAsInt("REDIS_DB", 0),
+		},
+		Jobs: JobsConfig{
+			Backend:            getEnv("JOBS_BACKEND", "database"),
+			Concurrency:        getEnvAsIntMap("JOBS_CONCURRENCY"),
+			DefaultConcurrency: getEnvAsInt("JOBS_DEFAULT_CONCURRENCY", 2),
+			MaxAttempts:        getEnvAsInt("JOBS_MAX_ATTEMPTS", 5),
+			RetryBackoff:       getEnvAsDuration("JOBS_RETRY_BACKOFF", 10*time.Second),
+			MaxBackoff:         getEnvAsDuration("JOBS_MAX_BACKOFF", time.Hour),
+			PollInterval:       getEnvAsDuration("JOBS_POLL_INTERVAL", time.Second),
+			Lease:              getEnvAsDuration("JOBS_LEASE", 5*time.Minute),
+		},
+		Privacy: PrivacyConfig{
+			PseudonymKey: getEnvAsSecret("PSEUDONYM_KEY", ""),
 		},
 	}
 
+	// The stores compared by the reconciler default to the service's own database
+	config.Reconcile.AuthDatabase = getEnvAsDatabase("RECONCILE_AUTH_", config.Database)
+	config.Reconcile.UserDatabase = getEnvAsDatabase("RECONCILE_USER_", config.Database)
+
+	// The user projection reads the auth service's events from DB_* unless the databases are split
+	config.User.EventsDatabase = getEnvAsDatabase("USER_EVENTS_", config.Database)
+
+	// Validate settings that would otherwise fail silently
+	switch config.Auth.RegistrationMode {
+	case RegistrationOpen, RegistrationApproval, RegistrationInvite, RegistrationClosed:
+	default:
+		return nil, fmt.Errorf("invalid AUTH_REGISTRATION_MODE %q, expected open, approval, invite or closed", config.Auth.RegistrationMode)
+	}
+	if config.Auth.InviteExpiration <= 0 {
+		return nil, fmt.Errorf("invalid INVITE_EXPIRATION %s, expected a positive duration", config.Auth.InviteExpiration)
+	}
+	if config.Auth.RecoveryEmailExpiration <= 0 {
+		return nil, fmt.Errorf("invalid RECOVERY_EMAIL_TOKEN_EXPIRATION %s, expected a positive duration", config.Auth.RecoveryEmailExpiration)
+	}
+	for _, key := range []string{"JWT_EXPIRATION_BY_ROLE", "JWT_EXPIRATION_BY_CLIENT"} {
+		for name, value := range getEnvAsMap(key) {
+			if ttl, err := time.ParseDuration(value); err != nil || ttl <= 0 {
+				return nil, fmt.Errorf("invalid %s lifetime %q of %s, expected a positive duration like 1h", key, value, name)
+			}
+		}
+	}
+	for clientType := range config.Auth.TokenExpirationByClient {
+		if clientType != ClientWeb && clientType != ClientMobile {
+			return nil, fmt.Errorf("invalid JWT_EXPIRATION_BY_CLIENT client type %q, expected web or mobile", clientType)
+		}
+	}
+	switch config.Auth.SigningAlgorithm {
+	case "HS256", "RS256", "ES256":
+	default:
+		return nil, fmt.Errorf("invalid JWT_SIGNING_ALGORITHM %q, expected HS256, RS256 or ES256", config.Auth.SigningAlgorithm)
+	}
+	if config.Auth.SigningAlgorithm != "HS256" && config.Auth.JWKSURL == "" && config.Auth.SigningKeyFile == "" {
+		// Validators would have no key to verify the tokens with
+		return nil, fmt.Errorf("JWT_SIGNING_ALGORITHM %s needs JWKS_URL or JWT_SIGNING_KEY_FILE to validate tokens", config.Auth.SigningAlgorithm)
+	}
+	if config.Auth.PreviousSigningKeyFile != "" && config.Auth.SigningKeyFile == "" {
+		return nil, fmt.Errorf("JWT_PREVIOUS_SIGNING_KEY_FILE needs JWT_SIGNING_KEY_FILE, the key replacing it")
+	}
+	if config.Auth.StepUpMaxAge < 0 {
+		return nil, fmt.Errorf("invalid STEP_UP_MAX_AGE %s, expected a positive duration or 0", config.Auth.StepUpMaxAge)
+	}
+	if config.Auth.ImpersonationExpiration <= 0 || config.Auth.ImpersonationExpiration > time.Hour {
+		return nil, fmt.Errorf("invalid IMPERSONATION_TOKEN_EXPIRATION %s, expected a positive duration of at most 1h", config.Auth.ImpersonationExpiration)
+	}
+	hashing := config.Auth.PasswordHashing
+	if hashing.Algorithm != PasswordBcrypt && hashing.Algorithm != PasswordArgon2id {
+		return nil, fmt.Errorf("invalid PASSWORD_HASH_ALGORITHM %q, expected bcrypt or argon2id", hashing.Algorithm)
+	}
+	if hashing.BcryptCost < 10 || hashing.BcryptCost > 31 {
+		return nil, fmt.Errorf("invalid PASSWORD_BCRYPT_COST %d, expected a number between 10 and 31", hashing.BcryptCost)
+	}
+	if hashing.Argon2Memory < 8*1024 {
+		return nil, fmt.Errorf("invalid PASSWORD_ARGON2_MEMORY %d, expected at least 8192 KiB", hashing.Argon2Memory)
+	}
+	if hashing.Argon2Iterations < 1 {
+		return nil, fmt.Errorf("invalid PASSWORD_ARGON2_ITERATIONS %d, expected a positive number", hashing.Argon2Iterations)
+	}
+	if hashing.Argon2Parallelism < 1 || hashing.Argon2Parallelism > 255 {
+		return nil, fmt.Errorf("invalid PASSWORD_ARGON2_PARALLELISM %d, expected a number between 1 and 255", hashing.Argon2Parallelism)
+	}
+	if config.LoginRateLimit.PerIP < 0 {
+		return nil, fmt.Errorf("invalid LOGIN_RATE_LIMIT_PER_IP %d, expected a positive number or 0", config.LoginRateLimit.PerIP)
+	}
+	if config.LoginRateLimit.PerEmail < 0 {
+		return nil, fmt.Errorf("invalid LOGIN_RATE_LIMIT_PER_EMAIL %d, expected a positive number or 0", config.LoginRateLimit.PerEmail)
+	}
+	if config.LoginRateLimit.Window <= 0 {
+		return nil, fmt.Errorf("invalid LOGIN_RATE_LIMIT_WINDOW %s, expected a positive duration", config.LoginRateLimit.Window)
+	}
+	if config.LoginRateLimit.TrustedProxies < 0 {
+		return nil, fmt.Errorf("invalid LOGIN_RATE_LIMIT_TRUSTED_PROXIES %d, expected a positive number or 0", config.LoginRateLimit.TrustedProxies)
+	}
+	switch config.LoginRateLimit.Backend {
+	case "memory", "redis":
+	default:
+		return nil, fmt.Errorf("invalid LOGIN_RATE_LIMIT_BACKEND %q, expected memory or redis", config.LoginRateLimit.Backend)
+	}
+	if config.WebAuthn.RPID == "" {
+		return nil, fmt.Errorf("WEBAUTHN_RP_ID is required")
+	}
+	if len(config.WebAuthn.Origins) == 0 {
+		return nil, fmt.Errorf("WEBAUTHN_ORIGINS is required")
+	}
+	if config.WebAuthn.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid WEBAUTHN_TIMEOUT %s, expected a positive duration", config.WebAuthn.Timeout)
+	}
+	objectives, err := getEnvAsObjectives("SLO_OBJECTIVES",
+		"availability=*:availability:99.9;latency=*:latency:99:500ms")
+	if err != nil {
+		return nil, err
+	}
+	config.SLO.Objectives = objectives
+	samplingByLevel, err := getEnvAsSampling("LOG_SAMPLING_BY_LEVEL")
+	if err != nil {
+		return nil, err
+	}
+	config.Logging.SamplingByLevel = samplingByLevel
+	if config.Logging.Sampling.Initial < 0 {
+		return nil, fmt.Errorf("invalid LOG_SAMPLING_INITIAL %d, expected a positive number or 0", config.Logging.Sampling.Initial)
+	}
+	if config.Logging.Sampling.Thereafter < 0 {
+		return nil, fmt.Errorf("invalid LOG_SAMPLING_THEREAFTER %d, expected a positive number or 0", config.Logging.Sampling.Thereafter)
+	}
+	if config.Logging.MaxPerSecond < 0 {
+		return nil, fmt.Errorf("invalid LOG_MAX_PER_SECOND %d, expected a positive number or 0", config.Logging.MaxPerSecond)
+	}
+	for name, level := range config.Logging.Levels {
+		switch level {
+		case "debug", "info", "warn", "error":
+		default:
+			return nil, fmt.Errorf("invalid LOG_LEVELS level %q of %s, expected debug, info, warn or error", level, name)
+		}
+	}
+	switch config.Presence.DefaultVisibility {
+	case PresenceEveryone, PresenceNobody:
+	default:
+		return nil, fmt.Errorf("invalid PRESENCE_DEFAULT_VISIBILITY %q, expected everyone or nobody", config.Presence.DefaultVisibility)
+	}
+	if config.PublicStats.TTL <= 0 || config.PublicStats.Jitter < 0 {
+		return nil, fmt.Errorf("invalid PUBLIC_STATS_TTL %s or PUBLIC_STATS_JITTER %s, expected a positive TTL and a jitter of 0 or more", config.PublicStats.TTL, config.PublicStats.Jitter)
+	}
+	if config.PublicStats.Epsilon <= 0 {
+		return nil, fmt.Errorf("invalid PUBLIC_STATS_EPSILON %v, expected a positive number", config.PublicStats.Epsilon)
+	}
+	if config.PublicStats.UsersRounding < 1 || config.PublicStats.SignupsRounding < 1 {
+		return nil, fmt.Errorf("invalid PUBLIC_STATS_USERS_ROUNDING %d or PUBLIC_STATS_SIGNUPS_ROUNDING %d, expected 1 or more", config.PublicStats.UsersRounding, config.PublicStats.SignupsRounding)
+	}
+	switch config.Reconcile.SourceOfTruth {
+	case SourceOfTruthAuth, SourceOfTruthUser:
+	default:
+		return nil, fmt.Errorf("invalid RECONCILE_SOURCE_OF_TRUTH %q, expected auth or user", config.Reconcile.SourceOfTruth)
+	}
+	for name, fieldType := range config.User.CustomFields {
+		if !customFieldName.MatchString(name) {
+			return nil, fmt.Errorf("invalid USER_CUSTOM_FIELDS name %q, expected up to 50 lowercase letters, digits and underscores", name)
+		}
+		switch fieldType {
+		case CustomFieldString, CustomFieldNumber, CustomFieldBool, CustomFieldDate:
+		default:
+			return nil, fmt.Errorf("invalid USER_CUSTOM_FIELDS type %q of %s, expected string, number, bool or date", fieldType, name)
+		}
+	}
+	switch config.Logging.Payloads {
+	case LogPayloadsAll, LogPayloadsSampled, LogPayloadsNone:
+	default:
+		return nil, fmt.Errorf("invalid LOG_PAYLOADS %q, expected all, sampled or none", config.Logging.Payloads)
+	}
+	switch config.Logging.SQLLevel {
+	case "silent", "error", "warn", "info":
+	default:
+		return nil, fmt.Errorf("invalid LOG_SQL_LEVEL %q, expected silent, error, warn or info", config.Logging.SQLLevel)
+	}
+	if config.Logging.SQLSlowThreshold < 0 {
+		return nil, fmt.Errorf("invalid LOG_SQL_SLOW_THRESHOLD %s, expected a positive duration or 0", config.Logging.SQLSlowThreshold)
+	}
+	if config.Logging.SQLExplainRatio < 0 || config.Logging.SQLExplainRatio > 1 {
+		return nil, fmt.Errorf("invalid LOG_SQL_EXPLAIN_RATIO %v, expected a number between 0 and 1", config.Logging.SQLExplainRatio)
+	}
+	if config.Tracing.SampleRatio < 0 || config.Tracing.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid TRACE_SAMPLE_RATIO %v, expected a number between 0 and 1", config.Tracing.SampleRatio)
+	}
+	for _, key := range config.Tracing.BaggageKeys {
+		if !baggageKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid TRACE_BAGGAGE_KEYS key %q, expected lowercase letters, digits, '_', '-' or '.'", key)
+		}
+	}
+	switch config.Tracing.LogExport.Exporter {
+	case LogExporterNone:
+	case LogExporterLoki, LogExporterOTLP:
+		if config.Tracing.LogExport.Endpoint == "" {
+			return nil, fmt.Errorf("LOG_EXPORTER=%s needs LOG_EXPORT_ENDPOINT", config.Tracing.LogExport.Exporter)
+		}
+	default:
+		return nil, fmt.Errorf("invalid LOG_EXPORTER %q, expected none, loki or otlp", config.Tracing.LogExport.Exporter)
+	}
+	if config.Tracing.LogExport.BatchSize <= 0 {
+		return nil, fmt.Errorf("invalid LOG_EXPORT_BATCH_SIZE %d, expected a positive number", config.Tracing.LogExport.BatchSize)
+	}
+	if config.Tracing.LogExport.QueueSize < config.Tracing.LogExport.BatchSize {
+		return nil, fmt.Errorf("invalid LOG_EXPORT_QUEUE_SIZE %d, expected at least LOG_EXPORT_BATCH_SIZE", config.Tracing.LogExport.QueueSize)
+	}
+	if config.Tracing.LogExport.FlushInterval <= 0 {
+		return nil, fmt.Errorf("invalid LOG_EXPORT_FLUSH_INTERVAL %s, expected a positive duration", config.Tracing.LogExport.FlushInterval)
+	}
+	if config.Tracing.LogExport.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid LOG_EXPORT_TIMEOUT %s, expected a positive duration", config.Tracing.LogExport.Timeout)
+	}
+	for name, threshold := range config.Alerting.Thresholds {
+		switch name {
+		case AlertDependencyFailures, AlertCircuitOpen, AlertTokenValidationErrors:
+		default:
+			return nil, fmt.Errorf("invalid ALERT_THRESHOLDS condition %q, expected dependency_failures, circuit_open or token_validation_errors", name)
+		}
+		if threshold < 0 {
+			return nil, fmt.Errorf("invalid ALERT_THRESHOLDS %s:%d, expected 0 or more", name, threshold)
+		}
+	}
+	if config.Alerting.Window <= 0 {
+		return nil, fmt.Errorf("invalid ALERT_WINDOW %s, expected a positive duration", config.Alerting.Window)
+	}
+	if config.Alerting.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid ALERT_TIMEOUT %s, expected a positive duration", config.Alerting.Timeout)
+	}
+	if config.Sentry.SampleRate < 0 || config.Sentry.SampleRate > 1 {
+		return nil, fmt.Errorf("invalid SENTRY_SAMPLE_RATE %v, expected a number between 0 and 1", config.Sentry.SampleRate)
+	}
+	if config.Sentry.ErrorSampleRate < 0 || config.Sentry.ErrorSampleRate > 1 {
+		return nil, fmt.Errorf("invalid SENTRY_ERROR_SAMPLE_RATE %v, expected a number between 0 and 1", config.Sentry.ErrorSampleRate)
+	}
+	if config.Sentry.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid SENTRY_TIMEOUT %s, expected a positive duration", config.Sentry.Timeout)
+	}
+	if config.Capture.SampleRatio < 0 || config.Capture.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid CAPTURE_SAMPLE_RATIO %v, expected a number between 0 and 1", config.Capture.SampleRatio)
+	}
+	if config.Capture.MaxRecords <= 0 {
+		return nil, fmt.Errorf("invalid CAPTURE_MAX_RECORDS %d, expected a positive number", config.Capture.MaxRecords)
+	}
+	if config.FlightRecorder.Size < 0 {
+		return nil, fmt.Errorf("invalid FLIGHT_RECORDER_SIZE %d, expected 0 or more", config.FlightRecorder.Size)
+	}
+	if config.CDC.Mode == "" {
+		// The binlog is MySQL's, other databases fall back to snapshots
+		config.CDC.Mode = CDCSnapshot
+		if config.Database.Driver == "mysql" {
+			config.CDC.Mode = CDCBinlog
+		}
+	}
+	switch config.CDC.Mode {
+	case CDCBinlog:
+		if config.Database.Driver != "mysql" {
+			return nil, fmt.Errorf("CDC_MODE=binlog needs DB_DRIVER=mysql, use CDC_MODE=snapshot for %s", config.Database.Driver)
+		}
+		if config.CDC.ServerID <= 0 || config.CDC.ServerID > math.MaxUint32 {
+			return nil, fmt.Errorf("invalid CDC_SERVER_ID %d, expected 1 to 4294967295", config.CDC.ServerID)
+		}
+	case CDCSnapshot:
+	default:
+		return nil, fmt.Errorf("invalid CDC_MODE %q, expected binlog or snapshot", config.CDC.Mode)
+	}
+	if config.ServiceDiscovery.Backend != DiscoveryConsul && config.ServiceDiscovery.Backend != DiscoveryDNS {
+		return nil, fmt.Errorf("invalid SERVICE_DISCOVERY_BACKEND %q, expected consul or dns", config.ServiceDiscovery.Backend)
+	}
+	if config.ServiceDiscovery.Register && config.ServiceDiscovery.Backend != DiscoveryConsul {
+		return nil, fmt.Errorf("SERVICE_DISCOVERY_REGISTER needs SERVICE_DISCOVERY_BACKEND=consul, DNS names are managed by the platform")
+	}
+	if strings.HasPrefix(config.Auth.GRPCAddress, "consul:") && config.ServiceDiscovery.Backend != DiscoveryConsul {
+		return nil, fmt.Errorf("AUTH_SERVICE_GRPC_ADDRESS %q needs SERVICE_DISCOVERY_BACKEND=consul", config.Auth.GRPCAddress)
+	}
+	if config.Region != "" && !ValidRegion(config.Region) {
+		return nil, fmt.Errorf("invalid REGION %q, expected lowercase letters, digits and dashes", config.Region)
+	}
+	for name, limits := range map[string]CacheLimits{
+		"TOKENS": config.LocalCache.Tokens,
+		"COUNTS": config.LocalCache.Counts,
+	} {
+		if limits.Size < 0 || limits.TTL < 0 {
+			return nil, fmt.Errorf("invalid LOCAL_CACHE_%s_SIZE %d or LOCAL_CACHE_%s_TTL %s, expected 0 or more", name, limits.Size, name, limits.TTL)
+		}
+	}
+	if config.Metering.Enabled && config.Metering.FlushInterval <= 0 {
+		return nil, fmt.Errorf("invalid METERING_FLUSH_INTERVAL %s, expected a positive duration", config.Metering.FlushInterval)
+	}
+	for route := range config.Cache.Policies {
+		method, path, _ := strings.Cut(route, " ")
+		if method == "" || method != strings.ToUpper(method) || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid CACHE_CONTROL_POLICIES route %q, expected a method and a path like \"GET /api/v1/users/{id}\"", route)
+		}
+	}
+
 	return config, nil
 }
 
+// ValidRegion reports whether name is a valid region name, e.g. "eu-west-1"
+func ValidRegion(name string) bool {
+	return regionPattern.MatchString(name)
+}
+
+// ValidTenant reports whether id is a valid tenant ID, e.g. "acme"
+func ValidTenant(id string) bool {
+	return tenantPattern.MatchString(id)
+}
+
 // Helper functions to get environment variables with defaults
+// getEnv returns an environment variable, or its default in the current
+// profile, or defaultValue
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
+	if value, ok := profileDefault(key); ok {
+		return value
+	}
 	return defaultValue
 }
 
@@ -81,6 +672,237 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	var values []string
+	for _, value := range strings.Split(valueStr, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvAsMap parses comma-separated name:value pairs, e.g. "ops:key1,batch:key2"
+func getEnvAsMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range getEnvAsSlice(key, nil) {
+		if name, value, ok := strings.Cut(pair, ":"); ok {
+			values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+// getEnvAsSecret returns a sensitive environment variable like getEnv
+func getEnvAsSecret(key string, defaultValue Secret) Secret {
+	return Secret(getEnv(key, string(defaultValue)))
+}
+
+// getEnvAsSecretMap parses comma-separated name:secret pairs like getEnvAsMap
+func getEnvAsSecretMap(key string) map[string]Secret {
+	values := make(map[string]Secret)
+	for name, value := range getEnvAsMap(key) {
+		values[name] = Secret(value)
+	}
+	return values
+}
+
+// getEnvAsSampling parses comma-separated level:initial/thereafter pairs, e.g. "debug:10/1000,error:20/20"
+func getEnvAsSampling(key string) (map[string]LogSampling, error) {
+	values := make(map[string]LogSampling)
+	for level, value := range getEnvAsMap(key) {
+		switch level {
+		case "debug", "info", "warn", "error":
+		default:
+			return nil, fmt.Errorf("invalid %s level %q, expected debug, info, warn or error", key, level)
+		}
+		initial, thereafter, ok := strings.Cut(value, "/")
+		sampling := LogSampling{}
+		var err error
+		if ok {
+			if sampling.Initial, err = strconv.Atoi(initial); err == nil {
+				sampling.Thereafter, err = strconv.Atoi(thereafter)
+			}
+		}
+		if !ok || err != nil || sampling.Initial < 0 || sampling.Thereafter < 0 {
+			return nil, fmt.Errorf("invalid %s value %q of %s, expected initial/thereafter, e.g. 100/100", key, value, level)
+		}
+		values[level] = sampling
+	}
+	return values, nil
+}
+
+// getEnvAsObjectives parses semicolon-separated name=methods:sli:target[:threshold]
+// objectives, with comma-separated methods and the target in percent, e.g.
+// "login=/auth.AuthService/Login:latency:99:300ms;api=*:availability:99.9"
+func getEnvAsObjectives(key, defaultValue string) ([]SLObjective, error) {
+	var objectives []SLObjective
+	names := make(map[string]bool)
+	for _, rule := range strings.Split(getEnv(key, defaultValue), ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(rule, "=")
+		parts := strings.Split(spec, ":")
+		if !ok || !sloNamePattern.MatchString(name) || len(parts) < 3 || len(parts) > 4 {
+			return nil, fmt.Errorf("invalid %s objective %q, expected name=methods:sli:target[:threshold]", key, rule)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("invalid %s, objective %q is defined twice", key, name)
+		}
+		names[name] = true
+
+		objective := SLObjective{Name: name, SLI: parts[1]}
+		for _, method := range strings.Split(parts[0], ",") {
+			if method = strings.TrimSpace(method); method != "" {
+				objective.Methods = append(objective.Methods, method)
+			}
+		}
+		if len(objective.Methods) == 0 {
+			return nil, fmt.Errorf("invalid %s objective %q, expected at least one method", key, name)
+		}
+		percent, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || percent <= 0 || percent >= 100 {
+			return nil, fmt.Errorf("invalid %s target %q of %s, expected a percentage between 0 and 100", key, parts[2], name)
+		}
+		// Rounded, so 99.9 is exported as 0.999 rather than 0.9990000000000001
+		objective.Target = math.Round(percent*1e7) / 1e9
+
+		switch objective.SLI {
+		case SLIAvailability:
+			if len(parts) == 4 {
+				return nil, fmt.Errorf("invalid %s objective %q, availability objectives have no threshold", key, name)
+			}
+		case SLILatency:
+			if len(parts) == 3 {
+				return nil, fmt.Errorf("invalid %s objective %q, latency objectives need a threshold", key, name)
+			}
+			if objective.Threshold, err = time.ParseDuration(parts[3]); err != nil || objective.Threshold <= 0 {
+				return nil, fmt.Errorf("invalid %s threshold %q of %s, expected a positive duration", key, parts[3], name)
+			}
+		default:
+			return nil, fmt.Errorf("invalid %s SLI %q of %s, expected availability or latency", key, objective.SLI, name)
+		}
+		objectives = append(objectives, objective)
+	}
+	return objectives, nil
+}
+
+// getEnvAsIntMap parses comma-separated name:number pairs, e.g. "mail:4,webhook:8".
+// Pairs with an invalid number are ignored.
+func getEnvAsIntMap(key string) map[string]int {
+	values := make(map[string]int)
+	for name, value := range getEnvAsMap(key) {
+		if number, err := strconv.Atoi(value); err == nil {
+			values[name] = number
+		}
+	}
+	return values
+}
+
+// alertThresholds returns the alert thresholds of the environment, with the
+// ones of ALERT_THRESHOLDS replacing them, e.g. "dependency_failures:5"
+func alertThresholds(environment string) map[string]int {
+	var thresholds map[string]int
+	switch environment {
+	case "development":
+		// Nobody is paged for a laptop
+		thresholds = map[string]int{AlertDependencyFailures: 0, AlertCircuitOpen: 0, AlertTokenValidationErrors: 0}
+	case "staging":
+		thresholds = map[string]int{AlertDependencyFailures: 10, AlertCircuitOpen: 3, AlertTokenValidationErrors: 500}
+	default:
+		thresholds = map[string]int{AlertDependencyFailures: 3, AlertCircuitOpen: 1, AlertTokenValidationErrors: 100}
+	}
+
+	for name, threshold := range getEnvAsIntMap("ALERT_THRESHOLDS") {
+		thresholds[name] = threshold
+	}
+	return thresholds
+}
+
+// getEnvAsAllowlist parses semicolon-separated rules of a method and the
+// comma-separated identities allowed to call it, e.g. "/pkg.Service/Method=gateway,apikey:ops"
+func getEnvAsAllowlist(key string) map[string][]string {
+	allowlist := make(map[string][]string)
+	for _, rule := range strings.Split(getEnv(key, ""), ";") {
+		method, identities, ok := strings.Cut(rule, "=")
+		if !ok {
+			continue
+		}
+
+		var allowed []string
+		for _, identity := range strings.Split(identities, ",") {
+			if identity = strings.TrimSpace(identity); identity != "" {
+				allowed = append(allowed, identity)
+			}
+		}
+		allowlist[strings.TrimSpace(method)] = allowed
+	}
+	return allowlist
+}
+
+// getEnvAsPolicies parses semicolon-separated rules of a route and its
+// Cache-Control policy, e.g. "GET /api/v1/status=public, max-age=30"
+func getEnvAsPolicies(key string) map[string]string {
+	policies := make(map[string]string)
+	for _, rule := range strings.Split(getEnv(key, ""), ";") {
+		route, policy, ok := strings.Cut(rule, "=")
+		if !ok {
+			continue
+		}
+		policies[strings.Join(strings.Fields(route), " ")] = strings.TrimSpace(policy)
+	}
+	return policies
+}
+
+// getEnvAsDatabase reads the DB_* settings under a prefix, e.g. RECONCILE_AUTH_DB_HOST,
+// falling back to the given connection
+func getEnvAsDatabase(prefix string, fallback DatabaseConfig) DatabaseConfig {
+	return DatabaseConfig{
+		Driver:   getEnv(prefix+"DB_DRIVER", fallback.Driver),
+		Host:     getEnv(prefix+"DB_HOST", fallback.Host),
+		Port:     getEnvAsInt(prefix+"DB_PORT", fallback.Port),
+		User:     getEnv(prefix+"DB_USER", fallback.User),
+		Password: getEnvAsSecret(prefix+"DB_PASSWORD", fallback.Password),
+		DBName:   getEnv(prefix+"DB_NAME", fallback.DBName),
+		Params:   getEnv(prefix+"DB_PARAMS", fallback.Params),
+	}
+}
+
+// getEnvAsDurationMap parses comma-separated name:duration pairs, e.g. "admin:1h,user:24h".
+// Pairs with an invalid duration are ignored.
+func getEnvAsDurationMap(key string) map[string]time.Duration {
+	values := make(map[string]time.Duration)
+	for name, value := range getEnvAsMap(key) {
+		if duration, err := time.ParseDuration(value); err == nil {
+			values[name] = duration
+		}
+	}
+	return values
+}
+
 func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	valueStr := getEnv(key, "")
 	if value, err := time.ParseDuration(valueStr); err == nil {
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"sort"
+)
+
+// Deployment profiles, see Profile
+const (
+	// ProfileLocal runs everything on localhost, the built-in defaults
+	ProfileLocal = "local"
+	// ProfileCompose runs in docker-compose.yml, where services are reached by their service names
+	ProfileCompose = "compose"
+	// ProfileK8s runs in the Kubernetes manifests of k8s/, where services are reached by their DNS names
+	ProfileK8s = "k8s"
+)
+
+// profileDefaults are the defaults of each profile that differ from the local
+// ones. Environment variables always take precedence.
+var profileDefaults = map[string]map[string]string{
+	ProfileLocal: {},
+	ProfileCompose: {
+		"DB_HOST":                   "mysql",
+		"AUTH_SERVICE_GRPC_ADDRESS": "auth-service:9091",
+		"REDIS_ADDRESS":             "redis:6379",
+		"SERVICE_DISCOVERY_BACKEND": DiscoveryDNS,
+		"SERVICE_DISCOVERY_URL":     "consul:8500",
+	},
+	ProfileK8s: {
+		"DB_HOST":                   "mysql-service",
+		"AUTH_SERVICE_GRPC_ADDRESS": "auth-service:9091",
+		"REDIS_ADDRESS":             "redis:6379",
+		"SERVICE_DISCOVERY_BACKEND": DiscoveryDNS,
+		"SERVICE_DISCOVERY_URL":     "service-discovery:8500",
+	},
+}
+
+// Profile returns the deployment profile selecting defaults: PROFILE if set,
+// otherwise ProfileK8s inside a Kubernetes pod and ProfileLocal elsewhere
+func Profile() string {
+	if profile := os.Getenv("PROFILE"); profile != "" {
+		return profile
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return ProfileK8s
+	}
+	return ProfileLocal
+}
+
+// Profiles returns the names of the known profiles
+func Profiles() []string {
+	names := make([]string, 0, len(profileDefaults))
+	for name := range profileDefaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileDefault returns the default of an environment variable in the current profile
+func profileDefault(key string) (string, bool) {
+	value, ok := profileDefaults[Profile()][key]
+	return value, ok
+}
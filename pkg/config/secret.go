@@ -0,0 +1,53 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// redacted replaces secrets wherever they're printed
+const redacted = "[REDACTED]"
+
+// Secret is a sensitive setting, e.g. a password or a key. It's redacted when
+// printed with any fmt verb, logged or marshalled as JSON, so it can't leak
+// through a config dump or a log field: only Reveal returns the value. An
+// unset secret prints as empty, telling it apart from a set one.
+type Secret string
+
+// Reveal returns the value of the secret, for the code that uses it
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// String returns the redacted secret
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString returns the redacted secret for %#v
+func (s Secret) GoString() string {
+	return fmt.Sprintf("config.Secret(%q)", s.String())
+}
+
+// Format redacts the secret for every verb, %x and %d included
+func (s Secret) Format(f fmt.State, verb rune) {
+	if verb == 'v' && f.Flag('#') {
+		io.WriteString(f, s.GoString())
+		return
+	}
+	io.WriteString(f, s.String())
+}
+
+// MarshalJSON returns the redacted secret as a JSON string
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// MarshalText returns the redacted secret, e.g. for map keys and text encoders
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
@@ -0,0 +1,225 @@
+// Package configcrypt encrypts configuration values so secrets can be kept in
+// git-managed config files, and decrypts them when the configuration is loaded.
+//
+// Encrypted values look like ENC[<scheme>,<base64>], the payload being:
+//
+//   - age: an age file (https://age-encryption.org) encrypted to X25519
+//     recipients, e.g. made with `age -r age1... | base64 -w0` and read with
+//     `base64 -d | age -d -i key.txt`
+//   - kms: an AWS KMS ciphertext blob, e.g. made with `aws kms encrypt`
+//
+// Both are handled behind the Encrypter and Decrypter interfaces.
+package configcrypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// Schemes of encrypted values
+const (
+	SchemeAge = "age"
+	SchemeKMS = "kms"
+)
+
+// Value format
+const (
+	valuePrefix = "ENC["
+	valueSuffix = "]"
+)
+
+// Common errors
+var (
+	ErrInvalidKey        = errors.New("invalid configuration key")
+	ErrUnsupportedValue  = errors.New("unsupported encrypted value, expected ENC[age,...] or ENC[kms,...]")
+	ErrDecryptionFailed  = errors.New("failed to decrypt configuration value")
+	ErrIdentityMissing   = errors.New("age encrypted configuration values need CONFIG_IDENTITY or CONFIG_IDENTITY_FILE")
+	ErrRecipientRequired = errors.New("missing recipient")
+)
+
+// Encrypter encrypts the payloads of one scheme's values
+type Encrypter interface {
+	// Scheme is the scheme of the values, e.g. SchemeAge
+	Scheme() string
+	Encrypt(ctx context.Context, plaintext []byte) ([]byte, error)
+}
+
+// Decrypter decrypts the payloads of one scheme's values
+type Decrypter interface {
+	// Scheme is the scheme of the values, e.g. SchemeAge
+	Scheme() string
+	Decrypt(ctx context.Context, payload []byte) ([]byte, error)
+}
+
+// Cipher encrypts and decrypts one scheme's values
+type Cipher interface {
+	Encrypter
+	Decrypter
+}
+
+// IsEncrypted reports whether a configuration value is encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, valuePrefix) && strings.HasSuffix(value, valueSuffix)
+}
+
+// Scheme returns the scheme of an encrypted value, empty if it isn't one
+func Scheme(value string) string {
+	scheme, _, err := parse(value)
+	if err != nil {
+		return ""
+	}
+	return scheme
+}
+
+// Encrypt encrypts a value
+func Encrypt(ctx context.Context, e Encrypter, plaintext string) (string, error) {
+	payload, err := e.Encrypt(ctx, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return valuePrefix + e.Scheme() + "," + base64.StdEncoding.EncodeToString(payload) + valueSuffix, nil
+}
+
+// Decrypt decrypts a value with the decrypter of its scheme
+func Decrypt(ctx context.Context, value string, decrypters ...Decrypter) (string, error) {
+	scheme, payload, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	for _, d := range decrypters {
+		if d.Scheme() == scheme {
+			plaintext, err := d.Decrypt(ctx, payload)
+			if err != nil {
+				return "", err
+			}
+			return string(plaintext), nil
+		}
+	}
+	return "", fmt.Errorf("%w: no key for %s values", ErrDecryptionFailed, scheme)
+}
+
+// parse returns the scheme and decoded payload of an encrypted value
+func parse(value string) (string, []byte, error) {
+	if !IsEncrypted(value) {
+		return "", nil, ErrUnsupportedValue
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(value, valuePrefix), valueSuffix)
+	scheme, encoded, ok := strings.Cut(body, ",")
+	if !ok || (scheme != SchemeAge && scheme != SchemeKMS) {
+		return "", nil, ErrUnsupportedValue
+	}
+	payload, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrUnsupportedValue, err)
+	}
+	return scheme, payload, nil
+}
+
+// GenerateIdentity returns a new age identity, which decrypts values and must
+// be kept secret, and its recipient, which encrypts values and can be shared.
+// They're compatible with the ones of age-keygen.
+func GenerateIdentity() (identity, recipient string, err error) {
+	key, err := age.GenerateX25519Identity()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key.String(), key.Recipient().String(), nil
+}
+
+// IdentityFromEnv returns the age identities in CONFIG_IDENTITY or the file at
+// CONFIG_IDENTITY_FILE, e.g. one written by age-keygen
+func IdentityFromEnv() (string, error) {
+	if identity := os.Getenv("CONFIG_IDENTITY"); identity != "" {
+		return identity, nil
+	}
+	path := os.Getenv("CONFIG_IDENTITY_FILE")
+	if path == "" {
+		return "", ErrIdentityMissing
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read CONFIG_IDENTITY_FILE: %w", err)
+	}
+	return string(data), nil
+}
+
+// ageEncrypter encrypts values to age recipients
+type ageEncrypter struct {
+	recipients []age.Recipient
+}
+
+// NewAgeEncrypter creates an encrypter for comma or newline separated age
+// recipients, e.g. age1...
+func NewAgeEncrypter(recipients string) (Encrypter, error) {
+	recipients = strings.ReplaceAll(strings.TrimSpace(recipients), ",", "\n")
+	if recipients == "" {
+		return nil, ErrRecipientRequired
+	}
+	parsed, err := age.ParseRecipients(strings.NewReader(recipients))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return &ageEncrypter{recipients: parsed}, nil
+}
+
+// Scheme returns SchemeAge
+func (e *ageEncrypter) Scheme() string {
+	return SchemeAge
+}
+
+// Encrypt encrypts plaintext into an age file
+func (e *ageEncrypter) Encrypt(_ context.Context, plaintext []byte) ([]byte, error) {
+	var out bytes.Buffer
+	w, err := age.Encrypt(&out, e.recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ageDecrypter decrypts values with age identities
+type ageDecrypter struct {
+	identities []age.Identity
+}
+
+// NewAgeDecrypter creates a decrypter for age identities, in the format of the
+// key files written by age-keygen
+func NewAgeDecrypter(identities string) (Decrypter, error) {
+	parsed, err := age.ParseIdentities(strings.NewReader(identities))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return &ageDecrypter{identities: parsed}, nil
+}
+
+// Scheme returns SchemeAge
+func (d *ageDecrypter) Scheme() string {
+	return SchemeAge
+}
+
+// Decrypt decrypts an age file
+func (d *ageDecrypter) Decrypt(_ context.Context, payload []byte) ([]byte, error) {
+	r, err := age.Decrypt(bytes.NewReader(payload), d.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryptionFailed, err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryptionFailed, err)
+	}
+	return plaintext, nil
+}
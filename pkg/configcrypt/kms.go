@@ -0,0 +1,61 @@
+package configcrypt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// kmsCipher encrypts and decrypts values with an AWS KMS key
+type kmsCipher struct {
+	client *kms.Client
+	keyID  string
+}
+
+// NewKMSCipher creates an encrypter and decrypter for AWS KMS, with the
+// credentials and region of the AWS environment, e.g. AWS_REGION or an
+// instance role. keyID is the key ID, ARN or alias values are encrypted with;
+// it's optional for decrypting, the ciphertext names its key.
+func NewKMSCipher(ctx context.Context, keyID string) (Cipher, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	return &kmsCipher{client: kms.NewFromConfig(cfg), keyID: keyID}, nil
+}
+
+// Scheme returns SchemeKMS
+func (c *kmsCipher) Scheme() string {
+	return SchemeKMS
+}
+
+// Encrypt encrypts plaintext with the key, which must be set
+func (c *kmsCipher) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	if c.keyID == "" {
+		return nil, ErrRecipientRequired
+	}
+	out, err := c.client.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:     aws.String(c.keyID),
+		Plaintext: plaintext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt with KMS: %w", err)
+	}
+	return out.CiphertextBlob, nil
+}
+
+// Decrypt decrypts a KMS ciphertext blob
+func (c *kmsCipher) Decrypt(ctx context.Context, payload []byte) ([]byte, error) {
+	input := &kms.DecryptInput{CiphertextBlob: payload}
+	if c.keyID != "" {
+		input.KeyId = aws.String(c.keyID)
+	}
+	out, err := c.client.Decrypt(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryptionFailed, err)
+	}
+	return out.Plaintext, nil
+}
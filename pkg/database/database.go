@@ -0,0 +1,37 @@
+package database
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// Open opens a GORM connection for the configured database driver
+func Open(cfg *config.Config, logger *zap.Logger) (*gorm.DB, error) {
+	configureSQLLog(cfg)
+
+	gormLogger := NewGormLogger(logger.Named("gorm"))
+	gormConfig := &gorm.Config{
+		Logger: gormLogger,
+		// Translate driver errors, e.g. unique violations to gorm.ErrDuplicatedKey
+		TranslateError: true,
+	}
+
+	switch cfg.Database.Driver {
+	case "mysql":
+		// Connect to MySQL database
+		db, err := gorm.Open(mysql.Open(cfg.Database.GetDSN()), gormConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		// Slow queries are explained on the same connection
+		gormLogger.explainer.db = db
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Database.Driver)
+	}
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	mathrand "math/rand"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+// Slow query metrics
+var (
+	slowQueries = metrics.NewCounterVec("sql_slow_queries_total",
+		"Queries slower than LOG_SQL_SLOW_THRESHOLD, by whether their plan was explained", "explained")
+	fullScans = metrics.NewCounterVec("sql_slow_query_full_scans_total",
+		"Tables read with a full scan by explained slow queries, a hint at a missing index", "table")
+)
+
+// explainTimeout bounds an EXPLAIN, it only plans the query
+const explainTimeout = 5 * time.Second
+
+// maxExplains is the number of EXPLAINs run at once per connection, slow
+// queries arriving while they run are logged without a plan
+const maxExplains = 2
+
+// explainer runs EXPLAIN for a sample of slow queries
+type explainer struct {
+	// db is set once the connection is open
+	db      *gorm.DB
+	running chan struct{}
+}
+
+// newExplainer creates an explainer, its connection is set by Open
+func newExplainer() *explainer {
+	return &explainer{running: make(chan struct{}, maxExplains)}
+}
+
+// sample reports whether a slow query should be explained and reserves a slot for it
+func (e *explainer) sample(sql string) bool {
+	ratio := sqlLog.explainRatio()
+	if e == nil || e.db == nil || ratio <= 0 || mathrand.Float64() >= ratio || !explainable(sql) {
+		return false
+	}
+	select {
+	case e.running <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// explain returns the plan of a query as one map per row of EXPLAIN's output,
+// the slot reserved by sample is released
+func (e *explainer) explain(sql string) ([]map[string]interface{}, error) {
+	defer func() { <-e.running }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+	defer cancel()
+
+	// Silenced, so EXPLAINs aren't logged and explained themselves
+	var rows []map[string]interface{}
+	if err := e.db.Session(&gorm.Session{Logger: e.db.Logger.LogMode(gormlogger.Silent)}).
+		WithContext(ctx).
+		Raw("EXPLAIN " + sql).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to explain query: %w", err)
+	}
+
+	for _, row := range rows {
+		for column, value := range row {
+			if b, ok := value.([]byte); ok {
+				row[column] = string(b)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// explainable reports whether a statement is a query EXPLAIN can plan without side effects
+func explainable(sql string) bool {
+	statement := strings.ToUpper(strings.TrimSpace(sql))
+	return strings.HasPrefix(statement, "SELECT") || strings.HasPrefix(statement, "WITH")
+}
+
+// logSlowQuery logs a slow query, with its plan if it's sampled for an EXPLAIN.
+// Explained queries are logged once the plan is known, without holding up the caller.
+func (l GormLogger) logSlowQuery(sql string, fields []zap.Field) {
+	if !l.explainer.sample(sql) {
+		slowQueries.Inc("false")
+		l.Logger.Warn("Slow SQL query", fields...)
+		return
+	}
+
+	go func() {
+		plan, err := l.explainer.explain(sql)
+		if err != nil {
+			slowQueries.Inc("false")
+			l.Logger.Warn("Slow SQL query", append(fields, zap.NamedError("explain_error", err))...)
+			return
+		}
+		slowQueries.Inc("true")
+
+		for _, row := range plan {
+			if fmt.Sprint(row["type"]) == "ALL" {
+				fullScans.Inc(fmt.Sprint(row["table"]))
+			}
+		}
+		l.Logger.Warn("Slow SQL query", append(fields, zap.Any("plan", plan))...)
+	}()
+}
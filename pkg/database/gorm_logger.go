@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// ErrInvalidSQLLogLevel is returned for SQL log levels other than silent, error, warn and info
+var ErrInvalidSQLLogLevel = apperrors.Invalid("invalid SQL log level, expected silent, error, warn or info")
+
+// ErrInvalidSQLExplainRatio is returned for explain ratios outside 0 to 1
+var ErrInvalidSQLExplainRatio = apperrors.Invalid("invalid explain_ratio, expected a number between 0 and 1")
+
+// sqlLogLevels maps the names of LOG_SQL_LEVEL to GORM log levels
+var sqlLogLevels = map[string]gormlogger.LogLevel{
+	"silent": gormlogger.Silent,
+	"error":  gormlogger.Error,
+	"warn":   gormlogger.Warn,
+	"info":   gormlogger.Info,
+}
+
+// sqlLog holds the SQL log settings shared by every connection of the process,
+// so they can be changed at runtime through the DatabaseService
+var sqlLog sqlLogSettings
+
+// sqlLogSettings are the SQL log settings of the process
+type sqlLogSettings struct {
+	once          sync.Once
+	level         atomic.Int32
+	slowThreshold atomic.Int64
+	// explainBits holds the float64 bits of the fraction of slow queries explained
+	explainBits atomic.Uint64
+}
+
+// explainRatio returns the fraction of slow queries explained
+func (s *sqlLogSettings) explainRatio() float64 {
+	return math.Float64frombits(s.explainBits.Load())
+}
+
+// configureSQLLog applies LOG_SQL_LEVEL and LOG_SQL_SLOW_THRESHOLD the first
+// time a connection is opened, later connections keep changes made at runtime
+func configureSQLLog(cfg *config.Config) {
+	sqlLog.once.Do(func() {
+		level, ok := sqlLogLevels[cfg.Logging.SQLLevel]
+		if !ok {
+			level = gormlogger.Info
+		}
+		sqlLog.level.Store(int32(level))
+		sqlLog.slowThreshold.Store(int64(cfg.Logging.SQLSlowThreshold))
+		sqlLog.explainBits.Store(math.Float64bits(cfg.Logging.SQLExplainRatio))
+	})
+}
+
+// SQLLogSettings returns the current SQL log level, slow query threshold and
+// fraction of slow queries explained
+func SQLLogSettings() (string, time.Duration, float64) {
+	level := gormlogger.LogLevel(sqlLog.level.Load())
+	name := ""
+	for levelName, value := range sqlLogLevels {
+		if value == level {
+			name = levelName
+		}
+	}
+	return name, time.Duration(sqlLog.slowThreshold.Load()), sqlLog.explainRatio()
+}
+
+// SetSQLLogLevel changes the SQL log level of every connection of the process
+func SetSQLLogLevel(name string) error {
+	level, ok := sqlLogLevels[name]
+	if !ok {
+		return ErrInvalidSQLLogLevel
+	}
+	sqlLog.level.Store(int32(level))
+	return nil
+}
+
+// SetSQLSlowThreshold changes the duration above which queries are logged as
+// slow for every connection of the process, 0 disables slow query logs
+func SetSQLSlowThreshold(threshold time.Duration) {
+	sqlLog.slowThreshold.Store(int64(threshold))
+}
+
+// SetSQLExplainRatio changes the fraction of slow queries whose plan is logged
+// with them for every connection of the process, 0 disables EXPLAINs
+func SetSQLExplainRatio(ratio float64) error {
+	if ratio < 0 || ratio > 1 {
+		return ErrInvalidSQLExplainRatio
+	}
+	sqlLog.explainBits.Store(math.Float64bits(ratio))
+	return nil
+}
+
+// GormLogger is a GORM logger that writes to zap. It follows the process's
+// SQL log settings unless a session sets its own level, e.g. with db.Debug().
+type GormLogger struct {
+	Logger *zap.Logger
+	// level overrides the process's SQL log level when set
+	level     gormlogger.LogLevel
+	explainer *explainer
+}
+
+// NewGormLogger creates a GORM logger following the process's SQL log settings
+func NewGormLogger(logger *zap.Logger) GormLogger {
+	return GormLogger{
+		Logger:    logger,
+		explainer: newExplainer(),
+	}
+}
+
+// LogMode sets the log level of a session
+func (l GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	newLogger := l
+	newLogger.level = level
+	return newLogger
+}
+
+// logLevel returns the level of the session, or of the process if it has none
+func (l GormLogger) logLevel() gormlogger.LogLevel {
+	if l.level != 0 {
+		return l.level
+	}
+	return gormlogger.LogLevel(sqlLog.level.Load())
+}
+
+// Info logs info
+func (l GormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.logLevel() >= gormlogger.Info {
+		l.Logger.Sugar().Infof(msg, data...)
+	}
+}
+
+// Warn logs warning
+func (l GormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.logLevel() >= gormlogger.Warn {
+		l.Logger.Sugar().Warnf(msg, data...)
+	}
+}
+
+// Error logs error
+func (l GormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.logLevel() >= gormlogger.Error {
+		l.Logger.Sugar().Errorf(msg, data...)
+	}
+}
+
+// Trace logs SQL trace
+func (l GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	level := l.logLevel()
+	if level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	slowThreshold := time.Duration(sqlLog.slowThreshold.Load())
+	sql, rows := fc()
+	fields := []zap.Field{
+		zap.String("sql", sql),
+		zap.Int64("rows", rows),
+		zap.Duration("elapsed", elapsed),
+	}
+
+	switch {
+	case err != nil && level >= gormlogger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		l.Logger.Error("SQL error", append(fields, zap.Error(err))...)
+	case elapsed > slowThreshold && slowThreshold != 0 && level >= gormlogger.Warn:
+		l.logSlowQuery(sql, fields)
+	case level >= gormlogger.Info:
+		l.Logger.Debug("SQL query", fields...)
+	}
+}
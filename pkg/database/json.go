@@ -0,0 +1,80 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrJSONUnsupported is returned for JSON queries on databases without JSON functions
+var ErrJSONUnsupported = errors.New("JSON queries are not supported by the database")
+
+// JSONMap is a JSON object column, JSON on MySQL and JSONB on PostgreSQL.
+// A nil map is stored as NULL.
+type JSONMap map[string]interface{}
+
+// Value encodes the map for the database
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(map[string]interface{}(m))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan decodes the map from the database
+func (m *JSONMap) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("can't scan %T into a JSON map", value)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*m = decoded
+	return nil
+}
+
+// GormDataType returns the data type of the column for GORM
+func (JSONMap) GormDataType() string {
+	return "json"
+}
+
+// GormDBDataType returns the column type for the database
+func (JSONMap) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "JSONB"
+	}
+	return "JSON"
+}
+
+// JSONText returns an expression for the text of a top-level key of a JSON
+// column, e.g. to compare it with a value. Strings are unquoted, numbers and
+// booleans are written as in JSON. The key must not contain double quotes.
+func JSONText(db *gorm.DB, column, key string) (string, []interface{}, error) {
+	switch db.Dialector.Name() {
+	case "mysql":
+		return "JSON_UNQUOTE(JSON_EXTRACT(" + column + ", ?))", []interface{}{`$."` + key + `"`}, nil
+	case "postgres":
+		return column + " ->> ?", []interface{}{key}, nil
+	default:
+		return "", nil, ErrJSONUnsupported
+	}
+}
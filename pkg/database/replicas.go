@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// UseReadReplicas sends the reads of db outside transactions to the replicas,
+// given as host:port and sharing the credentials of cfg. Writes and transactions
+// stay on the primary, as do queries whose context is marked with WithPrimary.
+func UseReadReplicas(db *gorm.DB, cfg config.DatabaseConfig, replicas []string) error {
+	if cfg.Driver != "mysql" {
+		return fmt.Errorf("read replicas are not supported for database driver: %s", cfg.Driver)
+	}
+
+	dialectors := make([]gorm.Dialector, 0, len(replicas))
+	for _, replica := range replicas {
+		replicaCfg := cfg
+		host, port, err := net.SplitHostPort(replica)
+		if err != nil {
+			// Without a port the replica listens on the primary's
+			host = replica
+		} else if replicaCfg.Port, err = strconv.Atoi(port); err != nil {
+			return fmt.Errorf("invalid read replica address %q", replica)
+		}
+		replicaCfg.Host = host
+		dialectors = append(dialectors, mysql.Open(replicaCfg.GetDSN()))
+	}
+
+	return db.Use(dbresolver.Register(dbresolver.Config{Replicas: dialectors}))
+}
+
+// primaryKey is the context key marking reads that must see the latest writes
+type primaryKey struct{}
+
+// WithPrimary returns a context whose reads go to the primary even when read
+// replicas are used, e.g. to read a record right after writing it
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// readsPrimary reports whether the reads of a context must go to the primary
+func readsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
@@ -0,0 +1,259 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// ErrDuplicate is returned when a write violates a unique constraint
+var ErrDuplicate = errors.New("duplicate record")
+
+// Scope narrows a query, see gorm.DB.Scopes
+type Scope func(db *gorm.DB) *gorm.DB
+
+// Repository provides the common operations on a model so entity repositories
+// only implement what is specific to them.
+//
+// Records are looked up by their "id" column. Models with a gorm.DeletedAt field
+// are soft deleted and hidden from queries unless WithDeleted is used.
+type Repository[T any] struct {
+	db           *gorm.DB
+	notFound     error
+	tenantColumn string
+}
+
+// RepositoryOption configures a Repository
+type RepositoryOption func(*repositoryOptions)
+
+// repositoryOptions holds the optional settings of a Repository
+type repositoryOptions struct {
+	tenantColumn string
+}
+
+// WithTenantColumn scopes every query to the tenant in the context (see WithTenant)
+// by the given column. Queries without a tenant in the context are not scoped.
+func WithTenantColumn(column string) RepositoryOption {
+	return func(o *repositoryOptions) {
+		o.tenantColumn = column
+	}
+}
+
+// NewRepository creates a repository for the model T.
+// notFound is returned when a record doesn't exist, e.g. ErrUserNotFound.
+func NewRepository[T any](db *gorm.DB, notFound error, opts ...RepositoryOption) *Repository[T] {
+	var options repositoryOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &Repository[T]{
+		db:           db,
+		notFound:     notFound,
+		tenantColumn: options.tenantColumn,
+	}
+}
+
+// WithDB returns a copy of the repository running on db, e.g. a transaction
+func (r *Repository[T]) WithDB(db *gorm.DB) *Repository[T] {
+	copied := *r
+	copied.db = db
+	return &copied
+}
+
+// Query starts a query on the model with the context and tenant applied
+func (r *Repository[T]) Query(ctx context.Context, scopes ...Scope) *gorm.DB {
+	db := r.db.WithContext(ctx).Model(new(T))
+	if readsPrimary(ctx) {
+		db = db.Clauses(dbresolver.Write)
+	}
+
+	if r.tenantColumn != "" {
+		if tenant, ok := TenantFromContext(ctx); ok {
+			db = db.Where(r.tenantColumn+" = ?", tenant)
+		}
+	}
+
+	for _, scope := range scopes {
+		db = scope(db)
+	}
+	return db
+}
+
+// Get returns the record with the given ID, loading only the given columns if any
+func (r *Repository[T]) Get(ctx context.Context, id string, columns ...string) (*T, error) {
+	return r.First(ctx, Columns(columns...), Where("id = ?", id))
+}
+
+// First returns the first record matching the scopes
+func (r *Repository[T]) First(ctx context.Context, scopes ...Scope) (*T, error) {
+	var record T
+	if err := r.Query(ctx, scopes...).First(&record).Error; err != nil {
+		return nil, r.translate(err)
+	}
+	return &record, nil
+}
+
+// List returns a page of records matching the scopes along with the total number of matches
+func (r *Repository[T]) List(ctx context.Context, page, pageSize int, scopes ...Scope) ([]*T, int, error) {
+	var total int64
+	if err := r.Query(ctx, scopes...).Count(&total).Error; err != nil {
+		return nil, 0, r.translate(err)
+	}
+
+	// Scan into a contiguous slice rather than allocating every row separately
+	records := make([]T, 0, pageSize)
+	if err := r.Query(ctx, scopes...).Scopes(Paginate(page, pageSize)).Find(&records).Error; err != nil {
+		return nil, 0, r.translate(err)
+	}
+
+	result := make([]*T, len(records))
+	for i := range records {
+		result[i] = &records[i]
+	}
+	return result, int(total), nil
+}
+
+// Count returns the number of records matching the scopes
+func (r *Repository[T]) Count(ctx context.Context, scopes ...Scope) (int64, error) {
+	var count int64
+	if err := r.Query(ctx, scopes...).Count(&count).Error; err != nil {
+		return 0, r.translate(err)
+	}
+	return count, nil
+}
+
+// Create inserts a record
+func (r *Repository[T]) Create(ctx context.Context, record *T) error {
+	return r.translate(r.db.WithContext(ctx).Create(record).Error)
+}
+
+// Save updates every field of a record
+func (r *Repository[T]) Save(ctx context.Context, record *T) error {
+	return r.translate(r.db.WithContext(ctx).Save(record).Error)
+}
+
+// Update sets the given columns of the record with the given ID.
+// Additional scopes can guard the update, e.g. on an expected status;
+// the not found error is returned when no record matched.
+func (r *Repository[T]) Update(ctx context.Context, id string, updates map[string]interface{}, scopes ...Scope) error {
+	result := r.Query(ctx, scopes...).Where("id = ?", id).Updates(updates)
+	if result.Error != nil {
+		return r.translate(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return r.notFound
+	}
+	return nil
+}
+
+// Delete deletes the record with the given ID, softly if the model supports it
+func (r *Repository[T]) Delete(ctx context.Context, id string, scopes ...Scope) error {
+	result := r.Query(ctx, scopes...).Where("id = ?", id).Delete(new(T))
+	if result.Error != nil {
+		return r.translate(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return r.notFound
+	}
+	return nil
+}
+
+// Ping checks the database connection
+func (r *Repository[T]) Ping(ctx context.Context) error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// translate maps GORM errors to the repository's errors
+func (r *Repository[T]) translate(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return r.notFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrDuplicate
+	default:
+		return err
+	}
+}
+
+// Where filters records, see gorm.DB.Where
+func Where(query interface{}, args ...interface{}) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(query, args...)
+	}
+}
+
+// OrderBy sorts records, e.g. "created_at DESC"
+func OrderBy(order string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order(order)
+	}
+}
+
+// Paginate selects a page of records, pages start at 1
+func Paginate(page, pageSize int) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		if page < 1 {
+			page = 1
+		}
+		return db.Offset((page - 1) * pageSize).Limit(pageSize)
+	}
+}
+
+// Columns restricts a query to the given columns. The primary key is always
+// loaded so records can be identified; no columns loads all of them.
+func Columns(columns ...string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(columns) == 0 {
+			return db
+		}
+
+		selected := []string{"id"}
+		for _, column := range columns {
+			if column != "id" {
+				selected = append(selected, column)
+			}
+		}
+		return db.Select(selected)
+	}
+}
+
+// WithDeleted includes soft deleted records
+func WithDeleted() Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}
+}
+
+// tenantKey is the context key of the current tenant
+type tenantKey struct{}
+
+// WithTenant returns a context whose repository queries are scoped to the tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set with WithTenant
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// TenantOrDefault returns the tenant set with WithTenant, or the default
+// tenant, e.g. for records created while tenancy is disabled
+func TenantOrDefault(ctx context.Context) string {
+	if tenant, ok := TenantFromContext(ctx); ok {
+		return tenant
+	}
+	return config.DefaultTenant
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	databasepb "github.com/linkeunid/hello-go/api/gen/database"
+	"github.com/linkeunid/hello-go/pkg/config"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// ErrInvalidSlowThreshold is returned for slow query thresholds that aren't a positive duration or 0
+var ErrInvalidSlowThreshold = apperrors.Invalid("invalid slow_threshold, expected a positive duration like 500ms or 0")
+
+// Authorizer checks that the caller may change the SQL log settings, typically an admin
+type Authorizer func(ctx context.Context) error
+
+// Server implements the DatabaseService gRPC service on the process's SQL log settings
+type Server struct {
+	databasepb.UnimplementedDatabaseServiceServer
+	service   string
+	authorize Authorizer
+	logger    *zap.Logger
+}
+
+// NewServer creates a DatabaseService for the database connections of a service
+func NewServer(cfg *config.Config, service string, authorize Authorizer, logger *zap.Logger) *Server {
+	// Services without a connection, e.g. with mock services, still report the configured settings
+	configureSQLLog(cfg)
+
+	return &Server{
+		service:   service,
+		authorize: authorize,
+		logger:    logger,
+	}
+}
+
+// GetSQLLogging returns the current SQL log settings
+func (s *Server) GetSQLLogging(ctx context.Context, req *databasepb.GetSQLLoggingRequest) (*databasepb.SQLLogging, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return s.settings(), nil
+}
+
+// UpdateSQLLogging changes the given SQL log settings, the others are kept
+func (s *Server) UpdateSQLLogging(ctx context.Context, req *databasepb.UpdateSQLLoggingRequest) (*databasepb.SQLLogging, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	// Validate every setting before changing any, the level is checked as it's set first
+	var threshold time.Duration
+	if req.SlowThreshold != "" {
+		var err error
+		if threshold, err = time.ParseDuration(req.SlowThreshold); err != nil || threshold < 0 {
+			return nil, apperrors.MapToStatus(ErrInvalidSlowThreshold, "failed to update SQL logging")
+		}
+	}
+	if req.ExplainRatio != nil {
+		if ratio := req.ExplainRatio.GetValue(); ratio < 0 || ratio > 1 {
+			return nil, apperrors.MapToStatus(ErrInvalidSQLExplainRatio, "failed to update SQL logging")
+		}
+	}
+	if req.Level != "" {
+		if err := SetSQLLogLevel(req.Level); err != nil {
+			return nil, apperrors.MapToStatus(err, "failed to update SQL logging")
+		}
+	}
+	if req.SlowThreshold != "" {
+		SetSQLSlowThreshold(threshold)
+	}
+	if req.ExplainRatio != nil {
+		if err := SetSQLExplainRatio(req.ExplainRatio.GetValue()); err != nil {
+			return nil, apperrors.MapToStatus(err, "failed to update SQL logging")
+		}
+	}
+
+	settings := s.settings()
+	s.logger.Info("SQL logging changed",
+		zap.String("level", settings.Level),
+		zap.String("slow_threshold", settings.SlowThreshold),
+		zap.Float64("explain_ratio", settings.ExplainRatio))
+
+	return settings, nil
+}
+
+// settings returns the current SQL log settings of the service
+func (s *Server) settings() *databasepb.SQLLogging {
+	level, threshold, explainRatio := SQLLogSettings()
+	return &databasepb.SQLLogging{
+		Service:       s.service,
+		Level:         level,
+		SlowThreshold: threshold.String(),
+		ExplainRatio:  explainRatio,
+	}
+}
@@ -0,0 +1,65 @@
+package debugtoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxLifetime limits how long a debug token is valid, so leaked tokens expire soon
+const MaxLifetime = 24 * time.Hour
+
+// Errors returned for invalid debug tokens
+var (
+	ErrNoKey     = errors.New("no debug key configured")
+	ErrMalformed = errors.New("malformed debug token")
+	ErrSignature = errors.New("invalid debug token signature")
+	ErrExpired   = errors.New("debug token expired")
+	ErrLifetime  = errors.New("debug token valid for too long")
+)
+
+// Sign returns a debug token valid until expires, in the form
+// "<expiry unix seconds>.<hex HMAC-SHA256 of the expiry with key>"
+func Sign(key string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return expiry + "." + signature(key, expiry)
+}
+
+// Verify checks that token was signed with key and is valid at now
+func Verify(key, token string, now time.Time) error {
+	if key == "" {
+		return ErrNoKey
+	}
+
+	expiry, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrMalformed
+	}
+	seconds, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return ErrMalformed
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(key, expiry))) {
+		return ErrSignature
+	}
+
+	expires := time.Unix(seconds, 0)
+	if !now.Before(expires) {
+		return ErrExpired
+	}
+	if expires.Sub(now) > MaxLifetime {
+		return ErrLifetime
+	}
+	return nil
+}
+
+// signature returns the hex HMAC-SHA256 of the expiry
+func signature(key, expiry string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
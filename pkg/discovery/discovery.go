@@ -0,0 +1,122 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/handoff"
+	"github.com/linkeunid/hello-go/pkg/httpclient"
+)
+
+// regionMeta is the metadata holding the REGION of registered instances
+const regionMeta = "region"
+
+// Registration is a service instance registered with the Consul agent at
+// SERVICE_DISCOVERY_URL. The instance is registered on its gRPC port, with the
+// HTTP port in the "http_port" metadata, so ports picked for port 0 can be found,
+// and its REGION in the "region" metadata.
+type Registration struct {
+	id     string
+	url    string
+	client *httpclient.Client
+	logger *zap.Logger
+}
+
+// Register registers a service instance listening on the given listeners. It
+// returns nil without registering unless SERVICE_DISCOVERY_REGISTER is set.
+func Register(ctx context.Context, cfg *config.Config, service string, grpcListener, httpListener net.Listener, logger *zap.Logger) (*Registration, error) {
+	if !cfg.ServiceDiscovery.Register {
+		return nil, nil
+	}
+
+	grpcPort, httpPort := handoff.Port(grpcListener), handoff.Port(httpListener)
+	if grpcPort == 0 {
+		return nil, fmt.Errorf("the %s gRPC listener isn't a TCP port and can't be registered", service)
+	}
+
+	host := cfg.ServiceDiscovery.AdvertiseHost
+	if host == "" {
+		var err error
+		if host, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to get host name, set SERVICE_DISCOVERY_ADVERTISE_HOST: %w", err)
+		}
+	}
+
+	url := cfg.ServiceDiscovery.URL
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+
+	r := &Registration{
+		id:     fmt.Sprintf("%s-%s-%d", service, host, grpcPort),
+		url:    strings.TrimSuffix(url, "/"),
+		client: httpclient.New("service_discovery", cfg, logger),
+		logger: logger,
+	}
+
+	meta := map[string]string{}
+	if httpPort != 0 {
+		meta["http_port"] = strconv.Itoa(httpPort)
+	}
+	if cfg.Region != "" {
+		meta[regionMeta] = cfg.Region
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"ID":      r.id,
+		"Name":    service,
+		"Address": host,
+		"Port":    grpcPort,
+		"Meta":    meta,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := r.put(ctx, "/v1/agent/service/register", body); err != nil {
+		return nil, fmt.Errorf("failed to register with service discovery: %w", err)
+	}
+
+	logger.Info("Registered with service discovery",
+		zap.String("id", r.id),
+		zap.String("address", host),
+		zap.Int("grpc_port", grpcPort),
+		zap.Int("http_port", httpPort),
+		zap.String("region", cfg.Region))
+	return r, nil
+}
+
+// Deregister removes the registration, it does nothing for a nil registration
+func (r *Registration) Deregister(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	if err := r.put(ctx, "/v1/agent/service/deregister/"+r.id, nil); err != nil {
+		return fmt.Errorf("failed to deregister from service discovery: %w", err)
+	}
+	r.logger.Info("Deregistered from service discovery", zap.String("id", r.id))
+	return nil
+}
+
+// put sends a request to the agent API
+func (r *Registration) put(ctx context.Context, path string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, r.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return httpclient.DecodeJSON(resp, nil)
+}
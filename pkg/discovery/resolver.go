@@ -0,0 +1,202 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	mathrand "math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/httpclient"
+)
+
+// Scheme is the scheme of gRPC targets resolved through the Consul agent, e.g. "consul:///auth"
+const Scheme = "consul"
+
+// resolveInterval is how often the instances of a service are looked up again
+const resolveInterval = 10 * time.Second
+
+// resolverBuilder builds resolvers for consul:///<service> targets
+type resolverBuilder struct {
+	url    string
+	region string
+	client *httpclient.Client
+	logger *zap.Logger
+}
+
+// NewResolverBuilder returns the gRPC resolver of consul:///<service> targets,
+// registered with grpc.WithResolvers. It resolves the passing instances of the
+// service registered with the Consul agent at SERVICE_DISCOVERY_URL, only the
+// ones of the instance's REGION when it has any, so calls stay in the region
+// and fail over to the others when none of its instances is healthy.
+//
+// Addresses are shuffled on every resolution, so the connections of a channel
+// pool using pick_first spread over the instances.
+func NewResolverBuilder(cfg *config.Config, logger *zap.Logger) resolver.Builder {
+	agentURL := cfg.ServiceDiscovery.URL
+	if !strings.Contains(agentURL, "://") {
+		agentURL = "http://" + agentURL
+	}
+
+	return &resolverBuilder{
+		url:    strings.TrimSuffix(agentURL, "/"),
+		region: cfg.Region,
+		client: httpclient.New("service_discovery", cfg, logger),
+		logger: logger,
+	}
+}
+
+// Build starts resolving the service of a target
+func (b *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	service := strings.TrimPrefix(target.Endpoint(), "/")
+	if service == "" {
+		return nil, fmt.Errorf("missing service name in target %q, expected consul:///<service>", target.URL.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &consulResolver{
+		builder: b,
+		service: service,
+		cc:      cc,
+		cancel:  cancel,
+		resolve: make(chan struct{}, 1),
+	}
+	r.wg.Add(1)
+	go r.watch(ctx)
+	return r, nil
+}
+
+// Scheme returns the scheme of the targets the builder resolves
+func (b *resolverBuilder) Scheme() string {
+	return Scheme
+}
+
+// consulResolver keeps the addresses of a service's instances up to date
+type consulResolver struct {
+	builder *resolverBuilder
+	service string
+	cc      resolver.ClientConn
+	cancel  context.CancelFunc
+	resolve chan struct{}
+	wg      sync.WaitGroup
+	// resolved and local tell whether the last resolution found instances in
+	// the region, changes are logged
+	resolved bool
+	local    bool
+}
+
+// ResolveNow looks the instances up again, e.g. after a connection failed
+func (r *consulResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolve <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops resolving
+func (r *consulResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// watch resolves the service until the resolver is closed
+func (r *consulResolver) watch(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(resolveInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.update(ctx); err != nil && ctx.Err() == nil {
+			r.builder.logger.Warn("Failed to resolve service",
+				zap.String("service", r.service),
+				zap.Error(err))
+			r.cc.ReportError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.resolve:
+		}
+	}
+}
+
+// consulInstance is an entry of the agent's health API
+type consulInstance struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+		Meta    map[string]string
+	}
+}
+
+// update sends the addresses of the service's passing instances to the channel
+func (r *consulResolver) update(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		r.builder.url+"/v1/health/service/"+url.PathEscape(r.service)+"?passing=true", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.builder.client.Do(req)
+	if err != nil {
+		return err
+	}
+	var instances []consulInstance
+	if err := httpclient.DecodeJSON(resp, &instances); err != nil {
+		return err
+	}
+
+	var all, local []resolver.Address
+	for _, instance := range instances {
+		host := instance.Service.Address
+		if host == "" {
+			host = instance.Node.Address
+		}
+		address := resolver.Address{Addr: net.JoinHostPort(host, strconv.Itoa(instance.Service.Port))}
+		all = append(all, address)
+		if r.builder.region != "" && instance.Service.Meta[regionMeta] == r.builder.region {
+			local = append(local, address)
+		}
+	}
+	if len(all) == 0 {
+		return fmt.Errorf("no passing instance of %s", r.service)
+	}
+
+	addresses := all
+	if len(local) > 0 {
+		addresses = local
+	}
+	if r.builder.region != "" && (!r.resolved || r.local != (len(local) > 0)) {
+		if len(local) > 0 {
+			r.builder.logger.Info("Calling instances in the region",
+				zap.String("service", r.service),
+				zap.String("region", r.builder.region),
+				zap.Int("instances", len(local)))
+		} else {
+			r.builder.logger.Warn("No instance in the region, calling other regions",
+				zap.String("service", r.service),
+				zap.String("region", r.builder.region),
+				zap.Int("instances", len(all)))
+		}
+	}
+	r.resolved, r.local = true, len(local) > 0
+
+	mathrand.Shuffle(len(addresses), func(i, j int) {
+		addresses[i], addresses[j] = addresses[j], addresses[i]
+	})
+	return r.cc.UpdateState(resolver.State{Addresses: addresses})
+}
@@ -0,0 +1,196 @@
+package errors
+
+import (
+	"errors"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Kind classifies domain errors by how callers should react to them
+type Kind int
+
+// Error kinds
+const (
+	// KindInternal is an unexpected failure, its details are not shown to clients
+	KindInternal Kind = iota
+	// KindNotFound means the requested entity doesn't exist
+	KindNotFound
+	// KindAlreadyExists means the entity (or a unique attribute of it) already exists
+	KindAlreadyExists
+	// KindPermissionDenied means the caller may not perform the operation
+	KindPermissionDenied
+	// KindUnauthenticated means the caller's credentials are missing or invalid
+	KindUnauthenticated
+	// KindInvalid means the request is malformed
+	KindInvalid
+	// KindFailedPrecondition means the request is valid but the entity's state doesn't allow it
+	KindFailedPrecondition
+	// KindUnavailable means a dependency is temporarily unavailable and the request can be retried
+	KindUnavailable
+	// KindResourceExhausted means the caller ran out of a quota, e.g. a rate limit, and can retry later
+	KindResourceExhausted
+	// KindAborted means the operation conflicted with a concurrent change, e.g. a
+	// stale etag, and can be retried after reading the entity again
+	KindAborted
+)
+
+// codes maps error kinds to gRPC status codes
+var kindCodes = map[Kind]codes.Code{
+	KindInternal:           codes.Internal,
+	KindNotFound:           codes.NotFound,
+	KindAlreadyExists:      codes.AlreadyExists,
+	KindPermissionDenied:   codes.PermissionDenied,
+	KindUnauthenticated:    codes.Unauthenticated,
+	KindInvalid:            codes.InvalidArgument,
+	KindFailedPrecondition: codes.FailedPrecondition,
+	KindUnavailable:        codes.Unavailable,
+	KindResourceExhausted:  codes.ResourceExhausted,
+	KindAborted:            codes.Aborted,
+}
+
+// Error is a domain error. Its message is returned to clients as is.
+type Error struct {
+	Kind    Kind
+	Message string
+	// Violations lists the invalid fields of a request, returned to clients as a BadRequest detail
+	Violations []FieldViolation
+}
+
+// FieldViolation describes why a field of a request is invalid
+type FieldViolation struct {
+	// Field is the path of the field, e.g. "email"
+	Field       string
+	Description string
+}
+
+// Violations collects every invalid field of a request, so clients can show
+// all problems at once rather than one per attempt
+type Violations []FieldViolation
+
+// Add records an invalid field
+func (v *Violations) Add(field, description string) {
+	*v = append(*v, FieldViolation{Field: field, Description: description})
+}
+
+// Err returns an Invalid error listing the violations, or nil if there are none
+func (v Violations) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+
+	parts := make([]string, len(v))
+	for i, violation := range v {
+		parts[i] = violation.Field + ": " + violation.Description
+	}
+	return &Error{Kind: KindInvalid, Message: strings.Join(parts, "; "), Violations: v}
+}
+
+// Error returns the message of the error
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NotFound creates an error for a missing entity
+func NotFound(message string) *Error {
+	return &Error{Kind: KindNotFound, Message: message}
+}
+
+// AlreadyExists creates an error for a conflicting entity
+func AlreadyExists(message string) *Error {
+	return &Error{Kind: KindAlreadyExists, Message: message}
+}
+
+// PermissionDenied creates an error for a forbidden operation
+func PermissionDenied(message string) *Error {
+	return &Error{Kind: KindPermissionDenied, Message: message}
+}
+
+// Unauthenticated creates an error for missing or invalid credentials
+func Unauthenticated(message string) *Error {
+	return &Error{Kind: KindUnauthenticated, Message: message}
+}
+
+// Invalid creates an error for a malformed request
+func Invalid(message string) *Error {
+	return &Error{Kind: KindInvalid, Message: message}
+}
+
+// FailedPrecondition creates an error for an operation the entity's state doesn't allow
+func FailedPrecondition(message string) *Error {
+	return &Error{Kind: KindFailedPrecondition, Message: message}
+}
+
+// Unavailable creates an error for a temporarily unavailable dependency
+func Unavailable(message string) *Error {
+	return &Error{Kind: KindUnavailable, Message: message}
+}
+
+// ResourceExhausted creates an error for a caller out of quota
+func ResourceExhausted(message string) *Error {
+	return &Error{Kind: KindResourceExhausted, Message: message}
+}
+
+// Aborted creates an error for an operation that conflicted with a concurrent change
+func Aborted(message string) *Error {
+	return &Error{Kind: KindAborted, Message: message}
+}
+
+// KindOf returns the kind of the first domain error in err's chain,
+// or KindInternal if there is none
+func KindOf(err error) Kind {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr.Kind
+	}
+	return KindInternal
+}
+
+// MapToStatus converts an error to a gRPC status error.
+//
+// Domain errors keep their message, gRPC status errors are passed through and
+// anything else becomes Internal with the given message, so internal details
+// never reach clients.
+func MapToStatus(err error, internalMessage string) error {
+	if err == nil {
+		return nil
+	}
+
+	var domainErr *Error
+	if errors.As(err, &domainErr) && domainErr.Kind != KindInternal {
+		st := status.New(kindCodes[domainErr.Kind], domainErr.Message)
+		if len(domainErr.Violations) > 0 {
+			badRequest := &errdetails.BadRequest{}
+			for _, violation := range domainErr.Violations {
+				badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+					Field:       violation.Field,
+					Description: violation.Description,
+				})
+			}
+			if withDetails, err := st.WithDetails(badRequest); err == nil {
+				st = withDetails
+			}
+		}
+		return st.Err()
+	}
+
+	if st, ok := status.FromError(err); ok && st.Code() != codes.Unknown {
+		return err
+	}
+
+	return status.Error(codes.Internal, internalMessage)
+}
+
+// Log logs a failed operation, as a warning for domain errors the client
+// caused and as an error for internal failures
+func Log(logger *zap.Logger, msg string, err error, fields ...zap.Field) {
+	fields = append(fields, zap.Error(err))
+	if KindOf(err) == KindInternal {
+		logger.Error(msg, fields...)
+		return
+	}
+	logger.Warn(msg, fields...)
+}
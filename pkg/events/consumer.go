@@ -0,0 +1,139 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// ErrUnknownSchema is returned for payloads whose message isn't linked into the consumer
+var ErrUnknownSchema = errors.New("unknown event schema")
+
+// Handler handles an event. Events are delivered at least once, handlers must
+// be idempotent.
+type Handler func(ctx context.Context, event Event) error
+
+// Middleware wraps a handler, e.g. to log or retry it
+type Middleware func(Handler) Handler
+
+// Upgrader converts a payload to the next version of its message, e.g. an
+// events.v1.X to an events.v2.X
+type Upgrader func(proto.Message) (proto.Message, error)
+
+// Consumer dispatches events to the handlers of their types, so every consumer
+// decodes, upgrades and wraps events the same way
+type Consumer struct {
+	handlers   map[string]Handler
+	upgraders  map[protoreflect.FullName]Upgrader
+	middleware []Middleware
+	logger     *zap.Logger
+}
+
+// NewConsumer creates a consumer without handlers
+func NewConsumer(logger *zap.Logger) *Consumer {
+	return &Consumer{
+		handlers:  make(map[string]Handler),
+		upgraders: make(map[protoreflect.FullName]Upgrader),
+		logger:    logger,
+	}
+}
+
+// Use adds middleware to every handler, the first one added runs outermost
+func (c *Consumer) Use(middleware ...Middleware) {
+	c.middleware = append(c.middleware, middleware...)
+}
+
+// HandleFunc registers the handler of an event type, replacing any previous one
+func (c *Consumer) HandleFunc(eventType string, handler Handler) {
+	c.handlers[eventType] = handler
+}
+
+// Types returns the event types with a handler, sorted
+func (c *Consumer) Types() []string {
+	types := make([]string, 0, len(c.handlers))
+	for eventType := range c.handlers {
+		types = append(types, eventType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Upgrade registers how payloads of an older message are upgraded. Payloads
+// are upgraded step by step until they're the message the handler expects.
+func (c *Consumer) Upgrade(from proto.Message, upgrader Upgrader) {
+	c.upgraders[from.ProtoReflect().Descriptor().FullName()] = upgrader
+}
+
+// Handle registers the handler of an event type whose payload is the message
+// M, a type of api/gen/events. Payloads are decoded, and upgraded if they're
+// an older version, before the handler is called. Payloads that can't be
+// decoded fail with a permanent error.
+func Handle[M proto.Message](c *Consumer, eventType string, handler func(ctx context.Context, event Event, payload M) error) {
+	var zero M
+	want := zero.ProtoReflect().Type()
+
+	c.HandleFunc(eventType, func(ctx context.Context, event Event) error {
+		payload, err := c.decode(event, want)
+		if err != nil {
+			return Permanent(fmt.Errorf("failed to decode %s event %d: %w", event.Type, event.ID, err))
+		}
+		return handler(ctx, event, payload.(M))
+	})
+}
+
+// Dispatch passes an event through the middleware to the handler of its
+// type. Events without a handler are skipped.
+func (c *Consumer) Dispatch(ctx context.Context, event Event) error {
+	handler, ok := c.handlers[event.Type]
+	if !ok {
+		c.logger.Debug("No handler for event, skipping",
+			zap.String("type", event.Type),
+			zap.Uint64("id", event.ID))
+		return nil
+	}
+
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		handler = c.middleware[i](handler)
+	}
+	return handler(ctx, event)
+}
+
+// decode decodes an event's payload and upgrades it to the wanted message.
+// Events without a schema were published before payloads had one, they're
+// decoded as the wanted message.
+func (c *Consumer) decode(event Event, want protoreflect.MessageType) (proto.Message, error) {
+	messageType := want
+	if event.Schema != "" && protoreflect.FullName(event.Schema) != want.Descriptor().FullName() {
+		var err error
+		messageType, err = protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(event.Schema))
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", ErrUnknownSchema, event.Schema)
+		}
+	}
+
+	// Fields added after the consumer was built are ignored
+	payload := messageType.New().Interface()
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(event.Data, payload); err != nil {
+		return nil, err
+	}
+
+	for payload.ProtoReflect().Descriptor().FullName() != want.Descriptor().FullName() {
+		name := payload.ProtoReflect().Descriptor().FullName()
+		upgrade, ok := c.upgraders[name]
+		if !ok {
+			return nil, fmt.Errorf("no upgrade from %s to %s", name, want.Descriptor().FullName())
+		}
+		var err error
+		if payload, err = upgrade(payload); err != nil {
+			return nil, fmt.Errorf("failed to upgrade %s: %w", name, err)
+		}
+	}
+	return payload, nil
+}
@@ -0,0 +1,87 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Record is the database representation of an event.
+// The auto-increment ID gives consumers a total order to track offsets against.
+type Record struct {
+	ID         uint64    `gorm:"primaryKey;autoIncrement"`
+	Type       string    `gorm:"index;type:varchar(100)"`
+	Source     string    `gorm:"type:varchar(50)"`
+	Subject    string    `gorm:"index;type:varchar(100)"`
+	Data       string    `gorm:"type:text"`
+	Schema     string    `gorm:"column:data_schema;type:varchar(100);default:''"`
+	OccurredAt time.Time `gorm:"index"`
+}
+
+// TableName overrides the table name used by Record
+func (Record) TableName() string {
+	return "events"
+}
+
+// Event returns the event stored in the record
+func (r *Record) Event() Event {
+	return Event{
+		ID:         r.ID,
+		Type:       r.Type,
+		Source:     r.Source,
+		Subject:    r.Subject,
+		Data:       []byte(r.Data),
+		Schema:     r.Schema,
+		OccurredAt: r.OccurredAt,
+	}
+}
+
+// dbPublisher appends events to the events table
+type dbPublisher struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewDBPublisher creates a publisher backed by the events table
+func NewDBPublisher(db *gorm.DB, logger *zap.Logger) (Publisher, error) {
+	if err := db.AutoMigrate(&Record{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate events table: %w", err)
+	}
+
+	return &dbPublisher{
+		db:     db,
+		logger: logger,
+	}, nil
+}
+
+// Publish publishes events in order
+func (p *dbPublisher) Publish(ctx context.Context, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	records := make([]*Record, len(events))
+	for i, event := range events {
+		records[i] = &Record{
+			Type:       event.Type,
+			Source:     event.Source,
+			Subject:    event.Subject,
+			Data:       string(event.Data),
+			Schema:     event.Schema,
+			OccurredAt: event.OccurredAt,
+		}
+	}
+
+	if err := p.db.WithContext(ctx).Create(&records).Error; err != nil {
+		p.logger.Error("Failed to store events",
+			zap.Int("count", len(events)),
+			zap.Error(err))
+		return err
+	}
+
+	p.logger.Debug("Events stored", zap.Int("count", len(events)))
+	return nil
+}
@@ -0,0 +1,65 @@
+package events
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	eventspb "github.com/linkeunid/hello-go/api/gen/events"
+)
+
+// ToEnvelope converts an event to its protobuf envelope, for consumers
+// receiving events as protobuf. Only events with a schema can be converted.
+func ToEnvelope(event Event) (*eventspb.Envelope, error) {
+	if event.Schema == "" {
+		return nil, fmt.Errorf("%w: %s event %d has no schema", ErrUnknownSchema, event.Type, event.ID)
+	}
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(event.Schema))
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSchema, event.Schema)
+	}
+
+	payload := messageType.New().Interface()
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(event.Data, payload); err != nil {
+		return nil, fmt.Errorf("failed to decode event payload: %w", err)
+	}
+	data, err := anypb.New(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &eventspb.Envelope{
+		Id:         event.ID,
+		Type:       event.Type,
+		Source:     event.Source,
+		Subject:    event.Subject,
+		OccurredAt: timestamppb.New(event.OccurredAt),
+		Data:       data,
+	}, nil
+}
+
+// FromEnvelope converts a protobuf envelope back to an event
+func FromEnvelope(envelope *eventspb.Envelope) (Event, error) {
+	payload, err := envelope.Data.UnmarshalNew()
+	if err != nil {
+		return Event{}, fmt.Errorf("%w: %v", ErrUnknownSchema, err)
+	}
+	data, err := encodeMessage(payload)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		ID:         envelope.Id,
+		Type:       envelope.Type,
+		Source:     envelope.Source,
+		Subject:    envelope.Subject,
+		Data:       data,
+		Schema:     string(payload.ProtoReflect().Descriptor().FullName()),
+		OccurredAt: envelope.OccurredAt.AsTime(),
+	}, nil
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// permanentError marks an error retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error retrying won't fix, e.g. an invalid payload, so
+// Retry gives up right away
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err is marked as permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// Recover turns a handler panic into an error, so it can't take the consumer down
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, event Event) (err error) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					err = fmt.Errorf("panic handling %s event %d: %v", event.Type, event.ID, recovered)
+				}
+			}()
+			return next(ctx, event)
+		}
+	}
+}
+
+// Logging logs handled events, failures as errors
+func Logging(logger *zap.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, event Event) error {
+			start := time.Now()
+			err := next(ctx, event)
+
+			fields := []zap.Field{
+				zap.String("type", event.Type),
+				zap.Uint64("id", event.ID),
+				zap.String("subject", event.Subject),
+				zap.Duration("duration", time.Since(start)),
+			}
+			if err != nil {
+				logger.Error("Failed to handle event", append(fields, zap.Error(err))...)
+				return err
+			}
+			logger.Debug("Event handled", fields...)
+			return nil
+		}
+	}
+}
+
+// Retry retries failed handlers up to attempts times in total, doubling the
+// backoff after each attempt. Permanent errors aren't retried.
+func Retry(attempts int, backoff time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, event Event) error {
+			delay := backoff
+			var err error
+			for attempt := 1; ; attempt++ {
+				if err = next(ctx, event); err == nil || IsPermanent(err) || attempt >= attempts {
+					return err
+				}
+
+				select {
+				case <-ctx.Done():
+					return err
+				case <-time.After(delay):
+				}
+				delay *= 2
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// settleDelay is how old events must be before subscribers read them. IDs are
+// assigned when events are inserted but concurrent inserts can commit out of
+// order, reading only settled events keeps the offset from skipping over them.
+const settleDelay = 2 * time.Second
+
+// Offset is the position of a subscriber in the events table
+type Offset struct {
+	Consumer string `gorm:"primaryKey;type:varchar(100)"`
+	// Position is the ID of the last event handled
+	Position  uint64
+	UpdatedAt time.Time
+}
+
+// TableName overrides the table name used by Offset
+func (Offset) TableName() string {
+	return "event_offsets"
+}
+
+// Subscriber feeds the events of the events table to a consumer, tracking how
+// far it got in event_offsets under its name.
+//
+// Delivery is at-least-once: the offset is stored after the events were
+// handled, so events are handled again after a crash and by every instance
+// running the same subscriber. Events are handled in order, a failing event
+// holds back the ones after it until it succeeds. Events failing with a
+// permanent error are logged and skipped.
+type Subscriber struct {
+	db        *gorm.DB
+	name      string
+	consumer  *Consumer
+	interval  time.Duration
+	batchSize int
+	logger    *zap.Logger
+}
+
+// NewSubscriber creates a subscriber reading the events table of db
+func NewSubscriber(cfg *config.Config, db *gorm.DB, name string, consumer *Consumer, logger *zap.Logger) (*Subscriber, error) {
+	if err := db.AutoMigrate(&Record{}, &Offset{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate event tables: %w", err)
+	}
+
+	return &Subscriber{
+		db:        db,
+		name:      name,
+		consumer:  consumer,
+		interval:  cfg.Events.PollInterval,
+		batchSize: cfg.Events.BatchSize,
+		logger:    logger,
+	}, nil
+}
+
+// Start polls the events table until the context is cancelled
+func (s *Subscriber) Start(ctx context.Context) {
+	s.logger.Info("Starting event subscriber",
+		zap.String("consumer", s.name),
+		zap.Strings("types", s.consumer.Types()),
+		zap.Duration("interval", s.interval))
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		// Keep reading while full batches come back, the subscriber is behind
+		handled, err := s.Poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error("Event subscriber failed",
+				zap.String("consumer", s.name),
+				zap.Error(err))
+		}
+		if err == nil && handled == s.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Event subscriber stopped", zap.String("consumer", s.name))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll handles the next batch of events and returns the number of events read
+func (s *Subscriber) Poll(ctx context.Context) (int, error) {
+	offset := Offset{Consumer: s.name}
+	if err := s.db.WithContext(ctx).FirstOrInit(&offset, Offset{Consumer: s.name}).Error; err != nil {
+		return 0, fmt.Errorf("failed to load offset: %w", err)
+	}
+
+	var records []*Record
+	if err := s.db.WithContext(ctx).
+		Where("id > ? AND type IN ? AND occurred_at < ?", offset.Position, s.consumer.Types(), time.Now().UTC().Add(-settleDelay)).
+		Order("id").
+		Limit(s.batchSize).
+		Find(&records).Error; err != nil {
+		return 0, fmt.Errorf("failed to read events: %w", err)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	position := offset.Position
+	var handleErr error
+	for _, record := range records {
+		if err := s.consumer.Dispatch(ctx, record.Event()); err != nil {
+			if !IsPermanent(err) {
+				handleErr = fmt.Errorf("failed to handle %s event %d: %w", record.Type, record.ID, err)
+				break
+			}
+			s.logger.Error("Skipping event that can't be handled",
+				zap.String("consumer", s.name),
+				zap.String("type", record.Type),
+				zap.Uint64("id", record.ID),
+				zap.Error(err))
+		}
+		position = record.ID
+	}
+
+	if position != offset.Position {
+		offset.Position = position
+		offset.UpdatedAt = time.Now()
+		if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&offset).Error; err != nil {
+			return 0, fmt.Errorf("failed to store offset: %w", err)
+		}
+	}
+	if handleErr != nil {
+		return 0, handleErr
+	}
+	return len(records), nil
+}
@@ -0,0 +1,86 @@
+package fieldmask
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// node is a level of the field mask tree. An empty node keeps the whole field.
+type node map[string]node
+
+// Validate checks that every path of the mask names a field of msg.
+// A nil mask is valid and selects every field.
+func Validate(mask *fieldmaskpb.FieldMask, msg proto.Message) bool {
+	return mask == nil || mask.IsValid(msg)
+}
+
+// Prune clears every field of msg that isn't covered by the mask paths.
+// An empty mask keeps every field.
+func Prune(msg proto.Message, mask *fieldmaskpb.FieldMask) {
+	if len(mask.GetPaths()) == 0 {
+		return
+	}
+
+	prune(msg.ProtoReflect(), buildTree(mask.GetPaths()))
+}
+
+// PruneAll prunes every message of a list, building the mask tree only once
+func PruneAll[M proto.Message](msgs []M, mask *fieldmaskpb.FieldMask) {
+	if len(mask.GetPaths()) == 0 {
+		return
+	}
+
+	tree := buildTree(mask.GetPaths())
+	for _, msg := range msgs {
+		prune(msg.ProtoReflect(), tree)
+	}
+}
+
+// buildTree turns dotted paths into a tree, e.g. ["a.b", "a.c"] -> {a: {b: {}, c: {}}}
+func buildTree(paths []string) node {
+	root := node{}
+	for _, path := range paths {
+		current := root
+		parts := strings.Split(path, ".")
+		for i, part := range parts {
+			child, exists := current[part]
+			if exists && len(child) == 0 {
+				// A parent path already keeps the whole field
+				break
+			}
+			if i == len(parts)-1 {
+				current[part] = node{}
+				break
+			}
+			if !exists {
+				child = node{}
+				current[part] = child
+			}
+			current = child
+		}
+	}
+	return root
+}
+
+// prune clears the fields of m that aren't in the tree
+func prune(m protoreflect.Message, tree node) {
+	var cleared []protoreflect.FieldDescriptor
+
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		child, ok := tree[string(fd.Name())]
+		switch {
+		case !ok:
+			cleared = append(cleared, fd)
+		case len(child) > 0 && fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap():
+			prune(v.Message(), child)
+		}
+		return true
+	})
+
+	for _, fd := range cleared {
+		m.Clear(fd)
+	}
+}
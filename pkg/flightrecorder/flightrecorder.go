@@ -0,0 +1,112 @@
+package flightrecorder
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// Entry summarizes a request
+type Entry struct {
+	Time    time.Time
+	Method  string
+	Caller  string
+	Latency time.Duration
+	Code    codes.Code
+	TraceID string
+}
+
+// Filter selects entries. Empty fields match everything.
+type Filter struct {
+	Method     string
+	Caller     string
+	TraceID    string
+	ErrorsOnly bool
+	MinLatency time.Duration
+	// Limit is the maximum number of entries, 0 for all
+	Limit int
+}
+
+// matches reports whether the entry is selected by the filter
+func (f Filter) matches(entry *Entry) bool {
+	return (f.Method == "" || entry.Method == f.Method) &&
+		(f.Caller == "" || entry.Caller == f.Caller) &&
+		(f.TraceID == "" || entry.TraceID == f.TraceID) &&
+		(!f.ErrorsOnly || entry.Code != codes.OK) &&
+		entry.Latency >= f.MinLatency
+}
+
+// Recorder keeps summaries of the most recent requests of a service in a fixed
+// size ring buffer, so they can be inspected after the fact. It is cheap
+// enough to always be on.
+type Recorder struct {
+	service string
+
+	mu      sync.Mutex
+	entries []Entry
+	// next is the index the next entry is written to
+	next int
+	full bool
+}
+
+// NewRecorder creates a recorder keeping the last FLIGHT_RECORDER_SIZE requests
+func NewRecorder(cfg *config.Config, service string) *Recorder {
+	return &Recorder{
+		service: service,
+		entries: make([]Entry, cfg.FlightRecorder.Size),
+	}
+}
+
+// Service returns the name of the recorded service
+func (r *Recorder) Service() string {
+	return r.service
+}
+
+// Capacity returns the number of requests the recorder keeps
+func (r *Recorder) Capacity() int {
+	return len(r.entries)
+}
+
+// Record adds a request, replacing the oldest one when the buffer is full
+func (r *Recorder) Record(entry Entry) {
+	if len(r.entries) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[r.next] = entry
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// Entries returns the recorded requests matching the filter, newest first
+func (r *Recorder) Entries(filter Filter) []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := r.next
+	if r.full {
+		count = len(r.entries)
+	}
+
+	var result []Entry
+	for i := 0; i < count; i++ {
+		entry := &r.entries[(r.next-1-i+len(r.entries))%len(r.entries)]
+		if !filter.matches(entry) {
+			continue
+		}
+		result = append(result, *entry)
+		if filter.Limit > 0 && len(result) == filter.Limit {
+			break
+		}
+	}
+	return result
+}
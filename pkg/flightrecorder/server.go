@@ -0,0 +1,65 @@
+package flightrecorder
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	flightrecorderpb "github.com/linkeunid/hello-go/api/gen/flightrecorder"
+)
+
+// Authorizer checks that the caller may inspect recent requests, typically an admin
+type Authorizer func(ctx context.Context) error
+
+// Server implements the FlightRecorderService gRPC service on a recorder
+type Server struct {
+	flightrecorderpb.UnimplementedFlightRecorderServiceServer
+	recorder  *Recorder
+	authorize Authorizer
+	logger    *zap.Logger
+}
+
+// NewServer creates a FlightRecorderService for the requests of a recorder
+func NewServer(recorder *Recorder, authorize Authorizer, logger *zap.Logger) *Server {
+	return &Server{
+		recorder:  recorder,
+		authorize: authorize,
+		logger:    logger,
+	}
+}
+
+// ListRecentRequests returns the recorded requests, newest first
+func (s *Server) ListRecentRequests(ctx context.Context, req *flightrecorderpb.ListRecentRequestsRequest) (*flightrecorderpb.ListRecentRequestsResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	entries := s.recorder.Entries(Filter{
+		Method:     req.Method,
+		Caller:     req.Caller,
+		TraceID:    req.TraceId,
+		ErrorsOnly: req.ErrorsOnly,
+		MinLatency: time.Duration(req.MinLatencyMs) * time.Millisecond,
+		Limit:      int(req.Limit),
+	})
+	s.logger.Info("Recent requests dumped", zap.Int("requests", len(entries)))
+
+	requests := make([]*flightrecorderpb.RequestSummary, len(entries))
+	for i, entry := range entries {
+		requests[i] = &flightrecorderpb.RequestSummary{
+			Time:          entry.Time.UTC().Format(time.RFC3339Nano),
+			Method:        entry.Method,
+			Caller:        entry.Caller,
+			LatencyMicros: entry.Latency.Microseconds(),
+			Code:          entry.Code.String(),
+			TraceId:       entry.TraceID,
+		}
+	}
+
+	return &flightrecorderpb.ListRecentRequestsResponse{
+		Service:  s.recorder.Service(),
+		Requests: requests,
+		Capacity: int32(s.recorder.Capacity()),
+	}, nil
+}
@@ -0,0 +1,55 @@
+package handoff
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Environment variables of the systemd socket activation protocol, see sd_listen_fds(3)
+const (
+	listenPIDEnv     = "LISTEN_PID"
+	listenFDsEnv     = "LISTEN_FDS"
+	listenFDNamesEnv = "LISTEN_FDNAMES"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd
+const listenFDsStart = 3
+
+// activatedFiles returns the sockets passed by systemd by name. Sockets without a
+// FileDescriptorName are named after their socket unit by systemd.
+// The environment is cleared so child processes don't pick the sockets up again.
+func activatedFiles() (map[string]*os.File, error) {
+	files := make(map[string]*os.File)
+
+	pid, fdCount := os.Getenv(listenPIDEnv), os.Getenv(listenFDsEnv)
+	names := strings.Split(os.Getenv(listenFDNamesEnv), ":")
+	os.Unsetenv(listenPIDEnv)
+	os.Unsetenv(listenFDsEnv)
+	os.Unsetenv(listenFDNamesEnv)
+
+	// The sockets are meant for another process if the PID doesn't match
+	if fdCount == "" || pid != strconv.Itoa(os.Getpid()) {
+		return files, nil
+	}
+
+	count, err := strconv.Atoi(fdCount)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid %s %q", listenFDsEnv, fdCount)
+	}
+
+	for i := 0; i < count; i++ {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+
+		name := strconv.Itoa(i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		files[name] = os.NewFile(uintptr(fd), name)
+	}
+
+	return files, nil
+}
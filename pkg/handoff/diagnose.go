@@ -0,0 +1,94 @@
+package handoff
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// checkPorts fails if two listeners of the service are configured with the same
+// port, and warns about ports shared with other services, which conflict when
+// the services run on the same host
+func (u *Upgrader) checkPorts() error {
+	var own, others []config.Listener
+	for _, listener := range u.cfg.Listeners() {
+		if listener.Service == u.service {
+			own = append(own, listener)
+		} else {
+			others = append(others, listener)
+		}
+	}
+
+	for i, listener := range own {
+		for _, other := range own[i+1:] {
+			if listener.Port == other.Port {
+				return fmt.Errorf("%s and %s both use port %d, change one of them or set it to 0 to pick a free port",
+					listener.Setting, other.Setting, listener.Port)
+			}
+		}
+		for _, other := range others {
+			if listener.Port == other.Port {
+				u.logger.Warn("Port is also configured for another service, they can't run on the same host",
+					zap.Int("port", listener.Port),
+					zap.String("setting", listener.Setting),
+					zap.String("other_setting", other.Setting))
+			}
+		}
+	}
+	return nil
+}
+
+// describeConflict explains a failure to bind a TCP address that is in use:
+// which configured components use the port and which setting to change
+func (u *Upgrader) describeConflict(name, address string, err error) error {
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		return err
+	}
+	_, value, splitErr := net.SplitHostPort(address)
+	port, atoiErr := strconv.Atoi(value)
+	if splitErr != nil || atoiErr != nil {
+		return err
+	}
+
+	setting := ""
+	var users []string
+	for _, listener := range u.cfg.Listeners() {
+		if listener.Port != port {
+			continue
+		}
+		if listener.Service == u.service && listener.Name == name {
+			setting = listener.Setting
+			users = append(users, fmt.Sprintf("another instance of the %s service", u.service))
+			continue
+		}
+		users = append(users, fmt.Sprintf("the %s %s listener (%s)", listener.Service, listener.Name, listener.Setting))
+	}
+	if name == "acme" {
+		setting = "ACME_HTTP_CHALLENGE_ADDRESS"
+	}
+
+	message := fmt.Sprintf("port %d of the %s %s listener is already in use", port, u.service, name)
+	if len(users) > 0 {
+		message += ", possibly by " + strings.Join(users, " or ")
+	}
+	if setting != "" {
+		message += fmt.Sprintf("; change %s, or set the port to 0 to pick a free one", setting)
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
+
+// Port returns the TCP port of a listener, e.g. the one picked for port 0, or 0
+// for other listeners
+func Port(listener net.Listener) int {
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
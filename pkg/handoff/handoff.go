@@ -0,0 +1,404 @@
+package handoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+const (
+	// listenersEnv lists the inherited listeners as name:fd pairs, e.g. "grpc:3,http:4"
+	listenersEnv = "HANDOFF_LISTENERS"
+	// readyEnv is the fd of the pipe the new process reports readiness on
+	readyEnv = "HANDOFF_READY_FD"
+)
+
+// Listen address prefixes
+const (
+	unixPrefix    = "unix:"
+	systemdPrefix = "systemd:"
+)
+
+// Common errors
+var (
+	ErrUpgradeInProgress = errors.New("an upgrade is already in progress")
+	ErrUpgradeTimeout    = errors.New("new process didn't become ready in time")
+	ErrNoActivatedSocket = errors.New("no socket with this name was passed by systemd")
+)
+
+// Upgrader hands listening sockets over to a new process of the same binary.
+//
+// On Upgrade the current executable is started again with the listeners
+// inherited as file descriptors. Once the new process reports it is ready,
+// the old one stops accepting and drains its connections with the usual
+// graceful shutdown. Connections queued on the sockets in between are
+// accepted by whichever process is serving, so none are dropped.
+type Upgrader struct {
+	cfg       *config.Config
+	service   string
+	logger    *zap.Logger
+	inherited map[string]*os.File
+	activated map[string]*os.File
+	mu        sync.Mutex
+	listeners map[string]net.Listener
+	upgrading bool
+}
+
+// NewUpgrader creates an upgrader for a service, picking up listeners inherited
+// from a parent process. It fails if listeners of the service share a port.
+func NewUpgrader(cfg *config.Config, service string, logger *zap.Logger) (*Upgrader, error) {
+	inherited, err := inheritedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	activated, err := activatedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inherited) > 0 {
+		logger.Info("Inherited listeners from parent process",
+			zap.Int("count", len(inherited)),
+			zap.Int("parent_pid", os.Getppid()))
+	}
+	if len(activated) > 0 {
+		logger.Info("Received sockets from systemd", zap.Int("count", len(activated)))
+	}
+
+	u := &Upgrader{
+		cfg:       cfg,
+		service:   service,
+		logger:    logger,
+		inherited: inherited,
+		activated: activated,
+		listeners: make(map[string]net.Listener),
+	}
+	if err := u.checkPorts(); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// inheritedFiles parses the listeners passed by a parent process
+func inheritedFiles() (map[string]*os.File, error) {
+	files := make(map[string]*os.File)
+
+	value := os.Getenv(listenersEnv)
+	if value == "" {
+		return files, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		name, fdValue, ok := strings.Cut(pair, ":")
+		fd, err := strconv.Atoi(fdValue)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q", listenersEnv, pair)
+		}
+		files[name] = os.NewFile(uintptr(fd), name)
+	}
+
+	return files, nil
+}
+
+// Listen returns the named listener inherited from the parent process, or creates
+// it on address (see config.ListenAddress): a TCP address, "unix:/path/to.sock"
+// for a unix socket or "systemd:<name>" for a socket passed by systemd.
+// With SO_REUSEPORT enabled, new TCP listeners can share the port with another
+// running process, e.g. one started by a process manager. Port 0 picks a free
+// port, see Port. Ports in use fail with an error naming what may use them.
+func (u *Upgrader) Listen(name, address string) (net.Listener, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if file, ok := u.inherited[name]; ok {
+		delete(u.inherited, name)
+
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to use inherited listener %s: %w", name, err)
+		}
+
+		u.logger.Debug("Using inherited listener",
+			zap.String("name", name),
+			zap.String("address", listener.Addr().String()))
+		u.listeners[name] = listener
+		return listener, nil
+	}
+
+	var listener net.Listener
+	var err error
+	switch {
+	case strings.HasPrefix(address, systemdPrefix):
+		listener, err = u.listenActivated(strings.TrimPrefix(address, systemdPrefix))
+	case strings.HasPrefix(address, unixPrefix):
+		listener, err = listenUnix(strings.TrimPrefix(address, unixPrefix))
+	default:
+		lc := net.ListenConfig{}
+		if u.cfg.Restart.ReusePort {
+			lc.Control = reusePort
+		}
+		if listener, err = lc.Listen(context.Background(), "tcp", address); err != nil {
+			err = u.describeConflict(name, address, err)
+		} else if strings.HasSuffix(address, ":0") {
+			u.logger.Info("Listening on a free port",
+				zap.String("name", name),
+				zap.Int("port", Port(listener)))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u.listeners[name] = listener
+	return listener, nil
+}
+
+// listenActivated returns the socket systemd passed under the given name
+func (u *Upgrader) listenActivated(name string) (net.Listener, error) {
+	file, ok := u.activated[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoActivatedSocket, name)
+	}
+	delete(u.activated, name)
+
+	listener, err := net.FileListener(file)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to use systemd socket %s: %w", name, err)
+	}
+
+	u.logger.Debug("Using systemd socket",
+		zap.String("name", name),
+		zap.String("address", listener.Addr().String()))
+	return listener, nil
+}
+
+// listenUnix listens on a unix socket, replacing a stale socket file left by a crashed process
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("unix socket %s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale unix socket %s: %w", path, err)
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+// DialTarget returns the gRPC target for connecting to a listener of this process
+func DialTarget(listener net.Listener) string {
+	switch addr := listener.Addr().(type) {
+	case *net.UnixAddr:
+		return unixPrefix + addr.Name
+	case *net.TCPAddr:
+		if addr.IP == nil || addr.IP.IsUnspecified() {
+			return fmt.Sprintf("localhost:%d", addr.Port)
+		}
+		return addr.String()
+	default:
+		return addr.String()
+	}
+}
+
+// Ready tells the parent process, if any, that this process is serving.
+// The parent then shuts down gracefully. The listen addresses are reported to
+// ADDRESS_REPORT_FILE and standard output if configured, see AddressReport.
+func (u *Upgrader) Ready() error {
+	// Inherited listeners that weren't requested are closed, they aren't used by this version
+	u.mu.Lock()
+	for name, file := range u.inherited {
+		u.logger.Warn("Closing unused inherited listener", zap.String("name", name))
+		file.Close()
+	}
+	for name, file := range u.activated {
+		u.logger.Warn("Closing unused systemd socket", zap.String("name", name))
+		file.Close()
+	}
+	u.inherited = nil
+	u.activated = nil
+	u.mu.Unlock()
+
+	// A missing report doesn't hold up the handoff
+	if err := u.reportAddresses(); err != nil {
+		u.logger.Error("Failed to report listen addresses", zap.Error(err))
+	}
+
+	value := os.Getenv(readyEnv)
+	if value == "" {
+		return nil
+	}
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", readyEnv, value)
+	}
+
+	pipe := os.NewFile(uintptr(fd), "ready")
+	defer pipe.Close()
+
+	if _, err := pipe.Write([]byte{1}); err != nil {
+		return fmt.Errorf("failed to notify parent process: %w", err)
+	}
+
+	u.logger.Info("Took over listeners from parent process", zap.Int("parent_pid", os.Getppid()))
+	return nil
+}
+
+// Upgrade starts a new process of the current executable with the listeners
+// and waits until it is ready. On success the caller should shut down gracefully;
+// on failure the new process is killed and the current one keeps serving.
+func (u *Upgrader) Upgrade() error {
+	u.mu.Lock()
+	if u.upgrading {
+		u.mu.Unlock()
+		return ErrUpgradeInProgress
+	}
+	u.upgrading = true
+	u.mu.Unlock()
+
+	defer func() {
+		u.mu.Lock()
+		u.upgrading = false
+		u.mu.Unlock()
+	}()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	// Duplicate the listening sockets for the new process
+	files, names, err := u.listenerFiles()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create readiness pipe: %w", err)
+	}
+	defer readyReader.Close()
+
+	// ExtraFiles start at fd 3
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s:%d", name, 3+i)
+	}
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, value := range os.Environ() {
+		if !strings.HasPrefix(value, listenersEnv+"=") && !strings.HasPrefix(value, readyEnv+"=") {
+			env = append(env, value)
+		}
+	}
+	env = append(env,
+		listenersEnv+"="+strings.Join(pairs, ","),
+		fmt.Sprintf("%s=%d", readyEnv, 3+len(files)))
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = env
+	cmd.ExtraFiles = append(files, readyWriter)
+
+	u.logger.Info("Starting new process for upgrade",
+		zap.String("executable", executable),
+		zap.Strings("listeners", names))
+
+	if err := cmd.Start(); err != nil {
+		readyWriter.Close()
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+	readyWriter.Close()
+
+	// Wait until the new process reports readiness, exits or times out
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if _, err := readyReader.Read(buf); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("new process exited before becoming ready")
+			}
+			ready <- err
+			return
+		}
+		ready <- nil
+	}()
+
+	select {
+	case err = <-ready:
+	case <-time.After(u.cfg.Restart.UpgradeTimeout):
+		err = ErrUpgradeTimeout
+	}
+
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	u.logger.Info("New process is ready, handing over", zap.Int("pid", cmd.Process.Pid))
+
+	// The new process serves the unix sockets now, keep their files on shutdown
+	u.mu.Lock()
+	for _, listener := range u.listeners {
+		if unixListener, ok := listener.(*net.UnixListener); ok {
+			unixListener.SetUnlinkOnClose(false)
+		}
+	}
+	u.mu.Unlock()
+
+	// The new process outlives this one, don't wait for it
+	cmd.Process.Release()
+	return nil
+}
+
+// listenerFiles duplicates the file descriptors of the listeners
+func (u *Upgrader) listenerFiles() ([]*os.File, []string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var files []*os.File
+	var names []string
+	for name, listener := range u.listeners {
+		filer, ok := listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return nil, nil, fmt.Errorf("listener %s can't be handed over", name)
+		}
+
+		file, err := filer.File()
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, nil, fmt.Errorf("failed to duplicate listener %s: %w", name, err)
+		}
+
+		files = append(files, file)
+		names = append(names, name)
+	}
+
+	return files, names, nil
+}
@@ -0,0 +1,90 @@
+package handoff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AddressReport lists where a serving process listens, see Upgrader.Ready. It
+// lets tests and scripts find the ports picked for port 0.
+type AddressReport struct {
+	Service string `json:"service"`
+	PID     int    `json:"pid"`
+	// Addresses maps listener names to dial addresses, e.g. "grpc" -> "localhost:9091", see DialTarget
+	Addresses map[string]string `json:"addresses"`
+}
+
+// Addresses returns the dial addresses of the process's listeners by name
+func (u *Upgrader) Addresses() map[string]string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	addresses := make(map[string]string, len(u.listeners))
+	for name, listener := range u.listeners {
+		addresses[name] = DialTarget(listener)
+	}
+	return addresses
+}
+
+// reportAddresses writes the addresses to ADDRESS_REPORT_FILE and prints them as
+// a JSON line to standard output with ADDRESS_REPORT_STDOUT
+func (u *Upgrader) reportAddresses() error {
+	cfg := u.cfg.AddressReport
+	if cfg.File == "" && !cfg.Stdout {
+		return nil
+	}
+
+	data, err := json.Marshal(AddressReport{
+		Service:   u.service,
+		PID:       os.Getpid(),
+		Addresses: u.Addresses(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if cfg.Stdout {
+		fmt.Println(string(data))
+	}
+	if cfg.File != "" {
+		// Readers never see a partially written file
+		tmp := filepath.Join(filepath.Dir(cfg.File), "."+filepath.Base(cfg.File)+".tmp")
+		if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+			return fmt.Errorf("failed to write address report: %w", err)
+		}
+		if err := os.Rename(tmp, cfg.File); err != nil {
+			return fmt.Errorf("failed to write address report: %w", err)
+		}
+	}
+	return nil
+}
+
+// WaitForAddressReport reads the address report a process writes to path once
+// it serves, polling until the report is written by the process with the given
+// PID or the context is done. A PID of 0 accepts any process.
+func WaitForAddressReport(ctx context.Context, path string, pid int) (*AddressReport, error) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if data, err := os.ReadFile(path); err == nil {
+			var report AddressReport
+			if err := json.Unmarshal(data, &report); err != nil {
+				return nil, fmt.Errorf("invalid address report %s: %w", path, err)
+			}
+			if pid == 0 || report.PID == pid {
+				return &report, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no address report in %s: %w", path, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package handoff
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePort is only supported on Linux
+func reusePort(network, address string, conn syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is only supported on linux")
+}
@@ -0,0 +1,154 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	statuspb "github.com/linkeunid/hello-go/api/gen/status"
+	"github.com/linkeunid/hello-go/pkg/alerting"
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// Check probes a single dependency
+type Check struct {
+	// Name identifies the dependency, e.g. "database"
+	Name string
+	// Critical dependencies make the service unhealthy when they fail, others only degrade it
+	Critical bool
+	// Probe returns an error when the dependency is unavailable
+	Probe func(ctx context.Context) error
+}
+
+// Checker runs dependency checks and implements the StatusService gRPC service
+type Checker struct {
+	statuspb.UnimplementedStatusServiceServer
+	service         string
+	checks          []Check
+	timeout         time.Duration
+	degradedLatency time.Duration
+	logger          *zap.Logger
+}
+
+// NewChecker creates a new Checker for the named service
+func NewChecker(service string, cfg *config.Config, logger *zap.Logger, checks ...Check) *Checker {
+	return &Checker{
+		service:         service,
+		checks:          checks,
+		timeout:         cfg.Status.CheckTimeout,
+		degradedLatency: cfg.Status.DegradedLatency,
+		logger:          logger.Named("health"),
+	}
+}
+
+// GetStatus returns the health of the service and each of its dependencies
+func (c *Checker) GetStatus(ctx context.Context, req *statuspb.GetStatusRequest) (*statuspb.GetStatusResponse, error) {
+	dependencies := make([]*statuspb.Dependency, len(c.checks))
+
+	// Run all checks concurrently so one slow dependency doesn't delay the others
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			dependencies[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	// The service is as healthy as its worst dependency
+	level := statuspb.Level_LEVEL_HEALTHY
+	for _, dependency := range dependencies {
+		if dependency.Level > level {
+			level = dependency.Level
+		}
+	}
+
+	return &statuspb.GetStatusResponse{
+		Service:      c.service,
+		Level:        level,
+		Dependencies: dependencies,
+		CheckedAt:    time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}, nil
+}
+
+// run probes a dependency and classifies the result
+func (c *Checker) run(ctx context.Context, check Check) *statuspb.Dependency {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Probe(ctx)
+	latency := time.Since(start)
+
+	dependency := &statuspb.Dependency{
+		Name:      check.Name,
+		Level:     statuspb.Level_LEVEL_HEALTHY,
+		Critical:  check.Critical,
+		LatencyMs: latency.Milliseconds(),
+	}
+
+	switch {
+	case err != nil && check.Critical:
+		dependency.Level = statuspb.Level_LEVEL_UNHEALTHY
+		dependency.Message = err.Error()
+	case err != nil:
+		dependency.Level = statuspb.Level_LEVEL_DEGRADED
+		dependency.Message = err.Error()
+	case latency > c.degradedLatency:
+		dependency.Level = statuspb.Level_LEVEL_DEGRADED
+		dependency.Message = fmt.Sprintf("slow response, took %s", latency.Round(time.Millisecond))
+	}
+
+	if err != nil {
+		c.logger.Warn("Dependency check failed",
+			zap.String("dependency", check.Name),
+			zap.Bool("critical", check.Critical),
+			zap.Error(err))
+	}
+	if check.Critical {
+		if err != nil {
+			alerting.Observe(config.AlertDependencyFailures, check.Name)
+		} else {
+			alerting.Resolve(config.AlertDependencyFailures, check.Name)
+		}
+	}
+
+	return dependency
+}
+
+// LivenessHandler reports that the process is up, without checking dependencies
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+}
+
+// ReadinessHandler returns the status report, with 503 when the service is unhealthy.
+// Degraded services stay ready so a slow dependency doesn't take every replica out of rotation.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, _ := c.GetStatus(r.Context(), &statuspb.GetStatusRequest{})
+
+		body, err := protojson.Marshal(res)
+		if err != nil {
+			http.Error(w, "failed to encode status", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if res.Level == statuspb.Level_LEVEL_UNHEALTHY {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		w.Write(body)
+	})
+}
@@ -0,0 +1,87 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/linkeunid/hello-go/pkg/alerting"
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// breaker is a circuit breaker counting consecutive failures
+type breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	// probing is set while the single request after the cooldown is in flight
+	probing bool
+}
+
+// newBreaker creates a breaker, a threshold below 1 never opens it
+func newBreaker(name string, threshold int, cooldown time.Duration) *breaker {
+	circuitOpen.Set(0, name)
+	return &breaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow reports whether a request may be sent. Once the cooldown of an open
+// circuit has passed, one request is let through to probe the service.
+func (b *breaker) allow() bool {
+	if b.threshold < 1 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// release ends a probe without counting its outcome, e.g. when the caller gave up
+func (b *breaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// record counts the outcome of a request, opening the circuit at the threshold
+// and closing it on success
+func (b *breaker) record(success bool) {
+	if b.threshold < 1 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		if b.failures >= b.threshold {
+			circuitOpen.Set(0, b.name)
+			alerting.Resolve(config.AlertCircuitOpen, b.name)
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+		circuitOpen.Set(1, b.name)
+		alerting.Observe(config.AlertCircuitOpen, b.name)
+	}
+}
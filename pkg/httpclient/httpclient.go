@@ -0,0 +1,335 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+// ErrCircuitOpen is returned without calling the service while its circuit is open
+var ErrCircuitOpen = errors.New("circuit open, the service failed repeatedly")
+
+var (
+	requests = metrics.NewCounterVec("http_client_requests_total",
+		"Number of outbound HTTP attempts by client, method and status code, or error", "client", "method", "status")
+	requestSeconds = metrics.NewCounterVec("http_client_request_duration_seconds_total",
+		"Total duration of outbound HTTP attempts by client", "client")
+	retries = metrics.NewCounterVec("http_client_retries_total",
+		"Number of retried outbound HTTP requests by client", "client")
+	circuitOpen = metrics.NewGaugeVec("http_client_circuit_open",
+		"Whether the circuit of a client is open (1) or closed (0)", "client")
+)
+
+// StatusError is returned by DecodeJSON for responses without a 2xx status
+type StatusError struct {
+	StatusCode int
+	// Body is the start of the response body, for logging
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithTimeout overrides HTTP_CLIENT_TIMEOUT for the client
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.cfg.Timeout = timeout
+	}
+}
+
+// WithMaxAttempts overrides HTTP_CLIENT_MAX_ATTEMPTS for the client, 1 disables retries
+func WithMaxAttempts(attempts int) Option {
+	return func(c *Client) {
+		c.cfg.MaxAttempts = attempts
+	}
+}
+
+// WithTransport replaces the client's transport, e.g. for custom TLS settings
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.client.Transport = transport
+	}
+}
+
+// Client calls an external HTTP service, e.g. a webhook receiver or an OAuth provider.
+//
+// Every attempt is bounded by a timeout. Idempotent requests, and requests with an
+// Idempotency-Key header, are retried with backoff on network errors and on 429,
+// 502, 503 and 504 responses, honoring Retry-After. After BreakerThreshold
+// consecutive failures the client's circuit opens and requests fail with
+// ErrCircuitOpen until BreakerCooldown has passed. The trace context of the
+// incoming request is propagated with a traceparent header.
+//
+// Create one client per service, the circuit and metrics are kept per client.
+type Client struct {
+	name    string
+	cfg     config.HTTPClientConfig
+	client  *http.Client
+	breaker *breaker
+	logger  *zap.Logger
+}
+
+// New creates a client for the service with the given name, used in metrics and logs
+func New(name string, cfg *config.Config, logger *zap.Logger, opts ...Option) *Client {
+	c := &Client{
+		name:   name,
+		cfg:    cfg.HTTPClient,
+		client: &http.Client{Transport: http.DefaultTransport},
+		logger: logger.With(zap.String("client", name)),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.cfg.MaxAttempts < 1 {
+		c.cfg.MaxAttempts = 1
+	}
+	c.breaker = newBreaker(name, c.cfg.BreakerThreshold, c.cfg.BreakerCooldown)
+	return c
+}
+
+// Get sends a GET request
+func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// PostJSON sends a POST request with v encoded as JSON
+func (c *Client) PostJSON(ctx context.Context, url string, v interface{}) (*http.Response, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.Do(req)
+}
+
+// PostForm sends a POST request with form-encoded values
+func (c *Client) PostForm(ctx context.Context, url string, values url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.Do(req)
+}
+
+// Do sends a request, retrying it if allowed. The caller must close the response body.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	retryable := isIdempotent(req) && (req.Body == nil || req.GetBody != nil)
+	propagateTrace(ctx, req)
+
+	for attempt := 1; ; attempt++ {
+		if !c.breaker.allow() {
+			return nil, fmt.Errorf("%s: %w", c.name, ErrCircuitOpen)
+		}
+
+		resp, err := c.attempt(req, attempt)
+
+		// The caller's context ending isn't a failure of the service
+		if ctx.Err() != nil {
+			c.breaker.release()
+			return resp, err
+		}
+		c.breaker.record(err == nil && resp.StatusCode < http.StatusInternalServerError)
+
+		if attempt >= c.cfg.MaxAttempts || !retryable || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		delay := c.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				// Rather than waiting long, let the caller decide
+				if after > c.cfg.MaxBackoff {
+					return resp, nil
+				}
+				delay = after
+			}
+			// Drain the body so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+
+		c.logger.Warn("Retrying HTTP request",
+			zap.String("method", req.Method),
+			zap.String("url", redactURL(req.URL)),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(attemptError(resp, err)))
+		retries.Inc(c.name)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// attempt sends the request once, bounded by the timeout
+func (c *Client) attempt(req *http.Request, attempt int) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), c.cfg.Timeout)
+
+	start := time.Now()
+	resp, err := c.client.Do(req.WithContext(ctx))
+	elapsed := time.Since(start)
+	requestSeconds.Add(elapsed.Seconds(), c.name)
+
+	if err != nil {
+		cancel()
+		requests.Inc(c.name, req.Method, "error")
+		c.logger.Debug("HTTP request failed",
+			zap.String("method", req.Method),
+			zap.String("url", redactURL(req.URL)),
+			zap.Int("attempt", attempt),
+			zap.Duration("duration", elapsed),
+			zap.Error(err))
+		return nil, err
+	}
+
+	requests.Inc(c.name, req.Method, strconv.Itoa(resp.StatusCode))
+	c.logger.Debug("HTTP request completed",
+		zap.String("method", req.Method),
+		zap.String("url", redactURL(req.URL)),
+		zap.Int("attempt", attempt),
+		zap.Int("status", resp.StatusCode),
+		zap.Duration("duration", elapsed))
+
+	// The timeout is released once the body is closed
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff returns the delay before the retry after the given attempt, doubled
+// with every attempt and capped, with jitter
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.cfg.RetryBackoff
+	for i := 1; i < attempt && delay < c.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > c.cfg.MaxBackoff {
+		delay = c.cfg.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// DecodeJSON decodes a 2xx response into v and closes its body.
+// Other responses return a *StatusError.
+func DecodeJSON(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// isIdempotent reports whether a request can safely be sent more than once
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return req.Header.Get("Idempotency-Key") != ""
+	}
+}
+
+// shouldRetry reports whether an attempt failed in a way another attempt may fix
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryAfter parses the Retry-After header, in seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// attemptError describes a failed attempt for logging
+func attemptError(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("status %d", resp.StatusCode)
+}
+
+// redactURL drops the query and credentials of a URL, they may contain secrets
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.RawQuery = ""
+	redacted.Fragment = ""
+	return redacted.String()
+}
+
+// cancelBody cancels an attempt's timeout when the response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the timeout
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,59 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// W3C trace context headers, see https://www.w3.org/TR/trace-context/
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+)
+
+// baggageHeader is the W3C baggage header, see https://www.w3.org/TR/baggage/
+const baggageHeader = "baggage"
+
+// propagateTrace sets the traceparent header of an outbound request. The trace
+// of the incoming gRPC request is continued with a new span ID, otherwise a new
+// trace is started. The request's baggage, filtered by BaggageInterceptor, is
+// forwarded too. Headers set by the caller are kept.
+func propagateTrace(ctx context.Context, req *http.Request) {
+	if req.Header.Get(traceparentHeader) != "" {
+		return
+	}
+
+	traceID, flags := "", "01"
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(traceparentHeader); len(values) > 0 {
+			// version-traceid-parentid-flags
+			parts := strings.Split(values[0], "-")
+			if len(parts) == 4 && len(parts[1]) == 32 && len(parts[3]) == 2 {
+				traceID, flags = parts[1], parts[3]
+			}
+		}
+		if values := md.Get(tracestateHeader); len(values) > 0 && traceID != "" {
+			req.Header.Set(tracestateHeader, strings.Join(values, ","))
+		}
+		if values := md.Get(baggageHeader); len(values) > 0 && req.Header.Get(baggageHeader) == "" {
+			req.Header.Set(baggageHeader, strings.Join(values, ","))
+		}
+	}
+	if traceID == "" {
+		traceID = randomHex(16)
+	}
+
+	req.Header.Set(traceparentHeader, "00-"+traceID+"-"+randomHex(8)+"-"+flags)
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
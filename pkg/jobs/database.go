@@ -0,0 +1,230 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Job statuses of the jobs table
+const (
+	statusQueued  = "queued"
+	statusRunning = "running"
+	statusDead    = "dead"
+)
+
+// Record is a job stored in the jobs table. Dead jobs stay in the table with
+// status "dead" until they are retried or removed.
+type Record struct {
+	ID          string    `gorm:"type:varchar(36);primary_key"`
+	Type        string    `gorm:"type:varchar(100);not null;index:idx_jobs_claim,priority:1"`
+	Status      string    `gorm:"type:varchar(20);not null;index:idx_jobs_claim,priority:2"`
+	Payload     string    `gorm:"type:text"`
+	Attempts    int       `gorm:"not null;default:0"`
+	RunAt       time.Time `gorm:"not null;index:idx_jobs_claim,priority:3"`
+	LockedUntil *time.Time
+	LastError   string `gorm:"type:text"`
+	// UniqueKey is set while a job enqueued with Unique is pending
+	UniqueKey *string `gorm:"type:varchar(191);uniqueIndex"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName specifies the table name for the Record model
+func (Record) TableName() string {
+	return "jobs"
+}
+
+// toJob converts a record to a job
+func (r *Record) toJob() *Job {
+	job := &Job{
+		ID:        r.ID,
+		Type:      r.Type,
+		Payload:   []byte(r.Payload),
+		Attempt:   r.Attempts,
+		RunAt:     r.RunAt,
+		LastError: r.LastError,
+		CreatedAt: r.CreatedAt,
+	}
+	if r.UniqueKey != nil {
+		job.uniqueKey = *r.UniqueKey
+	}
+	if r.Status == statusDead {
+		job.FailedAt = r.UpdatedAt
+	}
+	return job
+}
+
+// dbBackend stores jobs in the jobs table of the service's database
+type dbBackend struct {
+	db *gorm.DB
+}
+
+// newDBBackend creates the database backend, creating the jobs table if needed
+func newDBBackend(db *gorm.DB) (*dbBackend, error) {
+	if db == nil {
+		return nil, errors.New("the database job queue backend needs a database connection")
+	}
+	if err := db.AutoMigrate(&Record{}); err != nil {
+		return nil, err
+	}
+	return &dbBackend{db: db}, nil
+}
+
+func (b *dbBackend) enqueue(ctx context.Context, job *Job) error {
+	record := &Record{
+		ID:        job.ID,
+		Type:      job.Type,
+		Status:    statusQueued,
+		Payload:   string(job.Payload),
+		RunAt:     job.RunAt,
+		CreatedAt: job.CreatedAt,
+	}
+	if job.uniqueKey != "" {
+		record.UniqueKey = &job.uniqueKey
+	}
+
+	err := b.db.WithContext(ctx).Create(record).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// claim locks the next due job with SKIP LOCKED so workers of other processes
+// pass over it, and leases it. Running jobs whose lease ran out belonged to a
+// worker that died and are claimed again.
+func (b *dbBackend) claim(ctx context.Context, jobType string, lease time.Duration) (*Job, error) {
+	var claimed *Record
+	err := b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var record Record
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("type = ?", jobType).
+			Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_until <= ?)",
+				statusQueued, now, statusRunning, now).
+			Order("run_at").
+			First(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		lockedUntil := now.Add(lease)
+		record.Status = statusRunning
+		record.Attempts++
+		record.LockedUntil = &lockedUntil
+		if err := tx.Model(&record).Updates(map[string]interface{}{
+			"status":       record.Status,
+			"attempts":     record.Attempts,
+			"locked_until": record.LockedUntil,
+		}).Error; err != nil {
+			return err
+		}
+
+		claimed = &record
+		return nil
+	})
+	if err != nil || claimed == nil {
+		return nil, err
+	}
+	return claimed.toJob(), nil
+}
+
+func (b *dbBackend) complete(ctx context.Context, job *Job) error {
+	return b.db.WithContext(ctx).Delete(&Record{}, "id = ?", job.ID).Error
+}
+
+func (b *dbBackend) retry(ctx context.Context, job *Job, runAt time.Time, message string) error {
+	return b.db.WithContext(ctx).Model(&Record{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"status":       statusQueued,
+		"run_at":       runAt,
+		"locked_until": nil,
+		"last_error":   message,
+	}).Error
+}
+
+// bury marks the job dead and releases its unique key so it can be enqueued again
+func (b *dbBackend) bury(ctx context.Context, job *Job, message string) error {
+	return b.db.WithContext(ctx).Model(&Record{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"status":       statusDead,
+		"locked_until": nil,
+		"last_error":   message,
+		"unique_key":   nil,
+	}).Error
+}
+
+func (b *dbBackend) listDead(ctx context.Context, jobType string, page, pageSize int) ([]*Job, int, error) {
+	query := b.db.WithContext(ctx).Model(&Record{}).Where("status = ?", statusDead)
+	if jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var records []Record
+	if err := query.Order("updated_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+
+	jobs := make([]*Job, len(records))
+	for i := range records {
+		jobs[i] = records[i].toJob()
+	}
+	return jobs, int(total), nil
+}
+
+func (b *dbBackend) getDead(ctx context.Context, id string) (*Job, error) {
+	var record Record
+	err := b.db.WithContext(ctx).Where("id = ? AND status = ?", id, statusDead).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record.toJob(), nil
+}
+
+func (b *dbBackend) replayDead(ctx context.Context, selection Selection) (int, error) {
+	result := b.selectDead(ctx, selection).Updates(map[string]interface{}{
+		"status":   statusQueued,
+		"attempts": 0,
+		"run_at":   time.Now(),
+	})
+	return int(result.RowsAffected), result.Error
+}
+
+func (b *dbBackend) purgeDead(ctx context.Context, selection Selection) (int, error) {
+	result := b.selectDead(ctx, selection).Delete(&Record{})
+	return int(result.RowsAffected), result.Error
+}
+
+// selectDead queries the selected dead-lettered jobs
+func (b *dbBackend) selectDead(ctx context.Context, selection Selection) *gorm.DB {
+	query := b.db.WithContext(ctx).Model(&Record{}).Where("status = ?", statusDead)
+	if len(selection.IDs) > 0 {
+		query = query.Where("id IN ?", selection.IDs)
+	}
+	if selection.Type != "" {
+		query = query.Where("type = ?", selection.Type)
+	}
+	if !selection.Before.IsZero() {
+		query = query.Where("updated_at < ?", selection.Before)
+	}
+	return query
+}
+
+func (b *dbBackend) close() error {
+	// The connection belongs to the service
+	return nil
+}
@@ -0,0 +1,442 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+// Common errors
+var (
+	// ErrDuplicate is returned when enqueuing a unique job that is already queued or running
+	ErrDuplicate = errors.New("job is already queued")
+	// ErrUnknownBackend is returned for an unsupported JOBS_BACKEND
+	ErrUnknownBackend = errors.New("unknown job queue backend")
+	// ErrNotFound is returned when a dead-lettered job doesn't exist
+	ErrNotFound = errors.New("dead-lettered job not found")
+	// ErrNoSelection is returned when replaying or purging without selecting jobs by ID or type
+	ErrNoSelection = errors.New("select dead-lettered jobs by ID or type")
+)
+
+var (
+	processedJobs = metrics.NewCounterVec("jobs_processed_total",
+		"Number of job attempts by outcome: succeeded, retried or dead", "type", "outcome")
+	jobDuration = metrics.NewGaugeVec("jobs_last_duration_seconds",
+		"Duration of the last attempt of a job type", "type")
+)
+
+// Job is a unit of background work
+type Job struct {
+	ID   string
+	Type string
+	// Payload is the JSON the job was enqueued with
+	Payload []byte
+	// Attempt is the number of the current attempt, starting at 1
+	Attempt int
+	RunAt   time.Time
+	// LastError is the error of the previous attempt, if any
+	LastError string
+	CreatedAt time.Time
+	// FailedAt is when the job was dead-lettered, zero for pending jobs
+	FailedAt time.Time
+	// uniqueKey keeps other jobs with the same key out while this one is pending
+	uniqueKey string
+}
+
+// Decode unmarshals the payload into v
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Handler processes a job. Jobs are delivered at least once, handlers must be
+// idempotent. A returned error retries the job with backoff until it runs out
+// of attempts and is dead-lettered.
+type Handler func(ctx context.Context, job *Job) error
+
+// permanentError marks an error retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error retrying won't fix, e.g. an invalid payload,
+// so the job is dead-lettered right away
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// backend stores the queue
+type backend interface {
+	enqueue(ctx context.Context, job *Job) error
+	// claim leases the next due job of the type, nil if there is none
+	claim(ctx context.Context, jobType string, lease time.Duration) (*Job, error)
+	complete(ctx context.Context, job *Job) error
+	retry(ctx context.Context, job *Job, runAt time.Time, message string) error
+	// bury moves a job to the dead letters
+	bury(ctx context.Context, job *Job, message string) error
+	// listDead returns a page of dead-lettered jobs, most recently failed first
+	listDead(ctx context.Context, jobType string, page, pageSize int) ([]*Job, int, error)
+	getDead(ctx context.Context, id string) (*Job, error)
+	// replayDead queues the selected dead-lettered jobs again with fresh attempts
+	replayDead(ctx context.Context, selection Selection) (int, error)
+	purgeDead(ctx context.Context, selection Selection) (int, error)
+	close() error
+}
+
+// Selection selects dead-lettered jobs to replay or purge. Jobs must match
+// every field that is set; at least IDs or Type must be.
+type Selection struct {
+	IDs  []string
+	Type string
+	// Before only selects jobs that failed before this time
+	Before time.Time
+}
+
+// matches reports whether a dead-lettered job is selected
+func (s Selection) matches(job *Job) bool {
+	if len(s.IDs) > 0 && !slices.Contains(s.IDs, job.ID) {
+		return false
+	}
+	if s.Type != "" && job.Type != s.Type {
+		return false
+	}
+	return s.Before.IsZero() || job.FailedAt.Before(s.Before)
+}
+
+// registration is a handler with its settings
+type registration struct {
+	handler     Handler
+	concurrency int
+	maxAttempts int
+}
+
+// HandlerOption configures a registered handler
+type HandlerOption func(*registration)
+
+// WithConcurrency overrides the number of workers of the job type, JOBS_CONCURRENCY still takes precedence
+func WithConcurrency(workers int) HandlerOption {
+	return func(r *registration) {
+		r.concurrency = workers
+	}
+}
+
+// WithMaxAttempts overrides JOBS_MAX_ATTEMPTS for the job type
+func WithMaxAttempts(attempts int) HandlerOption {
+	return func(r *registration) {
+		r.maxAttempts = attempts
+	}
+}
+
+// enqueueOptions holds the optional settings of Enqueue
+type enqueueOptions struct {
+	runAt     time.Time
+	uniqueKey string
+}
+
+// EnqueueOption configures an enqueued job
+type EnqueueOption func(*enqueueOptions)
+
+// Delay runs the job no earlier than d from now
+func Delay(d time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.runAt = time.Now().Add(d)
+	}
+}
+
+// At runs the job no earlier than t
+func At(t time.Time) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.runAt = t
+	}
+}
+
+// Unique rejects the job with ErrDuplicate while another job with the same key is queued or running
+func Unique(key string) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.uniqueKey = key
+	}
+}
+
+// Queue is a persistent job queue with delayed jobs, retries with backoff and dead-lettering.
+//
+// Any process can enqueue jobs; processes that register handlers and call Run
+// work on them. Every job type has its own pool of workers.
+type Queue struct {
+	backend  backend
+	cfg      config.JobsConfig
+	logger   *zap.Logger
+	mu       sync.Mutex
+	handlers map[string]*registration
+}
+
+// NewQueue creates a queue on the JOBS_BACKEND: the jobs table of db or Redis
+func NewQueue(cfg *config.Config, db *gorm.DB, logger *zap.Logger) (*Queue, error) {
+	var store backend
+	var err error
+	switch cfg.Jobs.Backend {
+	case "database":
+		store, err = newDBBackend(db)
+	case "redis":
+		store, err = newRedisBackend(&cfg.Redis)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, cfg.Jobs.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Job queue ready", zap.String("backend", cfg.Jobs.Backend))
+	return newQueue(store, cfg, logger), nil
+}
+
+// NewMemoryQueue creates a queue that keeps its jobs in memory, for mock services
+func NewMemoryQueue(cfg *config.Config, logger *zap.Logger) *Queue {
+	return newQueue(newMemoryBackend(), cfg, logger)
+}
+
+func newQueue(store backend, cfg *config.Config, logger *zap.Logger) *Queue {
+	return &Queue{
+		backend:  store,
+		cfg:      cfg.Jobs,
+		logger:   logger,
+		handlers: make(map[string]*registration),
+	}
+}
+
+// Register sets the handler of a job type, workers are started by Run
+func (q *Queue) Register(jobType string, handler Handler, opts ...HandlerOption) {
+	reg := &registration{
+		handler:     handler,
+		concurrency: q.cfg.DefaultConcurrency,
+		maxAttempts: q.cfg.MaxAttempts,
+	}
+	for _, opt := range opts {
+		opt(reg)
+	}
+	if workers, ok := q.cfg.Concurrency[jobType]; ok {
+		reg.concurrency = workers
+	}
+
+	q.mu.Lock()
+	q.handlers[jobType] = reg
+	q.mu.Unlock()
+}
+
+// Enqueue adds a job with a JSON payload and returns its ID
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}, opts ...EnqueueOption) (string, error) {
+	options := enqueueOptions{runAt: time.Now()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("invalid job payload: %w", err)
+	}
+
+	job := &Job{
+		ID:        uuid.New().String(),
+		Type:      jobType,
+		Payload:   data,
+		RunAt:     options.runAt,
+		CreatedAt: time.Now(),
+		uniqueKey: options.uniqueKey,
+	}
+	if err := q.backend.enqueue(ctx, job); err != nil {
+		if !errors.Is(err, ErrDuplicate) {
+			q.logger.Error("Failed to enqueue job",
+				zap.String("type", jobType),
+				zap.Error(err))
+		}
+		return "", err
+	}
+
+	q.logger.Debug("Job enqueued",
+		zap.String("job_id", job.ID),
+		zap.String("type", jobType),
+		zap.Time("run_at", job.RunAt))
+	return job.ID, nil
+}
+
+// Run works on the registered job types until ctx is cancelled, then waits
+// for the running jobs to finish
+func (q *Queue) Run(ctx context.Context) {
+	q.mu.Lock()
+	var wg sync.WaitGroup
+	for jobType, reg := range q.handlers {
+		q.logger.Info("Starting job workers",
+			zap.String("type", jobType),
+			zap.Int("workers", reg.concurrency),
+			zap.Int("max_attempts", reg.maxAttempts))
+
+		for i := 0; i < reg.concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				q.work(ctx, jobType, reg)
+			}()
+		}
+	}
+	q.mu.Unlock()
+
+	wg.Wait()
+	q.logger.Info("Job workers stopped")
+}
+
+// Close releases the queue's connection, after Run returned
+func (q *Queue) Close() error {
+	return q.backend.close()
+}
+
+// DeadLetters returns a page of dead-lettered jobs, optionally of one type,
+// most recently failed first, along with the total number of matches
+func (q *Queue) DeadLetters(ctx context.Context, jobType string, page, pageSize int) ([]*Job, int, error) {
+	// Validate page and pageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	return q.backend.listDead(ctx, jobType, page, pageSize)
+}
+
+// DeadLetter returns a dead-lettered job
+func (q *Queue) DeadLetter(ctx context.Context, id string) (*Job, error) {
+	return q.backend.getDead(ctx, id)
+}
+
+// Replay queues the selected dead-lettered jobs again, e.g. once a downstream
+// outage is over. They run right away with fresh attempts.
+func (q *Queue) Replay(ctx context.Context, selection Selection) (int, error) {
+	if len(selection.IDs) == 0 && selection.Type == "" {
+		return 0, ErrNoSelection
+	}
+
+	replayed, err := q.backend.replayDead(ctx, selection)
+	if err != nil {
+		return 0, err
+	}
+
+	q.logger.Info("Dead-lettered jobs replayed",
+		zap.Strings("ids", selection.IDs),
+		zap.String("type", selection.Type),
+		zap.Int("replayed", replayed))
+	return replayed, nil
+}
+
+// Purge deletes the selected dead-lettered jobs
+func (q *Queue) Purge(ctx context.Context, selection Selection) (int, error) {
+	if len(selection.IDs) == 0 && selection.Type == "" {
+		return 0, ErrNoSelection
+	}
+
+	purged, err := q.backend.purgeDead(ctx, selection)
+	if err != nil {
+		return 0, err
+	}
+
+	q.logger.Info("Dead-lettered jobs purged",
+		zap.Strings("ids", selection.IDs),
+		zap.String("type", selection.Type),
+		zap.Int("purged", purged))
+	return purged, nil
+}
+
+// work claims and processes jobs of one type until ctx is cancelled
+func (q *Queue) work(ctx context.Context, jobType string, reg *registration) {
+	for ctx.Err() == nil {
+		job, err := q.backend.claim(ctx, jobType, q.cfg.Lease)
+		if err != nil && ctx.Err() == nil {
+			q.logger.Error("Failed to claim job", zap.String("type", jobType), zap.Error(err))
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(q.cfg.PollInterval):
+			}
+			continue
+		}
+
+		q.process(ctx, job, reg)
+	}
+}
+
+// process runs a job and records its outcome. A running job isn't interrupted
+// by shutdown, only by its lease running out.
+func (q *Queue) process(ctx context.Context, job *Job, reg *registration) {
+	logger := q.logger.With(
+		zap.String("job_id", job.ID),
+		zap.String("type", job.Type),
+		zap.Int("attempt", job.Attempt))
+
+	jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), q.cfg.Lease)
+	started := time.Now()
+	err := runHandler(jobCtx, reg.handler, job)
+	cancel()
+	jobDuration.Set(time.Since(started).Seconds(), job.Type)
+
+	// Record the outcome even if the queue is shutting down
+	storeCtx := context.WithoutCancel(ctx)
+	var permanent *permanentError
+	switch {
+	case err == nil:
+		processedJobs.Inc(job.Type, "succeeded")
+		logger.Debug("Job succeeded", zap.Duration("duration", time.Since(started)))
+		err = q.backend.complete(storeCtx, job)
+	case errors.As(err, &permanent) || job.Attempt >= reg.maxAttempts:
+		processedJobs.Inc(job.Type, "dead")
+		logger.Error("Job failed permanently, moved to dead letters", zap.Error(err))
+		err = q.backend.bury(storeCtx, job, err.Error())
+	default:
+		runAt := time.Now().Add(q.backoff(job.Attempt))
+		processedJobs.Inc(job.Type, "retried")
+		logger.Warn("Job failed, retrying", zap.Time("retry_at", runAt), zap.Error(err))
+		err = q.backend.retry(storeCtx, job, runAt, err.Error())
+	}
+	if err != nil {
+		logger.Error("Failed to record job outcome", zap.Error(err))
+	}
+}
+
+// runHandler runs a handler, turning a panic into an error so it can't take the worker down
+func runHandler(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// backoff returns the delay before the retry after the given attempt: the
+// retry backoff doubled with every attempt and capped, with jitter so jobs
+// that failed together don't retry together
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.cfg.RetryBackoff
+	for i := 1; i < attempt && delay < q.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.cfg.MaxBackoff {
+		delay = q.cfg.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,178 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryJob is a job with its queue state
+type memoryJob struct {
+	job         Job
+	status      string
+	lockedUntil time.Time
+}
+
+// memoryBackend keeps jobs in memory, they are lost on restart
+type memoryBackend struct {
+	mu     sync.Mutex
+	jobs   map[string]*memoryJob
+	unique map[string]string
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{
+		jobs:   make(map[string]*memoryJob),
+		unique: make(map[string]string),
+	}
+}
+
+func (b *memoryBackend) enqueue(ctx context.Context, job *Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if job.uniqueKey != "" {
+		if _, ok := b.unique[job.uniqueKey]; ok {
+			return ErrDuplicate
+		}
+		b.unique[job.uniqueKey] = job.ID
+	}
+
+	b.jobs[job.ID] = &memoryJob{job: *job, status: statusQueued}
+	return nil
+}
+
+func (b *memoryBackend) claim(ctx context.Context, jobType string, lease time.Duration) (*Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	var next *memoryJob
+	for _, entry := range b.jobs {
+		if entry.job.Type != jobType {
+			continue
+		}
+		due := (entry.status == statusQueued && !entry.job.RunAt.After(now)) ||
+			(entry.status == statusRunning && !entry.lockedUntil.After(now))
+		if due && (next == nil || entry.job.RunAt.Before(next.job.RunAt)) {
+			next = entry
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	next.status = statusRunning
+	next.lockedUntil = now.Add(lease)
+	next.job.Attempt++
+	job := next.job
+	return &job, nil
+}
+
+func (b *memoryBackend) complete(ctx context.Context, job *Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.jobs, job.ID)
+	if job.uniqueKey != "" {
+		delete(b.unique, job.uniqueKey)
+	}
+	return nil
+}
+
+func (b *memoryBackend) retry(ctx context.Context, job *Job, runAt time.Time, message string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if entry, ok := b.jobs[job.ID]; ok {
+		entry.status = statusQueued
+		entry.job.RunAt = runAt
+		entry.job.LastError = message
+	}
+	return nil
+}
+
+func (b *memoryBackend) bury(ctx context.Context, job *Job, message string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if entry, ok := b.jobs[job.ID]; ok {
+		entry.status = statusDead
+		entry.job.LastError = message
+		entry.job.FailedAt = time.Now()
+		entry.job.uniqueKey = ""
+	}
+	if job.uniqueKey != "" {
+		delete(b.unique, job.uniqueKey)
+	}
+	return nil
+}
+
+func (b *memoryBackend) listDead(ctx context.Context, jobType string, page, pageSize int) ([]*Job, int, error) {
+	b.mu.Lock()
+	dead := b.deadJobs(Selection{Type: jobType})
+	b.mu.Unlock()
+
+	sort.Slice(dead, func(i, j int) bool {
+		return dead[i].FailedAt.After(dead[j].FailedAt)
+	})
+
+	start := min((page-1)*pageSize, len(dead))
+	end := min(start+pageSize, len(dead))
+	return dead[start:end], len(dead), nil
+}
+
+func (b *memoryBackend) getDead(ctx context.Context, id string) (*Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, ok := b.jobs[id]
+	if !ok || entry.status != statusDead {
+		return nil, ErrNotFound
+	}
+	job := entry.job
+	return &job, nil
+}
+
+func (b *memoryBackend) replayDead(ctx context.Context, selection Selection) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dead := b.deadJobs(selection)
+	for _, job := range dead {
+		entry := b.jobs[job.ID]
+		entry.status = statusQueued
+		entry.job.Attempt = 0
+		entry.job.RunAt = time.Now()
+		entry.job.FailedAt = time.Time{}
+	}
+	return len(dead), nil
+}
+
+func (b *memoryBackend) purgeDead(ctx context.Context, selection Selection) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dead := b.deadJobs(selection)
+	for _, job := range dead {
+		delete(b.jobs, job.ID)
+	}
+	return len(dead), nil
+}
+
+// deadJobs returns copies of the selected dead-lettered jobs, b.mu must be held
+func (b *memoryBackend) deadJobs(selection Selection) []*Job {
+	var dead []*Job
+	for _, entry := range b.jobs {
+		if entry.status == statusDead && selection.matches(&entry.job) {
+			job := entry.job
+			dead = append(dead, &job)
+		}
+	}
+	return dead
+}
+
+func (b *memoryBackend) close() error {
+	return nil
+}
@@ -0,0 +1,340 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// Redis keys, every job type has its own sorted sets scored by time in milliseconds
+const (
+	// jobKeyPrefix prefixes the hash holding a job
+	jobKeyPrefix = "jobs:job:"
+	// queueKeyPrefix prefixes the queued jobs of a type, scored by when they are due
+	queueKeyPrefix = "jobs:queue:"
+	// runningKeyPrefix prefixes the claimed jobs of a type, scored by when their lease runs out
+	runningKeyPrefix = "jobs:running:"
+	// deadKeyPrefix prefixes the dead-lettered jobs of a type, scored by when they died
+	deadKeyPrefix = "jobs:dead:"
+	// uniqueKeyPrefix prefixes the unique keys of pending jobs
+	uniqueKeyPrefix = "jobs:unique:"
+)
+
+// claimScript requeues the jobs whose lease ran out, then leases the next due job
+// and counts the attempt. It runs atomically so a job is claimed by one worker only.
+var claimScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, id in ipairs(expired) do
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('ZADD', KEYS[1], ARGV[1], id)
+end
+
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 1)
+if #due == 0 then
+	return false
+end
+
+local id = due[1]
+redis.call('ZREM', KEYS[1], id)
+redis.call('ZADD', KEYS[2], ARGV[1] + ARGV[2], id)
+redis.call('HINCRBY', ARGV[3] .. id, 'attempts', 1)
+return id
+`)
+
+// redisBackend stores jobs in Redis. The keys of a job type are assumed to
+// live on one node, Redis Cluster isn't supported.
+type redisBackend struct {
+	client *redis.Client
+}
+
+// newRedisBackend connects to Redis
+func newRedisBackend(cfg *config.RedisConfig) (*redisBackend, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password.Reveal(),
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %w", cfg.Address, err)
+	}
+
+	return &redisBackend{client: client}, nil
+}
+
+func (b *redisBackend) enqueue(ctx context.Context, job *Job) error {
+	if job.uniqueKey != "" {
+		ok, err := b.client.SetNX(ctx, uniqueKeyPrefix+job.uniqueKey, job.ID, 0).Result()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrDuplicate
+		}
+	}
+
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, jobKeyPrefix+job.ID,
+			"type", job.Type,
+			"payload", job.Payload,
+			"attempts", 0,
+			"run_at", job.RunAt.UnixMilli(),
+			"created_at", job.CreatedAt.UnixMilli(),
+			"unique_key", job.uniqueKey)
+		pipe.ZAdd(ctx, queueKeyPrefix+job.Type, redis.Z{Score: float64(job.RunAt.UnixMilli()), Member: job.ID})
+		return nil
+	})
+	if err != nil && job.uniqueKey != "" {
+		b.client.Del(context.WithoutCancel(ctx), uniqueKeyPrefix+job.uniqueKey)
+	}
+	return err
+}
+
+func (b *redisBackend) claim(ctx context.Context, jobType string, lease time.Duration) (*Job, error) {
+	id, err := claimScript.Run(ctx, b.client,
+		[]string{queueKeyPrefix + jobType, runningKeyPrefix + jobType},
+		time.Now().UnixMilli(), lease.Milliseconds(), jobKeyPrefix).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := b.load(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		// The job was removed in the meantime
+		b.client.ZRem(ctx, runningKeyPrefix+jobType, id)
+		return nil, nil
+	}
+	return job, err
+}
+
+// load reads a job from its hash
+func (b *redisBackend) load(ctx context.Context, id string) (*Job, error) {
+	fields, err := b.client.HGetAll(ctx, jobKeyPrefix+id).Result()
+	if err != nil {
+		return nil, err
+	}
+	if fields["type"] == "" {
+		return nil, ErrNotFound
+	}
+
+	attempts, _ := strconv.Atoi(fields["attempts"])
+	runAt, _ := strconv.ParseInt(fields["run_at"], 10, 64)
+	createdAt, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+	return &Job{
+		ID:        id,
+		Type:      fields["type"],
+		Payload:   []byte(fields["payload"]),
+		Attempt:   attempts,
+		RunAt:     time.UnixMilli(runAt),
+		LastError: fields["last_error"],
+		CreatedAt: time.UnixMilli(createdAt),
+		uniqueKey: fields["unique_key"],
+	}, nil
+}
+
+func (b *redisBackend) complete(ctx context.Context, job *Job) error {
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, runningKeyPrefix+job.Type, job.ID)
+		pipe.Del(ctx, jobKeyPrefix+job.ID)
+		if job.uniqueKey != "" {
+			pipe.Del(ctx, uniqueKeyPrefix+job.uniqueKey)
+		}
+		return nil
+	})
+	return err
+}
+
+func (b *redisBackend) retry(ctx context.Context, job *Job, runAt time.Time, message string) error {
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, runningKeyPrefix+job.Type, job.ID)
+		pipe.HSet(ctx, jobKeyPrefix+job.ID, "run_at", runAt.UnixMilli(), "last_error", message)
+		pipe.ZAdd(ctx, queueKeyPrefix+job.Type, redis.Z{Score: float64(runAt.UnixMilli()), Member: job.ID})
+		return nil
+	})
+	return err
+}
+
+// bury moves the job to the dead letters of its type and releases its unique key
+func (b *redisBackend) bury(ctx context.Context, job *Job, message string) error {
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, runningKeyPrefix+job.Type, job.ID)
+		pipe.HSet(ctx, jobKeyPrefix+job.ID, "last_error", message, "unique_key", "")
+		pipe.ZAdd(ctx, deadKeyPrefix+job.Type, redis.Z{Score: float64(time.Now().UnixMilli()), Member: job.ID})
+		if job.uniqueKey != "" {
+			pipe.Del(ctx, uniqueKeyPrefix+job.uniqueKey)
+		}
+		return nil
+	})
+	return err
+}
+
+func (b *redisBackend) listDead(ctx context.Context, jobType string, page, pageSize int) ([]*Job, int, error) {
+	dead, err := b.deadJobs(ctx, Selection{Type: jobType})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sort.Slice(dead, func(i, j int) bool {
+		return dead[i].FailedAt.After(dead[j].FailedAt)
+	})
+
+	start := min((page-1)*pageSize, len(dead))
+	end := min(start+pageSize, len(dead))
+	return dead[start:end], len(dead), nil
+}
+
+func (b *redisBackend) getDead(ctx context.Context, id string) (*Job, error) {
+	dead, err := b.deadJobs(ctx, Selection{IDs: []string{id}})
+	if err != nil {
+		return nil, err
+	}
+	if len(dead) == 0 {
+		return nil, ErrNotFound
+	}
+	return dead[0], nil
+}
+
+func (b *redisBackend) replayDead(ctx context.Context, selection Selection) (int, error) {
+	dead, err := b.deadJobs(ctx, selection)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UnixMilli()
+	replayed := 0
+	for _, job := range dead {
+		// Only replay jobs still in the dead letters, a concurrent replay may have taken them
+		removed, err := b.client.ZRem(ctx, deadKeyPrefix+job.Type, job.ID).Result()
+		if err != nil {
+			return replayed, err
+		}
+		if removed == 0 {
+			continue
+		}
+
+		_, err = b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, jobKeyPrefix+job.ID, "attempts", 0, "run_at", now)
+			pipe.ZAdd(ctx, queueKeyPrefix+job.Type, redis.Z{Score: float64(now), Member: job.ID})
+			return nil
+		})
+		if err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func (b *redisBackend) purgeDead(ctx context.Context, selection Selection) (int, error) {
+	dead, err := b.deadJobs(ctx, selection)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, job := range dead {
+		removed, err := b.client.ZRem(ctx, deadKeyPrefix+job.Type, job.ID).Result()
+		if err != nil {
+			return purged, err
+		}
+		if removed == 0 {
+			continue
+		}
+
+		if err := b.client.Del(ctx, jobKeyPrefix+job.ID).Err(); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// deadJobs loads the selected dead-lettered jobs. Dead letters are expected to
+// be few, without a type every jobs:dead:<type> set is read.
+func (b *redisBackend) deadJobs(ctx context.Context, selection Selection) ([]*Job, error) {
+	failedAt := make(map[string]time.Time)
+
+	if len(selection.IDs) > 0 {
+		for _, id := range selection.IDs {
+			jobType, err := b.client.HGet(ctx, jobKeyPrefix+id, "type").Result()
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			score, err := b.client.ZScore(ctx, deadKeyPrefix+jobType, id).Result()
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			failedAt[id] = time.UnixMilli(int64(score))
+		}
+	} else {
+		keys := []string{deadKeyPrefix + selection.Type}
+		if selection.Type == "" {
+			var err error
+			keys, err = b.scan(ctx, deadKeyPrefix+"*")
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, key := range keys {
+			entries, err := b.client.ZRangeWithScores(ctx, key, 0, -1).Result()
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				failedAt[entry.Member.(string)] = time.UnixMilli(int64(entry.Score))
+			}
+		}
+	}
+
+	var dead []*Job
+	for id, at := range failedAt {
+		job, err := b.load(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		job.FailedAt = at
+		if selection.matches(job) {
+			dead = append(dead, job)
+		}
+	}
+	return dead, nil
+}
+
+// scan returns the keys matching a pattern
+func (b *redisBackend) scan(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	iter := b.client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+func (b *redisBackend) close() error {
+	return b.client.Close()
+}
@@ -0,0 +1,171 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	jobspb "github.com/linkeunid/hello-go/api/gen/jobs"
+)
+
+// Authorizer checks that the caller may manage dead-lettered jobs, typically an admin
+type Authorizer func(ctx context.Context) error
+
+// Server implements the DeadLetterService gRPC service on a queue
+type Server struct {
+	jobspb.UnimplementedDeadLetterServiceServer
+	queue     *Queue
+	authorize Authorizer
+	logger    *zap.Logger
+}
+
+// NewServer creates a DeadLetterService for the dead letters of a queue
+func NewServer(queue *Queue, authorize Authorizer, logger *zap.Logger) *Server {
+	return &Server{
+		queue:     queue,
+		authorize: authorize,
+		logger:    logger,
+	}
+}
+
+// ListDeadLetters returns dead-lettered jobs, most recently failed first
+func (s *Server) ListDeadLetters(ctx context.Context, req *jobspb.ListDeadLettersRequest) (*jobspb.ListDeadLettersResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	jobs, total, err := s.queue.DeadLetters(ctx, req.Type, int(req.Page), int(req.PageSize))
+	if err != nil {
+		s.logger.Error("Failed to list dead letters", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list dead letters")
+	}
+
+	deadLetters := make([]*jobspb.DeadLetter, len(jobs))
+	for i, job := range jobs {
+		deadLetters[i] = toProto(job)
+	}
+
+	return &jobspb.ListDeadLettersResponse{
+		DeadLetters: deadLetters,
+		Total:       int32(total),
+	}, nil
+}
+
+// GetDeadLetter returns a dead-lettered job with its payload
+func (s *Server) GetDeadLetter(ctx context.Context, req *jobspb.GetDeadLetterRequest) (*jobspb.DeadLetter, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	job, err := s.queue.DeadLetter(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		s.logger.Error("Failed to get dead letter",
+			zap.String("job_id", req.Id),
+			zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get dead letter")
+	}
+
+	return toProto(job), nil
+}
+
+// ReplayDeadLetters queues the selected jobs again with fresh attempts
+func (s *Server) ReplayDeadLetters(ctx context.Context, req *jobspb.DeadLetterSelection) (*jobspb.ReplayDeadLettersResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	selection, err := toSelection(req)
+	if err != nil {
+		return nil, err
+	}
+
+	replayed, err := s.queue.Replay(ctx, selection)
+	if err != nil {
+		if errors.Is(err, ErrNoSelection) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		s.logger.Error("Failed to replay dead letters", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to replay dead letters")
+	}
+
+	return &jobspb.ReplayDeadLettersResponse{Replayed: int32(replayed)}, nil
+}
+
+// PurgeDeadLetters deletes the selected jobs
+func (s *Server) PurgeDeadLetters(ctx context.Context, req *jobspb.DeadLetterSelection) (*jobspb.PurgeDeadLettersResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	selection, err := toSelection(req)
+	if err != nil {
+		return nil, err
+	}
+
+	purged, err := s.queue.Purge(ctx, selection)
+	if err != nil {
+		if errors.Is(err, ErrNoSelection) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		s.logger.Error("Failed to purge dead letters", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to purge dead letters")
+	}
+
+	return &jobspb.PurgeDeadLettersResponse{Purged: int32(purged)}, nil
+}
+
+// toSelection converts a selection request
+func toSelection(req *jobspb.DeadLetterSelection) (Selection, error) {
+	selection := Selection{
+		IDs:  req.Ids,
+		Type: req.Type,
+	}
+	if req.FailedBefore != "" {
+		before, err := time.Parse(time.RFC3339, req.FailedBefore)
+		if err != nil {
+			return Selection{}, status.Error(codes.InvalidArgument, "failed_before must be an RFC 3339 time")
+		}
+		selection.Before = before
+	}
+	return selection, nil
+}
+
+// toProto converts a dead-lettered job to its proto message
+func toProto(job *Job) *jobspb.DeadLetter {
+	return &jobspb.DeadLetter{
+		Id:        job.ID,
+		Type:      job.Type,
+		Payload:   toValue(job.Payload),
+		Attempts:  int32(job.Attempt),
+		Error:     job.LastError,
+		CreatedAt: formatTime(job.CreatedAt),
+		FailedAt:  formatTime(job.FailedAt),
+	}
+}
+
+// toValue converts a JSON payload to a value, invalid JSON is left out
+func toValue(payload []byte) *structpb.Value {
+	if len(payload) == 0 {
+		return nil
+	}
+
+	value := &structpb.Value{}
+	if err := protojson.Unmarshal(payload, value); err != nil {
+		return nil
+	}
+	return value
+}
+
+// formatTime formats a timestamp for responses
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
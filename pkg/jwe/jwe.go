@@ -0,0 +1,128 @@
+package jwe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// header is the protected header of tokens encrypted by Encrypt: direct encryption
+// with a shared key and AES-256-GCM, wrapping a signed JWT (RFC 7516, RFC 7519 section 5.2)
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"dir","enc":"A256GCM","cty":"JWT"}`))
+
+// gcmTagSize is the size of the authentication tag appended by AES-GCM
+const gcmTagSize = 16
+
+// Common errors
+var (
+	ErrDecryptionFailed = errors.New("failed to decrypt token")
+	ErrNoKey            = errors.New("token is encrypted but no encryption key is configured")
+)
+
+// deriveKey turns the configured key into an AES-256 key
+func deriveKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// newGCM creates the AES-256-GCM cipher for key
+func newGCM(key string) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt wraps a signed JWT in a JWE in compact serialization
+func Encrypt(token, key string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", fmt.Errorf("failed to generate iv: %w", err)
+	}
+
+	// The encoded header is the additional authenticated data
+	sealed := gcm.Seal(nil, iv, []byte(token), []byte(header))
+	ciphertext, tag := sealed[:len(sealed)-gcmTagSize], sealed[len(sealed)-gcmTagSize:]
+
+	// Direct encryption has an empty encrypted key
+	return strings.Join([]string{
+		header,
+		"",
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// Decrypt returns the signed JWT wrapped by Encrypt
+func Decrypt(token, key string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 || parts[1] != "" {
+		return "", ErrDecryptionFailed
+	}
+
+	// Only accept the algorithms Encrypt uses
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrDecryptionFailed
+	}
+	var fields struct {
+		Alg string `json:"alg"`
+		Enc string `json:"enc"`
+	}
+	if err := json.Unmarshal(rawHeader, &fields); err != nil || fields.Alg != "dir" || fields.Enc != "A256GCM" {
+		return "", ErrDecryptionFailed
+	}
+
+	iv, err1 := base64.RawURLEncoding.DecodeString(parts[2])
+	ciphertext, err2 := base64.RawURLEncoding.DecodeString(parts[3])
+	tag, err3 := base64.RawURLEncoding.DecodeString(parts[4])
+	if err1 != nil || err2 != nil || err3 != nil || len(tag) != gcmTagSize {
+		return "", ErrDecryptionFailed
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(iv) != gcm.NonceSize() {
+		return "", ErrDecryptionFailed
+	}
+
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return "", ErrDecryptionFailed
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether token is a JWE rather than a signed JWT,
+// which has three parts instead of five
+func IsEncrypted(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// Open returns the signed JWT of a token, decrypting it if it is encrypted.
+// Signed tokens are returned as is, so encryption can be enabled without
+// invalidating the tokens issued before.
+func Open(token, key string) (string, error) {
+	if !IsEncrypted(token) {
+		return token, nil
+	}
+	if key == "" {
+		return "", ErrNoKey
+	}
+	return Decrypt(token, key)
+}
@@ -0,0 +1,214 @@
+// Package listfilter implements the filter expressions of list endpoints, a
+// subset of AIP-160, e.g.
+//
+//	name = "Jo*" AND (role = admin OR created_at > "2024-01-01T00:00:00Z")
+//
+// Expressions only reference the fields of a Schema, which maps them to
+// columns, so clients can't query arbitrary columns. Values are passed to the
+// database as arguments, never as SQL.
+package listfilter
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// Type is the type of a field's values
+type Type int
+
+// Field types
+const (
+	// String values are quoted or bare words. With = and != a leading or
+	// trailing * matches any prefix or suffix.
+	String Type = iota
+	// Number values are decimal numbers
+	Number
+	// Bool values are true or false, compared with = and != only
+	Bool
+	// Timestamp values are RFC 3339 timestamps
+	Timestamp
+)
+
+// Field is a field expressions may reference
+type Field struct {
+	// Column is the database column of the field
+	Column string
+	Type   Type
+	// Values are the allowed values of a String field, any if empty
+	Values []string
+}
+
+// Schema lists the fields of a list endpoint by the name used in expressions
+type Schema map[string]Field
+
+// Comparison operators
+const (
+	OpEqual          = "="
+	OpNotEqual       = "!="
+	OpLess           = "<"
+	OpLessOrEqual    = "<="
+	OpGreater        = ">"
+	OpGreaterOrEqual = ">="
+)
+
+// Expr is a parsed filter expression
+type Expr interface {
+	// sql returns the expression as SQL condition with its arguments
+	sql() (string, []interface{})
+	// match evaluates the expression against the field values of a record
+	match(values func(column string) interface{}) bool
+	// fields adds the fields the expression references to set
+	fields(set map[string]bool)
+}
+
+// And matches records matching all of its expressions
+type And []Expr
+
+// Or matches records matching any of its expressions
+type Or []Expr
+
+// Not matches records its expression doesn't match
+type Not struct {
+	Expr Expr
+}
+
+// Restriction compares a field to a value
+type Restriction struct {
+	Field    string
+	Column   string
+	Operator string
+	// Value is a string, float64, bool or time.Time, by the field's type
+	Value interface{}
+}
+
+// Scope returns the expression as query scope
+func Scope(expr Expr) database.Scope {
+	query, args := expr.sql()
+	return database.Where(query, args...)
+}
+
+// Match reports whether a record matches the expression, for filtering in
+// memory. values returns the value of a field's column, nil for none, so
+// schemas naming the same columns differently share it. A nil expression
+// matches every record.
+func Match(expr Expr, values func(column string) interface{}) bool {
+	return expr == nil || expr.match(values)
+}
+
+// Fields returns the fields an expression references, sorted
+func Fields(expr Expr) []string {
+	if expr == nil {
+		return nil
+	}
+	set := make(map[string]bool)
+	expr.fields(set)
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e And) sql() (string, []interface{}) {
+	return join(e, " AND ")
+}
+
+func (e And) match(values func(string) interface{}) bool {
+	for _, expr := range e {
+		if !expr.match(values) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e And) fields(set map[string]bool) {
+	for _, expr := range e {
+		expr.fields(set)
+	}
+}
+
+func (e Or) sql() (string, []interface{}) {
+	return join(e, " OR ")
+}
+
+func (e Or) match(values func(string) interface{}) bool {
+	for _, expr := range e {
+		if expr.match(values) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Or) fields(set map[string]bool) {
+	for _, expr := range e {
+		expr.fields(set)
+	}
+}
+
+func (e Not) sql() (string, []interface{}) {
+	query, args := e.Expr.sql()
+	return "NOT (" + query + ")", args
+}
+
+func (e Not) match(values func(string) interface{}) bool {
+	return !e.Expr.match(values)
+}
+
+func (e Not) fields(set map[string]bool) {
+	e.Expr.fields(set)
+}
+
+func (r Restriction) sql() (string, []interface{}) {
+	if pattern, ok := r.pattern(); ok {
+		if r.Operator == OpNotEqual {
+			return r.Column + " NOT LIKE ?", []interface{}{pattern}
+		}
+		return r.Column + " LIKE ?", []interface{}{pattern}
+	}
+	return r.Column + " " + r.Operator + " ?", []interface{}{r.Value}
+}
+
+func (r Restriction) fields(set map[string]bool) {
+	set[r.Field] = true
+}
+
+// pattern returns the LIKE pattern of a string comparison with wildcards
+func (r Restriction) pattern() (string, bool) {
+	value, ok := r.Value.(string)
+	if !ok || (r.Operator != OpEqual && r.Operator != OpNotEqual) {
+		return "", false
+	}
+	prefix, suffix := strings.HasSuffix(value, "*"), strings.HasPrefix(value, "*")
+	if !prefix && !suffix {
+		return "", false
+	}
+
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "*"), "*")
+	// Wildcards of LIKE in the value match themselves
+	value = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+	if suffix {
+		value = "%" + value
+	}
+	if prefix {
+		value += "%"
+	}
+	return value, true
+}
+
+// join joins the SQL of expressions, each in parentheses
+func join(exprs []Expr, separator string) (string, []interface{}) {
+	parts := make([]string, len(exprs))
+	var args []interface{}
+	for i, expr := range exprs {
+		query, exprArgs := expr.sql()
+		parts[i] = "(" + query + ")"
+		args = append(args, exprArgs...)
+	}
+	return strings.Join(parts, separator), args
+}
@@ -0,0 +1,90 @@
+package listfilter
+
+import (
+	"strings"
+	"time"
+)
+
+func (r Restriction) match(values func(string) interface{}) bool {
+	value := values(r.Column)
+	if value == nil {
+		// Like NULL in SQL, a missing value matches no comparison
+		return false
+	}
+
+	var cmp int
+	switch want := r.Value.(type) {
+	case string:
+		got, ok := value.(string)
+		if !ok {
+			return false
+		}
+		if _, wildcard := r.pattern(); wildcard {
+			return matchPattern(got, want) == (r.Operator == OpEqual)
+		}
+		cmp = strings.Compare(got, want)
+	case float64:
+		got, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		cmp = compareFloats(got, want)
+	case bool:
+		got, ok := value.(bool)
+		if !ok {
+			return false
+		}
+		return (got == want) == (r.Operator == OpEqual)
+	case time.Time:
+		got, ok := value.(time.Time)
+		if !ok {
+			return false
+		}
+		cmp = got.Compare(want)
+	default:
+		return false
+	}
+
+	switch r.Operator {
+	case OpEqual:
+		return cmp == 0
+	case OpNotEqual:
+		return cmp != 0
+	case OpLess:
+		return cmp < 0
+	case OpLessOrEqual:
+		return cmp <= 0
+	case OpGreater:
+		return cmp > 0
+	case OpGreaterOrEqual:
+		return cmp >= 0
+	default:
+		return false
+	}
+}
+
+// matchPattern matches a value against a string with a leading or trailing *
+func matchPattern(value, pattern string) bool {
+	prefix, suffix := strings.HasSuffix(pattern, "*"), strings.HasPrefix(pattern, "*")
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "*"), "*")
+	switch {
+	case prefix && suffix:
+		return strings.Contains(value, pattern)
+	case prefix:
+		return strings.HasPrefix(value, pattern)
+	default:
+		return strings.HasSuffix(value, pattern)
+	}
+}
+
+// compareFloats compares two numbers like strings.Compare
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
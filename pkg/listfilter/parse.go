@@ -0,0 +1,330 @@
+package listfilter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// Limits of expressions, so filters can't make arbitrarily expensive queries
+const (
+	// MaxLength is the longest accepted expression in bytes
+	MaxLength = 1024
+	// MaxRestrictions is the most comparisons an expression may have
+	MaxRestrictions = 16
+	// maxDepth is the deepest nesting of parentheses and NOT
+	maxDepth = 8
+)
+
+// Parse parses an expression of the grammar
+//
+//	expression  = factor { "AND" factor }
+//	factor      = term { "OR" term }
+//	term        = [ "NOT" ] simple
+//	simple      = restriction | "(" expression ")"
+//	restriction = field comparator value
+//	comparator  = "=" | "!=" | "<" | "<=" | ">" | ">="
+//
+// where values are bare words or quoted strings. As in AIP-160, OR binds
+// tighter than AND. Fields must be in the schema and values must have their
+// type. An empty expression returns nil, which matches everything. Errors are
+// Invalid with a violation of the "filter" field.
+func Parse(input string, schema Schema) (Expr, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
+	}
+	if len(input) > MaxLength {
+		return nil, invalid(fmt.Sprintf("must be at most %d bytes", MaxLength))
+	}
+
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, schema: schema}
+	expr, err := p.expression(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, invalid(fmt.Sprintf("unexpected %s at position %d, expected AND or OR", t, t.pos))
+	}
+	return expr, nil
+}
+
+// invalid returns the error of an invalid expression
+func invalid(description string) error {
+	var violations apperrors.Violations
+	violations.Add("filter", description)
+	return violations.Err()
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenComparator
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// pos is the byte offset in the expression, from 1
+	pos int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of filter"
+	case tokenString:
+		return strconv.Quote(t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// lex splits an expression into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "(", pos: i + 1})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")", pos: i + 1})
+			i++
+		case c == '=' || c == '<' || c == '>' || c == '!':
+			end := i + 1
+			if end < len(input) && input[end] == '=' && c != '=' {
+				end++
+			}
+			if input[i:end] == "!" {
+				return nil, invalid(fmt.Sprintf("unexpected \"!\" at position %d, expected !=", i+1))
+			}
+			tokens = append(tokens, token{kind: tokenComparator, text: input[i:end], pos: i + 1})
+			i = end
+		case c == '"' || c == '\'':
+			text, end, err := lexString(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i + 1})
+			i = end
+		default:
+			end := i
+			for end < len(input) && !strings.ContainsRune(" \t\n\r()=<>!\"'", rune(input[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: input[i:end], pos: i + 1})
+			i = end
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(input) + 1}), nil
+}
+
+// lexString reads the quoted string starting at start, backslashes escape the next character
+func lexString(input string, start int) (string, int, error) {
+	quote := input[start]
+	var b strings.Builder
+	for i := start + 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			if i+1 == len(input) {
+				break
+			}
+			i++
+			b.WriteByte(input[i])
+		case quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(input[i])
+		}
+	}
+	return "", 0, invalid(fmt.Sprintf("unterminated string at position %d", start+1))
+}
+
+type parser struct {
+	tokens       []token
+	next         int
+	schema       Schema
+	restrictions int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// keyword reports whether the next token is the keyword and consumes it if so
+func (p *parser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokenWord && t.text == word {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expression(depth int) (Expr, error) {
+	var exprs And
+	for {
+		expr, err := p.factor(depth)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if !p.keyword("AND") {
+			break
+		}
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return exprs, nil
+}
+
+func (p *parser) factor(depth int) (Expr, error) {
+	var exprs Or
+	for {
+		expr, err := p.term(depth)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if !p.keyword("OR") {
+			break
+		}
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return exprs, nil
+}
+
+func (p *parser) term(depth int) (Expr, error) {
+	if depth > maxDepth {
+		return nil, invalid(fmt.Sprintf("nested deeper than %d levels", maxDepth))
+	}
+
+	if p.keyword("NOT") {
+		expr, err := p.term(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expr: expr}, nil
+	}
+
+	if p.peek().kind == tokenOpen {
+		p.advance()
+		expr, err := p.expression(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if t := p.advance(); t.kind != tokenClose {
+			return nil, invalid(fmt.Sprintf("unexpected %s at position %d, expected \")\"", t, t.pos))
+		}
+		return expr, nil
+	}
+
+	return p.restriction()
+}
+
+func (p *parser) restriction() (Expr, error) {
+	name := p.advance()
+	if name.kind != tokenWord || name.text == "AND" || name.text == "OR" {
+		return nil, invalid(fmt.Sprintf("unexpected %s at position %d, expected a field", name, name.pos))
+	}
+	field, ok := p.schema[name.text]
+	if !ok {
+		return nil, invalid(fmt.Sprintf("unknown field %q at position %d, expected one of %s", name.text, name.pos, p.fieldNames()))
+	}
+
+	comparator := p.advance()
+	if comparator.kind != tokenComparator {
+		return nil, invalid(fmt.Sprintf("unexpected %s at position %d, expected a comparator like =", comparator, comparator.pos))
+	}
+	value := p.advance()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, invalid(fmt.Sprintf("unexpected %s at position %d, expected a value", value, value.pos))
+	}
+
+	p.restrictions++
+	if p.restrictions > MaxRestrictions {
+		return nil, invalid(fmt.Sprintf("must have at most %d comparisons", MaxRestrictions))
+	}
+
+	parsed, err := parseValue(field, comparator.text, value.text)
+	if err != nil {
+		return nil, invalid(fmt.Sprintf("invalid value %s of %s at position %d, %s", value, name.text, value.pos, err))
+	}
+	return Restriction{
+		Field:    name.text,
+		Column:   field.Column,
+		Operator: comparator.text,
+		Value:    parsed,
+	}, nil
+}
+
+// fieldNames lists the schema's fields for errors
+func (p *parser) fieldNames() string {
+	names := make([]string, 0, len(p.schema))
+	for name := range p.schema {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// parseValue converts a value to the field's type
+func parseValue(field Field, comparator, text string) (interface{}, error) {
+	switch field.Type {
+	case Number:
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil || strings.IndexFunc(text, unicode.IsLetter) >= 0 {
+			return nil, fmt.Errorf("expected a number")
+		}
+		return value, nil
+	case Bool:
+		if comparator != OpEqual && comparator != OpNotEqual {
+			return nil, fmt.Errorf("booleans can only be compared with = and !=")
+		}
+		switch text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("expected true or false")
+	case Timestamp:
+		value, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return nil, fmt.Errorf("expected an RFC 3339 timestamp like 2024-01-01T00:00:00Z")
+		}
+		return value, nil
+	default:
+		if len(field.Values) > 0 && !slices.Contains(field.Values, text) {
+			return nil, fmt.Errorf("expected one of %s", strings.Join(field.Values, ", "))
+		}
+		return text, nil
+	}
+}
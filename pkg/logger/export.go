@@ -0,0 +1,464 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+// exportedBatches counts the pushes of log batches by exporter and outcome
+var exportedBatches = metrics.NewCounterVec("log_export_batches_total",
+	"Batches of log entries pushed by LOG_EXPORTER, by exporter and outcome", "exporter", "outcome")
+
+// exportAttempts is the number of times a batch is pushed before it's dropped
+const exportAttempts = 3
+
+// traceIDField is the field of the trace ID, passed as the trace of OTLP log records
+const traceIDField = "trace_id"
+
+// exportRecord is a log entry queued for export
+type exportRecord struct {
+	entry  zapcore.Entry
+	fields map[string]interface{}
+}
+
+// exportCore queues the entries it writes for an exporter
+type exportCore struct {
+	zapcore.LevelEnabler
+	fields   []zapcore.Field
+	exporter *exporter
+}
+
+// newExportCore creates a core shipping the entries at or above level to the
+// exporter of LOG_EXPORTER
+func newExportCore(cfg *config.Config, level zapcore.LevelEnabler) zapcore.Core {
+	return &exportCore{LevelEnabler: level, exporter: newExporter(cfg)}
+}
+
+// With adds fields to the core
+func (c *exportCore) With(fields []zapcore.Field) zapcore.Core {
+	return &exportCore{
+		LevelEnabler: c.LevelEnabler,
+		fields:       append(c.fields[:len(c.fields):len(c.fields)], fields...),
+		exporter:     c.exporter,
+	}
+}
+
+// Check adds the core to entries it's enabled for
+func (c *exportCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write queues an entry, it's dropped if the queue is full
+func (c *exportCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(enc)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	c.exporter.enqueue(exportRecord{entry: entry, fields: enc.Fields})
+
+	// The process is about to exit, as the io core syncs it
+	if entry.Level > zapcore.ErrorLevel {
+		return c.Sync()
+	}
+	return nil
+}
+
+// Sync pushes the queued entries
+func (c *exportCore) Sync() error {
+	return c.exporter.flush()
+}
+
+// exporter pushes queued log entries in batches from a goroutine. Logging
+// never waits for a push: while pushes are slow or failing entries pile up in
+// the queue, and those logged while it's full are dropped and counted.
+type exporter struct {
+	cfg    *config.LogExportConfig
+	name   string
+	encode func(records []exportRecord, labels map[string]string) ([]byte, error)
+	labels map[string]string
+	client *http.Client
+	queue  chan exportRecord
+	// flushes requests pushing the queue, the channel is closed once it's done
+	flushes chan chan struct{}
+	// failing is set while pushes fail, so failures are reported once
+	failing bool
+}
+
+// newExporter creates the exporter of LOG_EXPORTER and starts pushing
+func newExporter(cfg *config.Config) *exporter {
+	exportCfg := &cfg.Tracing.LogExport
+
+	// Entries are labeled with the service, e.g. "auth", and region
+	labels := map[string]string{"service_name": filepath.Base(os.Args[0])}
+	if cfg.Region != "" {
+		labels["region"] = cfg.Region
+	}
+	for name, value := range exportCfg.Labels {
+		labels[name] = value
+	}
+
+	e := &exporter{
+		cfg:     exportCfg,
+		name:    exportCfg.Exporter,
+		encode:  encodeLoki,
+		labels:  labels,
+		client:  &http.Client{Timeout: exportCfg.Timeout},
+		queue:   make(chan exportRecord, exportCfg.QueueSize),
+		flushes: make(chan chan struct{}),
+	}
+	if exportCfg.Exporter == config.LogExporterOTLP {
+		e.encode = encodeOTLP
+	}
+
+	go e.run()
+	return e
+}
+
+// enqueue queues a record without blocking
+func (e *exporter) enqueue(record exportRecord) {
+	select {
+	case e.queue <- record:
+	default:
+		droppedLogs.Inc(record.entry.Level.String(), "export_queue_full")
+	}
+}
+
+// flush pushes the queued records, waiting at most the push timeout
+func (e *exporter) flush() error {
+	done := make(chan struct{})
+	timeout := time.NewTimer(e.cfg.Timeout)
+	defer timeout.Stop()
+
+	select {
+	case e.flushes <- done:
+	case <-timeout.C:
+		return fmt.Errorf("flushing logs to %s timed out", e.name)
+	}
+	select {
+	case <-done:
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("flushing logs to %s timed out", e.name)
+	}
+}
+
+// run pushes batches when they're full or every flush interval
+func (e *exporter) run() {
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]exportRecord, 0, e.cfg.BatchSize)
+	send := func() {
+		if len(batch) > 0 {
+			e.push(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case record := <-e.queue:
+			if batch = append(batch, record); len(batch) >= e.cfg.BatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case done := <-e.flushes:
+			for drained := false; !drained; {
+				select {
+				case record := <-e.queue:
+					if batch = append(batch, record); len(batch) >= e.cfg.BatchSize {
+						send()
+					}
+				default:
+					drained = true
+				}
+			}
+			send()
+			close(done)
+		}
+	}
+}
+
+// push sends a batch, retrying throttled and failed pushes. The batch is
+// dropped after exportAttempts or if the endpoint rejects it.
+func (e *exporter) push(batch []exportRecord) {
+	body, err := e.encode(batch, e.labels)
+	if err != nil {
+		e.drop(batch, "encode_failed", err)
+		return
+	}
+
+	backoff := e.cfg.FlushInterval
+	for attempt := 1; ; attempt++ {
+		retry, err := e.post(body)
+		if err == nil {
+			exportedBatches.Inc(e.name, "success")
+			if e.failing {
+				e.failing = false
+				fmt.Fprintf(os.Stderr, "Log export to %s resumed\n", e.name)
+			}
+			return
+		}
+		if !retry || attempt == exportAttempts {
+			e.drop(batch, "export_failed", err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends an encoded batch and reports whether a failed push can be retried
+func (e *exporter) post(body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.cfg.Headers {
+		req.Header.Set(name, value.Reveal())
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(message))
+}
+
+// drop counts the records of a batch that couldn't be pushed. Failures are
+// reported on standard error, as logging them would queue more records.
+func (e *exporter) drop(batch []exportRecord, reason string, err error) {
+	exportedBatches.Inc(e.name, "failure")
+	for _, record := range batch {
+		droppedLogs.Inc(record.entry.Level.String(), reason)
+	}
+	if !e.failing {
+		e.failing = true
+		fmt.Fprintf(os.Stderr, "Log export to %s failing, dropped %d entries: %v\n", e.name, len(batch), err)
+	}
+}
+
+// encodeLoki encodes records as Loki push request, a stream per level. Lines
+// are the JSON entries written to standard output.
+func encodeLoki(records []exportRecord, labels map[string]string) ([]byte, error) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+
+	// Loki expects the entries of a stream in order, goroutines may queue them out of order
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].entry.Time.Before(records[j].entry.Time)
+	})
+
+	streams := make(map[zapcore.Level]*stream)
+	var levels []zapcore.Level
+	for _, record := range records {
+		s, ok := streams[record.entry.Level]
+		if !ok {
+			streamLabels := make(map[string]string, len(labels)+1)
+			for name, value := range labels {
+				streamLabels[name] = value
+			}
+			streamLabels["level"] = record.entry.Level.String()
+			s = &stream{Stream: streamLabels}
+			streams[record.entry.Level] = s
+			levels = append(levels, record.entry.Level)
+		}
+
+		line, err := json.Marshal(lokiLine(record))
+		if err != nil {
+			return nil, err
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(record.entry.Time.UnixNano(), 10), string(line)})
+	}
+
+	body := struct {
+		Streams []*stream `json:"streams"`
+	}{}
+	for _, level := range levels {
+		body.Streams = append(body.Streams, streams[level])
+	}
+	return json.Marshal(body)
+}
+
+// lokiLine returns the JSON object of a record, as written to standard output
+func lokiLine(record exportRecord) map[string]interface{} {
+	line := make(map[string]interface{}, len(record.fields)+6)
+	for key, value := range record.fields {
+		line[key] = jsonValue(value)
+	}
+	line["level"] = record.entry.Level.String()
+	line["time"] = record.entry.Time.UTC().Format(time.RFC3339Nano)
+	line["msg"] = record.entry.Message
+	if record.entry.LoggerName != "" {
+		line["logger"] = record.entry.LoggerName
+	}
+	if record.entry.Caller.Defined {
+		line["caller"] = record.entry.Caller.TrimmedPath()
+	}
+	if record.entry.Stack != "" {
+		line["stacktrace"] = record.entry.Stack
+	}
+	return line
+}
+
+// jsonValue converts durations to seconds, as the encoder of standard output
+func jsonValue(value interface{}) interface{} {
+	if duration, ok := value.(time.Duration); ok {
+		return duration.Seconds()
+	}
+	return value
+}
+
+// otlpSeverities are the OTLP severity numbers of zap levels
+var otlpSeverities = map[zapcore.Level]int{
+	zapcore.DebugLevel:  5,
+	zapcore.InfoLevel:   9,
+	zapcore.WarnLevel:   13,
+	zapcore.ErrorLevel:  17,
+	zapcore.DPanicLevel: 21,
+	zapcore.PanicLevel:  21,
+	zapcore.FatalLevel:  21,
+}
+
+// encodeOTLP encodes records as OTLP/HTTP JSON ExportLogsServiceRequest, the
+// labels are resource attributes
+func encodeOTLP(records []exportRecord, labels map[string]string) ([]byte, error) {
+	type logRecord struct {
+		TimeUnixNano   string                   `json:"timeUnixNano"`
+		SeverityNumber int                      `json:"severityNumber"`
+		SeverityText   string                   `json:"severityText"`
+		Body           map[string]interface{}   `json:"body"`
+		Attributes     []map[string]interface{} `json:"attributes,omitempty"`
+		TraceID        string                   `json:"traceId,omitempty"`
+	}
+
+	resource := make([]map[string]interface{}, 0, len(labels))
+	for name, value := range labels {
+		// OTLP names the service attribute service.name
+		if name == "service_name" {
+			name = "service.name"
+		}
+		resource = append(resource, otlpAttribute(name, value))
+	}
+	sort.Slice(resource, func(i, j int) bool {
+		return resource[i]["key"].(string) < resource[j]["key"].(string)
+	})
+
+	logRecords := make([]logRecord, 0, len(records))
+	for _, record := range records {
+		lr := logRecord{
+			TimeUnixNano:   strconv.FormatInt(record.entry.Time.UnixNano(), 10),
+			SeverityNumber: otlpSeverities[record.entry.Level],
+			SeverityText:   record.entry.Level.CapitalString(),
+			Body:           map[string]interface{}{"stringValue": record.entry.Message},
+		}
+		if record.entry.LoggerName != "" {
+			lr.Attributes = append(lr.Attributes, otlpAttribute("logger", record.entry.LoggerName))
+		}
+		if record.entry.Caller.Defined {
+			lr.Attributes = append(lr.Attributes, otlpAttribute("caller", record.entry.Caller.TrimmedPath()))
+		}
+		if record.entry.Stack != "" {
+			lr.Attributes = append(lr.Attributes, otlpAttribute("stacktrace", record.entry.Stack))
+		}
+
+		keys := make([]string, 0, len(record.fields))
+		for key := range record.fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := record.fields[key]
+			if id, ok := value.(string); ok && key == traceIDField && isTraceID(id) {
+				lr.TraceID = id
+				continue
+			}
+			lr.Attributes = append(lr.Attributes, otlpAttribute(key, value))
+		}
+		logRecords = append(logRecords, lr)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"resourceLogs": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": resource},
+			"scopeLogs": []interface{}{map[string]interface{}{
+				"scope":      map[string]interface{}{"name": "github.com/linkeunid/hello-go/pkg/logger"},
+				"logRecords": logRecords,
+			}},
+		}},
+	})
+}
+
+// otlpAttribute returns an OTLP KeyValue, values other than strings, numbers
+// and booleans are JSON encoded strings
+func otlpAttribute(key string, value interface{}) map[string]interface{} {
+	var anyValue map[string]interface{}
+	switch v := jsonValue(value).(type) {
+	case string:
+		anyValue = map[string]interface{}{"stringValue": v}
+	case bool:
+		anyValue = map[string]interface{}{"boolValue": v}
+	case int:
+		anyValue = map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int32:
+		anyValue = map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int64:
+		anyValue = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case uint32:
+		anyValue = map[string]interface{}{"intValue": strconv.FormatUint(uint64(v), 10)}
+	case uint64:
+		anyValue = map[string]interface{}{"intValue": strconv.FormatUint(v, 10)}
+	case float32:
+		anyValue = map[string]interface{}{"doubleValue": float64(v)}
+	case float64:
+		anyValue = map[string]interface{}{"doubleValue": v}
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			encoded = []byte(fmt.Sprint(v))
+		}
+		anyValue = map[string]interface{}{"stringValue": string(encoded)}
+	}
+	return map[string]interface{}{"key": key, "value": anyValue}
+}
+
+// isTraceID reports whether an ID is a W3C trace ID, 16 bytes hex encoded
+func isTraceID(id string) bool {
+	decoded, err := hex.DecodeString(id)
+	return err == nil && len(decoded) == 16
+}
@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// PayloadLoggerName names the logger of request and response payloads. With
+// LOG_PAYLOADS=sampled it logs at debug level whatever the log level, since
+// the caller only logs the payloads of selected requests.
+const PayloadLoggerName = "payloads"
+
+// GRPCLoggerName names the logger gRPC's own logs are written to, at error
+// level unless LOG_LEVELS sets another, as gRPC does by default
+const GRPCLoggerName = "grpc"
+
+// parseLevel returns the zap level of debug, info, warn or error
+func parseLevel(name string) (zapcore.Level, bool) {
+	switch name {
+	case "debug":
+		return zapcore.DebugLevel, true
+	case "info":
+		return zapcore.InfoLevel, true
+	case "warn":
+		return zapcore.WarnLevel, true
+	case "error":
+		return zapcore.ErrorLevel, true
+	}
+	return zapcore.InfoLevel, false
+}
+
+// loggerLevels are the levels of the named loggers
+type loggerLevels struct {
+	level     zapcore.Level
+	overrides map[string]zapcore.Level
+	// min is the lowest level of any logger
+	min zapcore.Level
+	// resolved caches the level of every logger name seen
+	resolved sync.Map
+}
+
+// newLoggerLevels creates the levels of loggers at level unless overridden
+func newLoggerLevels(level zapcore.Level, overrides map[string]zapcore.Level) *loggerLevels {
+	levels := &loggerLevels{level: level, overrides: overrides, min: level}
+	for _, override := range overrides {
+		if override < levels.min {
+			levels.min = override
+		}
+	}
+	return levels
+}
+
+// levelOf returns the level of a named logger. Names of nested loggers are
+// dotted, e.g. "auth_service.revocation": the override of the longest prefix
+// of the name applies, or else the override of its last segment having one, so
+// "revocation" applies to the revocation logger of every service.
+func (l *loggerLevels) levelOf(name string) zapcore.Level {
+	if level, ok := l.resolved.Load(name); ok {
+		return level.(zapcore.Level)
+	}
+
+	level := l.level
+	segments := strings.Split(name, ".")
+	found := false
+	for i := len(segments); i > 0 && !found; i-- {
+		if override, ok := l.overrides[strings.Join(segments[:i], ".")]; ok {
+			level, found = override, true
+		}
+	}
+	for i := len(segments) - 1; i >= 0 && !found; i-- {
+		if override, ok := l.overrides[segments[i]]; ok {
+			level, found = override, true
+		}
+	}
+
+	l.resolved.Store(name, level)
+	return level
+}
+
+// levelCore enforces the level of the named logger of every entry. The wrapped
+// core must accept entries at the lowest level of any logger.
+type levelCore struct {
+	zapcore.Core
+	levels *loggerLevels
+}
+
+// newLevelCore wraps a core to write the entries of each named logger at its own level
+func newLevelCore(core zapcore.Core, levels *loggerLevels) zapcore.Core {
+	return &levelCore{Core: core, levels: levels}
+}
+
+// Enabled reports whether any logger writes entries at the level, the level
+// of the entry's logger is checked by Check
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return level >= c.levels.min
+}
+
+// With adds fields to the core
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+// Check passes entries at the level of their logger to the wrapped core
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if entry.Level >= c.levels.levelOf(entry.LoggerName) {
+		return c.Core.Check(entry, checked)
+	}
+	return checked
+}
@@ -5,26 +5,27 @@ import (
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zapgrpc"
+	"google.golang.org/grpc/grpclog"
 
 	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/sentry"
 )
 
 // NewLogger creates a new logger
 func NewLogger(cfg *config.Config) (*zap.Logger, error) {
-	// Determine log level from config
-	var level zapcore.Level
-	switch cfg.Logging.Level {
-	case "debug":
-		level = zapcore.DebugLevel
-	case "info":
-		level = zapcore.InfoLevel
-	case "warn":
-		level = zapcore.WarnLevel
-	case "error":
-		level = zapcore.ErrorLevel
-	default:
-		level = zapcore.InfoLevel
+	// Determine log levels from config, an invalid level falls back to info
+	level, _ := parseLevel(cfg.Logging.Level)
+	overrides := map[string]zapcore.Level{GRPCLoggerName: zapcore.ErrorLevel}
+	if cfg.Logging.Payloads == config.LogPayloadsSampled {
+		overrides[PayloadLoggerName] = zapcore.DebugLevel
 	}
+	for name, value := range cfg.Logging.Levels {
+		if override, ok := parseLevel(value); ok {
+			overrides[name] = override
+		}
+	}
+	levels := newLoggerLevels(level, overrides)
 
 	// Create encoder config
 	encoderConfig := zapcore.EncoderConfig{
@@ -46,11 +47,50 @@ func NewLogger(cfg *config.Config) (*zap.Logger, error) {
 	core := zapcore.NewCore(
 		zapcore.NewJSONEncoder(encoderConfig),
 		zapcore.AddSync(os.Stdout),
-		level,
+		levels.min,
 	)
 
+	// Ship the entries to Loki or an OTLP collector as well, they go through the same scrubbing, sampling and levels
+	if cfg.Tracing.LogExport.Exporter != config.LogExporterNone {
+		core = zapcore.NewTee(core, newExportCore(cfg, levels.min))
+	}
+
+	// Report fatal entries, and error entries with SENTRY_ERROR_SAMPLE_RATE, as crashes to Sentry
+	if err := sentry.Init(cfg); err != nil {
+		return nil, err
+	}
+	if sentry.Enabled() {
+		reported := zapcore.LevelEnabler(zapcore.DPanicLevel)
+		if cfg.Sentry.ErrorSampleRate > 0 {
+			reported = zapcore.ErrorLevel
+		}
+		core = zapcore.NewTee(core, newSentryCore(reported))
+	}
+
+	// Mask secrets that end up in log entries by accident
+	if cfg.Logging.ScrubSecrets {
+		core = NewScrubCore(core)
+	}
+
+	// Sample repeated entries and cap the entries written per second, so a
+	// failure loop can't flood the logs. Sampled out entries don't count.
+	core = newBurstCore(core, cfg.Logging.MaxPerSecond)
+	core = newSamplingCore(core, &cfg.Logging)
+
+	// Apply the levels of LOG_LEVELS to named loggers
+	core = newLevelCore(core, levels)
+
 	// Create logger
 	logger := zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
 
+	// Tell apart the entries of the regions of an active-active deployment
+	if cfg.Region != "" {
+		logger = logger.With(zap.String("region", cfg.Region))
+	}
+
+	// Write gRPC's own logs with the others, its verbosity checks follow the level of its logger
+	grpcLogger := logger.Named(GRPCLoggerName).WithOptions(zap.IncreaseLevel(levels.levelOf(GRPCLoggerName)), zap.WithCaller(false))
+	grpclog.SetLoggerV2(zapgrpc.NewLogger(grpcLogger))
+
 	return logger, nil
 }
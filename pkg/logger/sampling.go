@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+// droppedLogs counts the log entries that weren't written
+var droppedLogs = metrics.NewCounterVec("log_entries_dropped_total",
+	"Log entries dropped by LOG_SAMPLING_*, LOG_MAX_PER_SECOND or a full or failing LOG_EXPORTER, by level and reason", "level", "reason")
+
+// samplingTick is the interval entries are sampled and rate limited in
+const samplingTick = time.Second
+
+// newSamplingCore wraps a core to sample entries with the same level and
+// message, with the first and thereafter counts of their level. Levels without
+// sampling are written as is.
+func newSamplingCore(core zapcore.Core, cfg *config.LoggingConfig) zapcore.Core {
+	hook := zapcore.SamplerHook(func(entry zapcore.Entry, decision zapcore.SamplingDecision) {
+		if decision&zapcore.LogDropped != 0 {
+			droppedLogs.Inc(entry.Level.String(), "sampled")
+		}
+	})
+
+	samplers := make(map[zapcore.Level]zapcore.Core)
+	for _, level := range []zapcore.Level{zapcore.DebugLevel, zapcore.InfoLevel, zapcore.WarnLevel, zapcore.ErrorLevel} {
+		sampling := cfg.Sampling
+		if override, ok := cfg.SamplingByLevel[level.String()]; ok {
+			sampling = override
+		}
+		if sampling.Initial > 0 {
+			samplers[level] = zapcore.NewSamplerWithOptions(core, samplingTick, sampling.Initial, sampling.Thereafter, hook)
+		}
+	}
+	if len(samplers) == 0 {
+		return core
+	}
+	return &samplingCore{Core: core, samplers: samplers}
+}
+
+// samplingCore passes entries to the sampler of their level
+type samplingCore struct {
+	zapcore.Core
+	samplers map[zapcore.Level]zapcore.Core
+}
+
+// With adds fields to the core, samplers keep counting entries together
+func (c *samplingCore) With(fields []zapcore.Field) zapcore.Core {
+	samplers := make(map[zapcore.Level]zapcore.Core, len(c.samplers))
+	for level, sampler := range c.samplers {
+		samplers[level] = sampler.With(fields)
+	}
+	return &samplingCore{Core: c.Core.With(fields), samplers: samplers}
+}
+
+// Check passes entries to the sampler of their level, if it has one
+func (c *samplingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if sampler, ok := c.samplers[entry.Level]; ok {
+		return sampler.Check(entry, checked)
+	}
+	return c.Core.Check(entry, checked)
+}
+
+// burstLimit is the count of entries written in the current tick, shared by
+// the cores of every logger
+type burstLimit struct {
+	mu      sync.Mutex
+	max     int
+	tick    time.Time
+	written int
+	dropped int
+	// core writes the report of dropped entries, without the fields of any logger
+	core zapcore.Core
+}
+
+// burstCore writes at most max entries per tick over every logger, so a
+// failure logged on every request can't saturate the disk or the log
+// pipeline. Entries at DPanic level and above are always written. The number
+// of entries dropped in a tick is logged with the first entry after it.
+type burstCore struct {
+	zapcore.Core
+	limit *burstLimit
+}
+
+// newBurstCore wraps a core to write at most max entries per second, 0 disables the limit
+func newBurstCore(core zapcore.Core, max int) zapcore.Core {
+	if max <= 0 {
+		return core
+	}
+	return &burstCore{Core: core, limit: &burstLimit{max: max, core: core}}
+}
+
+// With adds fields to the core, the limit stays shared
+func (c *burstCore) With(fields []zapcore.Field) zapcore.Core {
+	return &burstCore{Core: c.Core.With(fields), limit: c.limit}
+}
+
+// Check passes entries to the wrapped core while the limit allows it
+func (c *burstCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(entry.Level) {
+		return checked
+	}
+	if entry.Level < zapcore.DPanicLevel && !c.limit.allow(entry.Time) {
+		droppedLogs.Inc(entry.Level.String(), "rate_limited")
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
+
+// allow counts an entry logged at now against the limit of its tick
+func (l *burstLimit) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.tick) >= samplingTick {
+		if l.dropped > 0 {
+			l.report(now)
+		}
+		l.tick, l.written, l.dropped = now, 0, 0
+	}
+	if l.written >= l.max {
+		l.dropped++
+		return false
+	}
+	l.written++
+	return true
+}
+
+// report writes the number of entries dropped in the last tick, the lock is held
+func (l *burstLimit) report(now time.Time) {
+	entry := zapcore.Entry{
+		Level:   zapcore.WarnLevel,
+		Time:    now,
+		Message: "Log entries dropped over LOG_MAX_PER_SECOND",
+	}
+	if l.core.Enabled(entry.Level) {
+		l.core.Write(entry, []zapcore.Field{
+			zap.Int("dropped", l.dropped),
+			zap.Int("max_per_second", l.max),
+			zap.Time("since", l.tick),
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces secrets found in log entries
+const Redacted = "[REDACTED]"
+
+// secretPattern matches a secret. Matches are replaced with the replacement
+// template, which can keep context around the secret, e.g. the "Bearer " of a header.
+type secretPattern struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// secretPatterns are the secrets masked in log entries
+var secretPatterns = []secretPattern{
+	// JWTs, and JWEs which have five parts
+	{re: regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*(?:\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*)?`), replacement: Redacted},
+	// Authorization header values
+	{re: regexp.MustCompile(`(?i)(\b(?:bearer|basic)\s+)[A-Za-z0-9._~+/=-]+`), replacement: "${1}" + Redacted},
+	// Passwords in DSNs and URLs, e.g. user:password@tcp(localhost:3306)/db
+	{re: regexp.MustCompile(`([A-Za-z0-9._%+-]+:)[^\s@/:"']+@`), replacement: "${1}" + Redacted + "@"},
+	// API keys with well-known prefixes
+	{re: regexp.MustCompile(`\b(?:sk|pk|rk)_(?:live|test)_[A-Za-z0-9]{16,}`), replacement: Redacted},
+	{re: regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`), replacement: Redacted},
+	{re: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}`), replacement: Redacted},
+	{re: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`), replacement: Redacted},
+	{re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`), replacement: Redacted},
+	// Assignments of secrets, e.g. api_key=... or "password": "..."
+	{re: regexp.MustCompile(`(?i)((?:api[_-]?key|client[_-]?secret|secret|passw(?:or)?d)["']?\s*[:=]\s*["']?)[^\s"'&,;]+`), replacement: "${1}" + Redacted},
+}
+
+// Scrub masks the known secret patterns in s
+func Scrub(s string) string {
+	for _, pattern := range secretPatterns {
+		s = pattern.re.ReplaceAllString(s, pattern.replacement)
+	}
+	return s
+}
+
+// scrubCore masks secrets in the message and fields of log entries before they
+// reach the wrapped core. It is a safety net for secrets that end up in messages,
+// errors or values by accident, not a replacement for leaving them out.
+type scrubCore struct {
+	zapcore.Core
+}
+
+// NewScrubCore wraps a core so that secrets are masked in everything it writes
+func NewScrubCore(core zapcore.Core) zapcore.Core {
+	return &scrubCore{Core: core}
+}
+
+// With adds scrubbed fields to the core
+func (c *scrubCore) With(fields []zapcore.Field) zapcore.Core {
+	return &scrubCore{Core: c.Core.With(scrubFields(fields))}
+}
+
+// Check adds this core to the checked entry if the wrapped core accepts it
+func (c *scrubCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write scrubs the entry and writes it to the wrapped core
+func (c *scrubCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = Scrub(entry.Message)
+	entry.Stack = Scrub(entry.Stack)
+	return c.Core.Write(entry, scrubFields(fields))
+}
+
+// scrubFields returns the fields with secrets masked in their values
+func scrubFields(fields []zapcore.Field) []zapcore.Field {
+	scrubbed := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		scrubbed[i] = scrubField(field)
+	}
+	return scrubbed
+}
+
+// scrubField masks secrets in a field. Numbers, booleans and times can't contain
+// secrets and are kept; values that are encoded as text are scrubbed as text.
+func scrubField(field zapcore.Field) zapcore.Field {
+	switch field.Type {
+	case zapcore.StringType:
+		field.String = Scrub(field.String)
+		return field
+	case zapcore.ByteStringType:
+		return zap.String(field.Key, Scrub(string(field.Interface.([]byte))))
+	case zapcore.ErrorType:
+		return zap.String(field.Key, Scrub(field.Interface.(error).Error()))
+	case zapcore.StringerType:
+		return zap.String(field.Key, Scrub(field.Interface.(fmt.Stringer).String()))
+	case zapcore.ReflectType:
+		return scrubJSON(field.Key, field.Interface)
+	case zapcore.ObjectMarshalerType:
+		enc := zapcore.NewMapObjectEncoder()
+		if err := field.Interface.(zapcore.ObjectMarshaler).MarshalLogObject(enc); err != nil {
+			return field
+		}
+		return scrubJSON(field.Key, enc.Fields)
+	case zapcore.ArrayMarshalerType:
+		enc := zapcore.NewMapObjectEncoder()
+		if err := enc.AddArray(field.Key, field.Interface.(zapcore.ArrayMarshaler)); err != nil {
+			return field
+		}
+		return scrubJSON(field.Key, enc.Fields[field.Key])
+	default:
+		return field
+	}
+}
+
+// scrubJSON encodes a value as JSON and scrubs the encoded form
+func scrubJSON(key string, value interface{}) zapcore.Field {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return zap.String(key, Scrub(fmt.Sprint(value)))
+	}
+
+	scrubbed := Scrub(string(encoded))
+	if !json.Valid([]byte(scrubbed)) {
+		return zap.String(key, scrubbed)
+	}
+	return zap.Reflect(key, json.RawMessage(scrubbed))
+}
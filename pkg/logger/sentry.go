@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/linkeunid/hello-go/pkg/sentry"
+)
+
+// SentryEventIDKey is the field of entries about an event already reported to
+// Sentry, e.g. a recovered panic, so the entry isn't reported again
+const SentryEventIDKey = "sentry_event_id"
+
+// sentryCore reports error and fatal entries to Sentry with the caller's stack
+type sentryCore struct {
+	zapcore.LevelEnabler
+	fields []zapcore.Field
+}
+
+// newSentryCore creates a core reporting the entries at or above level
+func newSentryCore(level zapcore.LevelEnabler) zapcore.Core {
+	return &sentryCore{LevelEnabler: level}
+}
+
+// With adds fields to the core
+func (c *sentryCore) With(fields []zapcore.Field) zapcore.Core {
+	return &sentryCore{
+		LevelEnabler: c.LevelEnabler,
+		fields:       append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+// Check adds the core to entries it's enabled for
+func (c *sentryCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write reports an entry, the error field is the message of the event. Fatal
+// entries are sent before returning, as the process exits next.
+func (c *sentryCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(enc)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	if _, reported := enc.Fields[SentryEventIDKey]; reported {
+		return nil
+	}
+
+	event := &sentry.Event{
+		Level:   sentry.LevelError,
+		Type:    entry.Message,
+		Message: entry.Message,
+		Logger:  entry.LoggerName,
+		Frames:  sentry.CallerStack("go.uber.org/zap", "github.com/linkeunid/hello-go/pkg/logger"),
+		Extra:   enc.Fields,
+	}
+	if entry.Level > zapcore.ErrorLevel {
+		event.Level = sentry.LevelFatal
+	}
+	if err, ok := enc.Fields["error"]; ok {
+		event.Message = fmt.Sprint(err)
+	}
+	if traceID, ok := enc.Fields["trace_id"].(string); ok {
+		event.TraceID = traceID
+	}
+	if userID, ok := enc.Fields["user_id"].(string); ok {
+		event.UserID = userID
+	}
+	sentry.Capture(event)
+
+	if entry.Level > zapcore.ErrorLevel {
+		return c.Sync()
+	}
+	return nil
+}
+
+// Sync sends the pending reports
+func (c *sentryCore) Sync() error {
+	return sentry.Flush()
+}
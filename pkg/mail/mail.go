@@ -0,0 +1,275 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/jobs"
+	"github.com/linkeunid/hello-go/pkg/notification"
+)
+
+// SendJobType is the job type sending a single email
+const SendJobType = "mail.send"
+
+// Delivery statuses
+const (
+	StatusQueued = "queued"
+	StatusSent   = "sent"
+	// StatusFailed means the last attempt failed, the queue may still retry it
+	StatusFailed = "failed"
+)
+
+// Common errors
+var (
+	ErrNotFound       = apperrors.NotFound("email message not found")
+	ErrNotEmail       = apperrors.Invalid("template is not an email template")
+	ErrUnknownDriver  = errors.New("unknown mail driver")
+	ErrInvalidAddress = apperrors.Invalid("invalid recipient address")
+)
+
+// Message records the delivery of an email so support can tell whether and
+// when it was sent. The body isn't kept, it may contain secrets like reset links.
+type Message struct {
+	ID        string `gorm:"type:varchar(36);primaryKey"`
+	UserID    string `gorm:"type:varchar(36);index"`
+	Recipient string `gorm:"type:varchar(255);index"`
+	Template  string `gorm:"type:varchar(100)"`
+	// Locale is the locale of the template the email was rendered from
+	Locale   string `gorm:"type:varchar(35)"`
+	Subject  string `gorm:"type:varchar(255)"`
+	Status   string `gorm:"type:varchar(20);index"`
+	Attempts int
+	// Error is the error of the last failed attempt
+	Error     string `gorm:"type:text"`
+	SentAt    *time.Time
+	CreatedAt time.Time `gorm:"index"`
+	UpdatedAt time.Time
+}
+
+// TableName specifies the table name for the Message model
+func (Message) TableName() string {
+	return "email_messages"
+}
+
+// Request is an email to send
+type Request struct {
+	// UserID is the recipient's user ID, if the recipient is a user
+	UserID string
+	To     string
+	// Template is the name of an email template, e.g. notification.EmailVerification
+	Template string
+	// Locales are the preferred locales, most preferred first: the recipient's
+	// stored locale, then the ones of the request, see RequestLocales
+	Locales []string
+	Data    map[string]interface{}
+}
+
+// MessageFilter narrows the listed messages, empty fields match everything
+type MessageFilter struct {
+	UserID    string
+	Recipient string
+	Status    string
+}
+
+// sendJob is the payload of a send job
+type sendJob struct {
+	MessageID string `json:"message_id"`
+	To        string `json:"to"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+}
+
+// Dispatcher sends transactional emails through the job queue
+type Dispatcher struct {
+	cfg       *config.Config
+	store     store
+	templates *notification.Templates
+	queue     *jobs.Queue
+	sender    sender
+	logger    *zap.Logger
+}
+
+// NewDispatcher creates a dispatcher recording messages in the email_messages
+// table and sending them with MAIL_DRIVER. It registers the send job handler on the queue.
+func NewDispatcher(cfg *config.Config, db *gorm.DB, templates *notification.Templates, queue *jobs.Queue, logger *zap.Logger) (*Dispatcher, error) {
+	var mailSender sender
+	switch cfg.Mail.Driver {
+	case "smtp":
+		mailSender = newSMTPSender(&cfg.Mail)
+	case "log":
+		mailSender = newLogSender(logger)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDriver, cfg.Mail.Driver)
+	}
+
+	if err := db.AutoMigrate(&Message{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate email messages table: %w", err)
+	}
+
+	return newDispatcher(cfg, newDBStore(db), templates, queue, mailSender, logger), nil
+}
+
+// NewMemoryDispatcher creates a dispatcher that keeps messages in memory and
+// only logs emails, for mock services
+func NewMemoryDispatcher(cfg *config.Config, templates *notification.Templates, queue *jobs.Queue, logger *zap.Logger) *Dispatcher {
+	return newDispatcher(cfg, newMemoryStore(), templates, queue, newLogSender(logger), logger)
+}
+
+func newDispatcher(cfg *config.Config, store store, templates *notification.Templates, queue *jobs.Queue, mailSender sender, logger *zap.Logger) *Dispatcher {
+	d := &Dispatcher{
+		cfg:       cfg,
+		store:     store,
+		templates: templates,
+		queue:     queue,
+		sender:    mailSender,
+		logger:    logger,
+	}
+	queue.Register(SendJobType, d.handle)
+	return d
+}
+
+// Send renders an email in the first of the request's locales with a
+// translation, falling back to MAIL_DEFAULT_LOCALE and then English, records
+// it and queues it for delivery
+func (d *Dispatcher) Send(ctx context.Context, req Request) (*Message, error) {
+	d.logger.Debug("Sending email",
+		zap.String("template", req.Template),
+		zap.String("user_id", req.UserID),
+		zap.Strings("locales", req.Locales))
+
+	if err := validateAddress(req.To); err != nil {
+		return nil, err
+	}
+
+	locales := append(append([]string{}, req.Locales...), d.cfg.Mail.DefaultLocale)
+	rendered, err := d.templates.Render(ctx, req.Template, locales, req.Data)
+	if err != nil {
+		return nil, err
+	}
+	if rendered.Channel != notification.ChannelEmail {
+		return nil, ErrNotEmail
+	}
+
+	message := &Message{
+		ID:        uuid.New().String(),
+		UserID:    req.UserID,
+		Recipient: req.To,
+		Template:  req.Template,
+		Locale:    rendered.Locale,
+		Subject:   rendered.Subject,
+		Status:    StatusQueued,
+	}
+	if err := d.store.create(ctx, message); err != nil {
+		d.logger.Error("Failed to record email message", zap.Error(err))
+		return nil, err
+	}
+
+	payload := sendJob{
+		MessageID: message.ID,
+		To:        req.To,
+		Subject:   rendered.Subject,
+		Body:      rendered.Body,
+	}
+	if _, err := d.queue.Enqueue(ctx, SendJobType, payload); err != nil {
+		d.finish(context.WithoutCancel(ctx), message.ID, StatusFailed, 0, err)
+		return nil, err
+	}
+
+	d.logger.Info("Email queued",
+		zap.String("message_id", message.ID),
+		zap.String("template", req.Template),
+		zap.String("locale", rendered.Locale),
+		zap.String("user_id", req.UserID))
+	return message, nil
+}
+
+// Messages returns a page of recorded messages, newest first, along with the total number of matches
+func (d *Dispatcher) Messages(ctx context.Context, filter MessageFilter, page, pageSize int) ([]*Message, int, error) {
+	// Validate page and pageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	return d.store.list(ctx, filter, page, pageSize)
+}
+
+// handle delivers an email, failures are retried by the queue
+func (d *Dispatcher) handle(ctx context.Context, job *jobs.Job) error {
+	var payload sendJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid email job payload: %w", err))
+	}
+
+	err := d.sender.send(ctx, d.cfg.Mail.From, payload.To, payload.Subject, payload.Body)
+	if err != nil {
+		d.finish(ctx, payload.MessageID, StatusFailed, job.Attempt, err)
+		return err
+	}
+
+	d.finish(ctx, payload.MessageID, StatusSent, job.Attempt, nil)
+	return nil
+}
+
+// finish records the outcome of a delivery attempt
+func (d *Dispatcher) finish(ctx context.Context, id, status string, attempts int, sendErr error) {
+	updates := map[string]interface{}{
+		"status":     status,
+		"attempts":   attempts,
+		"error":      "",
+		"updated_at": time.Now(),
+	}
+	if sendErr != nil {
+		updates["error"] = sendErr.Error()
+	}
+	if status == StatusSent {
+		updates["sent_at"] = time.Now()
+	}
+
+	if err := d.store.update(ctx, id, updates); err != nil {
+		d.logger.Error("Failed to record email delivery status",
+			zap.String("message_id", id),
+			zap.String("status", status),
+			zap.Error(err))
+	}
+}
+
+// RequestLocales returns the locales of the request's Accept-Language header,
+// most preferred first
+func RequestLocales(ctx context.Context) []string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	values := md.Get("grpcgateway-accept-language")
+	if len(values) == 0 {
+		values = md.Get("accept-language")
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	tags, _, err := language.ParseAcceptLanguage(values[0])
+	if err != nil {
+		return nil
+	}
+
+	locales := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		locales = append(locales, tag.String())
+	}
+	return locales
+}
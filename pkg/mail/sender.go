@@ -0,0 +1,105 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// sender delivers an HTML email
+type sender interface {
+	send(ctx context.Context, from, to, subject, body string) error
+}
+
+// smtpSender delivers emails to an SMTP server, with STARTTLS when the server offers it
+type smtpSender struct {
+	address string
+	auth    smtp.Auth
+}
+
+func newSMTPSender(cfg *config.MailConfig) *smtpSender {
+	s := &smtpSender{address: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort))}
+	if cfg.SMTPUsername != "" {
+		s.auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword.Reveal(), cfg.SMTPHost)
+	}
+	return s
+}
+
+func (s *smtpSender) send(ctx context.Context, from, to, subject, body string) error {
+	message, err := buildMessage(from, to, subject, body)
+	if err != nil {
+		return err
+	}
+
+	// smtp.SendMail doesn't take a context, run it so a cancelled job isn't blocked on it
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.address, s.auth, from, []string{to}, message)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// buildMessage formats a quoted-printable HTML message
+func buildMessage(from, to, subject, body string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	// Encoding the subject also keeps line breaks from injecting headers
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	writer := quotedprintable.NewWriter(&buf)
+	if _, err := writer.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// validateAddress checks that to is a plain email address
+func validateAddress(to string) error {
+	address, err := netmail.ParseAddress(to)
+	if err != nil || address.Address != to {
+		return ErrInvalidAddress
+	}
+	return nil
+}
+
+// logSender only logs emails, for development
+type logSender struct {
+	logger *zap.Logger
+}
+
+func newLogSender(logger *zap.Logger) *logSender {
+	return &logSender{logger: logger}
+}
+
+func (s *logSender) send(ctx context.Context, from, to, subject, body string) error {
+	s.logger.Info("Email sent to log",
+		zap.String("from", from),
+		zap.String("to", to),
+		zap.String("subject", subject))
+	return nil
+}
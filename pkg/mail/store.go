@@ -0,0 +1,124 @@
+package mail
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// store persists messages
+type store interface {
+	create(ctx context.Context, message *Message) error
+	update(ctx context.Context, id string, updates map[string]interface{}) error
+	list(ctx context.Context, filter MessageFilter, page, pageSize int) ([]*Message, int, error)
+}
+
+// dbStore keeps messages in the email_messages table
+type dbStore struct {
+	messages *database.Repository[Message]
+}
+
+// newDBStore creates a store on the email_messages table
+func newDBStore(db *gorm.DB) *dbStore {
+	return &dbStore{messages: database.NewRepository[Message](db, ErrNotFound)}
+}
+
+func (s *dbStore) create(ctx context.Context, message *Message) error {
+	return s.messages.Create(ctx, message)
+}
+
+func (s *dbStore) update(ctx context.Context, id string, updates map[string]interface{}) error {
+	return s.messages.Update(ctx, id, updates)
+}
+
+func (s *dbStore) list(ctx context.Context, filter MessageFilter, page, pageSize int) ([]*Message, int, error) {
+	scopes := []database.Scope{database.OrderBy("created_at DESC")}
+	if filter.UserID != "" {
+		scopes = append(scopes, database.Where("user_id = ?", filter.UserID))
+	}
+	if filter.Recipient != "" {
+		scopes = append(scopes, database.Where("recipient = ?", filter.Recipient))
+	}
+	if filter.Status != "" {
+		scopes = append(scopes, database.Where("status = ?", filter.Status))
+	}
+	return s.messages.List(ctx, page, pageSize, scopes...)
+}
+
+// memoryStore keeps messages in memory
+type memoryStore struct {
+	mu       sync.Mutex
+	messages map[string]*Message
+}
+
+// newMemoryStore creates an empty in-memory store
+func newMemoryStore() *memoryStore {
+	return &memoryStore{messages: make(map[string]*Message)}
+}
+
+func (s *memoryStore) create(ctx context.Context, message *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	message.CreatedAt = now
+	message.UpdatedAt = now
+	stored := *message
+	s.messages[message.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) update(ctx context.Context, id string, updates map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message, ok := s.messages[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	for column, value := range updates {
+		switch column {
+		case "status":
+			message.Status = value.(string)
+		case "attempts":
+			message.Attempts = value.(int)
+		case "error":
+			message.Error = value.(string)
+		case "sent_at":
+			sentAt := value.(time.Time)
+			message.SentAt = &sentAt
+		case "updated_at":
+			message.UpdatedAt = value.(time.Time)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) list(ctx context.Context, filter MessageFilter, page, pageSize int) ([]*Message, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matches []*Message
+	for _, message := range s.messages {
+		if (filter.UserID == "" || message.UserID == filter.UserID) &&
+			(filter.Recipient == "" || message.Recipient == filter.Recipient) &&
+			(filter.Status == "" || message.Status == filter.Status) {
+			copied := *message
+			matches = append(matches, &copied)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].CreatedAt.After(matches[j].CreatedAt)
+	})
+
+	start := min((page-1)*pageSize, len(matches))
+	end := min(start+pageSize, len(matches))
+	return matches[start:end], len(matches), nil
+}
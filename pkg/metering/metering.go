@@ -0,0 +1,328 @@
+package metering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/httpclient"
+)
+
+// PrincipalAnonymous is the principal of requests without credentials
+const PrincipalAnonymous = "anonymous"
+
+// maxKeyLength limits the principal and method of records to their column size
+const maxKeyLength = 191
+
+// Record is the usage of a method by a principal during an hour, stored in the
+// usage_records table. Flushes of every instance add up in the same record.
+type Record struct {
+	Hour      time.Time `gorm:"primaryKey" json:"hour"`
+	Service   string    `gorm:"primaryKey;type:varchar(20)" json:"service"`
+	Principal string    `gorm:"primaryKey;type:varchar(191);index" json:"principal"`
+	Method    string    `gorm:"primaryKey;type:varchar(191)" json:"method"`
+	Calls     int64     `gorm:"not null;default:0" json:"calls"`
+	// Errors counts the calls that failed with any status but OK
+	Errors        int64 `gorm:"not null;default:0" json:"errors"`
+	RequestBytes  int64 `gorm:"not null;default:0" json:"request_bytes"`
+	ResponseBytes int64 `gorm:"not null;default:0" json:"response_bytes"`
+	// LatencyMicros is the total latency of the calls, divide by Calls for the average
+	LatencyMicros    int64 `gorm:"not null;default:0" json:"latency_micros"`
+	MaxLatencyMicros int64 `gorm:"not null;default:0" json:"max_latency_micros"`
+}
+
+// TableName specifies the table name for the Record model
+func (Record) TableName() string {
+	return "usage_records"
+}
+
+// add adds the usage of other to the record
+func (r *Record) add(other *Record) {
+	r.Calls += other.Calls
+	r.Errors += other.Errors
+	r.RequestBytes += other.RequestBytes
+	r.ResponseBytes += other.ResponseBytes
+	r.LatencyMicros += other.LatencyMicros
+	if other.MaxLatencyMicros > r.MaxLatencyMicros {
+		r.MaxLatencyMicros = other.MaxLatencyMicros
+	}
+}
+
+// Call is a metered request
+type Call struct {
+	// Principal identifies the caller, e.g. "user:<id>", see middleware.MeteringInterceptor
+	Principal     string
+	Method        string
+	RequestBytes  int
+	ResponseBytes int
+	Latency       time.Duration
+	Failed        bool
+}
+
+// Query selects the usage to report. Empty fields match everything.
+type Query struct {
+	// Start and End bound the hours to report, Start is rounded down to the hour
+	// and End is exclusive. A zero End reports up to now.
+	Start     time.Time
+	End       time.Time
+	Service   string
+	Principal string
+	Method    string
+	// Limit is the maximum number of rows, the busiest ones are reported
+	Limit int
+}
+
+// Usage is the usage of a method by a principal over the hours of a query
+type Usage struct {
+	Service          string
+	Principal        string
+	Method           string
+	Calls            int64
+	Errors           int64
+	RequestBytes     int64
+	ResponseBytes    int64
+	LatencyMicros    int64
+	MaxLatencyMicros int64
+}
+
+// recordKey identifies the record of a call
+type recordKey struct {
+	hour      time.Time
+	principal string
+	method    string
+}
+
+// Meter aggregates the usage of a service per principal, method and hour in
+// memory and periodically adds it to the store, so requests don't write to the
+// database. Batches are optionally exported to METERING_EXPORT_URL as well.
+type Meter struct {
+	service   string
+	enabled   bool
+	store     store
+	exporter  *httpclient.Client
+	exportURL string
+	logger    *zap.Logger
+
+	mu      sync.Mutex
+	pending map[recordKey]*Record
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewMeter creates a meter storing usage in the usage_records table of db,
+// creating the table if needed. Usage is only recorded with METERING_ENABLED.
+func NewMeter(cfg *config.Config, db *gorm.DB, service string, logger *zap.Logger) (*Meter, error) {
+	if db == nil {
+		return nil, errors.New("usage metering needs a database connection")
+	}
+	if err := db.AutoMigrate(&Record{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate usage records table: %w", err)
+	}
+	return newMeter(cfg, newDBStore(db), service, logger), nil
+}
+
+// NewMemoryMeter creates a meter keeping usage in memory, for mock services
+func NewMemoryMeter(cfg *config.Config, service string, logger *zap.Logger) *Meter {
+	return newMeter(cfg, newMemoryStore(), service, logger)
+}
+
+// newMeter creates a meter on the given store and starts flushing it
+func newMeter(cfg *config.Config, store store, service string, logger *zap.Logger) *Meter {
+	m := &Meter{
+		service:   service,
+		enabled:   cfg.Metering.Enabled,
+		store:     store,
+		exportURL: cfg.Metering.ExportURL,
+		logger:    logger,
+		pending:   make(map[recordKey]*Record),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if m.exportURL != "" {
+		m.exporter = httpclient.New("metering_export", cfg, logger)
+	}
+
+	if !m.enabled {
+		close(m.done)
+		return m
+	}
+	go m.run(cfg.Metering.FlushInterval)
+	return m
+}
+
+// Add records a call, it does nothing unless metering is enabled
+func (m *Meter) Add(call Call) {
+	if !m.enabled {
+		return
+	}
+
+	key := recordKey{
+		hour:      time.Now().UTC().Truncate(time.Hour),
+		principal: truncate(call.Principal),
+		method:    truncate(call.Method),
+	}
+	if key.principal == "" {
+		key.principal = PrincipalAnonymous
+	}
+	latency := call.Latency.Microseconds()
+	usage := &Record{
+		Calls:            1,
+		RequestBytes:     int64(call.RequestBytes),
+		ResponseBytes:    int64(call.ResponseBytes),
+		LatencyMicros:    latency,
+		MaxLatencyMicros: latency,
+	}
+	if call.Failed {
+		usage.Errors = 1
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.merge(key, usage)
+}
+
+// merge adds usage to the pending record of key, the caller holds the lock
+func (m *Meter) merge(key recordKey, usage *Record) {
+	record, ok := m.pending[key]
+	if !ok {
+		record = &Record{Hour: key.hour, Service: m.service, Principal: key.principal, Method: key.method}
+		m.pending[key] = record
+	}
+	record.add(usage)
+}
+
+// Flush adds the pending usage to the store and exports it. Usage that couldn't
+// be stored is kept for the next flush.
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[recordKey]*Record)
+	m.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	records := make([]*Record, 0, len(pending))
+	for _, record := range pending {
+		records = append(records, record)
+	}
+
+	if err := m.store.add(ctx, records); err != nil {
+		m.mu.Lock()
+		for key, record := range pending {
+			m.merge(key, record)
+		}
+		m.mu.Unlock()
+		return fmt.Errorf("failed to store usage: %w", err)
+	}
+
+	m.logger.Debug("Flushed usage", zap.Int("records", len(records)))
+	if m.exporter != nil {
+		if err := m.export(ctx, records); err != nil {
+			// The usage is stored, the export isn't retried
+			m.logger.Error("Failed to export usage", zap.Int("records", len(records)), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// export posts a batch of records to METERING_EXPORT_URL. The batch ID is sent
+// as Idempotency-Key so the receiver can drop retried batches.
+func (m *Meter) export(ctx context.Context, records []*Record) error {
+	batchID := uuid.New().String()
+	body, err := json.Marshal(map[string]interface{}{
+		"batch_id": batchID,
+		"service":  m.service,
+		"records":  records,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.exportURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", batchID)
+
+	resp, err := m.exporter.Do(req)
+	if err != nil {
+		return err
+	}
+	return httpclient.DecodeJSON(resp, nil)
+}
+
+// Report returns the usage matching the query, busiest first. The usage of this
+// instance that hasn't been flushed yet is stored first.
+func (m *Meter) Report(ctx context.Context, query Query) ([]*Usage, error) {
+	if err := m.Flush(ctx); err != nil {
+		m.logger.Error("Failed to flush usage before reporting", zap.Error(err))
+	}
+
+	query.Start = query.Start.UTC().Truncate(time.Hour)
+	if query.End.IsZero() {
+		query.End = time.Now().Add(time.Hour)
+	}
+	return m.store.report(ctx, query)
+}
+
+// run flushes the pending usage every interval until Close is called
+func (m *Meter) run(interval time.Duration) {
+	defer close(m.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := m.Flush(ctx); err != nil {
+				m.logger.Error("Failed to flush usage", zap.Error(err))
+			}
+			cancel()
+		}
+	}
+}
+
+// Close stops the periodic flushes and flushes the remaining usage
+func (m *Meter) Close() error {
+	if !m.enabled {
+		return nil
+	}
+
+	select {
+	case <-m.stop:
+		return nil
+	default:
+		close(m.stop)
+	}
+	<-m.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return m.Flush(ctx)
+}
+
+// truncate shortens a principal or method to the column size
+func truncate(s string) string {
+	if len(s) > maxKeyLength {
+		return s[:maxKeyLength]
+	}
+	return s
+}
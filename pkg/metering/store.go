@@ -0,0 +1,148 @@
+package metering
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// store persists usage records
+type store interface {
+	// add adds the usage of the records to the stored records with the same key
+	add(ctx context.Context, records []*Record) error
+	report(ctx context.Context, query Query) ([]*Usage, error)
+}
+
+// dbStore keeps usage in the usage_records table
+type dbStore struct {
+	db *gorm.DB
+}
+
+// newDBStore creates a store on the usage_records table
+func newDBStore(db *gorm.DB) *dbStore {
+	return &dbStore{db: db}
+}
+
+func (s *dbStore) add(ctx context.Context, records []*Record) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, record := range records {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "hour"}, {Name: "service"}, {Name: "principal"}, {Name: "method"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"calls":              gorm.Expr("usage_records.calls + ?", record.Calls),
+					"errors":             gorm.Expr("usage_records.errors + ?", record.Errors),
+					"request_bytes":      gorm.Expr("usage_records.request_bytes + ?", record.RequestBytes),
+					"response_bytes":     gorm.Expr("usage_records.response_bytes + ?", record.ResponseBytes),
+					"latency_micros":     gorm.Expr("usage_records.latency_micros + ?", record.LatencyMicros),
+					"max_latency_micros": gorm.Expr("GREATEST(usage_records.max_latency_micros, ?)", record.MaxLatencyMicros),
+				}),
+			}).Create(record).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *dbStore) report(ctx context.Context, query Query) ([]*Usage, error) {
+	db := s.db.WithContext(ctx).Model(&Record{}).
+		Select("service, principal, method, SUM(calls) AS calls, SUM(errors) AS errors, "+
+			"SUM(request_bytes) AS request_bytes, SUM(response_bytes) AS response_bytes, "+
+			"SUM(latency_micros) AS latency_micros, MAX(max_latency_micros) AS max_latency_micros").
+		Where("hour >= ? AND hour < ?", query.Start, query.End)
+	if query.Service != "" {
+		db = db.Where("service = ?", query.Service)
+	}
+	if query.Principal != "" {
+		db = db.Where("principal = ?", query.Principal)
+	}
+	if query.Method != "" {
+		db = db.Where("method = ?", query.Method)
+	}
+
+	var usage []*Usage
+	err := db.Group("service, principal, method").
+		Order("calls DESC, service, principal, method").
+		Limit(query.Limit).
+		Scan(&usage).Error
+	return usage, err
+}
+
+// memoryStore keeps usage in memory, for mock services
+type memoryStore struct {
+	mu      sync.Mutex
+	records []*Record
+}
+
+// newMemoryStore creates an empty in-memory store
+func newMemoryStore() *memoryStore {
+	return &memoryStore{}
+}
+
+func (s *memoryStore) add(ctx context.Context, records []*Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		copied := *record
+		s.records = append(s.records, &copied)
+	}
+	return nil
+}
+
+func (s *memoryStore) report(ctx context.Context, query Query) ([]*Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type usageKey struct{ service, principal, method string }
+	totals := make(map[usageKey]*Usage)
+	for _, record := range s.records {
+		if record.Hour.Before(query.Start) || !record.Hour.Before(query.End) ||
+			(query.Service != "" && record.Service != query.Service) ||
+			(query.Principal != "" && record.Principal != query.Principal) ||
+			(query.Method != "" && record.Method != query.Method) {
+			continue
+		}
+
+		key := usageKey{record.Service, record.Principal, record.Method}
+		usage, ok := totals[key]
+		if !ok {
+			usage = &Usage{Service: record.Service, Principal: record.Principal, Method: record.Method}
+			totals[key] = usage
+		}
+		usage.Calls += record.Calls
+		usage.Errors += record.Errors
+		usage.RequestBytes += record.RequestBytes
+		usage.ResponseBytes += record.ResponseBytes
+		usage.LatencyMicros += record.LatencyMicros
+		if record.MaxLatencyMicros > usage.MaxLatencyMicros {
+			usage.MaxLatencyMicros = record.MaxLatencyMicros
+		}
+	}
+
+	result := make([]*Usage, 0, len(totals))
+	for _, usage := range totals {
+		result = append(result, usage)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		if a.Principal != b.Principal {
+			return a.Principal < b.Principal
+		}
+		return a.Method < b.Method
+	})
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[:query.Limit]
+	}
+	return result, nil
+}
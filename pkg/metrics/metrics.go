@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// collector is implemented by every metric type that can be exposed
+type collector interface {
+	// write writes the metric in the Prometheus text exposition format
+	write(sb *strings.Builder)
+}
+
+// Registry holds a set of named metrics
+type Registry struct {
+	mu         sync.RWMutex
+	names      map[string]bool
+	collectors []collector
+}
+
+// DefaultRegistry is the registry used by the package-level constructors
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates an empty metrics registry
+func NewRegistry() *Registry {
+	return &Registry{
+		names: make(map[string]bool),
+	}
+}
+
+// register adds a collector, panicking on duplicate names
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: duplicate metric name %q", name))
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// Handler returns an HTTP handler exposing the registry in Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var sb strings.Builder
+
+		r.mu.RLock()
+		for _, c := range r.collectors {
+			c.write(&sb)
+		}
+		r.mu.RUnlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(sb.String()))
+	})
+}
+
+// Handler returns an HTTP handler exposing the default registry
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
+
+// vec holds labelled float64 values shared by counters and gauges
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+	keys   map[string][]string
+}
+
+func newVec(name, help, kind string, labels []string) *vec {
+	return &vec{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		values: make(map[string]float64),
+		keys:   make(map[string][]string),
+	}
+}
+
+// key returns the series key for the given label values
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (v *vec) add(delta float64, labelValues []string) {
+	k := v.key(labelValues)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.values[k] += delta
+	v.keys[k] = labelValues
+}
+
+func (v *vec) set(value float64, labelValues []string) {
+	k := v.key(labelValues)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.values[k] = value
+	v.keys[k] = labelValues
+}
+
+func (v *vec) write(sb *strings.Builder) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(sb, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(sb, "# TYPE %s %s\n", v.name, v.kind)
+
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(sb, "%s%s %g\n", v.name, formatLabels(v.labels, v.keys[k]), v.values[k])
+	}
+}
+
+// formatLabels renders a Prometheus label set
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		pairs[i] = fmt.Sprintf("%s=%q", name, value)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a monotonically increasing counter partitioned by labels
+type CounterVec struct {
+	v *vec
+}
+
+// NewCounterVec creates and registers a counter in the default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{v: newVec(name, help, "counter", labels)}
+	DefaultRegistry.register(name, c.v)
+	return c
+}
+
+// Inc increments the counter by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.v.add(1, labelValues)
+}
+
+// Add increments the counter by the given non-negative value
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.add(delta, labelValues)
+}
+
+// GaugeVec is a value that can go up and down, partitioned by labels
+type GaugeVec struct {
+	v *vec
+}
+
+// NewGaugeVec creates and registers a gauge in the default registry
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{v: newVec(name, help, "gauge", labels)}
+	DefaultRegistry.register(name, g.v)
+	return g
+}
+
+// Set sets the gauge to the given value
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.v.set(value, labelValues)
+}
+
+// Add adds the given value (which may be negative) to the gauge
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.v.add(delta, labelValues)
+}
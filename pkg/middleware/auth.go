@@ -2,18 +2,28 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	// "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/metadata"
 
+	"github.com/linkeunid/hello-go/pkg/alerting"
 	"github.com/linkeunid/hello-go/pkg/config"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/jwe"
+	"github.com/linkeunid/hello-go/pkg/revocation"
+	"github.com/linkeunid/hello-go/pkg/signing"
 )
 
+// ErrInvalidToken is returned for tokens that can't be verified
+var ErrInvalidToken = apperrors.Unauthenticated("invalid token")
+
 // AuthTokenValidator defines the interface for auth token validation
 type AuthTokenValidator interface {
 	ValidateToken(ctx context.Context, token string) (bool, string, error)
@@ -60,54 +70,243 @@ func AuthMiddleware(validator AuthTokenValidator, logger *zap.Logger) func(http.
 // JWTValidator implements simple JWT validation without requiring auth client
 type JWTValidator struct {
 	JWTSecret string
-	Logger    *zap.Logger
+	// Keyfunc returns the keys verifying tokens, HMAC with JWTSecret when unset
+	Keyfunc jwt.Keyfunc
+	// EncryptionKey decrypts encrypted tokens (JWE), signed tokens are accepted either way
+	EncryptionKey string
+	// Revocations rejects logged out tokens when set
+	Revocations revocation.Store
+	// ValidAfter returns the time before which a user's tokens are rejected,
+	// zero if all of them are accepted. Tokens aren't checked against it when unset.
+	ValidAfter func(ctx context.Context, userID string) (time.Time, error)
+	Logger     *zap.Logger
 }
 
-// NewJWTValidator creates a new JWT validator
+// NewJWTValidator creates a new JWT validator. With JWKS_URL set it verifies
+// tokens with the auth service's published keys instead of the shared secret,
+// otherwise with JWT_SECRET and, during a rotation, JWT_PREVIOUS_SECRET.
 func NewJWTValidator(cfg *config.Config, logger *zap.Logger) *JWTValidator {
-	return &JWTValidator{
-		JWTSecret: cfg.Auth.JWTSecret,
-		Logger:    logger.Named("jwt_validator"),
+	v := &JWTValidator{
+		JWTSecret:     cfg.Auth.JWTSecret.Reveal(),
+		Keyfunc:       signing.SecretKeyfunc(cfg),
+		EncryptionKey: cfg.Auth.TokenEncryptionKey.Reveal(),
+		Logger:        logger.Named("jwt_validator"),
+	}
+	switch {
+	case cfg.Auth.JWKSURL != "":
+		v.Keyfunc = signing.NewRemoteKeySet(cfg.Auth.JWKSURL, cfg, logger.Named("jwks")).Keyfunc
+	case cfg.Auth.SigningAlgorithm != signing.HS256:
+		// Without JWKS_URL, RS256 and ES256 tokens are verified with the local
+		// JWT_SIGNING_KEY_FILE, which the configuration requires
+		keys, err := signing.NewKeySet(cfg, logger.Named("signing"))
+		if err != nil {
+			logger.Error("Failed to load the token signing keys, rejecting every token", zap.Error(err))
+			v.Keyfunc = func(*jwt.Token) (interface{}, error) { return nil, err }
+			break
+		}
+		v.Keyfunc = keys.Keyfunc
 	}
+	return v
 }
 
 // ValidateToken validates a JWT token
 func (v *JWTValidator) ValidateToken(ctx context.Context, tokenString string) (bool, string, error) {
-	if tokenString == "" {
+	claims, signed, ok := v.parse(tokenString)
+	if !ok {
+		alerting.Observe(config.AlertTokenValidationErrors, "")
 		return false, "", nil
 	}
 
-	// Parse token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	// Get user ID from claims
+	userID, ok := claims["sub"].(string)
+	if !ok {
+		return false, "", nil
+	}
+
+	if v.Revocations != nil {
+		revoked, err := v.Revocations.IsRevoked(ctx, revocation.TokenID(signed))
+		if err != nil {
+			return false, "", fmt.Errorf("failed to check token revocation: %w", err)
 		}
-		return []byte(v.JWTSecret), nil
-	})
+		if revoked {
+			v.Logger.Debug("Token was revoked", zap.String("user_id", userID))
+			return false, "", nil
+		}
+	}
 
-	if err != nil {
-		v.Logger.Debug("Token validation failed", zap.Error(err))
-		return false, "", nil
+	if v.ValidAfter != nil {
+		validAfter, err := v.ValidAfter(ctx, userID)
+		if err != nil {
+			return false, "", fmt.Errorf("failed to check token cutoff: %w", err)
+		}
+		if IssuedAt(claims).Before(validAfter) {
+			v.Logger.Debug("Token was issued before the user's sessions were invalidated", zap.String("user_id", userID))
+			return false, "", nil
+		}
 	}
 
-	if !token.Valid {
-		return false, "", nil
+	return true, userID, nil
+}
+
+// IssuedAt returns when a token was issued, with the millisecond precision the
+// auth service signs it with. Tokens without an "iat" claim count as issued at
+// the zero time, so any cutoff rejects them.
+func IssuedAt(claims jwt.MapClaims) time.Time {
+	// jwt.NumericDate would truncate the claim to seconds
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return time.Time{}
 	}
+	return time.UnixMilli(int64(iat*1000 + 0.5))
+}
 
-	// Extract claims
-	claims, ok := token.Claims.(jwt.MapClaims)
+// TokenExpiry returns the revocation ID of a valid token, see
+// revocation.TokenID, and when it expires, e.g. to cache its validation until then
+func (v *JWTValidator) TokenExpiry(tokenString string) (tokenID string, expiresAt time.Time, valid bool) {
+	claims, signed, ok := v.parse(tokenString)
 	if !ok {
-		return false, "", nil
+		return "", time.Time{}, false
 	}
+	expires, err := claims.GetExpirationTime()
+	if err != nil || expires == nil {
+		return "", time.Time{}, false
+	}
+	return revocation.TokenID(signed), expires.Time, true
+}
 
-	// Get user ID from claims
-	userID, ok := claims["sub"].(string)
+// Revoke revokes a valid token until it expires, so ValidateToken rejects it
+func (v *JWTValidator) Revoke(ctx context.Context, tokenString string) error {
+	if v.Revocations == nil {
+		return errors.New("token revocation store is not set")
+	}
+
+	claims, signed, ok := v.parse(tokenString)
 	if !ok {
-		return false, "", nil
+		return ErrInvalidToken
+	}
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return ErrInvalidToken
 	}
 
-	return true, userID, nil
+	return v.Revocations.Revoke(ctx, revocation.TokenID(signed), expiresAt.Time)
+}
+
+// TokenScopes returns the scopes of a verified token. restricted is false for
+// tokens without a "scope" claim, which may use every method, and valid is
+// false for tokens that can't be verified, see verifiedClaims.
+func (v *JWTValidator) TokenScopes(tokenString string) (scopes []string, restricted, valid bool) {
+	claims, ok := v.verifiedClaims(tokenString)
+	if !ok {
+		return nil, false, false
+	}
+
+	scope, ok := claims["scope"].(string)
+	if !ok {
+		return nil, false, true
+	}
+
+	return strings.Fields(scope), true, true
+}
+
+// TokenAuthTime returns when the user of a verified token entered their
+// credentials, zero for tokens without an "auth_time" claim. valid is false
+// for tokens that can't be verified, see verifiedClaims.
+func (v *JWTValidator) TokenAuthTime(tokenString string) (authTime time.Time, valid bool) {
+	claims, ok := v.verifiedClaims(tokenString)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	seconds, ok := claims["auth_time"].(float64)
+	if !ok {
+		return time.Time{}, true
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// TokenTenant returns the tenant of a verified token, the default tenant for
+// tokens without a TenantClaim, e.g. issued before tenancy was enabled. valid
+// is false for tokens that can't be verified, see verifiedClaims.
+func (v *JWTValidator) TokenTenant(tokenString string) (tenant string, valid bool) {
+	claims, ok := v.verifiedClaims(tokenString)
+	if !ok {
+		return "", false
+	}
+
+	tenant, ok = claims[TenantClaim].(string)
+	if !ok || tenant == "" {
+		return config.DefaultTenant, true
+	}
+	return tenant, true
+}
+
+// TokenPrincipal returns the principal of a valid token for usage metering:
+// "client:<client_id>" for service account tokens and "user:<id>" otherwise.
+// It returns an empty string for invalid tokens.
+func (v *JWTValidator) TokenPrincipal(tokenString string) string {
+	claims, _, ok := v.parse(tokenString)
+	if !ok {
+		return ""
+	}
+
+	if clientID, ok := claims["client_id"].(string); ok && clientID != "" {
+		return "client:" + clientID
+	}
+	if userID, ok := claims["sub"].(string); ok && userID != "" {
+		return "user:" + userID
+	}
+	return ""
+}
+
+// verifiedClaims returns the claims of a token whose signature verifies, also
+// when it expired: an expired token still tells the tenant, scopes and
+// authentication time it was issued with, and the handlers reject it. Tokens
+// that don't verify, e.g. signed with an unknown key, aren't trusted at all.
+func (v *JWTValidator) verifiedClaims(tokenString string) (jwt.MapClaims, bool) {
+	claims, _, ok := v.parse(tokenString, jwt.WithoutClaimsValidation())
+	return claims, ok
+}
+
+// parse verifies a JWT token and returns its claims and the signed token,
+// which encrypted tokens wrap
+func (v *JWTValidator) parse(tokenString string, opts ...jwt.ParserOption) (jwt.MapClaims, string, bool) {
+	if tokenString == "" {
+		return nil, "", false
+	}
+
+	// Decrypt encrypted tokens to the signed token they wrap
+	signed, err := jwe.Open(tokenString, v.EncryptionKey)
+	if err != nil {
+		v.Logger.Debug("Token decryption failed", zap.Error(err))
+		return nil, "", false
+	}
+
+	// Parse token
+	keyfunc := v.Keyfunc
+	if keyfunc == nil {
+		keyfunc = func(token *jwt.Token) (interface{}, error) {
+			// Validate signing method
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(v.JWTSecret), nil
+		}
+	}
+	token, err := jwt.Parse(signed, keyfunc, opts...)
+
+	if err != nil {
+		v.Logger.Debug("Token validation failed", zap.Error(err))
+		return nil, "", false
+	}
+
+	if !token.Valid {
+		return nil, "", false
+	}
+
+	// Extract claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	return claims, signed, ok
 }
 
 // ForwardAuthToken forwards the Authorization header from HTTP to gRPC metadata
@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// cfg is loaded once, before benchmarks print their results
+var cfg *config.Config
+
+func TestMain(m *testing.M) {
+	var err error
+	if cfg, err = config.LoadConfig(); err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// BenchmarkValidateToken measures validating a signed JWT
+func BenchmarkValidateToken(b *testing.B) {
+	validator := NewJWTValidator(cfg, zap.NewNop())
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "00000000-0000-0000-0000-000000000001",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(cfg.Auth.JWTSecret.Reveal()))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if valid, _, _ := validator.ValidateToken(ctx, token); !valid {
+			b.Fatal("token was rejected")
+		}
+	}
+}
+
+// signedToken returns a token with claims signed with secret, expiring in an hour
+// unless the claims say otherwise
+func signedToken(t testing.TB, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// incomingContext returns the context of a call with the given metadata pairs
+func incomingContext(pairs ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+}
+
+func TestTenantInterceptor(t *testing.T) {
+	tenancy := *cfg
+	tenancy.Tenancy.Enabled = true
+	secret := cfg.Auth.JWTSecret.Reveal()
+	interceptor := TenantInterceptor(NewJWTValidator(&tenancy, zap.NewNop()), &tenancy, zap.NewNop())
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		tenant string
+		code   codes.Code
+	}{
+		{"no token", incomingContext(), config.DefaultTenant, codes.OK},
+		{"header", incomingContext(tenantMetadataKey, "acme"), "acme", codes.OK},
+		{"token tenant", incomingContext("authorization", "Bearer "+signedToken(t, secret, jwt.MapClaims{"sub": "u", TenantClaim: "acme"})), "acme", codes.OK},
+		{"token without tenant", incomingContext("authorization", "Bearer "+signedToken(t, secret, jwt.MapClaims{"sub": "u"})), config.DefaultTenant, codes.OK},
+		{"expired token", incomingContext("authorization", "Bearer "+signedToken(t, secret, jwt.MapClaims{"sub": "u", TenantClaim: "acme", "exp": time.Now().Add(-time.Hour).Unix()})), "acme", codes.OK},
+		{"header of another tenant", incomingContext(tenantMetadataKey, "other", "authorization", "Bearer "+signedToken(t, secret, jwt.MapClaims{"sub": "u", TenantClaim: "acme"})), "", codes.PermissionDenied},
+		{"unverifiable token", incomingContext(tenantMetadataKey, "other", "authorization", "Bearer "+signedToken(t, "another secret", jwt.MapClaims{"sub": "u", TenantClaim: "acme"})), "", codes.Unauthenticated},
+		{"malformed token", incomingContext(tenantMetadataKey, "other", "authorization", "Bearer garbage"), "", codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant := ""
+			_, err := interceptor(tt.ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				tenant, _ = database.TenantFromContext(ctx)
+				return nil, nil
+			})
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (%v)", code, tt.code, err)
+			}
+			if tenant != tt.tenant {
+				t.Errorf("tenant = %q, want %q", tenant, tt.tenant)
+			}
+		})
+	}
+}
+
+func TestScopeInterceptor(t *testing.T) {
+	secret := cfg.Auth.JWTSecret.Reveal()
+	methodScopes := map[string]string{"/test/Read": ScopeUsersRead, "/test/Open": ""}
+	interceptor := ScopeInterceptor(NewJWTValidator(cfg, zap.NewNop()), methodScopes, zap.NewNop())
+	bearer := func(secret string, claims jwt.MapClaims) context.Context {
+		return incomingContext("authorization", "Bearer "+signedToken(t, secret, claims))
+	}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		method     string
+		code       codes.Code
+		restricted bool
+	}{
+		{"no token", incomingContext(), "/test/Read", codes.OK, false},
+		{"unrestricted token", bearer(secret, jwt.MapClaims{"sub": "u"}), "/test/Write", codes.OK, false},
+		{"scoped token", bearer(secret, jwt.MapClaims{"sub": "u", "scope": ScopeUsersRead}), "/test/Read", codes.OK, true},
+		{"implied scope", bearer(secret, jwt.MapClaims{"sub": "u", "scope": ScopeUsersAdmin}), "/test/Read", codes.OK, true},
+		{"missing scope", bearer(secret, jwt.MapClaims{"sub": "u", "scope": ScopeUsersWrite}), "/test/Read", codes.PermissionDenied, false},
+		{"unlisted method", bearer(secret, jwt.MapClaims{"sub": "u", "scope": ScopeUsersAdmin}), "/test/Write", codes.PermissionDenied, false},
+		{"unverifiable token", bearer("another secret", jwt.MapClaims{"sub": "u"}), "/test/Write", codes.Unauthenticated, false},
+		{"malformed token", incomingContext("authorization", "Bearer garbage"), "/test/Open", codes.Unauthenticated, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restricted := false
+			_, err := interceptor(tt.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				_, restricted = ScopesFromContext(ctx)
+				return nil, nil
+			})
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (%v)", code, tt.code, err)
+			}
+			if restricted != tt.restricted {
+				t.Errorf("restricted = %v, want %v", restricted, tt.restricted)
+			}
+		})
+	}
+}
+
+func TestScopesFromContextWithoutInterceptor(t *testing.T) {
+	ctx := incomingContext("authorization", "Bearer "+signedToken(t, cfg.Auth.JWTSecret.Reveal(), jwt.MapClaims{"sub": "u"}))
+	if scopes, restricted := ScopesFromContext(ctx); !restricted || len(scopes) != 0 {
+		t.Errorf("ScopesFromContext = %v, %v, want no scopes, restricted", scopes, restricted)
+	}
+	if HasScope(ctx, ScopeUsersRead) {
+		t.Error("unchecked token has the users.read scope")
+	}
+}
+
+func TestStepUpInterceptor(t *testing.T) {
+	secret := cfg.Auth.JWTSecret.Reveal()
+	methods := map[string]StepUpRule{"/test/Delete": nil}
+	interceptor := StepUpInterceptor(NewJWTValidator(cfg, zap.NewNop()), methods, 5*time.Minute, zap.NewNop())
+	bearer := func(secret string, claims jwt.MapClaims) context.Context {
+		return incomingContext("authorization", "Bearer "+signedToken(t, secret, claims))
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		code   codes.Code
+		reauth bool
+	}{
+		{"not sensitive", bearer("another secret", jwt.MapClaims{"sub": "u"}), "/test/Get", codes.OK, false},
+		{"no token", incomingContext(), "/test/Delete", codes.OK, false},
+		{"recent login", bearer(secret, jwt.MapClaims{"sub": "u", "auth_time": time.Now().Unix()}), "/test/Delete", codes.OK, false},
+		{"old login", bearer(secret, jwt.MapClaims{"sub": "u", "auth_time": time.Now().Add(-time.Hour).Unix()}), "/test/Delete", codes.Unauthenticated, true},
+		{"no auth_time", bearer(secret, jwt.MapClaims{"sub": "u"}), "/test/Delete", codes.Unauthenticated, true},
+		{"unverifiable token", bearer("another secret", jwt.MapClaims{"sub": "u", "auth_time": time.Now().Unix()}), "/test/Delete", codes.Unauthenticated, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := interceptor(tt.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, nil
+			})
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (%v)", code, tt.code, err)
+			}
+			if reauth := len(status.Convert(err).Details()) > 0; reauth != tt.reauth {
+				t.Errorf("reauth = %v, want %v", reauth, tt.reauth)
+			}
+		})
+	}
+}
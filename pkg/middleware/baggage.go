@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// baggageHeader is the W3C baggage header, see https://www.w3.org/TR/baggage/.
+// It's the same in HTTP headers and gRPC metadata.
+const baggageHeader = "baggage"
+
+// Baggage limits, values and headers above them are dropped
+const (
+	maxBaggageValue  = 256
+	maxBaggageHeader = 8192
+)
+
+// Baggage is the business context of a request, e.g. its tenant, client app
+// and experiment flags, by key
+type Baggage map[string]string
+
+// Fields returns the baggage as log fields, e.g. "baggage.tenant"
+func (b Baggage) Fields() []zap.Field {
+	fields := make([]zap.Field, 0, len(b))
+	for _, key := range b.keys() {
+		fields = append(fields, zap.String("baggage."+key, b[key]))
+	}
+	return fields
+}
+
+// String encodes the baggage as a W3C baggage header
+func (b Baggage) String() string {
+	entries := make([]string, 0, len(b))
+	for _, key := range b.keys() {
+		entries = append(entries, key+"="+url.PathEscape(b[key]))
+	}
+	return strings.Join(entries, ",")
+}
+
+// keys returns the keys of the baggage sorted
+func (b Baggage) keys() []string {
+	keys := make([]string, 0, len(b))
+	for key := range b {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// baggageKey is the context key of the request's baggage
+type baggageKey struct{}
+
+// BaggageFromContext returns the baggage of the request, set by
+// BaggageInterceptor, nil if the caller sent none
+func BaggageFromContext(ctx context.Context) Baggage {
+	baggage, _ := ctx.Value(baggageKey{}).(Baggage)
+	return baggage
+}
+
+// BaggageAnnotator forwards the W3C baggage header from HTTP to gRPC metadata
+func BaggageAnnotator(ctx context.Context, r *http.Request) metadata.MD {
+	if values := r.Header.Values(baggageHeader); len(values) > 0 {
+		return metadata.Pairs(baggageHeader, strings.Join(values, ","))
+	}
+	return nil
+}
+
+// BaggageInterceptor keeps the caller's baggage entries with a key of
+// TRACE_BAGGAGE_KEYS, see BaggageFromContext. Other entries are dropped from
+// the incoming metadata, so only the kept ones reach downstream calls and
+// can't be used to smuggle data through the services.
+func BaggageInterceptor(cfg *config.Config, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	allowed := make(map[string]bool, len(cfg.Tracing.BaggageKeys))
+	for _, key := range cfg.Tracing.BaggageKeys {
+		allowed[key] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(baggageHeader)
+		if len(values) == 0 {
+			return handler(ctx, req)
+		}
+
+		header := strings.Join(values, ",")
+		baggage := Baggage{}
+		if len(header) > maxBaggageHeader {
+			logger.Debug("Ignoring oversized baggage",
+				zap.String("grpc_method", info.FullMethod),
+				zap.Int("size", len(header)))
+		} else {
+			baggage = parseBaggage(header, allowed)
+		}
+
+		md = md.Copy()
+		if len(baggage) > 0 {
+			md.Set(baggageHeader, baggage.String())
+			ctx = context.WithValue(ctx, baggageKey{}, baggage)
+		} else {
+			md.Delete(baggageHeader)
+		}
+		return handler(metadata.NewIncomingContext(ctx, md), req)
+	}
+}
+
+// BaggageClientInterceptor forwards the baggage of the request being handled
+// to outbound calls
+func BaggageClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if baggage := BaggageFromContext(ctx); len(baggage) > 0 {
+			ctx = metadata.AppendToOutgoingContext(ctx, baggageHeader, baggage.String())
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// parseBaggage returns the allowed entries of a baggage header. Entry
+// properties are dropped, as are invalid and oversized entries.
+func parseBaggage(header string, allowed map[string]bool) Baggage {
+	baggage := Baggage{}
+	for _, entry := range strings.Split(header, ",") {
+		// key=value;property
+		entry, _, _ = strings.Cut(entry, ";")
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !allowed[key] {
+			continue
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil || value == "" || len(value) > maxBaggageValue {
+			continue
+		}
+		baggage[key] = value
+	}
+	return baggage
+}
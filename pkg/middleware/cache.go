@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// maxAgePattern extracts the max-age directive of a Cache-Control policy
+var maxAgePattern = regexp.MustCompile(`(?i)(?:^|,)\s*max-age\s*=\s*(\d+)`)
+
+// httpMethodKey is the context key of the HTTP method of a gateway request
+type httpMethodKey struct{}
+
+// CacheRouteMiddleware records the HTTP method of gateway requests so
+// CacheControlResponseOption can tell routes sharing a path apart
+func CacheRouteMiddleware(next runtime.HandlerFunc) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		ctx := context.WithValue(r.Context(), httpMethodKey{}, r.Method)
+		next(w, r.WithContext(ctx), pathParams)
+	}
+}
+
+// CacheControlResponseOption sets the Cache-Control header of successful gateway
+// responses to the policy configured for their route in CACHE_CONTROL_POLICIES,
+// or to CACHE_CONTROL_DEFAULT. Routes are the HTTP method and the path template
+// of the proto's http rule, e.g. "GET /api/v1/users/{id}". Policies with a
+// max-age also get an Expires header for HTTP/1.0 caches.
+//
+// Error responses never get a policy, so failures aren't cached.
+func CacheControlResponseOption(cfg *config.Config) func(context.Context, http.ResponseWriter, proto.Message) error {
+	policies := cfg.Cache.Policies
+	defaultPolicy := cfg.Cache.DefaultPolicy
+
+	return func(ctx context.Context, w http.ResponseWriter, _ proto.Message) error {
+		policy := defaultPolicy
+		method, _ := ctx.Value(httpMethodKey{}).(string)
+		if pattern, ok := runtime.HTTPPathPattern(ctx); ok && method != "" {
+			if routePolicy, ok := policies[method+" "+pattern]; ok {
+				policy = routePolicy
+			}
+		}
+		if policy == "" {
+			return nil
+		}
+
+		w.Header().Set("Cache-Control", policy)
+		if match := maxAgePattern.FindStringSubmatch(policy); match != nil {
+			if seconds, err := strconv.Atoi(match[1]); err == nil {
+				expires := time.Now().Add(time.Duration(seconds) * time.Second)
+				w.Header().Set("Expires", expires.UTC().Format(http.TimeFormat))
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/metering"
+	"github.com/linkeunid/hello-go/pkg/siem"
+)
+
+// Caller identities, besides SPIFFE IDs which are used as is
+const (
+	// CallerGateway is the service's own REST gateway
+	CallerGateway = "gateway"
+	// callerDNSPrefix prefixes DNS names of client certificates, e.g. "dns:batch.internal"
+	callerDNSPrefix = "dns:"
+	// callerAPIKeyPrefix prefixes the names of API keys, e.g. "apikey:ops"
+	callerAPIKeyPrefix = "apikey:"
+)
+
+// Metadata keys identifying callers
+const (
+	apiKeyHeader       = "x-api-key"
+	gatewayTokenHeader = "x-gateway-token"
+)
+
+// gatewayToken identifies requests from the gateway of this process. It is
+// random per process so it can't be forged through forwarded HTTP headers.
+var gatewayToken = newGatewayToken()
+
+// newGatewayToken generates the gateway token
+func newGatewayToken() string {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(raw)
+}
+
+// GatewayCallerCredentials identifies the REST gateway's requests as CallerGateway
+func GatewayCallerCredentials() grpc.DialOption {
+	return grpc.WithPerRPCCredentials(metadataCredentials{gatewayTokenHeader: gatewayToken})
+}
+
+// APIKeyCallerCredentials sends an API key with every request, for services
+// calling internal RPCs without mTLS
+func APIKeyCallerCredentials(key string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(metadataCredentials{apiKeyHeader: key})
+}
+
+// metadataCredentials adds fixed metadata to requests
+type metadataCredentials map[string]string
+
+// GetRequestMetadata returns the metadata
+func (c metadataCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return c, nil
+}
+
+// RequireTransportSecurity allows plaintext, the gateway talks to its own process
+func (c metadataCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// CallerIdentities returns the identities the caller proved: the SPIFFE ID and DNS
+// names of its client certificate, the name of its API key and CallerGateway
+// for requests from this process's gateway
+func CallerIdentities(ctx context.Context, apiKeys map[string]config.Secret) []string {
+	var identities []string
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			leaf := info.State.PeerCertificates[0]
+			for _, uri := range leaf.URIs {
+				if uri.Scheme == "spiffe" {
+					identities = append(identities, uri.String())
+				}
+			}
+			for _, name := range leaf.DNSNames {
+				identities = append(identities, callerDNSPrefix+name)
+			}
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get(gatewayTokenHeader) {
+		if subtle.ConstantTimeCompare([]byte(value), []byte(gatewayToken)) == 1 {
+			identities = append(identities, CallerGateway)
+			break
+		}
+	}
+	if values := md.Get(apiKeyHeader); len(values) > 0 {
+		// Check every key so the time taken doesn't reveal which one matched
+		var matched string
+		for name, key := range apiKeys {
+			if subtle.ConstantTimeCompare([]byte(values[0]), []byte(key.Reveal())) == 1 {
+				matched = name
+			}
+		}
+		if matched != "" {
+			identities = append(identities, callerAPIKeyPrefix+matched)
+		}
+	}
+
+	return identities
+}
+
+// CallerAllowlistInterceptor restricts methods to the caller identities listed
+// for them in CALLER_ALLOWLIST (see CallerIdentities). Methods can be listed by
+// full name or by a prefix ending in "*", the longest match applies. Methods
+// without a rule are open to every caller.
+//
+// Rejected calls are logged and emitted as security events.
+func CallerAllowlistInterceptor(cfg *config.Config, security siem.Emitter, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		allowed, ok := allowedCallers(cfg.Callers.Allowlist, info.FullMethod)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		identities := CallerIdentities(ctx, cfg.Callers.APIKeys)
+		for _, identity := range identities {
+			for _, candidate := range allowed {
+				if identity == candidate {
+					return handler(ctx, req)
+				}
+			}
+		}
+
+		logger.Warn("Permission denied: caller not in allowlist",
+			zap.String("grpc_method", info.FullMethod),
+			zap.Strings("caller_identities", identities))
+		security.Emit(ctx, siem.Event{
+			Category: siem.CategoryAuthorization,
+			Action:   "caller_allowlist",
+			Outcome:  siem.OutcomeFailure,
+			Severity: siem.SeverityHigh,
+			Reason:   "caller is not allowed to call this method",
+			Actor:    siem.Actor{Type: siem.ActorService, Name: strings.Join(identities, " ")},
+			Details:  map[string]string{"method": info.FullMethod},
+		})
+		return nil, status.Error(codes.PermissionDenied, "caller is not allowed to call this method")
+	}
+}
+
+// allowedCallers returns the identities allowed to call method, if it has a rule
+func allowedCallers(allowlist map[string][]string, method string) ([]string, bool) {
+	if allowed, ok := allowlist[method]; ok {
+		return allowed, true
+	}
+
+	// Longest wildcard prefix wins
+	var prefixes []string
+	for pattern := range allowlist {
+		if strings.HasSuffix(pattern, "*") && strings.HasPrefix(method, strings.TrimSuffix(pattern, "*")) {
+			prefixes = append(prefixes, pattern)
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil, false
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return allowlist[prefixes[0]], true
+}
+
+// requestPrincipal identifies the caller of a request for usage metering and
+// the flight recorder: the subject of the bearer token, else the first caller
+// identity other than the gateway, else metering.PrincipalAnonymous
+func requestPrincipal(ctx context.Context, validator *JWTValidator, cfg *config.Config) string {
+	if principal := validator.TokenPrincipal(bearerToken(ctx)); principal != "" {
+		return principal
+	}
+	for _, identity := range CallerIdentities(ctx, cfg.Callers.APIKeys) {
+		if identity != CallerGateway {
+			return identity
+		}
+	}
+	return metering.PrincipalAnonymous
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/linkeunid/hello-go/pkg/capture"
+)
+
+// CaptureInterceptor writes sampled calls to recorder, anonymized, so they can
+// be replayed against another build with cmd/replay. A nil recorder captures
+// nothing, see capture.NewRecorder.
+func CaptureInterceptor(recorder *capture.Recorder) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !recorder.Sampled(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		recorder.Capture(info.FullMethod, req, resp, err, time.Since(start))
+		return resp, err
+	}
+}
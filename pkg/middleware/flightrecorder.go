@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/flightrecorder"
+)
+
+// FlightRecorderInterceptor records a summary of every call in recorder: the
+// method, caller (see MeteringInterceptor), latency, status code and the trace
+// ID set by TraceInterceptor, which must run first.
+func FlightRecorderInterceptor(recorder *flightrecorder.Recorder, validator *JWTValidator, cfg *config.Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if recorder.Capacity() == 0 {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		trace, _ := TraceFromContext(ctx)
+		recorder.Record(flightrecorder.Entry{
+			Time:    start,
+			Method:  info.FullMethod,
+			Caller:  requestPrincipal(ctx, validator, cfg),
+			Latency: time.Since(start),
+			Code:    status.Code(err),
+			TraceID: trace.ID,
+		})
+		return resp, err
+	}
+}
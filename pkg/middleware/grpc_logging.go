@@ -8,19 +8,54 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+	"github.com/linkeunid/hello-go/pkg/logger"
 )
 
-// GrpcLoggingInterceptor is a gRPC interceptor for logging requests
-func GrpcLoggingInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
+// GrpcLoggingInterceptor is a gRPC interceptor for logging requests.
+//
+// Payloads are logged at debug level as selected by LOG_PAYLOADS: for every
+// request, for none, or only for sampled traces and requests with a valid debug
+// token (see TraceInterceptor, which must run first). Sampled payloads are
+// logged whatever the log level, so production keeps its level and log volume.
+func GrpcLoggingInterceptor(cfg *config.Config, log *zap.Logger) grpc.UnaryServerInterceptor {
+	payloadLogger := log
+	if cfg.Logging.Payloads == config.LogPayloadsSampled {
+		payloadLogger = log.Named(logger.PayloadLoggerName)
+	}
+
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		start := time.Now()
 
 		// Create a logger for this request
-		reqLogger := logger.With(
-			zap.String("grpc_method", info.FullMethod),
-		)
+		fields := []zap.Field{zap.String("grpc_method", info.FullMethod)}
+		trace, ok := TraceFromContext(ctx)
+		if ok {
+			fields = append(fields, zap.String("trace_id", trace.ID))
+		}
+		if region := OriginRegion(ctx); region != cfg.Region {
+			fields = append(fields, zap.String("origin_region", region))
+		}
+		if tenant, ok := database.TenantFromContext(ctx); ok {
+			fields = append(fields, zap.String("tenant_id", tenant))
+		}
+		fields = append(fields, BaggageFromContext(ctx).Fields()...)
+		reqLogger := log.With(fields...)
 
-		reqLogger.Debug("gRPC request received", zap.Any("request", req))
+		// Decide whether to log the payloads of this request
+		var payloads *zap.Logger
+		switch {
+		case cfg.Logging.Payloads == config.LogPayloadsAll:
+			payloads = reqLogger
+		case cfg.Logging.Payloads == config.LogPayloadsSampled && (trace.Sampled || trace.Debug):
+			payloads = payloadLogger.With(append(fields, zap.Bool("debug_token", trace.Debug))...)
+		}
+
+		if payloads != nil {
+			payloads.Debug("gRPC request received", zap.Any("request", req))
+		}
 
 		// Process the request
 		resp, err := handler(ctx, req)
@@ -52,7 +87,9 @@ func GrpcLoggingInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
 				zap.Duration("duration", duration),
 			)
 
-			reqLogger.Debug("gRPC response", zap.Any("response", resp))
+			if payloads != nil {
+				payloads.Debug("gRPC response", zap.Any("response", resp))
+			}
 		}
 
 		return resp, err
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/metering"
+)
+
+// MeteringInterceptor records the usage of every call in meter: the principal,
+// method, request and response sizes, latency and whether it failed. The
+// principal is the subject of the bearer token ("user:<id>" or
+// "client:<client_id>"), else the caller identity of internal callers such as
+// "apikey:ops", else metering.PrincipalAnonymous. Calls through the gateway are
+// attributed to the token they forward.
+func MeteringInterceptor(meter *metering.Meter, validator *JWTValidator, cfg *config.Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		meter.Add(metering.Call{
+			Principal:     requestPrincipal(ctx, validator, cfg),
+			Method:        info.FullMethod,
+			RequestBytes:  messageSize(req),
+			ResponseBytes: messageSize(resp),
+			Latency:       time.Since(start),
+			Failed:        err != nil,
+		})
+		return resp, err
+	}
+}
+
+// messageSize returns the encoded size of a message, 0 for anything else
+func messageSize(v interface{}) int {
+	if msg, ok := v.(proto.Message); ok && msg != nil {
+		return proto.Size(msg)
+	}
+	return 0
+}
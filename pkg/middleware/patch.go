@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Patch document media types
+const (
+	// JSONPatchContentType is an RFC 6902 JSON Patch, a list of operations
+	JSONPatchContentType = "application/json-patch+json"
+	// MergePatchContentType is an RFC 7386 JSON merge patch, a partial object
+	MergePatchContentType = "application/merge-patch+json"
+)
+
+// maxPatchSize limits the size of patch documents
+const maxPatchSize = 1 << 20
+
+// patchOperation is an operation of a JSON Patch
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// PatchHandler translates PATCH requests with a JSON Patch or JSON merge patch
+// body into the request message of the route, with an update_mask listing the
+// patched fields, e.g. [{"op":"replace","path":"/name","value":"Jane"}] becomes
+// {"name":"Jane","updateMask":"name"}. Removed fields are masked but left
+// unset, which clears them. Only the add, replace and remove operations are
+// supported, since test, move and copy need the current resource.
+//
+// Other requests, including PATCH requests with a plain JSON body and an
+// explicit update_mask, are passed to the gateway unchanged. Invalid patches
+// are answered with 400 in the gateway's error format.
+func PatchHandler(mux *runtime.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != JSONPatchContentType && mediaType != MergePatchContentType {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := translatePatch(mediaType, http.MaxBytesReader(w, r.Body, maxPatchSize))
+		if err != nil {
+			_, outbound := runtime.MarshalerForRequest(mux, r)
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, status.Error(codes.InvalidArgument, err.Error()))
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// translatePatch reads a patch document and returns the equivalent request body
+func translatePatch(mediaType string, r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch: %w", err)
+	}
+
+	message := map[string]interface{}{}
+	var paths []string
+	if mediaType == JSONPatchContentType {
+		paths, err = applyJSONPatch(message, data)
+	} else {
+		paths, err = applyMergePatch(message, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("patch doesn't change any field")
+	}
+
+	sort.Strings(paths)
+	message["updateMask"] = strings.Join(paths, ",")
+	return json.Marshal(message)
+}
+
+// applyJSONPatch sets the values of a JSON Patch in the message and returns the patched paths
+func applyJSONPatch(message map[string]interface{}, data []byte) ([]string, error) {
+	var operations []patchOperation
+	if err := json.Unmarshal(data, &operations); err != nil {
+		return nil, fmt.Errorf("invalid JSON Patch, expected a list of operations: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	for i, operation := range operations {
+		fields, err := parsePointer(operation.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path of operation %d: %v", i, err)
+		}
+
+		var value interface{}
+		switch operation.Op {
+		case "add", "replace":
+			if len(operation.Value) == 0 {
+				return nil, fmt.Errorf("operation %d needs a value", i)
+			}
+			if err := json.Unmarshal(operation.Value, &value); err != nil {
+				return nil, fmt.Errorf("invalid value of operation %d: %v", i, err)
+			}
+		case "remove":
+			// A masked field without a value is cleared
+		default:
+			return nil, fmt.Errorf("unsupported op %q of operation %d, expected add, replace or remove", operation.Op, i)
+		}
+
+		setPatchValue(message, fields, value)
+		path := maskPath(fields)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// applyMergePatch sets the values of a merge patch in the message and returns the patched paths
+func applyMergePatch(message map[string]interface{}, data []byte) ([]string, error) {
+	var patch map[string]interface{}
+	if err := json.Unmarshal(data, &patch); err != nil || patch == nil {
+		return nil, fmt.Errorf("invalid merge patch, expected a JSON object")
+	}
+
+	var paths []string
+	var walk func(prefix []string, patch map[string]interface{})
+	walk = func(prefix []string, patch map[string]interface{}) {
+		for name, value := range patch {
+			fields := append(append([]string(nil), prefix...), name)
+			// Objects are merged member by member, everything else replaces the field
+			if object, ok := value.(map[string]interface{}); ok && len(object) > 0 {
+				walk(fields, object)
+				continue
+			}
+			setPatchValue(message, fields, value)
+			paths = append(paths, maskPath(fields))
+		}
+	}
+	walk(nil, patch)
+	return paths, nil
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into unescaped field names
+func parsePointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") || len(pointer) == 1 {
+		return nil, fmt.Errorf("%q doesn't point to a field", pointer)
+	}
+
+	fields := strings.Split(pointer[1:], "/")
+	for i, field := range fields {
+		if field == "" {
+			return nil, fmt.Errorf("%q has an empty field name", pointer)
+		}
+		fields[i] = strings.ReplaceAll(strings.ReplaceAll(field, "~1", "/"), "~0", "~")
+	}
+	return fields, nil
+}
+
+// setPatchValue sets a nested field of the message, a nil value leaves the field unset
+func setPatchValue(message map[string]interface{}, fields []string, value interface{}) {
+	current := message
+	for _, field := range fields[:len(fields)-1] {
+		child, ok := current[field].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			current[field] = child
+		}
+		current = child
+	}
+
+	last := fields[len(fields)-1]
+	if value == nil {
+		delete(current, last)
+		return
+	}
+	current[last] = value
+}
+
+// maskPath returns the field mask path of nested fields in the lowerCamelCase
+// form of JSON field masks, e.g. ["account", "display_name"] -> "account.displayName"
+func maskPath(fields []string) string {
+	camel := make([]string, len(fields))
+	for i, field := range fields {
+		parts := strings.Split(field, "_")
+		for j := 1; j < len(parts); j++ {
+			if parts[j] != "" {
+				parts[j] = strings.ToUpper(parts[j][:1]) + parts[j][1:]
+			}
+		}
+		camel[i] = strings.Join(parts, "")
+	}
+	return strings.Join(camel, ".")
+}
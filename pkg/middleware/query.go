@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// StrictQueryParser binds gateway query parameters like the default parser but
+// rejects input the default parser would silently drop, so clients get a 400
+// instead of an unfiltered result:
+//   - parameters that aren't fields of the request, e.g. a misspelled "stauts"
+//   - several values for a field that isn't repeated
+//   - enum values that aren't names or numbers of the enum
+//
+// Enum values may also be given in lowercase without the enum's prefix, e.g.
+// "suspended" for USER_STATUS_SUSPENDED. Repeated fields take one parameter per
+// value, e.g. "tags=a&tags=b". Errors name the parameter and what it expects.
+type StrictQueryParser struct{}
+
+// Parse populates the query parameters into the request message
+func (StrictQueryParser) Parse(msg proto.Message, values url.Values, filter *utilities.DoubleArray) error {
+	// Report problems in a stable order
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		params := values[key]
+		field, path := lookupQueryField(msg.ProtoReflect().Descriptor(), key)
+		if field == nil {
+			return fmt.Errorf("unknown query parameter %q", key)
+		}
+		if filter.HasCommonPrefix(path) {
+			continue
+		}
+		if !field.IsList() && len(params) > 1 {
+			return fmt.Errorf("query parameter %q takes a single value", key)
+		}
+
+		if field.Kind() == protoreflect.EnumKind {
+			params = enumValueNames(field.Enum(), params)
+		}
+
+		if err := (&runtime.DefaultQueryParser{}).Parse(msg, url.Values{key: params}, filter); err != nil {
+			return fmt.Errorf("invalid query parameter %q, expected %s", key, queryExpectation(field))
+		}
+	}
+	return nil
+}
+
+// lookupQueryField returns the field of a dotted query parameter name, by proto
+// or JSON name, and its path of proto names. It returns nil for unknown fields.
+func lookupQueryField(desc protoreflect.MessageDescriptor, key string) (protoreflect.FieldDescriptor, []string) {
+	var field protoreflect.FieldDescriptor
+	var path []string
+	for i, name := range strings.Split(key, ".") {
+		if i > 0 {
+			// Only singular message fields have nested fields
+			if field.Message() == nil || field.IsList() || field.IsMap() {
+				return nil, nil
+			}
+			desc = field.Message()
+		}
+
+		field = desc.Fields().ByName(protoreflect.Name(name))
+		if field == nil {
+			field = desc.Fields().ByJSONName(name)
+		}
+		if field == nil {
+			return nil, nil
+		}
+		path = append(path, string(field.Name()))
+	}
+
+	// Maps are bound from "key[map_key]" parameters, which aren't supported
+	if field.IsMap() {
+		return nil, nil
+	}
+	return field, path
+}
+
+// enumValueNames converts enum values in short form, such as "suspended", to
+// their full names. Other values are kept for the default parser, which
+// accepts full names and numbers.
+func enumValueNames(enum protoreflect.EnumDescriptor, params []string) []string {
+	prefix := enumPrefix(enum)
+	names := make([]string, len(params))
+	for i, param := range params {
+		name := protoreflect.Name(param)
+		if enum.Values().ByName(name) == nil {
+			name = protoreflect.Name(prefix + strings.ToUpper(param))
+		}
+		if enum.Values().ByName(name) == nil {
+			names[i] = param
+			continue
+		}
+		names[i] = string(name)
+	}
+	return names
+}
+
+// enumPrefix returns the prefix of the enum's value names, e.g. "USER_STATUS_"
+// for USER_STATUS_UNSPECIFIED, or an empty string if the zero value isn't named
+// "<PREFIX>UNSPECIFIED"
+func enumPrefix(enum protoreflect.EnumDescriptor) string {
+	zero := enum.Values().ByNumber(0)
+	if zero == nil {
+		return ""
+	}
+	prefix, ok := strings.CutSuffix(string(zero.Name()), "UNSPECIFIED")
+	if !ok {
+		return ""
+	}
+	return prefix
+}
+
+// queryExpectation describes the values a field accepts for error messages
+func queryExpectation(field protoreflect.FieldDescriptor) string {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return "true or false"
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return "an integer"
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return "a non-negative integer"
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return "a number"
+	case protoreflect.BytesKind:
+		return "base64 data"
+	case protoreflect.EnumKind:
+		prefix := enumPrefix(field.Enum())
+		var names []string
+		values := field.Enum().Values()
+		for i := 0; i < values.Len(); i++ {
+			if values.Get(i).Number() != 0 {
+				names = append(names, strings.ToLower(strings.TrimPrefix(string(values.Get(i).Name()), prefix)))
+			}
+		}
+		return "one of " + strings.Join(names, ", ")
+	case protoreflect.MessageKind:
+		switch field.Message().FullName() {
+		case "google.protobuf.Timestamp":
+			return "an RFC 3339 time such as 2024-01-02T15:04:05Z"
+		case "google.protobuf.Duration":
+			return "a duration such as 1h30m"
+		case "google.protobuf.FieldMask":
+			return "comma-separated field paths"
+		}
+	}
+	return "a valid " + string(field.Name())
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Rate limit headers of REST responses, sent as lowercase gRPC metadata
+const (
+	// RateLimitLimitHeader is the number of requests allowed per window
+	RateLimitLimitHeader = "X-RateLimit-Limit"
+	// RateLimitRemainingHeader is the number of requests left in the current window
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	// RateLimitResetHeader is when the current window ends, in Unix seconds
+	RateLimitResetHeader = "X-RateLimit-Reset"
+)
+
+// rateLimitHeaders are passed through the gateway as is rather than as Grpc-Metadata-* headers
+var rateLimitHeaders = map[string]string{
+	strings.ToLower(RateLimitLimitHeader):     RateLimitLimitHeader,
+	strings.ToLower(RateLimitRemainingHeader): RateLimitRemainingHeader,
+	strings.ToLower(RateLimitResetHeader):     RateLimitResetHeader,
+}
+
+// RateLimit is the state of a caller's limit
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// SetRateLimitHeaders sends the state of the caller's limit with the response
+func SetRateLimitHeaders(ctx context.Context, limit RateLimit) {
+	grpc.SetHeader(ctx, metadata.Pairs(
+		strings.ToLower(RateLimitLimitHeader), strconv.Itoa(limit.Limit),
+		strings.ToLower(RateLimitRemainingHeader), strconv.Itoa(limit.Remaining),
+		strings.ToLower(RateLimitResetHeader), strconv.FormatInt(limit.Reset.Unix(), 10),
+	))
+}
+
+// RateLimitExceeded returns the error for a caller over its limit: ResourceExhausted
+// with a RetryInfo detail telling when to retry, along with the limit headers
+func RateLimitExceeded(ctx context.Context, limit RateLimit, message string) error {
+	limit.Remaining = 0
+	SetRateLimitHeaders(ctx, limit)
+
+	st := status.New(codes.ResourceExhausted, message)
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(retryAfter(limit.Reset)),
+	}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// ClientIP returns the IP address of the client of a call to rate limit it.
+// The gateway appends the address it received the request from to
+// X-Forwarded-For, so the client is the entry trustedProxies from the end:
+// entries before it can be set by the client. Calls without the header come
+// straight from the peer.
+func ClientIP(ctx context.Context, trustedProxies int) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var addresses []string
+	for _, value := range md.Get("x-forwarded-for") {
+		for _, address := range strings.Split(value, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	if len(addresses) > 0 {
+		index := len(addresses) - 1 - trustedProxies
+		if index < 0 {
+			index = 0
+		}
+		return addresses[index]
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		address := p.Addr.String()
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			return host
+		}
+		return address
+	}
+	return ""
+}
+
+// retryAfter returns the whole seconds until reset, at least one
+func retryAfter(reset time.Time) time.Duration {
+	seconds := math.Ceil(time.Until(reset).Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// RateLimitHeaderMatcher passes the rate limit metadata of gRPC responses to
+// REST clients as X-RateLimit-* headers, other metadata keeps the default
+// Grpc-Metadata- prefix
+func RateLimitHeaderMatcher(key string) (string, bool) {
+	if header, ok := rateLimitHeaders[strings.ToLower(key)]; ok {
+		return header, true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// rateLimitBody is the JSON body of 429 responses
+type rateLimitBody struct {
+	Code       codes.Code `json:"code"`
+	Message    string     `json:"message"`
+	RetryAfter int        `json:"retry_after"`
+	Limit      *int       `json:"limit,omitempty"`
+	Reset      *int64     `json:"reset,omitempty"`
+}
+
+// RateLimitErrorHandler answers ResourceExhausted errors with 429 Too Many
+// Requests, a Retry-After header and a JSON body telling when to retry, e.g.
+// {"code": 8, "message": "too many requests", "retry_after": 30, "limit": 100, "reset": 1767225600}.
+// Other errors are handled by the gateway's default handler.
+func RateLimitErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
+		return
+	}
+
+	body := rateLimitBody{Code: st.Code(), Message: st.Message()}
+
+	// The limit headers are sent as metadata, see SetRateLimitHeaders
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for key, header := range rateLimitHeaders {
+			if values := md.HeaderMD.Get(key); len(values) > 0 {
+				w.Header().Set(header, values[0])
+			}
+		}
+		if values := md.HeaderMD.Get(strings.ToLower(RateLimitLimitHeader)); len(values) > 0 {
+			if limit, err := strconv.Atoi(values[0]); err == nil {
+				body.Limit = &limit
+			}
+		}
+		if values := md.HeaderMD.Get(strings.ToLower(RateLimitResetHeader)); len(values) > 0 {
+			if reset, err := strconv.ParseInt(values[0], 10, 64); err == nil {
+				body.Reset = &reset
+				body.RetryAfter = int(retryAfter(time.Unix(reset, 0)).Seconds())
+			}
+		}
+	}
+
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.RetryDelay != nil {
+			body.RetryAfter = int(math.Ceil(info.RetryDelay.AsDuration().Seconds()))
+		}
+	}
+	if body.RetryAfter < 1 {
+		body.RetryAfter = 1
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(body.RetryAfter))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(body)
+}
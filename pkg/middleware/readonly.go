@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+	"github.com/linkeunid/hello-go/pkg/readonly"
+)
+
+// ReadOnlyInterceptor rejects mutations with FailedPrecondition while the
+// instance is in read-only mode, see readonly.Mode
+func ReadOnlyInterceptor(mode *readonly.Mode, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := mode.Check(info.FullMethod); err != nil {
+			logger.Info("Mutation rejected in read-only mode", zap.String("grpc_method", info.FullMethod))
+			return nil, apperrors.MapToStatus(err, "read-only mode")
+		}
+		return handler(ctx, req)
+	}
+}
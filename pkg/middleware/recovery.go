@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/logger"
+	"github.com/linkeunid/hello-go/pkg/metering"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+	"github.com/linkeunid/hello-go/pkg/sentry"
+)
+
+// recoveredPanics counts the panics of gRPC handlers by method
+var recoveredPanics = metrics.NewCounterVec("grpc_panics_recovered_total",
+	"Panics of gRPC handlers turned into Internal errors, by method", "method")
+
+// RecoveryInterceptor turns panics of handlers into Internal errors instead of
+// crashing the service. Panics are logged and reported to Sentry with the
+// stack, method, caller, user agent and the trace ID set by TraceInterceptor,
+// which must run first.
+func RecoveryInterceptor(validator *JWTValidator, cfg *config.Config, log *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			recoveredPanics.Inc(info.FullMethod)
+
+			trace, _ := TraceFromContext(ctx)
+			event := &sentry.Event{
+				Level:   sentry.LevelFatal,
+				Type:    fmt.Sprintf("%T", recovered),
+				Message: fmt.Sprint(recovered),
+				Logger:  "grpc",
+				Frames:  sentry.PanicStack(),
+				Tags:    map[string]string{"grpc.method": info.FullMethod},
+				Extra:   map[string]interface{}{"request_type": fmt.Sprintf("%T", req)},
+				TraceID: trace.ID,
+			}
+			if principal := requestPrincipal(ctx, validator, cfg); principal != metering.PrincipalAnonymous {
+				event.UserID = principal
+			}
+			if md, ok := metadata.FromIncomingContext(ctx); ok {
+				for _, key := range []string{"user-agent", "grpcgateway-user-agent"} {
+					if values := md.Get(key); len(values) > 0 {
+						event.Extra[key] = strings.Join(values, ", ")
+					}
+				}
+			}
+
+			fields := []zap.Field{
+				zap.String("method", info.FullMethod),
+				zap.Any("panic", recovered),
+				zap.String("trace_id", trace.ID),
+			}
+			if eventID := sentry.Capture(event); eventID != "" {
+				fields = append(fields, zap.String(logger.SentryEventIDKey, eventID))
+			}
+			log.Error("Recovered from panic in gRPC handler", fields...)
+
+			resp, err = nil, status.Error(codes.Internal, "internal error")
+		}()
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+// RegionHeader carries the region a request entered the deployment in, set by
+// the edge or by the first service instance handling it
+const RegionHeader = "X-Region"
+
+// regionMetadataKey carries the origin region in gRPC metadata
+const regionMetadataKey = "x-region"
+
+// Region metrics
+var (
+	regionInfo = metrics.NewGaugeVec("region_info",
+		"Region the process runs in, always 1", "region")
+	crossRegionRequests = metrics.NewCounterVec("cross_region_requests_total",
+		"Requests that entered the deployment in another region, by origin region", "origin_region")
+)
+
+// regionKey is the context key of the request's origin region
+type regionKey struct{}
+
+// OriginRegion returns the region the request entered the deployment in, set
+// by RegionInterceptor, empty for single-region deployments
+func OriginRegion(ctx context.Context) string {
+	region, _ := ctx.Value(regionKey{}).(string)
+	return region
+}
+
+// RegionAnnotator forwards the region header from HTTP to gRPC metadata
+func RegionAnnotator(ctx context.Context, r *http.Request) metadata.MD {
+	if region := r.Header.Get(RegionHeader); region != "" {
+		return metadata.Pairs(regionMetadataKey, region)
+	}
+	return nil
+}
+
+// RegionInterceptor determines the origin region of every call, see
+// OriginRegion. Calls keep the region of their metadata; calls without one
+// entered the deployment here and get the instance's REGION, as do calls with
+// an invalid region. Calls from other regions are logged and counted, they're
+// the traffic an active-active deployment tries to keep local.
+func RegionInterceptor(cfg *config.Config, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	if cfg.Region != "" {
+		regionInfo.Set(1, cfg.Region)
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		region := cfg.Region
+		if values := md.Get(regionMetadataKey); len(values) > 0 && config.ValidRegion(values[0]) {
+			region = values[0]
+		}
+
+		if region != cfg.Region && cfg.Region != "" {
+			crossRegionRequests.Inc(region)
+			logger.Debug("Request from another region",
+				zap.String("grpc_method", info.FullMethod),
+				zap.String("origin_region", region))
+		}
+
+		return handler(context.WithValue(ctx, regionKey{}, region), req)
+	}
+}
+
+// RegionClientInterceptor forwards the origin region of the request being
+// handled to outbound calls, so it's known end-to-end
+func RegionClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if region := OriginRegion(ctx); region != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, regionMetadataKey, region)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Scopes of the user service
+const (
+	// ScopeUsersRead allows reading users
+	ScopeUsersRead = "users.read"
+	// ScopeUsersWrite allows updating and deleting users
+	ScopeUsersWrite = "users.write"
+	// ScopeUsersAdmin allows acting on any user, like an admin, and implies read and write
+	ScopeUsersAdmin = "users.admin"
+)
+
+// impliedScopes lists the scopes granted along with a scope
+var impliedScopes = map[string][]string{
+	ScopeUsersAdmin: {ScopeUsersRead, ScopeUsersWrite},
+}
+
+// scopeAliases maps the colon spelling of the user service's scopes, common
+// in OAuth, to their names
+var scopeAliases = map[string]string{
+	"users:read":  ScopeUsersRead,
+	"users:write": ScopeUsersWrite,
+	"users:admin": ScopeUsersAdmin,
+}
+
+// CanonicalScopes returns requested scopes with aliases such as "users:read"
+// replaced by the scope's name, tokens only carry the names
+func CanonicalScopes(scopes []string) []string {
+	canonical := make([]string, len(scopes))
+	for i, scope := range scopes {
+		if name, ok := scopeAliases[scope]; ok {
+			scope = name
+		}
+		canonical[i] = scope
+	}
+	return canonical
+}
+
+// scopesKey is the context key of the tokenScopes of a request
+type scopesKey struct{}
+
+// tokenScopes are the scopes the ScopeInterceptor found on a request's token
+type tokenScopes struct {
+	scopes     []string
+	restricted bool
+}
+
+// ScopeInterceptor enforces the scopes of restricted tokens, i.e. tokens with a
+// "scope" claim such as service account tokens and tokens of logins that asked
+// for scopes. methodScopes maps full method names to the scope they require,
+// "" for none. Restricted tokens are denied methods missing from methodScopes,
+// so new methods are closed to them by default.
+//
+// Session tokens from logins without scopes aren't restricted, and requests
+// without a token are left to the handler's authentication. Tokens that can't
+// be verified, e.g. signed with an unknown key, are rejected: their scopes are
+// unknown, so they can't be treated as unrestricted.
+func ScopeInterceptor(validator *JWTValidator, methodScopes map[string]string, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		token := bearerToken(ctx)
+		if token == "" {
+			return handler(ctx, req)
+		}
+
+		scopes, restricted, valid := validator.TokenScopes(token)
+		if !valid {
+			logger.Warn("Unauthenticated: token can't be verified to check its scopes",
+				zap.String("grpc_method", info.FullMethod))
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		if !restricted {
+			return handler(context.WithValue(ctx, scopesKey{}, tokenScopes{}), req)
+		}
+
+		required, ok := methodScopes[info.FullMethod]
+		if !ok {
+			logger.Warn("Permission denied: method not available to scoped tokens",
+				zap.String("grpc_method", info.FullMethod),
+				zap.Strings("scopes", scopes))
+			return nil, status.Error(codes.PermissionDenied, "method is not available to scoped tokens")
+		}
+
+		ctx = context.WithValue(ctx, scopesKey{}, tokenScopes{scopes: scopes, restricted: true})
+		if required != "" && !HasScope(ctx, required) {
+			logger.Warn("Permission denied: missing scope",
+				zap.String("grpc_method", info.FullMethod),
+				zap.String("required", required),
+				zap.Strings("scopes", scopes))
+			return nil, status.Errorf(codes.PermissionDenied, "token lacks the %s scope", required)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// ScopesFromContext returns the scopes granted to the request's token. ok is
+// false for unrestricted tokens and requests without a token. Tokens the
+// ScopeInterceptor didn't check count as restricted to no scopes, so a missing
+// check can't grant more than the token has.
+func ScopesFromContext(ctx context.Context) (scopes []string, ok bool) {
+	checked, found := ctx.Value(scopesKey{}).(tokenScopes)
+	if !found {
+		return nil, bearerToken(ctx) != ""
+	}
+	return checked.scopes, checked.restricted
+}
+
+// HasScope reports whether the request may use scope, either directly, through a
+// scope implying it or because its token isn't restricted
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, restricted := ScopesFromContext(ctx)
+	if !restricted {
+		return true
+	}
+	return GrantsScope(scopes, scope)
+}
+
+// GrantsScope reports whether scopes contain scope or a scope implying it
+func GrantsScope(scopes []string, scope string) bool {
+	for _, granted := range scopes {
+		if granted == scope {
+			return true
+		}
+		for _, implied := range impliedScopes[granted] {
+			if implied == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token of the request's authorization metadata
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(values[0], "Bearer ")
+}
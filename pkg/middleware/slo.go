@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+)
+
+// SLO metrics, the same for every objective so dashboards and burn-rate alerts
+// are written once, e.g. the error ratio of an objective is
+// slo_requests_total{result="bad"} / slo_requests_total and its burn rate that
+// ratio divided by slo_error_budget
+var (
+	sloRequests = metrics.NewCounterVec("slo_requests_total",
+		"Requests measured by service level objectives, by objective, method and result (good or bad)",
+		"objective", "sli", "method", "result")
+	sloTarget = metrics.NewGaugeVec("slo_target",
+		"Share of good requests of service level objectives, e.g. 0.999", "objective", "sli")
+	sloErrorBudget = metrics.NewGaugeVec("slo_error_budget",
+		"Share of bad requests service level objectives allow, 1 - slo_target", "objective", "sli")
+	sloLatencyThreshold = metrics.NewGaugeVec("slo_latency_threshold_seconds",
+		"Duration requests of latency objectives must complete within to be good", "objective")
+)
+
+// SLOInterceptor counts the good and bad requests of every objective of
+// SLO_OBJECTIVES matching the method. Availability objectives count requests
+// failing with a server error as bad, while client errors, e.g. InvalidArgument
+// or NotFound, are good. Latency objectives count requests slower than their
+// threshold as bad. It must run before RecoveryInterceptor to count panics.
+func SLOInterceptor(cfg *config.Config, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	objectives := cfg.SLO.Objectives
+	for _, objective := range objectives {
+		sloTarget.Set(objective.Target, objective.Name, objective.SLI)
+		sloErrorBudget.Set(math.Round((1-objective.Target)*1e9)/1e9, objective.Name, objective.SLI)
+		if objective.SLI == config.SLILatency {
+			sloLatencyThreshold.Set(objective.Threshold.Seconds(), objective.Name)
+		}
+		logger.Debug("Measuring service level objective",
+			zap.String("objective", objective.Name),
+			zap.String("sli", objective.SLI),
+			zap.Strings("methods", objective.Methods),
+			zap.Float64("target", objective.Target))
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		duration := time.Since(start)
+
+		for _, objective := range objectives {
+			if !sloMatches(objective.Methods, info.FullMethod) {
+				continue
+			}
+
+			good := true
+			switch objective.SLI {
+			case config.SLIAvailability:
+				good = !serverError(status.Code(err))
+			case config.SLILatency:
+				good = duration <= objective.Threshold
+			}
+			result := "good"
+			if !good {
+				result = "bad"
+			}
+			sloRequests.Inc(objective.Name, objective.SLI, info.FullMethod, result)
+		}
+
+		return resp, err
+	}
+}
+
+// sloMatches reports whether an objective's methods include a method
+func sloMatches(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		switch {
+		case pattern == "*":
+			// Probes and tooling aren't the service's API
+			if !strings.HasPrefix(method, "/grpc.") {
+				return true
+			}
+		case strings.HasSuffix(pattern, "/*"):
+			if strings.HasPrefix(method, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		case pattern == method:
+			return true
+		}
+	}
+	return false
+}
+
+// serverError reports whether a code is the service's fault rather than the caller's
+func serverError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
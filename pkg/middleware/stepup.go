@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ReauthRequired is the ErrorInfo reason of errors asking the user to enter
+// their credentials again, after which the request can be retried
+const ReauthRequired = "REAUTH_REQUIRED"
+
+// errorDomain is the ErrorInfo domain of the services' errors
+const errorDomain = "hello-go"
+
+// StepUpRule reports whether a request to a method is sensitive. A nil rule
+// makes every request to the method sensitive.
+type StepUpRule func(req interface{}) bool
+
+// StepUpInterceptor requires a recent authentication for sensitive requests:
+// methods maps full method names to the rule telling which of their requests
+// are sensitive. Their token must have been issued for credentials entered at
+// most maxAge ago, its "auth_time" claim, otherwise the request fails with
+// Unauthenticated and a ReauthRequired ErrorInfo. Refreshing a token keeps its
+// auth_time, so only logging in again satisfies the check.
+//
+// A maxAge of 0 disables the check. Requests without a token are left to the
+// handler's authentication, tokens that can't be verified are rejected since
+// their auth_time is unknown.
+func StepUpInterceptor(validator *JWTValidator, methods map[string]StepUpRule, maxAge time.Duration, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		rule, sensitive := methods[info.FullMethod]
+		if maxAge <= 0 || !sensitive || (rule != nil && !rule(req)) {
+			return handler(ctx, req)
+		}
+
+		token := bearerToken(ctx)
+		if token == "" {
+			return handler(ctx, req)
+		}
+		authTime, valid := validator.TokenAuthTime(token)
+		if !valid {
+			logger.Warn("Unauthenticated: token can't be verified to check its auth_time",
+				zap.String("grpc_method", info.FullMethod))
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+
+		if authTime.IsZero() || time.Since(authTime) > maxAge {
+			logger.Info("Recent authentication required",
+				zap.String("grpc_method", info.FullMethod),
+				zap.Time("auth_time", authTime))
+			return nil, reauthRequired(maxAge)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// reauthRequired returns the error for requests whose authentication is older than maxAge
+func reauthRequired(maxAge time.Duration) error {
+	st := status.New(codes.Unauthenticated, "recent authentication required, log in again")
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: ReauthRequired,
+		Domain: errorDomain,
+		Metadata: map[string]string{
+			"max_age": strconv.Itoa(int(maxAge.Seconds())),
+		},
+	}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// TenantHeader names the tenant of requests without a token, e.g. logins and
+// registrations. Requests with a token are in the tenant of its TenantClaim.
+const TenantHeader = "X-Tenant-ID"
+
+// tenantMetadataKey carries the tenant in gRPC metadata
+const tenantMetadataKey = "x-tenant-id"
+
+// TenantClaim is the JWT claim holding the tenant of the token's user
+const TenantClaim = "tid"
+
+// TenantAnnotator forwards the tenant header from HTTP to gRPC metadata
+func TenantAnnotator(ctx context.Context, r *http.Request) metadata.MD {
+	if tenant := r.Header.Get(TenantHeader); tenant != "" {
+		return metadata.Pairs(tenantMetadataKey, tenant)
+	}
+	return nil
+}
+
+// TenantInterceptor determines the tenant of every call while TENANCY_ENABLED
+// is set, and scopes the call's repository queries to it, see
+// database.WithTenant. Calls with a valid token are in the token's tenant,
+// tokens without a tenant claim are in the default one. Calls without a token
+// are in the tenant of their metadata, or the default one without any. Tokens
+// naming another tenant than the metadata are rejected, so a client configured
+// for one tenant can't act in another, and so are tokens the validator can't
+// verify, whose tenant is unknown.
+func TenantInterceptor(validator *JWTValidator, cfg *config.Config, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !cfg.Tenancy.Enabled {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		requested := ""
+		if values := md.Get(tenantMetadataKey); len(values) > 0 {
+			requested = values[0]
+			if !config.ValidTenant(requested) {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s header", TenantHeader)
+			}
+		}
+
+		tenant := requested
+		if token := bearerToken(ctx); token != "" {
+			tokenTenant, valid := validator.TokenTenant(token)
+			if !valid {
+				logger.Warn("Unauthenticated: token can't be verified to determine its tenant",
+					zap.String("grpc_method", info.FullMethod))
+				return nil, status.Error(codes.Unauthenticated, "invalid token")
+			}
+			if requested != "" && requested != tokenTenant {
+				logger.Warn("Permission denied: token of another tenant",
+					zap.String("grpc_method", info.FullMethod),
+					zap.String("tenant_id", tokenTenant),
+					zap.String("requested_tenant_id", requested))
+				return nil, status.Error(codes.PermissionDenied, "token belongs to another tenant")
+			}
+			tenant = tokenTenant
+		}
+		if tenant == "" {
+			tenant = config.DefaultTenant
+		}
+
+		return handler(database.WithTenant(ctx, tenant), req)
+	}
+}
+
+// TenantClientInterceptor forwards the tenant of the request being handled to
+// outbound calls
+func TenantClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if tenant, ok := database.TenantFromContext(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, tenantMetadataKey, tenant)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// TimezoneHeader is the HTTP header REST clients use to request localized timestamps
+	TimezoneHeader = "X-Timezone"
+	// TimezoneMetadataKey carries the requested or resolved timezone in gRPC metadata
+	TimezoneMetadataKey = "x-timezone"
+	// TimezoneUser asks for the authenticated user's stored timezone
+	TimezoneUser = "user"
+)
+
+// TimezoneAnnotator forwards the X-Timezone header from HTTP to gRPC metadata
+func TimezoneAnnotator(ctx context.Context, r *http.Request) metadata.MD {
+	md := make(metadata.MD)
+	if tz := r.Header.Get(TimezoneHeader); tz != "" {
+		md.Set(TimezoneMetadataKey, tz)
+	}
+	return md
+}
+
+// RequestedTimezone returns the timezone requested by the REST client, if any
+func RequestedTimezone(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(TimezoneMetadataKey); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// TimezoneResponseRewriter renders the timestamps of gateway responses in the requested timezone.
+//
+// gRPC responses always carry UTC timestamps. A timezone resolved by the server
+// (for X-Timezone: user) takes precedence over the one sent by the client.
+func TimezoneResponseRewriter(ctx context.Context, response proto.Message) (any, error) {
+	tz := ""
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		if values := md.HeaderMD.Get(TimezoneMetadataKey); len(values) > 0 {
+			tz = values[0]
+		}
+	}
+	if tz == "" {
+		if md, ok := metadata.FromOutgoingContext(ctx); ok {
+			if values := md.Get(TimezoneMetadataKey); len(values) > 0 {
+				tz = values[0]
+			}
+		}
+	}
+
+	if tz == "" || tz == TimezoneUser {
+		return response, nil
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		// Unknown zones fall back to UTC rather than failing the request
+		return response, nil
+	}
+
+	localizeTimestamps(response.ProtoReflect(), loc)
+	return response, nil
+}
+
+// localizeTimestamps converts every RFC 3339 string field ending in "_at" to the given location
+func localizeTimestamps(m protoreflect.Message, loc *time.Location) {
+	updates := make(map[protoreflect.FieldDescriptor]protoreflect.Value)
+
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList() && fd.Kind() == protoreflect.MessageKind:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				localizeTimestamps(list.Get(i).Message(), loc)
+			}
+		case fd.IsMap():
+			// Maps don't carry timestamps in our APIs
+		case fd.Kind() == protoreflect.MessageKind:
+			localizeTimestamps(v.Message(), loc)
+		case fd.Kind() == protoreflect.StringKind && !fd.IsList() && strings.HasSuffix(string(fd.Name()), "_at"):
+			if t, err := time.Parse(time.RFC3339, v.String()); err == nil {
+				updates[fd] = protoreflect.ValueOfString(t.In(loc).Format(time.RFC3339))
+			}
+		}
+		return true
+	})
+
+	for fd, v := range updates {
+		m.Set(fd, v)
+	}
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/debugtoken"
+)
+
+// W3C trace context headers, see https://www.w3.org/TR/trace-context/
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+)
+
+// DebugTokenHeader carries a debug token signed with LOG_DEBUG_KEY, which enables
+// payload logging for the request, see cmd/debugtoken
+const DebugTokenHeader = "X-Debug-Token"
+
+// debugTokenMetadataKey carries the debug token in gRPC metadata
+const debugTokenMetadataKey = "x-debug-token"
+
+// Trace is the trace context of a request
+type Trace struct {
+	// ID is the W3C trace ID
+	ID string
+	// Sampled is the sampled flag of the trace
+	Sampled bool
+	// Debug is set for requests with a valid debug token
+	Debug bool
+}
+
+// traceKey is the context key of the request's trace
+type traceKey struct{}
+
+// TraceFromContext returns the trace of the request, set by TraceInterceptor
+func TraceFromContext(ctx context.Context) (Trace, bool) {
+	trace, ok := ctx.Value(traceKey{}).(Trace)
+	return trace, ok
+}
+
+// TraceAnnotator forwards the W3C trace context and debug token headers from
+// HTTP to gRPC metadata, so requests through the gateway keep the caller's trace
+func TraceAnnotator(ctx context.Context, r *http.Request) metadata.MD {
+	md := make(metadata.MD)
+	if traceparent := r.Header.Get(traceparentHeader); traceparent != "" {
+		md.Set(traceparentHeader, traceparent)
+	}
+	if tracestate := r.Header.Get(tracestateHeader); tracestate != "" {
+		md.Set(tracestateHeader, tracestate)
+	}
+	if token := r.Header.Get(DebugTokenHeader); token != "" {
+		md.Set(debugTokenMetadataKey, token)
+	}
+	return md
+}
+
+// TraceInterceptor determines the trace of every call, see TraceFromContext.
+// Calls continue the trace of their traceparent metadata, keeping the caller's
+// sampling decision. Calls without one start a new trace, sampled with
+// TRACE_SAMPLE_RATIO, which is added to the incoming metadata so outbound calls
+// continue it. Calls with a valid debug token are sampled.
+func TraceInterceptor(cfg *config.Config, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		trace, ok := parseTraceparent(md.Get(traceparentHeader))
+
+		if values := md.Get(debugTokenMetadataKey); len(values) > 0 {
+			if err := debugtoken.Verify(cfg.Logging.DebugKey.Reveal(), values[0], time.Now()); err != nil {
+				logger.Warn("Ignoring invalid debug token",
+					zap.String("grpc_method", info.FullMethod),
+					zap.Error(err))
+			} else {
+				trace.Debug = true
+			}
+		}
+
+		// Start a new trace, or sample the caller's for debug requests
+		rewrite := !ok
+		if !ok {
+			trace.ID = randomHex(16)
+			trace.Sampled = mathrand.Float64() < cfg.Tracing.SampleRatio
+		}
+		if trace.Debug && !trace.Sampled {
+			trace.Sampled = true
+			rewrite = true
+		}
+		if rewrite {
+			flags := "00"
+			if trace.Sampled {
+				flags = "01"
+			}
+			md = md.Copy()
+			md.Set(traceparentHeader, "00-"+trace.ID+"-"+randomHex(8)+"-"+flags)
+			ctx = metadata.NewIncomingContext(ctx, md)
+		}
+
+		return handler(context.WithValue(ctx, traceKey{}, trace), req)
+	}
+}
+
+// parseTraceparent returns the trace of a traceparent header, ok is false if
+// it is missing or invalid
+func parseTraceparent(values []string) (trace Trace, ok bool) {
+	if len(values) == 0 {
+		return Trace{}, false
+	}
+
+	// version-traceid-parentid-flags
+	parts := strings.Split(values[0], "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[3]) != 2 {
+		return Trace{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return Trace{}, false
+	}
+	return Trace{ID: parts[1], Sampled: flags[0]&0x01 != 0}, true
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
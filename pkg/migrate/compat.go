@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Severity classifies a compatibility issue
+type Severity string
+
+const (
+	// SeverityError means the binary will fail against the live schema
+	SeverityError Severity = "error"
+	// SeverityWarning means the binary works but the schema drifted
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a mismatch between a model and the live schema
+type Issue struct {
+	Severity Severity
+	Table    string
+	Column   string
+	Message  string
+}
+
+// CompatibilityReport lists the mismatches found by CheckCompatibility
+type CompatibilityReport struct {
+	Issues []Issue
+}
+
+// Compatible reports whether no blocking issue was found
+func (r *CompatibilityReport) Compatible() bool {
+	for _, issue := range r.Issues {
+		if issue.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *CompatibilityReport) add(severity Severity, table, column, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{
+		Severity: severity,
+		Table:    table,
+		Column:   column,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// CheckCompatibility compares the columns the models expect with the live schema.
+//
+// It reports an error when a model column is missing (the expand migration
+// has not run yet) or when the table has a NOT NULL column without a
+// default that the model doesn't know about (inserts would fail).
+func CheckCompatibility(db *gorm.DB, models ...interface{}) (*CompatibilityReport, error) {
+	report := &CompatibilityReport{}
+	cache := &sync.Map{}
+
+	for _, model := range models {
+		s, err := schema.Parse(model, cache, db.NamingStrategy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+
+		if !db.Migrator().HasTable(s.Table) {
+			report.add(SeverityError, s.Table, "", "table does not exist")
+			continue
+		}
+
+		columnTypes, err := db.Migrator().ColumnTypes(s.Table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read columns of table %s: %w", s.Table, err)
+		}
+
+		live := make(map[string]gorm.ColumnType, len(columnTypes))
+		for _, column := range columnTypes {
+			live[column.Name()] = column
+		}
+
+		expected := make(map[string]bool)
+		for _, field := range s.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			expected[field.DBName] = true
+
+			column, ok := live[field.DBName]
+			if !ok {
+				report.add(SeverityError, s.Table, field.DBName, "column expected by model %s is missing", s.Name)
+				continue
+			}
+
+			if nullable, ok := column.Nullable(); ok && nullable && field.NotNull {
+				report.add(SeverityWarning, s.Table, field.DBName, "column is nullable but the model declares NOT NULL")
+			}
+		}
+
+		for name, column := range live {
+			if expected[name] {
+				continue
+			}
+
+			nullable, _ := column.Nullable()
+			_, hasDefault := column.DefaultValue()
+			if autoIncrement, ok := column.AutoIncrement(); ok && autoIncrement {
+				hasDefault = true
+			}
+
+			if !nullable && !hasDefault {
+				report.add(SeverityError, s.Table, name,
+					"NOT NULL column without default is unknown to model %s, inserts will fail", s.Name)
+			} else {
+				report.add(SeverityWarning, s.Table, name, "column is not used by model %s", s.Name)
+			}
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// CheckIndexes compares the indexes queries rely on with the live schema,
+// issues name the index in place of a column.
+//
+// It reports a warning when an index is missing or covers other columns than
+// expected: queries still work but may scan whole tables.
+func CheckIndexes(db *gorm.DB, indexes ...AddIndex) (*CompatibilityReport, error) {
+	report := &CompatibilityReport{}
+	live := make(map[string]map[string]gorm.Index)
+
+	for _, index := range indexes {
+		tableIndexes, ok := live[index.Table]
+		if !ok {
+			tableIndexes = make(map[string]gorm.Index)
+			if db.Migrator().HasTable(index.Table) {
+				found, err := db.Migrator().GetIndexes(index.Table)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read indexes of table %s: %w", index.Table, err)
+				}
+				for _, idx := range found {
+					tableIndexes[idx.Name()] = idx
+				}
+			}
+			live[index.Table] = tableIndexes
+		}
+
+		idx, ok := tableIndexes[index.Name]
+		if !ok {
+			report.add(SeverityWarning, index.Table, index.Name, "index on (%s) is missing",
+				strings.Join(index.Columns, ", "))
+			continue
+		}
+
+		if columns := idx.Columns(); strings.Join(columns, ",") != strings.Join(index.Columns, ",") {
+			report.add(SeverityWarning, index.Table, index.Name, "index is on (%s), expected (%s)",
+				strings.Join(columns, ", "), strings.Join(index.Columns, ", "))
+		}
+		if unique, ok := idx.Unique(); ok && index.Unique && !unique {
+			report.add(SeverityWarning, index.Table, index.Name, "index is not unique")
+		}
+	}
+
+	return report, nil
+}
+
+// VerifyIndexes logs a warning for every expected index missing from the live
+// schema, services start anyway
+func VerifyIndexes(db *gorm.DB, logger *zap.Logger, indexes ...AddIndex) {
+	report, err := CheckIndexes(db, indexes...)
+	if err != nil {
+		logger.Warn("Failed to verify database indexes", zap.Error(err))
+		return
+	}
+
+	for _, issue := range report.Issues {
+		logger.Warn("Database index mismatch, run the migrations",
+			zap.String("table", issue.Table),
+			zap.String("index", issue.Column),
+			zap.String("issue", issue.Message))
+	}
+}
@@ -0,0 +1,151 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Phase is the deployment phase a migration belongs to.
+//
+// Blue/green deploys run two binary versions against the same schema, so
+// every change is split in two: expand migrations run before the new
+// binary is rolled out and must keep the old binary working; contract
+// migrations run once the old binary is retired.
+type Phase string
+
+const (
+	// PhaseExpand adds schema that the old binary can safely ignore
+	PhaseExpand Phase = "expand"
+	// PhaseContract tightens or removes schema the old binary relied on
+	PhaseContract Phase = "contract"
+)
+
+// Common errors
+var (
+	ErrInvalidPhase       = errors.New("invalid migration phase")
+	ErrStepNotAllowed     = errors.New("step not allowed in this phase")
+	ErrUnsafeStep         = errors.New("unsafe migration step")
+	ErrBackfillIncomplete = errors.New("backfill incomplete")
+)
+
+// Step is a single schema change
+type Step interface {
+	// Describe returns a human-readable description of the step
+	Describe() string
+	// Phase returns the phase the step may run in
+	Phase() Phase
+	// Validate checks the step definition for unsafe patterns
+	Validate() error
+	// Apply executes the step
+	Apply(ctx context.Context, db *gorm.DB) error
+}
+
+// Migration is an ordered list of steps applied together
+type Migration struct {
+	ID    string
+	Phase Phase
+	Steps []Step
+}
+
+// Validate checks that every step is safe and belongs to the migration's phase
+func (m Migration) Validate() error {
+	if m.Phase != PhaseExpand && m.Phase != PhaseContract {
+		return fmt.Errorf("%w: migration %s has phase %q", ErrInvalidPhase, m.ID, m.Phase)
+	}
+
+	for _, step := range m.Steps {
+		if step.Phase() != m.Phase {
+			return fmt.Errorf("%w: %s is a %s step in %s migration %s",
+				ErrStepNotAllowed, step.Describe(), step.Phase(), m.Phase, m.ID)
+		}
+		if err := step.Validate(); err != nil {
+			return fmt.Errorf("migration %s: %w", m.ID, err)
+		}
+	}
+	return nil
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	ID        string `gorm:"primaryKey;type:varchar(100)"`
+	Phase     string `gorm:"type:varchar(20)"`
+	AppliedAt time.Time
+}
+
+// Migrator applies migrations and records them in the schema_migrations table
+type Migrator struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewMigrator creates a new migrator
+func NewMigrator(db *gorm.DB, logger *zap.Logger) *Migrator {
+	return &Migrator{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Apply runs every pending migration of the given phase, in order
+func (m *Migrator) Apply(ctx context.Context, migrations []Migration, phase Phase) error {
+	if phase != PhaseExpand && phase != PhaseContract {
+		return fmt.Errorf("%w: %q", ErrInvalidPhase, phase)
+	}
+
+	// Validate everything up front so a bad definition doesn't leave a half-applied phase
+	for _, migration := range migrations {
+		if err := migration.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := m.db.WithContext(ctx).AutoMigrate(&SchemaMigration{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	for _, migration := range migrations {
+		if migration.Phase != phase {
+			continue
+		}
+
+		var count int64
+		if err := m.db.WithContext(ctx).Model(&SchemaMigration{}).
+			Where("id = ?", migration.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			m.logger.Debug("Migration already applied", zap.String("id", migration.ID))
+			continue
+		}
+
+		m.logger.Info("Applying migration",
+			zap.String("id", migration.ID),
+			zap.String("phase", string(migration.Phase)))
+
+		for _, step := range migration.Steps {
+			m.logger.Info("Applying migration step",
+				zap.String("id", migration.ID),
+				zap.String("step", step.Describe()))
+
+			if err := step.Apply(ctx, m.db.WithContext(ctx)); err != nil {
+				return fmt.Errorf("migration %s: %s: %w", migration.ID, step.Describe(), err)
+			}
+		}
+
+		record := SchemaMigration{
+			ID:        migration.ID,
+			Phase:     string(migration.Phase),
+			AppliedAt: time.Now(),
+		}
+		if err := m.db.WithContext(ctx).Create(&record).Error; err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", migration.ID, err)
+		}
+	}
+
+	return nil
+}
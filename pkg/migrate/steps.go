@@ -0,0 +1,243 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// defaultBackfillBatchSize is the number of rows updated per backfill batch
+const defaultBackfillBatchSize = 1000
+
+// AddColumn adds a column that the old binary can ignore.
+// The column must be nullable or have a default, otherwise inserts
+// from the old binary would start failing.
+type AddColumn struct {
+	Table   string
+	Column  string
+	Type    string
+	Default string
+}
+
+// Describe returns a human-readable description of the step
+func (s AddColumn) Describe() string {
+	return fmt.Sprintf("add column %s.%s %s", s.Table, s.Column, s.Type)
+}
+
+// Phase returns the phase the step may run in
+func (s AddColumn) Phase() Phase { return PhaseExpand }
+
+// Validate checks the step definition for unsafe patterns
+func (s AddColumn) Validate() error {
+	if strings.Contains(strings.ToUpper(s.Type), "NOT NULL") && s.Default == "" {
+		return fmt.Errorf("%w: %s: NOT NULL columns need a default, add it nullable and use SetNotNull after a backfill",
+			ErrUnsafeStep, s.Describe())
+	}
+	return nil
+}
+
+// Apply executes the step
+func (s AddColumn) Apply(ctx context.Context, db *gorm.DB) error {
+	if db.Migrator().HasColumn(s.Table, s.Column) {
+		return nil
+	}
+
+	sql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", s.Table, s.Column, s.Type)
+	if s.Default != "" {
+		sql += " DEFAULT " + s.Default
+	}
+	return db.Exec(sql).Error
+}
+
+// Backfill fills a column in batches, so it doesn't hold long locks on large tables
+type Backfill struct {
+	Table  string
+	Column string
+	// Value is the SQL expression assigned to the column
+	Value string
+	// Where optionally restricts the rows to fill
+	Where     string
+	BatchSize int
+}
+
+// Describe returns a human-readable description of the step
+func (s Backfill) Describe() string {
+	return fmt.Sprintf("backfill %s.%s = %s", s.Table, s.Column, s.Value)
+}
+
+// Phase returns the phase the step may run in
+func (s Backfill) Phase() Phase { return PhaseExpand }
+
+// Validate checks the step definition for unsafe patterns
+func (s Backfill) Validate() error {
+	if s.Value == "" {
+		return fmt.Errorf("%w: %s: missing value", ErrUnsafeStep, s.Describe())
+	}
+	return nil
+}
+
+// Apply executes the step
+func (s Backfill) Apply(ctx context.Context, db *gorm.DB) error {
+	batchSize := s.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBackfillBatchSize
+	}
+
+	condition := fmt.Sprintf("%s IS NULL", s.Column)
+	if s.Where != "" {
+		condition = fmt.Sprintf("%s AND (%s)", condition, s.Where)
+	}
+
+	for {
+		result := db.Exec(fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s LIMIT %d",
+			s.Table, s.Column, s.Value, condition, batchSize))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < int64(batchSize) {
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// SetNotNull adds a NOT NULL constraint once a column has been backfilled
+type SetNotNull struct {
+	Table  string
+	Column string
+	// Type is the full column type, required by MySQL's MODIFY COLUMN
+	Type string
+}
+
+// Describe returns a human-readable description of the step
+func (s SetNotNull) Describe() string {
+	return fmt.Sprintf("set %s.%s NOT NULL", s.Table, s.Column)
+}
+
+// Phase returns the phase the step may run in
+func (s SetNotNull) Phase() Phase { return PhaseContract }
+
+// Validate checks the step definition for unsafe patterns
+func (s SetNotNull) Validate() error {
+	if s.Type == "" {
+		return fmt.Errorf("%w: %s: missing column type", ErrUnsafeStep, s.Describe())
+	}
+	return nil
+}
+
+// Apply executes the step
+func (s SetNotNull) Apply(ctx context.Context, db *gorm.DB) error {
+	var count int64
+	if err := db.Table(s.Table).Where(fmt.Sprintf("%s IS NULL", s.Column)).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %d rows in %s still have NULL %s", ErrBackfillIncomplete, count, s.Table, s.Column)
+	}
+
+	return db.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s NOT NULL", s.Table, s.Column, s.Type)).Error
+}
+
+// AddIndex creates an index
+type AddIndex struct {
+	Table   string
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// Describe returns a human-readable description of the step
+func (s AddIndex) Describe() string {
+	return fmt.Sprintf("add index %s on %s(%s)", s.Name, s.Table, strings.Join(s.Columns, ", "))
+}
+
+// Phase returns the phase the step may run in.
+// Unique indexes reject writes the old binary may still make, so they belong to contract.
+func (s AddIndex) Phase() Phase {
+	if s.Unique {
+		return PhaseContract
+	}
+	return PhaseExpand
+}
+
+// Validate checks the step definition for unsafe patterns
+func (s AddIndex) Validate() error {
+	if s.Name == "" || len(s.Columns) == 0 {
+		return fmt.Errorf("%w: %s: missing name or columns", ErrUnsafeStep, s.Describe())
+	}
+	return nil
+}
+
+// Apply executes the step
+func (s AddIndex) Apply(ctx context.Context, db *gorm.DB) error {
+	if db.Migrator().HasIndex(s.Table, s.Name) {
+		return nil
+	}
+
+	kind := "INDEX"
+	if s.Unique {
+		kind = "UNIQUE INDEX"
+	}
+	return db.Exec(fmt.Sprintf("CREATE %s %s ON %s (%s)", kind, s.Name, s.Table, strings.Join(s.Columns, ", "))).Error
+}
+
+// DropColumn removes a column that no running binary uses any more
+type DropColumn struct {
+	Table  string
+	Column string
+}
+
+// Describe returns a human-readable description of the step
+func (s DropColumn) Describe() string {
+	return fmt.Sprintf("drop column %s.%s", s.Table, s.Column)
+}
+
+// Phase returns the phase the step may run in
+func (s DropColumn) Phase() Phase { return PhaseContract }
+
+// Validate checks the step definition for unsafe patterns
+func (s DropColumn) Validate() error { return nil }
+
+// Apply executes the step
+func (s DropColumn) Apply(ctx context.Context, db *gorm.DB) error {
+	if !db.Migrator().HasColumn(s.Table, s.Column) {
+		return nil
+	}
+	return db.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", s.Table, s.Column)).Error
+}
+
+// DropIndex removes an index that no running binary relies on any more
+type DropIndex struct {
+	Table string
+	Name  string
+}
+
+// Describe returns a human-readable description of the step
+func (s DropIndex) Describe() string {
+	return fmt.Sprintf("drop index %s on %s", s.Name, s.Table)
+}
+
+// Phase returns the phase the step may run in.
+// The old binary may still rely on the index, e.g. a unique one, so it belongs to contract.
+func (s DropIndex) Phase() Phase { return PhaseContract }
+
+// Validate checks the step definition for unsafe patterns
+func (s DropIndex) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("%w: %s: missing name", ErrUnsafeStep, s.Describe())
+	}
+	return nil
+}
+
+// Apply executes the step
+func (s DropIndex) Apply(ctx context.Context, db *gorm.DB) error {
+	if !db.Migrator().HasIndex(s.Table, s.Name) {
+		return nil
+	}
+	return db.Exec(fmt.Sprintf("DROP INDEX %s ON %s", s.Name, s.Table)).Error
+}
@@ -0,0 +1,57 @@
+package notification
+
+// builtinTemplates is the content templates have until an admin changes it
+var builtinTemplates = []Template{
+	{
+		Name:    EmailVerification,
+		Channel: ChannelEmail,
+		Subject: "Verify your email address",
+		Body: `<p>Hi {{.name}},</p>
+<p>Please confirm your email address by opening the link below.</p>
+<p><a href="{{.verification_url}}">Verify email address</a></p>
+<p>The link expires in {{.expires_in}}. If you didn't create an account, you can ignore this email.</p>`,
+		SampleData: `{"name": "Jane Doe", "verification_url": "https://example.com/verify?token=sample", "expires_in": "24 hours"}`,
+	},
+	{
+		Name:    EmailPasswordReset,
+		Channel: ChannelEmail,
+		Subject: "Reset your password",
+		Body: `<p>Hi {{.name}},</p>
+<p>We received a request to reset your password. Open the link below to choose a new one.</p>
+<p><a href="{{.reset_url}}">Reset password</a></p>
+<p>The link expires in {{.expires_in}}. If you didn't request a reset, you can ignore this email.</p>`,
+		SampleData: `{"name": "Jane Doe", "reset_url": "https://example.com/reset-password?token=sample", "expires_in": "1 hour"}`,
+	},
+	{
+		Name:    EmailInvite,
+		Channel: ChannelEmail,
+		Subject: "You're invited",
+		Body: `<p>Hi,</p>
+<p>You've been invited to create an account. Open the link below to choose your name and password.</p>
+<p><a href="{{.invite_url}}">Accept invite</a></p>
+<p>The link expires in {{.expires_in}}. If you didn't expect an invite, you can ignore this email.</p>`,
+		SampleData: `{"invite_url": "https://example.com/accept-invite?code=sample", "expires_in": "7 days"}`,
+	},
+	{
+		Name:    EmailRecoveryVerification,
+		Channel: ChannelEmail,
+		Subject: "Verify your recovery email address",
+		Body: `<p>Hi {{.name}},</p>
+<p>This address was added to an account to receive password reset links when its primary inbox can't be reached. Open the link below to confirm it.</p>
+<p><a href="{{.verification_url}}">Verify recovery email</a></p>
+<p>The link expires in {{.expires_in}}. If you didn't add this address, you can ignore this email.</p>`,
+		SampleData: `{"name": "Jane Doe", "verification_url": "https://example.com/verify-recovery-email?token=sample", "expires_in": "24 hours"}`,
+	},
+	{
+		Name:    WebhookEvent,
+		Channel: ChannelWebhook,
+		Subject: "{{.type}}",
+		Body: `{
+  "id": {{json .id}},
+  "type": {{json .type}},
+  "occurred_at": {{json .occurred_at}},
+  "data": {{json .data}}
+}`,
+		SampleData: `{"id": "1", "type": "user.created", "occurred_at": "2024-01-01T00:00:00Z", "data": {"user_id": "00000000-0000-0000-0000-000000000002"}}`,
+	},
+}
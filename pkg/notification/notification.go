@@ -0,0 +1,427 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"slices"
+	"sort"
+	texttemplate "text/template"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// Channels templates are rendered for
+const (
+	// ChannelEmail bodies are HTML, values are escaped
+	ChannelEmail = "email"
+	// ChannelWebhook bodies are JSON, values are inserted with the json function
+	ChannelWebhook = "webhook"
+)
+
+// Names of the built-in templates
+const (
+	EmailVerification         = "email.verification"
+	EmailPasswordReset        = "email.password_reset"
+	EmailInvite               = "email.invite"
+	EmailRecoveryVerification = "email.recovery_verification"
+	WebhookEvent              = "webhook.event"
+)
+
+// BuiltinLocale is the locale of the built-in templates, the end of every fallback chain
+const BuiltinLocale = "en"
+
+// Common errors
+var (
+	// ErrNotFound is returned for a template that isn't built in or a missing translation
+	ErrNotFound = apperrors.NotFound("notification template not found")
+	// ErrInvalidLocale is returned for a locale that isn't a BCP 47 language tag
+	ErrInvalidLocale = apperrors.Invalid("invalid locale, expected a BCP 47 language tag")
+)
+
+// Template is a notification template in one locale. Subject and Body are Go
+// templates executed with a JSON object, e.g. {{.name}}; SampleData is the
+// object used to preview and validate them.
+type Template struct {
+	Name string `gorm:"type:varchar(100);primaryKey"`
+	// Locale is the BCP 47 language tag of the content, e.g. "pt-BR"
+	Locale  string `gorm:"type:varchar(35);primaryKey"`
+	Channel string `gorm:"type:varchar(20);not null"`
+	// Subject is the subject of emails and the event name of webhooks
+	Subject    string `gorm:"type:text"`
+	Body       string `gorm:"type:text"`
+	SampleData string `gorm:"type:text"`
+	// UpdatedBy is the admin who last changed the template
+	UpdatedBy string `gorm:"type:varchar(36)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Customized is set when the template was changed from its built-in content
+	Customized bool `gorm:"-"`
+}
+
+// TableName specifies the table name for the Template model
+func (Template) TableName() string {
+	return "notification_templates"
+}
+
+// Rendered is a rendered notification
+type Rendered struct {
+	// Locale is the locale of the template that was rendered
+	Locale  string
+	Channel string
+	Subject string
+	Body    string
+}
+
+// Draft is unsaved template content, empty fields keep the stored content
+type Draft struct {
+	Subject string
+	Body    string
+}
+
+// Templates is the catalog of notification templates and their translations.
+//
+// Every template has built-in English content. Admins can change it and add
+// translations, which are stored and take effect without a deploy.
+// Notifications are rendered in the first locale of a fallback chain that
+// has a translation, see Fallbacks.
+type Templates struct {
+	store    store
+	defaults map[string]Template
+	logger   *zap.Logger
+}
+
+// NewTemplates creates templates stored in the notification_templates table
+func NewTemplates(db *gorm.DB, logger *zap.Logger) (*Templates, error) {
+	if err := db.AutoMigrate(&Template{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate notification templates table: %w", err)
+	}
+
+	return newTemplates(newDBStore(db), logger), nil
+}
+
+// NewMemoryTemplates creates templates whose changes are kept in memory, e.g. for mock services
+func NewMemoryTemplates(logger *zap.Logger) *Templates {
+	return newTemplates(newMemoryStore(), logger)
+}
+
+// newTemplates creates templates on the given store
+func newTemplates(store store, logger *zap.Logger) *Templates {
+	defaults := make(map[string]Template)
+	for _, template := range builtinTemplates {
+		template.Locale = BuiltinLocale
+		defaults[template.Name] = template
+	}
+
+	return &Templates{
+		store:    store,
+		defaults: defaults,
+		logger:   logger,
+	}
+}
+
+// Fallbacks returns the locales to look for translations in: every given
+// locale followed by its parents, e.g. "pt-BR" then "pt", and finally
+// BuiltinLocale. Empty and invalid locales are skipped.
+func Fallbacks(locales ...string) []string {
+	var chain []string
+	add := func(locale string) {
+		if !slices.Contains(chain, locale) {
+			chain = append(chain, locale)
+		}
+	}
+
+	for _, locale := range locales {
+		if locale == "" {
+			continue
+		}
+		tag, err := language.Parse(locale)
+		if err != nil {
+			continue
+		}
+		for ; tag != language.Und; tag = tag.Parent() {
+			add(tag.String())
+		}
+	}
+	add(BuiltinLocale)
+
+	return chain
+}
+
+// canonicalLocale validates a locale and returns its canonical form, BuiltinLocale if empty
+func canonicalLocale(locale string) (string, error) {
+	if locale == "" {
+		return BuiltinLocale, nil
+	}
+
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", ErrInvalidLocale
+	}
+	return tag.String(), nil
+}
+
+// List returns every template and translation sorted by name and locale
+func (t *Templates) List(ctx context.Context) ([]*Template, error) {
+	stored, err := t.store.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]*Template, 0, len(t.defaults)+len(stored))
+	customized := make(map[string]bool)
+	for _, template := range stored {
+		if _, ok := t.defaults[template.Name]; !ok {
+			continue
+		}
+		template.Customized = true
+		templates = append(templates, template)
+		if template.Locale == BuiltinLocale {
+			customized[template.Name] = true
+		}
+	}
+	for name, template := range t.defaults {
+		if !customized[name] {
+			template := template
+			templates = append(templates, &template)
+		}
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Name != templates[j].Name {
+			return templates[i].Name < templates[j].Name
+		}
+		return templates[i].Locale < templates[j].Locale
+	})
+	return templates, nil
+}
+
+// Get returns a template in exactly the given locale, BuiltinLocale if empty
+func (t *Templates) Get(ctx context.Context, name, locale string) (*Template, error) {
+	builtin, ok := t.defaults[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	locale, err := canonicalLocale(locale)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := t.store.get(ctx, name, locale)
+	if errors.Is(err, ErrNotFound) && locale == BuiltinLocale {
+		return &builtin, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	template.Customized = true
+	return template, nil
+}
+
+// Resolve returns a template in the first locale of the fallback chain of the
+// given locales that has a translation
+func (t *Templates) Resolve(ctx context.Context, name string, locales ...string) (*Template, error) {
+	for _, locale := range Fallbacks(locales...) {
+		template, err := t.Get(ctx, name, locale)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return template, err
+	}
+	return nil, ErrNotFound
+}
+
+// Update changes a template or translation, adding the translation if it
+// doesn't exist yet. The new content must render with the sample data,
+// empty sample data keeps the current one.
+func (t *Templates) Update(ctx context.Context, name, locale, subject, body, sampleData, updatedBy string) (*Template, error) {
+	t.logger.Debug("Updating notification template",
+		zap.String("name", name),
+		zap.String("locale", locale))
+
+	locale, err := canonicalLocale(locale)
+	if err != nil {
+		return nil, err
+	}
+
+	// A new translation starts out from the content it replaces
+	current, err := t.Resolve(ctx, name, locale)
+	if err != nil {
+		return nil, err
+	}
+	if body == "" {
+		return nil, apperrors.Invalid("body is required")
+	}
+
+	template := &Template{
+		Name:       name,
+		Locale:     locale,
+		Channel:    current.Channel,
+		Subject:    subject,
+		Body:       body,
+		SampleData: sampleData,
+		UpdatedBy:  updatedBy,
+		CreatedAt:  time.Now(),
+	}
+	if template.SampleData == "" {
+		template.SampleData = current.SampleData
+	}
+	if current.Locale == locale && !current.CreatedAt.IsZero() {
+		template.CreatedAt = current.CreatedAt
+	}
+
+	// Refuse content that doesn't render, it would break the notification
+	data, err := decodeData(template.SampleData)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := render(template, data); err != nil {
+		return nil, err
+	}
+
+	if err := t.store.save(ctx, template); err != nil {
+		t.logger.Error("Failed to save notification template",
+			zap.String("name", name),
+			zap.String("locale", locale),
+			zap.Error(err))
+		return nil, err
+	}
+
+	template.Customized = true
+	return template, nil
+}
+
+// Reset restores the built-in content of a template, or removes a
+// translation, and returns the template that applies to the locale now
+func (t *Templates) Reset(ctx context.Context, name, locale string) (*Template, error) {
+	if _, ok := t.defaults[name]; !ok {
+		return nil, ErrNotFound
+	}
+
+	locale, err := canonicalLocale(locale)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.store.delete(ctx, name, locale); err != nil && !errors.Is(err, ErrNotFound) {
+		t.logger.Error("Failed to reset notification template",
+			zap.String("name", name),
+			zap.String("locale", locale),
+			zap.Error(err))
+		return nil, err
+	}
+
+	return t.Resolve(ctx, name, locale)
+}
+
+// Render renders a template in the first locale of the fallback chain of the
+// given locales with a translation, see Fallbacks
+func (t *Templates) Render(ctx context.Context, name string, locales []string, data map[string]interface{}) (*Rendered, error) {
+	template, err := t.Resolve(ctx, name, locales...)
+	if err != nil {
+		return nil, err
+	}
+
+	return render(template, data)
+}
+
+// Preview renders a template as it would be for the locale, or a draft of it,
+// with the given data or the template's sample data when there is none
+func (t *Templates) Preview(ctx context.Context, name, locale string, draft Draft, data map[string]interface{}) (*Rendered, error) {
+	if _, err := canonicalLocale(locale); err != nil {
+		return nil, err
+	}
+
+	template, err := t.Resolve(ctx, name, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	if draft.Subject != "" {
+		template.Subject = draft.Subject
+	}
+	if draft.Body != "" {
+		template.Body = draft.Body
+	}
+
+	if data == nil {
+		if data, err = decodeData(template.SampleData); err != nil {
+			return nil, err
+		}
+	}
+
+	return render(template, data)
+}
+
+// decodeData decodes sample data, which must be a JSON object
+func decodeData(sampleData string) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	if sampleData == "" {
+		return data, nil
+	}
+	if err := json.Unmarshal([]byte(sampleData), &data); err != nil {
+		return nil, apperrors.Invalid("sample data must be a JSON object")
+	}
+	return data, nil
+}
+
+// funcs are the functions available in templates
+var funcs = map[string]interface{}{
+	// json encodes a value, e.g. to insert strings into webhook bodies
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+}
+
+// render executes the subject and body of a template. Missing keys are errors
+// rather than empty output so typos are caught when the template is saved.
+func render(template *Template, data map[string]interface{}) (*Rendered, error) {
+	subject, err := texttemplate.New("subject").Funcs(funcs).Option("missingkey=error").Parse(template.Subject)
+	if err != nil {
+		return nil, apperrors.Invalid(fmt.Sprintf("invalid subject template: %v", err))
+	}
+
+	rendered := Rendered{Locale: template.Locale, Channel: template.Channel}
+	var buf bytes.Buffer
+	if err := subject.Execute(&buf, data); err != nil {
+		return nil, apperrors.Invalid(fmt.Sprintf("failed to render subject: %v", err))
+	}
+	rendered.Subject = buf.String()
+
+	// Email bodies are HTML, escape the values inserted into them
+	var body interface {
+		Execute(w io.Writer, data interface{}) error
+	}
+	if template.Channel == ChannelEmail {
+		body, err = htmltemplate.New("body").Funcs(funcs).Option("missingkey=error").Parse(template.Body)
+	} else {
+		body, err = texttemplate.New("body").Funcs(funcs).Option("missingkey=error").Parse(template.Body)
+	}
+	if err != nil {
+		return nil, apperrors.Invalid(fmt.Sprintf("invalid body template: %v", err))
+	}
+
+	buf.Reset()
+	if err := body.Execute(&buf, data); err != nil {
+		return nil, apperrors.Invalid(fmt.Sprintf("failed to render body: %v", err))
+	}
+	rendered.Body = buf.String()
+
+	if template.Channel == ChannelWebhook && !json.Valid(buf.Bytes()) {
+		return nil, apperrors.Invalid("webhook body must render to JSON")
+	}
+
+	return &rendered, nil
+}
@@ -0,0 +1,100 @@
+package notification
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// store persists the templates changed by admins
+type store interface {
+	get(ctx context.Context, name, locale string) (*Template, error)
+	list(ctx context.Context) ([]*Template, error)
+	save(ctx context.Context, template *Template) error
+	delete(ctx context.Context, name, locale string) error
+}
+
+// dbStore keeps templates in the notification_templates table
+type dbStore struct {
+	templates *database.Repository[Template]
+}
+
+// newDBStore creates a store on the notification_templates table
+func newDBStore(db *gorm.DB) *dbStore {
+	return &dbStore{templates: database.NewRepository[Template](db, ErrNotFound)}
+}
+
+func (s *dbStore) get(ctx context.Context, name, locale string) (*Template, error) {
+	return s.templates.First(ctx, database.Where("name = ? AND locale = ?", name, locale))
+}
+
+func (s *dbStore) list(ctx context.Context) ([]*Template, error) {
+	var templates []*Template
+	if err := s.templates.Query(ctx).Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (s *dbStore) save(ctx context.Context, template *Template) error {
+	return s.templates.Save(ctx, template)
+}
+
+func (s *dbStore) delete(ctx context.Context, name, locale string) error {
+	return s.templates.Query(ctx, database.Where("name = ? AND locale = ?", name, locale)).Delete(&Template{}).Error
+}
+
+// memoryStore keeps templates in memory, keyed by name and locale
+type memoryStore struct {
+	mu        sync.Mutex
+	templates map[[2]string]Template
+}
+
+// newMemoryStore creates an empty in-memory store
+func newMemoryStore() *memoryStore {
+	return &memoryStore{templates: make(map[[2]string]Template)}
+}
+
+func (s *memoryStore) get(ctx context.Context, name, locale string) (*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	template, ok := s.templates[[2]string{name, locale}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &template, nil
+}
+
+func (s *memoryStore) list(ctx context.Context) ([]*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	templates := make([]*Template, 0, len(s.templates))
+	for _, template := range s.templates {
+		template := template
+		templates = append(templates, &template)
+	}
+	return templates, nil
+}
+
+func (s *memoryStore) save(ctx context.Context, template *Template) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	template.UpdatedAt = time.Now()
+	s.templates[[2]string{template.Name, template.Locale}] = *template
+	return nil
+}
+
+func (s *memoryStore) delete(ctx context.Context, name, locale string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.templates, [2]string{name, locale})
+	return nil
+}
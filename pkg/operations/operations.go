@@ -0,0 +1,281 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Operation states
+const (
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+)
+
+// Common errors
+var (
+	ErrNotFound = errors.New("operation not found")
+	ErrDone     = errors.New("operation is already done")
+	// ErrCancelled is the cause of the context of a cancelled task
+	ErrCancelled = errors.New("operation was cancelled")
+	// errShutdown is the cause of the context of a task interrupted by Close
+	errShutdown = errors.New("interrupted by shutdown")
+)
+
+// Operation is an asynchronous task and its persisted state
+type Operation struct {
+	ID string `gorm:"primaryKey;type:varchar(36)"`
+	// Kind names what the operation does, e.g. "auth.bulk.suspend"
+	Kind      string `gorm:"index;type:varchar(100)"`
+	State     string `gorm:"index;type:varchar(20)"`
+	CreatedBy string `gorm:"index;type:varchar(36)"`
+	// Metadata is the JSON progress reported by the task
+	Metadata string `gorm:"type:text"`
+	// Result is the JSON result of a succeeded task
+	Result string `gorm:"type:text"`
+	// Error is the failure message of a failed or cancelled task
+	Error string `gorm:"type:text"`
+	// CancelRequested asks the instance running the task to cancel it
+	CancelRequested bool
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	FinishedAt      *time.Time
+}
+
+// Done reports whether the operation finished, one way or another
+func (o *Operation) Done() bool {
+	return o.State != StateRunning
+}
+
+// Task is the work of an operation. It reports its progress through progress and
+// returns a result that is stored as JSON. The message of a returned error is shown
+// to clients. ctx is cancelled when the operation is cancelled or the manager closed.
+type Task func(ctx context.Context, progress *Progress) (interface{}, error)
+
+// Manager runs operations in the background and persists their state so any
+// instance can report on them.
+//
+// Operations run in the instance that started them. Cancelling an operation of
+// another instance is a request the task picks up on its next progress update.
+type Manager struct {
+	store   store
+	logger  *zap.Logger
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc
+	wg      sync.WaitGroup
+}
+
+// NewManager creates a manager persisting operations in the operations table
+func NewManager(db *gorm.DB, logger *zap.Logger) (*Manager, error) {
+	if err := db.AutoMigrate(&Operation{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate operations table: %w", err)
+	}
+
+	return newManager(newDBStore(db), logger), nil
+}
+
+// NewMemoryManager creates a manager keeping operations in memory, e.g. for mock services
+func NewMemoryManager(logger *zap.Logger) *Manager {
+	return newManager(newMemoryStore(), logger)
+}
+
+// newManager creates a manager on the given store
+func newManager(store store, logger *zap.Logger) *Manager {
+	return &Manager{
+		store:   store,
+		logger:  logger,
+		running: make(map[string]context.CancelCauseFunc),
+	}
+}
+
+// Start stores a new operation with the initial metadata and runs the task in the background
+func (m *Manager) Start(ctx context.Context, kind, createdBy string, metadata interface{}, task Task) (*Operation, error) {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("invalid operation metadata: %w", err)
+	}
+
+	now := time.Now()
+	op := &Operation{
+		ID:        uuid.New().String(),
+		Kind:      kind,
+		State:     StateRunning,
+		CreatedBy: createdBy,
+		Metadata:  string(metadataJSON),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := m.store.create(ctx, op); err != nil {
+		m.logger.Error("Failed to store operation",
+			zap.String("kind", kind),
+			zap.Error(err))
+		return nil, err
+	}
+
+	// The task outlives the request, it gets its own context
+	taskCtx, cancel := context.WithCancelCause(context.Background())
+	m.mu.Lock()
+	m.running[op.ID] = cancel
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.run(taskCtx, cancel, *op, task)
+
+	m.logger.Info("Operation started",
+		zap.String("operation_id", op.ID),
+		zap.String("kind", kind),
+		zap.String("created_by", createdBy))
+
+	return op, nil
+}
+
+// run runs a task and stores how it ended
+func (m *Manager) run(ctx context.Context, cancel context.CancelCauseFunc, op Operation, task Task) {
+	defer m.wg.Done()
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, op.ID)
+		m.mu.Unlock()
+		cancel(nil)
+	}()
+
+	logger := m.logger.With(zap.String("operation_id", op.ID), zap.String("kind", op.Kind))
+	progress := &Progress{manager: m, id: op.ID, cancel: cancel, logger: logger}
+
+	result, err := runTask(ctx, task, progress)
+
+	var resultJSON []byte
+	state, message := StateSucceeded, ""
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, ErrCancelled):
+		state, message = StateCancelled, ErrCancelled.Error()
+	case errors.Is(cause, errShutdown):
+		state, message = StateFailed, errShutdown.Error()
+	case err != nil:
+		state, message = StateFailed, err.Error()
+	default:
+		if resultJSON, err = json.Marshal(result); err != nil {
+			state, message = StateFailed, "invalid operation result"
+			logger.Error("Failed to encode operation result", zap.Error(err))
+		}
+	}
+
+	// The request context is gone, finish with a fresh one so cancellation doesn't lose the state
+	if err := m.store.finish(context.Background(), op.ID, state, string(resultJSON), message); err != nil {
+		logger.Error("Failed to store operation result", zap.Error(err))
+		return
+	}
+
+	logger.Info("Operation finished", zap.String("state", state), zap.String("error", message))
+}
+
+// runTask runs a task, turning a panic into an error so it can't take the service down
+func runTask(ctx context.Context, task Task, progress *Progress) (result interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			progress.logger.Error("Operation panicked", zap.Any("panic", recovered), zap.Stack("stack"))
+			err = errors.New("internal error")
+		}
+	}()
+	return task(ctx, progress)
+}
+
+// Get returns an operation
+func (m *Manager) Get(ctx context.Context, id string) (*Operation, error) {
+	return m.store.get(ctx, id)
+}
+
+// List returns a page of operations, newest first, along with the total number of matches.
+// Empty createdBy or kind match every operation.
+func (m *Manager) List(ctx context.Context, createdBy, kind string, page, pageSize int) ([]*Operation, int, error) {
+	// Validate page and pageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	return m.store.list(ctx, createdBy, kind, page, pageSize)
+}
+
+// Cancel asks a running operation to stop and returns its current state.
+// The operation is done once its task noticed.
+func (m *Manager) Cancel(ctx context.Context, id string) (*Operation, error) {
+	op, err := m.store.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if op.Done() {
+		return nil, ErrDone
+	}
+
+	m.mu.Lock()
+	cancel, local := m.running[id]
+	m.mu.Unlock()
+
+	// Also record the request so every instance reports it
+	if err := m.store.requestCancel(ctx, id); err != nil {
+		return nil, err
+	}
+	if local {
+		cancel(ErrCancelled)
+	}
+
+	m.logger.Info("Operation cancellation requested",
+		zap.String("operation_id", id),
+		zap.Bool("local", local))
+
+	op.CancelRequested = true
+	return op, nil
+}
+
+// Close interrupts the running operations, they fail, and waits for their tasks to return
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	for _, cancel := range m.running {
+		cancel(errShutdown)
+	}
+	m.mu.Unlock()
+
+	m.wg.Wait()
+	return nil
+}
+
+// Progress reports the progress of a running operation
+type Progress struct {
+	manager *Manager
+	id      string
+	cancel  context.CancelCauseFunc
+	logger  *zap.Logger
+}
+
+// Update stores the operation's metadata, e.g. the number of processed items, and
+// cancels the task's context if another instance requested it. Failures are only
+// logged, the task continues.
+func (p *Progress) Update(ctx context.Context, metadata interface{}) {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		p.logger.Error("Failed to encode operation metadata", zap.Error(err))
+		return
+	}
+
+	// Progress is still stored after the task was cancelled
+	cancelRequested, err := p.manager.store.saveProgress(context.WithoutCancel(ctx), p.id, string(metadataJSON))
+	if err != nil {
+		p.logger.Error("Failed to store operation progress", zap.Error(err))
+		return
+	}
+	if cancelRequested {
+		p.cancel(ErrCancelled)
+	}
+}
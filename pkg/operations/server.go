@@ -0,0 +1,158 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	operationspb "github.com/linkeunid/hello-go/api/gen/operations"
+)
+
+// Authorizer authenticates the caller of the operations API. Admins can access
+// every operation, other callers only the ones they started.
+type Authorizer func(ctx context.Context) (callerID string, admin bool, err error)
+
+// Server implements the OperationsService gRPC service on a manager
+type Server struct {
+	operationspb.UnimplementedOperationsServiceServer
+	manager   *Manager
+	authorize Authorizer
+	logger    *zap.Logger
+}
+
+// NewServer creates an OperationsService for the operations of a manager
+func NewServer(manager *Manager, authorize Authorizer, logger *zap.Logger) *Server {
+	return &Server{
+		manager:   manager,
+		authorize: authorize,
+		logger:    logger,
+	}
+}
+
+// GetOperation returns the state of an operation
+func (s *Server) GetOperation(ctx context.Context, req *operationspb.GetOperationRequest) (*operationspb.Operation, error) {
+	op, err := s.accessible(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return ToProto(op), nil
+}
+
+// ListOperations returns the caller's operations, newest first
+func (s *Server) ListOperations(ctx context.Context, req *operationspb.ListOperationsRequest) (*operationspb.ListOperationsResponse, error) {
+	callerID, _, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ops, total, err := s.manager.List(ctx, callerID, req.Kind, int(req.Page), int(req.PageSize))
+	if err != nil {
+		s.logger.Error("Failed to list operations", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list operations")
+	}
+
+	protoOps := make([]*operationspb.Operation, len(ops))
+	for i, op := range ops {
+		protoOps[i] = ToProto(op)
+	}
+
+	return &operationspb.ListOperationsResponse{
+		Operations: protoOps,
+		Total:      int32(total),
+	}, nil
+}
+
+// CancelOperation asks a running operation to stop
+func (s *Server) CancelOperation(ctx context.Context, req *operationspb.CancelOperationRequest) (*operationspb.Operation, error) {
+	if _, err := s.accessible(ctx, req.Id); err != nil {
+		return nil, err
+	}
+
+	op, err := s.manager.Cancel(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, ErrDone) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		s.logger.Error("Failed to cancel operation",
+			zap.String("operation_id", req.Id),
+			zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to cancel operation")
+	}
+
+	return ToProto(op), nil
+}
+
+// accessible returns an operation if the caller may access it. Operations of
+// other callers are reported as not found so their IDs can't be probed.
+func (s *Server) accessible(ctx context.Context, id string) (*Operation, error) {
+	callerID, admin, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	op, err := s.manager.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		s.logger.Error("Failed to get operation",
+			zap.String("operation_id", id),
+			zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get operation")
+	}
+
+	if !admin && op.CreatedBy != callerID {
+		s.logger.Warn("Access to operation of another caller denied",
+			zap.String("operation_id", id),
+			zap.String("caller_id", callerID))
+		return nil, status.Error(codes.NotFound, ErrNotFound.Error())
+	}
+
+	return op, nil
+}
+
+// ToProto converts an operation to its proto message, e.g. for RPCs that start one
+func ToProto(op *Operation) *operationspb.Operation {
+	protoOp := &operationspb.Operation{
+		Id:              op.ID,
+		Kind:            op.Kind,
+		State:           op.State,
+		Done:            op.Done(),
+		CreatedBy:       op.CreatedBy,
+		Metadata:        toStruct(op.Metadata),
+		Result:          toStruct(op.Result),
+		Error:           op.Error,
+		CancelRequested: op.CancelRequested,
+		CreatedAt:       formatTime(op.CreatedAt),
+		UpdatedAt:       formatTime(op.UpdatedAt),
+	}
+	if op.FinishedAt != nil {
+		protoOp.FinishedAt = formatTime(*op.FinishedAt)
+	}
+	return protoOp
+}
+
+// toStruct converts a JSON object to a struct, other values are left out
+func toStruct(value string) *structpb.Struct {
+	if value == "" {
+		return nil
+	}
+
+	result := &structpb.Struct{}
+	if err := protojson.Unmarshal([]byte(value), result); err != nil {
+		return nil
+	}
+	return result
+}
+
+// formatTime formats a timestamp for responses
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
@@ -0,0 +1,195 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/database"
+)
+
+// store persists operations
+type store interface {
+	create(ctx context.Context, op *Operation) error
+	get(ctx context.Context, id string) (*Operation, error)
+	list(ctx context.Context, createdBy, kind string, page, pageSize int) ([]*Operation, int, error)
+	// saveProgress stores the metadata of a running operation and returns whether cancellation was requested
+	saveProgress(ctx context.Context, id, metadata string) (bool, error)
+	finish(ctx context.Context, id, state, result, message string) error
+	requestCancel(ctx context.Context, id string) error
+}
+
+// dbStore keeps operations in the operations table
+type dbStore struct {
+	operations *database.Repository[Operation]
+}
+
+// newDBStore creates a store on the operations table
+func newDBStore(db *gorm.DB) *dbStore {
+	return &dbStore{operations: database.NewRepository[Operation](db, ErrNotFound)}
+}
+
+func (s *dbStore) create(ctx context.Context, op *Operation) error {
+	return s.operations.Create(ctx, op)
+}
+
+func (s *dbStore) get(ctx context.Context, id string) (*Operation, error) {
+	return s.operations.Get(ctx, id)
+}
+
+func (s *dbStore) list(ctx context.Context, createdBy, kind string, page, pageSize int) ([]*Operation, int, error) {
+	scopes := []database.Scope{database.OrderBy("created_at DESC")}
+	if createdBy != "" {
+		scopes = append(scopes, database.Where("created_by = ?", createdBy))
+	}
+	if kind != "" {
+		scopes = append(scopes, database.Where("kind = ?", kind))
+	}
+	return s.operations.List(ctx, page, pageSize, scopes...)
+}
+
+func (s *dbStore) saveProgress(ctx context.Context, id, metadata string) (bool, error) {
+	err := s.operations.Update(ctx, id,
+		map[string]interface{}{"metadata": metadata, "updated_at": time.Now()})
+	if err != nil {
+		return false, err
+	}
+
+	op, err := s.operations.Get(ctx, id, "cancel_requested")
+	if err != nil {
+		return false, err
+	}
+	return op.CancelRequested, nil
+}
+
+func (s *dbStore) finish(ctx context.Context, id, state, result, message string) error {
+	now := time.Now()
+	return s.operations.Update(ctx, id, map[string]interface{}{
+		"state":       state,
+		"result":      result,
+		"error":       message,
+		"updated_at":  now,
+		"finished_at": now,
+	})
+}
+
+func (s *dbStore) requestCancel(ctx context.Context, id string) error {
+	// Only running operations can be cancelled, one that just finished is left alone
+	err := s.operations.Update(ctx, id,
+		map[string]interface{}{"cancel_requested": true, "updated_at": time.Now()},
+		database.Where("state = ?", StateRunning))
+	if errors.Is(err, ErrNotFound) {
+		return ErrDone
+	}
+	return err
+}
+
+// memoryStore keeps operations in memory
+type memoryStore struct {
+	mu         sync.Mutex
+	operations map[string]*Operation
+}
+
+// newMemoryStore creates an empty in-memory store
+func newMemoryStore() *memoryStore {
+	return &memoryStore{operations: make(map[string]*Operation)}
+}
+
+func (s *memoryStore) create(ctx context.Context, op *Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *op
+	s.operations[op.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) get(ctx context.Context, id string) (*Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	op, exists := s.operations[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	copied := *op
+	return &copied, nil
+}
+
+func (s *memoryStore) list(ctx context.Context, createdBy, kind string, page, pageSize int) ([]*Operation, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matches []*Operation
+	for _, op := range s.operations {
+		if (createdBy == "" || op.CreatedBy == createdBy) && (kind == "" || op.Kind == kind) {
+			copied := *op
+			matches = append(matches, &copied)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].CreatedAt.After(matches[j].CreatedAt)
+	})
+
+	// Apply pagination
+	total := len(matches)
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []*Operation{}, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return matches[start:end], total, nil
+}
+
+func (s *memoryStore) saveProgress(ctx context.Context, id, metadata string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	op, exists := s.operations[id]
+	if !exists {
+		return false, ErrNotFound
+	}
+	op.Metadata = metadata
+	op.UpdatedAt = time.Now()
+	return op.CancelRequested, nil
+}
+
+func (s *memoryStore) finish(ctx context.Context, id, state, result, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	op, exists := s.operations[id]
+	if !exists {
+		return ErrNotFound
+	}
+	now := time.Now()
+	op.State = state
+	op.Result = result
+	op.Error = message
+	op.UpdatedAt = now
+	op.FinishedAt = &now
+	return nil
+}
+
+func (s *memoryStore) requestCancel(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	op, exists := s.operations[id]
+	if !exists {
+		return ErrNotFound
+	}
+	if op.Done() {
+		return ErrDone
+	}
+	op.CancelRequested = true
+	op.UpdatedAt = time.Now()
+	return nil
+}
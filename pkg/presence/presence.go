@@ -0,0 +1,91 @@
+package presence
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// Statuses of a user
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+// throttleKeyPrefix prefixes the Redis key set while a user's last seen time is fresh
+const throttleKeyPrefix = "presence:seen:"
+
+// Status returns whether a user last seen at lastSeen is online, i.e. was seen within window
+func Status(lastSeen time.Time, window time.Duration) string {
+	if !lastSeen.IsZero() && time.Since(lastSeen) <= window {
+		return StatusOnline
+	}
+	return StatusOffline
+}
+
+// Throttle limits how often the last seen time of a user is written, so active
+// users don't cause a database write on every request
+type Throttle interface {
+	// Allow reports whether the last seen time of the user should be written now
+	Allow(ctx context.Context, userID string) (bool, error)
+}
+
+// redisThrottle shares the throttle between instances through Redis
+type redisThrottle struct {
+	client   *redis.Client
+	interval time.Duration
+}
+
+// NewThrottle creates a throttle allowing a write per user every PRESENCE_UPDATE_INTERVAL
+func NewThrottle(cfg *config.Config) (Throttle, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Address,
+		Password: cfg.Redis.Password.Reveal(),
+		DB:       cfg.Redis.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %w", cfg.Redis.Address, err)
+	}
+
+	return &redisThrottle{client: client, interval: cfg.Presence.UpdateInterval}, nil
+}
+
+func (t *redisThrottle) Allow(ctx context.Context, userID string) (bool, error) {
+	return t.client.SetNX(ctx, throttleKeyPrefix+userID, 1, t.interval).Result()
+}
+
+// memoryThrottle keeps the throttle in memory, for mock services
+type memoryThrottle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	written  map[string]time.Time
+}
+
+// NewMemoryThrottle creates a throttle local to this instance, for mock services
+func NewMemoryThrottle(cfg *config.Config) Throttle {
+	return &memoryThrottle{
+		interval: cfg.Presence.UpdateInterval,
+		written:  make(map[string]time.Time),
+	}
+}
+
+func (t *memoryThrottle) Allow(ctx context.Context, userID string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if last, ok := t.written[userID]; ok && now.Sub(last) < t.interval {
+		return false, nil
+	}
+	t.written[userID] = now
+	return true, nil
+}
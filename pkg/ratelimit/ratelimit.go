@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/middleware"
+)
+
+// Store counts calls per key in fixed windows
+type Store interface {
+	// Increment counts a call against key and returns the calls counted in the
+	// current window, including this one, and when the window ends
+	Increment(ctx context.Context, key string, window time.Duration) (int, time.Time, error)
+}
+
+// Limiter allows a number of calls per key and window
+type Limiter struct {
+	store  Store
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+// NewLimiter creates a limiter allowing limit calls per window, its keys are
+// prefixed so limiters can share a store
+func NewLimiter(store Store, prefix string, limit int, window time.Duration) *Limiter {
+	return &Limiter{store: store, prefix: prefix, limit: limit, window: window}
+}
+
+// Take counts a call against key and reports whether it's within the limit,
+// along with the state of the limit
+func (l *Limiter) Take(ctx context.Context, key string) (middleware.RateLimit, bool, error) {
+	count, reset, err := l.store.Increment(ctx, l.prefix+key, l.window)
+	if err != nil {
+		return middleware.RateLimit{}, true, err
+	}
+
+	limit := middleware.RateLimit{Limit: l.limit, Remaining: l.limit - count, Reset: reset}
+	if limit.Remaining < 0 {
+		limit.Remaining = 0
+	}
+	return limit, count <= l.limit, nil
+}
+
+// redisStore shares the counts between instances through Redis
+type redisStore struct {
+	client *redis.Client
+}
+
+// incrementScript increments a counter, starts its window on the first call
+// and returns the count with the milliseconds left in the window
+var incrementScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return {count, redis.call("PTTL", KEYS[1])}
+`)
+
+// NewRedisStore creates a store shared by every instance using the Redis server
+func NewRedisStore(cfg *config.RedisConfig) (Store, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password.Reveal(),
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %w", cfg.Address, err)
+	}
+
+	return &redisStore{client: client}, nil
+}
+
+func (s *redisStore) Increment(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	result, err := incrementScript.Run(ctx, s.client, []string{key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	ttl := time.Duration(result[1]) * time.Millisecond
+	if ttl < 0 {
+		ttl = window
+	}
+	return int(result[0]), time.Now().Add(ttl), nil
+}
+
+// memoryStore keeps the counts in memory, local to this instance
+type memoryStore struct {
+	mu      sync.Mutex
+	windows map[string]*memoryWindow
+	pruned  time.Time
+}
+
+// memoryWindow is the count of a key in its current window
+type memoryWindow struct {
+	count int
+	reset time.Time
+}
+
+// NewMemoryStore creates a store local to this instance
+func NewMemoryStore() Store {
+	return &memoryStore{windows: make(map[string]*memoryWindow)}
+}
+
+func (s *memoryStore) Increment(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop ended windows once per window, so keys seen once don't pile up
+	if now.Sub(s.pruned) >= window {
+		for k, w := range s.windows {
+			if !now.Before(w.reset) {
+				delete(s.windows, k)
+			}
+		}
+		s.pruned = now
+	}
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.reset) {
+		w = &memoryWindow{reset: now.Add(window)}
+		s.windows[key] = w
+	}
+	w.count++
+	return w.count, w.reset, nil
+}
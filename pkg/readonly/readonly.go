@@ -0,0 +1,127 @@
+package readonly
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	cachepb "github.com/linkeunid/hello-go/api/gen/cache"
+	databasepb "github.com/linkeunid/hello-go/api/gen/database"
+	readonlypb "github.com/linkeunid/hello-go/api/gen/readonly"
+	"github.com/linkeunid/hello-go/pkg/config"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// ErrReadOnly is returned for mutations while the instance is read-only
+var ErrReadOnly = apperrors.FailedPrecondition("service is in read-only mode, only reads are served")
+
+// processMethods only change the state of the process, not of the database,
+// so they're served in read-only mode, including turning it off
+var processMethods = []string{
+	readonlypb.ReadOnlyService_SetReadOnlyMode_FullMethodName,
+	cachepb.CacheService_FlushCache_FullMethodName,
+	databasepb.DatabaseService_UpdateSQLLogging_FullMethodName,
+}
+
+// Mode tells whether an instance serves reads only.
+//
+// Reads are methods mapped to GET by their http rule, methods of the standard
+// grpc.* services and methods allowed with Allow; every other method is a
+// mutation and fails with ErrReadOnly while the mode is enabled.
+type Mode struct {
+	mu        sync.RWMutex
+	enabled   bool
+	reason    string
+	changedAt time.Time
+	allowed   map[string]bool
+	// reads caches whether methods are reads by full method name
+	reads  sync.Map
+	logger *zap.Logger
+}
+
+// NewMode creates the read-only mode of an instance, enabled by READ_ONLY_MODE
+func NewMode(cfg *config.Config, logger *zap.Logger) *Mode {
+	m := &Mode{
+		enabled:   cfg.ReadOnly.Enabled,
+		reason:    cfg.ReadOnly.Reason,
+		changedAt: time.Now(),
+		allowed:   make(map[string]bool),
+		logger:    logger,
+	}
+	m.Allow(processMethods...)
+
+	if m.enabled {
+		logger.Warn("Read-only mode enabled, mutations are rejected", zap.String("reason", m.reason))
+	}
+	return m
+}
+
+// Allow serves methods in read-only mode although they aren't mapped to GET,
+// e.g. reads taking a request body. Call it before serving requests.
+func (m *Mode) Allow(methods ...string) {
+	for _, method := range methods {
+		m.allowed[method] = true
+	}
+}
+
+// Enabled reports whether mutations are rejected
+func (m *Mode) Enabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled
+}
+
+// State returns whether the mode is enabled, why and when it last changed
+func (m *Mode) State() (bool, string, time.Time) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled, m.reason, m.changedAt
+}
+
+// Set turns the mode on or off
+func (m *Mode) Set(enabled bool, reason string) {
+	m.mu.Lock()
+	m.enabled = enabled
+	m.reason = reason
+	m.changedAt = time.Now()
+	m.mu.Unlock()
+
+	m.logger.Warn("Read-only mode changed",
+		zap.Bool("enabled", enabled),
+		zap.String("reason", reason))
+}
+
+// Check returns ErrReadOnly if a method is a mutation and the mode is enabled
+func (m *Mode) Check(fullMethod string) error {
+	if !m.Enabled() || m.allowed[fullMethod] || m.isRead(fullMethod) {
+		return nil
+	}
+	return ErrReadOnly
+}
+
+// isRead reports whether a method only reads, from its http rule
+func (m *Mode) isRead(fullMethod string) bool {
+	if read, ok := m.reads.Load(fullMethod); ok {
+		return read.(bool)
+	}
+
+	read := strings.HasPrefix(fullMethod, "/grpc.")
+	// "/package.Service/Method" is described as "package.Service.Method"
+	name := protoreflect.FullName(strings.Replace(strings.TrimPrefix(fullMethod, "/"), "/", ".", 1))
+	if desc, err := protoregistry.GlobalFiles.FindDescriptorByName(name); err == nil {
+		if method, ok := desc.(protoreflect.MethodDescriptor); ok {
+			if rule, ok := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule); ok && rule != nil {
+				read = rule.GetGet() != ""
+			}
+		}
+	}
+
+	m.reads.Store(fullMethod, read)
+	return read
+}
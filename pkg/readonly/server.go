@@ -0,0 +1,61 @@
+package readonly
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	readonlypb "github.com/linkeunid/hello-go/api/gen/readonly"
+)
+
+// Authorizer checks that the caller may change the read-only mode, typically an admin
+type Authorizer func(ctx context.Context) error
+
+// Server implements the ReadOnlyService gRPC service on an instance's mode
+type Server struct {
+	readonlypb.UnimplementedReadOnlyServiceServer
+	mode      *Mode
+	service   string
+	authorize Authorizer
+	logger    *zap.Logger
+}
+
+// NewServer creates a ReadOnlyService for the mode of a service instance
+func NewServer(mode *Mode, service string, authorize Authorizer, logger *zap.Logger) *Server {
+	return &Server{
+		mode:      mode,
+		service:   service,
+		authorize: authorize,
+		logger:    logger,
+	}
+}
+
+// GetReadOnlyMode returns whether the instance rejects mutations
+func (s *Server) GetReadOnlyMode(ctx context.Context, req *readonlypb.GetReadOnlyModeRequest) (*readonlypb.ReadOnlyMode, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return s.state(), nil
+}
+
+// SetReadOnlyMode turns read-only mode on or off
+func (s *Server) SetReadOnlyMode(ctx context.Context, req *readonlypb.SetReadOnlyModeRequest) (*readonlypb.ReadOnlyMode, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	s.mode.Set(req.Enabled, req.Reason)
+	return s.state(), nil
+}
+
+// state returns the current mode of the instance
+func (s *Server) state() *readonlypb.ReadOnlyMode {
+	enabled, reason, changedAt := s.mode.State()
+	return &readonlypb.ReadOnlyMode{
+		Service:   s.service,
+		Enabled:   enabled,
+		Reason:    reason,
+		ChangedAt: timestamppb.New(changedAt),
+	}
+}
@@ -0,0 +1,59 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Record is a revoked token in the revoked_tokens table
+type Record struct {
+	// ID is the TokenID of the token
+	ID string `gorm:"type:varchar(64);primary_key"`
+	// ExpiresAt is when the token expires, the record can be removed from then on
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// TableName specifies the table name for the Record model
+func (Record) TableName() string {
+	return "revoked_tokens"
+}
+
+// dbStore keeps revoked tokens in the revoked_tokens table
+type dbStore struct {
+	db *gorm.DB
+}
+
+// newDBStore creates the database store, creating the revoked_tokens table if needed
+func newDBStore(db *gorm.DB) (*dbStore, error) {
+	if db == nil {
+		return nil, errors.New("the database token revocation backend needs a database connection")
+	}
+	if err := db.AutoMigrate(&Record{}); err != nil {
+		return nil, err
+	}
+	return &dbStore{db: db}, nil
+}
+
+func (s *dbStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	db := s.db.WithContext(ctx)
+
+	// Tokens that expired on their own don't need to be kept
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&Record{}).Error; err != nil {
+		return err
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Record{ID: tokenID, ExpiresAt: expiresAt}).Error
+}
+
+func (s *dbStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&Record{}).
+		Where("id = ? AND expires_at > ?", tokenID, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
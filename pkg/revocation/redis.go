@@ -0,0 +1,50 @@
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// revokedKeyPrefix prefixes the key set while a token is revoked, it expires with the token
+const revokedKeyPrefix = "revoked:"
+
+// redisStore keeps revoked tokens in Redis
+type redisStore struct {
+	client *redis.Client
+}
+
+// newRedisStore connects to Redis
+func newRedisStore(cfg *config.RedisConfig) (*redisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password.Reveal(),
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %w", cfg.Address, err)
+	}
+
+	return &redisStore{client: client}, nil
+}
+
+func (s *redisStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, revokedKeyPrefix+tokenID, 1, ttl).Err()
+}
+
+func (s *redisStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	n, err := s.client.Exists(ctx, revokedKeyPrefix+tokenID).Result()
+	return n > 0, err
+}
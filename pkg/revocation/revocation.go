@@ -0,0 +1,97 @@
+package revocation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// ErrUnknownBackend is returned for an unsupported TOKEN_REVOCATION_BACKEND
+var ErrUnknownBackend = errors.New("unknown token revocation backend")
+
+// Store keeps revoked access tokens until they expire, so tokens that were
+// logged out are rejected although their signature is still valid
+type Store interface {
+	// Revoke revokes a token until it expires
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// IsRevoked reports whether a token was revoked
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
+// TokenID identifies a signed token in the store, encrypted tokens are
+// identified by the signed token they wrap
+func TokenID(signed string) string {
+	sum := sha256.Sum256([]byte(signed))
+	return hex.EncodeToString(sum[:])
+}
+
+// SessionsID identifies the marker of a user whose sessions were all ended.
+// Caches of token validations check it, since the tokens issued before aren't
+// revoked one by one.
+func SessionsID(userID string) string {
+	return TokenID("sessions " + userID)
+}
+
+// NewStore creates the store of TOKEN_REVOCATION_BACKEND: database, the
+// revoked_tokens table, or redis. Every service validating tokens must use the
+// same store.
+func NewStore(cfg *config.Config, db *gorm.DB, logger *zap.Logger) (Store, error) {
+	var store Store
+	var err error
+	switch cfg.Auth.RevocationBackend {
+	case "database":
+		store, err = newDBStore(db)
+	case "redis":
+		store, err = newRedisStore(&cfg.Redis)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, cfg.Auth.RevocationBackend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Token revocation store ready", zap.String("backend", cfg.Auth.RevocationBackend))
+	return store, nil
+}
+
+// memoryStore keeps revoked tokens in memory, for mock services
+type memoryStore struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+// NewMemoryStore creates a store local to this process, for mock services
+func NewMemoryStore() Store {
+	return &memoryStore{revoked: make(map[string]time.Time)}
+}
+
+func (s *memoryStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, expiry := range s.revoked {
+		if expiry.Before(now) {
+			delete(s.revoked, id)
+		}
+	}
+	s.revoked[tokenID] = expiresAt
+	return nil
+}
+
+func (s *memoryStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.revoked[tokenID]
+	return ok && expiresAt.After(time.Now()), nil
+}
@@ -0,0 +1,396 @@
+// Package sentry reports crashes to Sentry or a compatible service, e.g.
+// GlitchTip, through its envelope endpoint. Reporting is disabled until Init
+// is called with a SENTRY_DSN, the functions do nothing until then.
+package sentry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/metrics"
+	"github.com/linkeunid/hello-go/pkg/startup"
+)
+
+// reportedEvents counts the events sent to Sentry by level and outcome
+var reportedEvents = metrics.NewCounterVec("sentry_events_total",
+	"Crash reports sent to SENTRY_DSN, by level and outcome", "level", "outcome")
+
+// queueSize is the number of events waiting to be sent, events reported while
+// it's full are dropped
+const queueSize = 100
+
+// modulePath marks the frames of the services' own code as in-app
+const modulePath = "github.com/linkeunid/hello-go/"
+
+// Event levels
+const (
+	// LevelFatal is the level of recovered panics and fatal log entries
+	LevelFatal = "fatal"
+	LevelError = "error"
+)
+
+// Frame is a stack frame in Sentry's format
+type Frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// Event is a crash to report
+type Event struct {
+	// Level is LevelFatal or LevelError
+	Level string
+	// Type groups the events in Sentry, e.g. the panic value's type or the log message
+	Type string
+	// Message describes this occurrence, e.g. the panic value or the error
+	Message string
+	// Logger is the name of the logger or component reporting the event
+	Logger string
+	// Frames is the stack, outermost first
+	Frames []Frame
+	// Tags are indexed by Sentry, e.g. the gRPC method
+	Tags map[string]string
+	// Extra is attached as is, e.g. the fields of a log entry
+	Extra map[string]interface{}
+	// UserID is the caller, e.g. "user:<id>"
+	UserID string
+	// TraceID links the event to the request's trace
+	TraceID string
+}
+
+// client sends events from a goroutine, so reporting never waits for Sentry
+type client struct {
+	cfg        *config.SentryConfig
+	dsn        string
+	endpoint   string
+	auth       string
+	release    string
+	serverName string
+	tags       map[string]string
+	http       *http.Client
+	queue      chan *payload
+	// pending counts the queued and in-flight events, for Flush
+	pending sync.WaitGroup
+}
+
+// payload is an encoded event
+type payload struct {
+	level string
+	body  []byte
+}
+
+// current is the client set up by Init
+var current atomic.Pointer[client]
+
+// Init sets up reporting to the SENTRY_DSN of cfg, it's disabled without one
+func Init(cfg *config.Config) error {
+	if cfg.Sentry.DSN == "" {
+		current.Store(nil)
+		return nil
+	}
+
+	dsn, err := url.Parse(cfg.Sentry.DSN.Reveal())
+	if err != nil {
+		return fmt.Errorf("invalid SENTRY_DSN: %w", err)
+	}
+	key := dsn.User.Username()
+	path := strings.TrimSuffix(dsn.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if (dsn.Scheme != "http" && dsn.Scheme != "https") || dsn.Host == "" || key == "" || project == "" {
+		return fmt.Errorf("invalid SENTRY_DSN, expected http(s)://<key>@<host>/<project>")
+	}
+
+	release := cfg.Sentry.Release
+	if release == "" {
+		release = startup.BuildVersion()
+	}
+	serverName, _ := os.Hostname()
+
+	// Events are tagged with the service, e.g. "auth", and region
+	tags := map[string]string{"service": filepath.Base(os.Args[0])}
+	if cfg.Region != "" {
+		tags["region"] = cfg.Region
+	}
+
+	c := &client{
+		cfg:        &cfg.Sentry,
+		dsn:        dsn.Redacted(),
+		endpoint:   fmt.Sprintf("%s://%s%s/api/%s/envelope/", dsn.Scheme, dsn.Host, path[:slash], project),
+		auth:       fmt.Sprintf("Sentry sentry_version=7, sentry_client=hello-go/%s, sentry_key=%s", release, key),
+		release:    release,
+		serverName: serverName,
+		tags:       tags,
+		http:       &http.Client{Timeout: cfg.Sentry.Timeout},
+		queue:      make(chan *payload, queueSize),
+	}
+	go c.run()
+	current.Store(c)
+	return nil
+}
+
+// Enabled reports whether Init set up reporting
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Capture queues an event, fatal events are sampled with SENTRY_SAMPLE_RATE
+// and errors with SENTRY_ERROR_SAMPLE_RATE. It returns the ID of the event in
+// Sentry, or "" if it wasn't reported.
+func Capture(event *Event) string {
+	c := current.Load()
+	if c == nil {
+		return ""
+	}
+
+	rate := c.cfg.SampleRate
+	if event.Level != LevelFatal {
+		rate = c.cfg.ErrorSampleRate
+	}
+	if rate < 1 && mathrand.Float64() >= rate {
+		reportedEvents.Inc(event.Level, "sampled_out")
+		return ""
+	}
+
+	id := newEventID()
+	body, err := c.encode(id, event)
+	if err != nil {
+		reportedEvents.Inc(event.Level, "encode_failed")
+		return ""
+	}
+
+	c.pending.Add(1)
+	select {
+	case c.queue <- &payload{level: event.Level, body: body}:
+		return id
+	default:
+		c.pending.Done()
+		reportedEvents.Inc(event.Level, "queue_full")
+		return ""
+	}
+}
+
+// Flush waits for the queued events to be sent, at most SENTRY_TIMEOUT
+func Flush() error {
+	c := current.Load()
+	if c == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.pending.Wait()
+		close(done)
+	}()
+
+	timeout := time.NewTimer(c.cfg.Timeout)
+	defer timeout.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("flushing crash reports timed out")
+	}
+}
+
+// run sends the queued events one at a time
+func (c *client) run() {
+	for p := range c.queue {
+		if err := c.send(p.body); err != nil {
+			reportedEvents.Inc(p.level, "failed")
+			// The logger reports to Sentry, failures go to standard error instead
+			fmt.Fprintf(os.Stderr, "Failed to report crash to %s: %v\n", c.dsn, err)
+		} else {
+			reportedEvents.Inc(p.level, "success")
+		}
+		c.pending.Done()
+	}
+}
+
+// send posts an envelope
+func (c *client) send(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", c.auth)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(message))
+}
+
+// encode encodes an event as an envelope with a single item
+func (c *client) encode(id string, event *Event) ([]byte, error) {
+	tags := make(map[string]string, len(c.tags)+len(event.Tags))
+	for name, value := range c.tags {
+		tags[name] = value
+	}
+	for name, value := range event.Tags {
+		tags[name] = value
+	}
+
+	contexts := map[string]interface{}{
+		"runtime": map[string]string{"name": "go", "version": runtime.Version()},
+		"os":      map[string]string{"name": runtime.GOOS},
+	}
+	if event.TraceID != "" {
+		contexts["trace"] = map[string]string{"trace_id": event.TraceID}
+	}
+
+	now := time.Now().UTC()
+	item := map[string]interface{}{
+		"event_id":    id,
+		"timestamp":   now.Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       event.Level,
+		"logger":      event.Logger,
+		"server_name": c.serverName,
+		"release":     c.release,
+		"tags":        tags,
+		"contexts":    contexts,
+		"extra":       event.Extra,
+		"exception": map[string]interface{}{
+			"values": []map[string]interface{}{{
+				"type":       event.Type,
+				"value":      event.Message,
+				"stacktrace": map[string]interface{}{"frames": event.Frames},
+			}},
+		},
+	}
+	if c.cfg.Environment != "" {
+		item["environment"] = c.cfg.Environment
+	}
+	if event.UserID != "" {
+		item["user"] = map[string]string{"id": event.UserID}
+	}
+
+	encoded, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	header, _ := json.Marshal(map[string]string{"event_id": id, "sent_at": now.Format(time.RFC3339Nano)})
+	itemHeader, _ := json.Marshal(map[string]interface{}{"type": "event", "length": len(encoded)})
+
+	var envelope bytes.Buffer
+	for _, line := range [][]byte{header, itemHeader, encoded} {
+		envelope.Write(line)
+		envelope.WriteByte('\n')
+	}
+	return envelope.Bytes(), nil
+}
+
+// PanicStack returns the stack of a panicking goroutine, from a deferred
+// function that recovered it. The frames of the panic itself are left out.
+func PanicStack() []Frame {
+	frames := callers()
+	// Frames up to runtime.gopanic are the deferred function's
+	for i, frame := range frames {
+		if frame.Function == "runtime.gopanic" {
+			return reverse(frames[i+1:])
+		}
+	}
+	return reverse(frames)
+}
+
+// CallerStack returns the caller's stack, leaving out the innermost frames of
+// the packages skipped, e.g. the logger's
+func CallerStack(skipped ...string) []Frame {
+	frames := callers()
+	for len(frames) > 0 && hasPackage(frames[0].Function, skipped) {
+		frames = frames[1:]
+	}
+	return reverse(frames)
+}
+
+// callers returns the current goroutine's stack above this package, innermost first
+func callers() []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(1, pcs)
+	iter := runtime.CallersFrames(pcs[:n])
+
+	var frames []Frame
+	for {
+		frame, more := iter.Next()
+		if !strings.HasPrefix(frame.Function, modulePath+"pkg/sentry.") {
+			frames = append(frames, Frame{
+				Function: frame.Function,
+				Module:   packageOf(frame.Function),
+				Filename: filepath.Base(frame.File),
+				AbsPath:  frame.File,
+				Lineno:   frame.Line,
+				InApp:    strings.HasPrefix(frame.Function, modulePath),
+			})
+		}
+		if !more {
+			return frames
+		}
+	}
+}
+
+// packageOf returns the import path of a function's package
+func packageOf(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return ""
+}
+
+// hasPackage reports whether a function is of one of the packages
+func hasPackage(function string, packages []string) bool {
+	module := packageOf(function)
+	for _, pkg := range packages {
+		if module == pkg || strings.HasPrefix(module, pkg+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// reverse orders frames outermost first, as Sentry expects
+func reverse(frames []Frame) []Frame {
+	reversed := make([]Frame, len(frames))
+	for i, frame := range frames {
+		reversed[len(frames)-1-i] = frame
+	}
+	return reversed
+}
+
+// newEventID returns a random event ID, 32 hex characters
+func newEventID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,39 @@
+package siem
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+// fileSink appends events to a file, one JSON object per line
+type fileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// newFileSink opens the file for appending, creating it if needed
+func newFileSink(path string) (sink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{file: file}, nil
+}
+
+// Write appends a line to the file
+func (s *fileSink) Write(ctx context.Context, line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
@@ -0,0 +1,50 @@
+package siem
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// kafkaSink produces events to a Kafka topic.
+// Messages are batched and sent in the background so requests don't wait for the brokers.
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+// newKafkaSink creates a producer for the topic
+func newKafkaSink(brokers []string, topic string, logger *zap.Logger) (sink, error) {
+	if len(brokers) == 0 || topic == "" {
+		return nil, errors.New("SIEM_KAFKA_BROKERS and SIEM_KAFKA_TOPIC are required")
+	}
+
+	return &kafkaSink{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 100 * time.Millisecond,
+			Async:        true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					logger.Error("Failed to produce security events",
+						zap.Int("count", len(messages)),
+						zap.Error(err))
+				}
+			},
+		},
+	}, nil
+}
+
+// Write queues a line as a message
+func (s *kafkaSink) Write(ctx context.Context, line []byte) error {
+	return s.writer.WriteMessages(ctx, kafka.Message{Value: line})
+}
+
+// Close sends the queued messages and closes the producer
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,229 @@
+package siem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	apperrors "github.com/linkeunid/hello-go/pkg/errors"
+)
+
+// SchemaVersion is the version of the event schema, bumped on incompatible changes
+const SchemaVersion = 1
+
+// Event categories
+const (
+	// CategoryAuthentication covers logins and token issuance
+	CategoryAuthentication = "authentication"
+	// CategorySession covers refresh and revocation of sessions
+	CategorySession = "session"
+	// CategoryIAM covers changes to accounts and permissions
+	CategoryIAM = "iam"
+	// CategoryAuthorization covers denied operations
+	CategoryAuthorization = "authorization"
+)
+
+// Event outcomes
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event severities, from routine to needing attention
+const (
+	SeverityInfo   = "info"
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// Actor types
+const (
+	ActorUser           = "user"
+	ActorServiceAccount = "service_account"
+	ActorService        = "service"
+	ActorAnonymous      = "anonymous"
+)
+
+// Actor is who performed the action
+type Actor struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+	// Name is the identifier the actor presented, e.g. the email of a failed login
+	Name string `json:"name,omitempty"`
+}
+
+// Target is what the action was performed on
+type Target struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Source is where the request came from
+type Source struct {
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// Event is a normalized security event.
+//
+// Events are written as one JSON object per line. Timestamp, service, environment
+// and source are filled in by the emitter.
+type Event struct {
+	SchemaVersion int       `json:"schema_version"`
+	Timestamp     time.Time `json:"timestamp"`
+	Service       string    `json:"service"`
+	Environment   string    `json:"environment"`
+	// Category groups related actions, e.g. CategoryAuthentication
+	Category string `json:"category"`
+	// Action is the dotted action name, e.g. "login"
+	Action   string `json:"action"`
+	Outcome  string `json:"outcome"`
+	Severity string `json:"severity"`
+	// Reason explains a failure, e.g. "invalid_credentials"
+	Reason  string            `json:"reason,omitempty"`
+	Actor   Actor             `json:"actor"`
+	Target  *Target           `json:"target,omitempty"`
+	Source  Source            `json:"source"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Emitter writes security events to the configured sink
+type Emitter interface {
+	// Emit writes an event. Failures are logged, they never fail the request.
+	Emit(ctx context.Context, event Event)
+	// Close flushes pending events and releases the sink
+	Close() error
+}
+
+// sink writes encoded events, one per call
+type sink interface {
+	Write(ctx context.Context, line []byte) error
+	Close() error
+}
+
+// emitter completes events and writes them to a sink
+type emitter struct {
+	cfg     *config.Config
+	service string
+	sink    sink
+	logger  *zap.Logger
+}
+
+// NewEmitter creates the emitter for the configured sink (SIEM_SINK).
+// With the "none" sink, events are discarded.
+func NewEmitter(cfg *config.Config, service string, logger *zap.Logger) (Emitter, error) {
+	var s sink
+	var err error
+	switch cfg.SIEM.Sink {
+	case "none", "":
+		return nopEmitter{}, nil
+	case "file":
+		s, err = newFileSink(cfg.SIEM.File)
+	case "syslog":
+		s, err = newSyslogSink(cfg.SIEM.SyslogNetwork, cfg.SIEM.SyslogAddress, "hello-go-"+service)
+	case "kafka":
+		s, err = newKafkaSink(cfg.SIEM.KafkaBrokers, cfg.SIEM.KafkaTopic, logger)
+	default:
+		return nil, fmt.Errorf("unsupported SIEM sink: %s", cfg.SIEM.Sink)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SIEM sink %s: %w", cfg.SIEM.Sink, err)
+	}
+
+	logger.Info("Emitting security events", zap.String("sink", cfg.SIEM.Sink))
+
+	return &emitter{
+		cfg:     cfg,
+		service: service,
+		sink:    s,
+		logger:  logger,
+	}, nil
+}
+
+// Emit writes an event
+func (e *emitter) Emit(ctx context.Context, event Event) {
+	event.SchemaVersion = SchemaVersion
+	event.Timestamp = time.Now().UTC()
+	event.Service = e.service
+	event.Environment = e.cfg.Environment
+	event.Source = SourceFromContext(ctx)
+	if event.Actor.Type == "" {
+		event.Actor.Type = ActorAnonymous
+	}
+	if event.Severity == "" {
+		event.Severity = SeverityInfo
+	}
+
+	line, err := json.Marshal(event)
+	if err == nil {
+		err = e.sink.Write(ctx, line)
+	}
+	if err != nil {
+		e.logger.Error("Failed to emit security event",
+			zap.String("category", event.Category),
+			zap.String("action", event.Action),
+			zap.Error(err))
+	}
+}
+
+// Close flushes pending events and releases the sink
+func (e *emitter) Close() error {
+	return e.sink.Close()
+}
+
+// nopEmitter discards events
+type nopEmitter struct{}
+
+// Emit discards the event
+func (nopEmitter) Emit(ctx context.Context, event Event) {}
+
+// Close does nothing
+func (nopEmitter) Close() error { return nil }
+
+// SourceFromContext returns the client address and user agent of a gRPC request.
+// Requests through the REST gateway report the HTTP client, not the gateway.
+func SourceFromContext(ctx context.Context) Source {
+	var source Source
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-forwarded-for"); len(values) > 0 {
+		// The first address is the original client
+		source.IP = strings.TrimSpace(strings.Split(values[0], ",")[0])
+	} else if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		source.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(source.IP); err == nil {
+			source.IP = host
+		}
+	}
+
+	if values := md.Get("grpcgateway-user-agent"); len(values) > 0 {
+		source.UserAgent = values[0]
+	} else if values := md.Get("user-agent"); len(values) > 0 {
+		source.UserAgent = values[0]
+	}
+
+	return source
+}
+
+// Reason describes a failure for the Reason field. Messages of domain and gRPC
+// status errors are safe to record, anything else is reported as an internal error.
+func Reason(err error) string {
+	if apperrors.KindOf(err) != apperrors.KindInternal {
+		return err.Error()
+	}
+	if st, ok := status.FromError(err); ok && st.Code() != codes.Unknown && st.Code() != codes.Internal {
+		return st.Message()
+	}
+	return "internal error"
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package siem
+
+import "errors"
+
+// newSyslogSink fails, syslog isn't available on this platform
+func newSyslogSink(network, address, tag string) (sink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,34 @@
+//go:build !windows && !plan9
+
+package siem
+
+import (
+	"context"
+	"log/syslog"
+)
+
+// syslogSink sends events to syslog with the auth facility, so they can be
+// routed separately from application logs
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+// newSyslogSink connects to a syslog daemon, the local one if address is empty
+func newSyslogSink(network, address, tag string) (sink, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_AUTH|syslog.LOG_NOTICE, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+// Write sends a line as a syslog message
+func (s *syslogSink) Write(ctx context.Context, line []byte) error {
+	_, err := s.writer.Write(line)
+	return err
+}
+
+// Close closes the connection to the syslog daemon
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
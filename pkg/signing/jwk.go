@@ -0,0 +1,146 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// JWK is a public key as JSON Web Key (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	// N and E are the modulus and exponent of RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve, X and Y are the curve and point of EC keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKS is a set of public keys, as served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK encodes an RSA or EC P-256 public key as JWK for verifying signatures
+func NewJWK(id, algorithm string, public crypto.PublicKey) (JWK, error) {
+	jwk := JWK{KeyID: id, Use: "sig", Algorithm: algorithm}
+
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encode(k.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		point, err := k.ECDH()
+		if err != nil || k.Curve != elliptic.P256() {
+			return JWK{}, fmt.Errorf("unsupported EC key, expected P-256")
+		}
+		// The uncompressed point is 0x04 followed by X and Y, 32 bytes each
+		raw := point.Bytes()
+		jwk.KeyType = "EC"
+		jwk.Curve = "P-256"
+		jwk.X = encode(raw[1:33])
+		jwk.Y = encode(raw[33:])
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", public)
+	}
+
+	return jwk, nil
+}
+
+// PublicKey decodes the public key of a JWK
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch j.KeyType {
+	case "RSA":
+		n, err := decode(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(j.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent of key %s", j.KeyID)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if j.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q of key %s", j.Curve, j.KeyID)
+		}
+		x, err := decode(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		// ECDH rejects points that aren't on the curve
+		if _, err := public.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid EC point of key %s", j.KeyID)
+		}
+		return public, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q of key %s", j.KeyType, j.KeyID)
+	}
+}
+
+// Thumbprint returns the JWK thumbprint of a public key (RFC 7638), used as its key ID
+func Thumbprint(public crypto.PublicKey) (string, error) {
+	jwk, err := NewJWK("", "", public)
+	if err != nil {
+		return "", err
+	}
+
+	// The required members in lexicographic order, without whitespace
+	var members interface{}
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Curve, jwk.KeyType, jwk.X, jwk.Y}
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return encode(sum[:]), nil
+}
+
+// encode encodes a JWK member, base64url without padding
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decode decodes a JWK member
+func decode(s string) ([]byte, error) {
+	if s == "" {
+		return nil, fmt.Errorf("missing JWK member")
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
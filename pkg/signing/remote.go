@@ -0,0 +1,155 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/httpclient"
+)
+
+const (
+	// remoteRefreshInterval is how long fetched keys are used before they're fetched again
+	remoteRefreshInterval = time.Hour
+	// remoteMinFetchInterval limits fetches for tokens with unknown key IDs,
+	// so invalid tokens can't make every request fetch the keys
+	remoteMinFetchInterval = 30 * time.Second
+	// remoteFetchTimeout bounds a fetch, validation has no context of its own
+	remoteFetchTimeout = 5 * time.Second
+)
+
+// RemoteKeySet verifies tokens with the public keys the auth service publishes
+// at its JWKS URL. Keys are cached and fetched again when a token names an
+// unknown key, e.g. after the auth service's key changed.
+type RemoteKeySet struct {
+	url    string
+	client *httpclient.Client
+	// fetches makes concurrent validations share one fetch
+	fetches singleflight.Group
+	// mu guards keys and fetchedAt, it's never held during a fetch
+	mu        sync.Mutex
+	keys      map[string]remoteKey
+	fetchedAt time.Time
+	logger    *zap.Logger
+}
+
+// remoteKey is a fetched public key with the algorithm it's used with
+type remoteKey struct {
+	algorithm string
+	public    crypto.PublicKey
+}
+
+// NewRemoteKeySet creates a key set for the JWKS at url. Keys are fetched on first use.
+func NewRemoteKeySet(url string, cfg *config.Config, logger *zap.Logger) *RemoteKeySet {
+	return &RemoteKeySet{
+		url:    url,
+		client: httpclient.New("jwks", cfg, logger),
+		keys:   make(map[string]remoteKey),
+		logger: logger,
+	}
+}
+
+// Keyfunc returns the key verifying a token, for jwt.Parse. Only RS256 and
+// ES256 tokens are accepted, the shared secret isn't known here.
+func (rs *RemoteKeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+	if alg != RS256 && alg != ES256 {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+
+	k, ok, sinceFetch := rs.key(kid)
+	switch {
+	case !ok && sinceFetch > remoteMinFetchInterval:
+		// The token can only be verified with fresh keys, wait for them
+		rs.fetches.Do(rs.url, rs.refresh)
+		k, ok, _ = rs.key(kid)
+	case ok && sinceFetch > remoteRefreshInterval:
+		// The cached key keeps verifying tokens while the keys are refreshed in
+		// the background. DoChan's channel is buffered, it needn't be read.
+		rs.fetches.DoChan(rs.url, rs.refresh)
+	}
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if k.algorithm != "" && k.algorithm != alg {
+		return nil, fmt.Errorf("key %s is not used with %s", kid, alg)
+	}
+	return k.public, nil
+}
+
+// key returns a cached key and how long ago the keys were fetched
+func (rs *RemoteKeySet) key(kid string) (remoteKey, bool, time.Duration) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	k, ok := rs.keys[kid]
+	return k, ok, time.Since(rs.fetchedAt)
+}
+
+// refresh replaces the cached keys with the published ones, run through
+// rs.fetches so concurrent validations share one fetch. Keys fetched within
+// remoteMinFetchInterval aren't fetched again, and the cached keys stay in use
+// if the fetch fails.
+func (rs *RemoteKeySet) refresh() (interface{}, error) {
+	rs.mu.Lock()
+	recent := time.Since(rs.fetchedAt) <= remoteMinFetchInterval
+	if !recent {
+		// Failed fetches count as well, so they're retried after remoteMinFetchInterval
+		rs.fetchedAt = time.Now()
+	}
+	rs.mu.Unlock()
+	if recent {
+		return nil, nil
+	}
+
+	keys, err := rs.fetch()
+	if err != nil {
+		// Keep using the cached keys while the auth service is unreachable
+		rs.logger.Warn("Failed to fetch JWKS", zap.String("url", rs.url), zap.Error(err))
+		return nil, nil
+	}
+
+	rs.mu.Lock()
+	rs.keys = keys
+	rs.mu.Unlock()
+	return nil, nil
+}
+
+// fetch returns the published keys
+func (rs *RemoteKeySet) fetch() (map[string]remoteKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteFetchTimeout)
+	defer cancel()
+
+	resp, err := rs.client.Get(ctx, rs.url)
+	if err != nil {
+		return nil, err
+	}
+	var set JWKS
+	if err := httpclient.DecodeJSON(resp, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]remoteKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		public, err := jwk.PublicKey()
+		if err != nil {
+			rs.logger.Warn("Skipping invalid JWK", zap.String("kid", jwk.KeyID), zap.Error(err))
+			continue
+		}
+		keys[jwk.KeyID] = remoteKey{algorithm: jwk.Algorithm, public: public}
+	}
+
+	rs.logger.Debug("Fetched JWKS", zap.String("url", rs.url), zap.Int("keys", len(keys)))
+	return keys, nil
+}
@@ -0,0 +1,298 @@
+// Package signing manages the keys the auth service signs tokens with. With
+// an asymmetric algorithm the public keys are published as JWKS, so other
+// services validate tokens without sharing a secret.
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// Signing algorithms
+const (
+	// HS256 signs with the shared JWT_SECRET, nothing is published
+	HS256 = "HS256"
+	// RS256 signs with an RSA key of at least 2048 bits
+	RS256 = "RS256"
+	// ES256 signs with an ECDSA P-256 key
+	ES256 = "ES256"
+)
+
+// minRSABits is the smallest RSA key accepted for RS256
+const minRSABits = 2048
+
+// ErrUnknownKey is returned for tokens signed with a key that isn't in the set
+var ErrUnknownKey = errors.New("token signed with an unknown key")
+
+// key is a signing key, asymmetric or the shared secret of HS256
+type key struct {
+	id        string
+	algorithm string
+	private   crypto.Signer
+	secret    []byte
+}
+
+// signingKey returns the key signing tokens, for jwt.Token.SignedString
+func (k *key) signingKey() interface{} {
+	if k.secret != nil {
+		return k.secret
+	}
+	return k.private
+}
+
+// verifyingKey returns the key verifying tokens, for jwt.Parse
+func (k *key) verifyingKey() interface{} {
+	if k.secret != nil {
+		return k.secret
+	}
+	return k.private.Public()
+}
+
+// KeySet signs tokens and verifies the ones it signed. During a rotation it
+// holds the previous key as well, so tokens signed with it stay valid until
+// they expire.
+type KeySet struct {
+	algorithm string
+	// signer signs new tokens
+	signer *key
+	// keys are the keys tokens are accepted from, by key ID
+	keys   map[string]*key
+	logger *zap.Logger
+}
+
+// NewKeySet creates the key set configured by JWT_SIGNING_ALGORITHM. The
+// private key of RS256 and ES256 is read from JWT_SIGNING_KEY_FILE, a PEM
+// file. Without one a key is generated, which only the running instance knows.
+// JWT_PREVIOUS_SECRET or JWT_PREVIOUS_SIGNING_KEY_FILE add the key being
+// rotated out, which only verifies tokens.
+func NewKeySet(cfg *config.Config, logger *zap.Logger) (*KeySet, error) {
+	ks := &KeySet{
+		algorithm: cfg.Auth.SigningAlgorithm,
+		keys:      make(map[string]*key),
+		logger:    logger,
+	}
+	if ks.algorithm == HS256 {
+		ks.addSecrets(cfg)
+		return ks, nil
+	}
+
+	var (
+		private crypto.Signer
+		err     error
+	)
+	if cfg.Auth.SigningKeyFile != "" {
+		private, err = loadKey(cfg.Auth.SigningKeyFile)
+	} else {
+		logger.Warn("No JWT_SIGNING_KEY_FILE set, generating a signing key, tokens become invalid on restart and aren't accepted by other replicas",
+			zap.String("algorithm", ks.algorithm))
+		private, err = generateKey(ks.algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ks.signer, err = ks.addKey(private); err != nil {
+		return nil, err
+	}
+	logger.Info("Loaded token signing key",
+		zap.String("algorithm", ks.algorithm),
+		zap.String("kid", ks.signer.id))
+
+	if cfg.Auth.PreviousSigningKeyFile != "" {
+		private, err := loadKey(cfg.Auth.PreviousSigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("previous signing key: %w", err)
+		}
+		previous, err := ks.addKey(private)
+		if err != nil {
+			return nil, fmt.Errorf("previous signing key: %w", err)
+		}
+		logger.Info("Loaded previous token signing key, tokens signed with it are accepted until they expire",
+			zap.String("kid", previous.id))
+	}
+
+	return ks, nil
+}
+
+// SecretKeyfunc returns a jwt.Keyfunc verifying HS256 tokens with JWT_SECRET
+// and JWT_PREVIOUS_SECRET, for services validating tokens with the shared secret
+func SecretKeyfunc(cfg *config.Config) jwt.Keyfunc {
+	ks := &KeySet{algorithm: HS256, keys: make(map[string]*key), logger: zap.NewNop()}
+	ks.addSecrets(cfg)
+	return ks.Keyfunc
+}
+
+// addSecrets adds the HS256 keys of the configured secrets, signing with JWT_SECRET
+func (ks *KeySet) addSecrets(cfg *config.Config) {
+	ks.signer = newSecretKey(cfg.Auth.JWTSecret.Reveal())
+	ks.keys[ks.signer.id] = ks.signer
+	if cfg.Auth.PreviousJWTSecret != "" {
+		previous := newSecretKey(cfg.Auth.PreviousJWTSecret.Reveal())
+		ks.keys[previous.id] = previous
+	}
+}
+
+// addKey checks that a private key can sign with the set's algorithm and adds it
+func (ks *KeySet) addKey(private crypto.Signer) (*key, error) {
+	if err := checkKey(ks.algorithm, private); err != nil {
+		return nil, err
+	}
+	id, err := Thumbprint(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	k := &key{id: id, algorithm: ks.algorithm, private: private}
+	ks.keys[id] = k
+	return k, nil
+}
+
+// newSecretKey returns the HS256 key of a shared secret. Its ID is derived
+// with HMAC, so it doesn't reveal anything about the secret.
+func newSecretKey(secret string) *key {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("kid"))
+	return &key{id: encode(mac.Sum(nil)[:12]), algorithm: HS256, secret: []byte(secret)}
+}
+
+// Algorithm returns the algorithm new tokens are signed with
+func (ks *KeySet) Algorithm() string {
+	return ks.algorithm
+}
+
+// Sign signs a token with the given claims, naming the key in the "kid" header
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(ks.signer.algorithm), claims)
+	token.Header["kid"] = ks.signer.id
+	return token.SignedString(ks.signer.signingKey())
+}
+
+// Keyfunc returns the key verifying a token, for jwt.Parse. Only tokens signed
+// with the configured algorithm and one of the set's keys are accepted.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != ks.algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && ks.algorithm == HS256 {
+		// HS256 tokens issued before key IDs were added
+		return ks.signer.verifyingKey(), nil
+	}
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return k.verifyingKey(), nil
+}
+
+// JWKS returns the public keys of the set, empty for HS256
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		if k.secret != nil {
+			continue
+		}
+		jwk, err := NewJWK(k.id, k.algorithm, k.private.Public())
+		if err != nil {
+			ks.logger.Error("Failed to encode public key", zap.String("kid", k.id), zap.Error(err))
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// Handler serves the public keys as JWKS, e.g. at /.well-known/jwks.json
+func (ks *KeySet) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		// Clients refetch on an unknown kid, so caching doesn't delay new keys
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		if err := json.NewEncoder(w).Encode(ks.JWKS()); err != nil {
+			ks.logger.Error("Failed to write JWKS", zap.Error(err))
+		}
+	})
+}
+
+// loadKey reads a PEM private key: PKCS#8, PKCS#1 (RSA) or SEC 1 (EC)
+func loadKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not PEM encoded", path)
+	}
+
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := parsed.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("signing key %s is neither an RSA nor an EC key", path)
+	}
+	if rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return rsaKey, nil
+	}
+	if ecKey, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return ecKey, nil
+	}
+	return nil, fmt.Errorf("failed to parse signing key %s, expected a PKCS#8, PKCS#1 or SEC 1 private key", path)
+}
+
+// generateKey generates a key for algorithm
+func generateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case RS256:
+		return rsa.GenerateKey(rand.Reader, minRSABits)
+	case ES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+}
+
+// checkKey checks that a key can sign with algorithm
+func checkKey(algorithm string, private crypto.Signer) error {
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != RS256 {
+			return fmt.Errorf("signing key is an RSA key, %s needs an EC P-256 key", algorithm)
+		}
+		if k.N.BitLen() < minRSABits {
+			return fmt.Errorf("signing key has %d bits, RS256 needs at least %d", k.N.BitLen(), minRSABits)
+		}
+	case *ecdsa.PrivateKey:
+		if algorithm != ES256 {
+			return fmt.Errorf("signing key is an EC key, %s needs an RSA key", algorithm)
+		}
+		if k.Curve != elliptic.P256() {
+			return fmt.Errorf("signing key uses %s, ES256 needs P-256", k.Curve.Params().Name)
+		}
+	default:
+		return fmt.Errorf("unsupported signing key type %T", private)
+	}
+	return nil
+}
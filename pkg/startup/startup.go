@@ -0,0 +1,132 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+
+	statuspb "github.com/linkeunid/hello-go/api/gen/status"
+	"github.com/linkeunid/hello-go/pkg/config"
+	"github.com/linkeunid/hello-go/pkg/health"
+)
+
+// Version is the release version, set at build time with
+// -ldflags "-X github.com/linkeunid/hello-go/pkg/startup.Version=v1.2.3"
+var Version = ""
+
+// ErrPreflightFailed is returned in strict mode when a critical dependency is unavailable
+var ErrPreflightFailed = errors.New("preflight failed")
+
+// Summary describes a starting service
+type Summary struct {
+	// Service is the name of the service, e.g. "user"
+	Service string
+	// Ports maps listener names to ports, e.g. "http" -> 8082
+	Ports map[string]int
+	// Features lists optional behavior and whether it is enabled
+	Features map[string]bool
+	// Settings lists noteworthy non-boolean settings, e.g. the registration mode
+	Settings map[string]string
+}
+
+// BuildVersion returns Version, or the VCS revision the binary was built from
+func BuildVersion() string {
+	if Version != "" {
+		return Version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "dev"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// Preflight checks the service's dependencies and logs a structured startup summary.
+//
+// Checks are retried until every critical dependency is healthy or
+// STARTUP_PREFLIGHT_TIMEOUT elapses, since dependencies are often started at the
+// same time. With STRICT_STARTUP, ErrPreflightFailed is returned if a critical
+// dependency is still unavailable; otherwise the service starts degraded.
+func Preflight(ctx context.Context, cfg *config.Config, logger *zap.Logger, checker *health.Checker, summary Summary) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Startup.PreflightTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	res, _ := checker.GetStatus(ctx, &statuspb.GetStatusRequest{})
+retry:
+	for res.Level == statuspb.Level_LEVEL_UNHEALTHY {
+		select {
+		case <-ctx.Done():
+			break retry
+		case <-ticker.C:
+			res, _ = checker.GetStatus(ctx, &statuspb.GetStatusRequest{})
+		}
+	}
+
+	// Log the dependencies as a structured list
+	dependencies := make([]map[string]interface{}, 0, len(res.Dependencies))
+	for _, dependency := range res.Dependencies {
+		entry := map[string]interface{}{
+			"name":       dependency.Name,
+			"level":      dependency.Level.String(),
+			"critical":   dependency.Critical,
+			"latency_ms": dependency.LatencyMs,
+		}
+		if dependency.Message != "" {
+			entry["message"] = dependency.Message
+		}
+		dependencies = append(dependencies, entry)
+	}
+
+	fields := []zap.Field{
+		zap.String("service", summary.Service),
+		zap.String("version", BuildVersion()),
+		zap.String("go_version", runtime.Version()),
+		zap.String("environment", cfg.Environment),
+		zap.Any("ports", summary.Ports),
+		zap.Any("features", summary.Features),
+		zap.Any("settings", summary.Settings),
+		zap.String("status", res.Level.String()),
+		zap.Any("dependencies", dependencies),
+		zap.Bool("strict", cfg.Startup.Strict),
+	}
+
+	if res.Level == statuspb.Level_LEVEL_UNHEALTHY {
+		if cfg.Startup.Strict {
+			logger.Error("Startup preflight failed, refusing to start", fields...)
+			return fmt.Errorf("%w: critical dependencies are unavailable", ErrPreflightFailed)
+		}
+		logger.Warn("Starting with unavailable critical dependencies", fields...)
+		return nil
+	}
+
+	logger.Info("Startup preflight passed", fields...)
+	return nil
+}
@@ -0,0 +1,138 @@
+package svid
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// fetchTimeout bounds waiting for the first SVID from the Workload API
+const fetchTimeout = 30 * time.Second
+
+// Source provides this workload's X.509 SVID and the trust bundles from the
+// SPIFFE Workload API, e.g. a SPIRE agent.
+//
+// The SVID is rotated by the agent before it expires and the source picks up
+// the new one, so connections made after a rotation use it without a restart.
+type Source struct {
+	source *workloadapi.X509Source
+	id     spiffeid.ID
+	logger *zap.Logger
+	done   chan struct{}
+}
+
+// NewSource connects to the Workload API and waits for the first SVID
+func NewSource(cfg *config.Config, logger *zap.Logger) (*Source, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	var opts []workloadapi.X509SourceOption
+	if cfg.SPIFFE.EndpointSocket != "" {
+		opts = append(opts, workloadapi.WithClientOptions(workloadapi.WithAddr(cfg.SPIFFE.EndpointSocket)))
+	}
+
+	source, err := workloadapi.NewX509Source(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch SVID from the workload API: %w", err)
+	}
+
+	svid, err := source.GetX509SVID()
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+
+	logger.Info("Obtained SVID",
+		zap.String("spiffe_id", svid.ID.String()),
+		zap.Time("expires_at", svid.Certificates[0].NotAfter))
+
+	s := &Source{
+		source: source,
+		id:     svid.ID,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+	go s.watch()
+
+	return s, nil
+}
+
+// watch logs SVID rotations until the source is closed
+func (s *Source) watch() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.source.Updated():
+			svid, err := s.source.GetX509SVID()
+			if err != nil {
+				continue
+			}
+			s.logger.Info("SVID rotated",
+				zap.String("spiffe_id", svid.ID.String()),
+				zap.Time("expires_at", svid.Certificates[0].NotAfter))
+		}
+	}
+}
+
+// ID returns the SPIFFE ID of this workload
+func (s *Source) ID() spiffeid.ID {
+	return s.id
+}
+
+// ServerCredentials returns mTLS credentials for a gRPC server that accepts the
+// given SPIFFE IDs and this workload's own ID, which its gateway connects with.
+// Without IDs, any workload of the same trust domain is accepted.
+func (s *Source) ServerCredentials(allowed []string) (credentials.TransportCredentials, error) {
+	authorizer, err := s.authorizer(allowed, s.id)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(tlsconfig.MTLSServerConfig(s.source, s.source, authorizer)), nil
+}
+
+// ClientCredentials returns mTLS credentials for connecting to the server with
+// the given SPIFFE ID. Without an ID, any server of the same trust domain is accepted.
+func (s *Source) ClientCredentials(serverID string) (credentials.TransportCredentials, error) {
+	var allowed []string
+	if serverID != "" {
+		allowed = []string{serverID}
+	}
+
+	authorizer, err := s.authorizer(allowed)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(tlsconfig.MTLSClientConfig(s.source, s.source, authorizer)), nil
+}
+
+// authorizer accepts the allowed IDs, or the own trust domain if there are none
+func (s *Source) authorizer(allowed []string, extra ...spiffeid.ID) (tlsconfig.Authorizer, error) {
+	if len(allowed) == 0 {
+		return tlsconfig.AuthorizeMemberOf(s.id.TrustDomain()), nil
+	}
+
+	ids := extra
+	for _, value := range allowed {
+		id, err := spiffeid.FromString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SPIFFE ID %q: %w", value, err)
+		}
+		ids = append(ids, id)
+	}
+	return tlsconfig.AuthorizeOneOf(ids...), nil
+}
+
+// Close stops watching for rotations and disconnects from the Workload API
+func (s *Source) Close() error {
+	close(s.done)
+	return s.source.Close()
+}
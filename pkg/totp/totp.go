@@ -0,0 +1,83 @@
+// Package totp implements time-based one-time passwords (RFC 6238) as shown
+// by authenticator apps: 6 digits, a new code every 30 seconds, HMAC-SHA1.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period is how long a code is valid
+	Period = 30 * time.Second
+	// Digits is the length of a code
+	Digits = 6
+	// skew is the number of periods before and after the current one whose
+	// codes are accepted as well, for clock drift and slow typing
+	skew = 1
+)
+
+// encoding is the base32 alphabet of secrets, unpadded as authenticator apps expect
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret, base32 encoded
+func GenerateSecret() (string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(raw), nil
+}
+
+// URI returns the otpauth:// URI of a secret, which authenticator apps read
+// from a QR code. issuer names the service and account the user.
+func URI(issuer, account, secret string) string {
+	query := url.Values{
+		"secret": {secret},
+		"issuer": {issuer},
+		"digits": {fmt.Sprint(Digits)},
+		"period": {fmt.Sprint(int(Period.Seconds()))},
+	}
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Validate checks a code against a secret at time t. It returns the time step
+// of the matching code, which callers store to reject the same code again.
+func Validate(secret, code string, t time.Time) (step int64, ok bool) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+
+	current := t.Unix() / int64(Period.Seconds())
+	for offset := int64(-skew); offset <= skew; offset++ {
+		step := current + offset
+		if subtle.ConstantTimeCompare([]byte(generate(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// generate computes the code of a time step (RFC 4226 section 5.3)
+func generate(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
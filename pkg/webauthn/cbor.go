@@ -0,0 +1,186 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// errInvalidCBOR is returned for malformed or unsupported CBOR
+var errInvalidCBOR = errors.New("invalid CBOR")
+
+// maxCBORDepth bounds the nesting of decoded items
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the CBOR item at the start of data and returns the bytes
+// after it. It supports the subset authenticators use (CTAP2 canonical CBOR):
+// integers as int64, byte and text strings, arrays, maps with integer or text
+// keys, tags, booleans, null and floats. Indefinite lengths aren't supported.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, fmt.Errorf("%w: nested too deeply", errInvalidCBOR)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end of data", errInvalidCBOR)
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	// Simple values and floats carry their value in the additional information
+	if major == 7 {
+		return decodeCBORSimple(info, data)
+	}
+
+	arg, data, err := decodeCBORArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errInvalidCBOR)
+		}
+		return int64(arg), data, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errInvalidCBOR)
+		}
+		return -1 - int64(arg), data, nil
+	case 2, 3:
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: string longer than data", errInvalidCBOR)
+		}
+		value := data[:arg]
+		if major == 3 {
+			return string(value), data[arg:], nil
+		}
+		return append([]byte(nil), value...), data[arg:], nil
+	case 4:
+		// Every item takes a byte at least
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: array longer than data", errInvalidCBOR)
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			if item, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+	case 5:
+		if arg > uint64(len(data))/2 {
+			return nil, nil, fmt.Errorf("%w: map longer than data", errInvalidCBOR)
+		}
+		entries := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value interface{}
+			if key, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key type %T", errInvalidCBOR, key)
+			}
+			if value, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			if _, ok := entries[key]; ok {
+				return nil, nil, fmt.Errorf("%w: duplicate map key %v", errInvalidCBOR, key)
+			}
+			entries[key] = value
+		}
+		return entries, data, nil
+	case 6:
+		// Tags only annotate the item that follows
+		return decodeCBORItem(data, depth+1)
+	}
+	return nil, nil, fmt.Errorf("%w: unknown major type %d", errInvalidCBOR, major)
+}
+
+// decodeCBORArgument decodes the argument of an item's initial byte
+func decodeCBORArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(data) < size {
+			return 0, nil, fmt.Errorf("%w: unexpected end of data", errInvalidCBOR)
+		}
+		var arg uint64
+		switch size {
+		case 1:
+			arg = uint64(data[0])
+		case 2:
+			arg = uint64(binary.BigEndian.Uint16(data))
+		case 4:
+			arg = uint64(binary.BigEndian.Uint32(data))
+		case 8:
+			arg = binary.BigEndian.Uint64(data)
+		}
+		return arg, data[size:], nil
+	}
+	return 0, nil, fmt.Errorf("%w: unsupported length encoding %d", errInvalidCBOR, info)
+}
+
+// decodeCBORSimple decodes a simple value or float
+func decodeCBORSimple(info byte, data []byte) (interface{}, []byte, error) {
+	switch info {
+	case 20:
+		return false, data, nil
+	case 21:
+		return true, data, nil
+	case 22, 23:
+		return nil, data, nil
+	case 25:
+		if len(data) < 2 {
+			return nil, nil, fmt.Errorf("%w: unexpected end of data", errInvalidCBOR)
+		}
+		return halfToFloat(binary.BigEndian.Uint16(data)), data[2:], nil
+	case 26:
+		if len(data) < 4 {
+			return nil, nil, fmt.Errorf("%w: unexpected end of data", errInvalidCBOR)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), data[4:], nil
+	case 27:
+		if len(data) < 8 {
+			return nil, nil, fmt.Errorf("%w: unexpected end of data", errInvalidCBOR)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[8:], nil
+	}
+	return nil, nil, fmt.Errorf("%w: unsupported simple value %d", errInvalidCBOR, info)
+}
+
+// halfToFloat converts an IEEE 754 half-precision float
+func halfToFloat(half uint16) float64 {
+	exponent := int(half>>10) & 0x1f
+	mantissa := float64(half & 0x3ff)
+
+	var value float64
+	switch exponent {
+	case 0:
+		value = math.Ldexp(mantissa, -24)
+	case 31:
+		if mantissa == 0 {
+			value = math.Inf(1)
+		} else {
+			value = math.NaN()
+		}
+	default:
+		value = math.Ldexp(mantissa+1024, exponent-25)
+	}
+	if half&0x8000 != 0 {
+		value = -value
+	}
+	return value
+}
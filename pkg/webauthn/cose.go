@@ -0,0 +1,127 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms of the credentials accepted, in order of preference
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// Algorithms are the COSE algorithms offered to authenticators when registering
+var Algorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters (RFC 9053)
+const (
+	coseKty = 1
+	coseAlg = 3
+	// coseCrv is the curve of EC2 and OKP keys, the modulus of RSA keys
+	coseCrv = -1
+	// coseX is the x coordinate of EC2 and OKP keys, the exponent of RSA keys
+	coseX = -2
+	coseY = -3
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+// minRSABits is the smallest RSA modulus accepted
+const minRSABits = 2048
+
+// ErrUnsupportedKey is returned for credential public keys of other algorithms than Algorithms
+var ErrUnsupportedKey = errors.New("unsupported credential public key")
+
+// publicKey is a credential public key
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey parses a COSE_Key, e.g. from authenticator data
+func parsePublicKey(cose []byte) (*publicKey, error) {
+	item, rest, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedKey, err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: trailing data", ErrUnsupportedKey)
+	}
+	params, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: not a map", ErrUnsupportedKey)
+	}
+
+	kty, _ := params[int64(coseKty)].(int64)
+	alg, _ := params[int64(coseAlg)].(int64)
+	crv, _ := params[int64(coseCrv)].(int64)
+	x, _ := params[int64(coseX)].([]byte)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256 && crv == coseCrvP256:
+		y, _ := params[int64(coseY)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: invalid P-256 coordinates", ErrUnsupportedKey)
+		}
+		// Reject points that aren't on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedKey, err)
+		}
+		return &publicKey{alg: alg, key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+
+	case kty == coseKtyOKP && alg == AlgEdDSA && crv == coseCrvEd25519:
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid Ed25519 key", ErrUnsupportedKey)
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == coseKtyRSA && alg == AlgRS256:
+		// RSA keys use the labels of the curve and x coordinate for n and e
+		n, _ := params[int64(coseCrv)].([]byte)
+		e := x
+		if len(n)*8 < minRSABits || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: invalid RSA key", ErrUnsupportedKey)
+		}
+		exponent := int(new(big.Int).SetBytes(e).Int64())
+		if exponent < 3 || exponent%2 == 0 {
+			return nil, fmt.Errorf("%w: invalid RSA exponent", ErrUnsupportedKey)
+		}
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}}, nil
+	}
+
+	return nil, fmt.Errorf("%w: key type %d, algorithm %d", ErrUnsupportedKey, kty, alg)
+}
+
+// verify checks a signature of the key over data
+func (k *publicKey) verify(data, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+// Package webauthn verifies the WebAuthn ceremonies of passkeys and security
+// keys (https://www.w3.org/TR/webauthn-2/): registering a credential and
+// logging in with it.
+//
+// Attestation isn't verified, relying parties request none: the credential is
+// trusted because the user registered it while logged in. Credentials can use
+// ES256, EdDSA or RS256.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/linkeunid/hello-go/pkg/config"
+)
+
+// Ceremony errors
+var (
+	ErrInvalidClientData        = errors.New("invalid client data")
+	ErrInvalidAuthenticatorData = errors.New("invalid authenticator data")
+	ErrInvalidAttestation       = errors.New("invalid attestation object")
+	ErrInvalidSignature         = errors.New("invalid assertion signature")
+	// ErrSignCountRegressed is returned when the authenticator's signature
+	// counter didn't increase, a sign the credential was cloned
+	ErrSignCountRegressed = errors.New("signature counter did not increase")
+)
+
+// Ceremony types of client data
+const (
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+)
+
+// Flags of authenticator data
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagBackupEligible   = 0x08
+	flagAttestedCredData = 0x40
+	flagExtensionData    = 0x80
+)
+
+// challengeSize is the number of random bytes of a challenge
+const challengeSize = 32
+
+// encoding encodes challenges, credential IDs and user handles as in client data
+var encoding = base64.RawURLEncoding
+
+// RelyingParty verifies the ceremonies of a site
+type RelyingParty struct {
+	// ID is the domain credentials are scoped to, e.g. "example.com"
+	ID string
+	// Name is shown by authenticators
+	Name string
+	// Origins are the origins of the pages allowed to run ceremonies, e.g. "https://app.example.com"
+	Origins  []string
+	rpIDHash [32]byte
+}
+
+// NewRelyingParty creates the relying party of WEBAUTHN_RP_ID
+func NewRelyingParty(cfg *config.Config) *RelyingParty {
+	return &RelyingParty{
+		ID:       cfg.WebAuthn.RPID,
+		Name:     cfg.WebAuthn.RPName,
+		Origins:  cfg.WebAuthn.Origins,
+		rpIDHash: sha256.Sum256([]byte(cfg.WebAuthn.RPID)),
+	}
+}
+
+// NewChallenge returns a random challenge, encoded as in client data
+func NewChallenge() (string, error) {
+	raw := make([]byte, challengeSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(raw), nil
+}
+
+// EncodeID encodes a credential ID or user handle as in client data
+func EncodeID(id []byte) string {
+	return encoding.EncodeToString(id)
+}
+
+// DecodeID decodes a credential ID or user handle encoded by EncodeID
+func DecodeID(id string) ([]byte, error) {
+	return encoding.DecodeString(id)
+}
+
+// Credential is a credential created by an authenticator
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE_Key of the credential
+	PublicKey []byte
+	Algorithm int64
+	SignCount uint32
+	// AAGUID identifies the authenticator model, zero for most passkeys
+	AAGUID []byte
+	// UserVerified reports whether the authenticator verified the user, e.g. with a PIN or biometrics
+	UserVerified bool
+	// BackupEligible reports whether the credential can be synced, i.e. is a passkey
+	BackupEligible bool
+}
+
+// Assertion is the result of logging in with a credential
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// VerifyRegistration verifies the response of navigator.credentials.create()
+// to the challenge of a registration and returns the created credential
+func (rp *RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, typeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	item, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAttestation, err)
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidAttestation
+	}
+	// The attestation statement isn't verified, see the package documentation
+	authData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing authData", ErrInvalidAttestation)
+	}
+
+	data, err := rp.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if data.credential == nil {
+		return nil, fmt.Errorf("%w: missing attested credential", ErrInvalidAuthenticatorData)
+	}
+
+	key, err := parsePublicKey(data.credential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	credential := data.credential
+	credential.Algorithm = key.alg
+	credential.SignCount = data.signCount
+	credential.UserVerified = data.flags&flagUserVerified != 0
+	credential.BackupEligible = data.flags&flagBackupEligible != 0
+	return credential, nil
+}
+
+// VerifyAssertion verifies the response of navigator.credentials.get() to the
+// challenge of a login, signed by the credential with the public key and sign
+// count stored when it was registered or last used
+func (rp *RelyingParty) VerifyAssertion(challenge string, publicKeyCOSE []byte, signCount uint32, clientDataJSON, authenticatorData, signature []byte) (*Assertion, error) {
+	if err := rp.verifyClientData(clientDataJSON, typeGet, challenge); err != nil {
+		return nil, err
+	}
+
+	data, err := rp.parseAuthenticatorData(authenticatorData)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parsePublicKey(publicKeyCOSE)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	// Authenticators without a counter, e.g. synced passkeys, always report 0
+	if (data.signCount != 0 || signCount != 0) && data.signCount <= signCount {
+		return nil, ErrSignCountRegressed
+	}
+
+	return &Assertion{
+		SignCount:    data.signCount,
+		UserVerified: data.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// clientData is the part of the client data checked, see CollectedClientData
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// verifyClientData checks the ceremony type, challenge and origin of client data
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony, challenge string) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidClientData, err)
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: type %q, expected %q", ErrInvalidClientData, data.Type, ceremony)
+	}
+	if challenge == "" || data.Challenge != challenge {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidClientData)
+	}
+	if !slices.Contains(rp.Origins, data.Origin) {
+		return fmt.Errorf("%w: origin %q not allowed", ErrInvalidClientData, data.Origin)
+	}
+	if data.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin ceremonies aren't allowed", ErrInvalidClientData)
+	}
+	return nil
+}
+
+// authenticatorData is parsed authenticator data
+type authenticatorData struct {
+	flags     byte
+	signCount uint32
+	// credential is set for registrations
+	credential *Credential
+}
+
+// parseAuthenticatorData parses authenticator data and checks that it's scoped
+// to the relying party and that the user was present
+func (rp *RelyingParty) parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	// rpIdHash, flags and signCount
+	if len(raw) < 37 {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidAuthenticatorData)
+	}
+	if !bytes.Equal(raw[:32], rp.rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: relying party ID mismatch", ErrInvalidAuthenticatorData)
+	}
+
+	data := &authenticatorData{
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	if data.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user not present", ErrInvalidAuthenticatorData)
+	}
+
+	rest := raw[37:]
+	if data.flags&flagAttestedCredData != 0 {
+		// aaguid and credentialIdLength
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: truncated attested credential data", ErrInvalidAuthenticatorData)
+		}
+		aaguid := rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return nil, fmt.Errorf("%w: invalid credential ID", ErrInvalidAuthenticatorData)
+		}
+		id := rest[:idLength]
+		rest = rest[idLength:]
+
+		// The public key is the CBOR item that follows, extensions may come after it
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: credential public key: %v", ErrInvalidAuthenticatorData, err)
+		}
+		data.credential = &Credential{
+			ID:        append([]byte(nil), id...),
+			PublicKey: append([]byte(nil), rest[:len(rest)-len(after)]...),
+			AAGUID:    append([]byte(nil), aaguid...),
+		}
+		rest = after
+	}
+	if data.flags&flagExtensionData != 0 {
+		var err error
+		if _, rest, err = decodeCBOR(rest); err != nil {
+			return nil, fmt.Errorf("%w: extensions: %v", ErrInvalidAuthenticatorData, err)
+		}
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidAuthenticatorData)
+	}
+
+	return data, nil
+}
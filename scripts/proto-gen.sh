@@ -87,5 +87,14 @@ generate_proto() {
 # Generate proto files for each service
 generate_proto "auth"
 generate_proto "user"
+generate_proto "userv2"
+generate_proto "status"
+generate_proto "operations"
+generate_proto "jobs"
+generate_proto "flightrecorder"
+generate_proto "cache"
+generate_proto "database"
+generate_proto "readonly"
+generate_proto "events"
 
 echo "Protocol buffer generation completed successfully!"
\ No newline at end of file
@@ -22,6 +22,8 @@ type User struct {
 	Email     string `gorm:"uniqueIndex;type:varchar(100)"`
 	Password  string `gorm:"type:varchar(255)"`
 	Name      string `gorm:"type:varchar(100)"`
+	Role      string `gorm:"type:varchar(20);default:'user'"`
+	Status    string `gorm:"type:varchar(20);default:'active';index"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -76,11 +78,13 @@ func main() {
 		Email    string
 		Password string
 		Name     string
+		Role     string
 	}{
 		{
 			Email:    "admin@example.com",
 			Password: "admin123",
 			Name:     "Admin User",
+			Role:     "admin",
 		},
 		{
 			Email:    "user1@example.com",
@@ -128,11 +132,18 @@ func main() {
 			zap.String("email", u.Email),
 			zap.String("user_id", userID))
 
+		// Seeded users are regular users unless stated otherwise
+		if u.Role == "" {
+			u.Role = "user"
+		}
+
 		user := User{
 			ID:        userID,
 			Email:     u.Email,
 			Password:  hashedPassword,
 			Name:      u.Name,
+			Role:      u.Role,
+			Status:    "active",
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}